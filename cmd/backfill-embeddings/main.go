@@ -0,0 +1,86 @@
+// Command backfill-embeddings embeds existing messages for semantic recall. It reads the
+// DATABASE_DSN, RECALL_* and HTTP client settings from the environment and runs until every user and
+// assistant text message has an embedding from the configured model.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/embeddings"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 64, "messages embedded per request")
+	pause := flag.Duration("pause", 200*time.Millisecond, "delay between batches, to stay under provider rate limits")
+	flag.Parse()
+
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetOutput(os.Stdout)
+
+	var dbCfg config.DatabaseConfig
+	var recallCfg config.RecallConfig
+	var retryCfg config.HTTPRetryConfig
+	var transportCfg config.HTTPTransportConfig
+	if err := envconfig.Process("", &dbCfg); err != nil {
+		logger.WithError(err).Fatal("failed to load database configuration")
+	}
+	if err := envconfig.Process("", &recallCfg); err != nil {
+		logger.WithError(err).Fatal("failed to load recall configuration")
+	}
+	if err := envconfig.Process("", &retryCfg); err != nil {
+		logger.WithError(err).Fatal("failed to load http retry configuration")
+	}
+	if err := envconfig.Process("", &transportCfg); err != nil {
+		logger.WithError(err).Fatal("failed to load http transport configuration")
+	}
+	if recallCfg.APIKey == "" {
+		logger.Fatal("RECALL_EMBEDDING_API_KEY is required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := postgres.New(ctx, dbCfg.DSN)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to connect to database")
+	}
+	defer db.Close()
+
+	httpClients, err := httpclient.NewFactory(transportCfg, retryCfg, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to configure http clients")
+	}
+	embedder, err := embeddings.NewClient(recallCfg, httpClients)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to create embeddings client")
+	}
+	recall := agent.NewMessageRecall(embedder, postgres.NewEmbeddingRepository(db.Pool()), recallCfg, logger)
+
+	total := 0
+	for ctx.Err() == nil {
+		n, err := recall.Backfill(ctx, *batchSize)
+		if err != nil {
+			logger.WithError(err).WithField("embedded", total).Fatal("backfill failed")
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+		logger.WithField("embedded", total).Info("backfill progress")
+		time.Sleep(*pause)
+	}
+	logger.WithFields(logrus.Fields{"embedded": total, "model": embedder.Model()}).Info("backfill finished")
+}
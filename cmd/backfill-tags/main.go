@@ -0,0 +1,80 @@
+// Command backfill-tags recomputes conversation topic tags from the intents and suggestions
+// stored in assistant message metadata. It reads DATABASE_DSN from the environment and
+// walks every conversation, including archived ones.
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/google/uuid"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 200, "conversations loaded per query")
+	dryRun := flag.Bool("dry-run", false, "log changes without writing them")
+	flag.Parse()
+
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetOutput(os.Stdout)
+
+	var dbCfg config.DatabaseConfig
+	if err := envconfig.Process("", &dbCfg); err != nil {
+		logger.WithError(err).Fatal("failed to load database configuration")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := postgres.New(ctx, dbCfg.DSN)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to connect to database")
+	}
+	defer db.Close()
+
+	convRepo := postgres.NewConversationRepository(db.Pool(), logger)
+	msgRepo := postgres.NewMessageRepository(db.Pool(), logger)
+
+	var scanned, updated int
+	after := uuid.Nil
+	for ctx.Err() == nil {
+		ids, err := convRepo.ListIDsAfter(ctx, after, *batchSize)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to list conversations")
+		}
+		if len(ids) == 0 {
+			break
+		}
+		for _, id := range ids {
+			msgs, err := msgRepo.GetByConversationID(ctx, id)
+			if err != nil {
+				logger.WithError(err).WithField("conversation_id", id).Fatal("failed to load messages")
+			}
+			tags := agent.TagsFromMessages(msgs)
+			scanned++
+			if *dryRun {
+				logger.WithFields(logrus.Fields{"conversation_id": id, "tags": tags}).Info("computed tags")
+				continue
+			}
+			if err := convRepo.SetTags(ctx, id, tags); err != nil {
+				logger.WithError(err).WithField("conversation_id", id).Fatal("failed to set tags")
+			}
+			if len(tags) > 0 {
+				updated++
+			}
+		}
+		after = ids[len(ids)-1]
+		logger.WithFields(logrus.Fields{"scanned": scanned, "tagged": updated}).Info("backfill progress")
+	}
+	logger.WithFields(logrus.Fields{"scanned": scanned, "tagged": updated}).Info("backfill finished")
+}
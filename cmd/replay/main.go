@@ -0,0 +1,275 @@
+// Command replay re-runs a sample of stored intent and policy replies against another prompt
+// template or model and writes the stored and replayed replies side by side, for reviewing a
+// prompt change before shipping it. It reads DATABASE_DSN, the CONTEXT_* and AGENT_* settings
+// and, unless -dry-run is set, ANTHROPIC_* from the environment. VERIFIER_URL is needed to
+// list plugins in intent prompts and to replay policy replies. Nothing is written to the
+// database; with -dry-run the sample is listed without calling the model.
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/service/plugin"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+)
+
+func main() {
+	from := flag.String("from", time.Now().UTC().AddDate(0, 0, -7).Format(time.DateOnly), "first day of replies to sample (YYYY-MM-DD or RFC 3339)")
+	to := flag.String("to", "", "day after the last replies to sample (YYYY-MM-DD or RFC 3339); default now")
+	intent := flag.String("intent", "", "only sample replies with this intent")
+	pluginID := flag.String("plugin", "", "only sample replies suggesting or building this plugin")
+	limit := flag.Int("limit", 50, "replies sampled")
+	model := flag.String("model", "", "model to replay with; default ANTHROPIC_MODEL")
+	intentPrompt := flag.String("intent-prompt", "", "file replacing the intent prompt template")
+	policyPrompt := flag.String("policy-prompt", "", "file replacing the policy builder prompt template")
+	anthropicURL := flag.String("anthropic-url", "", "Messages API base URL, e.g. a simulator; default the live API")
+	rps := flag.Float64("rps", 1, "model calls per second")
+	maxCost := flag.Float64("max-cost", 5, "stop once the estimated cost reaches this many USD; 0 for no cap")
+	format := flag.String("format", "json", "output format: json or csv")
+	out := flag.String("out", "", "output file; default stdout")
+	dryRun := flag.Bool("dry-run", false, "list the sample without calling the model")
+	flag.Parse()
+
+	// Results may go to stdout, so logs don't
+	logger := logrus.New()
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetOutput(os.Stderr)
+
+	if *format != "json" && *format != "csv" {
+		logger.Fatal("-format must be json or csv")
+	}
+	if *limit <= 0 || *rps <= 0 || *maxCost < 0 {
+		logger.Fatal("-limit and -rps must be positive and -max-cost must not be negative")
+	}
+	filter := agent.ReplayFilter{Intent: *intent, PluginID: *pluginID, Limit: *limit, To: time.Now().UTC()}
+	var err error
+	if filter.From, err = parseTime(*from); err != nil {
+		logger.WithError(err).Fatal("invalid -from")
+	}
+	if *to != "" {
+		if filter.To, err = parseTime(*to); err != nil {
+			logger.WithError(err).Fatal("invalid -to")
+		}
+	}
+
+	replayCfg := agent.ReplayConfig{Model: *model}
+	if replayCfg.IntentPrompt, err = readPrompt(*intentPrompt); err != nil {
+		logger.WithError(err).Fatal("failed to read -intent-prompt")
+	}
+	if replayCfg.PolicyPrompt, err = readPrompt(*policyPrompt); err != nil {
+		logger.WithError(err).Fatal("failed to read -policy-prompt")
+	}
+
+	var dbCfg config.DatabaseConfig
+	var ctxCfg config.ContextConfig
+	var agentCfg config.AgentConfig
+	var retryCfg config.HTTPRetryConfig
+	var transportCfg config.HTTPTransportConfig
+	for _, c := range []any{&dbCfg, &ctxCfg, &agentCfg, &retryCfg, &transportCfg} {
+		if err := envconfig.Process("", c); err != nil {
+			logger.WithError(err).Fatal("failed to load configuration")
+		}
+	}
+	var anthropicCfg config.AnthropicConfig
+	if !*dryRun {
+		if err := envconfig.Process("", &anthropicCfg); err != nil {
+			logger.WithError(err).Fatal("failed to load anthropic configuration")
+		}
+		replayCfg.Model = cmp.Or(replayCfg.Model, anthropicCfg.Model)
+		if _, ok := anthropicCfg.Prices[replayCfg.Model]; !ok && *maxCost > 0 {
+			logger.WithField("model", replayCfg.Model).Fatal("model has no price in ANTHROPIC_MODEL_PRICES, so -max-cost can't be enforced; set a price or -max-cost 0")
+		}
+	}
+
+	// Created up front so a bad path doesn't waste a paid run
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to create output file")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := postgres.New(ctx, dbCfg.DSN)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to connect to database")
+	}
+	defer db.Close()
+
+	httpClients, err := httpclient.NewFactory(transportCfg, retryCfg, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to configure http clients")
+	}
+	var anthropicClient *anthropic.Client
+	if !*dryRun {
+		anthropicClient = anthropic.NewClient(anthropicCfg.APIKey, anthropicCfg.Model, anthropicCfg.MaxConcurrent, httpClients)
+		if *anthropicURL != "" {
+			anthropicClient.WithBaseURL(*anthropicURL)
+		}
+	}
+	// Skills are cached in memory only, so the replay leaves the shared cache alone
+	var verifierClient agent.VerifierAPI
+	var pluginProvider agent.PluginSkillsProvider
+	if url := os.Getenv("VERIFIER_URL"); url != "" {
+		verifierClient = verifier.NewClient(url, httpClients)
+		pluginProvider = plugin.NewService(url, time.Hour, nil, httpClients, logger)
+	}
+
+	replayer := agent.NewReplayer(anthropicClient,
+		postgres.NewMessageRepository(db.Pool(), logger),
+		postgres.NewConversationRepository(db.Pool(), logger),
+		postgres.NewMemoryRepository(db.Pool()),
+		postgres.NewContactRepository(db.Pool()),
+		verifierClient, pluginProvider, logger, anthropicCfg.Prices, ctxCfg, agentCfg, replayCfg)
+
+	sample, err := replayer.Sample(ctx, filter)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to sample replies")
+	}
+	logger.WithField("sampled", len(sample)).Info("replay sample loaded")
+
+	results := make([]*agent.ReplayResult, 0, len(sample))
+	var spent float64
+	var failed int
+	tick := time.NewTicker(time.Duration(float64(time.Second) / *rps))
+	defer tick.Stop()
+	for i, msg := range sample {
+		if *dryRun {
+			results = append(results, replayer.Stored(msg))
+			continue
+		}
+		if *maxCost > 0 && spent >= *maxCost {
+			logger.WithFields(logrus.Fields{"cost_usd": spent, "skipped": len(sample) - i}).Warn("cost cap reached, stopping")
+			break
+		}
+		if i > 0 {
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			logger.Warn("interrupted, writing the replies replayed so far")
+			break
+		}
+
+		result := replayer.Replay(ctx, msg)
+		if result.Usage != nil {
+			spent += result.Usage.CostUSD
+		}
+		if result.Error != "" {
+			failed++
+			logger.WithFields(logrus.Fields{"message_id": msg.ID, "error": result.Error}).Warn("failed to replay reply")
+		}
+		results = append(results, result)
+	}
+
+	if *format == "csv" {
+		err = writeCSV(w, results)
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(results)
+	}
+	if err != nil {
+		logger.WithError(err).Fatal("failed to write results")
+	}
+	logger.WithFields(logrus.Fields{
+		"replayed": len(results),
+		"failed":   failed,
+		"cost_usd": spent,
+		"dry_run":  *dryRun,
+	}).Info("replay finished")
+}
+
+// parseTime reads a date or an RFC 3339 timestamp, in UTC when no zone is given.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// readPrompt returns the trimmed contents of path, or "" when no path is given.
+func readPrompt(path string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// csvHeader names the columns writeCSV writes.
+var csvHeader = []string{
+	"conversation_id", "message_id", "ability", "created_at",
+	"old_model", "new_model", "old_prompt_version", "new_prompt_version",
+	"old_intent", "new_intent", "old_plugins", "new_plugins",
+	"old_response", "new_response", "old_configuration", "new_configuration",
+	"cost_usd", "error",
+}
+
+// writeCSV writes results one row each, the stored and replayed columns side by side.
+func writeCSV(w io.Writer, results []*agent.ReplayResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, r := range results {
+		replayed := agent.ReplayReply{}
+		if r.New != nil {
+			replayed = *r.New
+		}
+		var cost string
+		if r.Usage != nil {
+			cost = strconv.FormatFloat(r.Usage.CostUSD, 'f', 6, 64)
+		}
+		row := []string{
+			r.ConversationID.String(), r.MessageID.String(), r.Ability, r.CreatedAt.Format(time.RFC3339),
+			r.Old.Model, replayed.Model, r.Old.PromptVersion, replayed.PromptVersion,
+			r.Old.Intent, replayed.Intent, strings.Join(r.Old.PluginIDs, " "), strings.Join(replayed.PluginIDs, " "),
+			r.Old.Response, replayed.Response, configurationJSON(r.Old.Configuration), configurationJSON(replayed.Configuration),
+			cost, r.Error,
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// configurationJSON renders a policy configuration for a CSV cell, empty when there is none.
+func configurationJSON(configuration map[string]any) string {
+	if len(configuration) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(configuration)
+	return string(data)
+}
@@ -11,16 +11,32 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 
 	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/ai/embeddings"
+	"github.com/vultisig/agent-backend/internal/ai/tts"
 	"github.com/vultisig/agent-backend/internal/api"
 	"github.com/vultisig/agent-backend/internal/cache/redis"
 	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
 	"github.com/vultisig/agent-backend/internal/service"
 	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/service/attachment"
+	"github.com/vultisig/agent-backend/internal/service/docs"
+	"github.com/vultisig/agent-backend/internal/service/explorer"
+	"github.com/vultisig/agent-backend/internal/service/fees"
+	"github.com/vultisig/agent-backend/internal/service/flags"
+	"github.com/vultisig/agent-backend/internal/service/names"
+	"github.com/vultisig/agent-backend/internal/service/notify"
+	"github.com/vultisig/agent-backend/internal/service/outbox"
 	"github.com/vultisig/agent-backend/internal/service/plugin"
+	"github.com/vultisig/agent-backend/internal/service/share"
+	"github.com/vultisig/agent-backend/internal/service/thorchain"
 	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/service/voice"
+	"github.com/vultisig/agent-backend/internal/storage/blob"
 	"github.com/vultisig/agent-backend/internal/storage/postgres"
 )
 
@@ -52,34 +68,188 @@ func main() {
 	defer db.Close()
 
 	// Initialize Redis client
-	redisClient, err := redis.New(cfg.Redis.URI)
+	redisClient, err := redis.New(cfg.Redis.URI, cfg.Redis.KeyPrefix)
 	if err != nil {
 		logger.WithError(err).Fatal("failed to connect to redis")
 	}
 	defer redisClient.Close()
 
+	// Shared outbound HTTP connection pool
+	httpClients, err := httpclient.NewFactory(cfg.HTTPTransport, cfg.HTTPRetry, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("failed to configure http clients")
+	}
+
 	// Initialize Anthropic client
-	anthropicClient := anthropic.NewClient(cfg.Anthropic.APIKey, cfg.Anthropic.Model)
+	anthropicClient := anthropic.NewClient(cfg.Anthropic.APIKey, cfg.Anthropic.Model, cfg.Anthropic.MaxConcurrent, httpClients)
 
 	// Initialize services
 	authService := service.NewAuthService(cfg.Server.JWTSecret)
 
 	// Initialize plugin service (skills fetched dynamically on demand)
-	pluginService := plugin.NewService(cfg.Verifier.URL, redisClient, logger)
+	pluginService := plugin.NewService(cfg.Verifier.URL, cfg.Verifier.SkillsStaleAfter, redisClient, httpClients, logger)
 
 	// Initialize verifier client
-	verifierClient := verifier.NewClient(cfg.Verifier.URL)
+	verifierClient := verifier.NewClient(cfg.Verifier.URL, httpClients)
+
+	// Warm plugin caches in the background; readiness waits for it (optional)
+	var warmer *plugin.Warmer
+	if cfg.Warm.Enabled {
+		warmer = plugin.NewWarmer(pluginService, verifierClient, cfg.Warm, logger)
+		go warmer.Run(ctx)
+	}
+
+	// Initialize docs index for grounding general answers (optional)
+	var docsRetriever agent.DocsRetriever
+	if cfg.Docs.Enabled {
+		docsIndex, err := docs.NewIndex()
+		if err != nil {
+			logger.WithError(err).Fatal("failed to load docs index")
+		}
+		logger.WithField("chunks", docsIndex.Len()).Info("docs index loaded")
+		docsRetriever = docsIndex
+	}
+
+	// Initialize ENS/SNS name resolution (optional)
+	var nameResolver agent.NameResolver
+	if cfg.NameService.Enabled {
+		nameResolver = names.NewResolver(cfg.NameService, redisClient, httpClients, logger)
+	}
+
+	// Initialize transaction status lookups (optional)
+	var txExplorer agent.TransactionExplorer
+	if cfg.Explorer.Enabled {
+		txExplorer = explorer.NewClient(cfg.Explorer, redisClient, httpClients, logger)
+	}
+
+	// Initialize THORChain swap quotes (optional)
+	var swapQuoter agent.SwapQuoter
+	if cfg.SwapQuote.Enabled {
+		swapQuoter = thorchain.NewClient(cfg.SwapQuote, redisClient, httpClients, logger)
+	}
+
+	// Initialize network fee estimates (optional)
+	var feeEstimator agent.FeeEstimator
+	if cfg.Fees.Enabled {
+		feeEstimator = fees.NewClient(cfg.Fees, redisClient, httpClients, logger)
+	}
 
 	// Initialize repositories
-	convRepo := postgres.NewConversationRepository(db.Pool())
-	msgRepo := postgres.NewMessageRepository(db.Pool())
+	convRepo := postgres.NewConversationRepository(db.Pool(), logger)
+	msgRepo := postgres.NewMessageRepository(db.Pool(), logger)
 	memRepo := postgres.NewMemoryRepository(db.Pool())
+	contactRepo := postgres.NewContactRepository(db.Pool())
+	draftRepo := postgres.NewPolicyDraftRepository(db.Pool())
+	failureRepo := postgres.NewToolParseFailureRepository(db.Pool())
+	outboxRepo := postgres.NewOutboxRepository(db.Pool())
+	keyRepo := postgres.NewPublicKeyRepository(db.Pool())
+
+	// Initialize semantic recall of older messages (optional)
+	var recall *agent.MessageRecall
+	if cfg.Recall.Enabled {
+		embedder, err := embeddings.NewClient(cfg.Recall, httpClients)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to create embeddings client")
+		}
+		recall = agent.NewMessageRecall(embedder, postgres.NewEmbeddingRepository(db.Pool()), cfg.Recall, logger)
+	}
+
+	// Initialize image attachments sent to the model (optional)
+	var attachmentService *attachment.Service
+	var attachmentLoader agent.AttachmentLoader
+	if cfg.Attachments.Enabled {
+		blobClient, err := blob.NewClient(cfg.Blob, cfg.Attachments.MaxBytes, httpClients)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to create blob client")
+		}
+		attachmentService = attachment.NewService(postgres.NewAttachmentRepository(db.Pool()), blobClient, cfg.Attachments, logger)
+		attachmentLoader = attachmentService
+	}
+
+	// Initialize voice replies for messages asking for audio (optional)
+	var voiceService *voice.Service
+	var voiceSynthesizer agent.VoiceSynthesizer
+	if cfg.TTS.Enabled {
+		synth, err := tts.NewClient(cfg.TTS, httpClients)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to create tts client")
+		}
+		blobClient, err := blob.NewClient(cfg.Blob, tts.MaxAudioBytes, httpClients)
+		if err != nil {
+			logger.WithError(err).Fatal("failed to create blob client")
+		}
+		voiceService = voice.NewService(synth, blobClient, cfg.TTS, logger)
+		voiceSynthesizer = voiceService
+	}
+
+	// Initialize outbox dispatcher; the background loop also recovers events left pending by a crash
+	outboxDispatcher := outbox.NewDispatcher(outboxRepo, logger, cfg.Outbox)
+	outboxDispatcher.Register(outbox.KindRedisSet, outbox.RedisSetHandler(redisClient))
+	dispatcherCtx, stopDispatcher := context.WithCancel(ctx)
+	defer stopDispatcher()
+	go outboxDispatcher.Run(dispatcherCtx)
+
+	// Initialize expiry notices for drafts and suggestions (optional); webhook calls go through the outbox
+	var noticeRepo *postgres.ExpiryNoticeRepository
+	if cfg.Notify.Enabled {
+		noticeRepo = postgres.NewExpiryNoticeRepository(db.Pool())
+		outboxDispatcher.Register(outbox.KindWebhook, outbox.WebhookHandler(httpClients.New(10*time.Second), cfg.Notify.WebhookURL, cfg.Notify.WebhookSecret))
+		notifier := notify.NewExpiryNotifier(noticeRepo, outboxDispatcher, logger, cfg.Notify)
+		notifierCtx, stopNotifier := context.WithCancel(ctx)
+		defer stopNotifier()
+		go notifier.Run(notifierCtx)
+	}
+
+	// Initialize operational kill switches; overrides made on other replicas arrive via pub/sub
+	flagStore := flags.NewStore(redisClient, cfg.Flags, logger)
+	flagsCtx, stopFlags := context.WithCancel(ctx)
+	defer stopFlags()
+	go flagStore.Run(flagsCtx)
 
 	// Initialize agent service
-	agentService := agent.NewAgentService(anthropicClient, msgRepo, convRepo, memRepo, redisClient, verifierClient, pluginService, logger, cfg.Anthropic.SummaryModel, cfg.Context)
+	agentService := agent.NewAgentService(agent.Deps{
+		Anthropic:     anthropicClient,
+		Messages:      msgRepo,
+		Conversations: convRepo,
+		Memory:        memRepo,
+		Contacts:      contactRepo,
+		Drafts:        draftRepo,
+		ToolFailures:  failureRepo,
+		Notices:       noticeRepo,
+		Cache:         redisClient,
+		Outbox:        outboxDispatcher,
+		Verifier:      verifierClient,
+		Plugins:       pluginService,
+		Docs:          docsRetriever,
+		Names:         nameResolver,
+		Explorer:      txExplorer,
+		Quotes:        swapQuoter,
+		Fees:          feeEstimator,
+		Attachments:   attachmentLoader,
+		Voice:         voiceSynthesizer,
+		Recall:        recall,
+		Flags:         flagStore,
+		Logger:        logger,
+	}, agent.Settings{
+		SummaryModel: cfg.Anthropic.SummaryModel,
+		Prices:       cfg.Anthropic.Prices,
+		Context:      cfg.Context,
+		Agent:        cfg.Agent,
+		Docs:         cfg.Docs,
+	})
+	// Aborts for messages processed here may arrive at another replica; they are relayed via pub/sub
+	abortsCtx, stopAborts := context.WithCancel(ctx)
+	defer stopAborts()
+	go agentService.RunAborts(abortsCtx)
+
+	// Initialize read-only conversation share links (optional)
+	var shareService *share.Service
+	if cfg.Share.Enabled {
+		shareService = share.NewService(convRepo, redisClient, cfg.Share, logger)
+	}
 
 	// Initialize API server
-	server := api.NewServer(authService, convRepo, agentService, logger)
+	server := api.NewServer(authService, convRepo, contactRepo, keyRepo, agentService, shareService, attachmentService, httpclient.NewUserURLClient(cfg.Outbound), voiceService, flagStore, pluginService, logger, cfg.Pagination, cfg.Agent.MaxContacts, cfg.Agent.MaxLabels, cfg.Agent.MaxContextAddresses, cfg.Agent.MaxTokensCap, cfg.Agent.StrictRequests)
 
 	// Create Echo server
 	e := echo.New()
@@ -90,17 +260,23 @@ func main() {
 	e.Use(middleware.Recover())
 	e.Use(middleware.CORS())
 	e.Use(middleware.RequestID())
+	e.Use(api.RequestIDContext)
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogURI:    true,
 		LogStatus: true,
 		LogMethod: true,
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			logger.WithFields(logrus.Fields{
+			fields := logrus.Fields{
 				"method":     v.Method,
 				"uri":        v.URI,
 				"status":     v.Status,
 				"request_id": c.Response().Header().Get(echo.HeaderXRequestID),
-			}).Info("request")
+			}
+			// Message routes share a path across abilities with very different latencies
+			if ability := api.GetAbility(c); ability != "" {
+				fields["ability"] = ability
+			}
+			logger.WithFields(fields).Info("request")
 			return nil
 		},
 	}))
@@ -112,13 +288,86 @@ func main() {
 		})
 	})
 
-	// Agent routes (authenticated)
+	// Readiness check (public): not ready until the startup cache warm-up has finished
+	e.GET("/readyz", func(c echo.Context) error {
+		if warmer == nil {
+			return c.JSON(http.StatusOK, map[string]any{"status": "ok"})
+		}
+		status := warmer.Status()
+		if !status.Done {
+			return c.JSON(http.StatusServiceUnavailable, map[string]any{"status": "warming", "warm": status})
+		}
+		return c.JSON(http.StatusOK, map[string]any{"status": "ok", "warm": status})
+	})
+
+	// Prometheus metrics (public, scraped internally)
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
+	// Agent routes (authenticated); bodies are capped per route, generously only where needed
+	crudLimit := api.BodyLimit(cfg.Server.MaxBodyBytes)
+	messageLimit := api.BodyLimit(cfg.Server.MaxMessageBodyBytes)
+	importLimit := api.BodyLimit(cfg.Server.MaxImportBodyBytes)
 	agent := e.Group("/agent", server.AuthMiddleware)
-	agent.POST("/conversations", server.CreateConversation)
-	agent.POST("/conversations/list", server.ListConversations)
-	agent.POST("/conversations/:id", server.GetConversation)
-	agent.DELETE("/conversations/:id", server.DeleteConversation)
-	agent.POST("/conversations/:id/messages", server.SendMessage)
+	agent.POST("/conversations", server.CreateConversation, messageLimit)
+	agent.POST("/conversations/start", server.StartConversation, messageLimit)
+	agent.POST("/conversations/list", server.ListConversations, crudLimit)
+	agent.POST("/conversations/import", server.ImportConversation, importLimit)
+	agent.POST("/conversations/bulk", server.BulkConversations, crudLimit)
+	agent.POST("/conversations/:id", server.GetConversation, crudLimit)
+	agent.DELETE("/conversations/:id", server.DeleteConversation, crudLimit)
+	agent.POST("/conversations/:id/fork", server.ForkConversation, crudLimit)
+	agent.POST("/conversations/:id/summarize", server.SummarizeConversation, crudLimit)
+	agent.GET("/conversations/:id/draft", server.GetPolicyDraft)
+	agent.POST("/conversations/:id/labels", server.AddLabels, crudLimit)
+	agent.DELETE("/conversations/:id/labels", server.RemoveLabels, crudLimit)
+	agent.POST("/conversations/:id/messages", server.SendMessage, messageLimit)
+	agent.POST("/conversations/:id/messages/list", server.ListMessages, crudLimit)
+	agent.POST("/conversations/:id/messages/abort", server.AbortMessage, crudLimit)
+	agent.POST("/conversations/:id/messages/:message_id/retry", server.RetryMessage, messageLimit)
+	agent.DELETE("/conversations/:id/messages/:message_id", server.DeleteMessage, crudLimit)
+	agent.POST("/contacts", server.CreateContact, crudLimit)
+	agent.POST("/contacts/list", server.ListContacts, crudLimit)
+	agent.PUT("/contacts/:id", server.UpdateContact, crudLimit)
+	agent.DELETE("/contacts/:id", server.DeleteContact, crudLimit)
+	agent.GET("/plugins", server.ListPlugins)
+	agent.GET("/stats", server.GetStats)
+
+	// Share links: managed by the owner, transcripts readable by anyone with the token (optional)
+	if shareService != nil {
+		agent.POST("/conversations/:id/share", server.CreateShare, crudLimit)
+		agent.DELETE("/conversations/:id/share", server.RevokeShare, crudLimit)
+		e.GET("/share/:token", server.GetSharedTranscript)
+	}
+
+	// Image attachments: uploaded ahead of the message that sends them (optional)
+	if attachmentService != nil {
+		// The body carries one image plus the multipart framing
+		agent.POST("/attachments", server.UploadAttachment, api.BodyLimit(cfg.Attachments.MaxBytes+64<<10))
+		agent.GET("/attachments/:id", server.GetAttachment)
+	}
+
+	// Voice replies: audio synthesized for messages sent with reply_format "audio" (optional)
+	if voiceService != nil {
+		agent.GET("/audio/:id", server.GetAudio)
+	}
+
+	// Admin routes (static admin token; not served without one)
+	if cfg.Server.AdminToken != "" {
+		admin := e.Group("/admin", api.AdminAuth(cfg.Server.AdminToken))
+		admin.GET("/flags", server.ListFlags)
+		admin.PUT("/flags/:name", server.SetFlag, crudLimit)
+		admin.DELETE("/flags/:name", server.ResetFlag)
+		admin.GET("/plugins/skills/status", server.GetSkillsStatus)
+		admin.GET("/stats/responses", server.GetResponseOutcomes)
+		admin.GET("/tool-failures", server.ListToolParseFailures)
+		admin.GET("/tool-failures/:id", server.GetToolParseFailure)
+		admin.GET("/conversations/:id/messages/:message_id/debug-bundle", server.GetDebugBundle)
+		admin.GET("/conversations/:id/export", server.ExportConversation)
+		admin.POST("/conversations/import", server.ImportConversationExport, importLimit)
+		admin.POST("/maintenance/public-keys/merge", server.MergePublicKeys)
+		admin.POST("/maintenance/conversations/dedupe", server.DedupeConversations)
+		admin.GET("/maintenance/conversations/dedupe", server.GetDedupeStatus)
+	}
 
 	// Start server
 	addr := fmt.Sprintf("%s:%s", cfg.Server.Host, cfg.Server.Port)
@@ -135,6 +384,7 @@ func main() {
 	<-quit
 
 	logger.Info("shutting down server")
+	stopDispatcher()
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
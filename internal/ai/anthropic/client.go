@@ -3,11 +3,17 @@ package anthropic
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/requestid"
 )
 
 const (
@@ -22,12 +28,100 @@ type Client struct {
 	model      string
 	httpClient *http.Client
 	baseURL    string
+	// sem bounds concurrent in-flight requests so traffic spikes queue here instead of
+	// tripping provider rate limits
+	sem chan struct{}
 }
 
 // Message represents a conversation message.
+// Content is either a plain string or a slice of request content blocks (e.g. []any{DocumentBlock{...}, TextBlock{...}}).
 type Message struct {
-	Role    string `json:"role"`    // "user" or "assistant"
-	Content string `json:"content"`
+	Role    string `json:"role"` // "user" or "assistant"
+	Content any    `json:"content"`
+}
+
+// TextBlock is a text content block in a request message.
+type TextBlock struct {
+	Type string `json:"type"` // "text"
+	Text string `json:"text"`
+}
+
+// NewTextBlock creates a text content block.
+func NewTextBlock(text string) TextBlock {
+	return TextBlock{Type: "text", Text: text}
+}
+
+// ToolResultBlock returns the result of a tool call to the model in a user message.
+type ToolResultBlock struct {
+	Type      string `json:"type"` // "tool_result"
+	ToolUseID string `json:"tool_use_id"`
+	Content   string `json:"content"`
+	IsError   bool   `json:"is_error,omitempty"`
+}
+
+// NewToolResultBlock creates a tool result content block for the given tool_use ID.
+func NewToolResultBlock(toolUseID, content string, isError bool) ToolResultBlock {
+	return ToolResultBlock{Type: "tool_result", ToolUseID: toolUseID, Content: content, IsError: isError}
+}
+
+// DocumentBlock is a document content block used to ground responses, optionally with citations.
+type DocumentBlock struct {
+	Type      string           `json:"type"` // "document"
+	Source    DocumentSource   `json:"source"`
+	Title     string           `json:"title,omitempty"`
+	Context   string           `json:"context,omitempty"`
+	Citations *CitationsConfig `json:"citations,omitempty"`
+}
+
+// DocumentSource holds the content of a document block.
+type DocumentSource struct {
+	Type      string `json:"type"`       // "text"
+	MediaType string `json:"media_type"` // "text/plain"
+	Data      string `json:"data"`
+}
+
+// CitationsConfig enables citations for a document block.
+type CitationsConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// NewTextDocumentBlock creates a plain-text document block with citations enabled.
+func NewTextDocumentBlock(title, text string) DocumentBlock {
+	return DocumentBlock{
+		Type: "document",
+		Source: DocumentSource{
+			Type:      "text",
+			MediaType: "text/plain",
+			Data:      text,
+		},
+		Title:     title,
+		Citations: &CitationsConfig{Enabled: true},
+	}
+}
+
+// ImageBlock is an image content block in a request message.
+type ImageBlock struct {
+	Type   string      `json:"type"` // "image"
+	Source ImageSource `json:"source"`
+}
+
+// ImageSource holds the data of an image block, base64-encoded.
+type ImageSource struct {
+	Type      string `json:"type"`       // "base64"
+	MediaType string `json:"media_type"` // "image/png", "image/jpeg", "image/gif" or "image/webp"
+	Data      string `json:"data"`
+}
+
+// NewImageBlock creates an image content block from raw image data.
+func NewImageBlock(mediaType string, data []byte) ImageBlock {
+	return ImageBlock{
+		Type: "image",
+		Source: ImageSource{
+			Type:      "base64",
+			MediaType: mediaType,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		},
+	}
 }
 
 // Tool represents a tool that Claude can use.
@@ -58,18 +152,32 @@ type Response struct {
 	ID         string         `json:"id"`
 	Type       string         `json:"type"`
 	Role       string         `json:"role"`
+	Model      string         `json:"model"`
 	Content    []ContentBlock `json:"content"`
 	StopReason string         `json:"stop_reason"`
-	Usage      Usage          `json:"usage"`
+	// StopSequence is the custom stop sequence that ended generation, if any
+	StopSequence *string `json:"stop_sequence"`
+	Usage        Usage   `json:"usage"`
 }
 
 // ContentBlock represents a content block in the response.
 type ContentBlock struct {
-	Type  string          `json:"type"` // "text" or "tool_use"
-	Text  string          `json:"text,omitempty"`
-	ID    string          `json:"id,omitempty"`
-	Name  string          `json:"name,omitempty"`
-	Input json.RawMessage `json:"input,omitempty"`
+	Type      string          `json:"type"` // "text" or "tool_use"
+	Text      string          `json:"text,omitempty"`
+	Citations []Citation      `json:"citations,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+}
+
+// Citation references the document passage supporting a text block.
+type Citation struct {
+	Type           string `json:"type"` // "char_location" for plain-text documents
+	CitedText      string `json:"cited_text"`
+	DocumentIndex  int    `json:"document_index"`
+	DocumentTitle  string `json:"document_title,omitempty"`
+	StartCharIndex int    `json:"start_char_index,omitempty"`
+	EndCharIndex   int    `json:"end_char_index,omitempty"`
 }
 
 // Usage contains token usage information.
@@ -88,18 +196,44 @@ func (e *APIError) Error() string {
 	return fmt.Sprintf("anthropic: %s: %s", e.Type, e.Message)
 }
 
-// NewClient creates a new Anthropic client.
-func NewClient(apiKey, model string) *Client {
+// NewClient creates a new Anthropic client allowing at most maxConcurrent requests in flight.
+// Overloaded and rate-limited requests are retried per the retry policy.
+func NewClient(apiKey, model string, maxConcurrent int, httpClients *httpclient.Factory) *Client {
 	return &Client{
-		apiKey:  apiKey,
-		model:   model,
-		baseURL: defaultBaseURL,
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
+		apiKey:     apiKey,
+		model:      model,
+		baseURL:    defaultBaseURL,
+		httpClient: httpClients.New(60 * time.Second),
+		sem:        make(chan struct{}, maxConcurrent),
 	}
 }
 
+// WithBaseURL points the client at another Messages API endpoint, such as a simulator
+// answering with canned responses, and returns the client.
+func (c *Client) WithBaseURL(baseURL string) *Client {
+	c.baseURL = strings.TrimSuffix(baseURL, "/")
+	return c
+}
+
+// acquire waits for a free request slot, giving up when ctx is done. The caller must
+// call release once the request completes.
+func (c *Client) acquire(ctx context.Context) error {
+	metrics.AnthropicQueueDepth.Inc()
+	defer metrics.AnthropicQueueDepth.Dec()
+
+	select {
+	case c.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release frees a request slot taken by acquire.
+func (c *Client) release() {
+	<-c.sem
+}
+
 // SendMessage sends a message to Claude and returns the response.
 func (c *Client) SendMessage(ctx context.Context, req *Request) (*Response, error) {
 	if req.Model == "" {
@@ -114,14 +248,22 @@ func (c *Client) SendMessage(ctx context.Context, req *Request) (*Response, erro
 		return nil, fmt.Errorf("marshal request: %w", err)
 	}
 
+	if err := c.acquire(ctx); err != nil {
+		return nil, fmt.Errorf("wait for request slot: %w", err)
+	}
+	defer c.release()
+
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/messages", bytes.NewReader(body))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 
+	// Generating a message has no side effects, so it is safe to retry
+	httpReq = httpclient.Idempotent(httpReq)
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("x-api-key", c.apiKey)
 	httpReq.Header.Set("anthropic-version", apiVersion)
+	requestid.SetHeader(httpReq)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
@@ -0,0 +1,176 @@
+package anthropic
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/requestid"
+)
+
+// concurrencyStub answers Messages API calls once release is closed, recording the
+// most requests it saw in flight at once.
+type concurrencyStub struct {
+	release  chan struct{}
+	inFlight atomic.Int32
+	peak     atomic.Int32
+	served   atomic.Int32
+}
+
+func (s *concurrencyStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		peak := s.peak.Load()
+		if n <= peak || s.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	<-s.release
+	s.served.Add(1)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn"}`)
+}
+
+func testClient(t *testing.T, baseURL string, maxConcurrent int) *Client {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	clients, err := httpclient.NewFactory(config.HTTPTransportConfig{}, config.HTTPRetryConfig{MaxAttempts: 1}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient("test-key", "test-model", maxConcurrent, clients).WithBaseURL(baseURL)
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool, what string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSendMessageConcurrencyLimit(t *testing.T) {
+	const (
+		limit    = 2
+		requests = 8
+	)
+	stub := &concurrencyStub{release: make(chan struct{})}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	c := testClient(t, srv.URL, limit)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, requests)
+	for range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.SendMessage(context.Background(), &Request{Messages: []Message{{Role: "user", Content: "hi"}}})
+			errs <- err
+		}()
+	}
+
+	// The rest queue for a slot rather than reaching the API
+	waitFor(t, func() bool { return stub.inFlight.Load() == limit }, "the first requests to reach the API")
+	waitFor(t, func() bool { return testutil.ToFloat64(metrics.AnthropicQueueDepth) == requests-limit }, "the queue to fill")
+
+	close(stub.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("SendMessage() error = %v", err)
+		}
+	}
+
+	if got := stub.peak.Load(); got != limit {
+		t.Errorf("peak in-flight requests = %d, want the limit %d", got, limit)
+	}
+	if got := stub.served.Load(); got != requests {
+		t.Errorf("served %d requests, want %d", got, requests)
+	}
+	if got := testutil.ToFloat64(metrics.AnthropicQueueDepth); got != 0 {
+		t.Errorf("queue depth = %v after all requests finished, want 0", got)
+	}
+}
+
+func TestSendMessageQueuedCancel(t *testing.T) {
+	stub := &concurrencyStub{release: make(chan struct{})}
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+	c := testClient(t, srv.URL, 1)
+
+	held := make(chan error, 1)
+	go func() {
+		_, err := c.SendMessage(context.Background(), &Request{Messages: []Message{{Role: "user", Content: "hi"}}})
+		held <- err
+	}()
+	waitFor(t, func() bool { return stub.inFlight.Load() == 1 }, "the first request to take the slot")
+
+	// A queued request gives up when its context ends, without reaching the API
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := c.SendMessage(ctx, &Request{Messages: []Message{{Role: "user", Content: "hi"}}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("queued SendMessage() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := testutil.ToFloat64(metrics.AnthropicQueueDepth); got != 0 {
+		t.Errorf("queue depth = %v after the queued request gave up, want 0", got)
+	}
+
+	close(stub.release)
+	if err := <-held; err != nil {
+		t.Errorf("held SendMessage() error = %v", err)
+	}
+	if got := stub.served.Load(); got != 1 {
+		t.Errorf("served %d requests, want only the one holding the slot", got)
+	}
+}
+
+func TestSendMessageForwardsRequestID(t *testing.T) {
+	headers := make(chan string, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Get(requestid.Header)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"ok"}],"stop_reason":"end_turn"}`)
+	}))
+	t.Cleanup(srv.Close)
+	c := testClient(t, srv.URL, 1)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "with request id", ctx: requestid.WithID(context.Background(), "req-123"), want: "req-123"},
+		{name: "without request id", ctx: context.Background()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := c.SendMessage(tt.ctx, &Request{Messages: []Message{{Role: "user", Content: "hi"}}}); err != nil {
+				t.Fatalf("SendMessage() error = %v", err)
+			}
+			if got := <-headers; got != tt.want {
+				t.Errorf("%s header = %q, want %q", requestid.Header, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/requestid"
+)
+
+// InputType tells providers that distinguish them whether text is stored or searched with.
+type InputType string
+
+const (
+	InputDocument InputType = "document"
+	InputQuery    InputType = "query"
+)
+
+// Embedder computes text embeddings. Implementations must return one vector per input, in
+// input order, and vectors from the same Model must be comparable.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string, inputType InputType) ([][]float32, error)
+	Model() string
+}
+
+// provider describes an OpenAI-compatible embeddings endpoint.
+type provider struct {
+	url          string
+	defaultModel string
+	// inputType is set when the provider accepts an input_type hint
+	inputType bool
+}
+
+var providers = map[string]provider{
+	"voyage": {url: "https://api.voyageai.com/v1/embeddings", defaultModel: "voyage-3.5-lite", inputType: true},
+	"openai": {url: "https://api.openai.com/v1/embeddings", defaultModel: "text-embedding-3-small"},
+}
+
+// embedRequest is the request body shared by the supported providers.
+type embedRequest struct {
+	Input     []string  `json:"input"`
+	Model     string    `json:"model"`
+	InputType InputType `json:"input_type,omitempty"`
+}
+
+// embedResponse is the subset of the response body we use.
+type embedResponse struct {
+	Data []struct {
+		Embedding []float32 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+}
+
+// Client calls a hosted embeddings API.
+type Client struct {
+	provider   provider
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// NewClient creates an embeddings Client for the configured provider.
+func NewClient(cfg config.RecallConfig, httpClients *httpclient.Factory) (*Client, error) {
+	p, ok := providers[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown embedding provider %q", cfg.Provider)
+	}
+	model := cfg.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+	return &Client{
+		provider:   p,
+		apiKey:     cfg.APIKey,
+		model:      model,
+		httpClient: httpClients.New(15 * time.Second),
+	}, nil
+}
+
+// Model returns the embedding model in use.
+func (c *Client) Model() string {
+	return c.model
+}
+
+// Embed returns one embedding per text, in order.
+func (c *Client) Embed(ctx context.Context, texts []string, inputType InputType) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	reqBody := embedRequest{Input: texts, Model: c.model}
+	if c.provider.inputType {
+		reqBody.InputType = inputType
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.provider.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	requestid.SetHeader(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("embeddings: status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result embedResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if len(result.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings: got %d vectors for %d inputs", len(result.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("embeddings: index %d out of range", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+var _ Embedder = (*Client)(nil)
@@ -0,0 +1,167 @@
+// Package tts turns reply text into speech with a hosted text-to-speech API.
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/requestid"
+)
+
+// ContentType is the format of the audio every provider is asked for.
+const ContentType = "audio/mpeg"
+
+// MaxAudioBytes caps the audio read back for one reply; a few minutes of speech fits well
+// below it.
+const MaxAudioBytes = 16 << 20
+
+// requestTimeout bounds one synthesis, retries included.
+const requestTimeout = 30 * time.Second
+
+// Synthesizer turns text into MP3 speech.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string) ([]byte, error)
+	Provider() string
+}
+
+// provider describes a text-to-speech endpoint and how to call it.
+type provider struct {
+	defaultModel string
+	defaultVoice string
+	newRequest   func(ctx context.Context, c *Client, text string) (*http.Request, error)
+}
+
+var providers = map[string]provider{
+	"openai": {
+		defaultModel: "gpt-4o-mini-tts",
+		defaultVoice: "alloy",
+		newRequest:   openAIRequest,
+	},
+	"elevenlabs": {
+		defaultModel: "eleven_flash_v2_5",
+		defaultVoice: "21m00Tcm4TlvDq8N71tn",
+		newRequest:   elevenLabsRequest,
+	},
+}
+
+// Client calls a hosted text-to-speech API.
+type Client struct {
+	name       string
+	provider   provider
+	apiKey     string
+	model      string
+	voice      string
+	httpClient *http.Client
+}
+
+// NewClient creates a text-to-speech Client for the configured provider.
+func NewClient(cfg config.TTSConfig, httpClients *httpclient.Factory) (*Client, error) {
+	p, ok := providers[cfg.Provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown tts provider %q", cfg.Provider)
+	}
+	model := cfg.Model
+	if model == "" {
+		model = p.defaultModel
+	}
+	voice := cfg.Voice
+	if voice == "" {
+		voice = p.defaultVoice
+	}
+	return &Client{
+		name:       cfg.Provider,
+		provider:   p,
+		apiKey:     cfg.APIKey,
+		model:      model,
+		voice:      voice,
+		httpClient: httpClients.New(requestTimeout),
+	}, nil
+}
+
+// Provider returns the name of the provider in use.
+func (c *Client) Provider() string {
+	return c.name
+}
+
+// Synthesize returns text spoken as MP3.
+func (c *Client) Synthesize(ctx context.Context, text string) ([]byte, error) {
+	req, err := c.provider.newRequest(ctx, c, text)
+	if err != nil {
+		return nil, err
+	}
+	requestid.SetHeader(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("tts: status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	audio, err := io.ReadAll(io.LimitReader(resp.Body, MaxAudioBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("read audio: %w", err)
+	}
+	if len(audio) > MaxAudioBytes {
+		return nil, fmt.Errorf("tts: audio is larger than %d bytes", MaxAudioBytes)
+	}
+	if len(audio) == 0 {
+		return nil, fmt.Errorf("tts: empty audio")
+	}
+	return audio, nil
+}
+
+// openAIRequest builds a request to OpenAI's speech endpoint.
+func openAIRequest(ctx context.Context, c *Client, text string) (*http.Request, error) {
+	body, err := json.Marshal(map[string]string{
+		"model":           c.model,
+		"voice":           c.voice,
+		"input":           text,
+		"response_format": "mp3",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.openai.com/v1/audio/speech", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	return req, nil
+}
+
+// elevenLabsRequest builds a request to ElevenLabs' text-to-speech endpoint, where the
+// voice is part of the path.
+func elevenLabsRequest(ctx context.Context, c *Client, text string) (*http.Request, error) {
+	body, err := json.Marshal(map[string]string{
+		"text":     text,
+		"model_id": c.model,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	endpoint := "https://api.elevenlabs.io/v1/text-to-speech/" + url.PathEscape(c.voice) + "?output_format=mp3_44100_128"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", ContentType)
+	req.Header.Set("xi-api-key", c.apiKey)
+	return req, nil
+}
+
+var _ Synthesizer = (*Client)(nil)
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/service"
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/service/flags"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// defaultOutcomeStatsDays is how many days GetResponseOutcomes reports without ?days.
+const defaultOutcomeStatsDays = 7
+
+// defaultToolParseFailures is how many failures ListToolParseFailures returns without ?limit.
+const defaultToolParseFailures = 50
+
+// SetFlagRequest is the request body for overriding a feature flag.
+type SetFlagRequest struct {
+	Enabled *bool `json:"enabled"`
+}
+
+// ListFlagsResponse is the response for listing feature flags.
+type ListFlagsResponse struct {
+	Flags []flags.Flag `json:"flags"`
+}
+
+// ListFlags returns the state of every feature flag.
+func (s *Server) ListFlags(c echo.Context) error {
+	return c.JSON(http.StatusOK, ListFlagsResponse{Flags: s.flags.List(c.Request().Context())})
+}
+
+// SetFlag overrides a feature flag on every replica.
+func (s *Server) SetFlag(c echo.Context) error {
+	var req SetFlagRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+	if req.Enabled == nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "enabled is required"})
+	}
+
+	name := c.Param("name")
+	if err := s.flags.Set(c.Request().Context(), name, *req.Enabled); err != nil {
+		return s.flagError(c, err, "failed to set feature flag")
+	}
+
+	s.logger.WithField("flag", name).WithField("enabled", *req.Enabled).Warn("feature flag overridden")
+	return c.JSON(http.StatusOK, SuccessResponse{Success: true})
+}
+
+// ResetFlag removes a feature flag override, restoring the configured default.
+func (s *Server) ResetFlag(c echo.Context) error {
+	name := c.Param("name")
+	if err := s.flags.Reset(c.Request().Context(), name); err != nil {
+		return s.flagError(c, err, "failed to reset feature flag")
+	}
+
+	s.logger.WithField("flag", name).Warn("feature flag override removed")
+	return c.JSON(http.StatusOK, SuccessResponse{Success: true})
+}
+
+// flagError maps flag store errors to responses.
+func (s *Server) flagError(c echo.Context, err error, msg string) error {
+	if errors.Is(err, flags.ErrUnknownFlag) {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	}
+	s.logger.WithError(err).Error(msg)
+	return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: msg})
+}
+
+// MergePublicKeys lowercases every stored public key, merging data split across spellings
+// that differ only by case. With ?dry_run=true it only reports what would change.
+func (s *Server) MergePublicKeys(c echo.Context) error {
+	dryRun := c.QueryParam("dry_run") == "true"
+	result, err := s.keyRepo.MergeCaseVariants(c.Request().Context(), dryRun)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to merge public key case variants")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to merge public keys"})
+	}
+
+	if !dryRun && result.MixedCaseKeys > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"mixed_case_keys":  result.MixedCaseKeys,
+			"conversations":    result.Conversations,
+			"contacts":         result.Contacts,
+			"contacts_dropped": result.ContactsDropped,
+			"memories":         result.Memories,
+			"memories_dropped": result.MemoriesDropped,
+		}).Warn("merged public key case variants")
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// DedupeConversations starts archiving near-empty duplicate conversations left by double taps
+// and client retries in the background and returns the job; GetDedupeStatus follows it. With
+// ?dry_run=true the run only reports what would be archived.
+func (s *Server) DedupeConversations(c echo.Context) error {
+	dryRun := c.QueryParam("dry_run") == "true"
+	job, err := s.agentService.StartDedupe(c.Request().Context(), dryRun)
+	if err != nil {
+		if errors.Is(err, agent.ErrDedupeRunning) {
+			return c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		}
+		s.logger.WithError(err).Error("failed to start dedupe")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to start dedupe"})
+	}
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// GetDedupeStatus returns the latest dedupe run, running or finished.
+func (s *Server) GetDedupeStatus(c echo.Context) error {
+	job := s.agentService.DedupeStatus(c.Request().Context())
+	if job == nil {
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "no dedupe run recorded"})
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+// ResponseOutcomesResponse is the response for model response outcome stats.
+type ResponseOutcomesResponse struct {
+	Days []agent.ResponseOutcomeDay `json:"days"`
+}
+
+// GetResponseOutcomes returns daily model response outcomes by ability and model, newest
+// day first. ?days selects how many days, up to agent.MaxOutcomeStatsDays.
+func (s *Server) GetResponseOutcomes(c echo.Context) error {
+	days := defaultOutcomeStatsDays
+	if raw := c.QueryParam("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > agent.MaxOutcomeStatsDays {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "days must be between 1 and " + strconv.Itoa(agent.MaxOutcomeStatsDays)})
+		}
+		days = n
+	}
+
+	stats, err := s.agentService.ResponseOutcomeStats(c.Request().Context(), days)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to get response outcome stats")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get response outcome stats"})
+	}
+	return c.JSON(http.StatusOK, ResponseOutcomesResponse{Days: stats})
+}
+
+// ListToolParseFailuresResponse is the response for listing tool parse failures.
+type ListToolParseFailuresResponse struct {
+	Failures []types.ToolParseFailure `json:"failures"`
+}
+
+// ListToolParseFailures returns the latest tool inputs that failed to parse, newest first.
+// ?limit selects how many, up to agent.MaxToolParseFailures.
+func (s *Server) ListToolParseFailures(c echo.Context) error {
+	limit := defaultToolParseFailures
+	if raw := c.QueryParam("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > agent.MaxToolParseFailures {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and " + strconv.Itoa(agent.MaxToolParseFailures)})
+		}
+		limit = n
+	}
+
+	failures, err := s.agentService.ToolParseFailures(c.Request().Context(), limit)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to list tool parse failures")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list tool parse failures"})
+	}
+	return c.JSON(http.StatusOK, ListToolParseFailuresResponse{Failures: failures})
+}
+
+// GetToolParseFailure returns a tool parse failure with its raw input.
+func (s *Server) GetToolParseFailure(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid failure id"})
+	}
+
+	failure, err := s.agentService.ToolParseFailure(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "tool parse failure not found"})
+		}
+		s.logger.WithError(err).Error("failed to get tool parse failure")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get tool parse failure"})
+	}
+	return c.JSON(http.StatusOK, failure)
+}
+
+// GetDebugBundle returns what the model was sent and answered for an assistant reply, for
+// replaying it. Addresses are masked unless ?redact=false.
+func (s *Server) GetDebugBundle(c echo.Context) error {
+	convID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid message id"})
+	}
+
+	redact := c.QueryParam("redact") != "false"
+	bundle, err := s.agentService.DebugBundle(c.Request().Context(), convID, messageID, redact)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrNotFound):
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "message not found"})
+		case errors.Is(err, agent.ErrNoGeneration):
+			return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+		}
+		s.logger.WithError(err).Error("failed to build debug bundle")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to build debug bundle"})
+	}
+
+	if !redact {
+		s.logger.WithField("message_id", messageID).Warn("unredacted debug bundle exported")
+	}
+	return c.JSONBlob(http.StatusOK, bundle)
+}
+
+// ExportConversation returns a conversation with its messages and summary, whoever owns
+// it, in the form ImportConversationExport takes back.
+func (s *Server) ExportConversation(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+
+	export, err := s.agentService.ExportConversation(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "conversation not found"})
+		}
+		s.logger.WithError(err).Error("failed to export conversation")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to export conversation"})
+	}
+
+	s.logger.WithField("conversation_id", id).Warn("conversation exported")
+	return c.JSON(http.StatusOK, export)
+}
+
+// ImportConversationExport creates a conversation from an export for the public key in the
+// body, e.g. to reproduce a user's issue locally or migrate users from another system.
+func (s *Server) ImportConversationExport(c echo.Context) error {
+	var req agent.ConversationExport
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+	publicKey, err := service.NormalizePublicKey(req.PublicKey)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid public_key"})
+	}
+	req.PublicKey = publicKey
+
+	conv, err := s.agentService.ImportExport(c.Request().Context(), &req)
+	if err != nil {
+		var invalid *agent.ImportValidationError
+		if errors.As(err, &invalid) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: invalid.Error()})
+		}
+		s.logger.WithError(err).Error("failed to import conversation export")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to import conversation"})
+	}
+	return c.JSON(http.StatusCreated, conv)
+}
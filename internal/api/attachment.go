@@ -0,0 +1,87 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/netguard"
+	"github.com/vultisig/agent-backend/internal/service/attachment"
+)
+
+// UploadAttachment handles POST /agent/attachments: it stores an image sent as the "file"
+// field of a multipart form, or fetched from the "url" field when the form has no file,
+// with the owner's key in the "public_key" field. URLs are only fetched from the hosts in
+// OUTBOUND_USER_URL_HOSTS. The returned ID is passed in a message's attachments.
+func (s *Server) UploadAttachment(c echo.Context) error {
+	publicKey := c.FormValue("public_key")
+	if !matchPublicKey(&publicKey, GetPublicKey(c)) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	var data []byte
+	if header, err := c.FormFile("file"); err == nil {
+		file, err := header.Open()
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid file"})
+		}
+		defer file.Close()
+		// One byte past the limit is enough to tell the upload is too large
+		data, err = io.ReadAll(io.LimitReader(file, s.attachments.MaxBytes()+1))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid file"})
+		}
+	} else if rawURL := c.FormValue("url"); rawURL != "" {
+		data, _, err = s.userURLs.Fetch(c.Request().Context(), rawURL)
+		switch {
+		case errors.Is(err, netguard.ErrURLNotAllowed):
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "url is not allowed"})
+		case errors.Is(err, httpclient.ErrUserURLTooLarge):
+			return c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("attachments can be at most %d bytes", s.attachments.MaxBytes())})
+		case err != nil:
+			s.logger.WithError(err).Warn("failed to fetch attachment url")
+			return c.JSON(http.StatusBadGateway, ErrorResponse{Error: "failed to fetch url"})
+		}
+	} else {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "file or url is required"})
+	}
+
+	a, err := s.attachments.Upload(c.Request().Context(), publicKey, data)
+	switch {
+	case errors.Is(err, attachment.ErrTooLarge):
+		return c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("attachments can be at most %d bytes", s.attachments.MaxBytes())})
+	case errors.Is(err, attachment.ErrEmpty), errors.Is(err, attachment.ErrUnsupportedType):
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		s.logger.WithError(err).Error("failed to upload attachment")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to upload attachment"})
+	}
+	return c.JSON(http.StatusCreated, a)
+}
+
+// GetAttachment handles GET /agent/attachments/:id: it returns an image of the caller, so
+// the history can show what was sent with a message.
+func (s *Server) GetAttachment(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid attachment id"})
+	}
+
+	img, err := s.attachments.Open(c.Request().Context(), GetPublicKey(c), id)
+	if err != nil {
+		if errors.Is(err, attachment.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "attachment not found"})
+		}
+		s.logger.WithError(err).Error("failed to get attachment")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get attachment"})
+	}
+
+	// Attachments never change, but they belong to one user
+	c.Response().Header().Set("Cache-Control", "private, max-age=86400")
+	return c.Blob(http.StatusOK, img.ContentType, img.Data)
+}
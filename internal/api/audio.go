@@ -0,0 +1,34 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/vultisig/agent-backend/internal/ai/tts"
+	"github.com/vultisig/agent-backend/internal/service/voice"
+)
+
+// GetAudio handles GET /agent/audio/:id: it returns a voice reply of the caller, as linked
+// from an assistant message's audio_url.
+func (s *Server) GetAudio(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid audio id"})
+	}
+
+	data, err := s.voice.Open(c.Request().Context(), GetPublicKey(c), id)
+	if err != nil {
+		if errors.Is(err, voice.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "audio not found"})
+		}
+		s.logger.WithError(err).Error("failed to get audio")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get audio"})
+	}
+
+	// Voice replies never change, but they belong to one user
+	c.Response().Header().Set("Cache-Control", "private, max-age=86400")
+	return c.Blob(http.StatusOK, tts.ContentType, data)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/vultisig/agent-backend/internal/service/agent"
+)
+
+// BodyLimit rejects request bodies larger than limit bytes with 413 payload_too_large before
+// the handler sees them. Bodies within the limit are buffered, so a declared Content-Length
+// can't be used to sneak a larger body past the check.
+func BodyLimit(limit int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Body == nil || req.Body == http.NoBody {
+				return next(c)
+			}
+			if req.ContentLength > limit {
+				return payloadTooLarge(c, limit)
+			}
+
+			body, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "failed to read request body"})
+			}
+			if int64(len(body)) > limit {
+				return payloadTooLarge(c, limit)
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = int64(len(body))
+			return next(c)
+		}
+	}
+}
+
+func payloadTooLarge(c echo.Context, limit int64) error {
+	return c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+		Error: fmt.Sprintf("request body exceeds %d bytes", limit),
+		Code:  agent.ErrorCodePayloadTooLarge,
+	})
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/vultisig/agent-backend/internal/service/agent"
+)
+
+const (
+	testCrudLimit    = 4 << 10
+	testMessageLimit = 256 << 10
+	testMaxAddresses = 50
+)
+
+// limitedRoutes serves the create conversation and send message routes with their body
+// limits, authenticated as testPublicKey.
+func limitedRoutes(s *Server) *echo.Echo {
+	e := echo.New()
+	g := e.Group("/agent", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("public_key", testPublicKey)
+			return next(c)
+		}
+	})
+	g.POST("/conversations", s.CreateConversation, BodyLimit(testCrudLimit))
+	g.POST("/conversations/:id/messages", s.SendMessage, BodyLimit(testMessageLimit))
+	return e
+}
+
+// walletContext returns a context with the given number of balances and addresses.
+func walletContext(balances, addresses int) *agent.MessageContext {
+	mc := &agent.MessageContext{Addresses: make(map[string]string, addresses)}
+	for i := range balances {
+		mc.Balances = append(mc.Balances, agent.Balance{Chain: "Ethereum", Symbol: fmt.Sprintf("TKN%d", i), Amount: "1", Decimals: 18})
+	}
+	for i := range addresses {
+		mc.Addresses[fmt.Sprintf("Chain%d", i)] = fmt.Sprintf("0x%040d", i)
+	}
+	return mc
+}
+
+// messageBody returns a send-message body carrying mc.
+func messageBody(content string, mc *agent.MessageContext) string {
+	data, _ := json.Marshal(agent.SendMessageRequest{PublicKey: testPublicKey, Content: content, Context: mc})
+	return string(data)
+}
+
+func TestOversizedRequestsRejectedEarly(t *testing.T) {
+	convID := uuid.New()
+	messages := "/agent/conversations/" + convID.String() + "/messages"
+	initialMessage := func(mc *agent.MessageContext) string {
+		data, _ := json.Marshal(map[string]any{
+			"public_key":      testPublicKey,
+			"initial_message": map[string]any{"content": "hi", "context": mc},
+		})
+		return string(data)
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		// chunked sends the body without a Content-Length
+		chunked    bool
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "message over the body limit",
+			target:     messages,
+			body:       messageBody(strings.Repeat("a", testMessageLimit), nil),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   agent.ErrorCodePayloadTooLarge,
+		},
+		{
+			name:       "chunked message over the body limit",
+			target:     messages,
+			body:       messageBody(strings.Repeat("a", testMessageLimit), nil),
+			chunked:    true,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   agent.ErrorCodePayloadTooLarge,
+		},
+		{
+			name:       "too many balances",
+			target:     messages,
+			body:       messageBody("hi", walletContext(agent.MaxContextBalances+1, 1)),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   agent.ErrorCodeContextTooLarge,
+		},
+		{
+			name:       "too many addresses",
+			target:     messages,
+			body:       messageBody("hi", walletContext(1, testMaxAddresses+1)),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   agent.ErrorCodeContextTooLarge,
+		},
+		{
+			name:       "largest allowed context",
+			target:     messages,
+			body:       messageBody("hi", walletContext(agent.MaxContextBalances, testMaxAddresses)),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "conversation over the body limit",
+			target:     "/agent/conversations",
+			body:       `{"public_key":"` + testPublicKey + `","title":"` + strings.Repeat("a", testCrudLimit) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   agent.ErrorCodePayloadTooLarge,
+		},
+		{
+			name:       "initial message with too many addresses",
+			target:     "/agent/conversations",
+			body:       initialMessage(walletContext(0, testMaxAddresses+1)),
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCode:   agent.ErrorCodeContextTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convs := newFakeConversations()
+			fake := &fakeAgent{convs: convs, resp: &agent.SendMessageResponse{}}
+			s := &Server{convRepo: convs, agentService: fake, maxContextAddresses: testMaxAddresses, logger: testLogger()}
+
+			var body io.Reader = strings.NewReader(tt.body)
+			if tt.chunked {
+				body = io.MultiReader(body)
+			}
+			req := httptest.NewRequest(http.MethodPost, tt.target, body)
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+			limitedRoutes(s).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %.200s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				if len(fake.calls) != 1 {
+					t.Errorf("agent got %d messages, want 1", len(fake.calls))
+				}
+				return
+			}
+
+			var errResp ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &errResp); err != nil {
+				t.Fatalf("decode error response: %v", err)
+			}
+			if errResp.Code != tt.wantCode {
+				t.Errorf("error code = %q, want %q", errResp.Code, tt.wantCode)
+			}
+			// Nothing is stored or sent to the model
+			if len(fake.calls) != 0 || len(convs.conversations) != 0 || len(convs.messages) != 0 {
+				t.Errorf("agent got %d messages and %d conversations were created, want none", len(fake.calls), len(convs.conversations))
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ContactRequest is the request body for creating or updating a contact.
+type ContactRequest struct {
+	PublicKey string `json:"public_key"`
+	Name      string `json:"name"`
+	Chain     string `json:"chain"`
+	Address   string `json:"address"`
+}
+
+// ListContactsRequest is the request body for listing contacts.
+type ListContactsRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// ListContactsResponse is the response for listing contacts.
+type ListContactsResponse struct {
+	Contacts []types.Contact `json:"contacts"`
+}
+
+// DeleteContactRequest is the request body for deleting a contact.
+type DeleteContactRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// CreateContact adds a contact to the user's address book.
+func (s *Server) CreateContact(c echo.Context) error {
+	var req ContactRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	contact := &types.Contact{
+		PublicKey: req.PublicKey,
+		Name:      req.Name,
+		Chain:     req.Chain,
+		Address:   req.Address,
+	}
+	if err := agent.NormalizeContact(contact); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	}
+
+	if err := s.contactRepo.Create(c.Request().Context(), contact, s.maxContacts); err != nil {
+		return s.contactError(c, err, "failed to create contact")
+	}
+
+	return c.JSON(http.StatusCreated, contact)
+}
+
+// ListContacts returns the user's contacts ordered by name.
+func (s *Server) ListContacts(c echo.Context) error {
+	var req ListContactsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	contacts, err := s.contactRepo.List(c.Request().Context(), req.PublicKey)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to list contacts")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list contacts"})
+	}
+
+	return c.JSON(http.StatusOK, ListContactsResponse{Contacts: contacts})
+}
+
+// UpdateContact changes a contact's name, chain and address.
+func (s *Server) UpdateContact(c echo.Context) error {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid contact id"})
+	}
+
+	var req ContactRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	contact := &types.Contact{
+		ID:        id,
+		PublicKey: req.PublicKey,
+		Name:      req.Name,
+		Chain:     req.Chain,
+		Address:   req.Address,
+	}
+	if err := agent.NormalizeContact(contact); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	}
+
+	if err := s.contactRepo.Update(c.Request().Context(), contact); err != nil {
+		return s.contactError(c, err, "failed to update contact")
+	}
+
+	return c.JSON(http.StatusOK, contact)
+}
+
+// DeleteContact removes a contact from the user's address book.
+func (s *Server) DeleteContact(c echo.Context) error {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid contact id"})
+	}
+
+	var req DeleteContactRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	if err := s.contactRepo.Delete(c.Request().Context(), id, req.PublicKey); err != nil {
+		return s.contactError(c, err, "failed to delete contact")
+	}
+
+	return c.JSON(http.StatusOK, SuccessResponse{Success: true})
+}
+
+// contactError maps contact repository errors to responses.
+func (s *Server) contactError(c echo.Context, err error, msg string) error {
+	switch {
+	case errors.Is(err, postgres.ErrNotFound):
+		return c.JSON(http.StatusNotFound, ErrorResponse{Error: "contact not found"})
+	case errors.Is(err, postgres.ErrContactExists):
+		return c.JSON(http.StatusConflict, ErrorResponse{Error: "a contact with this name already exists on this chain"})
+	case errors.Is(err, postgres.ErrContactLimit):
+		return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: "contact limit reached"})
+	}
+	s.logger.WithError(err).Error(msg)
+	return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: msg})
+}
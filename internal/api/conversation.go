@@ -1,12 +1,18 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
 
+	"github.com/vultisig/agent-backend/internal/service/agent"
 	"github.com/vultisig/agent-backend/internal/storage/postgres"
 	"github.com/vultisig/agent-backend/internal/types"
 )
@@ -14,6 +20,26 @@ import (
 // CreateConversationRequest is the request body for creating a conversation.
 type CreateConversationRequest struct {
 	PublicKey string `json:"public_key"`
+	// NoMemory keeps the conversation from reading or updating the user's memory
+	NoMemory bool `json:"no_memory,omitempty"`
+	// InitialMessage, when set, is sent as the conversation's first message before responding
+	InitialMessage *InitialMessage `json:"initial_message,omitempty"`
+}
+
+// InitialMessage is a conversation's first message, sent as part of creating it.
+type InitialMessage struct {
+	Content string                `json:"content"`
+	Context *agent.MessageContext `json:"context,omitempty"`
+}
+
+// CreateConversationResponse is the response for creating a conversation with an initial
+// message. Either Response or Error is set.
+type CreateConversationResponse struct {
+	Conversation *types.Conversation        `json:"conversation"`
+	Response     *agent.SendMessageResponse `json:"response,omitempty"`
+	// Error reports that the initial message couldn't be answered. The conversation is kept;
+	// when the message was stored its id is in details.message_id, for the retry endpoint.
+	Error *ErrorResponse `json:"error,omitempty"`
 }
 
 // ListConversationsRequest is the request body for listing conversations.
@@ -21,6 +47,11 @@ type ListConversationsRequest struct {
 	PublicKey string `json:"public_key"`
 	Skip      int    `json:"skip"`
 	Take      int    `json:"take"`
+	// Tags limits the list to conversations carrying all of these topic tags
+	Tags []string `json:"tags,omitempty"`
+	// Labels limits the list to conversations carrying all of these user labels, compared
+	// regardless of case
+	Labels []string `json:"labels,omitempty"`
 }
 
 // ListConversationsResponse is the response for listing conversations.
@@ -32,6 +63,38 @@ type ListConversationsResponse struct {
 // GetConversationRequest is the request body for getting a conversation.
 type GetConversationRequest struct {
 	PublicKey string `json:"public_key"`
+	// MinRevision is the revision a send-message response returned; the read waits briefly
+	// for the conversation to reach it, so the messages just written are included
+	MinRevision int64 `json:"min_revision,omitempty"`
+}
+
+// GetConversationResponse is a conversation with its messages and, when the user left a
+// built policy unconfirmed, that policy.
+type GetConversationResponse struct {
+	*types.ConversationWithMessages
+	PendingPolicy *agent.PendingPolicy `json:"pending_policy,omitempty"`
+}
+
+// ListMessagesRequest is the request body for listing a conversation's messages.
+type ListMessagesRequest struct {
+	PublicKey string `json:"public_key"`
+	Skip      int    `json:"skip"`
+	Take      int    `json:"take"`
+}
+
+// ListMessagesResponse is the response for listing messages.
+type ListMessagesResponse struct {
+	Messages   []types.Message `json:"messages"`
+	TotalCount int             `json:"total_count"`
+}
+
+// ForkConversationRequest is the request body for forking a conversation.
+type ForkConversationRequest struct {
+	PublicKey string `json:"public_key"`
+	// MessageID optionally limits the fork to messages up to and including this one.
+	MessageID *uuid.UUID `json:"message_id,omitempty"`
+	// SummaryOnly starts the new conversation from the source's summary without copying messages.
+	SummaryOnly bool `json:"summary_only,omitempty"`
 }
 
 // DeleteConversationRequest is the request body for deleting a conversation.
@@ -39,6 +102,22 @@ type DeleteConversationRequest struct {
 	PublicKey string `json:"public_key"`
 }
 
+// DeleteMessageRequest is the request body for deleting a single message.
+type DeleteMessageRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// LabelsRequest is the request body for adding or removing conversation labels.
+type LabelsRequest struct {
+	PublicKey string   `json:"public_key"`
+	Labels    []string `json:"labels"`
+}
+
+// LabelsResponse is the response for adding or removing conversation labels.
+type LabelsResponse struct {
+	Labels []string `json:"labels"`
+}
+
 // CreateConversation creates a new conversation.
 func (s *Server) CreateConversation(c echo.Context) error {
 	var req CreateConversationRequest
@@ -47,19 +126,127 @@ func (s *Server) CreateConversation(c echo.Context) error {
 	}
 
 	authPublicKey := GetPublicKey(c)
-	if req.PublicKey != authPublicKey {
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
 		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
 	}
+	if req.InitialMessage != nil {
+		if strings.TrimSpace(req.InitialMessage.Content) == "" {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "initial_message.content is required"})
+		}
+		if status, errResp := s.checkMessageContext(req.InitialMessage.Context); errResp != nil {
+			return c.JSON(status, errResp)
+		}
+	}
 
-	conv, err := s.convRepo.Create(c.Request().Context(), req.PublicKey)
+	ctx := c.Request().Context()
+	conv, err := s.convRepo.Create(ctx, req.PublicKey, req.NoMemory)
 	if err != nil {
 		s.logger.WithError(err).Error("failed to create conversation")
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to create conversation"})
 	}
+	if req.InitialMessage == nil {
+		return c.JSON(http.StatusCreated, conv)
+	}
+
+	// Unlike StartConversation, a failed first message keeps the conversation: the message
+	// is stored with an error reply and can be retried
+	resp, err := s.agentService.ProcessMessage(ctx, conv.ID, req.PublicKey, &agent.SendMessageRequest{
+		PublicKey:   req.PublicKey,
+		Content:     req.InitialMessage.Content,
+		Context:     req.InitialMessage.Context,
+		AccessToken: GetAccessToken(c),
+	})
+	if err != nil {
+		s.logger.WithError(err).WithField("conversation_id", conv.ID).Error("failed to process initial message")
+		return c.JSON(http.StatusCreated, CreateConversationResponse{
+			Conversation: conv,
+			Error:        s.initialMessageError(ctx, conv.ID, req.PublicKey),
+		})
+	}
+	return c.JSON(http.StatusCreated, CreateConversationResponse{Conversation: conv, Response: resp})
+}
+
+// initialMessageError describes a failed initial message, pointing at the stored user
+// message when there is one so the client can retry it.
+func (s *Server) initialMessageError(ctx context.Context, convID uuid.UUID, publicKey string) *ErrorResponse {
+	errResp := &ErrorResponse{
+		Error: "the conversation was created but its first message could not be answered",
+		Code:  agent.ErrorCodeInitialMessageFailed,
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), discardConversationTimeout)
+	defer cancel()
+	messages, _, err := s.convRepo.ListMessages(ctx, convID, publicKey, 0, 2)
+	if err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to look up initial message")
+		return errResp
+	}
+	for _, msg := range messages {
+		if msg.Role == types.RoleUser {
+			errResp.Details = map[string]string{"message_id": msg.ID.String()}
+			break
+		}
+	}
+	return errResp
+}
+
+// ImportConversation creates a conversation from a legacy assistant chat history.
+func (s *Server) ImportConversation(c echo.Context) error {
+	var req agent.ImportConversationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	conv, err := s.agentService.ImportConversation(c.Request().Context(), &req)
+	if err != nil {
+		var invalid *agent.ImportValidationError
+		if errors.As(err, &invalid) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: invalid.Error()})
+		}
+		s.logger.WithError(err).Error("failed to import conversation")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to import conversation"})
+	}
 
 	return c.JSON(http.StatusCreated, conv)
 }
 
+// BulkConversations archives, restores or deletes archived conversations picked by ID or
+// age, reporting the outcome for each. It is rate limited apart from other requests.
+func (s *Server) BulkConversations(c echo.Context) error {
+	var req agent.BulkConversationsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	resp, err := s.agentService.BulkConversations(c.Request().Context(), &req)
+	if err != nil {
+		var invalid *agent.BulkValidationError
+		if errors.As(err, &invalid) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid bulk request",
+				Code:    agent.ErrorCodeInvalidRequest,
+				Details: invalid.Fields,
+			})
+		}
+		if errors.Is(err, agent.ErrBulkRateLimited) {
+			return c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: err.Error()})
+		}
+		s.logger.WithError(err).Error("failed to run bulk conversation operation")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to run bulk conversation operation"})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
 // ListConversations returns a paginated list of conversations.
 func (s *Server) ListConversations(c echo.Context) error {
 	var req ListConversationsRequest
@@ -68,19 +255,30 @@ func (s *Server) ListConversations(c echo.Context) error {
 	}
 
 	authPublicKey := GetPublicKey(c)
-	if req.PublicKey != authPublicKey {
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
 		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
 	}
 
-	// Default pagination
-	if req.Take <= 0 {
-		req.Take = 20
+	var ok bool
+	if req.Skip, ok = clampSkip(req.Skip); !ok {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("skip must be at most %d", maxSkip)})
+	}
+	req.Take = clampTake(req.Take, s.pagination.ConversationsDefaultTake, s.pagination.ConversationsMaxTake)
+	if len(req.Tags) > agent.MaxConversationTags {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "too many tags"})
+	}
+	for i, tag := range req.Tags {
+		req.Tags[i] = strings.ToLower(strings.TrimSpace(tag))
+	}
+	// Labels are stored with whitespace collapsed and match regardless of case
+	if len(req.Labels) > s.maxLabels {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "too many labels"})
 	}
-	if req.Take > 100 {
-		req.Take = 100
+	for i, label := range req.Labels {
+		req.Labels[i] = strings.ToLower(strings.Join(strings.Fields(label), " "))
 	}
 
-	conversations, totalCount, err := s.convRepo.List(c.Request().Context(), req.PublicKey, req.Skip, req.Take)
+	conversations, totalCount, err := s.convRepo.List(c.Request().Context(), req.PublicKey, req.Tags, req.Labels, req.Skip, req.Take)
 	if err != nil {
 		s.logger.WithError(err).Error("failed to list conversations")
 		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list conversations"})
@@ -110,11 +308,11 @@ func (s *Server) GetConversation(c echo.Context) error {
 	}
 
 	authPublicKey := GetPublicKey(c)
-	if req.PublicKey != authPublicKey {
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
 		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
 	}
 
-	conv, err := s.convRepo.GetWithMessages(c.Request().Context(), id, req.PublicKey)
+	conv, err := s.getConversationAtLeast(c.Request().Context(), id, req.PublicKey, req.MinRevision)
 	if err != nil {
 		if errors.Is(err, postgres.ErrNotFound) {
 			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "conversation not found"})
@@ -126,8 +324,188 @@ func (s *Server) GetConversation(c echo.Context) error {
 	if conv.Messages == nil {
 		conv.Messages = []types.Message{}
 	}
+	s.agentService.RefreshSuggestions(c.Request().Context(), conv.Messages)
+
+	return c.JSON(http.StatusOK, GetConversationResponse{
+		ConversationWithMessages: conv,
+		PendingPolicy:            agent.FindPendingPolicy(conv.Messages),
+	})
+}
+
+const (
+	// minRevisionWait bounds how long a conversation read waits for a requested revision.
+	minRevisionWait = 2 * time.Second
+	// minRevisionPoll is the delay between reads while waiting for it.
+	minRevisionPoll = 100 * time.Millisecond
+)
+
+// getConversationAtLeast reads a conversation until its revision reaches minRevision, for up
+// to minRevisionWait. A read still behind then is returned as is; its revision tells the
+// client the latest messages are missing.
+func (s *Server) getConversationAtLeast(ctx context.Context, id uuid.UUID, publicKey string, minRevision int64) (*types.ConversationWithMessages, error) {
+	deadline := time.Now().Add(minRevisionWait)
+	for {
+		conv, err := s.convRepo.GetWithMessages(ctx, id, publicKey)
+		if err != nil || conv.Revision >= minRevision {
+			return conv, err
+		}
+		if time.Now().Add(minRevisionPoll).After(deadline) {
+			s.logger.WithFields(logrus.Fields{
+				"conversation_id": id,
+				"revision":        conv.Revision,
+				"min_revision":    minRevision,
+			}).Warn("conversation read still behind the requested revision")
+			return conv, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(minRevisionPoll):
+		}
+	}
+}
+
+// ListMessages returns a paginated list of messages in a conversation, oldest first.
+func (s *Server) ListMessages(c echo.Context) error {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+
+	var req ListMessagesRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	var ok bool
+	if req.Skip, ok = clampSkip(req.Skip); !ok {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("skip must be at most %d", maxSkip)})
+	}
+	req.Take = clampTake(req.Take, s.pagination.MessagesDefaultTake, s.pagination.MessagesMaxTake)
+
+	messages, totalCount, err := s.convRepo.ListMessages(c.Request().Context(), id, req.PublicKey, req.Skip, req.Take)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "conversation not found"})
+		}
+		s.logger.WithError(err).Error("failed to list messages")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list messages"})
+	}
+
+	if messages == nil {
+		messages = []types.Message{}
+	}
+	s.agentService.RefreshSuggestions(c.Request().Context(), messages)
+
+	return c.JSON(http.StatusOK, ListMessagesResponse{
+		Messages:   messages,
+		TotalCount: totalCount,
+	})
+}
+
+// ForkConversation copies a conversation, optionally up to a message, into a new conversation.
+func (s *Server) ForkConversation(c echo.Context) error {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+
+	var req ForkConversationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	if req.SummaryOnly && req.MessageID != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "message_id cannot be combined with summary_only"})
+	}
 
-	return c.JSON(http.StatusOK, conv)
+	conv, err := s.convRepo.Fork(c.Request().Context(), id, req.PublicKey, req.MessageID, req.SummaryOnly)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "conversation or message not found"})
+		}
+		s.logger.WithError(err).Error("failed to fork conversation")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to fork conversation"})
+	}
+
+	return c.JSON(http.StatusCreated, conv)
+}
+
+// SummarizeConversationRequest is the request body for summarizing a conversation on demand.
+type SummarizeConversationRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// SummarizeConversation handles POST /agent/conversations/:id/summarize
+// It condenses everything outside the recent window into the summary, regardless of the
+// summarize trigger, and returns the resulting summary.
+func (s *Server) SummarizeConversation(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+
+	var req SummarizeConversationRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	result, err := s.agentService.SummarizeConversation(c.Request().Context(), id, req.PublicKey)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "conversation not found"})
+		}
+		if errors.Is(err, agent.ErrConversationBusy) {
+			return c.JSON(http.StatusConflict, ErrorResponse{
+				Error: "another message in this conversation is still being processed",
+				Code:  agent.ErrorCodeConversationBusy,
+			})
+		}
+		if errors.Is(err, agent.ErrSummarizationDisabled) {
+			return c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "summarization is temporarily disabled"})
+		}
+		s.logger.WithError(err).Error("failed to summarize conversation")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to summarize conversation"})
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// GetPolicyDraft returns the conversation's pending policy draft so the app can restore the
+// confirm sheet.
+func (s *Server) GetPolicyDraft(c echo.Context) error {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+
+	draft, err := s.agentService.GetPolicyDraft(c.Request().Context(), id, GetPublicKey(c))
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "no pending policy draft"})
+		}
+		s.logger.WithError(err).Error("failed to get policy draft")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get policy draft"})
+	}
+
+	return c.JSON(http.StatusOK, draft)
 }
 
 // DeleteConversation archives a conversation (soft delete).
@@ -144,7 +522,7 @@ func (s *Server) DeleteConversation(c echo.Context) error {
 	}
 
 	authPublicKey := GetPublicKey(c)
-	if req.PublicKey != authPublicKey {
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
 		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
 	}
 
@@ -159,3 +537,88 @@ func (s *Server) DeleteConversation(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, SuccessResponse{Success: true})
 }
+
+// DeleteMessage removes a single message from a conversation (soft delete). The message stays
+// in the history as a tombstone with content_type "deleted"; replies to it are kept.
+func (s *Server) DeleteMessage(c echo.Context) error {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid message id"})
+	}
+
+	var req DeleteMessageRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	err = s.convRepo.DeleteMessage(c.Request().Context(), id, messageID, req.PublicKey)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "message not found"})
+		}
+		s.logger.WithError(err).Error("failed to delete message")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to delete message"})
+	}
+
+	return c.JSON(http.StatusOK, SuccessResponse{Success: true})
+}
+
+// AddLabels adds user labels to a conversation.
+func (s *Server) AddLabels(c echo.Context) error {
+	return s.editLabels(c, func(ctx context.Context, id uuid.UUID, publicKey string, labels []string) ([]string, error) {
+		return s.convRepo.AddLabels(ctx, id, publicKey, labels, s.maxLabels)
+	})
+}
+
+// RemoveLabels removes user labels from a conversation.
+func (s *Server) RemoveLabels(c echo.Context) error {
+	return s.editLabels(c, s.convRepo.RemoveLabels)
+}
+
+// editLabels handles a label edit request, applying edit to the normalized labels.
+func (s *Server) editLabels(c echo.Context, edit func(ctx context.Context, id uuid.UUID, publicKey string, labels []string) ([]string, error)) error {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+
+	var req LabelsRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	labels, err := agent.NormalizeLabels(req.Labels)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	}
+
+	labels, err = edit(c.Request().Context(), id, req.PublicKey, labels)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrNotFound):
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "conversation not found"})
+		case errors.Is(err, postgres.ErrLabelLimit):
+			return c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: fmt.Sprintf("a conversation can have at most %d labels", s.maxLabels)})
+		}
+		s.logger.WithError(err).Error("failed to update labels")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to update labels"})
+	}
+
+	return c.JSON(http.StatusOK, LabelsResponse{Labels: labels})
+}
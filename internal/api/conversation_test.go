@@ -0,0 +1,306 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestCreateConversation(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		agent      *fakeAgent
+		wantStatus int
+		// wantCalls is the number of messages sent to the agent
+		wantCalls    int
+		wantResponse bool
+		wantErrCode  string
+		// wantMessageID is set when the error should point at the stored user message
+		wantMessageID bool
+	}{
+		{
+			name:       "plain",
+			body:       `{"public_key":"` + testPublicKey + `"}`,
+			agent:      &fakeAgent{},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:         "with initial message",
+			body:         `{"public_key":"` + testPublicKey + `","initial_message":{"content":"hi"}}`,
+			agent:        &fakeAgent{resp: &agent.SendMessageResponse{}},
+			wantStatus:   http.StatusCreated,
+			wantCalls:    1,
+			wantResponse: true,
+		},
+		{
+			name:          "initial message fails after it was stored",
+			body:          `{"public_key":"` + testPublicKey + `","initial_message":{"content":"hi"}}`,
+			agent:         &fakeAgent{err: errors.New("model overloaded")},
+			wantStatus:    http.StatusCreated,
+			wantCalls:     1,
+			wantErrCode:   agent.ErrorCodeInitialMessageFailed,
+			wantMessageID: true,
+		},
+		{
+			name:        "initial message fails before it was stored",
+			body:        `{"public_key":"` + testPublicKey + `","initial_message":{"content":"hi"}}`,
+			agent:       &fakeAgent{err: errors.New("cache down"), errBeforeStore: true},
+			wantStatus:  http.StatusCreated,
+			wantCalls:   1,
+			wantErrCode: agent.ErrorCodeInitialMessageFailed,
+		},
+		{
+			name:       "empty initial message",
+			body:       `{"public_key":"` + testPublicKey + `","initial_message":{"content":"  "}}`,
+			agent:      &fakeAgent{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "uppercase public key",
+			body:       `{"public_key":"` + strings.ToUpper(testPublicKey) + `"}`,
+			agent:      &fakeAgent{},
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "public key mismatch",
+			body:       `{"public_key":"someone-else"}`,
+			agent:      &fakeAgent{},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "another vault's public key",
+			body:       `{"public_key":"` + strings.Repeat("CD", 33) + `"}`,
+			agent:      &fakeAgent{},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convs := newFakeConversations()
+			tt.agent.convs = convs
+			s := &Server{convRepo: convs, agentService: tt.agent, logger: testLogger()}
+
+			c, rec := authed(http.MethodPost, "/agent/conversations", tt.body)
+			if err := s.CreateConversation(c); err != nil {
+				t.Fatalf("CreateConversation() error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if len(tt.agent.calls) != tt.wantCalls {
+				t.Errorf("agent got %d messages, want %d", len(tt.agent.calls), tt.wantCalls)
+			}
+			if rec.Code != http.StatusCreated {
+				if len(convs.conversations) != 0 {
+					t.Errorf("created %d conversations for a refused request", len(convs.conversations))
+				}
+				return
+			}
+
+			// A failed initial message keeps the conversation, so it can be retried
+			if len(convs.conversations) != 1 || len(convs.deleted) != 0 {
+				t.Fatalf("conversations = %d, deleted = %d, want one kept", len(convs.conversations), len(convs.deleted))
+			}
+			if tt.wantCalls == 0 {
+				var conv struct {
+					ID        string `json:"id"`
+					PublicKey string `json:"public_key"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &conv); err != nil || conv.ID == "" || conv.PublicKey != testPublicKey {
+					t.Errorf("body = %s, want the conversation", rec.Body)
+				}
+				return
+			}
+
+			var got CreateConversationResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.Conversation == nil {
+				t.Fatal("response has no conversation")
+			}
+			if (got.Response != nil) != tt.wantResponse {
+				t.Errorf("response set = %v, want %v", got.Response != nil, tt.wantResponse)
+			}
+			if tt.wantErrCode == "" {
+				if got.Error != nil {
+					t.Errorf("unexpected error %+v", got.Error)
+				}
+				return
+			}
+			if got.Error == nil || got.Error.Code != tt.wantErrCode {
+				t.Fatalf("error = %+v, want code %s", got.Error, tt.wantErrCode)
+			}
+			msgs := convs.messages[got.Conversation.ID]
+			switch {
+			case tt.wantMessageID && got.Error.Details["message_id"] != msgs[0].ID.String():
+				t.Errorf("details.message_id = %q, want the user message %s", got.Error.Details["message_id"], msgs[0].ID)
+			case !tt.wantMessageID && got.Error.Details["message_id"] != "":
+				t.Errorf("details.message_id = %q with no stored message", got.Error.Details["message_id"])
+			}
+		})
+	}
+}
+
+func TestGetConversationMinRevision(t *testing.T) {
+	tests := []struct {
+		name        string
+		minRevision int64
+		lag         int
+		missing     bool
+		wantStatus  int
+		// wantRevision is the revision returned; the stale read is one behind
+		wantRevision int64
+		wantReads    int
+	}{
+		{name: "fresh read", minRevision: 2, wantStatus: http.StatusOK, wantRevision: 2, wantReads: 1},
+		{name: "stale read without min_revision", lag: 1, wantStatus: http.StatusOK, wantRevision: 1, wantReads: 1},
+		{name: "stale read retried until it catches up", minRevision: 2, lag: 2, wantStatus: http.StatusOK, wantRevision: 2, wantReads: 3},
+		{name: "older min_revision", minRevision: 1, lag: 1, wantStatus: http.StatusOK, wantRevision: 1, wantReads: 1},
+		{name: "missing conversation", minRevision: 2, missing: true, wantStatus: http.StatusNotFound, wantReads: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convs := newFakeConversations()
+			conv, _ := convs.Create(context.Background(), testPublicKey, false)
+			convs.addMessage(conv.ID, types.RoleUser, "hi")
+			convs.addMessage(conv.ID, types.RoleAssistant, "hello")
+			conv.Revision = 2
+			convs.lag = tt.lag
+			id := conv.ID
+			if tt.missing {
+				id = uuid.New()
+			}
+
+			s := &Server{convRepo: convs, agentService: &fakeAgent{}, logger: testLogger()}
+			body := fmt.Sprintf(`{"public_key":%q,"min_revision":%d}`, testPublicKey, tt.minRevision)
+			c, rec := authed(http.MethodPost, "/agent/conversations/"+id.String(), body)
+			c.SetParamNames("id")
+			c.SetParamValues(id.String())
+			if err := s.GetConversation(c); err != nil {
+				t.Fatalf("GetConversation() error = %v", err)
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if convs.reads != tt.wantReads {
+				t.Errorf("read the conversation %d times, want %d", convs.reads, tt.wantReads)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got GetConversationResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.Revision != tt.wantRevision || len(got.Messages) != int(tt.wantRevision) {
+				t.Errorf("got revision %d with %d messages, want revision %d", got.Revision, len(got.Messages), tt.wantRevision)
+			}
+		})
+	}
+
+	t.Run("still stale after the wait", func(t *testing.T) {
+		convs := newFakeConversations()
+		conv, _ := convs.Create(context.Background(), testPublicKey, false)
+		convs.addMessage(conv.ID, types.RoleUser, "hi")
+		conv.Revision = 1
+		convs.lag = 1000
+
+		s := &Server{convRepo: convs, agentService: &fakeAgent{}, logger: testLogger()}
+		body := fmt.Sprintf(`{"public_key":%q,"min_revision":1}`, testPublicKey)
+		c, rec := authed(http.MethodPost, "/agent/conversations/"+conv.ID.String(), body)
+		c.SetParamNames("id")
+		c.SetParamValues(conv.ID.String())
+		start := time.Now()
+		if err := s.GetConversation(c); err != nil {
+			t.Fatalf("GetConversation() error = %v", err)
+		}
+
+		// The read gives up within the bound and answers with what it has; the revision
+		// tells the client it's behind
+		if elapsed := time.Since(start); elapsed > minRevisionWait+time.Second {
+			t.Errorf("read took %v, want it bounded by %v", elapsed, minRevisionWait)
+		}
+		if convs.reads < 2 {
+			t.Errorf("read the conversation %d times, want it retried", convs.reads)
+		}
+		var got GetConversationResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if rec.Code != http.StatusOK || got.Revision != 0 || len(got.Messages) != 0 {
+			t.Errorf("got status %d, revision %d with %d messages; want the stale read", rec.Code, got.Revision, len(got.Messages))
+		}
+	})
+}
+
+func TestGetConversationPendingPolicy(t *testing.T) {
+	policyMeta := json.RawMessage(`{"type":"policy_ready","action":"create_policy","plugin_id":"vultisig-dca-0000","policy_suggest":{},"configuration":{"asset":"ETH"}}`)
+
+	tests := []struct {
+		name        string
+		confirmed   bool
+		wantPending bool
+	}{
+		{name: "unconfirmed policy", wantPending: true},
+		{name: "confirmed policy", confirmed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convs := newFakeConversations()
+			conv, _ := convs.Create(context.Background(), testPublicKey, false)
+			convs.addMessage(conv.ID, types.RoleUser, "buy ETH weekly")
+			policyID := uuid.New()
+			convs.messages[conv.ID] = append(convs.messages[conv.ID], types.Message{
+				ID: policyID, ConversationID: conv.ID, Role: types.RoleAssistant, Content: "Here is your policy.", ContentType: "text", Metadata: policyMeta,
+			})
+			if tt.confirmed {
+				convs.messages[conv.ID] = append(convs.messages[conv.ID], types.Message{
+					ID: uuid.New(), ConversationID: conv.ID, Role: types.RoleUser, ContentType: "action_result",
+				})
+			}
+
+			s := &Server{convRepo: convs, agentService: &fakeAgent{}, logger: testLogger()}
+			c, rec := authed(http.MethodPost, "/agent/conversations/"+conv.ID.String(), `{"public_key":"`+testPublicKey+`"}`)
+			c.SetParamNames("id")
+			c.SetParamValues(conv.ID.String())
+			if err := s.GetConversation(c); err != nil {
+				t.Fatalf("GetConversation() error = %v", err)
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+
+			var got GetConversationResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if !tt.wantPending {
+				if got.PendingPolicy != nil || strings.Contains(rec.Body.String(), "pending_policy") {
+					t.Errorf("pending_policy = %+v, want it omitted", got.PendingPolicy)
+				}
+				return
+			}
+			// The app can restore the confirm sheet from the reloaded conversation
+			if got.PendingPolicy == nil {
+				t.Fatalf("pending_policy missing from %s", rec.Body)
+			}
+			if got.PendingPolicy.MessageID != policyID || got.PendingPolicy.PluginID != "vultisig-dca-0000" || got.PendingPolicy.Configuration["asset"] != "ETH" {
+				t.Errorf("pending_policy = %+v, want the policy from message %s", got.PendingPolicy, policyID)
+			}
+		})
+	}
+}
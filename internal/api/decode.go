@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// strictRequestError describes why a request body was rejected by strict decoding. Its
+// message names the offending field and is safe to return to the client.
+type strictRequestError struct {
+	msg string
+}
+
+func (e *strictRequestError) Error() string {
+	return e.msg
+}
+
+// bindStrict decodes the JSON request body into v, rejecting unknown fields, type
+// mismatches and trailing data with an error describing the offending field.
+func bindStrict(c echo.Context, v any) error {
+	dec := json.NewDecoder(c.Request().Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return describeDecodeError(err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return &strictRequestError{msg: "request body must contain a single JSON object"}
+	}
+	return nil
+}
+
+// describeDecodeError turns a JSON decoding error into a client-facing description.
+func describeDecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			return &strictRequestError{msg: fmt.Sprintf("request body must be a JSON object, got %s", typeErr.Value)}
+		}
+		return &strictRequestError{msg: fmt.Sprintf("field %q must be %s, got %s", field, jsonTypeName(typeErr.Type.Kind().String()), typeErr.Value)}
+	case errors.As(err, &syntaxErr):
+		return &strictRequestError{msg: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset)}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return &strictRequestError{msg: "request body is empty or truncated"}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields
+		return &strictRequestError{msg: "unknown field " + strings.TrimPrefix(err.Error(), "json: unknown field ")}
+	default:
+		return &strictRequestError{msg: "invalid request body"}
+	}
+}
+
+// jsonTypeName names the JSON type expected for a Go kind.
+func jsonTypeName(kind string) string {
+	switch kind {
+	case "string":
+		return "a string"
+	case "bool":
+		return "a boolean"
+	case "slice", "array":
+		return "an array"
+	case "map", "struct":
+		return "an object"
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return "an integer"
+	case "float32", "float64":
+		return "a number"
+	default:
+		return "a " + kind
+	}
+}
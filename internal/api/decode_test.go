@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestSendMessageStrictDecoding(t *testing.T) {
+	key := `"public_key":"` + testPublicKey + `"`
+
+	tests := []struct {
+		name   string
+		strict bool
+		body   string
+		// wantError is a substring of the 400 error; empty means the message is accepted
+		wantError string
+	}{
+		{
+			name:   "valid body",
+			strict: true,
+			body:   `{` + key + `,"content":"hi","context":{"balances":[{"chain":"Ethereum","asset":"","symbol":"ETH","amount":"1.5","decimals":18}]}}`,
+		},
+		{
+			name:      "unknown field",
+			strict:    true,
+			body:      `{` + key + `,"content":"hi","contnet":"typo"}`,
+			wantError: `unknown field "contnet"`,
+		},
+		{
+			name:      "unknown context field",
+			strict:    true,
+			body:      `{` + key + `,"content":"hi","context":{"balance":[]}}`,
+			wantError: `unknown field "balance"`,
+		},
+		{
+			name:      "balances as an object",
+			strict:    true,
+			body:      `{` + key + `,"content":"hi","context":{"balances":{"chain":"Ethereum"}}}`,
+			wantError: `field "context.balances" must be an array, got object`,
+		},
+		{
+			name:      "amount as a number",
+			strict:    true,
+			body:      `{` + key + `,"content":"hi","context":{"balances":[{"chain":"Ethereum","symbol":"ETH","amount":1.5}]}}`,
+			wantError: `field "context.balances.0.amount" must be a string, got number`,
+		},
+		{
+			name:      "amount not a decimal",
+			strict:    true,
+			body:      `{` + key + `,"content":"hi","context":{"balances":[{"chain":"Ethereum","symbol":"ETH","amount":"lots"}]}}`,
+			wantError: `context.balances[0].amount must be a decimal number in a string`,
+		},
+		{
+			name:      "unsupported address chain",
+			strict:    true,
+			body:      `{` + key + `,"content":"hi","context":{"addresses":{"Fakechain":"abc"}}}`,
+			wantError: `context.addresses has an unsupported chain "Fakechain"`,
+		},
+		{
+			name:      "trailing data",
+			strict:    true,
+			body:      `{` + key + `,"content":"hi"} {}`,
+			wantError: "request body must contain a single JSON object",
+		},
+		{
+			name:      "malformed",
+			strict:    true,
+			body:      `{` + key + `,"content":}`,
+			wantError: "malformed JSON at offset",
+		},
+		{
+			name: "lenient ignores unknown fields",
+			body: `{` + key + `,"content":"hi","contnet":"typo"}`,
+		},
+		{
+			name: "lenient skips context validation",
+			body: `{` + key + `,"content":"hi","context":{"balances":[{"chain":"Ethereum","symbol":"ETH","amount":"lots"}]}}`,
+		},
+		{
+			name:      "lenient type mismatch",
+			body:      `{` + key + `,"content":"hi","context":{"balances":{"chain":"Ethereum"}}}`,
+			wantError: "invalid request body",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fa := &fakeAgent{
+				convs: newFakeConversations(),
+				resp:  &agent.SendMessageResponse{Message: types.Message{Role: types.RoleAssistant, Content: "hello"}},
+			}
+			s := &Server{agentService: fa, maxContextAddresses: testMaxAddresses, logger: testLogger(), strictRequests: tt.strict}
+
+			c, rec := authed(http.MethodPost, "/agent/conversations/messages", tt.body)
+			c.SetParamNames("id")
+			c.SetParamValues(uuid.NewString())
+			if err := s.SendMessage(c); err != nil {
+				t.Fatalf("SendMessage() error = %v", err)
+			}
+
+			if tt.wantError == "" {
+				if rec.Code != http.StatusOK || len(fa.calls) != 1 {
+					t.Fatalf("status = %d with %d agent calls, want 200 with 1: %s", rec.Code, len(fa.calls), rec.Body)
+				}
+				return
+			}
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400: %s", rec.Code, rec.Body)
+			}
+			var got ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if !strings.Contains(got.Error, tt.wantError) {
+				t.Errorf("error = %q, want it to contain %q", got.Error, tt.wantError)
+			}
+			if len(fa.calls) != 0 {
+				t.Errorf("agent got %d messages for a rejected body", len(fa.calls))
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// testPublicKey is the authenticated key in handler tests.
+var testPublicKey = strings.Repeat("ab", 33)
+
+// testLogger returns a logger that discards its output.
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// fakeConversations keeps conversations and their messages in memory. Methods a test
+// doesn't use fall through to the nil embedded interface and panic.
+type fakeConversations struct {
+	ConversationStore
+
+	mu            sync.Mutex
+	conversations map[uuid.UUID]*types.Conversation
+	messages      map[uuid.UUID][]types.Message
+	deleted       []uuid.UUID
+	// lag is how many GetWithMessages reads still miss the latest message, as a stale
+	// replica would; reads counts them all
+	lag, reads int
+	// listTags and listLabels are the filters of the last List call
+	listTags, listLabels []string
+}
+
+func newFakeConversations() *fakeConversations {
+	return &fakeConversations{
+		conversations: make(map[uuid.UUID]*types.Conversation),
+		messages:      make(map[uuid.UUID][]types.Message),
+	}
+}
+
+func (f *fakeConversations) Create(_ context.Context, publicKey string, noMemory bool) (*types.Conversation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	conv := &types.Conversation{ID: uuid.New(), PublicKey: publicKey, NoMemory: noMemory}
+	f.conversations[conv.ID] = conv
+	return conv, nil
+}
+
+func (f *fakeConversations) GetWithMessages(_ context.Context, id uuid.UUID, publicKey string) (*types.ConversationWithMessages, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reads++
+	conv, ok := f.conversations[id]
+	if !ok || conv.PublicKey != publicKey {
+		return nil, postgres.ErrNotFound
+	}
+	out := &types.ConversationWithMessages{Conversation: *conv, Messages: slices.Clone(f.messages[id])}
+	if f.reads <= f.lag && len(out.Messages) > 0 {
+		out.Messages = out.Messages[:len(out.Messages)-1]
+		out.Revision--
+	}
+	return out, nil
+}
+
+func (f *fakeConversations) ListMessages(_ context.Context, convID uuid.UUID, publicKey string, skip, take int) ([]types.Message, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	conv, ok := f.conversations[convID]
+	if !ok || conv.PublicKey != publicKey {
+		return nil, 0, postgres.ErrNotFound
+	}
+	msgs := f.messages[convID]
+	total := len(msgs)
+	msgs = msgs[min(skip, total):min(skip+take, total)]
+	return msgs, total, nil
+}
+
+func (f *fakeConversations) Delete(_ context.Context, id uuid.UUID, publicKey string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	conv, ok := f.conversations[id]
+	if !ok || conv.PublicKey != publicKey {
+		return postgres.ErrNotFound
+	}
+	delete(f.conversations, id)
+	f.deleted = append(f.deleted, id)
+	return nil
+}
+
+func (f *fakeConversations) List(_ context.Context, publicKey string, tags, labels []string, _, _ int) ([]types.Conversation, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listTags, f.listLabels = tags, labels
+	var convs []types.Conversation
+	for _, conv := range f.conversations {
+		if conv.PublicKey == publicKey && containsFold(conv.Tags, tags) && containsFold(conv.Labels, labels) {
+			convs = append(convs, *conv)
+		}
+	}
+	return convs, len(convs), nil
+}
+
+func (f *fakeConversations) AddLabels(_ context.Context, id uuid.UUID, publicKey string, labels []string, maxLabels int) ([]string, error) {
+	return f.editLabels(id, publicKey, func(current []string) ([]string, error) {
+		next := slices.Clone(current)
+		for _, label := range labels {
+			if !containsFold(next, []string{label}) {
+				next = append(next, label)
+			}
+		}
+		if len(next) > maxLabels {
+			return nil, postgres.ErrLabelLimit
+		}
+		return next, nil
+	})
+}
+
+func (f *fakeConversations) RemoveLabels(_ context.Context, id uuid.UUID, publicKey string, labels []string) ([]string, error) {
+	return f.editLabels(id, publicKey, func(current []string) ([]string, error) {
+		next := []string{}
+		for _, label := range current {
+			if !containsFold(labels, []string{label}) {
+				next = append(next, label)
+			}
+		}
+		return next, nil
+	})
+}
+
+func (f *fakeConversations) editLabels(id uuid.UUID, publicKey string, edit func([]string) ([]string, error)) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	conv, ok := f.conversations[id]
+	if !ok || conv.PublicKey != publicKey {
+		return nil, postgres.ErrNotFound
+	}
+	next, err := edit(conv.Labels)
+	if err != nil {
+		return nil, err
+	}
+	conv.Labels = next
+	return next, nil
+}
+
+// containsFold reports whether have holds every entry of want, ignoring case.
+func containsFold(have, want []string) bool {
+	for _, w := range want {
+		if !slices.ContainsFunc(have, func(h string) bool { return strings.EqualFold(h, w) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// addMessage stores a message in conversation convID and returns its id.
+func (f *fakeConversations) addMessage(convID uuid.UUID, role types.MessageRole, content string) uuid.UUID {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg := types.Message{ID: uuid.New(), ConversationID: convID, Role: role, Content: content}
+	f.messages[convID] = append(f.messages[convID], msg)
+	return msg.ID
+}
+
+// fakeAgent answers messages with a fixed response or error. When the request gets that
+// far, it stores the user message in convs first, as the service does.
+type fakeAgent struct {
+	AgentService
+	convs *fakeConversations
+	resp  *agent.SendMessageResponse
+	err   error
+	// errBeforeStore fails before the user message is stored
+	errBeforeStore bool
+
+	mu    sync.Mutex
+	calls []*agent.SendMessageRequest
+}
+
+func (f *fakeAgent) ProcessMessage(_ context.Context, convID uuid.UUID, _ string, req *agent.SendMessageRequest) (*agent.SendMessageResponse, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, req)
+	f.mu.Unlock()
+	if f.err != nil && f.errBeforeStore {
+		return nil, f.err
+	}
+	f.convs.addMessage(convID, types.RoleUser, req.Content)
+	if f.err != nil {
+		f.convs.addMessage(convID, types.RoleAssistant, "I couldn't generate a response. Tap to retry.")
+		return nil, f.err
+	}
+	return f.resp, nil
+}
+
+func (f *fakeAgent) RetryMessage(_ context.Context, _, _ uuid.UUID, req *agent.SendMessageRequest) (*agent.SendMessageResponse, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, req)
+	f.mu.Unlock()
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.resp, nil
+}
+
+func (f *fakeAgent) RefreshSuggestions(context.Context, []types.Message) {}
+
+// authed returns an echo context for a JSON request with body, authenticated as testPublicKey.
+func authed(method, target, body string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	c.Set("public_key", testPublicKey)
+	return c, rec
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestEditLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing are the conversation's labels before the request
+		existing   []string
+		remove     bool
+		body       string
+		wantStatus int
+		want       []string
+	}{
+		{
+			name:       "add",
+			existing:   []string{"tax"},
+			body:       `{"labels":["ETH  strategy"]}`,
+			wantStatus: http.StatusOK,
+			want:       []string{"tax", "ETH strategy"},
+		},
+		{
+			name:       "add existing label in another case",
+			existing:   []string{"Tax"},
+			body:       `{"labels":["TAX","tax"]}`,
+			wantStatus: http.StatusOK,
+			want:       []string{"Tax"},
+		},
+		{
+			name:       "add past the limit",
+			existing:   []string{"a", "b"},
+			body:       `{"labels":["c","d"]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			want:       []string{"a", "b"},
+		},
+		{
+			name:       "add blank label",
+			body:       `{"labels":[" "]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "remove ignoring case",
+			existing:   []string{"ETH strategy", "tax"},
+			remove:     true,
+			body:       `{"labels":["eth STRATEGY","missing"]}`,
+			wantStatus: http.StatusOK,
+			want:       []string{"tax"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convs := newFakeConversations()
+			conv := &types.Conversation{ID: uuid.New(), PublicKey: testPublicKey, Labels: tt.existing}
+			convs.conversations[conv.ID] = conv
+			s := &Server{convRepo: convs, logger: testLogger(), maxLabels: 3}
+
+			body := `{"public_key":"` + testPublicKey + `",` + tt.body[1:]
+			method, handler := http.MethodPost, s.AddLabels
+			if tt.remove {
+				method, handler = http.MethodDelete, s.RemoveLabels
+			}
+			c, rec := authed(method, "/agent/conversations/"+conv.ID.String()+"/labels", body)
+			c.SetParamNames("id")
+			c.SetParamValues(conv.ID.String())
+			if err := handler(c); err != nil {
+				t.Fatalf("handler error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code == http.StatusOK {
+				var got LabelsResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				if !reflect.DeepEqual(got.Labels, tt.want) {
+					t.Errorf("response labels = %q, want %q", got.Labels, tt.want)
+				}
+			}
+			if !reflect.DeepEqual(conv.Labels, tt.want) {
+				t.Errorf("stored labels = %q, want %q", conv.Labels, tt.want)
+			}
+		})
+	}
+
+	t.Run("another user's conversation", func(t *testing.T) {
+		convs := newFakeConversations()
+		conv := &types.Conversation{ID: uuid.New(), PublicKey: "someone-else"}
+		convs.conversations[conv.ID] = conv
+		s := &Server{convRepo: convs, logger: testLogger(), maxLabels: 3}
+
+		c, rec := authed(http.MethodPost, "/", `{"public_key":"`+testPublicKey+`","labels":["tax"]}`)
+		c.SetParamNames("id")
+		c.SetParamValues(conv.ID.String())
+		if err := s.AddLabels(c); err != nil {
+			t.Fatalf("AddLabels() error = %v", err)
+		}
+		if rec.Code != http.StatusNotFound || conv.Labels != nil {
+			t.Errorf("status = %d, labels = %q; want 404 and no labels", rec.Code, conv.Labels)
+		}
+	})
+}
+
+func TestListConversationsLabelFilter(t *testing.T) {
+	tests := []struct {
+		name       string
+		labels     string
+		wantStatus int
+		wantFilter []string
+		wantIDs    int
+	}{
+		{name: "no filter", labels: `[]`, wantStatus: http.StatusOK, wantFilter: []string{}, wantIDs: 2},
+		{name: "normalized like tags", labels: `["  ETH   Strategy "]`, wantStatus: http.StatusOK, wantFilter: []string{"eth strategy"}, wantIDs: 1},
+		{name: "all labels required", labels: `["eth strategy","tax"]`, wantStatus: http.StatusOK, wantFilter: []string{"eth strategy", "tax"}, wantIDs: 0},
+		{name: "too many labels", labels: `["a","b","c","d"]`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convs := newFakeConversations()
+			for _, labels := range [][]string{{"ETH strategy"}, {"Tax"}} {
+				conv := &types.Conversation{ID: uuid.New(), PublicKey: testPublicKey, Labels: labels}
+				convs.conversations[conv.ID] = conv
+			}
+			s := &Server{convRepo: convs, logger: testLogger(), maxLabels: 3}
+
+			c, rec := authed(http.MethodPost, "/agent/conversations/list", `{"public_key":"`+testPublicKey+`","labels":`+tt.labels+`}`)
+			if err := s.ListConversations(c); err != nil {
+				t.Fatalf("ListConversations() error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				if convs.listLabels != nil {
+					t.Errorf("listed with %q, want the request refused before listing", convs.listLabels)
+				}
+				return
+			}
+			if !reflect.DeepEqual(convs.listLabels, tt.wantFilter) {
+				t.Errorf("label filter = %q, want %q", convs.listLabels, tt.wantFilter)
+			}
+			var got ListConversationsResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(got.Conversations) != tt.wantIDs {
+				t.Errorf("listed %d conversations, want %d", len(got.Conversations), tt.wantIDs)
+			}
+		})
+	}
+}
@@ -1,16 +1,27 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
 
 	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/service/attachment"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
 	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
 )
 
+// statusClientClosedRequest is the non-standard status logged for requests the client
+// abandoned before a response was ready.
+const statusClientClosedRequest = 499
+
 // SendMessage handles POST /agent/conversations/:id/messages
 func (s *Server) SendMessage(c echo.Context) error {
 	// 1. Parse conversation ID from :id param
@@ -20,36 +31,286 @@ func (s *Server) SendMessage(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
 	}
 
-	// 2. Bind request body
+	// 2. Bind and validate the request body
 	var req agent.SendMessageRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	if status, errResp := s.bindMessageRequest(c, &req); errResp != nil {
+		return c.JSON(status, errResp)
 	}
 
-	// 3. Validate request has content, suggestion selection, or action result
-	if req.Content == "" && req.SelectedSuggestionID == nil && req.ActionResult == nil {
-		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "content, selected_suggestion_id, or action_result is required"})
+	// 3. Pass access token to request for plugin installation checks
+	req.AccessToken = GetAccessToken(c)
+
+	// 4. Call agentService.ProcessMessage, streaming its progress when the client asked
+	resp, err := s.agentService.ProcessMessage(s.startProgress(c), convID, req.PublicKey, &req)
+	if err != nil {
+		return s.messageError(c, convID, err)
 	}
 
-	// 4. Validate public_key matches JWT
-	authPublicKey := GetPublicKey(c)
-	if req.PublicKey != authPublicKey {
-		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	// 5. Return SendMessageResponse
+	return respond(c, http.StatusOK, resp)
+}
+
+// StartConversationResponse is the response for starting a conversation with its first message.
+type StartConversationResponse struct {
+	Conversation *types.Conversation        `json:"conversation"`
+	Response     *agent.SendMessageResponse `json:"response"`
+}
+
+// StartConversation handles POST /agent/conversations/start: it creates a conversation and
+// sends its first message in one call. The body is a send-message body; no_memory applies
+// to the whole conversation. If the first message fails the conversation is deleted, so a
+// failed start leaves no empty conversation behind.
+func (s *Server) StartConversation(c echo.Context) error {
+	var req agent.SendMessageRequest
+	if status, errResp := s.bindMessageRequest(c, &req); errResp != nil {
+		return c.JSON(status, errResp)
+	}
+	// There is nothing to select or confirm in a conversation that doesn't exist yet
+	if (req.Content == "" && len(req.Attachments) == 0) || req.SelectedSuggestionID != nil || req.ActionResult != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "content or attachments are required to start a conversation"})
+	}
+	req.AccessToken = GetAccessToken(c)
+
+	ctx := c.Request().Context()
+	conv, err := s.convRepo.Create(ctx, req.PublicKey, req.NoMemory)
+	if err != nil {
+		s.logger.WithError(err).Error("failed to create conversation")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to create conversation"})
 	}
 
-	// 5. Pass access token to request for plugin installation checks
+	resp, err := s.agentService.ProcessMessage(s.startProgress(c), conv.ID, req.PublicKey, &req)
+	if err != nil {
+		s.discardConversation(ctx, conv.ID, req.PublicKey)
+		return s.messageError(c, conv.ID, err)
+	}
+	return respond(c, http.StatusCreated, StartConversationResponse{Conversation: conv, Response: resp})
+}
+
+// discardConversationTimeout bounds deleting a conversation whose first message failed.
+const discardConversationTimeout = 5 * time.Second
+
+// discardConversation deletes a conversation whose first message failed. It runs detached
+// from the request, which may have failed because the client went away.
+func (s *Server) discardConversation(ctx context.Context, convID uuid.UUID, publicKey string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), discardConversationTimeout)
+	defer cancel()
+	if err := s.convRepo.Delete(ctx, convID, publicKey); err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to delete conversation after its first message failed")
+	}
+}
+
+// RetryMessage handles POST /agent/conversations/:id/messages/:message_id/retry: it answers a
+// stored user message again after its reply failed, without storing it a second time. The
+// body is a send-message body without content, carrying the wallet context for the reply.
+func (s *Server) RetryMessage(c echo.Context) error {
+	convID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+	messageID, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid message id"})
+	}
+
+	var req agent.SendMessageRequest
+	if status, errResp := s.bindMessageBody(c, &req); errResp != nil {
+		return c.JSON(status, errResp)
+	}
 	req.AccessToken = GetAccessToken(c)
 
-	// 6. Call agentService.ProcessMessage
-	resp, err := s.agentService.ProcessMessage(c.Request().Context(), convID, req.PublicKey, &req)
+	resp, err := s.agentService.RetryMessage(s.startProgress(c), convID, messageID, &req)
+	switch {
+	case errors.Is(err, agent.ErrMessageNotRetryable):
+		return respond(c, http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, agent.ErrMessageAlreadyReplied):
+		return respond(c, http.StatusConflict, ErrorResponse{
+			Error: "message already has a reply",
+			Code:  agent.ErrorCodeMessageAlreadyReplied,
+		})
+	case errors.Is(err, postgres.ErrNotFound):
+		return respond(c, http.StatusNotFound, ErrorResponse{Error: "conversation or message not found"})
+	case err != nil:
+		return s.messageError(c, convID, err)
+	}
+	return respond(c, http.StatusOK, resp)
+}
+
+// bindMessageRequest binds and validates a send-message body. On failure it returns the
+// status and error to respond with.
+func (s *Server) bindMessageRequest(c echo.Context, req *agent.SendMessageRequest) (int, *ErrorResponse) {
+	if status, errResp := s.bindMessageBody(c, req); errResp != nil {
+		return status, errResp
+	}
+	// The request needs content, attachments, a suggestion selection, or an action result
+	if req.Content == "" && len(req.Attachments) == 0 && req.SelectedSuggestionID == nil && req.ActionResult == nil {
+		return http.StatusBadRequest, &ErrorResponse{Error: "content, attachments, selected_suggestion_id, or action_result is required"}
+	}
+	if len(req.Attachments) > 0 {
+		if s.attachments == nil {
+			return http.StatusBadRequest, &ErrorResponse{Error: agent.ErrAttachmentsDisabled.Error()}
+		}
+		if err := req.CheckAttachments(s.attachments.MaxPerMessage()); err != nil {
+			return http.StatusBadRequest, &ErrorResponse{Error: err.Error()}
+		}
+	}
+	return 0, nil
+}
+
+// bindMessageBody binds a send-message body and validates everything but its content.
+func (s *Server) bindMessageBody(c echo.Context, req *agent.SendMessageRequest) (int, *ErrorResponse) {
+	// Strict mode names the offending field instead of ignoring it
+	if s.strictRequests {
+		if err := bindStrict(c, req); err != nil {
+			return http.StatusBadRequest, &ErrorResponse{Error: err.Error()}
+		}
+	} else if err := c.Bind(req); err != nil {
+		return http.StatusBadRequest, &ErrorResponse{Error: "invalid request body"}
+	}
+	c.Set("ability", agent.RequestAbility(req))
+	if status, errResp := s.checkMessageContext(req.Context); errResp != nil {
+		return status, errResp
+	}
+
+	if err := req.CheckMaxTokens(s.maxTokensCap); err != nil {
+		return http.StatusBadRequest, &ErrorResponse{Error: err.Error()}
+	}
+	if err := req.CheckReplyFormat(); err != nil {
+		return http.StatusBadRequest, &ErrorResponse{Error: err.Error()}
+	}
+
+	// The public key must match the JWT
+	if !matchPublicKey(&req.PublicKey, GetPublicKey(c)) {
+		return http.StatusForbidden, &ErrorResponse{Error: "public key mismatch"}
+	}
+	return 0, nil
+}
+
+// checkMessageContext validates a message's wallet context, which may be nil. On failure it
+// returns the status and error to respond with.
+func (s *Server) checkMessageContext(mc *agent.MessageContext) (int, *ErrorResponse) {
+	if mc == nil {
+		return 0, nil
+	}
+	// Oversized contexts are refused before anything is stored or sent to the model
+	if err := mc.CheckSize(s.maxContextAddresses); err != nil {
+		return http.StatusRequestEntityTooLarge, &ErrorResponse{
+			Error: err.Error(),
+			Code:  agent.ErrorCodeContextTooLarge,
+		}
+	}
+	if s.strictRequests {
+		if err := mc.Validate(); err != nil {
+			return http.StatusBadRequest, &ErrorResponse{Error: err.Error()}
+		}
+	}
+	return 0, nil
+}
+
+// messageError responds to a failure processing a message in conversation convID.
+func (s *Server) messageError(c echo.Context, convID uuid.UUID, err error) error {
+	// The client went away; there's nobody to answer and nothing went wrong on our side
+	if errors.Is(err, context.Canceled) && c.Request().Context().Err() != nil {
+		s.logger.WithField("conversation_id", convID).Info("client disconnected before the reply was ready")
+		return respond(c, statusClientClosedRequest, nil)
+	}
+	if errors.Is(err, agent.ErrGenerationAborted) {
+		return respond(c, http.StatusConflict, ErrorResponse{
+			Error: "reply was aborted",
+			Code:  agent.ErrorCodeGenerationAborted,
+		})
+	}
+	if errors.Is(err, agent.ErrConversationBusy) {
+		return respond(c, http.StatusConflict, ErrorResponse{
+			Error: "another message in this conversation is still being processed",
+			Code:  agent.ErrorCodeConversationBusy,
+		})
+	}
+	if errors.Is(err, attachment.ErrNotFound) {
+		return respond(c, http.StatusNotFound, ErrorResponse{Error: "attachment not found"})
+	}
+	if errors.Is(err, agent.ErrAttachmentsDisabled) {
+		return respond(c, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	}
+	if errors.Is(err, postgres.ErrNotFound) || err.Error() == "conversation not found" {
+		return respond(c, http.StatusNotFound, ErrorResponse{Error: "conversation not found"})
+	}
+	var wrongConv *agent.SuggestionConversationError
+	if errors.As(err, &wrongConv) {
+		return respond(c, http.StatusConflict, ErrorResponse{
+			Error:   "suggestion belongs to another conversation",
+			Code:    agent.ErrorCodeSuggestionWrongConversation,
+			Details: map[string]string{"conversation_id": wrongConv.ConversationID},
+		})
+	}
+	var notAllowed *agent.AddressNotAllowedError
+	if errors.As(err, &notAllowed) {
+		return respond(c, http.StatusUnprocessableEntity, ErrorResponse{
+			Error:   "policy uses an address that is not in your wallet or contacts",
+			Code:    agent.ErrorCodeAddressNotAllowed,
+			Details: map[string]string{"address": notAllowed.Address},
+		})
+	}
+	if errors.Is(err, verifier.ErrUnauthorized) {
+		return respond(c, http.StatusUnauthorized, ErrorResponse{
+			Error: "your session with the plugin service has expired; please sign in again",
+			Code:  agent.ErrorCodeReauthRequired,
+		})
+	}
+	if errors.Is(err, verifier.ErrUnavailable) {
+		return respond(c, http.StatusServiceUnavailable, ErrorResponse{
+			Error: "the plugin service is unavailable; please try again shortly",
+			Code:  agent.ErrorCodeVerifierUnavailable,
+		})
+	}
+	var full *agent.ConversationFullError
+	if errors.As(err, &full) {
+		return respond(c, http.StatusConflict, ErrorResponse{
+			Error:   "conversation has reached its message limit; fork it with summary_only to continue",
+			Code:    agent.ErrorCodeConversationFull,
+			Details: map[string]string{"messages": strconv.Itoa(full.Messages)},
+		})
+	}
+	entry := s.logger.WithError(err).WithField("conversation_id", convID)
+	var msgErr *agent.MessageError
+	if errors.As(err, &msgErr) {
+		entry = entry.WithFields(logrus.Fields{"ability": msgErr.Ability, "outcome": msgErr.Outcome})
+	}
+	entry.Error("failed to process message")
+	return respond(c, http.StatusInternalServerError, ErrorResponse{Error: "failed to process message"})
+}
+
+// AbortMessageRequest is the request body for aborting the reply in progress.
+type AbortMessageRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// AbortMessage handles POST /agent/conversations/:id/messages/abort
+func (s *Server) AbortMessage(c echo.Context) error {
+	convID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
-		if errors.Is(err, postgres.ErrNotFound) || err.Error() == "conversation not found" {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+
+	var req AbortMessageRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	if err := s.agentService.AbortMessage(c.Request().Context(), convID, req.PublicKey); err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
 			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "conversation not found"})
 		}
-		s.logger.WithError(err).Error("failed to process message")
-		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to process message"})
+		if errors.Is(err, agent.ErrNothingInFlight) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "no message in progress"})
+		}
+		s.logger.WithError(err).Error("failed to abort message")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to abort message"})
 	}
 
-	// 6. Return SendMessageResponse
-	return c.JSON(http.StatusOK, resp)
+	return c.JSON(http.StatusOK, SuccessResponse{Success: true})
 }
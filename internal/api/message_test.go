@@ -0,0 +1,258 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestStartConversation(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		agent      *fakeAgent
+		wantStatus int
+		// wantCalls is the number of messages sent to the agent
+		wantCalls int
+	}{
+		{
+			name:       "success",
+			body:       `{"public_key":"` + testPublicKey + `","content":"hi","no_memory":true}`,
+			agent:      &fakeAgent{resp: &agent.SendMessageResponse{Message: types.Message{Role: types.RoleAssistant, Content: "hello"}}},
+			wantStatus: http.StatusCreated,
+			wantCalls:  1,
+		},
+		{
+			name:       "first message fails after it was stored",
+			body:       `{"public_key":"` + testPublicKey + `","content":"hi"}`,
+			agent:      &fakeAgent{err: errors.New("model overloaded")},
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  1,
+		},
+		{
+			name:       "first message fails before it was stored",
+			body:       `{"public_key":"` + testPublicKey + `","content":"hi"}`,
+			agent:      &fakeAgent{err: agent.ErrConversationBusy, errBeforeStore: true},
+			wantStatus: http.StatusConflict,
+			wantCalls:  1,
+		},
+		{
+			name:       "no content",
+			body:       `{"public_key":"` + testPublicKey + `"}`,
+			agent:      &fakeAgent{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "suggestion selection",
+			body:       `{"public_key":"` + testPublicKey + `","content":"hi","selected_suggestion_id":"sug_1"}`,
+			agent:      &fakeAgent{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "public key mismatch",
+			body:       `{"public_key":"someone-else","content":"hi"}`,
+			agent:      &fakeAgent{},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convs := newFakeConversations()
+			tt.agent.convs = convs
+			s := &Server{convRepo: convs, agentService: tt.agent, maxContextAddresses: testMaxAddresses, logger: testLogger()}
+
+			c, rec := authed(http.MethodPost, "/agent/conversations/start", tt.body)
+			if err := s.StartConversation(c); err != nil {
+				t.Fatalf("StartConversation() error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if len(tt.agent.calls) != tt.wantCalls {
+				t.Errorf("agent got %d messages, want %d", len(tt.agent.calls), tt.wantCalls)
+			}
+
+			if rec.Code != http.StatusCreated {
+				// A failed start leaves no conversation behind, whether or not the first
+				// message was stored
+				if len(convs.conversations) != 0 {
+					t.Errorf("%d conversations left after a failed start", len(convs.conversations))
+				}
+				if len(convs.deleted) != tt.wantCalls {
+					t.Errorf("deleted %d conversations, want %d", len(convs.deleted), tt.wantCalls)
+				}
+				return
+			}
+
+			var got StartConversationResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.Conversation == nil || got.Response == nil || got.Response.Message.Content != "hello" {
+				t.Fatalf("body = %s, want the conversation and the first reply", rec.Body)
+			}
+			conv, ok := convs.conversations[got.Conversation.ID]
+			if !ok || len(convs.deleted) != 0 {
+				t.Fatalf("conversation %s not kept", got.Conversation.ID)
+			}
+			if !conv.NoMemory {
+				t.Error("no_memory not applied to the conversation")
+			}
+			if msgs := convs.messages[conv.ID]; len(msgs) != 1 || msgs[0].Content != "hi" {
+				t.Errorf("conversation messages = %+v, want the first message", msgs)
+			}
+		})
+	}
+}
+
+func TestRetryMessage(t *testing.T) {
+	tests := []struct {
+		name       string
+		convID     string
+		messageID  string
+		agent      *fakeAgent
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "success",
+			agent:      &fakeAgent{resp: &agent.SendMessageResponse{Message: types.Message{Role: types.RoleAssistant, Content: "Which chain?"}}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "already replied",
+			agent:      &fakeAgent{err: agent.ErrMessageAlreadyReplied},
+			wantStatus: http.StatusConflict,
+			wantCode:   agent.ErrorCodeMessageAlreadyReplied,
+		},
+		{
+			name:       "wrong role",
+			agent:      &fakeAgent{err: agent.ErrMessageNotRetryable},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "missing message",
+			agent:      &fakeAgent{err: fmt.Errorf("get message: %w", postgres.ErrNotFound)},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "conversation busy",
+			agent:      &fakeAgent{err: agent.ErrConversationBusy},
+			wantStatus: http.StatusConflict,
+			wantCode:   agent.ErrorCodeConversationBusy,
+		},
+		{
+			name:       "invalid message id",
+			messageID:  "not-a-uuid",
+			agent:      &fakeAgent{},
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{agentService: tt.agent, maxContextAddresses: testMaxAddresses, logger: testLogger()}
+
+			c, rec := authed(http.MethodPost, "/agent/conversations/retry", `{"public_key":"`+testPublicKey+`"}`)
+			c.SetParamNames("id", "message_id")
+			c.SetParamValues(cmp.Or(tt.convID, uuid.NewString()), cmp.Or(tt.messageID, uuid.NewString()))
+			if err := s.RetryMessage(c); err != nil {
+				t.Fatalf("RetryMessage() error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			switch tt.wantStatus {
+			case http.StatusBadRequest:
+				if len(tt.agent.calls) != 0 {
+					t.Errorf("agent got %d retries for a bad request", len(tt.agent.calls))
+				}
+				return
+			case http.StatusOK:
+				var got agent.SendMessageResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Message.Content != "Which chain?" {
+					t.Errorf("body = %s, want the new reply", rec.Body)
+				}
+				return
+			}
+			var got ErrorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if got.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", got.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestSendMessageMaxTokens(t *testing.T) {
+	const maxTokensCap = 8192
+	tests := []struct {
+		name       string
+		maxTokens  string
+		wantStatus int
+	}{
+		{name: "not set", wantStatus: http.StatusOK},
+		{name: "within bounds", maxTokens: "4000", wantStatus: http.StatusOK},
+		{name: "at the cap", maxTokens: "8192", wantStatus: http.StatusOK},
+		{name: "over the cap", maxTokens: "8193", wantStatus: http.StatusBadRequest},
+		{name: "zero", maxTokens: "0", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fa := &fakeAgent{
+				convs: newFakeConversations(),
+				resp:  &agent.SendMessageResponse{Message: types.Message{Role: types.RoleAssistant, Content: "hello"}},
+			}
+			s := &Server{agentService: fa, maxContextAddresses: testMaxAddresses, maxTokensCap: maxTokensCap, logger: testLogger()}
+
+			body := `{"public_key":"` + testPublicKey + `","content":"explain vaults in detail"`
+			if tt.maxTokens != "" {
+				body += `,"max_tokens":` + tt.maxTokens
+			}
+			c, rec := authed(http.MethodPost, "/agent/conversations/messages", body+"}")
+			c.SetParamNames("id")
+			c.SetParamValues(uuid.NewString())
+			if err := s.SendMessage(c); err != nil {
+				t.Fatalf("SendMessage() error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus == http.StatusBadRequest {
+				var got ErrorResponse
+				if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Error != fmt.Sprintf("max_tokens must be between 1 and %d", maxTokensCap) {
+					t.Errorf("error = %q, want the max_tokens bounds", got.Error)
+				}
+				if len(fa.calls) != 0 {
+					t.Errorf("agent got %d messages for a rejected max_tokens", len(fa.calls))
+				}
+				return
+			}
+			// The override reaches the agent as sent
+			if len(fa.calls) != 1 {
+				t.Fatalf("agent got %d messages, want 1", len(fa.calls))
+			}
+			got := fa.calls[0].MaxTokens
+			if tt.maxTokens == "" {
+				if got != nil {
+					t.Errorf("MaxTokens = %d, want unset", *got)
+				}
+			} else if got == nil || fmt.Sprint(*got) != tt.maxTokens {
+				t.Errorf("MaxTokens = %v, want %s", got, tt.maxTokens)
+			}
+		})
+	}
+}
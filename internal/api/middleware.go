@@ -1,12 +1,29 @@
 package api
 
 import (
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
 	"github.com/labstack/echo/v4"
+
+	"github.com/vultisig/agent-backend/internal/requestid"
+	"github.com/vultisig/agent-backend/internal/service"
 )
 
+// RequestIDContext stores the id assigned by Echo's RequestID middleware in the request
+// context so downstream clients can forward it. Must be registered after middleware.RequestID.
+func RequestIDContext(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Response().Header().Get(echo.HeaderXRequestID)
+		if id != "" {
+			req := c.Request()
+			c.SetRequest(req.WithContext(requestid.WithID(req.Context(), id)))
+		}
+		return next(c)
+	}
+}
+
 // AuthMiddleware validates JWT tokens and extracts the public key.
 func (s *Server) AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
@@ -25,17 +42,52 @@ func (s *Server) AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 			return c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid token"})
 		}
 
-		c.Set("public_key", claims.PublicKey)
+		// Keys are stored lowercase; anything that isn't a vault public key is refused
+		publicKey, err := service.NormalizePublicKey(claims.PublicKey)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid public key in token"})
+		}
+
+		c.Set("public_key", publicKey)
 		return next(c)
 	}
 }
 
+// AdminAuth requires the static admin token as a bearer token.
+func AdminAuth(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			got, found := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				return c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid admin token"})
+			}
+			return next(c)
+		}
+	}
+}
+
 // GetPublicKey extracts the public key from the echo context.
 func GetPublicKey(c echo.Context) string {
 	pk, _ := c.Get("public_key").(string)
 	return pk
 }
 
+// GetAbility returns the ability a message request is routed to, or "" for other requests.
+func GetAbility(c echo.Context) string {
+	ability, _ := c.Get("ability").(string)
+	return ability
+}
+
+// matchPublicKey normalizes a public key taken from a request body in place and reports
+// whether it is the authenticated key, so a different case isn't a mismatch. Malformed
+// keys are left as they are and never match.
+func matchPublicKey(bodyKey *string, authPublicKey string) bool {
+	if normalized, err := service.NormalizePublicKey(*bodyKey); err == nil {
+		*bodyKey = normalized
+	}
+	return *bodyKey == authPublicKey
+}
+
 // GetAccessToken extracts the raw JWT from Authorization header.
 func GetAccessToken(c echo.Context) string {
 	auth := c.Request().Header.Get("Authorization")
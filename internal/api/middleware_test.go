@@ -0,0 +1,183 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+
+	"github.com/vultisig/agent-backend/internal/requestid"
+	"github.com/vultisig/agent-backend/internal/service"
+)
+
+const testJWTSecret = "test-secret"
+
+// testToken signs an access token for publicKey with testJWTSecret.
+func testToken(t *testing.T, publicKey, tokenType string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &service.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+		PublicKey:        publicKey,
+		TokenID:          "token-1",
+		TokenType:        tokenType,
+	}).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	eddsaKey := strings.Repeat("0f", 32)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantKey    string
+	}{
+		{
+			name:       "lowercase ecdsa key",
+			header:     "Bearer " + testToken(t, testPublicKey, service.TokenTypeAccess),
+			wantStatus: http.StatusOK,
+			wantKey:    testPublicKey,
+		},
+		{
+			name:       "uppercase ecdsa key normalized",
+			header:     "Bearer " + testToken(t, strings.ToUpper(testPublicKey), service.TokenTypeAccess),
+			wantStatus: http.StatusOK,
+			wantKey:    testPublicKey,
+		},
+		{
+			name:       "mixed-case eddsa key normalized",
+			header:     "bearer " + testToken(t, "0F"+eddsaKey[2:], service.TokenTypeAccess),
+			wantStatus: http.StatusOK,
+			wantKey:    eddsaKey,
+		},
+		{
+			name:       "missing header",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "not a bearer token",
+			header:     "Basic " + testToken(t, testPublicKey, service.TokenTypeAccess),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "bad signature",
+			header:     "Bearer " + testToken(t, testPublicKey, service.TokenTypeAccess) + "x",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "refresh token",
+			header:     "Bearer " + testToken(t, testPublicKey, "refresh"),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "key of the wrong length",
+			header:     "Bearer " + testToken(t, testPublicKey[:40], service.TokenTypeAccess),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "key that isn't hex",
+			header:     "Bearer " + testToken(t, strings.Repeat("zz", 33), service.TokenTypeAccess),
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{authService: service.NewAuthService(testJWTSecret)}
+			req := httptest.NewRequest(http.MethodGet, "/agent/conversations", nil)
+			if tt.header != "" {
+				req.Header.Set(echo.HeaderAuthorization, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(req, rec)
+
+			var gotKey string
+			handler := s.AuthMiddleware(func(c echo.Context) error {
+				gotKey = GetPublicKey(c)
+				return c.NoContent(http.StatusOK)
+			})
+			if err := handler(c); err != nil {
+				t.Fatalf("handler error = %v", err)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if gotKey != tt.wantKey {
+				t.Errorf("public key = %q, want %q", gotKey, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestRequestIDContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		inbound string
+	}{
+		{name: "id from the caller", inbound: "req-123"},
+		{name: "id assigned by echo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.Use(middleware.RequestID(), RequestIDContext)
+			var got string
+			e.GET("/", func(c echo.Context) error {
+				got = requestid.FromContext(c.Request().Context())
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.inbound != "" {
+				req.Header.Set(echo.HeaderXRequestID, tt.inbound)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			// The context carries the id the response reports, for clients to forward
+			want := rec.Header().Get(echo.HeaderXRequestID)
+			if got == "" || got != want {
+				t.Errorf("context request id = %q, want the response's %q", got, want)
+			}
+			if tt.inbound != "" && got != tt.inbound {
+				t.Errorf("context request id = %q, want the caller's %q", got, tt.inbound)
+			}
+		})
+	}
+}
+
+func TestMatchPublicKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		bodyKey   string
+		wantMatch bool
+		wantKey   string
+	}{
+		{name: "same key", bodyKey: testPublicKey, wantMatch: true, wantKey: testPublicKey},
+		{name: "different case", bodyKey: strings.ToUpper(testPublicKey), wantMatch: true, wantKey: testPublicKey},
+		{name: "another key", bodyKey: strings.Repeat("CD", 33), wantKey: strings.Repeat("cd", 33)},
+		{name: "malformed key left as is", bodyKey: "ABC", wantKey: "ABC"},
+		{name: "empty", bodyKey: "", wantKey: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := tt.bodyKey
+			if got := matchPublicKey(&key, testPublicKey); got != tt.wantMatch {
+				t.Errorf("matchPublicKey(%q) = %v, want %v", tt.bodyKey, got, tt.wantMatch)
+			}
+			if key != tt.wantKey {
+				t.Errorf("body key = %q, want %q", key, tt.wantKey)
+			}
+		})
+	}
+}
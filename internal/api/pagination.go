@@ -0,0 +1,29 @@
+package api
+
+// clampTake normalizes a requested page size: non-positive values fall back to
+// defaultTake and anything above maxTake is capped.
+func clampTake(take, defaultTake, maxTake int) int {
+	if take <= 0 {
+		return defaultTake
+	}
+	if take > maxTake {
+		return maxTake
+	}
+	return take
+}
+
+// maxSkip is the largest page offset accepted. Offsets are passed to Postgres as 32-bit
+// integers, and no user has anywhere near this many conversations or messages.
+const maxSkip = 1_000_000
+
+// clampSkip ensures the page offset is never negative. ok is false for offsets above
+// maxSkip, which are rejected rather than overflowing the query parameter.
+func clampSkip(skip int) (clamped int, ok bool) {
+	if skip < 0 {
+		return 0, true
+	}
+	if skip > maxSkip {
+		return 0, false
+	}
+	return skip, true
+}
@@ -0,0 +1,48 @@
+package api
+
+import "testing"
+
+func TestClampTake(t *testing.T) {
+	tests := []struct {
+		name string
+		take int
+		want int
+	}{
+		{"zero uses default", 0, 20},
+		{"negative uses default", -5, 20},
+		{"within range", 30, 30},
+		{"at max", 100, 100},
+		{"above max is capped", 101, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clampTake(tt.take, 20, 100); got != tt.want {
+				t.Errorf("clampTake(%d) = %d, want %d", tt.take, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClampSkip(t *testing.T) {
+	tests := []struct {
+		name   string
+		skip   int
+		want   int
+		wantOK bool
+	}{
+		{"negative becomes zero", -1, 0, true},
+		{"zero", 0, 0, true},
+		{"within range", 40, 40, true},
+		{"at max", maxSkip, maxSkip, true},
+		{"above max is rejected", maxSkip + 1, 0, false},
+		{"past int32 is rejected", 1 << 40, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := clampSkip(tt.skip)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("clampSkip(%d) = %d, %v, want %d, %v", tt.skip, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/service/plugin"
+)
+
+// PluginsResponse is the response body for listing plugins.
+type PluginsResponse struct {
+	Plugins []agent.PluginInfo `json:"plugins"`
+}
+
+// ListPlugins handles GET /agent/plugins
+// It returns the agent's view of the plugin catalog, with installation state for the
+// authenticated user when the verifier could be asked.
+func (s *Server) ListPlugins(c echo.Context) error {
+	plugins := s.agentService.ListPlugins(c.Request().Context(), GetPublicKey(c), GetAccessToken(c))
+	return c.JSON(http.StatusOK, PluginsResponse{Plugins: plugins})
+}
+
+// GetSkillsStatus handles GET /admin/plugins/skills/status
+// It reports how old the plugin skills the agent is serving are, where they came from and
+// the last failed verifier fetch, so a verifier outage doesn't go unnoticed.
+func (s *Server) GetSkillsStatus(c echo.Context) error {
+	if s.plugins == nil {
+		return c.JSON(http.StatusOK, plugin.SkillsStatus{Plugins: []plugin.PluginSkillsStatus{}})
+	}
+	return c.JSON(http.StatusOK, s.plugins.Status())
+}
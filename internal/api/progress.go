@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/vultisig/agent-backend/internal/service/agent"
+)
+
+// eventStreamKey is the echo context key of the event stream a reply is sent on.
+const eventStreamKey = "event_stream"
+
+// StreamError is the data of a stream's error event: the status a plain JSON response would
+// have had, with its body.
+type StreamError struct {
+	Status int `json:"status"`
+	ErrorResponse
+}
+
+// eventStream sends a reply as server-sent events: progress events while the reply is
+// prepared, then a single message or error event. Sends are locked since progress may be
+// reported from goroutines the turn starts, and dropped once the final event was sent.
+type eventStream struct {
+	mu   sync.Mutex
+	resp *echo.Response
+	done bool
+}
+
+// startProgress starts an event stream for the reply when the client accepts
+// text/event-stream, and returns the context to process the message with, which reports
+// progress to the stream. Other clients get the request's context and a plain JSON reply.
+func (s *Server) startProgress(c echo.Context) context.Context {
+	ctx := c.Request().Context()
+	if !strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream") {
+		return ctx
+	}
+
+	resp := c.Response()
+	resp.Header().Set(echo.HeaderContentType, "text/event-stream")
+	resp.Header().Set(echo.HeaderCacheControl, "no-cache")
+	// Keeps proxies from holding events back until the reply is done
+	resp.Header().Set("X-Accel-Buffering", "no")
+	resp.WriteHeader(http.StatusOK)
+	resp.Flush()
+
+	stream := &eventStream{resp: resp}
+	c.Set(eventStreamKey, stream)
+	return agent.WithProgress(ctx, func(e agent.ProgressEvent) {
+		if err := stream.send("progress", e, false); err != nil {
+			s.logger.WithError(err).Debug("failed to send progress event")
+		}
+	})
+}
+
+// send writes one event; final closes the stream to further events.
+func (es *eventStream) send(event string, data any, final bool) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", event, err)
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.done {
+		return nil
+	}
+	es.done = final
+	if _, err := fmt.Fprintf(es.resp, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	es.resp.Flush()
+	return nil
+}
+
+// respond sends a message handler's final response: as a message or error event when the
+// reply is streamed, otherwise as JSON with status. A nil body sends nothing on a stream
+// and no content otherwise.
+func respond(c echo.Context, status int, body any) error {
+	stream, ok := c.Get(eventStreamKey).(*eventStream)
+	if !ok {
+		if body == nil {
+			return c.NoContent(status)
+		}
+		return c.JSON(status, body)
+	}
+
+	switch b := body.(type) {
+	case nil:
+		return nil
+	case ErrorResponse:
+		return stream.send("error", StreamError{Status: status, ErrorResponse: b}, true)
+	default:
+		return stream.send("message", b, true)
+	}
+}
@@ -3,6 +3,9 @@ package api
 // ErrorResponse represents an error response.
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Code is a stable machine-readable error identifier, set for errors the app handles specially
+	Code    string            `json:"code,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
 }
 
 // SuccessResponse represents a generic success response.
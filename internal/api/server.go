@@ -1,27 +1,112 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
 	"github.com/vultisig/agent-backend/internal/service"
 	"github.com/vultisig/agent-backend/internal/service/agent"
+	"github.com/vultisig/agent-backend/internal/service/attachment"
+	"github.com/vultisig/agent-backend/internal/service/flags"
+	"github.com/vultisig/agent-backend/internal/service/plugin"
+	"github.com/vultisig/agent-backend/internal/service/share"
+	"github.com/vultisig/agent-backend/internal/service/voice"
 	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
 )
 
+// ConversationStore reads and writes the conversations handlers serve directly.
+// *postgres.ConversationRepository is the production implementation.
+type ConversationStore interface {
+	Create(ctx context.Context, publicKey string, noMemory bool) (*types.Conversation, error)
+	Fork(ctx context.Context, id uuid.UUID, publicKey string, cutoffMessageID *uuid.UUID, summaryOnly bool) (*types.Conversation, error)
+	GetWithMessages(ctx context.Context, id uuid.UUID, publicKey string) (*types.ConversationWithMessages, error)
+	ListMessages(ctx context.Context, id uuid.UUID, publicKey string, skip, take int) ([]types.Message, int, error)
+	DeleteMessage(ctx context.Context, id, messageID uuid.UUID, publicKey string) error
+	List(ctx context.Context, publicKey string, tags, labels []string, skip, take int) ([]types.Conversation, int, error)
+	Archive(ctx context.Context, id uuid.UUID, publicKey string) error
+	Delete(ctx context.Context, id uuid.UUID, publicKey string) error
+	AddLabels(ctx context.Context, id uuid.UUID, publicKey string, labels []string, maxLabels int) ([]string, error)
+	RemoveLabels(ctx context.Context, id uuid.UUID, publicKey string, labels []string) ([]string, error)
+}
+
+var _ ConversationStore = (*postgres.ConversationRepository)(nil)
+
+// AgentService is the agent behaviour handlers call into.
+// *agent.AgentService is the production implementation.
+type AgentService interface {
+	ProcessMessage(ctx context.Context, convID uuid.UUID, publicKey string, req *agent.SendMessageRequest) (*agent.SendMessageResponse, error)
+	RetryMessage(ctx context.Context, convID, messageID uuid.UUID, req *agent.SendMessageRequest) (*agent.SendMessageResponse, error)
+	AbortMessage(ctx context.Context, convID uuid.UUID, publicKey string) error
+	RefreshSuggestions(ctx context.Context, messages []types.Message)
+	GetPolicyDraft(ctx context.Context, convID uuid.UUID, publicKey string) (*types.PolicyDraft, error)
+	SummarizeConversation(ctx context.Context, convID uuid.UUID, publicKey string) (*agent.SummarizeResult, error)
+	BulkConversations(ctx context.Context, req *agent.BulkConversationsRequest) (*agent.BulkConversationsResponse, error)
+	ImportConversation(ctx context.Context, req *agent.ImportConversationRequest) (*types.Conversation, error)
+	ExportConversation(ctx context.Context, convID uuid.UUID) (*agent.ConversationExport, error)
+	ImportExport(ctx context.Context, in *agent.ConversationExport) (*types.Conversation, error)
+	ListPlugins(ctx context.Context, publicKey, accessToken string) []agent.PluginInfo
+	UserStats(ctx context.Context, publicKey string) (*types.UserStats, error)
+	DebugBundle(ctx context.Context, convID, messageID uuid.UUID, redact bool) (json.RawMessage, error)
+	ResponseOutcomeStats(ctx context.Context, days int) ([]agent.ResponseOutcomeDay, error)
+	ToolParseFailures(ctx context.Context, limit int) ([]types.ToolParseFailure, error)
+	ToolParseFailure(ctx context.Context, id uuid.UUID) (*types.ToolParseFailure, error)
+	StartDedupe(ctx context.Context, dryRun bool) (*agent.DedupeJob, error)
+	DedupeStatus(ctx context.Context) *agent.DedupeJob
+}
+
+var _ AgentService = (*agent.AgentService)(nil)
+
 // Server holds API dependencies.
 type Server struct {
 	authService  *service.AuthService
-	convRepo     *postgres.ConversationRepository
-	agentService *agent.AgentService
+	convRepo     ConversationStore
+	contactRepo  *postgres.ContactRepository
+	keyRepo      *postgres.PublicKeyRepository
+	agentService AgentService
+	shareService *share.Service            // nil when share links are disabled
+	attachments  *attachment.Service       // nil when attachments are disabled
+	userURLs     *httpclient.UserURLClient // fetches URLs supplied in requests
+	voice        *voice.Service            // nil when voice replies are disabled
+	flags        *flags.Store
+	plugins      *plugin.Service
 	logger       *logrus.Logger
+	pagination   config.PaginationConfig
+	maxContacts  int
+	maxLabels    int
+	// maxContextAddresses caps wallet context addresses per message
+	maxContextAddresses int
+	// strictRequests decodes send-message bodies strictly; see bindStrict
+	strictRequests bool
+	// maxTokensCap bounds the max_tokens a send-message request may ask for
+	maxTokensCap int
 }
 
 // NewServer creates a new API server.
-func NewServer(authService *service.AuthService, convRepo *postgres.ConversationRepository, agentService *agent.AgentService, logger *logrus.Logger) *Server {
+func NewServer(authService *service.AuthService, convRepo ConversationStore, contactRepo *postgres.ContactRepository, keyRepo *postgres.PublicKeyRepository, agentService AgentService, shareService *share.Service, attachmentService *attachment.Service, userURLs *httpclient.UserURLClient, voiceService *voice.Service, flagStore *flags.Store, pluginService *plugin.Service, logger *logrus.Logger, pagination config.PaginationConfig, maxContacts, maxLabels, maxContextAddresses, maxTokensCap int, strictRequests bool) *Server {
 	return &Server{
-		authService:  authService,
-		convRepo:     convRepo,
-		agentService: agentService,
-		logger:       logger,
+		authService:         authService,
+		convRepo:            convRepo,
+		contactRepo:         contactRepo,
+		keyRepo:             keyRepo,
+		agentService:        agentService,
+		shareService:        shareService,
+		attachments:         attachmentService,
+		userURLs:            userURLs,
+		voice:               voiceService,
+		flags:               flagStore,
+		plugins:             pluginService,
+		logger:              logger,
+		pagination:          pagination,
+		maxContacts:         maxContacts,
+		maxLabels:           maxLabels,
+		maxContextAddresses: maxContextAddresses,
+		strictRequests:      strictRequests,
+		maxTokensCap:        maxTokensCap,
 	}
 }
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"github.com/vultisig/agent-backend/internal/service/share"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+)
+
+// CreateShareRequest is the request body for creating a conversation share link.
+type CreateShareRequest struct {
+	PublicKey string `json:"public_key"`
+	// TTLSeconds is the link lifetime; zero uses the server default
+	TTLSeconds int `json:"ttl_seconds,omitempty"`
+}
+
+// RevokeShareRequest is the request body for revoking a conversation share link.
+type RevokeShareRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// CreateShare issues a read-only share link for a conversation, replacing any active one.
+func (s *Server) CreateShare(c echo.Context) error {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+
+	var req CreateShareRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	link, err := s.shareService.Create(c.Request().Context(), id, req.PublicKey, time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		if errors.Is(err, share.ErrInvalidTTL) {
+			return c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("ttl_seconds must be between 0 and %d", int(s.shareService.MaxTTL().Seconds()))})
+		}
+		if errors.Is(err, postgres.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "conversation not found"})
+		}
+		s.logger.WithError(err).Error("failed to create share link")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to create share link"})
+	}
+
+	return c.JSON(http.StatusCreated, link)
+}
+
+// RevokeShare revokes a conversation's active share link.
+func (s *Server) RevokeShare(c echo.Context) error {
+	idStr := c.Param("id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid conversation id"})
+	}
+
+	var req RevokeShareRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request body"})
+	}
+
+	authPublicKey := GetPublicKey(c)
+	if !matchPublicKey(&req.PublicKey, authPublicKey) {
+		return c.JSON(http.StatusForbidden, ErrorResponse{Error: "public key mismatch"})
+	}
+
+	err = s.shareService.Revoke(c.Request().Context(), id, req.PublicKey)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: "conversation not found"})
+		}
+		if errors.Is(err, share.ErrNotShared) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		}
+		s.logger.WithError(err).Error("failed to revoke share link")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to revoke share link"})
+	}
+
+	return c.JSON(http.StatusOK, SuccessResponse{Success: true})
+}
+
+// GetSharedTranscript returns the read-only transcript behind a share token. It is public
+// and rate limited per client IP.
+func (s *Server) GetSharedTranscript(c echo.Context) error {
+	transcript, err := s.shareService.Transcript(c.Request().Context(), c.Param("token"), c.RealIP())
+	if err != nil {
+		if errors.Is(err, share.ErrRateLimited) {
+			return c.JSON(http.StatusTooManyRequests, ErrorResponse{Error: err.Error()})
+		}
+		if errors.Is(err, share.ErrNotFound) {
+			return c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		}
+		s.logger.WithError(err).Error("failed to load shared transcript")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to load shared transcript"})
+	}
+
+	return c.JSON(http.StatusOK, transcript)
+}
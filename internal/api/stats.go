@@ -0,0 +1,17 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GetStats returns aggregated activity stats for the authenticated user.
+func (s *Server) GetStats(c echo.Context) error {
+	stats, err := s.agentService.UserStats(c.Request().Context(), GetPublicKey(c))
+	if err != nil {
+		s.logger.WithError(err).Error("failed to get user stats")
+		return c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get stats"})
+	}
+	return c.JSON(http.StatusOK, stats)
+}
@@ -2,18 +2,23 @@ package redis
 
 import (
 	"context"
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
-// Client wraps the Redis client.
+// Client wraps the Redis client. Every key is namespaced with the configured prefix so the
+// agent can share a Redis instance with other services or environments.
 type Client struct {
-	rdb *redis.Client
+	rdb    *redis.Client
+	prefix string
 }
 
-// New creates a new Redis client from a URI.
-func New(uri string) (*Client, error) {
+// New creates a new Redis client from a URI. A non-empty keyPrefix (e.g. "agent:prod") is
+// prepended to every key, separated by a colon.
+func New(uri, keyPrefix string) (*Client, error) {
 	opt, err := redis.ParseURL(uri)
 	if err != nil {
 		return nil, err
@@ -29,22 +34,157 @@ func New(uri string) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{rdb: rdb}, nil
+	return newClient(rdb, keyPrefix), nil
+}
+
+// newClient wraps rdb, namespacing every key with keyPrefix.
+func newClient(rdb *redis.Client, keyPrefix string) *Client {
+	if keyPrefix != "" && !strings.HasSuffix(keyPrefix, ":") {
+		keyPrefix += ":"
+	}
+	return &Client{rdb: rdb, prefix: keyPrefix}
+}
+
+// prefixed applies the key prefix.
+func (c *Client) prefixed(key string) string {
+	return c.prefix + key
 }
 
 // Get retrieves a value by key.
 func (c *Client) Get(ctx context.Context, key string) (string, error) {
-	return c.rdb.Get(ctx, key).Result()
+	return c.rdb.Get(ctx, c.prefixed(key)).Result()
 }
 
 // Set stores a value with an optional TTL.
 func (c *Client) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
-	return c.rdb.Set(ctx, key, value, ttl).Err()
+	return c.rdb.Set(ctx, c.prefixed(key), value, ttl).Err()
+}
+
+// Exists reports whether a key is present.
+func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
+	n, err := c.rdb.Exists(ctx, c.prefixed(key)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ExistsMany reports whether each key is present, in one pipelined round trip.
+func (c *Client) ExistsMany(ctx context.Context, keys []string) ([]bool, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Exists(ctx, c.prefixed(key))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	exists := make([]bool, len(keys))
+	for i, cmd := range cmds {
+		exists[i] = cmd.Val() > 0
+	}
+	return exists, nil
+}
+
+// SetMany stores several values with the same TTL in one pipelined round trip.
+func (c *Client) SetMany(ctx context.Context, values map[string]string, ttl time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	pipe := c.rdb.Pipeline()
+	for key, value := range values {
+		pipe.Set(ctx, c.prefixed(key), value, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Incr increments a counter and (re)sets its TTL, returning the new value.
+func (c *Client) Incr(ctx context.Context, key string, ttl time.Duration) (int64, error) {
+	pipe := c.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, c.prefixed(key))
+	pipe.Expire(ctx, c.prefixed(key), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// HIncr increments a field of a hash and (re)sets the hash's TTL, returning the new value.
+func (c *Client) HIncr(ctx context.Context, key, field string, ttl time.Duration) (int64, error) {
+	pipe := c.rdb.TxPipeline()
+	incr := pipe.HIncrBy(ctx, c.prefixed(key), field, 1)
+	pipe.Expire(ctx, c.prefixed(key), ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// HGetAll returns every field of a hash; a missing key yields an empty map.
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return c.rdb.HGetAll(ctx, c.prefixed(key)).Result()
+}
+
+// SetNX stores a value with a TTL only if the key is absent, reporting whether it was set.
+func (c *Client) SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error) {
+	return c.rdb.SetNX(ctx, c.prefixed(key), value, ttl).Result()
+}
+
+// deleteIfEqualScript deletes KEYS[1] only while it still holds ARGV[1].
+var deleteIfEqualScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// DeleteIfEqual removes a key only if it still holds value, so a holder whose TTL lapsed
+// can't remove a key someone else has since set. Reports whether the key was removed.
+func (c *Client) DeleteIfEqual(ctx context.Context, key, value string) (bool, error) {
+	n, err := deleteIfEqualScript.Run(ctx, c.rdb, []string{c.prefixed(key)}, value).Int()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
 }
 
 // Delete removes a key.
 func (c *Client) Delete(ctx context.Context, key string) error {
-	return c.rdb.Del(ctx, key).Err()
+	return c.rdb.Del(ctx, c.prefixed(key)).Err()
+}
+
+// Publish sends a message to a channel. Channel names are prefixed like keys.
+func (c *Client) Publish(ctx context.Context, channel, message string) error {
+	return c.rdb.Publish(ctx, c.prefixed(channel), message).Err()
+}
+
+// Subscribe passes each message published to channel to handle, until ctx is done or the
+// subscription fails. It returns once the subscription can't deliver messages anymore.
+func (c *Client) Subscribe(ctx context.Context, channel string, handle func(payload string)) error {
+	sub := c.rdb.Subscribe(ctx, c.prefixed(channel))
+	defer sub.Close()
+
+	// Wait for the subscription to be confirmed so connection errors surface here
+	if _, err := sub.Receive(ctx); err != nil {
+		return err
+	}
+
+	msgs := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-msgs:
+			if !ok {
+				return errors.New("subscription closed")
+			}
+			handle(msg.Payload)
+		}
+	}
 }
 
 // Close closes the Redis connection.
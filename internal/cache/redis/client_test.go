@@ -0,0 +1,109 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyRecorder answers every command without a server, recording the key each was sent with.
+type keyRecorder struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (r *keyRecorder) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (r *keyRecorder) ProcessHook(redis.ProcessHook) redis.ProcessHook {
+	return func(_ context.Context, cmd redis.Cmder) error {
+		r.record(cmd)
+		return nil
+	}
+}
+
+func (r *keyRecorder) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(_ context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			r.record(cmd)
+		}
+		return nil
+	}
+}
+
+func (r *keyRecorder) record(cmd redis.Cmder) {
+	args := cmd.Args()
+	var key any
+	switch cmd.Name() {
+	case "multi", "exec":
+		return
+	case "eval", "evalsha":
+		// EVALSHA sha numkeys key...
+		key = args[3]
+	default:
+		key = args[1]
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys = append(r.keys, key.(string))
+}
+
+func (r *keyRecorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := r.keys
+	r.keys = nil
+	return keys
+}
+
+func TestClientPrefixesKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{name: "prefix", prefix: "agent:prod", want: "agent:prod:pending_build:conv-1"},
+		{name: "prefix with separator", prefix: "agent:staging:", want: "agent:staging:pending_build:conv-1"},
+		{name: "no prefix", want: "pending_build:conv-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+			t.Cleanup(func() { _ = rdb.Close() })
+			rec := &keyRecorder{}
+			rdb.AddHook(rec)
+			c := newClient(rdb, tt.prefix)
+
+			ctx := context.Background()
+			const key = "pending_build:conv-1"
+			ops := map[string]func(){
+				"Get":           func() { _, _ = c.Get(ctx, key) },
+				"Set":           func() { _ = c.Set(ctx, key, "v", time.Minute) },
+				"Exists":        func() { _, _ = c.Exists(ctx, key) },
+				"ExistsMany":    func() { _, _ = c.ExistsMany(ctx, []string{key}) },
+				"SetMany":       func() { _ = c.SetMany(ctx, map[string]string{key: "v"}, time.Minute) },
+				"Incr":          func() { _, _ = c.Incr(ctx, key, time.Minute) },
+				"HIncr":         func() { _, _ = c.HIncr(ctx, key, "field", time.Minute) },
+				"HGetAll":       func() { _, _ = c.HGetAll(ctx, key) },
+				"SetNX":         func() { _, _ = c.SetNX(ctx, key, "v", time.Minute) },
+				"DeleteIfEqual": func() { _, _ = c.DeleteIfEqual(ctx, key, "v") },
+				"Delete":        func() { _ = c.Delete(ctx, key) },
+				"Publish":       func() { _ = c.Publish(ctx, key, "v") },
+			}
+			for name, op := range ops {
+				op()
+				keys := rec.recorded()
+				if len(keys) == 0 {
+					t.Errorf("%s sent no commands", name)
+				}
+				for _, got := range keys {
+					if got != tt.want {
+						t.Errorf("%s sent key %q, want %q", name, got, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
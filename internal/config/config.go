@@ -1,18 +1,45 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
+
+	"github.com/vultisig/agent-backend/internal/netguard"
 )
 
 // Config holds all configuration for the agent-backend service.
 type Config struct {
-	LogFormat string `envconfig:"LOG_FORMAT" default:"json"`
-	Server    ServerConfig
-	Database  DatabaseConfig
-	Redis     RedisConfig
-	Anthropic AnthropicConfig
-	Context   ContextConfig
-	Verifier  VerifierConfig
+	LogFormat     string `envconfig:"LOG_FORMAT" default:"json"`
+	Server        ServerConfig
+	Database      DatabaseConfig
+	Redis         RedisConfig
+	Anthropic     AnthropicConfig
+	Context       ContextConfig
+	Agent         AgentConfig
+	Docs          DocsConfig
+	NameService   NameServiceConfig
+	Explorer      ExplorerConfig
+	SwapQuote     SwapQuoteConfig
+	Fees          FeeConfig
+	Recall        RecallConfig
+	Outbox        OutboxConfig
+	Notify        NotifyConfig
+	HTTPRetry     HTTPRetryConfig
+	HTTPTransport HTTPTransportConfig
+	Outbound      OutboundConfig
+	Verifier      VerifierConfig
+	Warm          WarmConfig
+	Share         ShareConfig
+	Attachments   AttachmentsConfig
+	Blob          BlobConfig
+	TTS           TTSConfig
+	Flags         FlagsConfig
+	Pagination    PaginationConfig
 }
 
 // ServerConfig holds HTTP server configuration.
@@ -20,6 +47,14 @@ type ServerConfig struct {
 	Host      string `envconfig:"SERVER_HOST" default:"0.0.0.0"`
 	Port      string `envconfig:"SERVER_PORT" default:"8080"`
 	JWTSecret string `envconfig:"JWT_SECRET" required:"true"`
+	// AdminToken authenticates the /admin endpoints; they are not served when it is empty
+	AdminToken string `envconfig:"ADMIN_TOKEN" default:""`
+	// Request body limits in bytes: MaxBodyBytes applies to conversation and contact CRUD,
+	// MaxMessageBodyBytes to sending messages (which carry wallet context) and
+	// MaxImportBodyBytes to conversation imports.
+	MaxBodyBytes        int64 `envconfig:"MAX_BODY_BYTES" default:"65536"`
+	MaxMessageBodyBytes int64 `envconfig:"MAX_MESSAGE_BODY_BYTES" default:"524288"`
+	MaxImportBodyBytes  int64 `envconfig:"MAX_IMPORT_BODY_BYTES" default:"1048576"`
 }
 
 // DatabaseConfig holds PostgreSQL configuration.
@@ -30,6 +65,9 @@ type DatabaseConfig struct {
 // RedisConfig holds Redis configuration.
 type RedisConfig struct {
 	URI string `envconfig:"REDIS_URI" required:"true"`
+	// KeyPrefix namespaces every key (e.g. "agent:prod") when Redis is shared with other
+	// services or environments. Empty keeps keys unprefixed.
+	KeyPrefix string `envconfig:"REDIS_KEY_PREFIX"`
 }
 
 // AnthropicConfig holds Anthropic Claude API configuration.
@@ -37,6 +75,47 @@ type AnthropicConfig struct {
 	APIKey       string `envconfig:"ANTHROPIC_API_KEY" required:"true"`
 	Model        string `envconfig:"ANTHROPIC_MODEL" default:"claude-sonnet-4-20250514"`
 	SummaryModel string `envconfig:"ANTHROPIC_SUMMARY_MODEL" default:"claude-haiku-4-5-20251001"`
+	// MaxConcurrent caps in-flight requests; excess requests queue until a slot frees up.
+	MaxConcurrent int `envconfig:"ANTHROPIC_MAX_CONCURRENT_REQUESTS" default:"16"`
+	// Prices are the per-model token prices turn cost estimates are computed from.
+	Prices ModelPrices `envconfig:"ANTHROPIC_MODEL_PRICES" default:"claude-sonnet-4-20250514=3/15,claude-haiku-4-5-20251001=1/5"`
+}
+
+// ModelPrice is a model's price in USD per million input and output tokens.
+type ModelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// ModelPrices maps model names to token prices, decoded from comma-separated
+// model=input/output pairs in USD per million tokens.
+type ModelPrices map[string]ModelPrice
+
+// Decode implements envconfig.Decoder.
+func (p *ModelPrices) Decode(value string) error {
+	prices := ModelPrices{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		model, price, ok := strings.Cut(pair, "=")
+		in, out, ok2 := strings.Cut(price, "/")
+		if !ok || !ok2 || strings.TrimSpace(model) == "" {
+			return fmt.Errorf("invalid model price %q, expected model=input/output", pair)
+		}
+		input, err := strconv.ParseFloat(strings.TrimSpace(in), 64)
+		if err != nil || input < 0 {
+			return fmt.Errorf("invalid input price in %q", pair)
+		}
+		output, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+		if err != nil || output < 0 {
+			return fmt.Errorf("invalid output price in %q", pair)
+		}
+		prices[strings.TrimSpace(model)] = ModelPrice{Input: input, Output: output}
+	}
+	*p = prices
+	return nil
 }
 
 // TODO: Add WhisperConfig for OpenAI Whisper voice transcription support.
@@ -46,11 +125,334 @@ type ContextConfig struct {
 	WindowSize       int `envconfig:"CONTEXT_WINDOW_SIZE" default:"20"`
 	SummarizeTrigger int `envconfig:"CONTEXT_SUMMARIZE_TRIGGER" default:"30"`
 	SummaryMaxTokens int `envconfig:"CONTEXT_SUMMARY_MAX_TOKENS" default:"512"`
+	// SummaryChunkSize caps how many messages go into one summarization call; longer
+	// backlogs are summarized oldest-first in chunks, each folded into the next. 0 disables chunking.
+	SummaryChunkSize int `envconfig:"CONTEXT_SUMMARY_CHUNK_SIZE" default:"0"`
+	// SummaryPrompt replaces the built-in summarization instructions, e.g. to ask for bullets
+	// or leave out amounts. The previous summary and the messages are still appended after it.
+	// Empty uses the built-in prompt.
+	SummaryPrompt string `envconfig:"CONTEXT_SUMMARY_PROMPT" default:""`
+	// MaxMessages is the soft cap past which the agent suggests starting a fresh conversation.
+	MaxMessages int `envconfig:"MAX_CONVERSATION_MESSAGES" default:"500"`
+	// HardMaxMessages is the cap past which new messages are refused.
+	HardMaxMessages int `envconfig:"MAX_CONVERSATION_MESSAGES_HARD" default:"1000"`
+}
+
+// AgentConfig holds agent service behavior settings.
+type AgentConfig struct {
+	// OwnershipCheckOnInsert skips the up-front conversation lookup in ProcessMessage and
+	// relies on the ownership-guarded reads and inserts instead, saving a round-trip per message.
+	OwnershipCheckOnInsert bool `envconfig:"AGENT_OWNERSHIP_CHECK_ON_INSERT" default:"false"`
+	// MaxPromptBalances caps how many balances are rendered into prompts, highest value first.
+	MaxPromptBalances int `envconfig:"AGENT_MAX_PROMPT_BALANCES" default:"40"`
+	// MaxPromptPlugins caps how many plugins' skills are rendered into prompts, most
+	// relevant to the user's message first.
+	MaxPromptPlugins int `envconfig:"AGENT_MAX_PROMPT_PLUGINS" default:"8"`
+	// SuggestionRehydrateWindow is how old a message's suggestions may be and still be
+	// re-issued when a conversation is reloaded after they expired. Older ones are marked expired.
+	SuggestionRehydrateWindow time.Duration `envconfig:"AGENT_SUGGESTION_REHYDRATE_WINDOW" default:"24h"`
+	// MaxResponseChars caps the length of model-produced responses before they are stored.
+	MaxResponseChars int `envconfig:"AGENT_MAX_RESPONSE_CHARS" default:"4000"`
+	// Default reply token budgets per ability: intent detection, policy building (large
+	// configurations need room) and action confirmation (short replies).
+	IntentMaxTokens  int `envconfig:"AGENT_INTENT_MAX_TOKENS" default:"4096"`
+	PolicyMaxTokens  int `envconfig:"AGENT_POLICY_MAX_TOKENS" default:"8192"`
+	ConfirmMaxTokens int `envconfig:"AGENT_CONFIRM_MAX_TOKENS" default:"1024"`
+	// MaxTokensCap is the largest max_tokens a send-message request may ask for its reply.
+	MaxTokensCap int `envconfig:"AGENT_MAX_TOKENS_CAP" default:"8192"`
+	// MaxContacts caps the number of address book entries per user.
+	MaxContacts int `envconfig:"AGENT_MAX_CONTACTS" default:"100"`
+	// MaxLabels caps the number of user labels per conversation.
+	MaxLabels int `envconfig:"AGENT_MAX_LABELS" default:"10"`
+	// MaxContextAddresses caps the chain addresses a message's wallet context may carry.
+	MaxContextAddresses int `envconfig:"AGENT_MAX_CONTEXT_ADDRESSES" default:"50"`
+	// SystemPromptAppendix holds deployment-specific instructions (a promo, a compliance
+	// disclaimer) added to the system prompt after the base prompt, before plugin skills.
+	SystemPromptAppendix string `envconfig:"AGENT_SYSTEM_PROMPT_APPENDIX" default:""`
+	// BuildFailureThreshold is how many consecutive failed policy builds in a conversation
+	// are tolerated before the agent offers help instead of retrying.
+	BuildFailureThreshold int `envconfig:"AGENT_BUILD_FAILURE_THRESHOLD" default:"3"`
+	// ConversationLockTTL bounds how long one message holds its conversation's lock, so a
+	// crashed instance can't block the conversation. It should exceed the slowest reply.
+	ConversationLockTTL time.Duration `envconfig:"AGENT_CONVERSATION_LOCK_TTL" default:"2m"`
+	// ConversationLockWait is how long a message waits for the previous one in the same
+	// conversation before it is rejected as busy.
+	ConversationLockWait time.Duration `envconfig:"AGENT_CONVERSATION_LOCK_WAIT" default:"3s"`
+	// SupportURL is linked from the help response offered after repeated build failures.
+	SupportURL string `envconfig:"AGENT_SUPPORT_URL" default:"https://docs.vultisig.com"`
+	// PluginInstallURL is the deeplink template offered with suggestions whose plugin isn't
+	// installed; {plugin_id} is replaced with the plugin ID. Empty omits the link.
+	PluginInstallURL string `envconfig:"AGENT_PLUGIN_INSTALL_URL" default:"vultisig://plugins/{plugin_id}/install"`
+	// FastPathEnabled answers trivial messages ("thanks", "ok") with a canned reply or a
+	// minimal summary-model call, skipping tools and full context assembly.
+	FastPathEnabled bool `envconfig:"AGENT_FAST_PATH_ENABLED" default:"true"`
+	// MinSuggestionConfidence is the confidence (0-1) the model must report for
+	// suggestions to be shown as action chips; below it they are returned as withheld suggestions
+	// the app may mention. 0 disables the gate.
+	MinSuggestionConfidence float64 `envconfig:"AGENT_MIN_SUGGESTION_CONFIDENCE" default:"0"`
+	// Below ClarifyConfidence in its intent the model's suggestions are replaced by a clarifying
+	// question; below TentativeConfidence they are shown flagged as tentative. 0 disables either.
+	ClarifyConfidence   float64 `envconfig:"AGENT_CLARIFY_CONFIDENCE" default:"0.4"`
+	TentativeConfidence float64 `envconfig:"AGENT_TENTATIVE_CONFIDENCE" default:"0.7"`
+	// ToolParseFailureSampleRate is the share (0-1) of unparseable tool inputs kept in the
+	// dead-letter table for prompt debugging. Every failure is still counted in metrics.
+	ToolParseFailureSampleRate float64 `envconfig:"AGENT_TOOL_PARSE_FAILURE_SAMPLE_RATE" default:"1"`
+	// DuplicateConversationWindow is how close together one user's conversations must be
+	// created for the dedupe maintenance routine to compare them.
+	DuplicateConversationWindow time.Duration `envconfig:"AGENT_DUPLICATE_CONVERSATION_WINDOW" default:"1m"`
+	// BulkRequestsPerMinute caps how many bulk conversation operations one user may run a
+	// minute. Each can touch many conversations, so it is limited apart from other requests.
+	BulkRequestsPerMinute int `envconfig:"AGENT_BULK_REQUESTS_PER_MINUTE" default:"5"`
+
+	// TitleMode is how conversations are titled after their first exchange: "truncate" cuts
+	// the first message, "generate" has the summary model write a title, falling back to
+	// the truncated message when that fails.
+	TitleMode string `envconfig:"AGENT_TITLE_MODE" default:"truncate"`
+	// DebugSnapshotTTL is how long the exact request and response behind each reply are kept
+	// for admin debug bundles. 0 disables capturing them.
+	DebugSnapshotTTL time.Duration `envconfig:"AGENT_DEBUG_SNAPSHOT_TTL" default:"24h"`
+	// DefaultLocale formats amounts in backend-written text (permissions summaries, balance
+	// warnings) for messages whose wallet context carries no locale.
+	DefaultLocale string `envconfig:"AGENT_DEFAULT_LOCALE" default:"en-US"`
+	// Maximum fractional digits shown for amounts in backend-written text, per asset class;
+	// fiat amounts always show exactly FiatDisplayDecimals.
+	CryptoDisplayDecimals     int `envconfig:"AGENT_CRYPTO_DISPLAY_DECIMALS" default:"8"`
+	StablecoinDisplayDecimals int `envconfig:"AGENT_STABLECOIN_DISPLAY_DECIMALS" default:"2"`
+	FiatDisplayDecimals       int `envconfig:"AGENT_FIAT_DISPLAY_DECIMALS" default:"2"`
+	// StrictRequests rejects send-message bodies with unknown fields or wrongly typed values,
+	// and malformed wallet context, with a 400 naming the field instead of ignoring them.
+	StrictRequests bool `envconfig:"AGENT_STRICT_REQUESTS" default:"false"`
+}
+
+// MaxSystemPromptAppendix bounds AGENT_SYSTEM_PROMPT_APPENDIX so it can't balloon token cost.
+const MaxSystemPromptAppendix = 2000
+
+// MaxSummaryPrompt bounds CONTEXT_SUMMARY_PROMPT, which is sent with every summarization call.
+const MaxSummaryPrompt = 4000
+
+// OutboxConfig holds settings for delivering side effects recorded with messages.
+type OutboxConfig struct {
+	PollInterval  time.Duration `envconfig:"OUTBOX_POLL_INTERVAL" default:"5s"`
+	BatchSize     int           `envconfig:"OUTBOX_BATCH_SIZE" default:"50"`
+	MaxAttempts   int           `envconfig:"OUTBOX_MAX_ATTEMPTS" default:"10"`
+	RetryBase     time.Duration `envconfig:"OUTBOX_RETRY_BASE" default:"5s"`
+	FastPathGrace time.Duration `envconfig:"OUTBOX_FAST_PATH_GRACE" default:"30s"`
+	Retention     time.Duration `envconfig:"OUTBOX_RETENTION" default:"24h"`
+}
+
+// NotifyConfig holds settings for the webhook notices sent shortly before a policy draft or
+// a reply's suggestions expire, so the app can bring the user back in time.
+type NotifyConfig struct {
+	Enabled       bool   `envconfig:"EXPIRY_NOTIFY_ENABLED" default:"false"`
+	WebhookURL    string `envconfig:"EXPIRY_NOTIFY_WEBHOOK_URL"`
+	WebhookSecret string `envconfig:"EXPIRY_NOTIFY_WEBHOOK_SECRET"`
+	// Window is how long before expiry a notice is sent
+	Window       time.Duration `envconfig:"EXPIRY_NOTIFY_WINDOW" default:"10m"`
+	ScanInterval time.Duration `envconfig:"EXPIRY_NOTIFY_SCAN_INTERVAL" default:"1m"`
+	BatchSize    int           `envconfig:"EXPIRY_NOTIFY_BATCH_SIZE" default:"100"`
+	// ResumeURL is the deep link sent with a notice; {conversation_id} is replaced
+	ResumeURL string `envconfig:"EXPIRY_NOTIFY_RESUME_URL" default:"vultisig://agent/conversations/{conversation_id}"`
+}
+
+// NameServiceConfig holds ENS and SNS resolution settings.
+type NameServiceConfig struct {
+	Enabled        bool          `envconfig:"NAME_SERVICE_ENABLED" default:"true"`
+	EthereumRPCURL string        `envconfig:"NAME_SERVICE_ETH_RPC_URL" default:"https://ethereum-rpc.publicnode.com"`
+	SolanaRPCURL   string        `envconfig:"NAME_SERVICE_SOL_RPC_URL" default:"https://api.mainnet-beta.solana.com"`
+	CacheTTL       time.Duration `envconfig:"NAME_SERVICE_CACHE_TTL" default:"10m"`
+}
+
+// ExplorerConfig holds block explorer settings for transaction status lookups.
+// EVM chains go through an Etherscan-compatible multichain API keyed by chain ID;
+// Bitcoin goes through an Esplora API. Leaving a URL empty disables those chains.
+type ExplorerConfig struct {
+	Enabled          bool              `envconfig:"EXPLORER_ENABLED" default:"true"`
+	EtherscanURL     string            `envconfig:"EXPLORER_ETHERSCAN_URL" default:"https://api.etherscan.io/v2/api"`
+	EtherscanAPIKey  string            `envconfig:"EXPLORER_ETHERSCAN_API_KEY"`
+	EVMChains        map[string]string `envconfig:"EXPLORER_EVM_CHAINS" default:"ethereum:1,arbitrum:42161,base:8453,optimism:10,polygon:137,bsc:56,avalanche:43114"`
+	BitcoinURL       string            `envconfig:"EXPLORER_BITCOIN_URL" default:"https://blockstream.info/api"`
+	LookupsPerMinute int               `envconfig:"EXPLORER_LOOKUPS_PER_MINUTE" default:"10"`
+}
+
+// SwapQuoteConfig holds THORChain swap quote settings.
+type SwapQuoteConfig struct {
+	Enabled  bool          `envconfig:"SWAP_QUOTE_ENABLED" default:"true"`
+	URL      string        `envconfig:"SWAP_QUOTE_THORNODE_URL" default:"https://thornode.ninerealms.com"`
+	CacheTTL time.Duration `envconfig:"SWAP_QUOTE_CACHE_TTL" default:"30s"`
+}
+
+// FeeConfig holds network fee estimation settings. EVM chains are estimated from a JSON-RPC
+// endpoint, UTXO chains from an Esplora fee-rate API.
+type FeeConfig struct {
+	Enabled    bool          `envconfig:"FEE_ESTIMATE_ENABLED" default:"true"`
+	EVMRPCURLs ChainURLs     `envconfig:"FEE_ESTIMATE_EVM_RPC_URLS" default:"ethereum=https://ethereum-rpc.publicnode.com,arbitrum=https://arbitrum-one-rpc.publicnode.com,base=https://base-rpc.publicnode.com,optimism=https://optimism-rpc.publicnode.com,polygon=https://polygon-bor-rpc.publicnode.com,bsc=https://bsc-rpc.publicnode.com,avalanche=https://avalanche-c-chain-rpc.publicnode.com"`
+	UTXOURLs   ChainURLs     `envconfig:"FEE_ESTIMATE_UTXO_URLS" default:"bitcoin=https://blockstream.info/api,litecoin=https://litecoinspace.org/api"`
+	CacheTTL   time.Duration `envconfig:"FEE_ESTIMATE_CACHE_TTL" default:"30s"`
+}
+
+// ChainURLs maps chain names to URLs, decoded from comma-separated chain=url pairs.
+// envconfig's built-in map decoding splits on ':' and can't hold URLs.
+type ChainURLs map[string]string
+
+// Decode implements envconfig.Decoder.
+func (c *ChainURLs) Decode(value string) error {
+	urls := ChainURLs{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		chain, url, ok := strings.Cut(pair, "=")
+		if !ok || chain == "" || url == "" {
+			return fmt.Errorf("invalid chain URL %q, expected chain=url", pair)
+		}
+		urls[strings.TrimSpace(chain)] = strings.TrimSpace(url)
+	}
+	*c = urls
+	return nil
+}
+
+// DocsConfig holds documentation retrieval configuration for grounding general answers.
+type DocsConfig struct {
+	Enabled   bool    `envconfig:"DOCS_RAG_ENABLED" default:"false"`
+	MaxChunks int     `envconfig:"DOCS_RAG_MAX_CHUNKS" default:"3"`
+	MinScore  float64 `envconfig:"DOCS_RAG_MIN_SCORE" default:"1.5"`
+}
+
+// RecallConfig holds semantic recall configuration: older messages similar to the incoming
+// one are retrieved by embedding and added to the prompt.
+type RecallConfig struct {
+	Enabled  bool   `envconfig:"RECALL_ENABLED" default:"false"`
+	Provider string `envconfig:"RECALL_EMBEDDING_PROVIDER" default:"voyage"` // voyage or openai
+	APIKey   string `envconfig:"RECALL_EMBEDDING_API_KEY"`
+	// Model defaults to the provider's small general-purpose model when empty
+	Model       string  `envconfig:"RECALL_EMBEDDING_MODEL"`
+	TopK        int     `envconfig:"RECALL_TOP_K" default:"5"`
+	MaxDistance float64 `envconfig:"RECALL_MAX_DISTANCE" default:"0.6"` // cosine distance, 0-2
+}
+
+// HTTPRetryConfig holds the retry policy for outbound calls to Anthropic and the verifier.
+type HTTPRetryConfig struct {
+	// MaxAttempts counts the first attempt; 1 disables retries
+	MaxAttempts int           `envconfig:"HTTP_RETRY_MAX_ATTEMPTS" default:"3"`
+	BaseDelay   time.Duration `envconfig:"HTTP_RETRY_BASE_DELAY" default:"250ms"`
+	// MaxDelay caps the backoff; a longer Retry-After from the server ends the retries
+	MaxDelay time.Duration `envconfig:"HTTP_RETRY_MAX_DELAY" default:"5s"`
+}
+
+// HTTPTransportConfig tunes the connection pool shared by the outbound service clients.
+type HTTPTransportConfig struct {
+	MaxIdleConns        int           `envconfig:"HTTP_MAX_IDLE_CONNS" default:"100"`
+	MaxIdleConnsPerHost int           `envconfig:"HTTP_MAX_IDLE_CONNS_PER_HOST" default:"32"`
+	IdleConnTimeout     time.Duration `envconfig:"HTTP_IDLE_CONN_TIMEOUT" default:"90s"`
+	DialTimeout         time.Duration `envconfig:"HTTP_DIAL_TIMEOUT" default:"10s"`
+	TLSHandshakeTimeout time.Duration `envconfig:"HTTP_TLS_HANDSHAKE_TIMEOUT" default:"10s"`
+	// ProxyURL overrides the HTTPS_PROXY/HTTP_PROXY environment variables when set
+	ProxyURL string `envconfig:"HTTP_PROXY_URL"`
+	// LogRequests logs every outbound request at debug level
+	LogRequests bool `envconfig:"HTTP_LOG_REQUESTS" default:"false"`
+}
+
+// OutboundConfig holds the outbound URL policy. Configured service URLs must be https and
+// not internal IP literals; URLs supplied in requests are only fetched from allowlisted
+// hosts, through a dedicated client with size and time limits.
+type OutboundConfig struct {
+	// InternalHosts may be reached over http and at internal addresses, e.g. an in-cluster verifier
+	InternalHosts []string `envconfig:"OUTBOUND_INTERNAL_HOSTS"`
+	// UserURLHosts are the hosts request-supplied URLs (audio, attachments) may be fetched
+	// from; when empty none are fetched
+	UserURLHosts    []string      `envconfig:"OUTBOUND_USER_URL_HOSTS"`
+	UserURLMaxBytes int64         `envconfig:"OUTBOUND_USER_URL_MAX_BYTES" default:"10485760"`
+	UserURLTimeout  time.Duration `envconfig:"OUTBOUND_USER_URL_TIMEOUT" default:"10s"`
 }
 
 // VerifierConfig holds verifier service configuration.
 type VerifierConfig struct {
 	URL string `envconfig:"VERIFIER_URL" required:"true"`
+	// SkillsStaleAfter is the age past which served plugin skills are reported stale
+	SkillsStaleAfter time.Duration `envconfig:"PLUGIN_SKILLS_STALE_AFTER" default:"1h"`
+}
+
+// WarmConfig holds startup cache warming settings. When enabled, plugin skills and the
+// recipe schemas of a few plugins are fetched before the instance reports ready.
+type WarmConfig struct {
+	Enabled bool `envconfig:"WARM_CACHES" default:"false"`
+	// Plugins lists the plugin IDs whose recipe schemas are warmed; when empty, the first
+	// TopN available plugins are used
+	Plugins []string `envconfig:"WARM_CACHES_PLUGINS"`
+	TopN    int      `envconfig:"WARM_CACHES_TOP_N" default:"5"`
+	// Budget bounds the whole warm-up so a slow verifier can't hold back readiness
+	Budget time.Duration `envconfig:"WARM_CACHES_BUDGET" default:"10s"`
+}
+
+// ShareConfig holds settings for read-only conversation share links. Each conversation has
+// at most one active link; creating a new one revokes the previous.
+type ShareConfig struct {
+	Enabled    bool          `envconfig:"SHARE_ENABLED" default:"false"`
+	DefaultTTL time.Duration `envconfig:"SHARE_DEFAULT_TTL" default:"24h"`
+	MaxTTL     time.Duration `envconfig:"SHARE_MAX_TTL" default:"168h"`
+	// RedactAddresses masks wallet-address-like strings in shared transcripts
+	RedactAddresses bool `envconfig:"SHARE_REDACT_ADDRESSES" default:"true"`
+	// RequestsPerMinute limits transcript fetches per client IP on the public endpoint
+	RequestsPerMinute int `envconfig:"SHARE_REQUESTS_PER_MINUTE" default:"30"`
+}
+
+// MaxAttachmentBytes is the largest image the model accepts inline.
+const MaxAttachmentBytes = 5 << 20
+
+// AttachmentsConfig holds settings for images users attach to messages, such as a
+// screenshot of a failed transaction. Images are kept in the blob bucket and sent to the
+// model as image blocks; while disabled, uploads and messages with attachments are refused.
+type AttachmentsConfig struct {
+	Enabled bool `envconfig:"ATTACHMENTS_ENABLED" default:"false"`
+	// MaxBytes caps one image, at most MaxAttachmentBytes
+	MaxBytes      int64 `envconfig:"ATTACHMENTS_MAX_BYTES" default:"5242880"`
+	MaxPerMessage int   `envconfig:"ATTACHMENTS_MAX_PER_MESSAGE" default:"4"`
+}
+
+// BlobConfig holds the S3-compatible bucket attachments and voice replies are stored in. PathStyle puts the
+// bucket in the URL path instead of the host name, as MinIO and most self-hosted servers need.
+type BlobConfig struct {
+	Endpoint        string `envconfig:"BLOB_ENDPOINT"`
+	Region          string `envconfig:"BLOB_REGION" default:"us-east-1"`
+	Bucket          string `envconfig:"BLOB_BUCKET"`
+	AccessKeyID     string `envconfig:"BLOB_ACCESS_KEY_ID"`
+	SecretAccessKey string `envconfig:"BLOB_SECRET_ACCESS_KEY"`
+	PathStyle       bool   `envconfig:"BLOB_PATH_STYLE" default:"true"`
+}
+
+// TTSConfig holds text-to-speech settings for voice replies, which are synthesized when a
+// message asks for reply_format "audio" and kept in the blob bucket.
+type TTSConfig struct {
+	Enabled  bool   `envconfig:"TTS_ENABLED" default:"false"`
+	Provider string `envconfig:"TTS_PROVIDER" default:"openai"` // openai or elevenlabs
+	APIKey   string `envconfig:"TTS_API_KEY"`
+	// Model and Voice default to the provider's fast model and a neutral voice when empty
+	Model string `envconfig:"TTS_MODEL"`
+	Voice string `envconfig:"TTS_VOICE"`
+	// MaxChars caps the text of one reply sent for synthesis; longer replies are cut at a
+	// sentence or word boundary
+	MaxChars int `envconfig:"TTS_MAX_CHARS" default:"2000"`
+}
+
+// FlagsConfig holds the defaults of the operational kill switches. Runtime overrides set via
+// the admin API are stored in Redis; these values apply when there is none or Redis is down.
+type FlagsConfig struct {
+	Memory        bool `envconfig:"FLAG_MEMORY" default:"true"`
+	Summarization bool `envconfig:"FLAG_SUMMARIZATION" default:"true"`
+	Suggestions   bool `envconfig:"FLAG_SUGGESTIONS" default:"true"`
+	Tools         bool `envconfig:"FLAG_TOOLS" default:"true"`
+	// CacheTTL bounds how long a replica serves a flag without re-reading it; overrides
+	// normally propagate sooner through pub/sub
+	CacheTTL time.Duration `envconfig:"FLAGS_CACHE_TTL" default:"5s"`
+}
+
+// PaginationConfig holds default and maximum page sizes for list endpoints.
+type PaginationConfig struct {
+	ConversationsDefaultTake int `envconfig:"CONVERSATIONS_DEFAULT_TAKE" default:"20"`
+	ConversationsMaxTake     int `envconfig:"CONVERSATIONS_MAX_TAKE" default:"100"`
+	MessagesDefaultTake      int `envconfig:"MESSAGES_DEFAULT_TAKE" default:"50"`
+	MessagesMaxTake          int `envconfig:"MESSAGES_MAX_TAKE" default:"200"`
 }
 
 // TODO: Add MetricsConfig for Prometheus metrics when metrics are implemented.
@@ -73,6 +475,219 @@ func (c *Config) Validate() error {
 	if c.Server.Port == "" {
 		c.Server.Port = "8080"
 	}
+	if c.Server.MaxBodyBytes <= 0 || c.Server.MaxMessageBodyBytes <= 0 || c.Server.MaxImportBodyBytes <= 0 {
+		return fmt.Errorf("MAX_BODY_BYTES, MAX_MESSAGE_BODY_BYTES and MAX_IMPORT_BODY_BYTES must be positive")
+	}
+	if c.Pagination.ConversationsDefaultTake <= 0 || c.Pagination.ConversationsDefaultTake > c.Pagination.ConversationsMaxTake {
+		return fmt.Errorf("CONVERSATIONS_DEFAULT_TAKE must be between 1 and CONVERSATIONS_MAX_TAKE (%d)", c.Pagination.ConversationsMaxTake)
+	}
+	if c.Pagination.MessagesDefaultTake <= 0 || c.Pagination.MessagesDefaultTake > c.Pagination.MessagesMaxTake {
+		return fmt.Errorf("MESSAGES_DEFAULT_TAKE must be between 1 and MESSAGES_MAX_TAKE (%d)", c.Pagination.MessagesMaxTake)
+	}
+	if c.Anthropic.MaxConcurrent <= 0 {
+		return fmt.Errorf("ANTHROPIC_MAX_CONCURRENT_REQUESTS must be positive")
+	}
+	if c.Agent.MaxPromptBalances <= 0 {
+		return fmt.Errorf("AGENT_MAX_PROMPT_BALANCES must be positive")
+	}
+	if c.Agent.MaxPromptPlugins <= 0 {
+		return fmt.Errorf("AGENT_MAX_PROMPT_PLUGINS must be positive")
+	}
+	if c.Agent.MaxResponseChars <= 0 {
+		return fmt.Errorf("AGENT_MAX_RESPONSE_CHARS must be positive")
+	}
+	if c.Agent.MaxTokensCap <= 0 {
+		return fmt.Errorf("AGENT_MAX_TOKENS_CAP must be positive")
+	}
+	if c.Agent.IntentMaxTokens <= 0 || c.Agent.PolicyMaxTokens <= 0 || c.Agent.ConfirmMaxTokens <= 0 {
+		return fmt.Errorf("AGENT_INTENT_MAX_TOKENS, AGENT_POLICY_MAX_TOKENS and AGENT_CONFIRM_MAX_TOKENS must be positive")
+	}
+	if c.Agent.MaxContacts <= 0 {
+		return fmt.Errorf("AGENT_MAX_CONTACTS must be positive")
+	}
+	if c.Agent.MinSuggestionConfidence < 0 || c.Agent.MinSuggestionConfidence > 1 {
+		return fmt.Errorf("AGENT_MIN_SUGGESTION_CONFIDENCE must be between 0 and 1")
+	}
+	if c.Agent.ClarifyConfidence < 0 || c.Agent.TentativeConfidence > 1 || c.Agent.ClarifyConfidence > c.Agent.TentativeConfidence {
+		return fmt.Errorf("AGENT_CLARIFY_CONFIDENCE and AGENT_TENTATIVE_CONFIDENCE must be between 0 and 1, clarify not above tentative")
+	}
+	if c.Agent.ToolParseFailureSampleRate < 0 || c.Agent.ToolParseFailureSampleRate > 1 {
+		return fmt.Errorf("AGENT_TOOL_PARSE_FAILURE_SAMPLE_RATE must be between 0 and 1")
+	}
+	if c.Agent.DuplicateConversationWindow <= 0 {
+		return fmt.Errorf("AGENT_DUPLICATE_CONVERSATION_WINDOW must be positive")
+	}
+	if c.Agent.BulkRequestsPerMinute <= 0 {
+		return fmt.Errorf("AGENT_BULK_REQUESTS_PER_MINUTE must be positive")
+	}
+	if c.Agent.TitleMode != "truncate" && c.Agent.TitleMode != "generate" {
+		return fmt.Errorf("AGENT_TITLE_MODE must be truncate or generate")
+	}
+	if c.Agent.DebugSnapshotTTL < 0 {
+		return fmt.Errorf("AGENT_DEBUG_SNAPSHOT_TTL must not be negative")
+	}
+	if c.Agent.MaxLabels <= 0 {
+		return fmt.Errorf("AGENT_MAX_LABELS must be positive")
+	}
+	if c.Agent.MaxContextAddresses <= 0 {
+		return fmt.Errorf("AGENT_MAX_CONTEXT_ADDRESSES must be positive")
+	}
+	if c.Explorer.Enabled && c.Explorer.LookupsPerMinute <= 0 {
+		return fmt.Errorf("EXPLORER_LOOKUPS_PER_MINUTE must be positive")
+	}
+	if c.SwapQuote.Enabled && c.SwapQuote.URL == "" {
+		return fmt.Errorf("SWAP_QUOTE_THORNODE_URL is required when SWAP_QUOTE_ENABLED is true")
+	}
+	if c.Recall.Enabled {
+		if c.Recall.Provider != "voyage" && c.Recall.Provider != "openai" {
+			return fmt.Errorf("RECALL_EMBEDDING_PROVIDER must be voyage or openai")
+		}
+		if c.Recall.APIKey == "" {
+			return fmt.Errorf("RECALL_EMBEDDING_API_KEY is required when RECALL_ENABLED is true")
+		}
+		if c.Recall.TopK <= 0 {
+			return fmt.Errorf("RECALL_TOP_K must be positive")
+		}
+	}
+	if c.Agent.ConversationLockTTL <= 0 || c.Agent.ConversationLockWait < 0 {
+		return fmt.Errorf("AGENT_CONVERSATION_LOCK_TTL must be positive and AGENT_CONVERSATION_LOCK_WAIT not negative")
+	}
+	if c.Agent.CryptoDisplayDecimals < 0 || c.Agent.StablecoinDisplayDecimals < 0 || c.Agent.FiatDisplayDecimals < 0 {
+		return fmt.Errorf("AGENT_CRYPTO_DISPLAY_DECIMALS, AGENT_STABLECOIN_DISPLAY_DECIMALS and AGENT_FIAT_DISPLAY_DECIMALS must not be negative")
+	}
+	if c.Agent.BuildFailureThreshold <= 0 {
+		return fmt.Errorf("AGENT_BUILD_FAILURE_THRESHOLD must be positive")
+	}
+	if c.Outbound.UserURLMaxBytes <= 0 || c.Outbound.UserURLTimeout <= 0 {
+		return fmt.Errorf("OUTBOUND_USER_URL_MAX_BYTES and OUTBOUND_USER_URL_TIMEOUT must be positive")
+	}
+	if err := c.checkOutboundURLs(); err != nil {
+		return err
+	}
+	if c.Agent.PluginInstallURL != "" && !strings.Contains(c.Agent.PluginInstallURL, "{plugin_id}") {
+		return fmt.Errorf("AGENT_PLUGIN_INSTALL_URL must contain {plugin_id}")
+	}
+	if c.Context.SummaryPrompt != "" && strings.TrimSpace(c.Context.SummaryPrompt) == "" {
+		return fmt.Errorf("CONTEXT_SUMMARY_PROMPT must not be blank")
+	}
+	if len(c.Context.SummaryPrompt) > MaxSummaryPrompt {
+		return fmt.Errorf("CONTEXT_SUMMARY_PROMPT must be at most %d bytes", MaxSummaryPrompt)
+	}
+	if len(c.Agent.SystemPromptAppendix) > MaxSystemPromptAppendix {
+		return fmt.Errorf("AGENT_SYSTEM_PROMPT_APPENDIX must be at most %d bytes", MaxSystemPromptAppendix)
+	}
+	if c.Context.SummaryChunkSize < 0 {
+		return fmt.Errorf("CONTEXT_SUMMARY_CHUNK_SIZE must not be negative")
+	}
+	if c.Context.MaxMessages <= 0 || c.Context.HardMaxMessages < c.Context.MaxMessages {
+		return fmt.Errorf("MAX_CONVERSATION_MESSAGES must be positive and not above MAX_CONVERSATION_MESSAGES_HARD (%d)", c.Context.HardMaxMessages)
+	}
+	if c.Outbox.PollInterval <= 0 || c.Outbox.BatchSize <= 0 || c.Outbox.MaxAttempts <= 0 {
+		return fmt.Errorf("OUTBOX_POLL_INTERVAL, OUTBOX_BATCH_SIZE and OUTBOX_MAX_ATTEMPTS must be positive")
+	}
+	if c.Notify.Enabled {
+		if c.Notify.WebhookURL == "" {
+			return fmt.Errorf("EXPIRY_NOTIFY_WEBHOOK_URL is required when EXPIRY_NOTIFY_ENABLED is true")
+		}
+		if c.Notify.Window <= 0 || c.Notify.ScanInterval <= 0 || c.Notify.BatchSize <= 0 {
+			return fmt.Errorf("EXPIRY_NOTIFY_WINDOW, EXPIRY_NOTIFY_SCAN_INTERVAL and EXPIRY_NOTIFY_BATCH_SIZE must be positive")
+		}
+		if !strings.Contains(c.Notify.ResumeURL, "{conversation_id}") {
+			return fmt.Errorf("EXPIRY_NOTIFY_RESUME_URL must contain {conversation_id}")
+		}
+	}
+	if c.Attachments.Enabled || c.TTS.Enabled {
+		if c.Blob.Endpoint == "" || c.Blob.Bucket == "" || c.Blob.AccessKeyID == "" || c.Blob.SecretAccessKey == "" {
+			return fmt.Errorf("BLOB_ENDPOINT, BLOB_BUCKET, BLOB_ACCESS_KEY_ID and BLOB_SECRET_ACCESS_KEY are required when ATTACHMENTS_ENABLED or TTS_ENABLED is true")
+		}
+	}
+	if c.Attachments.Enabled {
+		if c.Attachments.MaxBytes <= 0 || c.Attachments.MaxBytes > MaxAttachmentBytes {
+			return fmt.Errorf("ATTACHMENTS_MAX_BYTES must be between 1 and %d", MaxAttachmentBytes)
+		}
+		if c.Attachments.MaxPerMessage <= 0 {
+			return fmt.Errorf("ATTACHMENTS_MAX_PER_MESSAGE must be positive")
+		}
+	}
+	if c.TTS.Enabled {
+		if c.TTS.Provider != "openai" && c.TTS.Provider != "elevenlabs" {
+			return fmt.Errorf("TTS_PROVIDER must be openai or elevenlabs")
+		}
+		if c.TTS.APIKey == "" {
+			return fmt.Errorf("TTS_API_KEY is required when TTS_ENABLED is true")
+		}
+		if c.TTS.MaxChars <= 0 {
+			return fmt.Errorf("TTS_MAX_CHARS must be positive")
+		}
+	}
+	if c.HTTPRetry.MaxAttempts <= 0 || c.HTTPRetry.BaseDelay < 0 || c.HTTPRetry.MaxDelay < c.HTTPRetry.BaseDelay {
+		return fmt.Errorf("HTTP_RETRY_MAX_ATTEMPTS must be positive and HTTP_RETRY_MAX_DELAY not below HTTP_RETRY_BASE_DELAY")
+	}
+	if c.HTTPTransport.MaxIdleConns < 0 || c.HTTPTransport.MaxIdleConnsPerHost <= 0 || c.HTTPTransport.IdleConnTimeout < 0 ||
+		c.HTTPTransport.DialTimeout < 0 || c.HTTPTransport.TLSHandshakeTimeout < 0 {
+		return fmt.Errorf("HTTP_MAX_IDLE_CONNS_PER_HOST must be positive and HTTP transport limits must not be negative")
+	}
+	if c.HTTPTransport.ProxyURL != "" {
+		if u, err := url.Parse(c.HTTPTransport.ProxyURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("HTTP_PROXY_URL must be an absolute URL")
+		}
+	}
+	if c.Verifier.SkillsStaleAfter <= 0 {
+		return fmt.Errorf("PLUGIN_SKILLS_STALE_AFTER must be positive")
+	}
+	if c.Warm.Enabled && (c.Warm.TopN < 0 || c.Warm.Budget <= 0) {
+		return fmt.Errorf("WARM_CACHES_TOP_N must not be negative and WARM_CACHES_BUDGET must be positive")
+	}
+	if c.Flags.CacheTTL <= 0 {
+		return fmt.Errorf("FLAGS_CACHE_TTL must be positive")
+	}
+	if c.Share.Enabled && (c.Share.DefaultTTL <= 0 || c.Share.MaxTTL < c.Share.DefaultTTL || c.Share.RequestsPerMinute <= 0) {
+		return fmt.Errorf("SHARE_DEFAULT_TTL and SHARE_REQUESTS_PER_MINUTE must be positive and SHARE_MAX_TTL not below SHARE_DEFAULT_TTL")
+	}
 	// Add additional validation as needed (e.g., URL format, port ranges)
 	return nil
 }
+
+// checkOutboundURLs validates the configured service URLs of enabled features against the
+// outbound URL policy.
+func (c *Config) checkOutboundURLs() error {
+	type namedURL struct{ name, url string }
+	urls := []namedURL{{"VERIFIER_URL", c.Verifier.URL}}
+	if c.NameService.Enabled {
+		urls = append(urls,
+			namedURL{"NAME_SERVICE_ETH_RPC_URL", c.NameService.EthereumRPCURL},
+			namedURL{"NAME_SERVICE_SOL_RPC_URL", c.NameService.SolanaRPCURL})
+	}
+	if c.Explorer.Enabled {
+		urls = append(urls,
+			namedURL{"EXPLORER_ETHERSCAN_URL", c.Explorer.EtherscanURL},
+			namedURL{"EXPLORER_BITCOIN_URL", c.Explorer.BitcoinURL})
+	}
+	if c.SwapQuote.Enabled {
+		urls = append(urls, namedURL{"SWAP_QUOTE_THORNODE_URL", c.SwapQuote.URL})
+	}
+	if c.Fees.Enabled {
+		for chain, u := range c.Fees.EVMRPCURLs {
+			urls = append(urls, namedURL{"FEE_ESTIMATE_EVM_RPC_URLS " + chain, u})
+		}
+		for chain, u := range c.Fees.UTXOURLs {
+			urls = append(urls, namedURL{"FEE_ESTIMATE_UTXO_URLS " + chain, u})
+		}
+	}
+	if c.Notify.Enabled {
+		urls = append(urls, namedURL{"EXPIRY_NOTIFY_WEBHOOK_URL", c.Notify.WebhookURL})
+	}
+	if c.Attachments.Enabled || c.TTS.Enabled {
+		urls = append(urls, namedURL{"BLOB_ENDPOINT", c.Blob.Endpoint})
+	}
+
+	for _, u := range urls {
+		if u.url == "" {
+			continue
+		}
+		if err := netguard.CheckConfiguredURL(u.url, c.Outbound.InternalHosts); err != nil {
+			return fmt.Errorf("%s: %w (list the host in OUTBOUND_INTERNAL_HOSTS to allow it)", u.name, err)
+		}
+	}
+	return nil
+}
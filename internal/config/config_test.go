@@ -0,0 +1,118 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setRequiredEnv sets the variables Load requires, so a test only sets what it checks.
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("DATABASE_DSN", "postgres://localhost/agent")
+	t.Setenv("REDIS_URI", "redis://localhost:6379")
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	t.Setenv("VERIFIER_URL", "https://verifier.example.com")
+}
+
+func TestModelPricesDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    ModelPrices
+		wantErr bool
+	}{
+		{
+			name:  "several models",
+			value: "claude-sonnet=3/15, claude-haiku = 1 / 5,",
+			want:  ModelPrices{"claude-sonnet": {Input: 3, Output: 15}, "claude-haiku": {Input: 1, Output: 5}},
+		},
+		{name: "fractional prices", value: "m=0.25/1.25", want: ModelPrices{"m": {Input: 0.25, Output: 1.25}}},
+		{name: "empty", value: "", want: ModelPrices{}},
+		{name: "missing output", value: "m=3", wantErr: true},
+		{name: "missing model", value: "=3/15", wantErr: true},
+		{name: "negative price", value: "m=-1/15", wantErr: true},
+		{name: "not a number", value: "m=3/free", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ModelPrices
+			err := got.Decode(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSystemPromptAppendix(t *testing.T) {
+	t.Run("empty by default", func(t *testing.T) {
+		setRequiredEnv(t)
+		cfg, err := Load()
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if cfg.Agent.SystemPromptAppendix != "" {
+			t.Errorf("SystemPromptAppendix = %q, want empty", cfg.Agent.SystemPromptAppendix)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		size    int
+		wantErr bool
+	}{
+		{name: "at the limit", size: MaxSystemPromptAppendix},
+		{name: "over the limit", size: MaxSystemPromptAppendix + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv("AGENT_SYSTEM_PROMPT_APPENDIX", strings.Repeat("a", tt.size))
+			_, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "AGENT_SYSTEM_PROMPT_APPENDIX") {
+				t.Errorf("Load() error = %v, want it to name AGENT_SYSTEM_PROMPT_APPENDIX", err)
+			}
+		})
+	}
+}
+
+func TestSummaryPrompt(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "default"},
+		{name: "custom", value: "Summarize as short bullets without amounts."},
+		{name: "at the limit", value: strings.Repeat("a", MaxSummaryPrompt)},
+		{name: "blank", value: " \n\t", wantErr: true},
+		{name: "over the limit", value: strings.Repeat("a", MaxSummaryPrompt+1), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv("CONTEXT_SUMMARY_PROMPT", tt.value)
+			cfg, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "CONTEXT_SUMMARY_PROMPT") {
+					t.Errorf("Load() error = %v, want it to name CONTEXT_SUMMARY_PROMPT", err)
+				}
+				return
+			}
+			if cfg.Context.SummaryPrompt != tt.value {
+				t.Errorf("SummaryPrompt = %q, want %q", cfg.Context.SummaryPrompt, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Package httpclient builds the HTTP clients used for outbound calls, on a shared tuned
+// transport with a common retry policy for transient failures.
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+// maxDrainBytes bounds how much of a discarded response body is read so the connection can
+// be reused.
+const maxDrainBytes = 64 << 10
+
+type idempotentKey struct{}
+
+// Idempotent returns a copy of req marked safe to retry even though its method, typically
+// POST, is not idempotent by definition. Only mark requests without side effects, or whose
+// side effects the server deduplicates.
+func Idempotent(req *http.Request) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), idempotentKey{}, true))
+}
+
+// Transport is an http.RoundTripper that retries idempotent requests on network errors and
+// on 429, 502, 503, 504 and 529 responses, with jittered exponential backoff. A Retry-After
+// header is honored when it fits within the maximum delay; a longer one ends the retries.
+type Transport struct {
+	base        http.RoundTripper
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+}
+
+// NewTransport wraps base with the retry policy from cfg.
+func NewTransport(base http.RoundTripper, cfg config.HTTPRetryConfig) *Transport {
+	return &Transport{
+		base:        base,
+		maxAttempts: max(cfg.MaxAttempts, 1),
+		baseDelay:   cfg.BaseDelay,
+		maxDelay:    cfg.MaxDelay,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !retryable(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.maxAttempts || req.Context().Err() != nil || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		delay := t.backoff(attempt)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+				if after > t.maxDelay {
+					return resp, nil
+				}
+				delay = after
+			}
+			_, _ = io.CopyN(io.Discard, resp.Body, maxDrainBytes)
+			resp.Body.Close()
+		}
+
+		// Each attempt needs a fresh body
+		if req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+
+		metrics.HTTPRetries.WithLabelValues(req.URL.Host).Inc()
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// retryable reports whether a request may be sent more than once: idempotent methods, or
+// requests marked with Idempotent. A body must be replayable.
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	marked, _ := req.Context().Value(idempotentKey{}).(bool)
+	return marked
+}
+
+// shouldRetry reports whether an attempt failed transiently.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout, 529: // 529: Anthropic overloaded
+		return true
+	}
+	return false
+}
+
+// backoff returns a jittered exponential delay before the attempt after the given one.
+func (t *Transport) backoff(attempt int) time.Duration {
+	delay := t.baseDelay
+	for i := 1; i < attempt && delay < t.maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, t.maxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	// Equal jitter keeps at least half the delay while spreading out clients that failed together
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,157 @@
+package httpclient
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/config"
+)
+
+// roundTripFunc adapts a function to http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// reply is one scripted attempt outcome: a status with optional Retry-After, or an error.
+type reply struct {
+	status     int
+	retryAfter string
+	err        error
+}
+
+func TestTransportRoundTrip(t *testing.T) {
+	errReset := errors.New("connection reset by peer")
+	tests := []struct {
+		name         string
+		method       string
+		idempotent   bool
+		replies      []reply
+		wantAttempts int
+		wantStatus   int
+		wantErr      bool
+	}{
+		{name: "success", method: http.MethodGet, replies: []reply{{status: 200}}, wantAttempts: 1, wantStatus: 200},
+		{name: "retried after 503", method: http.MethodGet, replies: []reply{{status: 503}, {status: 200}}, wantAttempts: 2, wantStatus: 200},
+		{name: "retried after network error", method: http.MethodGet, replies: []reply{{err: errReset}, {status: 200}}, wantAttempts: 2, wantStatus: 200},
+		{name: "network errors exhaust attempts", method: http.MethodGet, replies: []reply{{err: errReset}, {err: errReset}, {err: errReset}}, wantAttempts: 3, wantErr: true},
+		{name: "gives up after max attempts", method: http.MethodGet, replies: []reply{{status: 529}, {status: 529}, {status: 529}, {status: 200}}, wantAttempts: 3, wantStatus: 529},
+		{name: "client errors not retried", method: http.MethodGet, replies: []reply{{status: 400}, {status: 200}}, wantAttempts: 1, wantStatus: 400},
+		{name: "post not retried", method: http.MethodPost, replies: []reply{{status: 503}, {status: 200}}, wantAttempts: 1, wantStatus: 503},
+		{name: "idempotent post retried", method: http.MethodPost, idempotent: true, replies: []reply{{status: 503}, {status: 200}}, wantAttempts: 2, wantStatus: 200},
+		{name: "short retry-after honored", method: http.MethodGet, replies: []reply{{status: 429, retryAfter: "0"}, {status: 200}}, wantAttempts: 2, wantStatus: 200},
+		{name: "long retry-after ends retries", method: http.MethodGet, replies: []reply{{status: 429, retryAfter: "60"}, {status: 200}}, wantAttempts: 1, wantStatus: 429},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const body = `{"q":"hi"}`
+			attempts := 0
+			base := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if req.Body != nil {
+					got, _ := io.ReadAll(req.Body)
+					if string(got) != body {
+						t.Errorf("attempt %d sent body %q, want %q", attempts+1, got, body)
+					}
+				}
+				r := tt.replies[attempts]
+				attempts++
+				if r.err != nil {
+					return nil, r.err
+				}
+				resp := &http.Response{StatusCode: r.status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}"))}
+				if r.retryAfter != "" {
+					resp.Header.Set("Retry-After", r.retryAfter)
+				}
+				return resp, nil
+			})
+			transport := NewTransport(base, config.HTTPRetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond})
+
+			req, err := http.NewRequest(tt.method, "http://verifier.test/plugins", bytes.NewReader([]byte(body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.idempotent {
+				req = Idempotent(req)
+			}
+			resp, err := transport.RoundTrip(req)
+			if attempts != tt.wantAttempts {
+				t.Errorf("made %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if resp != nil {
+				resp.Body.Close()
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	newRequest := func(method string, body io.Reader) *http.Request {
+		req, err := http.NewRequest(method, "http://verifier.test", body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	unreplayable := newRequest(http.MethodPut, nil)
+	unreplayable.Body = io.NopCloser(strings.NewReader("{}"))
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want bool
+	}{
+		{name: "get", req: newRequest(http.MethodGet, nil), want: true},
+		{name: "delete", req: newRequest(http.MethodDelete, nil), want: true},
+		{name: "put with replayable body", req: newRequest(http.MethodPut, strings.NewReader("{}")), want: true},
+		{name: "put with one-shot body", req: unreplayable, want: false},
+		{name: "post", req: newRequest(http.MethodPost, strings.NewReader("{}")), want: false},
+		{name: "post marked idempotent", req: Idempotent(newRequest(http.MethodPost, strings.NewReader("{}"))), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.req); got != tt.want {
+				t.Errorf("retryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "missing", value: ""},
+		{name: "seconds", value: "2", want: 2 * time.Second, wantOK: true},
+		{name: "zero", value: "0", want: 0, wantOK: true},
+		{name: "negative", value: "-1"},
+		{name: "garbage", value: "soon"},
+		{name: "date in the past", value: "Mon, 02 Jan 2006 15:04:05 GMT", want: 0, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := retryAfter(tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// A future date is returned as the time left until it
+	at := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got, ok := retryAfter(at); !ok || got < 59*time.Minute || got > time.Hour {
+		t.Errorf("retryAfter(%q) = %v, %v; want about an hour", at, got, ok)
+	}
+}
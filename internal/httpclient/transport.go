@@ -0,0 +1,109 @@
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+// Factory builds HTTP clients that share one tuned connection pool, so services calling
+// the same hosts reuse connections instead of each dialing their own.
+type Factory struct {
+	transport http.RoundTripper
+	retry     config.HTTPRetryConfig
+}
+
+// NewFactory builds the shared transport from cfg. Requests go through HTTP_PROXY_URL when
+// set, otherwise through the proxy named by the HTTPS_PROXY/HTTP_PROXY environment variables.
+// With logging enabled, every outbound request is logged at debug level.
+func NewFactory(cfg config.HTTPTransportConfig, retry config.HTTPRetryConfig, logger *logrus.Logger) (*Factory, error) {
+	proxy := http.ProxyFromEnvironment
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy url: %w", err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	base := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	var requestLogger *logrus.Logger
+	if cfg.LogRequests {
+		requestLogger = logger
+	}
+	return &Factory{
+		transport: &instrumentedTransport{base: base, logger: requestLogger},
+		retry:     retry,
+	}, nil
+}
+
+// New returns an http.Client on the shared transport with the given overall timeout, which
+// also bounds retries.
+func (f *Factory) New(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: NewTransport(f.transport, f.retry),
+	}
+}
+
+// instrumentedTransport records in-flight requests and connection reuse per host, and
+// optionally logs each request. It sits below the retry transport, so every attempt counts.
+type instrumentedTransport struct {
+	base   http.RoundTripper
+	logger *logrus.Logger
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	inFlight := metrics.HTTPInFlight.WithLabelValues(host)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			metrics.HTTPConnections.WithLabelValues(host, strconv.FormatBool(info.Reused)).Inc()
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if t.logger != nil {
+		fields := logrus.Fields{
+			"method":      req.Method,
+			"host":        host,
+			"path":        req.URL.Path,
+			"duration_ms": time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			t.logger.WithFields(fields).WithError(err).Debug("outbound request failed")
+		} else {
+			fields["status"] = resp.StatusCode
+			t.logger.WithFields(fields).Debug("outbound request")
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,121 @@
+package httpclient
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/config"
+)
+
+func testFactory(t *testing.T, cfg config.HTTPTransportConfig, retry config.HTTPRetryConfig) *Factory {
+	t.Helper()
+	f, err := NewFactory(cfg, retry, nil)
+	if err != nil {
+		t.Fatalf("NewFactory() error = %v", err)
+	}
+	return f
+}
+
+func TestFactoryTimeouts(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	f := testFactory(t, config.HTTPTransportConfig{}, config.HTTPRetryConfig{MaxAttempts: 10, BaseDelay: 50 * time.Millisecond, MaxDelay: 50 * time.Millisecond})
+	tests := []struct {
+		name        string
+		url         string
+		timeout     time.Duration
+		wantTimeout bool
+	}{
+		{name: "within the timeout", url: slow.URL, timeout: 2 * time.Second},
+		{name: "past the timeout", url: slow.URL, timeout: 50 * time.Millisecond, wantTimeout: true},
+		{name: "timeout bounds retries", url: unavailable.URL, timeout: 120 * time.Millisecond, wantTimeout: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Clients share the transport but each keeps its own timeout
+			client := f.New(tt.timeout)
+			start := time.Now()
+			resp, err := client.Get(tt.url)
+			elapsed := time.Since(start)
+			if resp != nil {
+				resp.Body.Close()
+			}
+
+			var netErr net.Error
+			if got := errors.As(err, &netErr) && netErr.Timeout(); got != tt.wantTimeout {
+				t.Fatalf("Get() error = %v, want timeout %v", err, tt.wantTimeout)
+			}
+			if tt.wantTimeout && elapsed > tt.timeout+200*time.Millisecond {
+				t.Errorf("Get() returned after %v, want about %v", elapsed, tt.timeout)
+			}
+		})
+	}
+}
+
+// proxyServer stands in for a forward proxy, answering every request with the host it was for.
+func proxyServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "proxied "+r.URL.Host)
+	}))
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// getVia fetches a non-loopback URL, which the proxy settings apply to, and returns the body.
+func getVia(t *testing.T, f *Factory) string {
+	t.Helper()
+	resp, err := f.New(5 * time.Second).Get("http://quotes.vultisig.invalid/health")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestFactoryProxyURL(t *testing.T) {
+	proxy := proxyServer(t)
+	f := testFactory(t, config.HTTPTransportConfig{ProxyURL: proxy.URL}, config.HTTPRetryConfig{})
+	if got, want := getVia(t, f), "proxied quotes.vultisig.invalid"; got != want {
+		t.Errorf("response = %q, want %q", got, want)
+	}
+}
+
+// proxyEnvChild marks the process re-executed by TestFactoryProxyFromEnvironment.
+const proxyEnvChild = "HTTPCLIENT_TEST_PROXY_CHILD"
+
+func TestFactoryProxyFromEnvironment(t *testing.T) {
+	// The proxy environment is read once per process, so the check runs in a fresh one
+	if os.Getenv(proxyEnvChild) == "" {
+		proxy := proxyServer(t)
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFactoryProxyFromEnvironment$")
+		cmd.Env = append(os.Environ(), proxyEnvChild+"=1", "HTTP_PROXY="+proxy.URL, "NO_PROXY=")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("child process failed: %v\n%s", err, out)
+		}
+		return
+	}
+
+	f := testFactory(t, config.HTTPTransportConfig{}, config.HTTPRetryConfig{})
+	if got, want := getVia(t, f), "proxied quotes.vultisig.invalid"; got != want {
+		t.Errorf("response = %q, want %q", got, want)
+	}
+}
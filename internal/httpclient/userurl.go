@@ -0,0 +1,101 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/netguard"
+)
+
+// maxUserURLRedirects bounds the redirects followed when fetching a request-supplied URL.
+const maxUserURLRedirects = 3
+
+// ErrUserURLTooLarge is returned when a fetched body exceeds the configured size limit.
+var ErrUserURLTooLarge = errors.New("user url response too large")
+
+// UserURLClient fetches URLs supplied in requests (audio, attachments). It is kept apart
+// from the shared pool: only allowlisted hosts are fetched, every connection is dialed to a
+// checked public address, redirects are re-checked, and bodies are capped in size and time.
+type UserURLClient struct {
+	httpClient *http.Client
+	allowed    []string
+	maxBytes   int64
+}
+
+// NewUserURLClient builds the client from the outbound policy. It never uses a proxy, as the
+// proxy would dial on its behalf and bypass the address check.
+func NewUserURLClient(cfg config.OutboundConfig) *UserURLClient {
+	return newUserURLClient(cfg, &netguard.Dialer{
+		Resolver: net.DefaultResolver,
+		Dialer:   &net.Dialer{Timeout: 5 * time.Second},
+	})
+}
+
+// newUserURLClient builds the client connecting through dialer.
+func newUserURLClient(cfg config.OutboundConfig, dialer *netguard.Dialer) *UserURLClient {
+	c := &UserURLClient{
+		allowed:  cfg.UserURLHosts,
+		maxBytes: cfg.UserURLMaxBytes,
+	}
+	c.httpClient = &http.Client{
+		Timeout: cfg.UserURLTimeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: cfg.UserURLTimeout,
+			MaxIdleConnsPerHost:   2,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxUserURLRedirects {
+				return fmt.Errorf("%w: too many redirects", netguard.ErrURLNotAllowed)
+			}
+			return netguard.CheckUserURL(req.URL, c.allowed)
+		},
+	}
+	return c
+}
+
+// Fetch downloads raw after checking it against the allowlist, returning the body and its
+// content type. Non-2xx responses and bodies over the size limit are errors.
+func (c *UserURLClient) Fetch(ctx context.Context, raw string) ([]byte, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", netguard.ErrURLNotAllowed, err)
+	}
+	if err := netguard.CheckUserURL(u, c.allowed); err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("fetch user url: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("fetch user url: status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > c.maxBytes {
+		return nil, "", ErrUserURLTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxBytes+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("read user url: %w", err)
+	}
+	if int64(len(body)) > c.maxBytes {
+		return nil, "", ErrUserURLTooLarge
+	}
+	return body, resp.Header.Get("Content-Type"), nil
+}
@@ -0,0 +1,161 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/netguard"
+)
+
+// fakeResolver answers lookups from a fixed table.
+type fakeResolver map[string]string
+
+func (r fakeResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	addr, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return []netip.Addr{netip.MustParseAddr(addr)}, nil
+}
+
+// serverDialer connects every dial to a test server, recording the addresses asked for.
+type serverDialer struct {
+	server string
+	dialed []string
+}
+
+func (d *serverDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d.dialed = append(d.dialed, address)
+	return (&net.Dialer{}).DialContext(ctx, network, d.server)
+}
+
+func TestUserURLClientFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte("png-data"))
+	})
+	mux.HandleFunc("/large.png", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 64)))
+	})
+	mux.HandleFunc("/missing.png", http.NotFound)
+	mux.HandleFunc("/to-metadata", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://metadata.example.com/latest/meta-data/", http.StatusFound)
+	})
+	mux.HandleFunc("/to-internal-ip", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://10.0.0.5/admin", http.StatusFound)
+	})
+	mux.HandleFunc("/to-image", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/image.png", http.StatusFound)
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	// The test certificate is issued for example.com, which resolves to a public address
+	// here while every connection actually reaches the test server
+	resolver := fakeResolver{
+		"example.com":          "203.0.113.10",
+		"private.example.com":  "10.0.0.5",
+		"metadata.example.com": "169.254.169.254",
+		"cgnat.example.com":    "100.64.0.1",
+	}
+	cfg := config.OutboundConfig{
+		UserURLHosts:    []string{"example.com", "private.example.com", "metadata.example.com", "cgnat.example.com", "10.0.0.5"},
+		UserURLMaxBytes: 32,
+		UserURLTimeout:  5 * time.Second,
+	}
+	newClient := func() (*UserURLClient, *serverDialer) {
+		dialer := &serverDialer{server: srv.Listener.Addr().String()}
+		c := newUserURLClient(cfg, &netguard.Dialer{Resolver: resolver, Dialer: dialer})
+		c.httpClient.Transport.(*http.Transport).TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+		return c, dialer
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		want     string
+		wantType string
+		// wantErr is the error expected, nil for a successful fetch
+		wantErr error
+		// wantDialed are the addresses dialed
+		wantDialed []string
+	}{
+		{
+			name:       "allowlisted host",
+			url:        "https://example.com/image.png",
+			want:       "png-data",
+			wantType:   "image/png",
+			wantDialed: []string{"203.0.113.10:443"},
+		},
+		{
+			name:       "allowlisted redirect",
+			url:        "https://example.com/to-image",
+			want:       "png-data",
+			wantType:   "image/png",
+			wantDialed: []string{"203.0.113.10:443"},
+		},
+		{name: "host not allowlisted", url: "https://other.example.com/image.png", wantErr: netguard.ErrURLNotAllowed},
+		{name: "ip literal not allowlisted", url: "https://127.0.0.1/image.png", wantErr: netguard.ErrURLNotAllowed},
+		{name: "http", url: "http://example.com/image.png", wantErr: netguard.ErrURLNotAllowed},
+		{name: "other port", url: "https://example.com:8443/image.png", wantErr: netguard.ErrURLNotAllowed},
+		{name: "allowlisted host resolving to a private address", url: "https://private.example.com/image.png", wantErr: netguard.ErrURLNotAllowed},
+		{name: "allowlisted host resolving to shared address space", url: "https://cgnat.example.com/image.png", wantErr: netguard.ErrURLNotAllowed},
+		{name: "allowlisted private ip literal", url: "https://10.0.0.5/image.png", wantErr: netguard.ErrURLNotAllowed},
+		{
+			name:       "redirect to a host resolving to the metadata address",
+			url:        "https://example.com/to-metadata",
+			wantErr:    netguard.ErrURLNotAllowed,
+			wantDialed: []string{"203.0.113.10:443"},
+		},
+		{
+			name:       "redirect to an internal ip",
+			url:        "https://example.com/to-internal-ip",
+			wantErr:    netguard.ErrURLNotAllowed,
+			wantDialed: []string{"203.0.113.10:443"},
+		},
+		{
+			name:       "body over the limit",
+			url:        "https://example.com/large.png",
+			wantErr:    ErrUserURLTooLarge,
+			wantDialed: []string{"203.0.113.10:443"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, dialer := newClient()
+
+			body, contentType, err := c.Fetch(context.Background(), tt.url)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Fetch() error = %v, want %v", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Fetch() error = %v", err)
+				}
+				if string(body) != tt.want || contentType != tt.wantType {
+					t.Errorf("Fetch() = %q, %q; want %q, %q", body, contentType, tt.want, tt.wantType)
+				}
+			}
+			if strings.Join(dialer.dialed, ",") != strings.Join(tt.wantDialed, ",") {
+				t.Errorf("dialed %v, want %v", dialer.dialed, tt.wantDialed)
+			}
+		})
+	}
+
+	t.Run("failed status", func(t *testing.T) {
+		c, _ := newClient()
+		if _, _, err := c.Fetch(context.Background(), "https://example.com/missing.png"); err == nil || errors.Is(err, netguard.ErrURLNotAllowed) {
+			t.Errorf("Fetch() error = %v, want a status error", err)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// UnclearIntents counts agent responses classified as "unclear", a signal of UX friction.
+var UnclearIntents = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "unclear_intents_total",
+	Help:      "Number of messages for which the agent detected an unclear intent.",
+}, []string{"has_context", "has_balances"})
+
+// IncUnclearIntent records an unclear intent, labeled by what the client supplied with the message.
+func IncUnclearIntent(hasContext, hasBalances bool) {
+	UnclearIntents.WithLabelValues(strconv.FormatBool(hasContext), strconv.FormatBool(hasBalances)).Inc()
+}
+
+// AnthropicQueueDepth is the number of Anthropic requests waiting for a concurrency slot.
+var AnthropicQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "agent",
+	Name:      "anthropic_queue_depth",
+	Help:      "Number of Anthropic requests waiting for a free concurrency slot.",
+})
+
+// IntentConfidence tracks the confidence the model reports in its intent, by intent, to
+// follow its calibration over time.
+var IntentConfidence = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "agent",
+	Name:      "intent_confidence",
+	Help:      "Confidence the model reported in the detected intent.",
+	Buckets:   []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8, 0.9, 1},
+}, []string{"intent"})
+
+// ToolCalls counts server-side tool calls by tool and outcome.
+var ToolCalls = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "tool_calls_total",
+	Help:      "Number of server-side tool calls.",
+}, []string{"tool", "success"})
+
+// ToolLatency tracks server-side tool call latency by tool.
+var ToolLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "agent",
+	Name:      "tool_call_duration_seconds",
+	Help:      "Latency of server-side tool calls.",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"tool"})
+
+// ObserveToolCall records a server-side tool call.
+func ObserveToolCall(tool string, success bool, latency time.Duration) {
+	ToolCalls.WithLabelValues(tool, strconv.FormatBool(success)).Inc()
+	ToolLatency.WithLabelValues(tool).Observe(latency.Seconds())
+}
+
+// HTTPRetries counts outbound HTTP requests retried after a transient failure, by host.
+var HTTPRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "http_retries_total",
+	Help:      "Number of outbound HTTP requests retried after a transient failure.",
+}, []string{"host"})
+
+// HTTPInFlight is the number of outbound HTTP requests awaiting a response, by host.
+var HTTPInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "agent",
+	Name:      "http_in_flight_requests",
+	Help:      "Number of outbound HTTP requests awaiting a response.",
+}, []string{"host"})
+
+// HTTPConnections counts connections obtained for outbound HTTP requests, by host and
+// whether an idle connection was reused; the reused share is the connection reuse rate.
+var HTTPConnections = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "http_connections_total",
+	Help:      "Number of connections obtained for outbound HTTP requests.",
+}, []string{"host", "reused"})
+
+// PluginSkillsAge is the age, in seconds, of the plugin skills last served; it keeps growing
+// while the verifier can't be reached and stale skills are served.
+var PluginSkillsAge = promauto.NewGauge(prometheus.GaugeOpts{
+	Namespace: "agent",
+	Name:      "plugin_skills_age_seconds",
+	Help:      "Age of the plugin skills last served to the agent.",
+})
+
+// InjectionAttempts counts user messages flagged as likely prompt-injection attempts, by
+// the pattern category that matched.
+var InjectionAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "injection_attempts_total",
+	Help:      "Number of user messages flagged as likely prompt-injection attempts.",
+}, []string{"category"})
+
+// ResponseOutcomes counts model responses by ability, model and outcome (tool_ok,
+// text_fallback, empty, truncated or refusal).
+var ResponseOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "response_outcomes_total",
+	Help:      "Number of model responses by how they ended.",
+}, []string{"ability", "model", "outcome"})
+
+// Messages counts processed messages by ability (intent, policy or confirm) and outcome
+// (ok, client_error, ai_error, verifier_error, db_error or internal_error).
+var Messages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "messages_total",
+	Help:      "Number of processed messages, by ability and outcome.",
+}, []string{"ability", "outcome"})
+
+// MessageDuration tracks how long processing a message takes by ability and outcome. The
+// buckets span fast intent replies to multi-call policy builds.
+var MessageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "agent",
+	Name:      "message_duration_seconds",
+	Help:      "Time to process a message, by ability and outcome.",
+	Buckets:   []float64{0.5, 1, 2, 3, 5, 8, 12, 20, 30},
+}, []string{"ability", "outcome"})
+
+// TextFallbackRecoveries counts follow-up calls extracting intent and suggestions from
+// intent replies written as plain text, by outcome (recovered, no_suggestions or failed).
+var TextFallbackRecoveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "text_fallback_recoveries_total",
+	Help:      "Number of plain-text intent replies sent for intent and suggestion extraction, by outcome.",
+}, []string{"outcome"})
+
+// TitleGenerations counts conversation titles asked of the model, by outcome (generated or
+// failed). A failed generation keeps the truncated first message as the title.
+var TitleGenerations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "title_generations_total",
+	Help:      "Number of conversation titles generated by the model, by outcome.",
+}, []string{"outcome"})
+
+// TTSSyntheses counts voice reply syntheses by provider and outcome (synthesized or
+// failed). A failed synthesis leaves the reply as text only.
+var TTSSyntheses = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "tts_syntheses_total",
+	Help:      "Number of voice reply syntheses, by provider and outcome.",
+}, []string{"provider", "outcome"})
+
+// TTSCharacters counts characters sent for speech synthesis by provider, which is what
+// providers bill by.
+var TTSCharacters = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "tts_characters_total",
+	Help:      "Characters sent for speech synthesis, by provider.",
+}, []string{"provider"})
+
+// ToolParseFailures counts tool inputs that failed to parse strictly, by tool and outcome
+// (rescued by the lenient parse, or dropped).
+var ToolParseFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "tool_parse_failures_total",
+	Help:      "Number of tool inputs that failed to parse, by tool and outcome.",
+}, []string{"tool", "outcome"})
+
+// ModelCost accumulates the estimated USD cost of model calls by model and purpose
+// (reply or summary). Calls to models without a configured price aren't counted.
+var ModelCost = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "model_cost_usd_total",
+	Help:      "Estimated USD cost of model calls.",
+}, []string{"model", "purpose"})
+
+// ModelImages counts attached images sent to the model by model and purpose. Their tokens
+// are counted in ModelTokens as input.
+var ModelImages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "model_images_total",
+	Help:      "Number of attached images sent to the model.",
+}, []string{"model", "purpose"})
+
+// ModelTokens counts model tokens by model, purpose and direction (input or output).
+var ModelTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "agent",
+	Name:      "model_tokens_total",
+	Help:      "Number of model tokens used.",
+}, []string{"model", "purpose", "direction"})
@@ -0,0 +1,138 @@
+// Package netguard decides which outbound URLs and addresses the agent may reach, to keep
+// configured endpoints and user-supplied URLs from being pointed into the internal network.
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ErrURLNotAllowed is returned for URLs or addresses the agent must not reach.
+var ErrURLNotAllowed = errors.New("url not allowed")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), not covered by
+// netip.Addr.IsPrivate but just as unreachable from the internet.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// IsInternal reports whether addr is loopback, private, link-local (including cloud
+// metadata endpoints), unspecified, multicast or otherwise not a public unicast address.
+func IsInternal(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr) ||
+		(addr.Is4() && addr.As4()[0] == 0)
+}
+
+// CheckConfiguredURL validates a base URL taken from configuration: it must be https and
+// its host must not be an internal IP literal. Hosts listed in exempt (e.g. an in-cluster
+// verifier) may use http and internal addresses.
+func CheckConfiguredURL(raw string, exempt []string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%w: no host", ErrURLNotAllowed)
+	}
+	if hostListed(u.Hostname(), exempt) {
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return fmt.Errorf("%w: scheme %q", ErrURLNotAllowed, u.Scheme)
+		}
+		return nil
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q, https required", ErrURLNotAllowed, u.Scheme)
+	}
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && IsInternal(addr) {
+		return fmt.Errorf("%w: internal address %s", ErrURLNotAllowed, addr)
+	}
+	return nil
+}
+
+// CheckUserURL validates a URL supplied in a request before it is fetched: it must be https
+// on the default port, carry no credentials and its host must be in allowed. Where the host
+// resolves is checked when connecting, see Dialer.
+func CheckUserURL(u *url.URL, allowed []string) error {
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %q, https required", ErrURLNotAllowed, u.Scheme)
+	}
+	if u.User != nil {
+		return fmt.Errorf("%w: credentials in url", ErrURLNotAllowed)
+	}
+	if port := u.Port(); port != "" && port != "443" {
+		return fmt.Errorf("%w: port %s", ErrURLNotAllowed, port)
+	}
+	if !hostListed(u.Hostname(), allowed) {
+		return fmt.Errorf("%w: host %q is not allowlisted", ErrURLNotAllowed, u.Hostname())
+	}
+	return nil
+}
+
+// hostListed reports whether host matches an entry of hosts, ignoring case.
+func hostListed(host string, hosts []string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return slices.ContainsFunc(hosts, func(h string) bool {
+		return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(h)), ".") == host
+	})
+}
+
+// Resolver looks up the addresses of a host; *net.Resolver implements it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// ContextDialer dials a network address; *net.Dialer implements it.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Dialer connects only to public addresses. It resolves the host itself and dials the
+// resolved address, so the address checked is the one connected to: a hostname can't pass
+// the check and then re-resolve to an internal address (DNS rebinding). Every redirect
+// dials through it too, so redirects into the internal network fail.
+type Dialer struct {
+	Resolver Resolver
+	Dialer   ContextDialer
+}
+
+// DialContext implements the http.Transport dial hook.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		addrs, err = d.Resolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("resolve %s: no addresses", host)
+	}
+	// A host with any internal address is refused outright rather than filtered, so a
+	// mixed answer can't be used to reach the internal one on a later attempt
+	for _, addr := range addrs {
+		if IsInternal(addr) {
+			return nil, fmt.Errorf("%w: %s resolves to internal address %s", ErrURLNotAllowed, host, addr.Unmap())
+		}
+	}
+	return d.Dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].Unmap().String(), port))
+}
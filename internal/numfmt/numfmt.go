@@ -0,0 +1,196 @@
+// Package numfmt renders amounts for user-visible text with locale-aware separators and
+// currency symbols. Amounts sent to the model stay in canonical plain form ("1234.5").
+package numfmt
+
+import (
+	"math/big"
+	"strings"
+)
+
+// Class groups assets that are displayed with the same precision.
+type Class int
+
+const (
+	Crypto Class = iota
+	Stablecoin
+	Fiat
+)
+
+// Precision is the maximum number of fractional digits shown per asset class. Fiat amounts
+// always show exactly Fiat digits; crypto amounts drop trailing zeros.
+type Precision struct {
+	Crypto     int
+	Stablecoin int
+	Fiat       int
+}
+
+// Locale describes how numbers and currency amounts are written.
+type Locale struct {
+	Tag     string
+	Decimal string
+	Group   string
+	// CurrencyFirst puts the currency symbol before the number; CurrencySpace separates them
+	CurrencyFirst bool
+	CurrencySpace bool
+}
+
+// DefaultLocale is used for unknown or missing locale tags.
+var DefaultLocale = Locale{Tag: "en-US", Decimal: ".", Group: ",", CurrencyFirst: true}
+
+// locales are the supported locales keyed by lowercased tag. A bare language ("de") maps to
+// the first region listed for it in languageDefaults.
+var locales = map[string]Locale{
+	"en-us": DefaultLocale,
+	"en-gb": {Tag: "en-GB", Decimal: ".", Group: ",", CurrencyFirst: true},
+	"de-de": {Tag: "de-DE", Decimal: ",", Group: ".", CurrencySpace: true},
+	"fr-fr": {Tag: "fr-FR", Decimal: ",", Group: " ", CurrencySpace: true},
+	"es-es": {Tag: "es-ES", Decimal: ",", Group: ".", CurrencySpace: true},
+	"it-it": {Tag: "it-IT", Decimal: ",", Group: ".", CurrencySpace: true},
+	"pt-br": {Tag: "pt-BR", Decimal: ",", Group: ".", CurrencyFirst: true, CurrencySpace: true},
+	"pt-pt": {Tag: "pt-PT", Decimal: ",", Group: " ", CurrencySpace: true},
+}
+
+var languageDefaults = map[string]string{
+	"en": "en-us",
+	"de": "de-de",
+	"fr": "fr-fr",
+	"es": "es-es",
+	"it": "it-it",
+	"pt": "pt-br",
+}
+
+// currencySymbols maps ISO 4217 codes to their symbols; other codes are written as the code.
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"BRL": "R$",
+	"JPY": "¥",
+	"CHF": "CHF",
+}
+
+// LookupLocale resolves a BCP 47 tag such as "de-DE" or "pt_BR", falling back to the
+// language's default region and then to DefaultLocale.
+func LookupLocale(tag string) Locale {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if l, ok := locales[tag]; ok {
+		return l
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	if l, ok := locales[languageDefaults[lang]]; ok {
+		return l
+	}
+	return DefaultLocale
+}
+
+// Formatter formats amounts for one locale.
+type Formatter struct {
+	locale    Locale
+	precision Precision
+}
+
+// New returns a Formatter for the locale tag with the given per-class precision.
+func New(tag string, precision Precision) Formatter {
+	return Formatter{locale: LookupLocale(tag), precision: precision}
+}
+
+// Locale returns the resolved locale.
+func (f Formatter) Locale() Locale {
+	return f.locale
+}
+
+// Number formats a canonical decimal string ("1234.5") with at most maxDecimals fractional
+// digits, rounding half away from zero and dropping trailing zeros. Input that isn't a
+// decimal number is returned unchanged.
+func (f Formatter) Number(amount string, maxDecimals int) string {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(amount))
+	if !ok {
+		return amount
+	}
+	return f.rat(r, maxDecimals, false)
+}
+
+// Asset formats an amount of a crypto asset with its symbol, e.g. "1.234,5 ETH" in de-DE.
+func (f Formatter) Asset(amount, symbol string, class Class) string {
+	n := f.Number(amount, f.decimals(class))
+	if symbol == "" {
+		return n
+	}
+	return n + " " + symbol
+}
+
+// Money formats a fiat amount in the given ISO 4217 currency, e.g. "$5.00" in en-US and
+// "5,00 $" in de-DE.
+func (f Formatter) Money(amount float64, currency string) string {
+	n := f.rat(new(big.Rat).SetFloat64(amount), f.precision.Fiat, true)
+	symbol, ok := currencySymbols[strings.ToUpper(currency)]
+	if !ok {
+		symbol = strings.ToUpper(currency)
+	}
+	sep := ""
+	if f.locale.CurrencySpace || !ok {
+		sep = " "
+	}
+	if f.locale.CurrencyFirst {
+		return symbol + sep + n
+	}
+	return n + sep + symbol
+}
+
+// Percent formats a percentage with exactly decimals fractional digits, e.g. "0,50%".
+func (f Formatter) Percent(value float64, decimals int) string {
+	return f.rat(new(big.Rat).SetFloat64(value), decimals, true) + "%"
+}
+
+func (f Formatter) decimals(class Class) int {
+	switch class {
+	case Stablecoin:
+		return f.precision.Stablecoin
+	case Fiat:
+		return f.precision.Fiat
+	default:
+		return f.precision.Crypto
+	}
+}
+
+// rat renders r with decimals fractional digits, trimming trailing zeros unless fixed.
+func (f Formatter) rat(r *big.Rat, decimals int, fixed bool) string {
+	if r == nil {
+		return ""
+	}
+	s := r.FloatString(max(decimals, 0))
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if !fixed {
+		frac = strings.TrimRight(frac, "0")
+	}
+	out := groupDigits(whole, f.locale.Group)
+	if frac != "" {
+		out += f.locale.Decimal + frac
+	}
+	if neg && strings.Trim(whole+frac, "0") != "" {
+		out = "-" + out
+	}
+	return out
+}
+
+// groupDigits inserts sep between groups of three digits, e.g. "1234567" to "1,234,567".
+func groupDigits(digits, sep string) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	var b strings.Builder
+	head := len(digits) % 3
+	if head > 0 {
+		b.WriteString(digits[:head])
+	}
+	for i := head; i < len(digits); i += 3 {
+		if b.Len() > 0 {
+			b.WriteString(sep)
+		}
+		b.WriteString(digits[i : i+3])
+	}
+	return b.String()
+}
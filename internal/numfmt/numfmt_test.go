@@ -0,0 +1,114 @@
+package numfmt
+
+import "testing"
+
+var testPrecision = Precision{Crypto: 8, Stablecoin: 2, Fiat: 2}
+
+func TestFormatter(t *testing.T) {
+	tests := []struct {
+		name   string
+		format func(Formatter) string
+		// want is keyed by locale tag
+		want map[string]string
+	}{
+		{
+			name:   "crypto with grouping",
+			format: func(f Formatter) string { return f.Asset("1234567.891", "ETH", Crypto) },
+			want:   map[string]string{"en-US": "1,234,567.891 ETH", "de-DE": "1.234.567,891 ETH", "pt-BR": "1.234.567,891 ETH"},
+		},
+		{
+			name:   "crypto rounded to its precision",
+			format: func(f Formatter) string { return f.Asset("0.123456789", "BTC", Crypto) },
+			want:   map[string]string{"en-US": "0.12345679 BTC", "de-DE": "0,12345679 BTC", "pt-BR": "0,12345679 BTC"},
+		},
+		{
+			name:   "crypto drops trailing zeros",
+			format: func(f Formatter) string { return f.Asset("2.500000", "SOL", Crypto) },
+			want:   map[string]string{"en-US": "2.5 SOL", "de-DE": "2,5 SOL", "pt-BR": "2,5 SOL"},
+		},
+		{
+			name:   "crypto dust rounds to zero",
+			format: func(f Formatter) string { return f.Asset("-0.0000000001", "ETH", Crypto) },
+			want:   map[string]string{"en-US": "0 ETH", "de-DE": "0 ETH", "pt-BR": "0 ETH"},
+		},
+		{
+			name:   "stablecoin whole amount",
+			format: func(f Formatter) string { return f.Asset("1500", "USDC", Stablecoin) },
+			want:   map[string]string{"en-US": "1,500 USDC", "de-DE": "1.500 USDC", "pt-BR": "1.500 USDC"},
+		},
+		{
+			name:   "stablecoin rounds half away from zero",
+			format: func(f Formatter) string { return f.Asset("10.005", "USDC", Stablecoin) },
+			want:   map[string]string{"en-US": "10.01 USDC", "de-DE": "10,01 USDC", "pt-BR": "10,01 USDC"},
+		},
+		{
+			name:   "not a number",
+			format: func(f Formatter) string { return f.Asset("lots", "ETH", Crypto) },
+			want:   map[string]string{"en-US": "lots ETH", "de-DE": "lots ETH", "pt-BR": "lots ETH"},
+		},
+		{
+			name:   "number without a symbol",
+			format: func(f Formatter) string { return f.Number("1234.5", 0) },
+			want:   map[string]string{"en-US": "1,235", "de-DE": "1.235", "pt-BR": "1.235"},
+		},
+		// Currency symbols are kept on the amount's line with a no-break space
+		{
+			name:   "dollars",
+			format: func(f Formatter) string { return f.Money(5, "USD") },
+			want:   map[string]string{"en-US": "$5.00", "de-DE": "5,00\u00a0$", "pt-BR": "$\u00a05,00"},
+		},
+		{
+			name:   "euros with grouping",
+			format: func(f Formatter) string { return f.Money(1234.5, "eur") },
+			want:   map[string]string{"en-US": "€1,234.50", "de-DE": "1.234,50\u00a0€", "pt-BR": "€\u00a01.234,50"},
+		},
+		{
+			name:   "reais",
+			format: func(f Formatter) string { return f.Money(1234.5, "BRL") },
+			want:   map[string]string{"en-US": "R$1,234.50", "de-DE": "1.234,50\u00a0R$", "pt-BR": "R$\u00a01.234,50"},
+		},
+		{
+			name:   "unknown currency written as its code",
+			format: func(f Formatter) string { return f.Money(12, "XYZ") },
+			want:   map[string]string{"en-US": "XYZ\u00a012.00", "de-DE": "12,00\u00a0XYZ", "pt-BR": "XYZ\u00a012,00"},
+		},
+		{
+			name:   "percent",
+			format: func(f Formatter) string { return f.Percent(0.5, 2) },
+			want:   map[string]string{"en-US": "0.50%", "de-DE": "0,50%", "pt-BR": "0,50%"},
+		},
+	}
+
+	for _, tt := range tests {
+		for tag, want := range tt.want {
+			t.Run(tt.name+"/"+tag, func(t *testing.T) {
+				if got := tt.format(New(tag, testPrecision)); got != want {
+					t.Errorf("got %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestLookupLocale(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{tag: "de-DE", want: "de-DE"},
+		{tag: " DE-de ", want: "de-DE"},
+		{tag: "pt_BR", want: "pt-BR"},
+		{tag: "pt", want: "pt-BR"},
+		{tag: "pt-PT", want: "pt-PT"},
+		{tag: "de-AT", want: "de-DE"},
+		{tag: "ja-JP", want: "en-US"},
+		{tag: "", want: "en-US"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := LookupLocale(tt.tag).Tag; got != tt.want {
+				t.Errorf("LookupLocale(%q) = %s, want %s", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+// Package requestid carries the inbound request id through contexts so it can be
+// forwarded to downstream services for log correlation.
+package requestid
+
+import (
+	"context"
+	"net/http"
+)
+
+// Header is the correlation header set on outgoing requests.
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// WithID returns a context carrying the request id. Empty ids are ignored.
+func WithID(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id carried by ctx, or "" if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// SetHeader copies the request id from the request's context onto its correlation header.
+func SetHeader(req *http.Request) {
+	if id := FromContext(req.Context()); id != "" {
+		req.Header.Set(Header, id)
+	}
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ErrNothingInFlight is returned by AbortMessage when no message is being processed for the
+// conversation.
+var ErrNothingInFlight = errors.New("no message in flight")
+
+// ErrGenerationAborted is returned by ProcessMessage when the user aborted the reply.
+var ErrGenerationAborted = errors.New("generation aborted")
+
+const (
+	// abortChannel is the pub/sub channel carrying aborts to the instance processing the
+	// message; payloads are conversation IDs.
+	abortChannel = "conv_abort"
+	// abortResubscribeDelay is the pause before resubscribing after the subscription failed.
+	abortResubscribeDelay = 2 * time.Second
+)
+
+// errAbortRequested is the cancellation cause set by AbortMessage, telling an abort apart
+// from the client going away.
+var errAbortRequested = errors.New("abort requested")
+
+// inflightRegistry tracks the cancel functions of messages being processed, per conversation.
+// It is per process; aborts for messages on other instances reach them through abortChannel.
+// The zero value is ready to use.
+type inflightRegistry struct {
+	mu    sync.Mutex
+	next  uint64
+	calls map[uuid.UUID]map[uint64]context.CancelCauseFunc
+}
+
+// start registers a cancelable context for a message in the conversation. done must be
+// called when processing ends; it clears the registration and releases the context.
+func (r *inflightRegistry) start(ctx context.Context, convID uuid.UUID) (_ context.Context, done func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+
+	r.mu.Lock()
+	if r.calls == nil {
+		r.calls = make(map[uuid.UUID]map[uint64]context.CancelCauseFunc)
+	}
+	r.next++
+	id := r.next
+	if r.calls[convID] == nil {
+		r.calls[convID] = make(map[uint64]context.CancelCauseFunc)
+	}
+	r.calls[convID][id] = cancel
+	r.mu.Unlock()
+
+	return ctx, func() {
+		r.mu.Lock()
+		delete(r.calls[convID], id)
+		if len(r.calls[convID]) == 0 {
+			delete(r.calls, convID)
+		}
+		r.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// abort cancels every message in flight for the conversation and reports whether there was any.
+func (r *inflightRegistry) abort(convID uuid.UUID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.calls[convID]
+	for _, cancel := range calls {
+		cancel(errAbortRequested)
+	}
+	return len(calls) > 0
+}
+
+// AbortMessage cancels the message being processed for a conversation owned by publicKey.
+// The interrupted request stores an aborted reply and fails with ErrGenerationAborted.
+// A message processed by another instance holds the conversation lock; the abort is
+// published for RunAborts there to apply. Returns ErrNothingInFlight if no message is
+// being processed.
+func (s *AgentService) AbortMessage(ctx context.Context, convID uuid.UUID, publicKey string) error {
+	if err := s.ensureConversation(ctx, convID, publicKey); err != nil {
+		return err
+	}
+	if s.inflight.abort(convID) {
+		return nil
+	}
+
+	busy, err := s.redis.Exists(ctx, conversationLockKey(convID))
+	if err != nil {
+		return fmt.Errorf("check conversation lock: %w", err)
+	}
+	if !busy {
+		return ErrNothingInFlight
+	}
+	if err := s.redis.Publish(ctx, abortChannel, convID.String()); err != nil {
+		return fmt.Errorf("publish abort: %w", err)
+	}
+	return nil
+}
+
+// RunAborts applies aborts published by other instances to the messages this instance is
+// processing, until ctx is done, resubscribing after failures.
+func (s *AgentService) RunAborts(ctx context.Context) {
+	for {
+		err := s.redis.Subscribe(ctx, abortChannel, s.applyAbort)
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.WithError(err).Warn("abort subscription failed, resubscribing")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(abortResubscribeDelay):
+		}
+	}
+}
+
+// applyAbort cancels the local messages of the conversation named by an abort payload.
+func (s *AgentService) applyAbort(payload string) {
+	convID, err := uuid.Parse(payload)
+	if err != nil {
+		s.logger.WithField("payload", payload).Warn("ignoring malformed abort")
+		return
+	}
+	s.inflight.abort(convID)
+}
+
+// aborted reports whether ctx was canceled by AbortMessage.
+func aborted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), errAbortRequested)
+}
+
+// storeAbortedReply stores the assistant message for an aborted turn, marked aborted:true.
+// Replies are generated in a single model call, so there is no partial text to keep and the
+// message is empty; empty messages are left out of model context.
+func (s *AgentService) storeAbortedReply(ctx context.Context, convID, userMsgID uuid.UUID) {
+	metadata, _ := json.Marshal(map[string]any{
+		"aborted":          true,
+		"retry_message_id": userMsgID,
+	})
+	msg := &types.Message{
+		ConversationID: convID,
+		Role:           types.RoleAssistant,
+		ContentType:    "text",
+		Metadata:       metadata,
+	}
+
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), detachedWriteTimeout)
+	defer cancel()
+	if err := s.msgRepo.Create(writeCtx, msg); err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to store aborted reply")
+	}
+}
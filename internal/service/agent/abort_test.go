@@ -0,0 +1,122 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// slowModel answers nothing until its request is canceled, like a long generation.
+type slowModel struct {
+	started chan struct{}
+}
+
+func (m *slowModel) SendMessage(ctx context.Context, _ *anthropic.Request) (*anthropic.Response, error) {
+	m.started <- struct{}{}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAbortMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		// remote aborts through a second instance sharing the cache, as behind a load balancer
+		remote bool
+	}{
+		{name: "same instance"},
+		{name: "other instance", remote: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &slowModel{started: make(chan struct{}, 1)}
+			svc, msgs := newConversationService(nil)
+			svc.anthropic = model
+			cache := svc.redis.(*fakeCache)
+			ctx, stop := context.WithCancel(context.Background())
+			defer stop()
+			go svc.RunAborts(ctx)
+			waitFor(t, "the abort subscription", func() bool { return cache.subscribed(abortChannel) > 0 })
+
+			aborter := svc
+			if tt.remote {
+				aborter, _ = newConversationService(nil)
+				aborter.redis = cache
+			}
+
+			convID := uuid.New()
+			errs := make(chan error, 1)
+			go func() {
+				_, err := svc.ProcessMessage(context.Background(), convID, testOwner, &SendMessageRequest{
+					PublicKey: testOwner,
+					Content:   "write me a long story about vaults",
+				})
+				errs <- err
+			}()
+			<-model.started
+
+			if err := aborter.AbortMessage(context.Background(), convID, testOwner); err != nil {
+				t.Fatalf("AbortMessage() error = %v", err)
+			}
+			select {
+			case err := <-errs:
+				if !errors.Is(err, ErrGenerationAborted) {
+					t.Fatalf("ProcessMessage() error = %v, want ErrGenerationAborted", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("ProcessMessage() still running after abort")
+			}
+
+			// The user message stays, answered by an empty reply marked aborted
+			stored := msgs.stored()
+			if len(stored) != 2 {
+				t.Fatalf("stored %d messages, want the user message and the aborted reply", len(stored))
+			}
+			userMsg, reply := stored[0], stored[1]
+			var meta struct {
+				Aborted        bool      `json:"aborted"`
+				RetryMessageID uuid.UUID `json:"retry_message_id"`
+			}
+			if err := json.Unmarshal(reply.Metadata, &meta); err != nil {
+				t.Fatalf("decode reply metadata: %v", err)
+			}
+			if reply.Role != types.RoleAssistant || reply.Content != "" || !meta.Aborted || meta.RetryMessageID != userMsg.ID {
+				t.Errorf("reply = %s %q %s, want an empty aborted reply retrying %s", reply.Role, reply.Content, reply.Metadata, userMsg.ID)
+			}
+
+			// The conversation is free for the next message, and there is nothing left to abort
+			if locked, _ := cache.Exists(context.Background(), conversationLockKey(convID)); locked {
+				t.Error("conversation lock still held after abort")
+			}
+			if err := aborter.AbortMessage(context.Background(), convID, testOwner); !errors.Is(err, ErrNothingInFlight) {
+				t.Errorf("second AbortMessage() error = %v, want ErrNothingInFlight", err)
+			}
+		})
+	}
+}
+
+func TestAbortMessageNothingInFlight(t *testing.T) {
+	svc, _ := newConversationService(nil)
+	convID := uuid.New()
+	if err := svc.AbortMessage(context.Background(), convID, testOwner); !errors.Is(err, ErrNothingInFlight) {
+		t.Errorf("AbortMessage() error = %v, want ErrNothingInFlight", err)
+	}
+}
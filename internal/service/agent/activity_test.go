@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildRecentActivity(t *testing.T) {
+	at := time.Date(2026, 10, 9, 15, 4, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	if got := BuildRecentActivity(nil); got != "" {
+		t.Errorf("BuildRecentActivity(nil) = %q, want empty", got)
+	}
+	if got := BuildRecentActivity([]Activity{{Summary: " \n "}}); got != "" {
+		t.Errorf("BuildRecentActivity() of blank summaries = %q, want empty", got)
+	}
+
+	got := BuildRecentActivity([]Activity{
+		{Type: "dca", Summary: "Bought 0.05 ETH\nwith 100 USDC", Timestamp: &at},
+		{Summary: "Sent 0.1 BTC to cold storage"},
+	})
+	for _, want := range []string{
+		"## Recent Activity",
+		"- 2026-10-09: [dca] Bought 0.05 ETH with 100 USDC\n",
+		"- Sent 0.1 BTC to cold storage\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("recent activity lacks %q:\n%s", want, got)
+		}
+	}
+
+	// Entries, summaries and types are all bounded
+	var many []Activity
+	for i := range maxActivityItems + 5 {
+		many = append(many, Activity{Type: strings.Repeat("t", 50), Summary: fmt.Sprintf("activity-%02d %s", i, strings.Repeat("x", 500))})
+	}
+	got = BuildRecentActivity(many)
+	if n := strings.Count(got, "\n- "); n != maxActivityItems {
+		t.Errorf("rendered %d entries, want %d", n, maxActivityItems)
+	}
+	if strings.Contains(got, fmt.Sprintf("activity-%02d", maxActivityItems)) {
+		t.Errorf("rendered an entry past the first %d", maxActivityItems)
+	}
+	for _, line := range strings.Split(got, "\n") {
+		if strings.HasPrefix(line, "- ") && len([]rune(line)) > len("- [] ")+maxActivityTypeLength+maxActivitySummaryLength {
+			t.Errorf("entry is %d characters, want it bounded: %q", len([]rune(line)), line)
+		}
+	}
+}
+
+func TestProcessMessageRecentActivity(t *testing.T) {
+	const activity = "Started a weekly DCA into ETH"
+
+	model := &fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "general_question",
+		"response": "You already buy ETH every week.",
+	})}
+	svc, msgs := newConversationService(model)
+
+	if _, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "should i dca into eth?",
+		Context:   &MessageContext{RecentActivity: []Activity{{Type: "dca", Summary: activity}}},
+	}); err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+
+	if len(model.requests) == 0 {
+		t.Fatal("model got no requests")
+	}
+	req := model.requests[0]
+	if !strings.Contains(req.System, "[dca] "+activity) {
+		t.Errorf("system prompt lacks the recent activity:\n%s", req.System)
+	}
+	// The activity is context for this turn only: it isn't in the conversation sent to the
+	// model nor in any stored message
+	for _, msg := range req.Messages {
+		if strings.Contains(fmt.Sprint(msg.Content), activity) {
+			t.Errorf("model conversation carries the activity: %+v", msg)
+		}
+	}
+	for _, msg := range msgs.stored() {
+		if strings.Contains(msg.Content, activity) || strings.Contains(string(msg.Metadata), activity) {
+			t.Errorf("stored %s message carries the activity: %q %s", msg.Role, msg.Content, msg.Metadata)
+		}
+	}
+}
@@ -1,9 +1,13 @@
 package agent
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
@@ -11,30 +15,268 @@ import (
 	"github.com/vultisig/agent-backend/internal/ai/anthropic"
 	"github.com/vultisig/agent-backend/internal/cache/redis"
 	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/numfmt"
+	"github.com/vultisig/agent-backend/internal/service/attachment"
+	"github.com/vultisig/agent-backend/internal/service/explorer"
+	"github.com/vultisig/agent-backend/internal/service/fees"
+	"github.com/vultisig/agent-backend/internal/service/flags"
+	"github.com/vultisig/agent-backend/internal/service/names"
+	"github.com/vultisig/agent-backend/internal/service/outbox"
+	"github.com/vultisig/agent-backend/internal/service/thorchain"
 	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/service/voice"
 	"github.com/vultisig/agent-backend/internal/storage/postgres"
 	"github.com/vultisig/agent-backend/internal/types"
 )
 
+// ModelClient sends requests to the language model.
+// *anthropic.Client is the production implementation.
+type ModelClient interface {
+	SendMessage(ctx context.Context, req *anthropic.Request) (*anthropic.Response, error)
+}
+
+var _ ModelClient = (*anthropic.Client)(nil)
+
 // PluginSkillsProvider provides plugin skills for prompt building.
 type PluginSkillsProvider interface {
 	GetSkills(ctx context.Context) []PluginSkill
+	// SkillsGeneration changes whenever the skills returned by GetSkills may have changed.
+	SkillsGeneration() uint64
+}
+
+// VerifierAPI is the subset of the verifier service used to build policies and list plugins.
+// *verifier.Client is the production implementation.
+type VerifierAPI interface {
+	InstalledPluginIDs(ctx context.Context, accessToken string) ([]string, error)
+	GetRecipeSchema(ctx context.Context, pluginID string) (*verifier.RecipeSchema, error)
+	GetPolicySuggest(ctx context.Context, pluginID string, configuration map[string]any) (*verifier.PolicySuggest, error)
 }
 
+var _ VerifierAPI = (*verifier.Client)(nil)
+
+// NameResolver resolves ENS and SNS names to addresses.
+// *names.Resolver is the production implementation.
+type NameResolver interface {
+	Resolve(ctx context.Context, name string) (*names.Resolution, error)
+}
+
+var _ NameResolver = (*names.Resolver)(nil)
+
+// TransactionExplorer looks up on-chain transaction status.
+// *explorer.Client is the production implementation.
+type TransactionExplorer interface {
+	Status(ctx context.Context, user, chain, hash string) (*explorer.TxStatus, error)
+	SupportedChains() []string
+}
+
+var _ TransactionExplorer = (*explorer.Client)(nil)
+
+// SwapQuoter quotes swaps and USD prices for assets in THORChain notation.
+// *thorchain.Client is the production implementation.
+type SwapQuoter interface {
+	Quote(ctx context.Context, fromAsset, toAsset, amount string) (*thorchain.Quote, error)
+	USDPrice(ctx context.Context, asset string) (float64, error)
+}
+
+var _ SwapQuoter = (*thorchain.Client)(nil)
+
+// FeeEstimator estimates network fees.
+// *fees.Client is the production implementation.
+type FeeEstimator interface {
+	Estimate(ctx context.Context, chain, action string) (*fees.Estimate, error)
+	SupportedChains() []string
+}
+
+var _ FeeEstimator = (*fees.Client)(nil)
+
+// AttachmentLoader loads the images attached to a message, in the order given, failing
+// with attachment.ErrNotFound when one doesn't exist or belongs to someone else.
+// *attachment.Service is the production implementation.
+type AttachmentLoader interface {
+	Load(ctx context.Context, publicKey string, ids []uuid.UUID) ([]attachment.Image, error)
+}
+
+var _ AttachmentLoader = (*attachment.Service)(nil)
+
+// VoiceSynthesizer speaks a reply and stores the audio for publicKey.
+// *voice.Service is the production implementation.
+type VoiceSynthesizer interface {
+	Synthesize(ctx context.Context, publicKey, text string) (*voice.Audio, error)
+}
+
+var _ VoiceSynthesizer = (*voice.Service)(nil)
+
+// FeatureFlags reports whether operational kill switches leave a feature on.
+// *flags.Store is the production implementation.
+type FeatureFlags interface {
+	Enabled(ctx context.Context, name string) bool
+}
+
+var _ FeatureFlags = (*flags.Store)(nil)
+
+// Cache is the key-value store holding suggestions, locks, counters and short-lived caches.
+// *redis.Client is the production implementation.
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	SetNX(ctx context.Context, key string, value string, ttl time.Duration) (bool, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	ExistsMany(ctx context.Context, keys []string) ([]bool, error)
+	SetMany(ctx context.Context, values map[string]string, ttl time.Duration) error
+	Incr(ctx context.Context, key string, ttl time.Duration) (int64, error)
+	HIncr(ctx context.Context, key, field string, ttl time.Duration) (int64, error)
+	HGetAll(ctx context.Context, key string) (map[string]string, error)
+	Delete(ctx context.Context, key string) error
+	DeleteIfEqual(ctx context.Context, key, value string) (bool, error)
+	Publish(ctx context.Context, channel, message string) error
+	Subscribe(ctx context.Context, channel string, handle func(payload string)) error
+}
+
+var _ Cache = (*redis.Client)(nil)
+
+// EffectDispatcher delivers the side-effect events committed together with a message.
+// *outbox.Dispatcher is the production implementation.
+type EffectDispatcher interface {
+	DispatchAfter() time.Time
+	Deliver(ctx context.Context, events []*types.OutboxEvent)
+}
+
+var _ EffectDispatcher = (*outbox.Dispatcher)(nil)
+
+// MessageStore persists conversation messages.
+// *postgres.MessageRepository is the production implementation.
+type MessageStore interface {
+	Create(ctx context.Context, msg *types.Message) error
+	CreateIfOwned(ctx context.Context, msg *types.Message, publicKey string) error
+	CreateWithOutbox(ctx context.Context, msg *types.Message, events []*types.OutboxEvent, dispatchAfter time.Time) error
+	GetByID(ctx context.Context, convID, messageID uuid.UUID) (*types.Message, error)
+	GetByConversationID(ctx context.Context, convID uuid.UUID) ([]types.Message, error)
+	GetRecent(ctx context.Context, convID uuid.UUID, limit int) ([]types.Message, error)
+	GetSince(ctx context.Context, convID uuid.UUID, since time.Time) ([]types.Message, error)
+	GetRecentSince(ctx context.Context, convID uuid.UUID, since time.Time, limit int) ([]types.Message, error)
+	CountByConversationID(ctx context.Context, convID uuid.UUID) (int, error)
+	CountSince(ctx context.Context, convID uuid.UUID, since time.Time) (int, error)
+	ListReplayCandidates(ctx context.Context, from, to time.Time, intent, pluginID string, limit int) ([]types.Message, error)
+}
+
+var _ MessageStore = (*postgres.MessageRepository)(nil)
+
+// ConversationStore persists conversations and their summaries.
+// *postgres.ConversationRepository is the production implementation.
+type ConversationStore interface {
+	GetByID(ctx context.Context, id uuid.UUID, publicKey string) (*types.Conversation, error)
+	GetForAdmin(ctx context.Context, id uuid.UUID) (*types.Conversation, error)
+	GetSummaryWithCursor(ctx context.Context, id uuid.UUID, publicKey string) (*string, *time.Time, error)
+	UpdateSummaryWithCursor(ctx context.Context, id uuid.UUID, publicKey string, summary string, summaryUpTo time.Time) error
+	UpdateTitle(ctx context.Context, id uuid.UUID, publicKey string, title string) error
+	UpdateTags(ctx context.Context, id uuid.UUID, publicKey string, tags []string) error
+	NoMemory(ctx context.Context, id uuid.UUID, publicKey string) (bool, error)
+	DeleteMessage(ctx context.Context, id, messageID uuid.UUID, publicKey string) error
+	BulkArchive(ctx context.Context, publicKey string, filter types.BulkFilter, limit int) ([]uuid.UUID, error)
+	BulkRestore(ctx context.Context, publicKey string, filter types.BulkFilter, limit int) ([]uuid.UUID, error)
+	BulkDeleteArchived(ctx context.Context, publicKey string, filter types.BulkFilter, limit int) ([]uuid.UUID, error)
+	ArchiveDuplicate(ctx context.Context, id uuid.UUID, messages int64) (bool, error)
+	ListPublicKeysAfter(ctx context.Context, after string, limit int) ([]string, error)
+	ListDuplicateCandidates(ctx context.Context, publicKeys []string, window time.Duration) ([]types.DuplicateCandidate, error)
+	Import(ctx context.Context, publicKey string, title, summary *string, summaryUpTo time.Time, msgs []types.Message) (*types.Conversation, error)
+	Stats(ctx context.Context, publicKey, automationAction string, confidenceSince time.Time) (*types.UserStats, error)
+}
+
+var _ ConversationStore = (*postgres.ConversationRepository)(nil)
+
+// MemoryStore persists the memory document kept for each user.
+// *postgres.MemoryRepository is the production implementation.
+type MemoryStore interface {
+	GetMemory(ctx context.Context, publicKey string) (*types.UserMemory, error)
+	UpsertMemory(ctx context.Context, publicKey, content string) error
+}
+
+var _ MemoryStore = (*postgres.MemoryRepository)(nil)
+
+// ToolFailureStore keeps the dead-lettered tool inputs that failed to parse.
+// *postgres.ToolParseFailureRepository is the production implementation.
+type ToolFailureStore interface {
+	Create(ctx context.Context, f *types.ToolParseFailure) error
+	ListRecent(ctx context.Context, limit int) ([]types.ToolParseFailure, error)
+	GetByID(ctx context.Context, id uuid.UUID) (*types.ToolParseFailure, error)
+}
+
+var _ ToolFailureStore = (*postgres.ToolParseFailureRepository)(nil)
+
+// DraftStore keeps built policies awaiting confirmation, one pending draft per conversation.
+// *postgres.PolicyDraftRepository is the production implementation.
+type DraftStore interface {
+	Create(ctx context.Context, draft *types.PolicyDraft) error
+	GetPending(ctx context.Context, convID uuid.UUID, publicKey string, createdAfter time.Time) (*types.PolicyDraft, error)
+	Resolve(ctx context.Context, convID uuid.UUID, draftID *uuid.UUID, status string) (bool, error)
+}
+
+var _ DraftStore = (*postgres.PolicyDraftRepository)(nil)
+
 // AgentService handles AI agent operations.
 type AgentService struct {
-	anthropic        *anthropic.Client
-	msgRepo          *postgres.MessageRepository
-	convRepo         *postgres.ConversationRepository
-	memRepo          *postgres.MemoryRepository
-	redis            *redis.Client
-	verifier         *verifier.Client
+	anthropic        ModelClient
+	msgRepo          MessageStore
+	convRepo         ConversationStore
+	memRepo          MemoryStore
+	contactRepo      *postgres.ContactRepository
+	draftRepo        DraftStore
+	failureRepo      ToolFailureStore
+	noticeRepo       *postgres.ExpiryNoticeRepository
+	redis            Cache
+	outbox           EffectDispatcher
+	verifier         VerifierAPI
 	pluginProvider   PluginSkillsProvider
+	docs             DocsRetriever
+	names            NameResolver
+	explorer         TransactionExplorer
+	quotes           SwapQuoter
+	fees             FeeEstimator
+	attachments      AttachmentLoader // nil while attachments are disabled
+	voice            VoiceSynthesizer // nil while voice replies are disabled
+	recall           *MessageRecall
+	flags            FeatureFlags
+	intentTools      *ToolRegistry
 	logger           *logrus.Logger
 	summaryModel     string
 	windowSize       int
 	summarizeTrigger int
 	summaryMaxTokens int
+	summaryChunkSize int
+	summaryPrompt    string
+	maxMessages      int
+	hardMaxMessages  int
+	// ownershipOnInsert skips the GetByID precheck; ownership is enforced by the window
+	// lookup and the guarded user-message insert instead.
+	ownershipOnInsert bool
+	maxPromptBalances int
+	maxPromptPlugins  int
+	rehydrateWindow   time.Duration
+	maxResponseChars  int
+	// abilityMaxTokens holds the default reply token budget per ability
+	abilityMaxTokens  map[string]int
+	buildFailureLimit int
+	supportURL        string
+	pluginInstallURL  string
+	fastPath          bool
+	minSuggestionConf float64
+	clarifyConf       float64
+	tentativeConf     float64
+	staticPrompt      staticPromptCache
+	inflight          inflightRegistry
+	lockTTL           time.Duration
+	lockWait          time.Duration
+	docsMaxChunks     int
+	docsMinScore      float64
+	defaultLocale     string
+	amountPrecision   numfmt.Precision
+	// toolFailureSampleRate is the share of tool parse failures kept in the dead-letter table
+	toolFailureSampleRate float64
+	duplicateWindow       time.Duration
+	bulkPerMinute         int
+	titleMode             string
+	debugSnapshotTTL      time.Duration
+	prices                config.ModelPrices
 }
 
 // conversationWindow holds a windowed view of conversation messages plus optional summary.
@@ -42,52 +284,171 @@ type conversationWindow struct {
 	messages []types.Message
 	summary  *string
 	total    int
+	// rolloverSuggested is set once the conversation passes the soft message cap
+	rolloverSuggested bool
+	// noMemory is set when the conversation or the request turned memory off
+	noMemory bool
+}
+
+// Deps are the collaborators of an AgentService. Anthropic, Messages, Conversations and
+// Logger are required, and Cache too unless the service only replays; any other dependency
+// left nil turns its feature off.
+type Deps struct {
+	Anthropic     ModelClient
+	Messages      MessageStore
+	Conversations ConversationStore
+	Memory        MemoryStore
+	Contacts      *postgres.ContactRepository
+	Drafts        DraftStore
+	ToolFailures  ToolFailureStore
+	Notices       *postgres.ExpiryNoticeRepository
+	Cache         Cache
+	Outbox        EffectDispatcher
+	Verifier      VerifierAPI
+	Plugins       PluginSkillsProvider
+	Docs          DocsRetriever
+	Names         NameResolver
+	Explorer      TransactionExplorer
+	Quotes        SwapQuoter
+	Fees          FeeEstimator
+	Attachments   AttachmentLoader
+	Voice         VoiceSynthesizer
+	Recall        *MessageRecall
+	Flags         FeatureFlags
+	Logger        *logrus.Logger
+}
+
+// Settings is the configuration of an AgentService.
+type Settings struct {
+	// SummaryModel writes conversation summaries and titles
+	SummaryModel string
+	Prices       config.ModelPrices
+	Context      config.ContextConfig
+	Agent        config.AgentConfig
+	Docs         config.DocsConfig
 }
 
 // NewAgentService creates a new AgentService.
-func NewAgentService(
-	anthropicClient *anthropic.Client,
-	msgRepo *postgres.MessageRepository,
-	convRepo *postgres.ConversationRepository,
-	memRepo *postgres.MemoryRepository,
-	redisClient *redis.Client,
-	verifierClient *verifier.Client,
-	pluginProvider PluginSkillsProvider,
-	logger *logrus.Logger,
-	summaryModel string,
-	ctxCfg config.ContextConfig,
-) *AgentService {
-	return &AgentService{
-		anthropic:        anthropicClient,
-		msgRepo:          msgRepo,
-		convRepo:         convRepo,
-		memRepo:          memRepo,
-		redis:            redisClient,
-		verifier:         verifierClient,
-		pluginProvider:   pluginProvider,
-		logger:           logger,
-		summaryModel:     summaryModel,
-		windowSize:       ctxCfg.WindowSize,
-		summarizeTrigger: ctxCfg.SummarizeTrigger,
-		summaryMaxTokens: ctxCfg.SummaryMaxTokens,
+func NewAgentService(deps Deps, settings Settings) *AgentService {
+	s := &AgentService{
+		anthropic:         deps.Anthropic,
+		msgRepo:           deps.Messages,
+		convRepo:          deps.Conversations,
+		memRepo:           deps.Memory,
+		contactRepo:       deps.Contacts,
+		draftRepo:         deps.Drafts,
+		failureRepo:       deps.ToolFailures,
+		noticeRepo:        deps.Notices,
+		redis:             deps.Cache,
+		outbox:            deps.Outbox,
+		verifier:          deps.Verifier,
+		pluginProvider:    deps.Plugins,
+		docs:              deps.Docs,
+		names:             deps.Names,
+		explorer:          deps.Explorer,
+		quotes:            deps.Quotes,
+		fees:              deps.Fees,
+		attachments:       deps.Attachments,
+		voice:             deps.Voice,
+		recall:            deps.Recall,
+		flags:             deps.Flags,
+		logger:            deps.Logger,
+		summaryModel:      settings.SummaryModel,
+		windowSize:        settings.Context.WindowSize,
+		summarizeTrigger:  settings.Context.SummarizeTrigger,
+		summaryMaxTokens:  settings.Context.SummaryMaxTokens,
+		summaryChunkSize:  settings.Context.SummaryChunkSize,
+		summaryPrompt:     cmp.Or(strings.TrimSpace(settings.Context.SummaryPrompt), SummarizationPrompt),
+		maxMessages:       settings.Context.MaxMessages,
+		hardMaxMessages:   settings.Context.HardMaxMessages,
+		ownershipOnInsert: settings.Agent.OwnershipCheckOnInsert,
+		maxPromptBalances: settings.Agent.MaxPromptBalances,
+		maxPromptPlugins:  settings.Agent.MaxPromptPlugins,
+		rehydrateWindow:   settings.Agent.SuggestionRehydrateWindow,
+		maxResponseChars:  settings.Agent.MaxResponseChars,
+		abilityMaxTokens: map[string]int{
+			abilityIntent:  settings.Agent.IntentMaxTokens,
+			abilityPolicy:  settings.Agent.PolicyMaxTokens,
+			abilityConfirm: settings.Agent.ConfirmMaxTokens,
+		},
+		buildFailureLimit: settings.Agent.BuildFailureThreshold,
+		lockTTL:           settings.Agent.ConversationLockTTL,
+		lockWait:          settings.Agent.ConversationLockWait,
+		supportURL:        settings.Agent.SupportURL,
+		pluginInstallURL:  settings.Agent.PluginInstallURL,
+		fastPath:          settings.Agent.FastPathEnabled,
+		minSuggestionConf: settings.Agent.MinSuggestionConfidence,
+		clarifyConf:       settings.Agent.ClarifyConfidence,
+		tentativeConf:     settings.Agent.TentativeConfidence,
+		staticPrompt:      staticPromptCache{appendix: settings.Agent.SystemPromptAppendix},
+		docsMaxChunks:     settings.Docs.MaxChunks,
+		docsMinScore:      settings.Docs.MinScore,
+		defaultLocale:     settings.Agent.DefaultLocale,
+		amountPrecision: numfmt.Precision{
+			Crypto:     settings.Agent.CryptoDisplayDecimals,
+			Stablecoin: settings.Agent.StablecoinDisplayDecimals,
+			Fiat:       settings.Agent.FiatDisplayDecimals,
+		},
+		toolFailureSampleRate: settings.Agent.ToolParseFailureSampleRate,
+		duplicateWindow:       settings.Agent.DuplicateConversationWindow,
+		bulkPerMinute:         settings.Agent.BulkRequestsPerMinute,
+		titleMode:             settings.Agent.TitleMode,
+		debugSnapshotTTL:      settings.Agent.DebugSnapshotTTL,
+		prices:                settings.Prices,
 	}
+	s.intentTools = s.buildIntentTools()
+	return s
 }
 
 // ProcessMessage routes the request to the appropriate ability handler.
-func (s *AgentService) ProcessMessage(ctx context.Context, convID uuid.UUID, publicKey string, req *SendMessageRequest) (*SendMessageResponse, error) {
-	// Validate conversation exists and belongs to user
-	_, err := s.convRepo.GetByID(ctx, convID, publicKey)
-	if err != nil {
-		if errors.Is(err, postgres.ErrNotFound) {
-			return nil, fmt.Errorf("conversation not found")
+func (s *AgentService) ProcessMessage(ctx context.Context, convID uuid.UUID, publicKey string, req *SendMessageRequest) (out *SendMessageResponse, err error) {
+	start := time.Now()
+	// Register the request so AbortMessage can cancel it
+	ctx, done := s.inflight.start(ctx, convID)
+	defer done()
+	ctx = withWrites(withUsage(withGeneration(ctx)))
+	defer func() {
+		if err != nil && aborted(ctx) {
+			err = ErrGenerationAborted
+		}
+		err = observeMessage(RequestAbility(req), start, err)
+		s.reportUsage(ctx, convID, out)
+		reportWrites(ctx, out)
+	}()
+
+	// Address keys are rendered into prompts and used for policy sources, so unknown chains
+	// are dropped and the rest brought to one spelling before anything reads them
+	if req.Context != nil {
+		if dropped := req.Context.NormalizeAddresses(); len(dropped) > 0 {
+			s.logger.WithFields(logrus.Fields{
+				"conversation_id": convID,
+				"dropped_chains":  dropped,
+			}).Warn("dropped wallet context addresses with unsupported or conflicting chains")
 		}
-		return nil, fmt.Errorf("get conversation: %w", err)
 	}
 
-	// Load conversation window once before routing to abilities
-	window, err := s.getConversationWindow(ctx, convID, publicKey)
+	// Messages to one conversation are processed one at a time; concurrent ones would load
+	// the same window and race on the summary cursor
+	unlock, err := s.lockConversation(ctx, convID)
 	if err != nil {
-		return nil, fmt.Errorf("get conversation window: %w", err)
+		return nil, err
+	}
+	defer unlock()
+
+	window, err := s.admitMessage(ctx, convID, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Memory can be turned off for a single message or for the whole conversation
+	window.noMemory = req.NoMemory
+	if !window.noMemory {
+		if window.noMemory, err = s.convRepo.NoMemory(ctx, convID, publicKey); err != nil {
+			return nil, fmt.Errorf("get conversation memory setting: %w", err)
+		}
+	}
+	if window.noMemory {
+		ctx = withNoMemory(ctx)
 	}
 
 	// Route based on request content
@@ -97,13 +458,157 @@ func (s *AgentService) ProcessMessage(ctx context.Context, convID uuid.UUID, pub
 		return s.confirmAction(ctx, convID, req, window)
 	case req.SelectedSuggestionID != nil:
 		// Ability 2: Policy builder
-		return s.buildPolicy(ctx, convID, req, window)
+		return s.buildPolicyTracked(ctx, convID, req, window)
+	case s.fastPath && s.fastPathAllowed(ctx, convID, req, window):
+		// Trivial acknowledgments skip tools and full context assembly
+		return s.replyFast(ctx, convID, req, window)
 	default:
 		// Ability 1: Intent detection (default)
 		return s.detectIntent(ctx, convID, req, window)
 	}
 }
 
+// admitMessage checks that the conversation belongs to publicKey and is below the hard
+// message cap, and loads its window once before routing to abilities. The cap is checked
+// only after ownership is established, so a caller can't probe whether someone else's
+// conversation is full.
+func (s *AgentService) admitMessage(ctx context.Context, convID uuid.UUID, publicKey string) (*conversationWindow, error) {
+	// Validate conversation exists and belongs to user. When ownershipOnInsert is set this
+	// round-trip is skipped: the window's summary lookup is scoped to the public key and the
+	// first message insert is guarded, so nothing is read from or written to a foreign conversation.
+	if !s.ownershipOnInsert {
+		if err := s.ensureConversation(ctx, convID, publicKey); err != nil {
+			return nil, err
+		}
+	}
+
+	window, err := s.getConversationWindow(ctx, convID, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("get conversation window: %w", err)
+	}
+
+	// Refuse new messages past the hard cap; past the soft cap, suggest a fresh conversation
+	count, err := s.msgRepo.CountByConversationID(ctx, convID)
+	if err != nil {
+		return nil, fmt.Errorf("count messages: %w", err)
+	}
+	if count >= s.hardMaxMessages {
+		return nil, &ConversationFullError{ConversationID: convID.String(), Messages: count}
+	}
+	window.rolloverSuggested = count >= s.maxMessages
+	return window, nil
+}
+
+// createMessageWithEffects stores a message together with its side-effect events, then
+// delivers the events immediately. Events that fail here are retried by the outbox dispatcher.
+func (s *AgentService) createMessageWithEffects(ctx context.Context, msg *types.Message, events []*types.OutboxEvent) error {
+	if err := s.msgRepo.CreateWithOutbox(ctx, msg, events, s.outbox.DispatchAfter()); err != nil {
+		return err
+	}
+	s.outbox.Deliver(ctx, events)
+	return nil
+}
+
+// detachedWriteTimeout bounds writes made after the request context is done.
+const detachedWriteTimeout = 5 * time.Second
+
+// storeAssistantMessage stores an assistant reply with its side-effect events. When the client
+// went away while the reply was generated, the reply is still stored so the conversation stays
+// consistent, but it is marked delivered:false and its side effects are dropped: suggestions
+// the user never saw shouldn't become selectable when the client retries.
+func (s *AgentService) storeAssistantMessage(ctx context.Context, msg *types.Message, events []*types.OutboxEvent) error {
+	msg.Metadata = markNoMemory(ctx, annotateGeneration(ctx, msg.Metadata))
+	if ctx.Err() == nil {
+		var err error
+		if len(events) == 0 {
+			err = s.msgRepo.Create(ctx, msg)
+		} else {
+			err = s.createMessageWithEffects(ctx, msg, events)
+		}
+		if err == nil {
+			noteWrite(ctx, msg)
+			s.indexMessage(ctx, msg)
+			s.captureDebugSnapshot(ctx, msg)
+		}
+		return err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"conversation_id": msg.ConversationID,
+		"dropped_events":  len(events),
+	}).Info("client disconnected, storing reply as undelivered")
+	msg.Metadata = markUndelivered(msg.Metadata)
+
+	// The request context is done; detach so the write isn't canceled with it
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), detachedWriteTimeout)
+	defer cancel()
+	if err := s.msgRepo.Create(writeCtx, msg); err != nil {
+		return err
+	}
+	noteWrite(ctx, msg)
+	s.indexMessage(ctx, msg)
+	s.captureDebugSnapshot(ctx, msg)
+	return nil
+}
+
+// errorReplyContent is the placeholder reply stored when a response couldn't be generated.
+const errorReplyContent = "I couldn't generate a response. Tap to retry."
+
+// storeErrorReply stores a placeholder assistant message with content type "error" after an
+// ability failed past storing the user's message, so the conversation doesn't end on an
+// unanswered message when reloaded. Error replies are kept out of model context. retryable
+// marks failures whose user message can be re-run with RetryMessage.
+func (s *AgentService) storeErrorReply(ctx context.Context, convID, userMsgID uuid.UUID, retryable bool) {
+	if aborted(ctx) {
+		s.storeAbortedReply(ctx, convID, userMsgID)
+		return
+	}
+
+	metadata, _ := json.Marshal(map[string]any{
+		"type":             "error",
+		"status":           "failed",
+		"retryable":        retryable,
+		"retry_message_id": userMsgID,
+	})
+	metadata = annotateGeneration(ctx, metadata)
+	msg := &types.Message{
+		ConversationID: convID,
+		Role:           types.RoleAssistant,
+		Content:        errorReplyContent,
+		ContentType:    "error",
+		Metadata:       metadata,
+	}
+
+	// Store it even when the failure was the client going away, so a reload isn't left dangling
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), detachedWriteTimeout)
+	defer cancel()
+	if err := s.msgRepo.Create(writeCtx, msg); err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to store error reply")
+	}
+}
+
+// markUndelivered sets delivered:false in message metadata.
+func markUndelivered(metadata json.RawMessage) json.RawMessage {
+	meta := map[string]any{}
+	if len(metadata) > 0 {
+		_ = json.Unmarshal(metadata, &meta)
+	}
+	meta["delivered"] = false
+	data, _ := json.Marshal(meta)
+	return data
+}
+
+// ensureConversation verifies the conversation exists and belongs to the given public key.
+func (s *AgentService) ensureConversation(ctx context.Context, convID uuid.UUID, publicKey string) error {
+	if _, err := s.convRepo.GetByID(ctx, convID, publicKey); err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return fmt.Errorf("conversation not found: %w", err)
+		}
+		return fmt.Errorf("get conversation: %w", err)
+	}
+	return nil
+}
+
 // getConversationWindow returns a windowed view of the conversation.
 // Uses a summary_up_to cursor to only count/load messages after the last summarization point.
 // This prevents re-summarizing on every request once the trigger threshold is crossed.
@@ -129,8 +634,10 @@ func (s *AgentService) getConversationWindow(ctx context.Context, convID uuid.UU
 			"has_cursor":        true,
 		}).Debug("context window state")
 
+		plan := planWindow(count, s.windowSize, s.summarizeTrigger, true)
+
 		// Active messages fit in window — load all since cursor
-		if count <= s.windowSize {
+		if plan == windowAll {
 			msgs, err := s.msgRepo.GetSince(ctx, convID, *cursor)
 			if err != nil {
 				return nil, fmt.Errorf("get messages since cursor: %w", err)
@@ -138,8 +645,8 @@ func (s *AgentService) getConversationWindow(ctx context.Context, convID uuid.UU
 			return &conversationWindow{messages: msgs, summary: summary, total: count}, nil
 		}
 
-		// Active messages exceed trigger — re-summarize
-		if count > s.summarizeTrigger {
+		// Active messages exceed trigger — re-summarize, unless switched off
+		if plan == windowSummarize && s.summarizationEnabled(ctx) {
 			allSinceCursor, err := s.msgRepo.GetSince(ctx, convID, *cursor)
 			if err != nil {
 				return nil, fmt.Errorf("get messages since cursor: %w", err)
@@ -187,25 +694,33 @@ func (s *AgentService) getConversationWindow(ctx context.Context, convID uuid.UU
 		"has_cursor":        false,
 	}).Debug("context window state")
 
-	// All messages fit in window
-	if total <= s.windowSize {
-		msgs, err := s.msgRepo.GetByConversationID(ctx, convID)
+	plan := planWindow(total, s.windowSize, s.summarizeTrigger, false)
+
+	// Past trigger with summarization switched off — keep the recent window only
+	if plan == windowSummarize && !s.summarizationEnabled(ctx) {
+		msgs, err := s.msgRepo.GetRecent(ctx, convID, s.windowSize)
 		if err != nil {
-			return nil, fmt.Errorf("get messages: %w", err)
+			return nil, fmt.Errorf("get recent messages: %w", err)
 		}
 		return &conversationWindow{messages: msgs, total: total}, nil
 	}
 
 	// Past trigger — first-time summarization
-	if total > s.summarizeTrigger {
+	if plan == windowSummarize {
 		allMsgs, err := s.msgRepo.GetByConversationID(ctx, convID)
 		if err != nil {
 			return nil, fmt.Errorf("get messages: %w", err)
 		}
 
 		if err := s.summarizeOldMessages(ctx, convID, publicKey, allMsgs); err != nil {
-			s.logger.WithError(err).Error("synchronous summarization failed")
-			return &conversationWindow{messages: allMsgs, total: total}, nil
+			// Sending every message could exceed the model's context limit and fail the turn;
+			// keep only the recent window and drop older context instead
+			dropped := len(allMsgs) - s.windowSize
+			s.logger.WithError(err).WithFields(logrus.Fields{
+				"conversation_id":  convID,
+				"dropped_messages": dropped,
+			}).Warn("synchronous summarization failed, context truncated to recent window")
+			return &conversationWindow{messages: allMsgs[dropped:], total: total}, nil
 		}
 
 		// Reload summary+cursor after first summarization
@@ -230,7 +745,7 @@ func (s *AgentService) getConversationWindow(ctx context.Context, convID uuid.UU
 		return &conversationWindow{messages: recentMsgs, summary: summary, total: total}, nil
 	}
 
-	// Between window and trigger, no cursor yet — load all messages
+	// All messages fit in window, or between window and trigger with no cursor yet — load all messages
 	msgs, err := s.msgRepo.GetByConversationID(ctx, convID)
 	if err != nil {
 		return nil, fmt.Errorf("get messages: %w", err)
@@ -240,27 +755,56 @@ func (s *AgentService) getConversationWindow(ctx context.Context, convID uuid.UU
 
 // summarizeOldMessages summarizes messages outside the recent window and stores the summary.
 // It runs synchronously and advances the summary_up_to cursor to the last summarized message.
+// With chunking enabled, long backlogs are summarized oldest-first one chunk at a time; each
+// chunk's summary is stored before the next so a failure keeps the progress made so far.
 func (s *AgentService) summarizeOldMessages(ctx context.Context, convID uuid.UUID, publicKey string, allMsgs []types.Message) error {
 	if len(allMsgs) <= s.windowSize {
 		return nil
 	}
+	reportProgress(ctx, ProgressSummarizing)
 
 	// Split: old messages to summarize, recent window to keep
-	oldMsgs := allMsgs[:len(allMsgs)-s.windowSize]
+	oldCount := len(allMsgs) - s.windowSize
+	chunkSize := oldCount
+	if s.summaryChunkSize > 0 && s.summaryChunkSize < oldCount {
+		chunkSize = s.summaryChunkSize
+	}
+
+	// Include existing summary for incremental summarization
+	existingSummary, _, _ := s.convRepo.GetSummaryWithCursor(ctx, convID, publicKey)
+	for start := 0; start < oldCount; start += chunkSize {
+		end := min(start+chunkSize, oldCount)
+		summaryText, err := s.summarizeChunk(ctx, convID, publicKey, existingSummary, allMsgs[start:end], allMsgs[end:])
+		if err != nil {
+			if start > 0 {
+				return fmt.Errorf("summarize messages %d-%d of %d: %w", start, end, oldCount, err)
+			}
+			return err
+		}
+		existingSummary = &summaryText
+	}
+	return nil
+}
 
+// summarizeChunk folds oldMsgs into the previous summary and stores the result, advancing
+// the cursor to the last message of the chunk. later holds every message after the chunk,
+// so suggestions acted on later aren't reported as pending.
+func (s *AgentService) summarizeChunk(ctx context.Context, convID uuid.UUID, publicKey string, previous *string, oldMsgs, later []types.Message) (string, error) {
 	// Build content to summarize
 	var oldContent string
 	for _, msg := range oldMsgs {
+		if msg.ContentType == "error" {
+			continue
+		}
 		oldContent += fmt.Sprintf("[%s]: %s\n\n", msg.Role, msg.Content)
 	}
 
-	// Include existing summary for incremental summarization
-	existingSummary, _, _ := s.convRepo.GetSummaryWithCursor(ctx, convID, publicKey)
-	prompt := SummarizationPrompt
-	if existingSummary != nil {
-		prompt += "\n\n## Previous Summary\n\n" + *existingSummary
+	prompt := s.summaryPrompt
+	if previous != nil {
+		prompt += "\n\n## Previous Summary\n\n" + *previous
 	}
 	prompt += "\n\n## Messages to Summarize\n\n" + oldContent
+	prompt += summarySuggestionsSection(oldMsgs, later)
 
 	// Call Claude Haiku for summarization
 	req := &anthropic.Request{
@@ -271,9 +815,9 @@ func (s *AgentService) summarizeOldMessages(ctx context.Context, convID uuid.UUI
 		},
 	}
 
-	resp, err := s.anthropic.SendMessage(ctx, req)
+	resp, err := s.send(ctx, purposeSummary, req)
 	if err != nil {
-		return fmt.Errorf("call anthropic: %w", err)
+		return "", fmt.Errorf("call anthropic: %w", err)
 	}
 
 	// Extract text response
@@ -286,13 +830,22 @@ func (s *AgentService) summarizeOldMessages(ctx context.Context, convID uuid.UUI
 	}
 
 	if summaryText == "" {
-		return fmt.Errorf("empty response from anthropic")
+		return "", fmt.Errorf("empty response from anthropic")
+	}
+
+	// Summaries are replayed into every future prompt, so scrub secrets the same way as memory
+	summaryText, redacted := scrubSensitive(summaryText)
+	if len(redacted) > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"conversation_id": convID,
+			"categories":      redacted,
+		}).Warn("security: redacted sensitive content from conversation summary")
 	}
 
 	// Advance cursor to the last summarized message's timestamp
 	summaryUpTo := oldMsgs[len(oldMsgs)-1].CreatedAt
 	if err := s.convRepo.UpdateSummaryWithCursor(ctx, convID, publicKey, summaryText, summaryUpTo); err != nil {
-		return fmt.Errorf("store summary with cursor: %w", err)
+		return "", fmt.Errorf("store summary with cursor: %w", err)
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -300,15 +853,17 @@ func (s *AgentService) summarizeOldMessages(ctx context.Context, convID uuid.UUI
 		"summary_length":  len(summaryText),
 		"summary_up_to":   summaryUpTo,
 	}).Info("conversation summary updated")
-	return nil
+	return summaryText, nil
 }
 
 // anthropicMessagesFromWindow converts conversation window messages to Anthropic message format,
-// skipping system messages.
+// skipping system messages. The result alternates roles and starts with a user turn, as the
+// API requires, even when deletions or regenerations left same-role messages next to each other.
 func anthropicMessagesFromWindow(window *conversationWindow) []anthropic.Message {
 	msgs := make([]anthropic.Message, 0, len(window.messages))
 	for _, msg := range window.messages {
-		if msg.Role == types.RoleSystem {
+		// Error placeholders are for the UI only, and the API rejects empty (aborted) turns
+		if msg.Role == types.RoleSystem || msg.ContentType == "error" || msg.Content == "" {
 			continue
 		}
 		msgs = append(msgs, anthropic.Message{
@@ -316,6 +871,59 @@ func anthropicMessagesFromWindow(window *conversationWindow) []anthropic.Message
 			Content: msg.Content,
 		})
 	}
-	return msgs
+	return alternateTurns(msgs)
+}
+
+// turnPlaceholder stands in for a missing turn where roles must alternate and adjacent
+// messages can't be merged.
+const turnPlaceholder = "(continue)"
+
+// alternateTurns merges consecutive same-role text messages and makes the first message a
+// user turn. Same-role messages with non-text content are separated by a placeholder turn.
+func alternateTurns(msgs []anthropic.Message) []anthropic.Message {
+	out := make([]anthropic.Message, 0, len(msgs)+1)
+	for _, msg := range msgs {
+		if len(out) == 0 {
+			if msg.Role != "user" {
+				out = append(out, anthropic.Message{Role: "user", Content: turnPlaceholder})
+			}
+			out = append(out, msg)
+			continue
+		}
+		last := &out[len(out)-1]
+		if last.Role != msg.Role {
+			out = append(out, msg)
+			continue
+		}
+		prev, prevText := last.Content.(string)
+		next, nextText := msg.Content.(string)
+		if prevText && nextText {
+			last.Content = prev + "\n\n" + next
+			continue
+		}
+		out = append(out, anthropic.Message{Role: otherRole(msg.Role), Content: turnPlaceholder}, msg)
+	}
+	return out
 }
 
+// appendUserTurn adds a user message, merging it into the last message when that is already
+// a user turn.
+func appendUserTurn(msgs []anthropic.Message, content string) []anthropic.Message {
+	return alternateTurns(append(msgs, anthropic.Message{Role: "user", Content: content}))
+}
+
+// endWithUserTurn makes sure the conversation ends on a user turn, since the model is asked
+// to respond to it; a trailing assistant message gets a placeholder user turn after it.
+func endWithUserTurn(msgs []anthropic.Message) []anthropic.Message {
+	if len(msgs) > 0 && msgs[len(msgs)-1].Role == "user" {
+		return msgs
+	}
+	return append(msgs, anthropic.Message{Role: "user", Content: turnPlaceholder})
+}
+
+func otherRole(role string) string {
+	if role == "user" {
+		return "assistant"
+	}
+	return "user"
+}
@@ -0,0 +1,480 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+const (
+	testOwner    = "owner-public-key"
+	testStranger = "stranger-public-key"
+)
+
+// admissionService returns a service whose conversation belongs to testOwner and holds total messages.
+func admissionService(total int, ownershipOnInsert bool) (*AgentService, *fakeMessageStore) {
+	cursor := time.Now().Add(-time.Hour)
+	msgs := &fakeMessageStore{
+		total: total,
+		messages: []types.Message{
+			{Role: types.RoleUser, Content: "hi", CreatedAt: cursor.Add(time.Minute)},
+			{Role: types.RoleAssistant, Content: "hello", CreatedAt: cursor.Add(2 * time.Minute)},
+		},
+	}
+	return &AgentService{
+		msgRepo:           msgs,
+		convRepo:          &fakeConversationStore{owner: testOwner, cursor: &cursor},
+		logger:            testLogger(),
+		windowSize:        20,
+		summarizeTrigger:  40,
+		maxMessages:       5,
+		hardMaxMessages:   10,
+		ownershipOnInsert: ownershipOnInsert,
+	}, msgs
+}
+
+func TestAdmitMessage(t *testing.T) {
+	tests := []struct {
+		name              string
+		publicKey         string
+		total             int
+		ownershipOnInsert bool
+		wantNotFound      bool
+		wantFull          bool
+		wantRollover      bool
+	}{
+		{name: "owner below soft cap", publicKey: testOwner, total: 2},
+		{name: "owner past soft cap", publicKey: testOwner, total: 5, wantRollover: true},
+		{name: "owner at hard cap", publicKey: testOwner, total: 10, wantFull: true},
+		{name: "owner at hard cap, ownership on insert", publicKey: testOwner, total: 10, ownershipOnInsert: true, wantFull: true},
+		{name: "stranger to a full conversation", publicKey: testStranger, total: 10, wantNotFound: true},
+		{name: "stranger to a full conversation, ownership on insert", publicKey: testStranger, total: 10, ownershipOnInsert: true, wantNotFound: true},
+		{name: "stranger to an open conversation, ownership on insert", publicKey: testStranger, total: 2, ownershipOnInsert: true, wantNotFound: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, msgs := admissionService(tt.total, tt.ownershipOnInsert)
+			window, err := s.admitMessage(context.Background(), uuid.New(), tt.publicKey)
+
+			var full *ConversationFullError
+			if got := errors.As(err, &full); got != tt.wantFull {
+				t.Fatalf("admitMessage() err = %v, want ConversationFullError %v", err, tt.wantFull)
+			}
+			if got := errors.Is(err, postgres.ErrNotFound); got != tt.wantNotFound {
+				t.Fatalf("admitMessage() err = %v, want not found %v", err, tt.wantNotFound)
+			}
+			if tt.wantNotFound && msgs.counts > 0 {
+				t.Errorf("messages of a foreign conversation were counted %d times", msgs.counts)
+			}
+			if err != nil {
+				return
+			}
+			if window.rolloverSuggested != tt.wantRollover {
+				t.Errorf("rolloverSuggested = %v, want %v", window.rolloverSuggested, tt.wantRollover)
+			}
+			if len(window.messages) != len(msgs.messages) {
+				t.Errorf("window has %d messages, want %d", len(window.messages), len(msgs.messages))
+			}
+		})
+	}
+}
+
+func BenchmarkAdmitMessage(b *testing.B) {
+	for _, ownershipOnInsert := range []bool{false, true} {
+		name := "precheck"
+		if ownershipOnInsert {
+			name = "ownership_on_insert"
+		}
+		b.Run(name, func(b *testing.B) {
+			s, _ := admissionService(2, ownershipOnInsert)
+			ctx := context.Background()
+			convID := uuid.New()
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := s.admitMessage(ctx, convID, testOwner); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAlternateTurns(t *testing.T) {
+	user := func(content any) anthropic.Message { return anthropic.Message{Role: "user", Content: content} }
+	assistant := func(content any) anthropic.Message { return anthropic.Message{Role: "assistant", Content: content} }
+	image := []any{anthropic.TextBlock{Type: "text", Text: "see this"}}
+
+	tests := []struct {
+		name string
+		msgs []anthropic.Message
+		want []anthropic.Message
+	}{
+		{name: "empty", msgs: nil, want: []anthropic.Message{}},
+		{
+			name: "already alternating",
+			msgs: []anthropic.Message{user("hi"), assistant("hello"), user("swap")},
+			want: []anthropic.Message{user("hi"), assistant("hello"), user("swap")},
+		},
+		{
+			name: "leading assistant gets a user turn",
+			msgs: []anthropic.Message{assistant("welcome"), user("hi")},
+			want: []anthropic.Message{user(turnPlaceholder), assistant("welcome"), user("hi")},
+		},
+		{
+			name: "consecutive text merged",
+			msgs: []anthropic.Message{user("hi"), user("are you there?"), assistant("yes"), assistant("how can I help?")},
+			want: []anthropic.Message{user("hi\n\nare you there?"), assistant("yes\n\nhow can I help?")},
+		},
+		{
+			name: "block content separated by a placeholder",
+			msgs: []anthropic.Message{user("hi"), user(image)},
+			want: []anthropic.Message{user("hi"), assistant(turnPlaceholder), user(image)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := alternateTurns(tt.msgs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("alternateTurns() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newConversationService returns a service answering from model, for an empty conversation
+// that belongs to testOwner.
+func newConversationService(model *fakeModel) (*AgentService, *fakeMessageStore) {
+	msgs := &fakeMessageStore{}
+	return NewAgentService(Deps{
+		Anthropic:     model,
+		Messages:      msgs,
+		Conversations: &fakeConversationStore{owner: testOwner},
+		Cache:         newFakeCache(),
+		Logger:        testLogger(),
+	}, Settings{
+		Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+		Agent:   config.AgentConfig{IntentMaxTokens: 1024},
+	}), msgs
+}
+
+func TestProcessMessageNewConversation(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     *fakeModel
+		wantErr   bool
+		wantReply string
+	}{
+		{
+			name: "answered",
+			model: &fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+				"intent":   "general_question",
+				"response": "Vultisig is a multi-chain wallet.",
+			})},
+			wantReply: "Vultisig is a multi-chain wallet.",
+		},
+		{
+			name:      "model fails",
+			model:     &fakeModel{err: errors.New("overloaded")},
+			wantErr:   true,
+			wantReply: errorReplyContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, msgs := newConversationService(tt.model)
+			resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   "what is vultisig?",
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProcessMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			stored := msgs.stored()
+			if len(stored) != 2 {
+				t.Fatalf("stored %d messages, want the user message and a reply", len(stored))
+			}
+			userMsg, reply := stored[0], stored[1]
+			if userMsg.Role != types.RoleUser || userMsg.Content != "what is vultisig?" {
+				t.Errorf("first stored message = %s %q, want the user message", userMsg.Role, userMsg.Content)
+			}
+			if reply.Role != types.RoleAssistant || reply.Content != tt.wantReply {
+				t.Errorf("reply = %s %q, want assistant %q", reply.Role, reply.Content, tt.wantReply)
+			}
+
+			if tt.wantErr {
+				// The message stays retryable from the error reply
+				var meta struct {
+					Retryable      bool      `json:"retryable"`
+					RetryMessageID uuid.UUID `json:"retry_message_id"`
+				}
+				if err := json.Unmarshal(reply.Metadata, &meta); err != nil {
+					t.Fatalf("decode error reply metadata: %v", err)
+				}
+				if !meta.Retryable || meta.RetryMessageID != userMsg.ID {
+					t.Errorf("error reply metadata = %+v, want retryable pointing at %s", meta, userMsg.ID)
+				}
+				return
+			}
+			if resp == nil || resp.Message.Content != tt.wantReply {
+				t.Errorf("response = %+v, want reply %q", resp, tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestProcessMessageErrorReply(t *testing.T) {
+	model := &fakeModel{err: errors.New("anthropic: api_error: Internal server error")}
+	svc, msgs := newConversationService(model)
+	convID := uuid.New()
+
+	if _, err := svc.ProcessMessage(context.Background(), convID, testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "what is vultisig?",
+	}); err == nil {
+		t.Fatal("ProcessMessage() error = nil, want the model failure")
+	}
+
+	stored := msgs.stored()
+	if len(stored) != 2 {
+		t.Fatalf("stored %d messages, want the user message and a placeholder", len(stored))
+	}
+	placeholder := stored[1]
+	if placeholder.Role != types.RoleAssistant || placeholder.ContentType != "error" || placeholder.Content != errorReplyContent {
+		t.Errorf("placeholder = %s %s %q, want an assistant error reply", placeholder.Role, placeholder.ContentType, placeholder.Content)
+	}
+	var meta struct {
+		Type   string `json:"type"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(placeholder.Metadata, &meta); err != nil {
+		t.Fatalf("decode placeholder metadata: %v", err)
+	}
+	if meta.Type != "error" || meta.Status != "failed" {
+		t.Errorf("placeholder metadata = %s, want type error and status failed", placeholder.Metadata)
+	}
+
+	// The next turn is answered without the placeholder in its context
+	msgs.messages = stored
+	model.err = nil
+	model.resp = toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "general_question",
+		"response": "Vultisig is a multi-chain wallet.",
+	})
+	if _, err := svc.ProcessMessage(context.Background(), convID, testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "hello?",
+	}); err != nil {
+		t.Fatalf("ProcessMessage() after the error error = %v", err)
+	}
+	next := model.requests[len(model.requests)-1]
+	for _, m := range next.Messages {
+		if text, _ := m.Content.(string); strings.Contains(text, errorReplyContent) {
+			t.Errorf("next turn context carries the placeholder in the %s turn", m.Role)
+		}
+	}
+	if len(next.Messages) == 0 || next.Messages[0].Role != "user" {
+		t.Errorf("next turn context = %+v, want it to start with the user's earlier message", next.Messages)
+	}
+}
+
+func TestProcessMessageSystemPromptAppendix(t *testing.T) {
+	const appendix = "Mention the zero-fee weekend promo when asked about swaps."
+	model := &fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "general_question",
+		"response": "Vultisig is a multi-chain wallet.",
+	})}
+	svc := NewAgentService(Deps{
+		Anthropic:     model,
+		Messages:      &fakeMessageStore{},
+		Conversations: &fakeConversationStore{owner: testOwner},
+		Cache:         newFakeCache(),
+		Logger:        testLogger(),
+	}, Settings{
+		Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+		Agent:   config.AgentConfig{IntentMaxTokens: 1024, SystemPromptAppendix: appendix},
+	})
+
+	// The second send is served from the cached static prompt
+	for i := range 2 {
+		if _, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+			PublicKey: testOwner,
+			Content:   "what is vultisig?",
+		}); err != nil {
+			t.Fatalf("ProcessMessage() #%d error = %v", i+1, err)
+		}
+	}
+
+	if len(model.requests) != 2 {
+		t.Fatalf("model got %d requests, want 2", len(model.requests))
+	}
+	for i, req := range model.requests {
+		base := strings.Index(req.System, SystemPrompt)
+		at := strings.Index(req.System, appendix)
+		if base < 0 || at < base+len(SystemPrompt) {
+			t.Errorf("request #%d system prompt does not carry the appendix after the base prompt", i+1)
+		}
+		if plugins := strings.Index(req.System, "## Available Plugins"); plugins >= 0 && plugins < at {
+			t.Errorf("request #%d system prompt puts the appendix after the plugins section", i+1)
+		}
+	}
+}
+
+func TestProcessMessageConversationCaps(t *testing.T) {
+	const reply = "Vultisig is a multi-chain wallet."
+	tests := []struct {
+		name         string
+		total        int
+		content      string
+		wantFull     bool
+		wantRollover bool
+		wantReply    string
+	}{
+		{name: "below the soft cap", total: 49, content: "what is vultisig?", wantReply: reply},
+		{name: "at the soft cap", total: 50, content: "what is vultisig?", wantRollover: true, wantReply: reply},
+		{name: "at the soft cap, fast path", total: 50, content: "thanks", wantRollover: true},
+		{name: "just below the hard cap", total: 99, content: "what is vultisig?", wantRollover: true, wantReply: reply},
+		{name: "at the hard cap", total: 100, content: "what is vultisig?", wantFull: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+				"intent":   "general_question",
+				"response": reply,
+			})}
+			svc, msgs := newConversationService(model)
+			svc.fastPath = true
+			// Older messages are summarized, so the window is read past the cursor
+			cursor := time.Now().Add(-time.Hour)
+			svc.convRepo.(*fakeConversationStore).cursor = &cursor
+			msgs.total = tt.total
+
+			resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   tt.content,
+			})
+			var full *ConversationFullError
+			if got := errors.As(err, &full); got != tt.wantFull {
+				t.Fatalf("ProcessMessage() error = %v, want ConversationFullError %v", err, tt.wantFull)
+			}
+			if tt.wantFull {
+				// A full conversation is refused before anything is stored or sent to the model
+				if n := len(msgs.stored()); n > 0 || len(model.requests) > 0 {
+					t.Errorf("stored %d messages and made %d model requests, want none", n, len(model.requests))
+				}
+				if full.Messages != tt.total {
+					t.Errorf("ConversationFullError.Messages = %d, want %d", full.Messages, tt.total)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+			if resp.RolloverSuggested != tt.wantRollover {
+				t.Errorf("RolloverSuggested = %v, want %v", resp.RolloverSuggested, tt.wantRollover)
+			}
+			// The rollover is signalled by the flag alone; the reply is left as written
+			if tt.wantReply != "" && resp.Message.Content != tt.wantReply {
+				t.Errorf("reply = %q, want %q", resp.Message.Content, tt.wantReply)
+			}
+			stored := msgs.stored()
+			if got := stored[len(stored)-1].Content; got != resp.Message.Content {
+				t.Errorf("stored reply = %q, want %q", got, resp.Message.Content)
+			}
+		})
+	}
+}
+
+func TestAbilityMaxTokens(t *testing.T) {
+	agentCfg := config.AgentConfig{IntentMaxTokens: 1500, PolicyMaxTokens: 6000, ConfirmMaxTokens: 300}
+	override := 700
+
+	tests := []struct {
+		name string
+		// run sends one message of the ability through s
+		run  func(s *AgentService, convID uuid.UUID) error
+		want int
+	}{
+		{
+			name: "intent",
+			run: func(s *AgentService, convID uuid.UUID) error {
+				_, err := s.ProcessMessage(context.Background(), convID, testOwner, &SendMessageRequest{PublicKey: testOwner, Content: "hi"})
+				return err
+			},
+			want: agentCfg.IntentMaxTokens,
+		},
+		{
+			name: "intent with a request override",
+			run: func(s *AgentService, convID uuid.UUID) error {
+				_, err := s.ProcessMessage(context.Background(), convID, testOwner, &SendMessageRequest{PublicKey: testOwner, Content: "hi", MaxTokens: &override})
+				return err
+			},
+			want: override,
+		},
+		{
+			name: "policy",
+			run: func(s *AgentService, convID uuid.UUID) error {
+				id := "sugg-1"
+				_, err := s.buildPolicy(context.Background(), convID, &SendMessageRequest{PublicKey: testOwner, SelectedSuggestionID: &id}, &conversationWindow{})
+				return err
+			},
+			want: agentCfg.PolicyMaxTokens,
+		},
+		{
+			name: "confirm",
+			run: func(s *AgentService, convID uuid.UUID) error {
+				_, err := s.confirmAction(context.Background(), convID, &SendMessageRequest{
+					PublicKey:    testOwner,
+					ActionResult: &ActionResult{Action: "create_policy", Success: true},
+				}, &conversationWindow{})
+				return err
+			},
+			want: agentCfg.ConfirmMaxTokens,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convID := uuid.New()
+			// The model call fails, so only the request sent matters
+			model := &fakeModel{err: errors.New("overloaded")}
+			cache := newFakeCache()
+			suggestion, _ := json.Marshal(Suggestion{ID: "sugg-1", PluginID: testPluginID, Title: "Recurring swap", ConversationID: convID.String()})
+			_ = cache.Set(context.Background(), "sugg-1", string(suggestion), 0)
+			s := NewAgentService(Deps{
+				Anthropic:     model,
+				Messages:      &fakeMessageStore{},
+				Conversations: &fakeConversationStore{owner: testOwner},
+				Cache:         cache,
+				Outbox:        &fakeOutbox{cache: cache},
+				Verifier:      &fakeVerifier{schemas: map[string]*verifier.RecipeSchema{testPluginID: {}}},
+				Logger:        testLogger(),
+			}, Settings{
+				Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+				Agent:   agentCfg,
+			})
+
+			if err := tt.run(s, convID); err == nil {
+				t.Fatal("sent the message without the model, want its error")
+			}
+			if len(model.requests) != 1 {
+				t.Fatalf("model got %d requests, want 1", len(model.requests))
+			}
+			if got := model.requests[0].MaxTokens; got != tt.want {
+				t.Errorf("max_tokens = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
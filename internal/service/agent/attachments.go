@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/service/attachment"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ErrAttachmentsDisabled is returned for messages with attachments while attachments are
+// switched off.
+var ErrAttachmentsDisabled = errors.New("attachments are not enabled")
+
+// attachmentsMeta is how a user message's attachments are kept in its metadata, so the
+// history can show thumbnails and a retry can send the images again.
+type attachmentsMeta struct {
+	Attachments []types.Attachment `json:"attachments"`
+}
+
+// loadAttachments loads the images listed in a message. Returns nil without attachments.
+func (s *AgentService) loadAttachments(ctx context.Context, publicKey string, ids []uuid.UUID) ([]attachment.Image, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if s.attachments == nil {
+		return nil, ErrAttachmentsDisabled
+	}
+	return s.attachments.Load(ctx, publicKey, ids)
+}
+
+// attachmentMetadata returns the metadata recording images on a user message, or nil
+// without images.
+func attachmentMetadata(images []attachment.Image) json.RawMessage {
+	if len(images) == 0 {
+		return nil
+	}
+	meta := attachmentsMeta{Attachments: make([]types.Attachment, len(images))}
+	for i, img := range images {
+		meta.Attachments[i] = img.Attachment
+	}
+	data, _ := json.Marshal(meta)
+	return data
+}
+
+// attachmentIDs returns the IDs of the images recorded on a user message.
+func attachmentIDs(msg *types.Message) []uuid.UUID {
+	var meta attachmentsMeta
+	if len(msg.Metadata) == 0 || json.Unmarshal(msg.Metadata, &meta) != nil {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(meta.Attachments))
+	for i, a := range meta.Attachments {
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+// withImages puts images in front of the text of the last message, which is the user turn
+// being answered. Images go first, as the model reads them best that way.
+func withImages(msgs []anthropic.Message, images []attachment.Image) []anthropic.Message {
+	if len(images) == 0 || len(msgs) == 0 {
+		return msgs
+	}
+	last := &msgs[len(msgs)-1]
+	blocks := make([]any, 0, len(images)+1)
+	for _, img := range images {
+		blocks = append(blocks, anthropic.NewImageBlock(img.ContentType, img.Data))
+	}
+	switch content := last.Content.(type) {
+	case string:
+		if content != "" {
+			blocks = append(blocks, anthropic.NewTextBlock(content))
+		}
+	case []any:
+		blocks = append(blocks, content...)
+	default:
+		blocks = append(blocks, content)
+	}
+	last.Content = blocks
+	return msgs
+}
+
+// countImages returns how many image blocks a request carries.
+func countImages(req *anthropic.Request) int {
+	n := 0
+	for _, msg := range req.Messages {
+		blocks, ok := msg.Content.([]any)
+		if !ok {
+			continue
+		}
+		for _, block := range blocks {
+			if _, ok := block.(anthropic.ImageBlock); ok {
+				n++
+			}
+		}
+	}
+	return n
+}
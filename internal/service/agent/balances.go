@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/vultisig/agent-backend/internal/numfmt"
+)
+
+// maxPromptDecimals caps the fractional digits of balance amounts rendered into prompts.
+const maxPromptDecimals = 8
+
+// stablecoinSymbols are valued at $1 per unit when estimating balance value.
+var stablecoinSymbols = map[string]bool{
+	"USDC": true, "USDT": true, "DAI": true, "BUSD": true, "TUSD": true, "USDP": true,
+	"FDUSD": true, "PYUSD": true, "USDE": true, "USDS": true, "FRAX": true, "LUSD": true, "GUSD": true,
+}
+
+// maxUnverifiedBalances caps how many unrecognized assets are listed in prompts.
+const maxUnverifiedBalances = 10
+
+const (
+	// maxActivityItems caps how many recent activity entries are rendered into prompts.
+	maxActivityItems = 10
+	// maxActivitySummaryLength caps each rendered activity summary, in characters.
+	maxActivitySummaryLength = 200
+	// maxActivityTypeLength caps the rendered activity type label, in characters.
+	maxActivityTypeLength = 20
+)
+
+// PromptBalances is the bounded, partitioned view of a wallet's balances rendered into prompts.
+type PromptBalances struct {
+	// Verified are recognized assets the agent may act on, highest estimated value first.
+	Verified []Balance
+	// More is how many verified balances were left out by the cap.
+	More int
+	// Unverified are assets not on the known-token list (possible spam or airdrops).
+	Unverified []Balance
+	// MoreUnverified is how many unverified balances were left out by the cap.
+	MoreUnverified int
+}
+
+// promptBalances prepares balances for prompt rendering: zero balances are dropped, amounts
+// normalized, unrecognized assets split out, and verified ones ordered by estimated USD value
+// and capped at s.maxPromptBalances. The caller's slice is not modified, so the full list stays
+// available for amount conversion and sufficiency checks.
+func (s *AgentService) promptBalances(balances []Balance) PromptBalances {
+	type ranked struct {
+		balance  Balance
+		amount   float64
+		usd      float64
+		hasValue bool
+	}
+
+	var verified, unverified []ranked
+	for _, b := range balances {
+		amount, ok := parseAmount(b.Amount)
+		if ok && amount.Sign() == 0 {
+			continue
+		}
+
+		item := ranked{balance: b}
+		item.balance.Amount = normalizeAmount(b.Amount)
+		if ok {
+			item.amount, _ = amount.Float64()
+		}
+		if !isRecognizedAsset(b) {
+			unverified = append(unverified, item)
+			continue
+		}
+		if ok {
+			item.usd, item.hasValue = estimateUSDValue(b, item.amount)
+		}
+		verified = append(verified, item)
+	}
+
+	// Valued balances first (highest USD first), then unvalued ones by raw amount
+	sort.SliceStable(verified, func(i, j int) bool {
+		a, b := verified[i], verified[j]
+		if a.hasValue != b.hasValue {
+			return a.hasValue
+		}
+		if a.hasValue {
+			return a.usd > b.usd
+		}
+		return a.amount > b.amount
+	})
+	sort.SliceStable(unverified, func(i, j int) bool {
+		return unverified[i].amount > unverified[j].amount
+	})
+
+	var result PromptBalances
+	if s.maxPromptBalances > 0 && len(verified) > s.maxPromptBalances {
+		result.More = len(verified) - s.maxPromptBalances
+		verified = verified[:s.maxPromptBalances]
+	}
+	if len(unverified) > maxUnverifiedBalances {
+		result.MoreUnverified = len(unverified) - maxUnverifiedBalances
+		unverified = unverified[:maxUnverifiedBalances]
+	}
+
+	for _, item := range verified {
+		result.Verified = append(result.Verified, item.balance)
+	}
+	for _, item := range unverified {
+		result.Unverified = append(result.Unverified, item.balance)
+	}
+	return result
+}
+
+// estimateUSDValue returns the estimated USD value of a recognized balance when it can be
+// determined. Without a price source only stablecoins can be valued.
+func estimateUSDValue(b Balance, amount float64) (float64, bool) {
+	if stablecoinSymbols[strings.ToUpper(b.Symbol)] {
+		return amount, true
+	}
+	return 0, false
+}
+
+// parseAmount parses a human-readable decimal amount.
+func parseAmount(amount string) (*big.Rat, bool) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(amount))
+	return r, ok
+}
+
+// normalizeAmount trims trailing zeros and caps decimal places for prompt display.
+// e.g. "1.500000000000000000" becomes "1.5" and "0.123456789123" becomes "0.12345678".
+func normalizeAmount(amount string) string {
+	amount = strings.TrimSpace(amount)
+	whole, frac, hasFrac := strings.Cut(amount, ".")
+	if !hasFrac {
+		return amount
+	}
+	if len(frac) > maxPromptDecimals {
+		frac = frac[:maxPromptDecimals]
+	}
+	frac = strings.TrimRight(frac, "0")
+	if whole == "" {
+		whole = "0"
+	}
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
+
+// amountFormatter formats amounts in backend-written text for the locale in the message's
+// wallet context, or the configured default.
+func (s *AgentService) amountFormatter(mc *MessageContext) numfmt.Formatter {
+	locale := s.defaultLocale
+	if mc != nil && mc.Locale != "" {
+		locale = mc.Locale
+	}
+	return numfmt.New(locale, s.amountPrecision)
+}
+
+// assetClass picks the display precision class for an asset symbol.
+func assetClass(symbol string) numfmt.Class {
+	if stablecoinSymbols[strings.ToUpper(symbol)] {
+		return numfmt.Stablecoin
+	}
+	return numfmt.Crypto
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// whaleBalances returns a 500-balance wallet: zero balances, USDC, native BTC and SOL, and
+// spam tokens, in that rotation.
+func whaleBalances() []Balance {
+	balances := make([]Balance, 500)
+	for i := range balances {
+		switch i % 5 {
+		case 0:
+			balances[i] = Balance{Chain: "Ethereum", Symbol: "ETH", Amount: "0.000000"}
+		case 1:
+			balances[i] = Balance{Chain: "Ethereum", Asset: "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", Symbol: "USDC", Amount: fmt.Sprintf("%d.500000000000000000", i)}
+		case 2:
+			balances[i] = Balance{Chain: "Bitcoin", Symbol: "BTC", Amount: fmt.Sprintf("0.%08d", i)}
+		case 3:
+			balances[i] = Balance{Chain: "Ethereum", Asset: fmt.Sprintf("0x%040x", i), Symbol: fmt.Sprintf("AIRDROP%d", i), Amount: "1000000"}
+		case 4:
+			balances[i] = Balance{Chain: "Solana", Symbol: "SOL", Amount: fmt.Sprintf("%d.123456789123", i)}
+		}
+	}
+	return balances
+}
+
+func TestPromptBalancesBounded(t *testing.T) {
+	s := &AgentService{maxPromptBalances: 40}
+	balances := whaleBalances()
+	original := slices.Clone(balances)
+
+	pb := s.promptBalances(balances)
+
+	// 300 verified and 100 unverified balances; the 100 zero balances are dropped
+	if len(pb.Verified) != 40 || pb.More != 260 {
+		t.Errorf("verified = %d plus %d more, want 40 plus 260", len(pb.Verified), pb.More)
+	}
+	if len(pb.Unverified) != maxUnverifiedBalances || pb.MoreUnverified != 100-maxUnverifiedBalances {
+		t.Errorf("unverified = %d plus %d more, want %d plus %d", len(pb.Unverified), pb.MoreUnverified, maxUnverifiedBalances, 100-maxUnverifiedBalances)
+	}
+	// Stablecoins are the only balances valued without prices, so they lead, largest first
+	if top := pb.Verified[0]; top.Symbol != "USDC" || top.Amount != "496.5" {
+		t.Errorf("top balance = %s %s, want USDC 496.5", top.Symbol, top.Amount)
+	}
+	for i := 1; i < len(pb.Verified); i++ {
+		if pb.Verified[i].Symbol != "USDC" {
+			t.Fatalf("balance %d = %s, want the USDC balances to fill the cap", i, pb.Verified[i].Symbol)
+		}
+	}
+
+	section := BuildWalletContext(pb, nil, nil)
+	if len(section) > 4096 {
+		t.Errorf("wallet context is %d bytes for 500 balances, want at most 4096", len(section))
+	}
+	for _, want := range []string{"- ...plus 260 more assets\n", "- ...plus 90 more assets\n"} {
+		if !strings.Contains(section, want) {
+			t.Errorf("wallet context lacks %q", want)
+		}
+	}
+	if strings.Contains(section, "0.000000") || strings.Contains(section, ".500000") {
+		t.Errorf("wallet context has zero balances or unnormalized amounts:\n%s", section)
+	}
+
+	// The full list stays intact for amount conversion and sufficiency checks
+	if !slices.Equal(balances, original) {
+		t.Error("promptBalances() modified the caller's balances")
+	}
+}
+
+func TestPromptBalancesUncapped(t *testing.T) {
+	s := &AgentService{}
+	pb := s.promptBalances(whaleBalances())
+	if len(pb.Verified) != 300 || pb.More != 0 {
+		t.Errorf("verified = %d plus %d more, want all 300 without a cap", len(pb.Verified), pb.More)
+	}
+}
+
+func TestNormalizeAmount(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   string
+	}{
+		{amount: "1.500000000000000000", want: "1.5"},
+		{amount: "0.123456789123", want: "0.12345678"},
+		{amount: "2.000", want: "2"},
+		{amount: ".25", want: "0.25"},
+		{amount: "  42 ", want: "42"},
+		{amount: "0.000000001", want: "0"},
+	}
+	for _, tt := range tests {
+		if got := normalizeAmount(tt.amount); got != tt.want {
+			t.Errorf("normalizeAmount(%q) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// validBlocks returns blocks if they all validate. Invalid blocks are dropped as a group and
+// logged; the message content remains the fallback the app renders.
+func (s *AgentService) validBlocks(blocks []types.Block) []types.Block {
+	if err := types.ValidateBlocks(blocks); err != nil {
+		s.logger.WithError(err).Warn("dropping invalid message blocks")
+		return nil
+	}
+	return blocks
+}
+
+// policyPreviewBlock summarizes a prepared policy: the configuration as rows and the
+// PolicySuggest rules with their fixed constraints.
+func policyPreviewBlock(suggestion Suggestion, configuration map[string]any, policySuggest *verifier.PolicySuggest) types.Block {
+	block := types.Block{
+		Type:     types.BlockTypePolicyPreview,
+		Title:    suggestion.Title,
+		PluginID: suggestion.PluginID,
+		Rows:     flattenConfiguration("", configuration, nil),
+	}
+
+	if policySuggest == nil {
+		return block
+	}
+	for _, r := range policySuggest.Rules {
+		rule := types.RulePreview{
+			Resource: r.Resource,
+			Effect:   r.Effect,
+		}
+		if r.Target != nil {
+			rule.Target = r.Target.Address
+		}
+		for _, pc := range r.ParameterConstraints {
+			value := pc.Constraint.FixedValue
+			if value == "" {
+				value = pc.Constraint.Type
+			}
+			rule.Constraints = append(rule.Constraints, types.KeyValue{Key: pc.ParameterName, Value: value})
+		}
+		block.Rules = append(block.Rules, rule)
+	}
+	if policySuggest.MaxTxsPerWindow > 0 {
+		block.Rows = append(block.Rows, types.KeyValue{
+			Key:   "rate limit",
+			Value: fmt.Sprintf("%d txs per %ds", policySuggest.MaxTxsPerWindow, policySuggest.RateLimitWindow),
+		})
+	}
+	return block
+}
+
+// actionSummaryBlock summarizes an action result reported by the app.
+func actionSummaryBlock(result *ActionResult, nextSteps []string) types.Block {
+	status := "succeeded"
+	if !result.Success {
+		status = "failed"
+	}
+	rows := []types.KeyValue{
+		{Key: "action", Value: result.Action},
+		{Key: "status", Value: status},
+	}
+	if result.Error != "" {
+		rows = append(rows, types.KeyValue{Key: "error", Value: result.Error})
+	}
+	for i, step := range nextSteps {
+		rows = append(rows, types.KeyValue{Key: "next step " + strconv.Itoa(i+1), Value: step})
+	}
+	return types.Block{
+		Type:  types.BlockTypeKeyValueTable,
+		Title: "Action summary",
+		Rows:  rows,
+	}
+}
+
+// flattenConfiguration renders a configuration map as rows with dotted keys, sorted by key.
+func flattenConfiguration(prefix string, config map[string]any, rows []types.KeyValue) []types.KeyValue {
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := config[k].(map[string]any); ok {
+			rows = flattenConfiguration(key, nested, rows)
+			continue
+		}
+		rows = append(rows, types.KeyValue{Key: key, Value: formatConfigValue(config[k])})
+	}
+	return rows
+}
+
+func formatConfigValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case []any:
+		parts := make([]string, len(val))
+		for i, item := range val {
+			parts[i] = formatConfigValue(item)
+		}
+		return strings.Join(parts, ", ")
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprint(val)
+		}
+		return string(b)
+	}
+}
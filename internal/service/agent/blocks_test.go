@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite golden files in testdata")
+
+func TestPolicyPreviewBlockGolden(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "dca_policy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixture struct {
+		Configuration map[string]any          `json:"configuration"`
+		PolicySuggest *verifier.PolicySuggest `json:"policy_suggest"`
+	}
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		t.Fatalf("decode fixture: %v", err)
+	}
+
+	suggestion := Suggestion{ID: "sugg-1", PluginID: testPluginID, Title: "Weekly ETH to BTC"}
+	block := policyPreviewBlock(suggestion, fixture.Configuration, fixture.PolicySuggest)
+	if err := types.ValidateBlocks([]types.Block{block}); err != nil {
+		t.Fatalf("policy preview block is invalid: %v", err)
+	}
+
+	got, err := json.MarshalIndent(block, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = append(got, '\n')
+
+	golden := filepath.Join("testdata", "dca_policy_preview.golden.json")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("policy preview block differs from %s:\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
@@ -0,0 +1,226 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// Bulk conversation operations.
+const (
+	BulkArchive        = "archive"
+	BulkRestore        = "restore"
+	BulkDeleteArchived = "delete_archived"
+)
+
+// Per-item statuses of a bulk operation.
+const (
+	BulkStatusArchived = "archived"
+	BulkStatusRestored = "restored"
+	BulkStatusDeleted  = "deleted"
+	// BulkStatusSkipped means the conversation wasn't changed: it doesn't exist, belongs to
+	// someone else, or isn't in a state the operation applies to
+	BulkStatusSkipped = "skipped"
+)
+
+const (
+	// MaxBulkIDs caps how many conversation IDs one bulk request may list.
+	MaxBulkIDs = 100
+	// bulkBatchSize is how many conversations one statement changes; each batch commits
+	// on its own.
+	bulkBatchSize = 100
+	// maxBulkBatches caps the batches one older_than request runs. More is set on the
+	// response when conversations may be left, so the client can send the request again.
+	maxBulkBatches = 10
+	// bulkKeyPrefix is the Redis key prefix counting a user's bulk requests.
+	bulkKeyPrefix = "bulk_requests:"
+	// bulkWindow is the period bulk requests are counted over.
+	bulkWindow = time.Minute
+)
+
+// ErrBulkRateLimited is returned when a user runs too many bulk operations.
+var ErrBulkRateLimited = errors.New("too many bulk operations, try again in a minute")
+
+// BulkConversationsRequest is the request body for a bulk conversation operation. Exactly
+// one of IDs and OlderThan picks the conversations. For archive, OlderThan is compared with
+// the conversation's last activity; for restore and delete_archived, with its archive time.
+type BulkConversationsRequest struct {
+	PublicKey string      `json:"public_key"`
+	Operation string      `json:"operation"`
+	IDs       []uuid.UUID `json:"ids,omitempty"`
+	OlderThan *time.Time  `json:"older_than,omitempty"`
+}
+
+// BulkConversationsResponse reports what a bulk operation did to each conversation.
+type BulkConversationsResponse struct {
+	Operation string           `json:"operation"`
+	Results   []BulkItemResult `json:"results"`
+	Counts    BulkCounts       `json:"counts"`
+	// More is set when an older_than request stopped at its batch cap and conversations may
+	// be left; sending the same request again continues
+	More bool `json:"more,omitempty"`
+}
+
+// BulkItemResult is the outcome of a bulk operation for one conversation.
+type BulkItemResult struct {
+	ID     uuid.UUID `json:"id"`
+	Status string    `json:"status"`
+}
+
+// BulkCounts totals the outcomes of a bulk operation.
+type BulkCounts struct {
+	Succeeded int `json:"succeeded"`
+	Skipped   int `json:"skipped"`
+}
+
+// BulkValidationError is returned when a bulk request is rejected. Fields maps each invalid
+// request field to what is wrong with it.
+type BulkValidationError struct {
+	Fields map[string]string
+}
+
+func (e *BulkValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + e.Fields[name]
+	}
+	return "invalid bulk request: " + strings.Join(parts, "; ")
+}
+
+// BulkConversations runs a bulk operation over the user's conversations. Every statement is
+// scoped to req.PublicKey, so IDs of other users' conversations are reported as skipped.
+// Conversations are changed in batches that each commit on their own; if a batch fails,
+// the earlier ones stay applied and sending the request again picks up the rest.
+func (s *AgentService) BulkConversations(ctx context.Context, req *BulkConversationsRequest) (*BulkConversationsResponse, error) {
+	if err := validateBulkRequest(req, time.Now()); err != nil {
+		return nil, err
+	}
+
+	n, err := s.redis.Incr(ctx, bulkKeyPrefix+req.PublicKey, bulkWindow)
+	if err != nil {
+		s.logger.WithError(err).Warn("failed to count bulk request")
+	} else if n > int64(s.bulkPerMinute) {
+		return nil, ErrBulkRateLimited
+	}
+
+	var apply func(ctx context.Context, publicKey string, filter types.BulkFilter, limit int) ([]uuid.UUID, error)
+	var status string
+	switch req.Operation {
+	case BulkArchive:
+		apply, status = s.convRepo.BulkArchive, BulkStatusArchived
+	case BulkRestore:
+		apply, status = s.convRepo.BulkRestore, BulkStatusRestored
+	case BulkDeleteArchived:
+		apply, status = s.convRepo.BulkDeleteArchived, BulkStatusDeleted
+	}
+
+	resp := &BulkConversationsResponse{Operation: req.Operation, Results: []BulkItemResult{}}
+	if len(req.IDs) > 0 {
+		ids := uniqueIDs(req.IDs)
+		changed, err := apply(ctx, req.PublicKey, types.BulkFilter{IDs: ids}, len(ids))
+		if err != nil {
+			return nil, fmt.Errorf("%s conversations: %w", req.Operation, err)
+		}
+		for _, id := range ids {
+			result := BulkItemResult{ID: id, Status: BulkStatusSkipped}
+			if slices.Contains(changed, id) {
+				result.Status = status
+			}
+			resp.add(result)
+		}
+	} else {
+		filter := types.BulkFilter{OlderThan: req.OlderThan}
+		for batch := 0; batch < maxBulkBatches; batch++ {
+			// Changed conversations stop matching the filter, so each batch picks up new ones
+			changed, err := apply(ctx, req.PublicKey, filter, bulkBatchSize)
+			if err != nil {
+				return nil, fmt.Errorf("%s conversations: %w", req.Operation, err)
+			}
+			for _, id := range changed {
+				resp.add(BulkItemResult{ID: id, Status: status})
+			}
+			if len(changed) < bulkBatchSize {
+				break
+			}
+			resp.More = batch == maxBulkBatches-1
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"operation": req.Operation,
+		"succeeded": resp.Counts.Succeeded,
+		"skipped":   resp.Counts.Skipped,
+		"more":      resp.More,
+	}).Info("bulk conversation operation")
+	return resp, nil
+}
+
+// add records one conversation's outcome and counts it.
+func (r *BulkConversationsResponse) add(result BulkItemResult) {
+	r.Results = append(r.Results, result)
+	if result.Status == BulkStatusSkipped {
+		r.Counts.Skipped++
+	} else {
+		r.Counts.Succeeded++
+	}
+}
+
+// validateBulkRequest checks a bulk request, collecting a message for each invalid field.
+// IDs and OlderThan together are rejected rather than guessing whether they narrow or
+// widen each other.
+func validateBulkRequest(req *BulkConversationsRequest, now time.Time) error {
+	fields := map[string]string{}
+	switch req.Operation {
+	case BulkArchive, BulkRestore, BulkDeleteArchived:
+	case "":
+		fields["operation"] = "operation is required"
+	default:
+		fields["operation"] = fmt.Sprintf("operation must be %s, %s or %s", BulkArchive, BulkRestore, BulkDeleteArchived)
+	}
+
+	switch {
+	case len(req.IDs) > 0 && req.OlderThan != nil:
+		fields["ids"] = "ids can't be combined with older_than"
+		fields["older_than"] = "older_than can't be combined with ids"
+	case len(req.IDs) == 0 && req.OlderThan == nil:
+		fields["ids"] = "ids or older_than is required"
+		fields["older_than"] = "older_than or ids is required"
+	case len(req.IDs) > MaxBulkIDs:
+		fields["ids"] = fmt.Sprintf("at most %d ids can be given", MaxBulkIDs)
+	case slices.Contains(req.IDs, uuid.Nil):
+		fields["ids"] = "ids must not contain the nil UUID"
+	case req.OlderThan != nil && req.OlderThan.After(now):
+		fields["older_than"] = "older_than must not be in the future"
+	}
+
+	if len(fields) > 0 {
+		return &BulkValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// uniqueIDs returns ids without repeats, in their first-seen order.
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
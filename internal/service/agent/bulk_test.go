@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestValidateBulkRequest(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-24*time.Hour), now.Add(time.Hour)
+	ids := func(n int) []uuid.UUID {
+		out := make([]uuid.UUID, n)
+		for i := range out {
+			out[i] = uuid.New()
+		}
+		return out
+	}
+
+	tests := []struct {
+		name string
+		req  BulkConversationsRequest
+		// wantFields are the fields reported invalid, none when the request is valid
+		wantFields []string
+	}{
+		{name: "ids", req: BulkConversationsRequest{Operation: BulkArchive, IDs: ids(3)}},
+		{name: "older than", req: BulkConversationsRequest{Operation: BulkDeleteArchived, OlderThan: &past}},
+		{name: "ids at the cap", req: BulkConversationsRequest{Operation: BulkRestore, IDs: ids(MaxBulkIDs)}},
+		{name: "ids and older than together", req: BulkConversationsRequest{Operation: BulkArchive, IDs: ids(1), OlderThan: &past}, wantFields: []string{"ids", "older_than"}},
+		{name: "neither ids nor older than", req: BulkConversationsRequest{Operation: BulkArchive}, wantFields: []string{"ids", "older_than"}},
+		{name: "too many ids", req: BulkConversationsRequest{Operation: BulkArchive, IDs: ids(MaxBulkIDs + 1)}, wantFields: []string{"ids"}},
+		{name: "nil id", req: BulkConversationsRequest{Operation: BulkArchive, IDs: []uuid.UUID{uuid.New(), uuid.Nil}}, wantFields: []string{"ids"}},
+		{name: "older than in the future", req: BulkConversationsRequest{Operation: BulkArchive, OlderThan: &future}, wantFields: []string{"older_than"}},
+		{name: "missing operation", req: BulkConversationsRequest{IDs: ids(1)}, wantFields: []string{"operation"}},
+		{name: "unknown operation", req: BulkConversationsRequest{Operation: "delete", IDs: ids(1)}, wantFields: []string{"operation"}},
+		{name: "every field wrong", req: BulkConversationsRequest{Operation: "purge"}, wantFields: []string{"ids", "older_than", "operation"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBulkRequest(&tt.req, now)
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Fatalf("validateBulkRequest() error = %v, want none", err)
+				}
+				return
+			}
+			var invalid *BulkValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("validateBulkRequest() error = %v, want a BulkValidationError", err)
+			}
+			var fields []string
+			for field := range invalid.Fields {
+				fields = append(fields, field)
+			}
+			slices.Sort(fields)
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+// bulkStore archives every ID it is given, counting the calls.
+type bulkStore struct {
+	ConversationStore
+	calls int
+}
+
+func (f *bulkStore) BulkArchive(_ context.Context, _ string, filter types.BulkFilter, _ int) ([]uuid.UUID, error) {
+	f.calls++
+	return filter.IDs, nil
+}
+
+func TestBulkConversationsRateLimit(t *testing.T) {
+	store := &bulkStore{}
+	svc := &AgentService{convRepo: store, redis: newFakeCache(), logger: testLogger(), bulkPerMinute: 2}
+	ctx := context.Background()
+	request := func(publicKey string, ids ...uuid.UUID) error {
+		_, err := svc.BulkConversations(ctx, &BulkConversationsRequest{PublicKey: publicKey, Operation: BulkArchive, IDs: ids})
+		return err
+	}
+
+	// Rejected requests don't count against the limit
+	var invalid *BulkValidationError
+	if err := request(testOwner); !errors.As(err, &invalid) {
+		t.Fatalf("request without ids: error = %v, want a validation error", err)
+	}
+	for i := range 2 {
+		if err := request(testOwner, uuid.New()); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if err := request(testOwner, uuid.New()); !errors.Is(err, ErrBulkRateLimited) {
+		t.Fatalf("request past the limit: error = %v, want ErrBulkRateLimited", err)
+	}
+	if store.calls != 2 {
+		t.Errorf("repository called %d times, want 2: a limited request must not reach it", store.calls)
+	}
+
+	// The limit is per user
+	if err := request(testStranger, uuid.New()); err != nil {
+		t.Errorf("another user's request: %v", err)
+	}
+}
+
+// foreignBulkStore archives only the first ID it is given, as if the others belonged to
+// someone else.
+type foreignBulkStore struct {
+	ConversationStore
+}
+
+func (f *foreignBulkStore) BulkArchive(_ context.Context, _ string, filter types.BulkFilter, _ int) ([]uuid.UUID, error) {
+	return filter.IDs[:1], nil
+}
+
+func TestBulkConversationsSkipsUnchanged(t *testing.T) {
+	svc := &AgentService{convRepo: &foreignBulkStore{}, redis: newFakeCache(), logger: testLogger(), bulkPerMinute: 10}
+	own, foreign := uuid.New(), uuid.New()
+
+	resp, err := svc.BulkConversations(context.Background(), &BulkConversationsRequest{
+		PublicKey: testOwner,
+		Operation: BulkArchive,
+		IDs:       []uuid.UUID{own, foreign, own},
+	})
+	if err != nil {
+		t.Fatalf("BulkConversations() error = %v", err)
+	}
+	want := []BulkItemResult{{ID: own, Status: BulkStatusArchived}, {ID: foreign, Status: BulkStatusSkipped}}
+	if !reflect.DeepEqual(resp.Results, want) {
+		t.Errorf("results = %+v, want %+v", resp.Results, want)
+	}
+	if resp.Counts != (BulkCounts{Succeeded: 1, Skipped: 1}) {
+		t.Errorf("counts = %+v, want 1 succeeded and 1 skipped", resp.Counts)
+	}
+}
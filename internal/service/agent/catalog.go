@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// installedLookupTimeout bounds the verifier call made to mark installed plugins; the
+// catalog is still returned, without installation state, when it runs out.
+const installedLookupTimeout = 2 * time.Second
+
+// maxPluginDescription caps catalog descriptions taken from skills.md, in runes.
+const maxPluginDescription = 280
+
+// PluginInfo is a plugin as the agent sees it, for rendering what the assistant can automate.
+type PluginInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Installed is omitted when the user's installed plugins couldn't be looked up
+	Installed *bool `json:"installed,omitempty"`
+}
+
+// ListPlugins returns the plugins the agent currently knows about, from the same skills
+// cache used to build prompts. With an access token the user's installed plugins are
+// looked up too, and cached for annotating suggestions; if that fails the catalog is
+// returned without installation state.
+func (s *AgentService) ListPlugins(ctx context.Context, publicKey, accessToken string) []PluginInfo {
+	if s.pluginProvider == nil {
+		return []PluginInfo{}
+	}
+	skills := s.pluginProvider.GetSkills(ctx)
+
+	var installed map[string]bool
+	if accessToken != "" && s.verifier != nil && len(skills) > 0 {
+		installed = s.installedPluginSet(ctx, publicKey, accessToken)
+	}
+
+	plugins := make([]PluginInfo, 0, len(skills))
+	for _, skill := range skills {
+		info := PluginInfo{
+			ID:          skill.PluginID,
+			Name:        skill.Name,
+			Description: skillsSummary(skill.Skills),
+		}
+		if installed != nil {
+			isInstalled := installed[skill.PluginID]
+			info.Installed = &isInstalled
+		}
+		plugins = append(plugins, info)
+	}
+	return plugins
+}
+
+// installedPluginSet returns the IDs of the user's installed plugins, or nil on failure.
+func (s *AgentService) installedPluginSet(ctx context.Context, publicKey, accessToken string) map[string]bool {
+	ctx, cancel := context.WithTimeout(ctx, installedLookupTimeout)
+	defer cancel()
+
+	ids, err := s.verifier.InstalledPluginIDs(ctx, accessToken)
+	if err != nil {
+		s.logger.WithError(err).Warn("failed to look up installed plugins for catalog")
+		return nil
+	}
+	s.cacheInstalledPlugins(ctx, publicKey, ids)
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// skillsSummary returns the first prose paragraph of a skills.md document: headings, YAML
+// front matter, code blocks and horizontal rules are skipped, lines of the paragraph are
+// joined and the result is cut at a word boundary past maxPluginDescription runes.
+func skillsSummary(md string) string {
+	lines := strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n")
+
+	// YAML front matter opens with --- on the first line
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "---" {
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+
+	var paragraph []string
+	inCode := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		skip := trimmed == "" || strings.HasPrefix(trimmed, "#") ||
+			strings.Trim(trimmed, "-*_ ") == "" || strings.HasPrefix(trimmed, "<!--")
+		if skip {
+			if len(paragraph) > 0 {
+				break
+			}
+			continue
+		}
+		paragraph = append(paragraph, trimmed)
+	}
+
+	return truncateWords(strings.Join(paragraph, " "), maxPluginDescription)
+}
+
+// truncateWords cuts s to at most limit runes, at the last space when there is one, and
+// marks the cut with an ellipsis.
+func truncateWords(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	cut := string(runes[:limit])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,;:.") + "…"
+}
@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSkillsSummary(t *testing.T) {
+	long := strings.Repeat("Buys a fixed amount of any token on a schedule, ", 10)
+
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{
+			name: "first paragraph after the title",
+			md:   "# Recurring Swaps\n\nBuys a fixed amount of a token\non a schedule.\n\nSecond paragraph.",
+			want: "Buys a fixed amount of a token on a schedule.",
+		},
+		{
+			name: "front matter skipped",
+			md:   "---\nname: dca\nversion: 2\n---\n\n# DCA\n\nBuys on a schedule.",
+			want: "Buys on a schedule.",
+		},
+		{
+			name: "code, rules and comments skipped",
+			md:   "<!-- generated -->\n## Setup\n\n```json\n{\"asset\": \"ETH\"}\n```\n\n---\n\nPays recipients monthly.\n",
+			want: "Pays recipients monthly.",
+		},
+		{
+			name: "windows line endings",
+			md:   "# Payroll\r\n\r\nPays recipients\r\nmonthly.\r\n\r\nMore.",
+			want: "Pays recipients monthly.",
+		},
+		{
+			name: "headings only",
+			md:   "# Payroll\n\n## Parameters\n",
+			want: "",
+		},
+		{
+			name: "long paragraph cut at a word",
+			md:   "# DCA\n\n" + long,
+			want: truncateWords(strings.TrimSpace(long), maxPluginDescription),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := skillsSummary(tt.md); got != tt.want {
+				t.Errorf("skillsSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncateWords(t *testing.T) {
+	tests := []struct {
+		s     string
+		limit int
+		want  string
+	}{
+		{s: "Buys on a schedule.", limit: 40, want: "Buys on a schedule."},
+		{s: "Buys on a schedule, weekly.", limit: 20, want: "Buys on a schedule…"},
+		{s: "Kauft wöchentlich Ether für dich", limit: 20, want: "Kauft wöchentlich…"},
+		{s: "Supercalifragilistic", limit: 5, want: "Super…"},
+	}
+	for _, tt := range tests {
+		got := truncateWords(tt.s, tt.limit)
+		if got != tt.want {
+			t.Errorf("truncateWords(%q, %d) = %q, want %q", tt.s, tt.limit, got, tt.want)
+		}
+		// The limit counts characters, before the ellipsis
+		if n := utf8.RuneCountInString(strings.TrimSuffix(got, "…")); n > tt.limit {
+			t.Errorf("truncateWords(%q, %d) kept %d characters", tt.s, tt.limit, n)
+		}
+	}
+}
+
+func TestListPluginsDescriptions(t *testing.T) {
+	s := &AgentService{
+		pluginProvider: &fakeSkillsProvider{skills: []PluginSkill{
+			{PluginID: testPluginID, Name: "DCA", Skills: "# DCA\n\nBuys a fixed amount on a schedule.\n\n## Parameters\n\n- asset"},
+		}},
+		logger: testLogger(),
+	}
+	plugins := s.ListPlugins(context.Background(), testOwner, "")
+	if len(plugins) != 1 {
+		t.Fatalf("ListPlugins() returned %d plugins, want 1", len(plugins))
+	}
+	want := PluginInfo{ID: testPluginID, Name: "DCA", Description: "Buys a fixed amount on a schedule."}
+	if plugins[0] != want {
+		t.Errorf("plugin = %+v, want %+v", plugins[0], want)
+	}
+
+	// Without plugins the catalog is an empty list, not null
+	if got := (&AgentService{}).ListPlugins(context.Background(), testOwner, ""); got == nil || len(got) != 0 {
+		t.Errorf("ListPlugins() without a provider = %#v, want an empty list", got)
+	}
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+)
+
+// oversizedConfiguration returns a payroll configuration whose recipient list and notes
+// push it far past maxPolicyMetadataBytes, around small key fields.
+func oversizedConfiguration() map[string]any {
+	recipients := make([]any, 2000)
+	for i := range recipients {
+		recipients[i] = map[string]any{"name": fmt.Sprintf("employee-%d", i), "amount": "10"}
+	}
+	return map[string]any{
+		"asset":      "USDC",
+		"chain":      "Ethereum",
+		"frequency":  "monthly",
+		"recipients": recipients,
+		"notes":      strings.Repeat("n", 40000),
+		"schedule": map[string]any{
+			"start": "2026-11-01",
+			"memo":  strings.Repeat("m", 2000),
+		},
+	}
+}
+
+func TestCompactConfiguration(t *testing.T) {
+	configuration := oversizedConfiguration()
+	compact := compactConfiguration(configuration)
+
+	for _, key := range []string{"asset", "chain", "frequency"} {
+		if compact[key] != configuration[key] {
+			t.Errorf("%s = %v, want %v kept", key, compact[key], configuration[key])
+		}
+	}
+	if got := compact["recipients"]; got != "[2000 items omitted]" {
+		t.Errorf("recipients = %v, want a placeholder", got)
+	}
+	if notes := compact["notes"].(string); len(notes) != maxConfigValueBytes+len("...") {
+		t.Errorf("notes are %d bytes, want truncated to %d", len(notes), maxConfigValueBytes)
+	}
+	// Nested objects are compacted field by field
+	schedule := compact["schedule"].(map[string]any)
+	if schedule["start"] != "2026-11-01" || !strings.HasSuffix(schedule["memo"].(string), "...") {
+		t.Errorf("schedule = %v, want start kept and memo truncated", schedule)
+	}
+	// The original is left intact for the immediate reply
+	if len(configuration["recipients"].([]any)) != 2000 || len(configuration["notes"].(string)) != 40000 {
+		t.Error("compactConfiguration() modified its input")
+	}
+}
+
+func TestBuildPolicyOversizedConfiguration(t *testing.T) {
+	convID := uuid.New()
+	cache := newFakeCache()
+	suggestion, _ := json.Marshal(Suggestion{ID: "sugg-1", PluginID: testPluginID, Title: "Monthly payroll", ConversationID: convID.String()})
+	_ = cache.Set(context.Background(), "sugg-1", string(suggestion), 0)
+	msgs := &fakeMessageStore{}
+	s := NewAgentService(Deps{
+		Anthropic:     &fakeModel{resp: toolReply(BuildPolicyTool.Name, map[string]any{"configuration": oversizedConfiguration()})},
+		Messages:      msgs,
+		Conversations: &fakeConversationStore{owner: testOwner},
+		Cache:         cache,
+		Outbox:        &fakeOutbox{cache: cache},
+		Verifier:      &fakeVerifier{schemas: map[string]*verifier.RecipeSchema{testPluginID: {}}, suggest: &verifier.PolicySuggest{}},
+		Logger:        testLogger(),
+	}, Settings{
+		Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+		Agent:   config.AgentConfig{PolicyMaxTokens: 1024},
+	})
+	id := "sugg-1"
+
+	resp, err := s.buildPolicy(context.Background(), convID, &SendMessageRequest{PublicKey: testOwner, SelectedSuggestionID: &id}, &conversationWindow{})
+	if err != nil {
+		t.Fatalf("buildPolicy() error = %v", err)
+	}
+
+	// The reply carries the full configuration for this turn
+	if resp.PolicyReady == nil {
+		t.Fatal("PolicyReady = nil, want the built policy")
+	}
+	recipients, _ := resp.PolicyReady.Configuration["recipients"].([]any)
+	notes, _ := resp.PolicyReady.Configuration["notes"].(string)
+	if len(recipients) != 2000 || len(notes) != 40000 {
+		t.Errorf("PolicyReady has %d recipients and %d bytes of notes, want the full configuration", len(recipients), len(notes))
+	}
+
+	// The stored row holds the compacted configuration and says so
+	stored := msgs.stored()
+	metadata := stored[len(stored)-1].Metadata
+	if len(metadata) > maxPolicyMetadataBytes {
+		t.Errorf("stored metadata is %d bytes, want at most %d", len(metadata), maxPolicyMetadataBytes)
+	}
+	var meta PolicyReadyMetadata
+	if err := json.Unmarshal(metadata, &meta); err != nil {
+		t.Fatalf("decode metadata: %v", err)
+	}
+	if !meta.ConfigurationCompacted {
+		t.Error("configuration_compacted not set on the stored metadata")
+	}
+	if meta.Configuration["asset"] != "USDC" || meta.Configuration["frequency"] != "monthly" || meta.Configuration["recipients"] != "[2000 items omitted]" {
+		t.Errorf("stored configuration = %v, want key fields kept and recipients omitted", meta.Configuration)
+	}
+}
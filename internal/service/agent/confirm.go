@@ -20,14 +20,14 @@ type ConfirmResponse struct {
 
 // confirmAction handles Ability 3: confirm action result.
 // Called when the frontend/mobile app reports the result of an action (e.g., policy created, install completed).
-func (s *AgentService) confirmAction(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, window *conversationWindow) (*SendMessageResponse, error) {
+func (s *AgentService) confirmAction(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, window *conversationWindow) (_ *SendMessageResponse, err error) {
 	if req.ActionResult == nil {
 		return nil, errors.New("action_result is required for action confirmation")
 	}
 
 	// 1. Build system prompt for action confirmation
 	basePrompt := BuildConfirmActionPrompt(req.ActionResult)
-	basePrompt += s.loadMemorySection(ctx, req.PublicKey) + MemoryManagementInstructions
+	basePrompt += s.memoryPrompt(ctx, req.PublicKey, window)
 	systemPrompt := BuildSystemPromptWithSummary(basePrompt, window.summary)
 
 	// 2. Build messages for Anthropic
@@ -35,10 +35,7 @@ func (s *AgentService) confirmAction(ctx context.Context, convID uuid.UUID, req
 
 	// Add synthetic user message describing the action result
 	actionMsg := buildActionResultMessage(req.ActionResult)
-	messages = append(messages, anthropic.Message{
-		Role:    "user",
-		Content: actionMsg,
-	})
+	messages = appendUserTurn(messages, actionMsg)
 
 	// 3. Store the user's action result as a message (marked as action_result so frontend can hide it)
 	userMsg := &types.Message{
@@ -46,73 +43,155 @@ func (s *AgentService) confirmAction(ctx context.Context, convID uuid.UUID, req
 		Role:           types.RoleUser,
 		Content:        actionMsg,
 		ContentType:    "action_result",
+		Metadata:       actionResultMetadata(req.ActionResult),
 	}
-	if err := s.msgRepo.Create(ctx, userMsg); err != nil {
+	if err := s.msgRepo.CreateIfOwned(ctx, userMsg, req.PublicKey); err != nil {
 		return nil, fmt.Errorf("store user message: %w", err)
 	}
+	noteWrite(ctx, userMsg)
+	s.resolvePolicyDraft(ctx, convID, req.ActionResult)
+	// From here on a failure would leave the action result unanswered
+	defer func() {
+		if err != nil {
+			s.storeErrorReply(ctx, convID, userMsg.ID, false)
+		}
+	}()
 
 	// 4. Call Anthropic with forced confirm_action + optional update_memory
 	tools := []anthropic.Tool{ConfirmActionTool}
-	tools = append(tools, s.memoryTools()...)
+	tools = append(tools, s.memoryTools(ctx, window)...)
 
 	anthropicReq := &anthropic.Request{
-		System:   systemPrompt,
-		Messages: messages,
-		Tools:    tools,
+		MaxTokens: s.abilityMaxTokens[abilityConfirm],
+		System:    systemPrompt,
+		Messages:  messages,
+		Tools:     tools,
 		ToolChoice: &anthropic.ToolChoice{
 			Type: "tool",
 			Name: "confirm_action",
 		},
 	}
 
-	resp, err := s.anthropic.SendMessage(ctx, anthropicReq)
+	resp, err := s.generate(ctx, abilityConfirm, anthropicReq)
 	if err != nil {
 		return nil, fmt.Errorf("call anthropic: %w", err)
 	}
 
 	// 5. Parse confirm_action (guaranteed by forced tool choice)
-	confirmResp, err := parseConfirmResponse(resp)
+	confirmResp, err := s.parseConfirmResponse(ctx, resp)
 	if err != nil {
 		return nil, fmt.Errorf("parse confirm response: %w", err)
 	}
 
-	// 6. Fire-and-forget: persist memory update if present
-	s.persistMemoryUpdate(ctx, req.PublicKey, s.extractMemoryUpdate(resp))
+	// 6. Persist memory update if present
+	memResult := s.persistMemoryUpdate(ctx, req.PublicKey, window, s.extractMemoryUpdate(ctx, abilityConfirm, resp))
 
-	// 7. Store assistant message in DB
+	// 7. Store assistant message in DB with an action summary card
+	blocks := s.validBlocks([]types.Block{actionSummaryBlock(req.ActionResult, confirmResp.NextSteps)})
+	content, truncated := s.processResponse(confirmResp.Response)
+	meta := map[string]any{}
+	if len(blocks) > 0 {
+		meta["blocks"] = blocks
+	}
+	if truncated {
+		meta["truncated"] = true
+	}
+	memResult.annotate(meta)
+	var metadata []byte
+	if len(meta) > 0 {
+		metadata, _ = json.Marshal(meta)
+	}
 	assistantMsg := &types.Message{
 		ConversationID: convID,
 		Role:           types.RoleAssistant,
-		Content:        confirmResp.Response,
+		Content:        content,
 		ContentType:    "text",
+		Metadata:       metadata,
+		Blocks:         blocks,
 	}
-	if err := s.msgRepo.Create(ctx, assistantMsg); err != nil {
+	if err := s.storeAssistantMessage(ctx, assistantMsg, nil); err != nil {
 		return nil, fmt.Errorf("store assistant message: %w", err)
 	}
 
-	// 8. Auto-continue: if install_plugin succeeded, check for pending policy build
+	// An install changes the user's installed plugins, so the cached set is stale
 	if req.ActionResult.Action == "install_plugin" && req.ActionResult.Success {
-		pendingKey := fmt.Sprintf("pending_build:%s", convID)
-		suggID, err := s.redis.Get(ctx, pendingKey)
+		s.forgetInstalledPlugins(ctx, req.PublicKey)
+	}
+
+	// 8. Auto-continue: if install_plugin succeeded, check for pending policy build
+	// The pending key is cleared by buildPolicy on success only, so a failed build can be retried.
+	// Nobody is waiting once the client has gone away, so no build is started then.
+	if req.ActionResult.Action == "install_plugin" && req.ActionResult.Success && ctx.Err() == nil {
+		suggID, err := s.redis.Get(ctx, pendingBuildKey(convID))
 		if err == nil && suggID != "" {
-			_ = s.redis.Delete(ctx, pendingKey)
 			buildReq := &SendMessageRequest{
 				SelectedSuggestionID: &suggID,
 				Context:              req.Context,
 				AccessToken:          req.AccessToken,
+				// Tells the build the plugin was just installed
+				ActionResult: req.ActionResult,
 			}
-			buildResp, err := s.buildPolicy(ctx, convID, buildReq, window)
+			buildResp, err := s.buildPolicyTracked(ctx, convID, buildReq, window)
 			if err != nil {
 				s.logger.WithError(err).Warn("auto-continue to buildPolicy failed")
-			} else {
-				buildResp.Message = *assistantMsg
-				return buildResp, nil
+				failResp, err := s.autoBuildFailedResponse(ctx, convID, suggID, assistantMsg)
+				if err != nil {
+					return nil, err
+				}
+				failResp.MemoryUpdated = memResult.Updated
+				failResp.MemorySections = memResult.Sections
+				return failResp, nil
 			}
+			// Non-policy outcomes (help, clarification) carry their own message as a follow-up
+			if buildResp.PolicyReady == nil {
+				followUp := buildResp.Message
+				buildResp.FollowUp = &followUp
+			}
+			buildResp.Message = *assistantMsg
+			buildResp.MemoryUpdated = memResult.Updated
+			buildResp.MemorySections = memResult.Sections
+			return buildResp, nil
 		}
 	}
 
 	return &SendMessageResponse{
-		Message: *assistantMsg,
+		Message:        *assistantMsg,
+		MemoryUpdated:  memResult.Updated,
+		MemorySections: memResult.Sections,
+	}, nil
+}
+
+// autoBuildFailedResponse stores an assistant message explaining that the policy could not be
+// prepared after the plugin was installed, and offers the pending suggestion again as a retry.
+func (s *AgentService) autoBuildFailedResponse(ctx context.Context, convID uuid.UUID, suggID string, confirmMsg *types.Message) (*SendMessageResponse, error) {
+	var suggestions []Suggestion
+	content := "The plugin is installed, but I couldn't prepare your automation just now. Please try again in a moment."
+	if sugg, err := s.getSuggestion(ctx, suggID); err == nil {
+		suggestions = []Suggestion{sugg}
+		content = fmt.Sprintf("The plugin is installed, but I couldn't prepare your %s just now. Tap below to try again.", sugg.Title)
+	}
+
+	metadata, _ := json.Marshal(map[string]any{
+		"type":        "auto_build_failed",
+		"error_code":  ErrorCodeAutoBuildFailed,
+		"suggestions": suggestions,
+	})
+	failureMsg := &types.Message{
+		ConversationID: convID,
+		Role:           types.RoleAssistant,
+		Content:        content,
+		ContentType:    "text",
+		Metadata:       metadata,
+	}
+	if err := s.storeAssistantMessage(ctx, failureMsg, nil); err != nil {
+		return nil, fmt.Errorf("store auto-build failure message: %w", err)
+	}
+
+	return &SendMessageResponse{
+		Message:     *confirmMsg,
+		FollowUp:    failureMsg,
+		Suggestions: suggestions,
+		ErrorCode:   ErrorCodeAutoBuildFailed,
 	}, nil
 }
 
@@ -127,12 +206,25 @@ func buildActionResultMessage(result *ActionResult) string {
 	return fmt.Sprintf("[Action failed: %s was not successful]", result.Action)
 }
 
+// ActionResultMetadata is the metadata of a stored action result, queried by user stats.
+type ActionResultMetadata struct {
+	Type    string `json:"type"` // "action_result"
+	Action  string `json:"action"`
+	Success bool   `json:"success"`
+}
+
+// actionResultMetadata encodes the structured form of an action result message.
+func actionResultMetadata(result *ActionResult) json.RawMessage {
+	metadata, _ := json.Marshal(ActionResultMetadata{Type: "action_result", Action: result.Action, Success: result.Success})
+	return metadata
+}
+
 // parseConfirmResponse extracts the confirm_action tool response from Claude's response.
-func parseConfirmResponse(resp *anthropic.Response) (*ConfirmResponse, error) {
+func (s *AgentService) parseConfirmResponse(ctx context.Context, resp *anthropic.Response) (*ConfirmResponse, error) {
 	for _, block := range resp.Content {
 		if block.Type == "tool_use" && block.Name == "confirm_action" {
 			var cr ConfirmResponse
-			if err := json.Unmarshal(block.Input, &cr); err != nil {
+			if err := s.parseToolInput(ctx, abilityConfirm, resp, block, &cr); err != nil {
 				return nil, fmt.Errorf("unmarshal confirm_action: %w", err)
 			}
 			return &cr, nil
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestActionResultMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		result ActionResult
+		want   ActionResultMetadata
+	}{
+		{
+			name:   "policy created",
+			result: ActionResult{Action: "create_policy", Success: true},
+			want:   ActionResultMetadata{Type: "action_result", Action: "create_policy", Success: true},
+		},
+		{
+			name:   "install failed with error",
+			result: ActionResult{Action: "install_plugin", Error: "user cancelled"},
+			want:   ActionResultMetadata{Type: "action_result", Action: "install_plugin"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]any
+			if err := json.Unmarshal(actionResultMetadata(&tt.result), &got); err != nil {
+				t.Fatal(err)
+			}
+			// The stats query matches on these keys, so they must always be present
+			if got["type"] != tt.want.Type || got["action"] != tt.want.Action || got["success"] != tt.want.Success {
+				t.Errorf("actionResultMetadata() = %v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfirmActionAutoBuildFails(t *testing.T) {
+	convID := uuid.New()
+	v := &fakeVerifier{installed: []string{testPluginID}, schemaErr: errConnReset}
+	s, msgs, _ := policyService(t, v, convID)
+	s.anthropic = &fakeModel{resp: toolReply(ConfirmActionTool.Name, map[string]any{
+		"response": "The plugin is installed.",
+	})}
+	s.abilityMaxTokens = map[string]int{abilityConfirm: 1024, abilityPolicy: 1024}
+	s.buildFailureLimit = 3
+	// The user picked the suggestion before installing the plugin
+	_ = s.redis.Set(context.Background(), pendingBuildKey(convID), "sugg-1", 0)
+
+	resp, err := s.confirmAction(context.Background(), convID, &SendMessageRequest{
+		PublicKey:    testOwner,
+		AccessToken:  "token",
+		ActionResult: &ActionResult{Action: "install_plugin", Success: true},
+	}, &conversationWindow{})
+	if err != nil {
+		t.Fatalf("confirmAction() error = %v", err)
+	}
+
+	if resp.ErrorCode != ErrorCodeAutoBuildFailed {
+		t.Errorf("ErrorCode = %q, want %q", resp.ErrorCode, ErrorCodeAutoBuildFailed)
+	}
+	if resp.Message.Content != "The plugin is installed." {
+		t.Errorf("message = %q, want the install confirmation", resp.Message.Content)
+	}
+	want := "The plugin is installed, but I couldn't prepare your Recurring swap just now. Tap below to try again."
+	if resp.FollowUp == nil || resp.FollowUp.Content != want {
+		t.Fatalf("follow-up = %+v, want %q", resp.FollowUp, want)
+	}
+	if len(resp.Suggestions) != 1 || resp.Suggestions[0].ID != "sugg-1" {
+		t.Errorf("suggestions = %+v, want the pending suggestion offered again", resp.Suggestions)
+	}
+
+	// The action result, the confirmation and the explanation are stored, in that order
+	stored := msgs.stored()
+	if len(stored) != 3 || stored[2].Content != want {
+		t.Fatalf("stored %d messages, want the action result, confirmation and explanation", len(stored))
+	}
+	var meta struct {
+		Type      string `json:"type"`
+		ErrorCode string `json:"error_code"`
+	}
+	if err := json.Unmarshal(stored[2].Metadata, &meta); err != nil || meta.Type != "auto_build_failed" || meta.ErrorCode != ErrorCodeAutoBuildFailed {
+		t.Errorf("explanation metadata = %s, want type auto_build_failed with its error code", stored[2].Metadata)
+	}
+
+	// The pending build survives so the retry can pick it up
+	if pending, err := s.redis.Get(context.Background(), pendingBuildKey(convID)); err != nil || pending != "sugg-1" {
+		t.Errorf("pending build = %q (%v), want sugg-1 kept", pending, err)
+	}
+}
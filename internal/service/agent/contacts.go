@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/vultisig/agent-backend/internal/service/names"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// maxContactNameLength bounds contact names; it matches the column width.
+const maxContactNameLength = 100
+
+// maxContactLookups caps resolve_contact rounds before build_policy is forced.
+const maxContactLookups = 3
+
+const (
+	base58Chars = `[1-9A-HJ-NP-Za-km-z]`
+	bech32Chars = `[02-9ac-hj-np-z]`
+)
+
+var evmAddressRe = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+// addressPatterns maps normalized chain names to the address formats accepted for contacts.
+var addressPatterns = map[string]*regexp.Regexp{
+	"ethereum":    evmAddressRe,
+	"arbitrum":    evmAddressRe,
+	"base":        evmAddressRe,
+	"optimism":    evmAddressRe,
+	"blast":       evmAddressRe,
+	"zksync":      evmAddressRe,
+	"bsc":         evmAddressRe,
+	"avalanche":   evmAddressRe,
+	"polygon":     evmAddressRe,
+	"cronoschain": evmAddressRe,
+	"bitcoin":     regexp.MustCompile(`^(bc1` + bech32Chars + `{11,71}|[13]` + base58Chars + `{25,34})$`),
+	"bitcoincash": regexp.MustCompile(`^(bitcoincash:)?[qp]` + bech32Chars + `{41}$`),
+	"litecoin":    regexp.MustCompile(`^(ltc1` + bech32Chars + `{11,71}|[LM3]` + base58Chars + `{26,33})$`),
+	"dogecoin":    regexp.MustCompile(`^[DA9]` + base58Chars + `{25,34}$`),
+	"dash":        regexp.MustCompile(`^X` + base58Chars + `{33}$`),
+	"zcash":       regexp.MustCompile(`^t1` + base58Chars + `{33}$`),
+	"solana":      regexp.MustCompile(`^` + base58Chars + `{32,44}$`),
+	"thorchain":   regexp.MustCompile(`^thor1` + bech32Chars + `{38}$`),
+	"mayachain":   regexp.MustCompile(`^maya1` + bech32Chars + `{38}$`),
+	"cosmos":      regexp.MustCompile(`^cosmos1` + bech32Chars + `{38}$`),
+	"gaiachain":   regexp.MustCompile(`^cosmos1` + bech32Chars + `{38}$`),
+	"osmosis":     regexp.MustCompile(`^osmo1` + bech32Chars + `{38}$`),
+	"kujira":      regexp.MustCompile(`^kujira1` + bech32Chars + `{38}$`),
+	"dydx":        regexp.MustCompile(`^dydx1` + bech32Chars + `{38}$`),
+	"polkadot":    regexp.MustCompile(`^1` + base58Chars + `{46,47}$`),
+	"ripple":      regexp.MustCompile(`^r` + base58Chars + `{24,34}$`),
+	"tron":        regexp.MustCompile(`^T` + base58Chars + `{33}$`),
+	"ton":         regexp.MustCompile(`^((EQ|UQ)[A-Za-z0-9_-]{46}|-?[0-9]:[0-9a-fA-F]{64})$`),
+	"sui":         regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`),
+	"cardano":     regexp.MustCompile(`^addr1` + bech32Chars + `{53,}$`),
+}
+
+// NormalizeContact trims and validates a contact before it is written: the name must be
+// non-empty, the chain supported and the address well-formed for that chain.
+// The chain is stored in normalized form.
+func NormalizeContact(c *types.Contact) error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Address = strings.TrimSpace(c.Address)
+	c.Chain = normalizeChain(strings.TrimSpace(c.Chain))
+
+	if c.Name == "" {
+		return errors.New("name is required")
+	}
+	if len([]rune(c.Name)) > maxContactNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxContactNameLength)
+	}
+	pattern, ok := addressPatterns[c.Chain]
+	if !ok {
+		return fmt.Errorf("unsupported chain %q", c.Chain)
+	}
+	if !pattern.MatchString(c.Address) {
+		return fmt.Errorf("invalid %s address", c.Chain)
+	}
+	return nil
+}
+
+// loadContacts returns the user's address book. Failures are logged and yield no contacts.
+func (s *AgentService) loadContacts(ctx context.Context, publicKey string) []types.Contact {
+	if s.contactRepo == nil {
+		return nil
+	}
+
+	contacts, err := s.contactRepo.List(ctx, publicKey)
+	if err != nil {
+		s.logger.WithError(err).Warn("failed to load contacts")
+		return nil
+	}
+	return contacts
+}
+
+// resolveContactInput is the input of the resolve_contact tool.
+type resolveContactInput struct {
+	Name  string `json:"name"`
+	Chain string `json:"chain,omitempty"`
+}
+
+// resolvedContact is a single resolve_contact match.
+type resolvedContact struct {
+	Name    string `json:"name"`
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+}
+
+// resolveContact looks up contacts by name, optionally narrowed to a chain, and returns
+// the tool result content. The second return value reports whether it is an error result.
+func resolveContact(contacts []types.Contact, input json.RawMessage) (string, bool) {
+	var in resolveContactInput
+	if err := json.Unmarshal(input, &in); err != nil || strings.TrimSpace(in.Name) == "" {
+		return "a contact name is required", true
+	}
+
+	chain := normalizeChain(in.Chain)
+	var matches []resolvedContact
+	for _, c := range contacts {
+		if !strings.EqualFold(c.Name, strings.TrimSpace(in.Name)) {
+			continue
+		}
+		if chain != "" && c.Chain != chain {
+			continue
+		}
+		matches = append(matches, resolvedContact{Name: c.Name, Chain: c.Chain, Address: c.Address})
+	}
+	if len(matches) == 0 {
+		return fmt.Sprintf("no contact named %q", in.Name), true
+	}
+
+	result, _ := json.Marshal(matches)
+	return string(result), false
+}
+
+// contactTool answers resolve_contact calls from the given address book.
+func contactTool(contacts []types.Contact) toolHandler {
+	return func(_ context.Context, input json.RawMessage) (string, bool) {
+		return resolveContact(contacts, input)
+	}
+}
+
+// checkConfigurationAddresses is the address guardrail for built policies: every address
+// field in the configuration must be one of the user's own addresses, a saved contact or
+// a name resolved for this build. Token contract fields are not address fields and are not checked.
+func checkConfigurationAddresses(configuration map[string]any, addresses map[string]string, contacts []types.Contact, resolved []names.Resolution) error {
+	allowed := make([]string, 0, len(addresses)+len(contacts)+len(resolved))
+	for _, addr := range addresses {
+		allowed = append(allowed, addr)
+	}
+	for _, c := range contacts {
+		allowed = append(allowed, c.Address)
+	}
+	for _, r := range resolved {
+		allowed = append(allowed, r.Address)
+	}
+
+	return walkAddressFields(configuration, func(_ map[string]any, _, addr string) error {
+		if !addressAllowed(addr, allowed) {
+			return &AddressNotAllowedError{Address: addr}
+		}
+		return nil
+	})
+}
+
+// walkAddressFields calls fn for every non-empty string address field in a configuration,
+// passing the containing object so fn can rewrite the value. It stops at the first error.
+func walkAddressFields(v any, fn func(fields map[string]any, key, value string) error) error {
+	switch val := v.(type) {
+	case map[string]any:
+		for key, child := range val {
+			if s, ok := child.(string); ok {
+				if isAddressField(key) && s != "" {
+					if err := fn(val, key, s); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := walkAddressFields(child, fn); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, child := range val {
+			if err := walkAddressFields(child, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isAddressField reports whether a configuration key holds a wallet address.
+func isAddressField(key string) bool {
+	key = strings.ToLower(key)
+	if strings.Contains(key, "token") || strings.Contains(key, "contract") {
+		return false
+	}
+	return strings.Contains(key, "address") || strings.Contains(key, "recipient")
+}
+
+// addressAllowed reports whether addr is in allowed. Hex addresses compare case-insensitively.
+func addressAllowed(addr string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == addr || (strings.HasPrefix(addr, "0x") && strings.EqualFold(a, addr)) {
+			return true
+		}
+	}
+	return false
+}
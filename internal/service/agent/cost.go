@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+// Purposes model calls are attributed to. Summarization runs inside a turn but is reported
+// apart from the reply, since it pays for the whole conversation rather than one message.
+// Titles are generated once per conversation and count toward the first reply.
+const (
+	purposeReply   = "reply"
+	purposeSummary = "summary"
+	purposeTitle   = "title"
+)
+
+// Usage is the tokens used by model calls and their estimated cost.
+type Usage struct {
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+	// Unpriced is set when a model without a configured price was called; CostUSD then
+	// leaves out those calls
+	Unpriced bool `json:"unpriced,omitempty"`
+	// Images counts the attached images sent; their tokens are part of InputTokens
+	Images int `json:"images,omitempty"`
+	// TTSCharacters counts the characters sent for speech synthesis, which isn't priced
+	TTSCharacters int `json:"tts_characters,omitempty"`
+}
+
+// add counts one call's usage, priced with price when known.
+func (u *Usage) add(usage anthropic.Usage, price config.ModelPrice, priced bool) {
+	u.InputTokens += usage.InputTokens
+	u.OutputTokens += usage.OutputTokens
+	if !priced {
+		u.Unpriced = true
+		return
+	}
+	u.CostUSD += callCost(usage, price)
+}
+
+// TurnUsage is the model usage of one message's turn, with summarization reported apart
+// from the reply.
+type TurnUsage struct {
+	Reply   Usage  `json:"reply"`
+	Summary *Usage `json:"summary,omitempty"`
+	// TotalCostUSD is the reply and summary cost together
+	TotalCostUSD float64 `json:"total_cost_usd"`
+}
+
+// callCost returns the USD cost of a call's usage at price, which is per million tokens.
+func callCost(usage anthropic.Usage, price config.ModelPrice) float64 {
+	return (float64(usage.InputTokens)*price.Input + float64(usage.OutputTokens)*price.Output) / 1e6
+}
+
+// usageKey is the context key for the usage accumulated while handling a message.
+type usageKey struct{}
+
+// turnUsage accumulates a turn's usage across its model calls. It is locked since work
+// started from the turn may outlive the request's goroutine.
+type turnUsage struct {
+	mu      sync.Mutex
+	reply   Usage
+	summary Usage
+}
+
+// withUsage returns a context that accumulates the usage of the model calls made with it.
+func withUsage(ctx context.Context) context.Context {
+	return context.WithValue(ctx, usageKey{}, new(turnUsage))
+}
+
+// turnUsageFrom returns the usage accumulated in ctx, or nil when nothing was called.
+func turnUsageFrom(ctx context.Context) *TurnUsage {
+	tu, ok := ctx.Value(usageKey{}).(*turnUsage)
+	if !ok {
+		return nil
+	}
+	tu.mu.Lock()
+	defer tu.mu.Unlock()
+	if tu.reply == (Usage{}) && tu.summary == (Usage{}) {
+		return nil
+	}
+
+	out := &TurnUsage{Reply: tu.reply, TotalCostUSD: tu.reply.CostUSD + tu.summary.CostUSD}
+	if tu.summary != (Usage{}) {
+		summary := tu.summary
+		out.Summary = &summary
+	}
+	return out
+}
+
+// send calls the model and accounts the call's usage to purpose, in metrics and in the
+// context's turn usage.
+func (s *AgentService) send(ctx context.Context, purpose string, req *anthropic.Request) (*anthropic.Response, error) {
+	if purpose == purposeReply {
+		reportProgress(ctx, ProgressThinking)
+	}
+	resp, err := s.anthropic.SendMessage(ctx, req)
+	if err != nil {
+		return nil, &ModelError{Err: err}
+	}
+
+	model := resp.Model
+	if model == "" {
+		model = req.Model
+	}
+	price, priced := s.prices[model]
+	metrics.ModelTokens.WithLabelValues(model, purpose, "input").Add(float64(resp.Usage.InputTokens))
+	metrics.ModelTokens.WithLabelValues(model, purpose, "output").Add(float64(resp.Usage.OutputTokens))
+	if priced {
+		metrics.ModelCost.WithLabelValues(model, purpose).Add(callCost(resp.Usage, price))
+	}
+	images := countImages(req)
+	if images > 0 {
+		metrics.ModelImages.WithLabelValues(model, purpose).Add(float64(images))
+	}
+
+	if tu, ok := ctx.Value(usageKey{}).(*turnUsage); ok {
+		tu.mu.Lock()
+		if purpose == purposeSummary {
+			tu.summary.add(resp.Usage, price, priced)
+		} else {
+			tu.reply.add(resp.Usage, price, priced)
+			tu.reply.Images += images
+		}
+		tu.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// addSpeechUsage accounts characters sent for speech synthesis to the reply's usage.
+func addSpeechUsage(ctx context.Context, chars int) {
+	if tu, ok := ctx.Value(usageKey{}).(*turnUsage); ok {
+		tu.mu.Lock()
+		tu.reply.TTSCharacters += chars
+		tu.mu.Unlock()
+	}
+}
+
+// reportUsage logs the turn's usage and attaches it to out, when a response was built.
+func (s *AgentService) reportUsage(ctx context.Context, convID uuid.UUID, out *SendMessageResponse) {
+	usage := turnUsageFrom(ctx)
+	if usage == nil {
+		return
+	}
+
+	fields := logrus.Fields{
+		"conversation_id": convID,
+		"input_tokens":    usage.Reply.InputTokens,
+		"output_tokens":   usage.Reply.OutputTokens,
+		"cost_usd":        usage.Reply.CostUSD,
+		"total_cost_usd":  usage.TotalCostUSD,
+	}
+	if usage.Summary != nil {
+		fields["summary_cost_usd"] = usage.Summary.CostUSD
+	}
+	if usage.Reply.Images > 0 {
+		fields["images"] = usage.Reply.Images
+	}
+	if usage.Reply.TTSCharacters > 0 {
+		fields["tts_characters"] = usage.Reply.TTSCharacters
+	}
+	if usage.Reply.Unpriced || usage.Summary != nil && usage.Summary.Unpriced {
+		fields["unpriced"] = true
+	}
+	s.logger.WithFields(fields).Info("turn usage")
+
+	if out != nil {
+		out.Usage = usage
+	}
+}
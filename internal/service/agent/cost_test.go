@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+)
+
+var testPrices = config.ModelPrices{
+	"sonnet": {Input: 3, Output: 15},
+	"haiku":  {Input: 1, Output: 5},
+	"opus":   {Input: 15, Output: 75},
+}
+
+// closeTo reports whether two costs are equal up to float rounding.
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) < 1e-12
+}
+
+func TestCallCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		usage anthropic.Usage
+		want  float64
+	}{
+		{name: "sonnet", model: "sonnet", usage: anthropic.Usage{InputTokens: 1000, OutputTokens: 500}, want: 0.0105},
+		{name: "haiku", model: "haiku", usage: anthropic.Usage{InputTokens: 2000, OutputTokens: 100}, want: 0.0025},
+		{name: "opus, a million of each", model: "opus", usage: anthropic.Usage{InputTokens: 1_000_000, OutputTokens: 1_000_000}, want: 90},
+		{name: "input only", model: "sonnet", usage: anthropic.Usage{InputTokens: 1}, want: 0.000003},
+		{name: "no tokens", model: "opus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := callCost(tt.usage, testPrices[tt.model]); !closeTo(got, tt.want) {
+				t.Errorf("callCost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// usageCall is a model call made for purpose.
+type usageCall struct {
+	purpose string
+	resp    *anthropic.Response
+}
+
+func TestTurnUsage(t *testing.T) {
+	call := func(model string, in, out int) *anthropic.Response {
+		return &anthropic.Response{Model: model, Usage: anthropic.Usage{InputTokens: in, OutputTokens: out}}
+	}
+
+	tests := []struct {
+		name  string
+		calls []usageCall
+		want  *TurnUsage
+	}{
+		{name: "no calls"},
+		{
+			name: "reply and title across models",
+			calls: []usageCall{
+				{purposeReply, call("sonnet", 1000, 500)},
+				{purposeTitle, call("haiku", 200, 20)},
+			},
+			want: &TurnUsage{
+				Reply:        Usage{InputTokens: 1200, OutputTokens: 520, CostUSD: 0.0105 + 0.0003},
+				TotalCostUSD: 0.0108,
+			},
+		},
+		{
+			name: "summary attributed apart",
+			calls: []usageCall{
+				{purposeSummary, call("haiku", 2000, 100)},
+				{purposeReply, call("opus", 1000, 100)},
+			},
+			want: &TurnUsage{
+				Reply:        Usage{InputTokens: 1000, OutputTokens: 100, CostUSD: 0.0225},
+				Summary:      &Usage{InputTokens: 2000, OutputTokens: 100, CostUSD: 0.0025},
+				TotalCostUSD: 0.025,
+			},
+		},
+		{
+			name: "unpriced model counts tokens only",
+			calls: []usageCall{
+				{purposeReply, call("sonnet", 1000, 500)},
+				{purposeReply, call("unknown", 10, 10)},
+			},
+			want: &TurnUsage{
+				Reply:        Usage{InputTokens: 1010, OutputTokens: 510, CostUSD: 0.0105, Unpriced: true},
+				TotalCostUSD: 0.0105,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &fakeModel{}
+			for _, c := range tt.calls {
+				model.replies = append(model.replies, c.resp)
+			}
+			s := &AgentService{anthropic: model, prices: testPrices, logger: testLogger()}
+			ctx := withUsage(context.Background())
+			for _, c := range tt.calls {
+				if _, err := s.send(ctx, c.purpose, &anthropic.Request{}); err != nil {
+					t.Fatalf("send() error = %v", err)
+				}
+			}
+
+			out := &SendMessageResponse{}
+			s.reportUsage(ctx, uuid.New(), out)
+			got := out.Usage
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("usage = %+v, want none without model calls", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("usage not attached to the response")
+			}
+			if !sameUsage(got.Reply, tt.want.Reply) || !closeTo(got.TotalCostUSD, tt.want.TotalCostUSD) {
+				t.Errorf("usage = %+v, want %+v", got, tt.want)
+			}
+			if (got.Summary == nil) != (tt.want.Summary == nil) || got.Summary != nil && !sameUsage(*got.Summary, *tt.want.Summary) {
+				t.Errorf("summary usage = %+v, want %+v", got.Summary, tt.want.Summary)
+			}
+		})
+	}
+}
+
+// sameUsage compares usages, allowing for float rounding in the cost.
+func sameUsage(a, b Usage) bool {
+	costA, costB := a.CostUSD, b.CostUSD
+	a.CostUSD, b.CostUSD = 0, 0
+	return a == b && closeTo(costA, costB)
+}
@@ -0,0 +1,212 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/service/share"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ErrNoGeneration is returned by DebugBundle for messages not generated by the model, such
+// as user messages and canned replies.
+var ErrNoGeneration = errors.New("message was not generated by the model")
+
+// Divergences a debug bundle can report between the reply's generation and the bundle.
+const (
+	// DivergenceSnapshotMissing means the exact request expired or was never captured, so it
+	// was reconstructed from the current state
+	DivergenceSnapshotMissing = "snapshot_missing"
+	// DivergenceWalletContext means the request's wallet context (balances, addresses,
+	// activity) isn't stored and is missing from the reconstruction
+	DivergenceWalletContext = "wallet_context_unavailable"
+	// DivergenceSystemPrompt means the system prompt differs from the one sent
+	DivergenceSystemPrompt = "system_prompt"
+	// DivergencePromptVersion means the ability's prompt template changed since the reply
+	DivergencePromptVersion = "prompt_version"
+	// DivergenceMemory means the user's memory changed since the reply
+	DivergenceMemory = "memory"
+	// DivergenceUnsupportedAbility means requests of the reply's ability can't be reconstructed
+	DivergenceUnsupportedAbility = "reconstruction_unsupported"
+)
+
+// debugSnapshot is the exact request and response a reply was generated from.
+type debugSnapshot struct {
+	Request    *anthropic.Request  `json:"request"`
+	Response   *anthropic.Response `json:"response"`
+	CapturedAt time.Time           `json:"captured_at"`
+}
+
+// DebugBundle packages what the model was sent and answered for one assistant reply, for
+// replaying a bad generation. Request is the exact request while its snapshot is kept, and
+// otherwise a reconstruction from the current state; Divergences lists where the bundle may
+// differ from what was sent.
+type DebugBundle struct {
+	ConversationID uuid.UUID           `json:"conversation_id"`
+	MessageID      uuid.UUID           `json:"message_id"`
+	Message        types.Message       `json:"message"`
+	Generation     json.RawMessage     `json:"generation"`
+	Exact          bool                `json:"exact"`
+	CapturedAt     *time.Time          `json:"captured_at,omitempty"`
+	Request        *anthropic.Request  `json:"request"`
+	Response       *anthropic.Response `json:"response,omitempty"`
+	Current        DebugCurrentState   `json:"current"`
+	Divergences    []string            `json:"divergences"`
+	Redacted       bool                `json:"redacted"`
+}
+
+// DebugCurrentState is the state a reply's prompt is built from, as it is now.
+type DebugCurrentState struct {
+	PromptVersion string  `json:"prompt_version"`
+	Memory        string  `json:"memory"`
+	Summary       *string `json:"summary,omitempty"`
+}
+
+// debugSnapshotKey is the Redis key holding a reply's debug snapshot.
+func debugSnapshotKey(messageID uuid.UUID) string {
+	return "debug_snapshot:" + messageID.String()
+}
+
+// captureDebugSnapshot keeps the request and response msg was generated from for
+// debugSnapshotTTL. Failing to store it is logged, not returned.
+func (s *AgentService) captureDebugSnapshot(ctx context.Context, msg *types.Message) {
+	info, ok := ctx.Value(generationKey{}).(*generationInfo)
+	if s.debugSnapshotTTL <= 0 || !ok || info.request == nil {
+		return
+	}
+
+	data, err := json.Marshal(debugSnapshot{Request: info.request, Response: info.response, CapturedAt: time.Now().UTC()})
+	if err != nil {
+		s.logger.WithError(err).Warn("failed to encode debug snapshot")
+		return
+	}
+	if err := s.redis.Set(context.WithoutCancel(ctx), debugSnapshotKey(msg.ID), string(data), s.debugSnapshotTTL); err != nil {
+		s.logger.WithError(err).Warn("failed to store debug snapshot")
+	}
+}
+
+// DebugBundle returns the debug bundle of an assistant reply as JSON. Addresses are masked
+// unless redact is false. Returns postgres.ErrNotFound for unknown conversations or
+// messages, and ErrNoGeneration for messages without generation metadata.
+func (s *AgentService) DebugBundle(ctx context.Context, convID, messageID uuid.UUID, redact bool) (json.RawMessage, error) {
+	conv, err := s.convRepo.GetForAdmin(ctx, convID)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := s.msgRepo.GetByID(ctx, convID, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var meta struct {
+		Generation json.RawMessage `json:"generation"`
+	}
+	_ = json.Unmarshal(msg.Metadata, &meta)
+	var gen generationInfo
+	if msg.Role != types.RoleAssistant || len(meta.Generation) == 0 || json.Unmarshal(meta.Generation, &gen) != nil {
+		return nil, ErrNoGeneration
+	}
+
+	window := &conversationWindow{summary: conv.Summary, noMemory: conv.NoMemory}
+	mem, err := s.memRepo.GetMemory(ctx, conv.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("get memory: %w", err)
+	}
+	var memory string
+	if mem != nil {
+		memory = mem.Content
+	}
+
+	bundle := &DebugBundle{
+		ConversationID: convID,
+		MessageID:      messageID,
+		Message:        *msg,
+		Generation:     meta.Generation,
+		Current: DebugCurrentState{
+			PromptVersion: promptVersions[gen.Ability],
+			Memory:        memory,
+			Summary:       conv.Summary,
+		},
+		Divergences: []string{},
+		Redacted:    redact,
+	}
+
+	raw, err := s.redis.Get(ctx, debugSnapshotKey(messageID))
+	var snap debugSnapshot
+	if err == nil && raw != "" && json.Unmarshal([]byte(raw), &snap) == nil && snap.Request != nil {
+		bundle.Exact = true
+		bundle.CapturedAt = &snap.CapturedAt
+		bundle.Request = snap.Request
+		bundle.Response = snap.Response
+		if memory != "" && s.memoryAllowed(ctx, window) && !strings.Contains(snap.Request.System, BuildMemorySection(memory)) {
+			bundle.Divergences = append(bundle.Divergences, DivergenceMemory)
+		}
+	} else {
+		bundle.Divergences = append(bundle.Divergences, DivergenceSnapshotMissing)
+		if bundle.Request, err = s.reconstructRequest(ctx, conv, msg, gen.Ability); err != nil {
+			return nil, err
+		}
+		if bundle.Request == nil {
+			bundle.Divergences = append(bundle.Divergences, DivergenceUnsupportedAbility)
+		} else {
+			bundle.Divergences = append(bundle.Divergences, DivergenceWalletContext)
+			if gen.SystemHash != promptHash(bundle.Request.System) {
+				bundle.Divergences = append(bundle.Divergences, DivergenceSystemPrompt)
+			}
+		}
+	}
+	if gen.PromptVersion != "" && gen.PromptVersion != bundle.Current.PromptVersion {
+		bundle.Divergences = append(bundle.Divergences, DivergencePromptVersion)
+	}
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("encode debug bundle: %w", err)
+	}
+	if redact {
+		// Addresses never contain quotes or backslashes, so masking keeps the JSON valid
+		data = []byte(share.RedactAddresses(string(data)))
+	}
+	return data, nil
+}
+
+// reconstructRequest rebuilds the intent request that msg answered from the current plugin
+// skills, contacts, memory and summary and the messages before it. The request's wallet
+// context isn't stored, so it is left out. Returns nil for other abilities, whose prompts
+// depend on request state that isn't kept.
+func (s *AgentService) reconstructRequest(ctx context.Context, conv *types.Conversation, msg *types.Message, ability string) (*anthropic.Request, error) {
+	if ability != abilityIntent {
+		return nil, nil
+	}
+	window, err := s.windowBefore(ctx, conv, msg)
+	if err != nil {
+		return nil, err
+	}
+	return s.intentRequest(ctx, conv, window), nil
+}
+
+// intentRequest rebuilds the intent request answering the last message of window in
+// conversation conv, with the current plugin skills, contacts and memory and without wallet
+// context, which isn't stored.
+func (s *AgentService) intentRequest(ctx context.Context, conv *types.Conversation, window *conversationWindow) *anthropic.Request {
+	var content string
+	if n := len(window.messages); n > 0 && window.messages[n-1].Role == types.RoleUser {
+		content = window.messages[n-1].Content
+	}
+	req, _ := s.buildIntentRequest(ctx, &intentTurn{
+		convID:    conv.ID,
+		publicKey: conv.PublicKey,
+		content:   content,
+		injection: injectionInWindow(window, ""),
+		window:    window,
+		messages:  endWithUserTurn(anthropicMessagesFromWindow(window)),
+	})
+	return req
+}
@@ -0,0 +1,240 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ConversationDuplicate is a conversation archived, or to be archived on a dry run, as a
+// duplicate of the conversation kept.
+type ConversationDuplicate struct {
+	ID     uuid.UUID `json:"id"`
+	KeptID uuid.UUID `json:"kept_id"`
+}
+
+// DedupeResult reports what deduplicating conversations changed, or would change on a dry run.
+type DedupeResult struct {
+	DryRun bool `json:"dry_run"`
+	// Candidates is the number of conversations created close to another of the same user
+	Candidates int                     `json:"candidates"`
+	Duplicates []ConversationDuplicate `json:"duplicates"`
+	// Skipped counts duplicates left alone because they changed after being judged
+	Skipped int `json:"skipped"`
+}
+
+const (
+	// dedupeBatchUsers is how many users' conversations are read and deduplicated at a time.
+	dedupeBatchUsers = 500
+	// dedupeJobTimeout bounds a dedupe run; its lock expires after it too, so a replica that
+	// died mid-run doesn't block the next one.
+	dedupeJobTimeout = 30 * time.Minute
+	// dedupeStatusTTL is how long the last run's status stays readable.
+	dedupeStatusTTL = 7 * 24 * time.Hour
+
+	dedupeLockKey   = "dedupe_lock"
+	dedupeStatusKey = "dedupe_status"
+)
+
+// Dedupe job states.
+const (
+	DedupeJobRunning   = "running"
+	DedupeJobSucceeded = "succeeded"
+	DedupeJobFailed    = "failed"
+)
+
+// ErrDedupeRunning is returned by StartDedupe while another dedupe run holds the lock.
+var ErrDedupeRunning = errors.New("a dedupe run is already in progress")
+
+// DedupeJob is a background dedupe run. Result is set once it succeeded, Error once it failed.
+type DedupeJob struct {
+	ID         uuid.UUID     `json:"id"`
+	DryRun     bool          `json:"dry_run"`
+	State      string        `json:"state"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Result     *DedupeResult `json:"result,omitempty"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// StartDedupe starts DedupeConversations in the background and returns the running job; its
+// progress is read with DedupeStatus. Only one run goes at a time across instances.
+func (s *AgentService) StartDedupe(ctx context.Context, dryRun bool) (*DedupeJob, error) {
+	job := &DedupeJob{ID: uuid.New(), DryRun: dryRun, State: DedupeJobRunning, StartedAt: time.Now().UTC()}
+	token := job.ID.String()
+	ok, err := s.redis.SetNX(ctx, dedupeLockKey, token, dedupeJobTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("take dedupe lock: %w", err)
+	}
+	if !ok {
+		return nil, ErrDedupeRunning
+	}
+	s.saveDedupeJob(ctx, job)
+	// The goroutine updates job as it finishes; the caller gets the running state
+	running := *job
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), dedupeJobTimeout)
+		defer cancel()
+		defer func() {
+			if _, err := s.redis.DeleteIfEqual(context.WithoutCancel(ctx), dedupeLockKey, token); err != nil {
+				s.logger.WithError(err).Warn("failed to release dedupe lock")
+			}
+		}()
+
+		result, err := s.DedupeConversations(ctx, dryRun)
+		finished := time.Now().UTC()
+		job.FinishedAt = &finished
+		if err != nil {
+			s.logger.WithError(err).WithField("job_id", job.ID).Error("failed to dedupe conversations")
+			job.State, job.Error = DedupeJobFailed, err.Error()
+		} else {
+			job.State, job.Result = DedupeJobSucceeded, result
+			if !dryRun && len(result.Duplicates) > 0 {
+				s.logger.WithFields(logrus.Fields{
+					"job_id":     job.ID,
+					"candidates": result.Candidates,
+					"archived":   len(result.Duplicates),
+					"skipped":    result.Skipped,
+				}).Warn("archived duplicate conversations")
+			}
+		}
+		s.saveDedupeJob(ctx, job)
+	}()
+	return &running, nil
+}
+
+// DedupeStatus returns the latest dedupe run, or nil when none was recorded recently.
+func (s *AgentService) DedupeStatus(ctx context.Context) *DedupeJob {
+	val, err := s.redis.Get(ctx, dedupeStatusKey)
+	if err != nil {
+		return nil
+	}
+	var job DedupeJob
+	if err := json.Unmarshal([]byte(val), &job); err != nil {
+		s.logger.WithError(err).Warn("failed to decode dedupe status")
+		return nil
+	}
+	return &job
+}
+
+// saveDedupeJob records job as the latest dedupe run.
+func (s *AgentService) saveDedupeJob(ctx context.Context, job *DedupeJob) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		s.logger.WithError(err).Warn("failed to encode dedupe status")
+		return
+	}
+	if err := s.redis.Set(context.WithoutCancel(ctx), dedupeStatusKey, string(data), dedupeStatusTTL); err != nil {
+		s.logger.WithError(err).WithField("job_id", job.ID).Warn("failed to save dedupe status")
+	}
+}
+
+// DedupeConversations archives near-empty duplicate conversations, left behind by double
+// taps and client retries. Users are walked in public key order, dedupeBatchUsers at a time;
+// each user's conversations created within the duplicate window are compared with the one
+// that got furthest, which is kept; see isDuplicateOf for what counts as a duplicate. With
+// dryRun nothing is archived.
+func (s *AgentService) DedupeConversations(ctx context.Context, dryRun bool) (*DedupeResult, error) {
+	result := &DedupeResult{DryRun: dryRun, Duplicates: []ConversationDuplicate{}}
+	after := ""
+	for {
+		keys, err := s.convRepo.ListPublicKeysAfter(ctx, after, dedupeBatchUsers)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 {
+			return result, nil
+		}
+		if err := s.dedupeUsers(ctx, keys, result); err != nil {
+			return nil, err
+		}
+		if len(keys) < dedupeBatchUsers {
+			return result, nil
+		}
+		after = keys[len(keys)-1]
+	}
+}
+
+// dedupeUsers deduplicates the conversations of the users with publicKeys, adding to result.
+func (s *AgentService) dedupeUsers(ctx context.Context, publicKeys []string, result *DedupeResult) error {
+	candidates, err := s.convRepo.ListDuplicateCandidates(ctx, publicKeys, s.duplicateWindow)
+	if err != nil {
+		return err
+	}
+	result.Candidates += len(candidates)
+	for _, d := range findDuplicates(candidates, s.duplicateWindow) {
+		if !result.DryRun {
+			archived, err := s.convRepo.ArchiveDuplicate(ctx, d.conv.ID, d.conv.Messages)
+			if err != nil {
+				return err
+			}
+			if !archived {
+				result.Skipped++
+				continue
+			}
+		}
+		result.Duplicates = append(result.Duplicates, ConversationDuplicate{ID: d.conv.ID, KeptID: d.keptID})
+	}
+	return nil
+}
+
+// duplicate is a conversation found to duplicate the conversation keptID.
+type duplicate struct {
+	conv   types.DuplicateCandidate
+	keptID uuid.UUID
+}
+
+// findDuplicates groups candidates, ordered by public key and creation time, into runs of
+// one user's conversations each created within window of the previous. In each run the
+// conversation with the most user messages, then the most messages, then the oldest is
+// kept, and the others created within window of it are returned if they duplicate it.
+func findDuplicates(candidates []types.DuplicateCandidate, window time.Duration) []duplicate {
+	var dups []duplicate
+	for start := 0; start < len(candidates); {
+		end := start + 1
+		for end < len(candidates) &&
+			candidates[end].PublicKey == candidates[start].PublicKey &&
+			candidates[end].CreatedAt.Sub(candidates[end-1].CreatedAt) <= window {
+			end++
+		}
+
+		run := candidates[start:end]
+		kept := run[0]
+		for _, c := range run[1:] {
+			if c.UserMessages > kept.UserMessages || c.UserMessages == kept.UserMessages && c.Messages > kept.Messages {
+				kept = c
+			}
+		}
+		for _, c := range run {
+			gap := c.CreatedAt.Sub(kept.CreatedAt).Abs()
+			if c.ID != kept.ID && gap <= window && isDuplicateOf(c, kept) {
+				dups = append(dups, duplicate{conv: c, keptID: kept.ID})
+			}
+		}
+		start = end
+	}
+	return dups
+}
+
+// isDuplicateOf reports whether conv can be archived in favor of kept without losing
+// anything: it has no messages, or only the same first message as kept with at most one
+// reply. Conversations the user labeled are never duplicates.
+func isDuplicateOf(conv, kept types.DuplicateCandidate) bool {
+	if len(conv.Labels) > 0 {
+		return false
+	}
+	if conv.Messages == 0 {
+		return true
+	}
+	return conv.UserMessages == 1 && conv.Messages <= 2 && kept.UserMessages >= 1 &&
+		strings.TrimSpace(conv.FirstMessage) == strings.TrimSpace(kept.FirstMessage)
+}
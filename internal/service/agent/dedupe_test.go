@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// fakeDuplicateStore serves duplicate candidates, ordered by public key and creation time,
+// and records the conversations archived. Conversations in moved have changed since they
+// were read and aren't archived.
+type fakeDuplicateStore struct {
+	ConversationStore
+	candidates []types.DuplicateCandidate
+	moved      map[uuid.UUID]bool
+
+	mu       sync.Mutex
+	batches  int
+	archived []uuid.UUID
+}
+
+func (f *fakeDuplicateStore) ListPublicKeysAfter(_ context.Context, after string, limit int) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.batches++
+	var keys []string
+	for _, c := range f.candidates {
+		if c.PublicKey > after && !slices.Contains(keys, c.PublicKey) && len(keys) < limit {
+			keys = append(keys, c.PublicKey)
+		}
+	}
+	return keys, nil
+}
+
+func (f *fakeDuplicateStore) ListDuplicateCandidates(_ context.Context, publicKeys []string, _ time.Duration) ([]types.DuplicateCandidate, error) {
+	var candidates []types.DuplicateCandidate
+	for _, c := range f.candidates {
+		if slices.Contains(publicKeys, c.PublicKey) {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, nil
+}
+
+func (f *fakeDuplicateStore) ArchiveDuplicate(_ context.Context, id uuid.UUID, _ int64) (bool, error) {
+	if f.moved[id] {
+		return false, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.archived = append(f.archived, id)
+	return true, nil
+}
+
+func TestFindDuplicates(t *testing.T) {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	conv := func(key string, offset time.Duration, messages, userMessages int64, first string) types.DuplicateCandidate {
+		return types.DuplicateCandidate{
+			ID:           uuid.New(),
+			PublicKey:    key,
+			CreatedAt:    base.Add(offset),
+			Messages:     messages,
+			UserMessages: userMessages,
+			FirstMessage: first,
+		}
+	}
+	labeled := conv("a", 10*time.Second, 0, 0, "")
+	labeled.Labels = []string{"keep"}
+
+	tests := []struct {
+		name       string
+		candidates []types.DuplicateCandidate
+		// want maps the index of each duplicate to the index of the conversation kept
+		want map[int]int
+	}{
+		{
+			name:       "empty conversation next to a used one",
+			candidates: []types.DuplicateCandidate{conv("a", 0, 0, 0, ""), conv("a", 10*time.Second, 4, 2, "hi")},
+			want:       map[int]int{0: 1},
+		},
+		{
+			name:       "same first message with a reply",
+			candidates: []types.DuplicateCandidate{conv("a", 0, 3, 2, "swap eth"), conv("a", 5*time.Second, 2, 1, " swap eth ")},
+			want:       map[int]int{1: 0},
+		},
+		{
+			name:       "different first message",
+			candidates: []types.DuplicateCandidate{conv("a", 0, 2, 1, "swap eth"), conv("a", 5*time.Second, 2, 1, "send btc")},
+			want:       map[int]int{},
+		},
+		{
+			name:       "labeled conversation is kept",
+			candidates: []types.DuplicateCandidate{conv("a", 0, 2, 1, "hi"), labeled},
+			want:       map[int]int{},
+		},
+		{
+			name:       "outside the window",
+			candidates: []types.DuplicateCandidate{conv("a", 0, 2, 1, "hi"), conv("a", 2*time.Minute, 0, 0, "")},
+			want:       map[int]int{},
+		},
+		{
+			name:       "different users",
+			candidates: []types.DuplicateCandidate{conv("a", 0, 2, 1, "hi"), conv("b", time.Second, 0, 0, "")},
+			want:       map[int]int{},
+		},
+		{
+			name: "run chained through the window keeps the furthest",
+			candidates: []types.DuplicateCandidate{
+				conv("a", 0, 0, 0, ""),
+				conv("a", 50*time.Second, 6, 3, "hi"),
+				conv("a", 100*time.Second, 0, 0, ""),
+			},
+			want: map[int]int{0: 1, 2: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findDuplicates(tt.candidates, time.Minute)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d duplicates, want %d", len(got), len(tt.want))
+			}
+			for _, d := range got {
+				i := slices.IndexFunc(tt.candidates, func(c types.DuplicateCandidate) bool { return c.ID == d.conv.ID })
+				kept, ok := tt.want[i]
+				if !ok {
+					t.Errorf("conversation %d reported as a duplicate", i)
+					continue
+				}
+				if d.keptID != tt.candidates[kept].ID {
+					t.Errorf("conversation %d kept in favor of the wrong conversation", i)
+				}
+			}
+		})
+	}
+}
+
+// duplicatePairs returns two conversations for each of n users: an empty one and, ten
+// seconds later, one in use.
+func duplicatePairs(n int) []types.DuplicateCandidate {
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var candidates []types.DuplicateCandidate
+	for i := range n {
+		key := fmt.Sprintf("%064x", i)
+		candidates = append(candidates,
+			types.DuplicateCandidate{ID: uuid.New(), PublicKey: key, CreatedAt: base},
+			types.DuplicateCandidate{ID: uuid.New(), PublicKey: key, CreatedAt: base.Add(10 * time.Second), Messages: 2, UserMessages: 1, FirstMessage: "hi"},
+		)
+	}
+	return candidates
+}
+
+func TestDedupeConversations(t *testing.T) {
+	users := 2*dedupeBatchUsers + 1
+	tests := []struct {
+		name         string
+		dryRun       bool
+		moved        int
+		wantArchived int
+		wantSkipped  int
+	}{
+		{name: "archives across batches", wantArchived: users},
+		{name: "dry run archives nothing", dryRun: true},
+		{name: "changed conversations are skipped", moved: 3, wantArchived: users - 3, wantSkipped: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeDuplicateStore{candidates: duplicatePairs(users), moved: make(map[uuid.UUID]bool)}
+			for i := range tt.moved {
+				store.moved[store.candidates[2*i].ID] = true
+			}
+			s := &AgentService{convRepo: store, duplicateWindow: time.Minute, logger: testLogger()}
+
+			result, err := s.DedupeConversations(context.Background(), tt.dryRun)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if store.batches != 3 {
+				t.Errorf("read users in %d batches, want 3", store.batches)
+			}
+			if result.Candidates != 2*users {
+				t.Errorf("candidates = %d, want %d", result.Candidates, 2*users)
+			}
+			if len(store.archived) != tt.wantArchived || result.Skipped != tt.wantSkipped {
+				t.Errorf("archived %d, skipped %d; want %d, %d", len(store.archived), result.Skipped, tt.wantArchived, tt.wantSkipped)
+			}
+			if want := users - tt.wantSkipped; len(result.Duplicates) != want {
+				t.Errorf("reported %d duplicates, want %d", len(result.Duplicates), want)
+			}
+		})
+	}
+}
+
+func TestStartDedupe(t *testing.T) {
+	store := &fakeDuplicateStore{candidates: duplicatePairs(2)}
+	cache := newFakeCache()
+	s := &AgentService{convRepo: store, redis: cache, duplicateWindow: time.Minute, logger: testLogger()}
+	ctx := context.Background()
+
+	if s.DedupeStatus(ctx) != nil {
+		t.Fatal("status reported before any run")
+	}
+	_ = cache.Set(ctx, dedupeLockKey, "other", time.Minute)
+	if _, err := s.StartDedupe(ctx, false); !errors.Is(err, ErrDedupeRunning) {
+		t.Fatalf("start while locked: got %v, want ErrDedupeRunning", err)
+	}
+	_ = cache.Delete(ctx, dedupeLockKey)
+
+	job, err := s.StartDedupe(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != DedupeJobRunning {
+		t.Errorf("started job state = %q, want %q", job.State, DedupeJobRunning)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := s.DedupeStatus(ctx)
+		if status != nil && status.State == DedupeJobSucceeded {
+			if status.ID != job.ID || status.Result == nil || len(status.Result.Duplicates) != 2 {
+				t.Errorf("finished status = %+v", status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job did not finish, status %+v", status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The lock is released once the job's status is saved
+	for time.Now().Before(deadline) {
+		if ok, _ := cache.Exists(ctx, dedupeLockKey); !ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("dedupe lock not released")
+}
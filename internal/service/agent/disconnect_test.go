@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// disconnectModel, with cancel set, cancels the request context while the model call is in
+// flight, as when the client gives up waiting. With abort set the call then ends with the
+// context's error, otherwise the reply still arrives.
+type disconnectModel struct {
+	cancel context.CancelFunc
+	abort  bool
+	resp   *anthropic.Response
+}
+
+func (m *disconnectModel) SendMessage(ctx context.Context, _ *anthropic.Request) (*anthropic.Response, error) {
+	if m.cancel != nil {
+		m.cancel()
+	}
+	if m.abort {
+		return nil, ctx.Err()
+	}
+	return m.resp, nil
+}
+
+func TestProcessMessageClientDisconnects(t *testing.T) {
+	reply := toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "action_request",
+		"response": "A DCA plugin can do that.",
+		"suggestions": []map[string]any{
+			{"plugin_id": "vultisig-dca-0000", "title": "Recurring swap", "description": "Swap ETH weekly"},
+		},
+	})
+
+	tests := []struct {
+		name            string
+		disconnect      bool
+		abort           bool
+		wantErr         error
+		wantContentType string
+		wantContent     string
+		wantDelivered   bool
+	}{
+		{
+			name:            "client still connected",
+			wantContentType: "text",
+			wantContent:     "A DCA plugin can do that.",
+			wantDelivered:   true,
+		},
+		{
+			name:            "reply finishes after the client left",
+			disconnect:      true,
+			wantContentType: "text",
+			wantContent:     "A DCA plugin can do that.",
+		},
+		{
+			name:            "model call canceled",
+			disconnect:      true,
+			abort:           true,
+			wantErr:         context.Canceled,
+			wantContentType: "error",
+			wantContent:     errorReplyContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			model := &disconnectModel{abort: tt.abort, resp: reply}
+			if tt.disconnect {
+				model.cancel = cancel
+			}
+			cache := newFakeCache()
+			msgs := &fakeMessageStore{}
+			svc := NewAgentService(Deps{
+				Anthropic:     model,
+				Messages:      msgs,
+				Conversations: &fakeConversationStore{owner: testOwner},
+				Cache:         cache,
+				Outbox:        &fakeOutbox{cache: cache},
+				Logger:        testLogger(),
+			}, Settings{
+				Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+				Agent:   config.AgentConfig{IntentMaxTokens: 1024},
+			})
+
+			_, err := svc.ProcessMessage(ctx, uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   "swap eth every week",
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ProcessMessage() error = %v, want %v", err, tt.wantErr)
+			}
+
+			// The reply is stored either way, so a reload isn't left on an unanswered message
+			stored := msgs.stored()
+			if len(stored) != 2 {
+				t.Fatalf("stored %d messages, want the user message and a reply", len(stored))
+			}
+			got := stored[1]
+			if got.Role != types.RoleAssistant || got.ContentType != tt.wantContentType || got.Content != tt.wantContent {
+				t.Errorf("reply = %s %s %q, want assistant %s %q", got.Role, got.ContentType, got.Content, tt.wantContentType, tt.wantContent)
+			}
+			if tt.abort {
+				return
+			}
+			var meta struct {
+				Delivered *bool `json:"delivered"`
+			}
+			if err := json.Unmarshal(got.Metadata, &meta); err != nil {
+				t.Fatalf("decode reply metadata: %v", err)
+			}
+			if delivered := meta.Delivered == nil || *meta.Delivered; delivered != tt.wantDelivered {
+				t.Errorf("reply metadata = %s, want delivered %v", got.Metadata, tt.wantDelivered)
+			}
+
+			// Suggestions the user never saw aren't made selectable
+			var cached int
+			for key := range cache.values {
+				if strings.HasPrefix(key, "sug_") {
+					cached++
+				}
+			}
+			wantCached := 0
+			if tt.wantDelivered {
+				wantCached = 1
+			}
+			if cached != wantCached {
+				t.Errorf("cached %d suggestions, want %d", cached, wantCached)
+			}
+		})
+	}
+}
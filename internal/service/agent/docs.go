@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"strings"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/service/docs"
+)
+
+// DocsRetriever finds documentation passages relevant to a query.
+type DocsRetriever interface {
+	Search(query string, limit int, minScore float64) []docs.Result
+}
+
+// groundedAnswer is a documentation-grounded response with its supporting citations.
+type groundedAnswer struct {
+	text      string
+	citations []Citation
+}
+
+// answerFromDocs retrieves documentation passages relevant to the question and asks Claude to
+// answer again with the passages attached as citable documents. Returns nil when retrieval is
+// disabled, finds nothing, or the call fails — callers keep the original response in that case.
+func (s *AgentService) answerFromDocs(ctx context.Context, systemPrompt string, history []anthropic.Message, question string) *groundedAnswer {
+	if s.docs == nil {
+		return nil
+	}
+
+	results := s.docs.Search(question, s.docsMaxChunks, s.docsMinScore)
+	if len(results) == 0 {
+		return nil
+	}
+
+	// Documents go before the question, as recommended for long-context grounding
+	blocks := make([]any, 0, len(results)+1)
+	for _, r := range results {
+		blocks = append(blocks, anthropic.NewTextDocumentBlock(r.Title, r.Text))
+	}
+	blocks = append(blocks, anthropic.NewTextBlock(question))
+
+	messages := make([]anthropic.Message, 0, len(history)+1)
+	messages = append(messages, history...)
+	messages = append(messages, anthropic.Message{Role: "user", Content: blocks})
+
+	resp, err := s.send(ctx, purposeReply, &anthropic.Request{
+		MaxTokens: s.abilityMaxTokens[abilityIntent],
+		System:    systemPrompt + DocsGroundingInstructions,
+		Messages:  messages,
+	})
+	if err != nil {
+		s.logger.WithError(err).Warn("docs-grounded answer failed, keeping original response")
+		return nil
+	}
+
+	var sb strings.Builder
+	var citations []Citation
+	seen := make(map[string]bool)
+	for _, block := range resp.Content {
+		if block.Type != "text" {
+			continue
+		}
+		sb.WriteString(block.Text)
+		for _, c := range block.Citations {
+			citation := Citation{DocumentTitle: c.DocumentTitle, CitedText: c.CitedText}
+			if c.DocumentIndex >= 0 && c.DocumentIndex < len(results) {
+				citation.Source = results[c.DocumentIndex].Source
+				if citation.DocumentTitle == "" {
+					citation.DocumentTitle = results[c.DocumentIndex].Title
+				}
+			}
+			key := citation.DocumentTitle + "\x00" + citation.CitedText
+			if !seen[key] {
+				seen[key] = true
+				citations = append(citations, citation)
+			}
+		}
+	}
+
+	text := strings.TrimSpace(sb.String())
+	if text == "" {
+		return nil
+	}
+	return &groundedAnswer{text: text, citations: citations}
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/docs"
+)
+
+// fakeDocs returns fixed results for every search, recording the queries.
+type fakeDocs struct {
+	results []docs.Result
+	queries []string
+}
+
+func (f *fakeDocs) Search(query string, limit int, _ float64) []docs.Result {
+	f.queries = append(f.queries, query)
+	if len(f.results) > limit {
+		return f.results[:limit]
+	}
+	return f.results
+}
+
+func TestProcessMessageDocsCitations(t *testing.T) {
+	retriever := &fakeDocs{results: []docs.Result{
+		{Chunk: docs.Chunk{Source: "vaults.md", Title: "Vaults: Backups", Text: "Each key share should be backed up separately."}, Score: 4.2},
+		{Chunk: docs.Chunk{Source: "vaults.md", Title: "Vaults: What is a vault", Text: "A vault is a collection of key shares."}, Score: 2.1},
+	}}
+	model := &fakeModel{replies: []*anthropic.Response{
+		toolReply(RespondToUserTool.Name, map[string]any{
+			"intent":   "general_question",
+			"response": "Back up your vault.",
+		}),
+		{
+			StopReason: "end_turn",
+			Content: []anthropic.ContentBlock{
+				{Type: "text", Text: "Back up each key share on its own. "},
+				{Type: "text", Text: "A vault is a set of key shares.", Citations: []anthropic.Citation{
+					{Type: "char_location", CitedText: "Each key share should be backed up separately.", DocumentIndex: 0, DocumentTitle: "Vaults: Backups"},
+					// Repeated passages are listed once
+					{Type: "char_location", CitedText: "Each key share should be backed up separately.", DocumentIndex: 0, DocumentTitle: "Vaults: Backups"},
+					// A missing title falls back to the retrieved chunk's
+					{Type: "char_location", CitedText: "A vault is a collection of key shares.", DocumentIndex: 1},
+					// An index outside the attached documents keeps no source
+					{Type: "char_location", CitedText: "Unknown passage.", DocumentIndex: 7, DocumentTitle: "Elsewhere"},
+				}},
+			},
+		},
+	}}
+	msgs := &fakeMessageStore{}
+	svc := NewAgentService(Deps{
+		Anthropic:     model,
+		Messages:      msgs,
+		Conversations: &fakeConversationStore{owner: testOwner},
+		Cache:         newFakeCache(),
+		Docs:          retriever,
+		Logger:        testLogger(),
+	}, Settings{
+		Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+		Agent:   config.AgentConfig{IntentMaxTokens: 1024},
+		Docs:    config.DocsConfig{Enabled: true, MaxChunks: 3, MinScore: 1.5},
+	})
+
+	resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "how do I back up my vault?",
+	})
+	if err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(retriever.queries, []string{"how do I back up my vault?"}) {
+		t.Errorf("docs queries = %q, want the user's question", retriever.queries)
+	}
+	if len(model.requests) != 2 {
+		t.Fatalf("model got %d requests, want the intent call and the grounded answer", len(model.requests))
+	}
+	grounded := model.requests[1]
+	if grounded.MaxTokens != 1024 {
+		t.Errorf("grounded answer MaxTokens = %d, want the intent budget 1024", grounded.MaxTokens)
+	}
+	last := grounded.Messages[len(grounded.Messages)-1]
+	blocks, ok := last.Content.([]any)
+	if !ok || len(blocks) != 3 {
+		t.Fatalf("grounded question content = %#v, want two documents then the question", last.Content)
+	}
+	for i, r := range retriever.results {
+		doc, ok := blocks[i].(anthropic.DocumentBlock)
+		if !ok || doc.Title != r.Title || doc.Source.Data != r.Text || doc.Citations == nil || !doc.Citations.Enabled {
+			t.Errorf("block %d = %#v, want a citable document for %q", i, blocks[i], r.Title)
+		}
+	}
+
+	if want := "Back up each key share on its own. A vault is a set of key shares."; resp.Message.Content != want {
+		t.Errorf("reply = %q, want the grounded answer %q", resp.Message.Content, want)
+	}
+	wantCitations := []Citation{
+		{DocumentTitle: "Vaults: Backups", Source: "vaults.md", CitedText: "Each key share should be backed up separately."},
+		{DocumentTitle: "Vaults: What is a vault", Source: "vaults.md", CitedText: "A vault is a collection of key shares."},
+		{DocumentTitle: "Elsewhere", CitedText: "Unknown passage."},
+	}
+	if !reflect.DeepEqual(resp.Citations, wantCitations) {
+		t.Errorf("citations = %+v, want %+v", resp.Citations, wantCitations)
+	}
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// buildFailureTTL is how long a conversation's consecutive build failures are remembered.
+// Once it lapses, builds are attempted again.
+const buildFailureTTL = 1 * time.Hour
+
+// buildFailureKey is the Redis key counting consecutive failed policy builds in a conversation.
+func buildFailureKey(convID uuid.UUID) string {
+	return fmt.Sprintf("build_failures:%s", convID)
+}
+
+// buildPolicyTracked runs buildPolicy and counts consecutive failures per conversation.
+// Past the threshold it offers documentation and support instead of another attempt.
+// A successful build resets the count.
+func (s *AgentService) buildPolicyTracked(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, window *conversationWindow) (*SendMessageResponse, error) {
+	if s.buildFailures(ctx, convID) >= s.buildFailureLimit {
+		return s.buildHelpResponse(ctx, convID)
+	}
+
+	resp, err := s.buildPolicy(ctx, convID, req, window)
+	if err != nil {
+		if countsAsBuildFailure(err) {
+			s.recordBuildFailure(ctx, convID)
+		}
+		return nil, err
+	}
+	// A configuration the plugin rejected is answered normally but is still a failed build
+	if resp.ErrorCode == ErrorCodeInvalidConfiguration {
+		s.recordBuildFailure(ctx, convID)
+		return resp, nil
+	}
+
+	if resp.PolicyReady != nil {
+		if err := s.redis.Delete(ctx, buildFailureKey(convID)); err != nil {
+			s.logger.WithError(err).Warn("failed to reset policy build failures")
+		}
+	}
+	return resp, nil
+}
+
+// recordBuildFailure counts a failed build for the conversation.
+func (s *AgentService) recordBuildFailure(ctx context.Context, convID uuid.UUID) {
+	if _, err := s.redis.Incr(ctx, buildFailureKey(convID), buildFailureTTL); err != nil {
+		s.logger.WithError(err).Warn("failed to record policy build failure")
+	}
+}
+
+// buildFailures returns the conversation's consecutive build failure count, 0 if unknown.
+func (s *AgentService) buildFailures(ctx context.Context, convID uuid.UUID) int {
+	val, err := s.redis.Get(ctx, buildFailureKey(convID))
+	if err != nil {
+		return 0
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// countsAsBuildFailure reports whether an error means the automation couldn't be configured.
+// Request problems (wrong conversation, expired suggestion, disallowed address), a rejected
+// access token, an unreachable verifier and cancellations don't count.
+func countsAsBuildFailure(err error) bool {
+	var wrongConv *SuggestionConversationError
+	var notAllowed *AddressNotAllowedError
+	switch {
+	case errors.As(err, &wrongConv), errors.As(err, &notAllowed):
+		return false
+	case errors.Is(err, ErrSuggestionNotFound), errors.Is(err, context.Canceled):
+		return false
+	case errors.Is(err, verifier.ErrUnauthorized), errors.Is(err, verifier.ErrUnavailable):
+		return false
+	}
+	return true
+}
+
+// buildHelpResponse stores and returns a message pointing the user to documentation and
+// support after repeated failed builds.
+func (s *AgentService) buildHelpResponse(ctx context.Context, convID uuid.UUID) (*SendMessageResponse, error) {
+	blocks := s.validBlocks([]types.Block{{
+		Type:  types.BlockTypeLink,
+		Title: "Vultisig help & support",
+		URL:   s.supportURL,
+	}})
+	metadata, _ := json.Marshal(map[string]any{
+		"type":       "build_escalated",
+		"error_code": ErrorCodeBuildEscalated,
+		"blocks":     blocks,
+	})
+	msg := &types.Message{
+		ConversationID: convID,
+		Role:           types.RoleAssistant,
+		Content:        "I've tried to set this automation up a few times without success, so I'll stop retrying for now. The guides below may help, and the Vultisig support team can look into it with you. You can also try again a bit later.",
+		ContentType:    "text",
+		Metadata:       metadata,
+		Blocks:         blocks,
+	}
+	if err := s.storeAssistantMessage(ctx, msg, nil); err != nil {
+		return nil, fmt.Errorf("store help message: %w", err)
+	}
+
+	return &SendMessageResponse{
+		Message:   *msg,
+		ErrorCode: ErrorCodeBuildEscalated,
+	}, nil
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestBuildPolicyEscalation(t *testing.T) {
+	const limit = 3
+
+	tests := []struct {
+		name string
+		// failures is the count already recorded for the conversation
+		failures      int
+		verifier      *fakeVerifier
+		wantErr       error
+		wantErrorCode string
+		wantFailures  int
+		wantSchema    bool
+	}{
+		{
+			name:         "failure below the threshold is counted",
+			failures:     limit - 2,
+			verifier:     &fakeVerifier{schemaErr: errConnReset},
+			wantErr:      errConnReset,
+			wantFailures: limit - 1,
+			wantSchema:   true,
+		},
+		{
+			name:         "failure reaching the threshold is counted",
+			failures:     limit - 1,
+			verifier:     &fakeVerifier{schemaErr: errConnReset},
+			wantErr:      errConnReset,
+			wantFailures: limit,
+			wantSchema:   true,
+		},
+		{
+			name:          "rejected configuration is counted",
+			failures:      limit - 1,
+			verifier:      &fakeVerifier{schemas: map[string]*verifier.RecipeSchema{testPluginID: {}}, suggestErr: verifier.ErrInvalidConfiguration},
+			wantErrorCode: ErrorCodeInvalidConfiguration,
+			wantFailures:  limit,
+			wantSchema:    true,
+		},
+		{
+			name:         "unreachable verifier is not counted",
+			failures:     limit - 1,
+			verifier:     &fakeVerifier{schemaErr: verifier.ErrUnavailable},
+			wantErr:      verifier.ErrUnavailable,
+			wantFailures: limit - 1,
+			wantSchema:   true,
+		},
+		{
+			name:          "at the threshold the build is not attempted",
+			failures:      limit,
+			verifier:      &fakeVerifier{schemas: map[string]*verifier.RecipeSchema{testPluginID: {}}},
+			wantErrorCode: ErrorCodeBuildEscalated,
+			wantFailures:  limit,
+		},
+		{
+			name:         "success resets the count",
+			failures:     limit - 1,
+			verifier:     &fakeVerifier{schemas: map[string]*verifier.RecipeSchema{testPluginID: {}}, suggest: &verifier.PolicySuggest{}},
+			wantFailures: 0,
+			wantSchema:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convID := uuid.New()
+			cache := newFakeCache()
+			suggestion, _ := json.Marshal(Suggestion{ID: "sugg-1", PluginID: testPluginID, Title: "Recurring swap", ConversationID: convID.String()})
+			_ = cache.Set(context.Background(), "sugg-1", string(suggestion), 0)
+			for range tt.failures {
+				_, _ = cache.Incr(context.Background(), buildFailureKey(convID), buildFailureTTL)
+			}
+			msgs := &fakeMessageStore{}
+			s := NewAgentService(Deps{
+				Anthropic: &fakeModel{resp: toolReply(BuildPolicyTool.Name, map[string]any{
+					"configuration": map[string]any{"frequency": "weekly"},
+				})},
+				Messages:      msgs,
+				Conversations: &fakeConversationStore{owner: testOwner},
+				Cache:         cache,
+				Outbox:        &fakeOutbox{cache: cache},
+				Verifier:      tt.verifier,
+				Logger:        testLogger(),
+			}, Settings{
+				Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+				Agent:   config.AgentConfig{PolicyMaxTokens: 1024, BuildFailureThreshold: limit, SupportURL: "https://docs.vultisig.com"},
+			})
+			id := "sugg-1"
+
+			resp, err := s.buildPolicyTracked(context.Background(), convID, &SendMessageRequest{PublicKey: testOwner, SelectedSuggestionID: &id}, &conversationWindow{})
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("buildPolicyTracked() err = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("buildPolicyTracked() err = %v", err)
+			default:
+				if resp.ErrorCode != tt.wantErrorCode {
+					t.Errorf("ErrorCode = %q, want %q", resp.ErrorCode, tt.wantErrorCode)
+				}
+				if tt.wantErrorCode == "" && resp.PolicyReady == nil {
+					t.Error("PolicyReady = nil, want the built policy")
+				}
+			}
+
+			if got := s.buildFailures(context.Background(), convID); got != tt.wantFailures {
+				t.Errorf("build failures = %d, want %d", got, tt.wantFailures)
+			}
+			if got := len(tt.verifier.schemaCalls) > 0; got != tt.wantSchema {
+				t.Errorf("schema fetched = %v, want %v", got, tt.wantSchema)
+			}
+			if tt.wantErrorCode != ErrorCodeBuildEscalated {
+				return
+			}
+			// The help message is stored for history with a link to support
+			stored := msgs.stored()
+			if len(stored) != 1 || len(stored[0].Blocks) != 1 || stored[0].Blocks[0].Type != types.BlockTypeLink {
+				t.Fatalf("stored %+v, want one message with a support link", stored)
+			}
+			if url := stored[0].Blocks[0].URL; url != "https://docs.vultisig.com" {
+				t.Errorf("support link = %q, want the configured support URL", url)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package agent
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/vultisig/agent-backend/internal/numfmt"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+)
+
+// Parameter names recognized when explaining rule constraints.
+var (
+	amountParams    = []string{"amount", "amountin", "amount_in", "fromamount", "from_amount", "value"}
+	recipientParams = []string{"recipient", "to", "destination", "receiver"}
+	tokenParams     = []string{"token", "tokenin", "token_in", "asset", "from_asset", "fromtoken", "from_token"}
+	spenderParams   = []string{"spender"}
+)
+
+// ruleExplainer renders PolicySuggest rules into sentences the user can review before signing.
+// Balances resolve token symbols and decimals; addresses fill in the user's own address per chain.
+type ruleExplainer struct {
+	balances  []Balance
+	addresses map[string]string
+	config    map[string]any
+	format    numfmt.Formatter
+}
+
+// explainPolicy returns one sentence per rule. The rate limit window, when set, applies to
+// every rule and is appended to each sentence. Amounts are formatted for the user's locale.
+func explainPolicy(ps *verifier.PolicySuggest, configuration map[string]any, balances []Balance, addresses map[string]string, format numfmt.Formatter) []string {
+	if ps == nil || len(ps.Rules) == 0 {
+		return nil
+	}
+	e := ruleExplainer{balances: balances, addresses: addresses, config: configuration, format: format}
+	frequency := describeFrequency(ps.MaxTxsPerWindow, ps.RateLimitWindow)
+
+	summary := make([]string, 0, len(ps.Rules))
+	for _, r := range ps.Rules {
+		summary = append(summary, e.explainRule(r)+frequency+".")
+	}
+	return summary
+}
+
+// explainRule renders a single rule without the trailing frequency or period.
+func (e ruleExplainer) explainRule(r verifier.Rule) string {
+	chain, protocol, function := splitResource(r.Resource)
+	verb := "Allows"
+	if strings.EqualFold(r.Effect, "deny") {
+		verb = "Blocks"
+	}
+
+	constraints := make(map[string]verifier.Constraint, len(r.ParameterConstraints))
+	for _, pc := range r.ParameterConstraints {
+		constraints[strings.ToLower(pc.ParameterName)] = pc.Constraint
+	}
+
+	token := e.resolveToken(chain, protocol, constraints)
+	amountConstraint, hasAmount := findConstraint(constraints, amountParams)
+	amount := describeAmount(amountConstraint, hasAmount, token, e.format)
+	from := e.describeFromAddress(chain)
+	fn := strings.ToLower(function)
+
+	switch {
+	case strings.Contains(fn, "swap"):
+		return fmt.Sprintf("%s swapping %s%s", verb, amount, from)
+	case strings.Contains(fn, "transfer") || strings.Contains(fn, "send"):
+		sentence := fmt.Sprintf("%s sending %s%s", verb, amount, from)
+		if c, ok := findConstraint(constraints, recipientParams); ok && c.FixedValue != "" {
+			sentence += " to " + shortenAddress(c.FixedValue)
+		} else if r.Target != nil && r.Target.Address != "" && !strings.EqualFold(protocol, "erc20") {
+			sentence += " to " + shortenAddress(r.Target.Address)
+		}
+		return sentence
+	case strings.Contains(fn, "approve"):
+		spender := "a contract"
+		if c, ok := findConstraint(constraints, spenderParams); ok && c.FixedValue != "" {
+			spender = shortenAddress(c.FixedValue)
+		}
+		return fmt.Sprintf("%s approving %s to spend %s%s", verb, spender, amount, from)
+	default:
+		sentence := fmt.Sprintf("%s the action %q", verb, r.Resource)
+		if chain != "" {
+			sentence += " on " + titleCase(chain)
+		}
+		if r.Target != nil && r.Target.Address != "" {
+			sentence += " against " + shortenAddress(r.Target.Address)
+		}
+		return sentence
+	}
+}
+
+// tokenInfo identifies the asset a rule moves.
+type tokenInfo struct {
+	symbol   string
+	decimals int
+	known    bool
+}
+
+// resolveToken finds the rule's asset from its token constraint, falling back to the chain's
+// native asset when the protocol names it (e.g. "ethereum.eth.transfer").
+func (e ruleExplainer) resolveToken(chain, protocol string, constraints map[string]verifier.Constraint) tokenInfo {
+	if c, ok := findConstraint(constraints, tokenParams); ok && c.FixedValue != "" {
+		for _, b := range e.balances {
+			if strings.EqualFold(b.Asset, c.FixedValue) || strings.EqualFold(b.Symbol, c.FixedValue) {
+				return tokenInfo{symbol: b.Symbol, decimals: b.Decimals, known: true}
+			}
+		}
+		if token, ok := knownTokens[normalizeChain(chain)][strings.ToLower(c.FixedValue)]; ok {
+			return tokenInfo{symbol: token.symbol, decimals: token.decimals, known: true}
+		}
+		return tokenInfo{symbol: "token " + shortenAddress(c.FixedValue)}
+	}
+
+	for _, b := range e.balances {
+		if strings.EqualFold(b.Chain, chain) && strings.EqualFold(b.Symbol, protocol) {
+			return tokenInfo{symbol: b.Symbol, decimals: b.Decimals, known: true}
+		}
+	}
+	if protocol != "" && !strings.EqualFold(protocol, "erc20") {
+		if decimals, ok := assetDecimals(chain, protocol); ok {
+			return tokenInfo{symbol: strings.ToUpper(protocol), decimals: decimals, known: true}
+		}
+		return tokenInfo{symbol: strings.ToUpper(protocol)}
+	}
+	return tokenInfo{symbol: "tokens"}
+}
+
+// describeFromAddress names the user's own address on chain, if known.
+func (e ruleExplainer) describeFromAddress(chain string) string {
+	if chain == "" {
+		return ""
+	}
+	for c, addr := range e.addresses {
+		if strings.EqualFold(c, chain) && addr != "" {
+			return fmt.Sprintf(" from your %s address %s", titleCase(chain), shortenAddress(addr))
+		}
+	}
+	if from, ok := e.config["from"].(map[string]any); ok {
+		if addr, ok := from["address"].(string); ok && addr != "" {
+			return fmt.Sprintf(" from your %s address %s", titleCase(chain), shortenAddress(addr))
+		}
+	}
+	return fmt.Sprintf(" from your %s wallet", titleCase(chain))
+}
+
+// describeAmount renders an amount constraint such as "up to 100 USDC".
+func describeAmount(c verifier.Constraint, found bool, token tokenInfo, format numfmt.Formatter) string {
+	if !found || c.FixedValue == "" {
+		return "any amount of " + token.symbol
+	}
+
+	var amount string
+	if token.known {
+		amount = format.Asset(fromBaseUnits(c.FixedValue, token.decimals), token.symbol, assetClass(token.symbol))
+	} else {
+		amount = format.Number(c.FixedValue, 0) + " base units of " + token.symbol
+	}
+
+	switch strings.ToLower(c.Type) {
+	case "max":
+		return "up to " + amount
+	case "min":
+		return "at least " + amount
+	default:
+		return amount
+	}
+}
+
+// describeFrequency renders the rate limit window, e.g. " once per week".
+func describeFrequency(maxTxs, windowSeconds int) string {
+	if maxTxs <= 0 || windowSeconds <= 0 {
+		return ""
+	}
+
+	times := fmt.Sprintf("up to %d times", maxTxs)
+	switch maxTxs {
+	case 1:
+		times = "once"
+	case 2:
+		times = "up to twice"
+	}
+	return " " + times + " per " + describeWindow(windowSeconds)
+}
+
+func describeWindow(seconds int) string {
+	units := []struct {
+		seconds int
+		name    string
+	}{
+		{7 * 24 * 3600, "week"},
+		{24 * 3600, "day"},
+		{3600, "hour"},
+		{60, "minute"},
+	}
+	for _, u := range units {
+		if seconds%u.seconds == 0 {
+			n := seconds / u.seconds
+			if n == 1 {
+				return u.name
+			}
+			return fmt.Sprintf("%d %ss", n, u.name)
+		}
+	}
+	return fmt.Sprintf("%d seconds", seconds)
+}
+
+// fromBaseUnits converts a base-unit integer string to a human-readable decimal, e.g.
+// "100000000" with 6 decimals becomes "100". Non-integer input is returned unchanged.
+func fromBaseUnits(baseUnits string, decimals int) string {
+	n, ok := new(big.Int).SetString(baseUnits, 10)
+	if !ok || decimals < 0 {
+		return baseUnits
+	}
+	r := new(big.Rat).SetFrac(n, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	s := r.FloatString(decimals)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// splitResource splits "chain.protocol.function" resource paths.
+func splitResource(resource string) (chain, protocol, function string) {
+	parts := strings.SplitN(resource, ".", 3)
+	switch len(parts) {
+	case 3:
+		return parts[0], parts[1], parts[2]
+	case 2:
+		return parts[0], "", parts[1]
+	default:
+		return "", "", resource
+	}
+}
+
+func findConstraint(constraints map[string]verifier.Constraint, names []string) (verifier.Constraint, bool) {
+	for _, name := range names {
+		if c, ok := constraints[name]; ok {
+			return c, true
+		}
+	}
+	return verifier.Constraint{}, false
+}
+
+// shortenAddress abbreviates long addresses to "0x12…ab" form.
+func shortenAddress(addr string) string {
+	if len(addr) <= 12 {
+		return addr
+	}
+	return addr[:4] + "…" + addr[len(addr)-2:]
+}
+
+func titleCase(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
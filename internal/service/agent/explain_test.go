@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/vultisig/agent-backend/internal/numfmt"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+)
+
+const (
+	testUSDC      = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+	testEVMOwner  = "0x1234567890abcdef1234567890abcdef123456ab"
+	testRecipient = "0x9876543210fedcba9876543210fedcba98765432"
+)
+
+func fixed(name, value string) verifier.ParameterConstraint {
+	return verifier.ParameterConstraint{ParameterName: name, Constraint: verifier.Constraint{Type: "fixed", FixedValue: value}}
+}
+
+func maxOf(name, value string) verifier.ParameterConstraint {
+	return verifier.ParameterConstraint{ParameterName: name, Constraint: verifier.Constraint{Type: "max", FixedValue: value}}
+}
+
+func TestExplainPolicy(t *testing.T) {
+	addresses := map[string]string{"Ethereum": testEVMOwner}
+	balances := []Balance{{Chain: "Ethereum", Asset: "", Symbol: "ETH", Amount: "1.5", Decimals: 18}}
+
+	tests := []struct {
+		name   string
+		ps     *verifier.PolicySuggest
+		config map[string]any
+		locale string
+		want   []string
+	}{
+		{
+			name: "swap up to an ERC-20 amount once per week",
+			ps: &verifier.PolicySuggest{
+				Rules: []verifier.Rule{{
+					Resource:             "ethereum.thorchain.swap",
+					ParameterConstraints: []verifier.ParameterConstraint{fixed("token", testUSDC), maxOf("amount", "100000000")},
+				}},
+				MaxTxsPerWindow: 1,
+				RateLimitWindow: 7 * 24 * 3600,
+			},
+			want: []string{"Allows swapping up to 100 USDC from your Ethereum address 0x12…ab once per week."},
+		},
+		{
+			name: "native transfer with a fixed recipient, twice a day",
+			ps: &verifier.PolicySuggest{
+				Rules: []verifier.Rule{{
+					Resource:             "ethereum.eth.transfer",
+					ParameterConstraints: []verifier.ParameterConstraint{fixed("amount", "50000000000000000"), fixed("recipient", testRecipient)},
+				}},
+				MaxTxsPerWindow: 2,
+				RateLimitWindow: 24 * 3600,
+			},
+			want: []string{"Allows sending 0.05 ETH from your Ethereum address 0x12…ab to 0x98…32 up to twice per day."},
+		},
+		{
+			name: "transfer without amount or window",
+			ps: &verifier.PolicySuggest{
+				Rules: []verifier.Rule{{Resource: "bitcoin.btc.transfer"}},
+			},
+			want: []string{"Allows sending any amount of BTC from your Bitcoin wallet."},
+		},
+		{
+			name: "unknown token amount stays in base units",
+			ps: &verifier.PolicySuggest{
+				Rules: []verifier.Rule{{
+					Resource:             "ethereum.erc20.transfer",
+					ParameterConstraints: []verifier.ParameterConstraint{fixed("token", testRecipient), fixed("amount", "1234567")},
+				}},
+				MaxTxsPerWindow: 5,
+				RateLimitWindow: 2 * 3600,
+			},
+			want: []string{"Allows sending 1,234,567 base units of token 0x98…32 from your Ethereum address 0x12…ab up to 5 times per 2 hours."},
+		},
+		{
+			name: "window that isn't a whole minute",
+			ps: &verifier.PolicySuggest{
+				Rules:           []verifier.Rule{{Resource: "ethereum.eth.transfer", ParameterConstraints: []verifier.ParameterConstraint{fixed("amount", "1000000000000000000")}}},
+				MaxTxsPerWindow: 3,
+				RateLimitWindow: 90,
+			},
+			want: []string{"Allows sending 1 ETH from your Ethereum address 0x12…ab up to 3 times per 90 seconds."},
+		},
+		{
+			name: "amounts in the user's locale",
+			ps: &verifier.PolicySuggest{
+				Rules: []verifier.Rule{{
+					Resource:             "ethereum.eth.transfer",
+					ParameterConstraints: []verifier.ParameterConstraint{maxOf("amount", "1250000000000000000000")},
+				}},
+			},
+			locale: "de-DE",
+			want:   []string{"Allows sending up to 1.250 ETH from your Ethereum address 0x12…ab."},
+		},
+		{
+			name: "deny rule and unknown resource, window on each",
+			ps: &verifier.PolicySuggest{
+				Rules: []verifier.Rule{
+					{Resource: "ethereum.eth.swap", Effect: "DENY"},
+					{Resource: "ethereum.vault.rebalance", Target: &verifier.Target{Address: testRecipient}},
+				},
+				MaxTxsPerWindow: 1,
+				RateLimitWindow: 3600,
+			},
+			want: []string{
+				"Blocks swapping any amount of ETH from your Ethereum address 0x12…ab once per hour.",
+				`Allows the action "ethereum.vault.rebalance" on Ethereum against 0x98…32 once per hour.`,
+			},
+		},
+		{
+			name: "sender taken from the configuration",
+			ps: &verifier.PolicySuggest{
+				Rules: []verifier.Rule{{Resource: "arbitrum.eth.transfer"}},
+			},
+			config: map[string]any{"from": map[string]any{"address": testRecipient}},
+			want:   []string{"Allows sending any amount of ETH from your Arbitrum address 0x98…32."},
+		},
+		{
+			name: "no rules",
+			ps:   &verifier.PolicySuggest{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := numfmt.New(tt.locale, numfmt.Precision{Crypto: 8, Stablecoin: 2, Fiat: 2})
+			got := explainPolicy(tt.ps, tt.config, balances, addresses, format)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("explainPolicy() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromBaseUnits(t *testing.T) {
+	tests := []struct {
+		baseUnits string
+		decimals  int
+		want      string
+	}{
+		{"100000000", 6, "100"},
+		{"123456789", 6, "123.456789"},
+		{"50000000000000000", 18, "0.05"},
+		{"1", 18, "0.000000000000000001"},
+		{"0", 8, "0"},
+		{"42", 0, "42"},
+		{"not-a-number", 6, "not-a-number"},
+	}
+	for _, tt := range tests {
+		if got := fromBaseUnits(tt.baseUnits, tt.decimals); got != tt.want {
+			t.Errorf("fromBaseUnits(%q, %d) = %q, want %q", tt.baseUnits, tt.decimals, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ConversationExport is a conversation as operators export it, and the body the admin
+// import takes back, so a user's conversation can be reproduced locally or migrated.
+type ConversationExport struct {
+	PublicKey string  `json:"public_key"`
+	Title     *string `json:"title,omitempty"`
+	// Summary and SummaryUpTo are set together; messages up to the cursor are covered by
+	// the summary instead of the context window
+	Summary     *string           `json:"summary,omitempty"`
+	SummaryUpTo *time.Time        `json:"summary_up_to,omitempty"`
+	Messages    []ExportedMessage `json:"messages"`
+}
+
+// ExportedMessage is one message of an exported conversation.
+type ExportedMessage struct {
+	Role        string          `json:"role"`
+	Content     string          `json:"content"`
+	ContentType string          `json:"content_type"`
+	Metadata    json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// ExportConversation returns a conversation, whoever owns it, with its messages and summary.
+// Deleted messages are left out. Returns postgres.ErrNotFound for unknown conversations.
+func (s *AgentService) ExportConversation(ctx context.Context, convID uuid.UUID) (*ConversationExport, error) {
+	conv, err := s.convRepo.GetForAdmin(ctx, convID)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := s.msgRepo.GetByConversationID(ctx, convID)
+	if err != nil {
+		return nil, fmt.Errorf("get messages: %w", err)
+	}
+
+	out := &ConversationExport{
+		PublicKey:   conv.PublicKey,
+		Title:       conv.Title,
+		Summary:     conv.Summary,
+		SummaryUpTo: conv.SummaryUpTo,
+		Messages:    make([]ExportedMessage, len(msgs)),
+	}
+	for i, msg := range msgs {
+		out.Messages[i] = ExportedMessage{
+			Role:        string(msg.Role),
+			Content:     msg.Content,
+			ContentType: msg.ContentType,
+			Metadata:    msg.Metadata,
+			CreatedAt:   msg.CreatedAt,
+		}
+	}
+	return out, nil
+}
+
+// ImportExport creates a conversation from an export, keeping message content types,
+// metadata, timestamps and order as well as the summary and its cursor. Unlike the user
+// import nothing is summarized, so the conversation is in the state it was exported in.
+// Invalid payloads are rejected whole with an *ImportValidationError.
+func (s *AgentService) ImportExport(ctx context.Context, in *ConversationExport) (*types.Conversation, error) {
+	msgs, err := exportedMessages(in.Messages, s.hardMaxMessages, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if (in.Summary == nil) != (in.SummaryUpTo == nil) {
+		return nil, &ImportValidationError{Index: -1, Reason: "summary and summary_up_to must be set together"}
+	}
+	var summaryUpTo time.Time
+	if in.SummaryUpTo != nil {
+		summaryUpTo = in.SummaryUpTo.UTC().Truncate(time.Microsecond)
+	}
+
+	conv, err := s.convRepo.Import(ctx, in.PublicKey, in.Title, in.Summary, summaryUpTo, msgs)
+	if err != nil {
+		return nil, fmt.Errorf("import conversation: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"conversation_id": conv.ID,
+		"messages":        len(msgs),
+		"summary":         in.Summary != nil,
+	}).Info("conversation imported from export")
+	return conv, nil
+}
+
+// exportedMessages validates the messages of an export and converts them. As in the user
+// import, timestamps must not be in the future or go backwards, and equal ones are spread
+// a microsecond apart to keep the order.
+func exportedMessages(in []ExportedMessage, limit int, now time.Time) ([]types.Message, error) {
+	if len(in) == 0 {
+		return nil, &ImportValidationError{Index: -1, Reason: "no messages to import"}
+	}
+	if len(in) > limit {
+		return nil, &ImportValidationError{Index: -1, Reason: fmt.Sprintf("at most %d messages can be imported", limit)}
+	}
+
+	msgs := make([]types.Message, 0, len(in))
+	var prevTimestamp, prev time.Time
+	for i, m := range in {
+		role := types.MessageRole(m.Role)
+		if role != types.RoleUser && role != types.RoleAssistant && role != types.RoleSystem {
+			return nil, &ImportValidationError{Index: i, Reason: "role must be user, assistant or system"}
+		}
+		if m.ContentType == "" || m.ContentType == "deleted" {
+			return nil, &ImportValidationError{Index: i, Reason: "content_type is required and can't be deleted"}
+		}
+		if len(m.Metadata) > 0 && !json.Valid(m.Metadata) {
+			return nil, &ImportValidationError{Index: i, Reason: "metadata is not valid JSON"}
+		}
+		if m.CreatedAt.IsZero() {
+			return nil, &ImportValidationError{Index: i, Reason: "created_at is required"}
+		}
+		if m.CreatedAt.After(now.Add(importClockSkew)) {
+			return nil, &ImportValidationError{Index: i, Reason: "created_at is in the future"}
+		}
+		if m.CreatedAt.Before(prevTimestamp) {
+			return nil, &ImportValidationError{Index: i, Reason: "created_at is before the previous message"}
+		}
+		prevTimestamp = m.CreatedAt
+
+		createdAt := m.CreatedAt.UTC().Truncate(time.Microsecond)
+		if !prev.IsZero() && !createdAt.After(prev) {
+			createdAt = prev.Add(time.Microsecond)
+		}
+		prev = createdAt
+
+		msgs = append(msgs, types.Message{
+			Role:        role,
+			Content:     m.Content,
+			ContentType: m.ContentType,
+			Metadata:    m.Metadata,
+			CreatedAt:   createdAt,
+		})
+	}
+	return msgs, nil
+}
@@ -0,0 +1,428 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/service/outbox"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// testLogger returns a logger that discards its output.
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// fakeConversationStore serves a single conversation owned by owner. Methods a test doesn't
+// use fall through to the nil embedded interface and panic.
+type fakeConversationStore struct {
+	ConversationStore
+	owner    string
+	summary  *string
+	cursor   *time.Time
+	noMemory bool
+
+	stats      *types.UserStats
+	statsCalls []statsCall
+
+	// summaryUpdates holds the cursor of every stored summary, in order
+	summaryUpdates []time.Time
+
+	mu     sync.Mutex
+	tags   []string
+	titles []string
+}
+
+// statsCall records the arguments of a Stats call.
+type statsCall struct {
+	publicKey, automationAction string
+	confidenceSince             time.Time
+}
+
+func (f *fakeConversationStore) GetByID(_ context.Context, id uuid.UUID, publicKey string) (*types.Conversation, error) {
+	if publicKey != f.owner {
+		return nil, postgres.ErrNotFound
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &types.Conversation{ID: id, PublicKey: publicKey, Tags: slices.Clone(f.tags)}, nil
+}
+
+func (f *fakeConversationStore) GetSummaryWithCursor(_ context.Context, _ uuid.UUID, publicKey string) (*string, *time.Time, error) {
+	if publicKey != f.owner {
+		return nil, nil, postgres.ErrNotFound
+	}
+	return f.summary, f.cursor, nil
+}
+
+func (f *fakeConversationStore) UpdateSummaryWithCursor(_ context.Context, _ uuid.UUID, _ string, summary string, summaryUpTo time.Time) error {
+	f.summary = &summary
+	f.cursor = &summaryUpTo
+	f.summaryUpdates = append(f.summaryUpdates, summaryUpTo)
+	return nil
+}
+
+func (f *fakeConversationStore) UpdateTags(_ context.Context, _ uuid.UUID, _ string, tags []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tags = tags
+	return nil
+}
+
+func (f *fakeConversationStore) UpdateTitle(_ context.Context, _ uuid.UUID, _ string, title string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.titles = append(f.titles, title)
+	return nil
+}
+
+func (f *fakeConversationStore) NoMemory(context.Context, uuid.UUID, string) (bool, error) {
+	return f.noMemory, nil
+}
+
+func (f *fakeConversationStore) Stats(_ context.Context, publicKey, automationAction string, confidenceSince time.Time) (*types.UserStats, error) {
+	f.statsCalls = append(f.statsCalls, statsCall{publicKey, automationAction, confidenceSince})
+	return f.stats, nil
+}
+
+// fakeMessageStore holds the messages of one conversation; total is what
+// CountByConversationID reports, so tests can simulate a full conversation cheaply.
+type fakeMessageStore struct {
+	MessageStore
+	messages []types.Message
+	total    int
+	counts   int
+
+	mu      sync.Mutex
+	created []types.Message
+}
+
+func (f *fakeMessageStore) CountByConversationID(context.Context, uuid.UUID) (int, error) {
+	f.counts++
+	return f.total, nil
+}
+
+func (f *fakeMessageStore) CountSince(_ context.Context, _ uuid.UUID, since time.Time) (int, error) {
+	msgs, _ := f.GetSince(context.Background(), uuid.Nil, since)
+	return len(msgs), nil
+}
+
+func (f *fakeMessageStore) GetSince(_ context.Context, _ uuid.UUID, since time.Time) ([]types.Message, error) {
+	var msgs []types.Message
+	for _, m := range f.messages {
+		if m.CreatedAt.After(since) {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
+
+func (f *fakeMessageStore) GetRecentSince(ctx context.Context, convID uuid.UUID, since time.Time, limit int) ([]types.Message, error) {
+	msgs, _ := f.GetSince(ctx, convID, since)
+	return msgs[max(0, len(msgs)-limit):], nil
+}
+
+func (f *fakeMessageStore) GetRecent(_ context.Context, _ uuid.UUID, limit int) ([]types.Message, error) {
+	return f.messages[max(0, len(f.messages)-limit):], nil
+}
+
+func (f *fakeMessageStore) GetByID(_ context.Context, _ uuid.UUID, id uuid.UUID) (*types.Message, error) {
+	for _, m := range f.messages {
+		if m.ID == id {
+			return &m, nil
+		}
+	}
+	return nil, postgres.ErrNotFound
+}
+
+func (f *fakeMessageStore) GetByConversationID(context.Context, uuid.UUID) ([]types.Message, error) {
+	return f.messages, nil
+}
+
+func (f *fakeMessageStore) Create(_ context.Context, msg *types.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg.ID = uuid.New()
+	msg.CreatedAt = time.Now()
+	f.created = append(f.created, *msg)
+	return nil
+}
+
+func (f *fakeMessageStore) CreateWithOutbox(ctx context.Context, msg *types.Message, _ []*types.OutboxEvent, _ time.Time) error {
+	return f.Create(ctx, msg)
+}
+
+func (f *fakeMessageStore) CreateIfOwned(ctx context.Context, msg *types.Message, _ string) error {
+	return f.Create(ctx, msg)
+}
+
+// stored returns the messages created so far.
+func (f *fakeMessageStore) stored() []types.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.created)
+}
+
+// fakeOutbox delivers redis_set events to a cache right away, like the outbox fast path.
+type fakeOutbox struct {
+	cache Cache
+}
+
+func (f *fakeOutbox) DispatchAfter() time.Time { return time.Now() }
+
+func (f *fakeOutbox) Deliver(ctx context.Context, events []*types.OutboxEvent) {
+	for _, event := range events {
+		var p outbox.RedisSet
+		if event.Kind == outbox.KindRedisSet && json.Unmarshal(event.Payload, &p) == nil {
+			_ = f.cache.Set(ctx, p.Key, p.Value, time.Duration(p.TTLSeconds)*time.Second)
+		}
+	}
+}
+
+// fakeModel answers model requests from a fixed response or error, recording the requests.
+// Scripted replies, when set, are returned in order before resp.
+type fakeModel struct {
+	resp    *anthropic.Response
+	err     error
+	replies []*anthropic.Response
+
+	mu       sync.Mutex
+	requests []*anthropic.Request
+}
+
+func (f *fakeModel) SendMessage(_ context.Context, req *anthropic.Request) (*anthropic.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(f.replies) > 0 {
+		resp := f.replies[0]
+		f.replies = f.replies[1:]
+		return resp, nil
+	}
+	return f.resp, nil
+}
+
+// toolReply returns a model response calling the tool name with input.
+func toolReply(name string, input any) *anthropic.Response {
+	data, _ := json.Marshal(input)
+	return &anthropic.Response{
+		StopReason: "tool_use",
+		Content:    []anthropic.ContentBlock{{Type: "tool_use", ID: "toolu_1", Name: name, Input: data}},
+	}
+}
+
+// errCacheMiss is returned by fakeCache for missing keys, like redis.Nil.
+var errCacheMiss = errors.New("cache miss")
+
+// fakeCache is an in-memory Cache; TTLs are ignored. Published messages are handed to the
+// current subscribers synchronously.
+type fakeCache struct {
+	mu          sync.Mutex
+	values      map[string]string
+	hashes      map[string]map[string]string
+	subscribers map[string][]func(string)
+}
+
+func newFakeCache() *fakeCache {
+	return &fakeCache{
+		values:      make(map[string]string),
+		hashes:      make(map[string]map[string]string),
+		subscribers: make(map[string][]func(string)),
+	}
+}
+
+func (c *fakeCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	if !ok {
+		return "", errCacheMiss
+	}
+	return v, nil
+}
+
+func (c *fakeCache) Set(_ context.Context, key, value string, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+	return nil
+}
+
+func (c *fakeCache) SetNX(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+	c.values[key] = value
+	return true, nil
+}
+
+func (c *fakeCache) Exists(_ context.Context, key string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.values[key]
+	return ok, nil
+}
+
+func (c *fakeCache) ExistsMany(_ context.Context, keys []string) ([]bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	exists := make([]bool, len(keys))
+	for i, key := range keys {
+		_, exists[i] = c.values[key]
+	}
+	return exists, nil
+}
+
+func (c *fakeCache) SetMany(_ context.Context, values map[string]string, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	maps.Copy(c.values, values)
+	return nil
+}
+
+func (c *fakeCache) Incr(_ context.Context, key string, _ time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, _ := strconv.ParseInt(c.values[key], 10, 64)
+	n++
+	c.values[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (c *fakeCache) HIncr(_ context.Context, key, field string, _ time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h := c.hashes[key]
+	if h == nil {
+		h = make(map[string]string)
+		c.hashes[key] = h
+	}
+	n, _ := strconv.ParseInt(h[field], 10, 64)
+	n++
+	h[field] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (c *fakeCache) HGetAll(_ context.Context, key string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hashes[key], nil
+}
+
+func (c *fakeCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+	return nil
+}
+
+func (c *fakeCache) DeleteIfEqual(_ context.Context, key, value string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values[key] != value {
+		return false, nil
+	}
+	delete(c.values, key)
+	return true, nil
+}
+
+func (c *fakeCache) Publish(_ context.Context, channel, message string) error {
+	c.mu.Lock()
+	handlers := slices.Clone(c.subscribers[channel])
+	c.mu.Unlock()
+	for _, handle := range handlers {
+		handle(message)
+	}
+	return nil
+}
+
+func (c *fakeCache) Subscribe(ctx context.Context, channel string, handle func(payload string)) error {
+	c.mu.Lock()
+	c.subscribers[channel] = append(c.subscribers[channel], handle)
+	c.mu.Unlock()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// subscribed reports how many subscribers channel has.
+func (c *fakeCache) subscribed(channel string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.subscribers[channel])
+}
+
+// fakeVerifier answers from fixed installed plugins and schemas, recording the calls made.
+type fakeVerifier struct {
+	installed  []string
+	installErr error
+	schemas    map[string]*verifier.RecipeSchema
+	schemaErr  error
+	suggest    *verifier.PolicySuggest
+	suggestErr error
+	// delay is added to every install check and schema fetch
+	delay time.Duration
+
+	mu          sync.Mutex
+	installCall int
+	schemaCalls []string
+}
+
+func (f *fakeVerifier) InstalledPluginIDs(context.Context, string) ([]string, error) {
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.installCall++
+	if f.installErr != nil {
+		return nil, f.installErr
+	}
+	return slices.Clone(f.installed), nil
+}
+
+func (f *fakeVerifier) GetRecipeSchema(_ context.Context, pluginID string) (*verifier.RecipeSchema, error) {
+	time.Sleep(f.delay)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.schemaCalls = append(f.schemaCalls, pluginID)
+	if f.schemaErr != nil {
+		return nil, f.schemaErr
+	}
+	schema, ok := f.schemas[pluginID]
+	if !ok {
+		return nil, verifier.ErrPluginNotFound
+	}
+	return schema, nil
+}
+
+func (f *fakeVerifier) GetPolicySuggest(context.Context, string, map[string]any) (*verifier.PolicySuggest, error) {
+	return f.suggest, f.suggestErr
+}
+
+// fakeSkillsProvider serves fixed plugin skills.
+type fakeSkillsProvider struct {
+	skills     []PluginSkill
+	generation uint64
+}
+
+func (f *fakeSkillsProvider) GetSkills(context.Context) []PluginSkill { return f.skills }
+
+func (f *fakeSkillsProvider) SkillsGeneration() uint64 { return f.generation }
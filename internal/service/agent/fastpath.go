@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+const (
+	// fastPathMaxChars and fastPathMaxWords bound what counts as a trivial message.
+	fastPathMaxChars = 40
+	fastPathMaxWords = 5
+	// fastPathHistory is how many recent messages the fast-path model call sees.
+	fastPathHistory = 4
+	// fastPathMaxTokens caps fast-path replies.
+	fastPathMaxTokens = 256
+)
+
+// cannedReplies answers acknowledgments without a model call, keyed by normalized message.
+var cannedReplies = map[string]string{
+	"thanks":            "You're welcome! Let me know if there's anything else I can help with.",
+	"thank you":         "You're welcome! Let me know if there's anything else I can help with.",
+	"thanks a lot":      "You're welcome! Let me know if there's anything else I can help with.",
+	"thank you so much": "You're welcome! Let me know if there's anything else I can help with.",
+	"thx":               "You're welcome! Let me know if there's anything else I can help with.",
+	"ty":                "You're welcome! Let me know if there's anything else I can help with.",
+	"ok":                "Sounds good. Let me know if there's anything else you need.",
+	"okay":              "Sounds good. Let me know if there's anything else you need.",
+	"got it":            "Sounds good. Let me know if there's anything else you need.",
+	"cool":              "Sounds good. Let me know if there's anything else you need.",
+	"great":             "Glad to help! Let me know if there's anything else you need.",
+	"nice":              "Glad to help! Let me know if there's anything else you need.",
+	"perfect":           "Glad to help! Let me know if there's anything else you need.",
+	"awesome":           "Glad to help! Let me know if there's anything else you need.",
+}
+
+// fastPathBlockWords are words that mean a message may need tools, wallet context or a
+// policy flow, so it never takes the fast path. Yes/no style answers are included since
+// they usually answer something the assistant asked.
+var fastPathBlockWords = map[string]bool{
+	"send": true, "swap": true, "buy": true, "sell": true, "transfer": true, "bridge": true,
+	"stake": true, "unstake": true, "withdraw": true, "deposit": true, "pay": true,
+	"balance": true, "balances": true, "price": true, "fee": true, "fees": true, "gas": true,
+	"wallet": true, "vault": true, "address": true, "token": true, "tokens": true, "coin": true,
+	"coins": true, "crypto": true, "btc": true, "bitcoin": true, "eth": true, "ethereum": true,
+	"sol": true, "solana": true, "usdc": true, "usdt": true, "rune": true, "thorchain": true,
+	"policy": true, "policies": true, "plugin": true, "install": true, "dca": true,
+	"recurring": true, "schedule": true, "automate": true, "automation": true, "tx": true,
+	"transaction": true, "remember": true, "forget": true, "contact": true, "contacts": true,
+	"yes": true, "no": true, "yep": true, "nope": true, "sure": true, "do": true, "confirm": true,
+	"cancel": true, "stop": true, "help": true,
+}
+
+// trivialMessage reports whether a message is small talk that needs neither tools nor
+// context: short, no question, no digits and no wallet or flow vocabulary. The canned reply
+// is set when the message is a plain acknowledgment that needs no model call at all.
+func trivialMessage(content string) (canned string, ok bool) {
+	content = strings.TrimSpace(content)
+	if content == "" || len(content) > fastPathMaxChars || strings.ContainsAny(content, "?@#$/:") {
+		return "", false
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	if len(words) == 0 || len(words) > fastPathMaxWords {
+		return "", false
+	}
+	for _, w := range words {
+		if fastPathBlockWords[w] || strings.IndexFunc(w, unicode.IsDigit) >= 0 {
+			return "", false
+		}
+	}
+	return cannedReplies[strings.Join(words, " ")], true
+}
+
+// fastPathAllowed reports whether a message can skip tools and context assembly. Besides
+// the message being trivial, the conversation must not be mid-flow: no policy build waiting
+// on a plugin install, and the last assistant reply didn't offer suggestions, carry a flow
+// payload such as policy_ready, or ask the user something.
+func (s *AgentService) fastPathAllowed(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, window *conversationWindow) bool {
+	if _, ok := trivialMessage(req.Content); !ok || len(req.Attachments) > 0 {
+		return false
+	}
+	if last := lastAssistantMessage(window); last != nil && midFlow(last) {
+		return false
+	}
+	pending, err := s.redis.Exists(ctx, pendingBuildKey(convID))
+	if err != nil || pending {
+		return false
+	}
+	return true
+}
+
+// lastAssistantMessage returns the most recent assistant message in the window, if any.
+func lastAssistantMessage(window *conversationWindow) *types.Message {
+	for i := len(window.messages) - 1; i >= 0; i-- {
+		if window.messages[i].Role == types.RoleAssistant {
+			return &window.messages[i]
+		}
+	}
+	return nil
+}
+
+// midFlow reports whether an assistant message leaves the conversation waiting on the user.
+func midFlow(msg *types.Message) bool {
+	if strings.Contains(msg.Content, "?") {
+		return true
+	}
+	if len(msg.Metadata) == 0 {
+		return false
+	}
+	var meta struct {
+		Type        string            `json:"type"`
+		Suggestions []json.RawMessage `json:"suggestions"`
+	}
+	if err := json.Unmarshal(msg.Metadata, &meta); err != nil {
+		return true
+	}
+	return (meta.Type != "" && meta.Type != "error") || len(meta.Suggestions) > 0
+}
+
+// replyFast answers a trivial message with a canned reply, or a minimal summary-model call
+// with no tools and only the last few messages. Messages are persisted like any other turn.
+func (s *AgentService) replyFast(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, window *conversationWindow) (_ *SendMessageResponse, err error) {
+	userMsg := &types.Message{
+		ConversationID: convID,
+		Role:           types.RoleUser,
+		Content:        req.Content,
+		ContentType:    "text",
+		Metadata:       markNoMemory(ctx, nil),
+	}
+	if err := s.msgRepo.CreateIfOwned(ctx, userMsg, req.PublicKey); err != nil {
+		return nil, fmt.Errorf("store user message: %w", err)
+	}
+	noteWrite(ctx, userMsg)
+	s.indexMessage(ctx, userMsg)
+	// From here on a failure would leave the user message unanswered
+	defer func() {
+		if err != nil {
+			s.storeErrorReply(ctx, convID, userMsg.ID, true)
+		}
+	}()
+
+	text, _ := trivialMessage(req.Content)
+	if text == "" {
+		text, err = s.fastPathCompletion(ctx, window, req.Content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	text, truncated := s.processResponse(text)
+
+	meta := map[string]any{"fast_path": true}
+	if truncated {
+		meta["truncated"] = true
+	}
+	metadata, _ := json.Marshal(meta)
+	assistantMsg := &types.Message{
+		ConversationID: convID,
+		Role:           types.RoleAssistant,
+		Content:        text,
+		ContentType:    "text",
+		AudioURL:       s.replyAudio(ctx, convID, req, text),
+		Metadata:       metadata,
+	}
+	if err := s.storeAssistantMessage(ctx, assistantMsg, nil); err != nil {
+		return nil, fmt.Errorf("store assistant message: %w", err)
+	}
+
+	// Update conversation title if this is the first exchange
+	if window.total <= 2 {
+		s.setInitialTitle(ctx, convID, req.PublicKey, req.Content, text)
+	}
+
+	return &SendMessageResponse{
+		Message:           *assistantMsg,
+		RolloverSuggested: window.rolloverSuggested,
+	}, nil
+}
+
+// fastPathCompletion asks the summary model for a short reply given the last few messages.
+func (s *AgentService) fastPathCompletion(ctx context.Context, window *conversationWindow, content string) (string, error) {
+	history := anthropicMessagesFromWindow(window)
+	if len(history) > fastPathHistory {
+		history = history[len(history)-fastPathHistory:]
+	}
+	// The API requires the first message to come from the user
+	for len(history) > 0 && history[0].Role != "user" {
+		history = history[1:]
+	}
+
+	resp, err := s.send(ctx, purposeReply, &anthropic.Request{
+		Model:     s.summaryModel,
+		MaxTokens: fastPathMaxTokens,
+		System:    FastPathPrompt,
+		Messages:  appendUserTurn(history, content),
+	})
+	if err != nil {
+		return "", fmt.Errorf("call anthropic: %w", err)
+	}
+	for _, block := range resp.Content {
+		if block.Type == "text" && strings.TrimSpace(block.Text) != "" {
+			return block.Text, nil
+		}
+	}
+	return "", fmt.Errorf("empty response from anthropic")
+}
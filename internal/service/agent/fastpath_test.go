@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestTrivialMessage(t *testing.T) {
+	tests := []struct {
+		content     string
+		wantTrivial bool
+		wantCanned  bool
+	}{
+		// Acknowledgments are answered without a model call
+		{content: "thanks", wantTrivial: true, wantCanned: true},
+		{content: "Thanks!", wantTrivial: true, wantCanned: true},
+		{content: "  thank you so much  ", wantTrivial: true, wantCanned: true},
+		{content: "thx", wantTrivial: true, wantCanned: true},
+		{content: "OK.", wantTrivial: true, wantCanned: true},
+		{content: "got it", wantTrivial: true, wantCanned: true},
+		{content: "Perfect", wantTrivial: true, wantCanned: true},
+		// Other small talk gets a minimal model call
+		{content: "hi there", wantTrivial: true},
+		{content: "good morning!", wantTrivial: true},
+		{content: "lol", wantTrivial: true},
+		{content: "gracias", wantTrivial: true},
+		{content: "you're the best", wantTrivial: true},
+		// Questions, amounts, addresses and wallet vocabulary take the full path
+		{content: "what's up?"},
+		{content: "thanks, now swap ETH"},
+		{content: "send it"},
+		{content: "my balance"},
+		{content: "ok 100"},
+		{content: "0xdeadbeef"},
+		{content: "pay @alice"},
+		{content: "see https://vultisig.com"},
+		{content: "BTC"},
+		// Answers to something the assistant asked
+		{content: "yes"},
+		{content: "Nope"},
+		{content: "sure"},
+		{content: "cancel"},
+		// Too long, or nothing to classify
+		{content: "thanks for all the help you gave me today"},
+		{content: "ok ok ok ok ok ok"},
+		{content: ""},
+		{content: "   "},
+		{content: "👍"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			canned, ok := trivialMessage(tt.content)
+			if ok != tt.wantTrivial || (canned != "") != tt.wantCanned {
+				t.Errorf("trivialMessage(%q) = %q, %v; want trivial %v, canned %v", tt.content, canned, ok, tt.wantTrivial, tt.wantCanned)
+			}
+		})
+	}
+}
+
+func TestProcessMessageFastPathRouting(t *testing.T) {
+	const (
+		routeFull   = "full"
+		routeCanned = "canned"
+		routeModel  = "fast model"
+	)
+	earlier := time.Now().Add(-time.Minute)
+	history := func(reply string, metadata string) []types.Message {
+		msgs := []types.Message{
+			{Role: types.RoleUser, Content: "how do I swap eth to btc", ContentType: "text", CreatedAt: earlier},
+			{Role: types.RoleAssistant, Content: reply, ContentType: "text", CreatedAt: earlier.Add(time.Second)},
+		}
+		if metadata != "" {
+			msgs[1].Metadata = json.RawMessage(metadata)
+		}
+		return msgs
+	}
+
+	tests := []struct {
+		name      string
+		disabled  bool
+		content   string
+		history   []types.Message
+		pending   bool
+		wantRoute string
+	}{
+		{name: "acknowledgment", content: "thanks", wantRoute: routeCanned},
+		{name: "small talk", content: "hi there", wantRoute: routeModel},
+		{name: "after a plain answer", content: "thanks", history: history("Use the swap screen.", ""), wantRoute: routeCanned},
+		{name: "after an error reply", content: "ok", history: history(errorReplyContent, `{"type":"error"}`), wantRoute: routeCanned},
+		{name: "not trivial", content: "swap 1 eth to btc", wantRoute: routeFull},
+		{name: "disabled", disabled: true, content: "thanks", wantRoute: routeFull},
+		{name: "policy build pending", content: "thanks", pending: true, wantRoute: routeFull},
+		{name: "after suggestions", content: "ok", history: history("A DCA plugin can do that.", `{"suggestions":[{"id":"sug_1"}]}`), wantRoute: routeFull},
+		{name: "after policy ready", content: "great", history: history("Here is your policy.", `{"type":"policy_ready"}`), wantRoute: routeFull},
+		{name: "after a question", content: "ok", history: history("Which chain should I use?", ""), wantRoute: routeFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+				"intent":   "general_question",
+				"response": "Happy to help.",
+			})}
+			cache := newFakeCache()
+			msgs := &fakeMessageStore{messages: tt.history, total: len(tt.history)}
+			svc := NewAgentService(Deps{
+				Anthropic:     model,
+				Messages:      msgs,
+				Conversations: &fakeConversationStore{owner: testOwner},
+				Cache:         cache,
+				Logger:        testLogger(),
+			}, Settings{
+				SummaryModel: "summary-model",
+				Context:      config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+				Agent:        config.AgentConfig{IntentMaxTokens: 1024, FastPathEnabled: !tt.disabled},
+			})
+			convID := uuid.New()
+			if tt.pending {
+				cache.values[pendingBuildKey(convID)] = "sugg-1"
+			}
+			if tt.wantRoute == routeModel {
+				model.resp = &anthropic.Response{Content: []anthropic.ContentBlock{{Type: "text", Text: "Hi! How can I help?"}}}
+			}
+
+			resp, err := svc.ProcessMessage(context.Background(), convID, testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   tt.content,
+			})
+			if err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+
+			var route string
+			switch {
+			case len(model.requests) == 0:
+				route = routeCanned
+			case model.requests[0].System == FastPathPrompt && len(model.requests[0].Tools) == 0 && model.requests[0].Model == "summary-model":
+				route = routeModel
+			default:
+				route = routeFull
+			}
+			if route != tt.wantRoute {
+				t.Fatalf("%q took the %s path, want %s", tt.content, route, tt.wantRoute)
+			}
+
+			// Both paths persist the exchange; only the fast path marks its reply
+			stored := msgs.stored()
+			if len(stored) != 2 || stored[0].Content != tt.content || stored[1].ID != resp.Message.ID {
+				t.Fatalf("stored %d messages, want the user message and the reply", len(stored))
+			}
+			var meta struct {
+				FastPath bool `json:"fast_path"`
+			}
+			_ = json.Unmarshal(stored[1].Metadata, &meta)
+			if meta.FastPath != (tt.wantRoute != routeFull) {
+				t.Errorf("reply metadata = %s, want fast_path %v", stored[1].Metadata, tt.wantRoute != routeFull)
+			}
+		})
+	}
+}
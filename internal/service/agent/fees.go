@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/vultisig/agent-backend/internal/numfmt"
+	"github.com/vultisig/agent-backend/internal/service/fees"
+)
+
+// feeEstimateInput is the input of the get_fee_estimate tool.
+type feeEstimateInput struct {
+	Chain  string `json:"chain"`
+	Action string `json:"action"`
+}
+
+// feeEstimateTool answers get_fee_estimate calls.
+func (s *AgentService) feeEstimateTool(ctx context.Context, input json.RawMessage, _ *RequestContext) (any, error) {
+	var in feeEstimateInput
+	if err := json.Unmarshal(input, &in); err != nil || in.Chain == "" || in.Action == "" {
+		return nil, errors.New("a chain and an action are required")
+	}
+
+	estimate, err := s.estimateFee(ctx, normalizeChain(in.Chain), in.Action)
+	if err != nil {
+		switch {
+		case errors.Is(err, fees.ErrUnsupportedChain), errors.Is(err, fees.ErrUnsupportedAction):
+			return nil, err
+		}
+		s.logger.WithError(err).WithField("chain", in.Chain).Warn("fee estimate failed")
+		return nil, fmt.Errorf("could not estimate fees on %s right now", in.Chain)
+	}
+	return estimate, nil
+}
+
+// estimateFee estimates an action's network fee and, when a price is available, its USD cost.
+func (s *AgentService) estimateFee(ctx context.Context, chain, action string) (*fees.Estimate, error) {
+	estimate, err := s.fees.Estimate(ctx, chain, action)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.quotes != nil {
+		asset, ok := thorchainAsset(map[string]any{"chain": chain}, nil)
+		if !ok && len(nativeSymbols[chain]) > 0 && nativeSymbols[chain][0] == "ETH" {
+			// L2s without a THORChain pool pay gas in ETH
+			asset, ok = "ETH.ETH", true
+		}
+		if ok {
+			price, err := s.quotes.USDPrice(ctx, asset)
+			if err != nil {
+				s.logger.WithError(err).WithField("asset", asset).Debug("no USD price for fee estimate")
+			} else if fee, ok := parseAmount(estimate.Fee); ok {
+				f, _ := fee.Float64()
+				usd := math.Round(f*price*100) / 100
+				estimate.FeeUSD = &usd
+			}
+		}
+	}
+	return estimate, nil
+}
+
+// checkBalanceSufficiency warns when a policy's source balance can't cover its amount. For
+// native source assets the estimated network fee is included, since gas is paid from the
+// same balance. Returns "" when the balance suffices or can't be checked. It must run
+// before fromAmount is converted to base units. Amounts are formatted for the user's locale.
+func (s *AgentService) checkBalanceSufficiency(ctx context.Context, configuration map[string]any, balances []Balance, format numfmt.Formatter) string {
+	amountVal, ok := configuration["fromAmount"]
+	if !ok {
+		return ""
+	}
+	amount, ok := parseAmount(fmt.Sprintf("%v", amountVal))
+	if !ok || amount.Sign() <= 0 {
+		return ""
+	}
+	from, _ := configuration["from"].(map[string]any)
+	chain, _ := from["chain"].(string)
+	token, _ := from["token"].(string)
+	chain = normalizeChain(chain)
+	native := nativeAssetMarkers[strings.ToLower(strings.TrimSpace(token))]
+
+	balance, ok := sourceBalance(balances, chain, token, native)
+	if !ok {
+		return ""
+	}
+	available, ok := parseAmount(balance.Amount)
+	if !ok {
+		return ""
+	}
+
+	needed := new(big.Rat).Set(amount)
+	var feeText string
+	if native && s.fees != nil {
+		estimate, err := s.estimateFee(ctx, chain, policyFeeAction(from, configuration))
+		if err != nil {
+			if !errors.Is(err, fees.ErrUnsupportedChain) && !errors.Is(err, fees.ErrUnsupportedAction) {
+				s.logger.WithError(err).WithField("chain", chain).Warn("failed to estimate policy fees")
+			}
+		} else if fee, ok := parseAmount(estimate.Fee); ok {
+			needed.Add(needed, fee)
+			feeText = fmt.Sprintf(" plus about %s in network fees", format.Asset(estimate.Fee, balance.Symbol, numfmt.Crypto))
+			if estimate.FeeUSD != nil {
+				feeText += fmt.Sprintf(" (~%s)", format.Money(*estimate.FeeUSD, "USD"))
+			}
+		}
+	}
+
+	if needed.Cmp(available) <= 0 {
+		return ""
+	}
+	class := assetClass(balance.Symbol)
+	return fmt.Sprintf("\n\nHeads up: each run needs %s%s, but your balance is %s, so it may fail for insufficient funds. Consider lowering the amount or topping up first.",
+		format.Asset(fmt.Sprintf("%v", amountVal), balance.Symbol, class), feeText, format.Asset(balance.Amount, balance.Symbol, class))
+}
+
+// sourceBalance finds the user's balance of a policy's source asset.
+func sourceBalance(balances []Balance, chain, token string, native bool) (Balance, bool) {
+	for _, b := range balances {
+		if normalizeChain(b.Chain) != chain {
+			continue
+		}
+		asset := strings.ToLower(strings.TrimSpace(b.Asset))
+		if native && (nativeAssetMarkers[asset] || strings.EqualFold(b.Asset, b.Symbol)) {
+			return b, true
+		}
+		if !native && strings.EqualFold(b.Asset, token) {
+			return b, true
+		}
+	}
+	return Balance{}, false
+}
+
+// policyFeeAction picks the fee action for a policy: a swap when the destination is a
+// different asset, otherwise a plain transfer.
+func policyFeeAction(from, configuration map[string]any) string {
+	to, ok := configuration["to"].(map[string]any)
+	if !ok {
+		return fees.ActionTransfer
+	}
+	if !strings.EqualFold(fmt.Sprintf("%v", to["chain"]), fmt.Sprintf("%v", from["chain"])) ||
+		!strings.EqualFold(fmt.Sprintf("%v", to["token"]), fmt.Sprintf("%v", from["token"])) {
+		return fees.ActionSwap
+	}
+	return fees.ActionTransfer
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vultisig/agent-backend/internal/numfmt"
+	"github.com/vultisig/agent-backend/internal/service/fees"
+)
+
+// fakeFees returns fixed estimates per chain; chains without one are unsupported.
+type fakeFees struct {
+	estimates map[string]string
+	err       error
+	actions   []string
+}
+
+func (f *fakeFees) Estimate(_ context.Context, chain, action string) (*fees.Estimate, error) {
+	f.actions = append(f.actions, action)
+	if f.err != nil {
+		return nil, f.err
+	}
+	fee, ok := f.estimates[chain]
+	if !ok {
+		return nil, fees.ErrUnsupportedChain
+	}
+	return &fees.Estimate{Chain: chain, Action: action, Fee: fee, Symbol: "ETH"}, nil
+}
+
+func (f *fakeFees) SupportedChains() []string { return []string{"ethereum"} }
+
+func TestCheckBalanceSufficiencyFees(t *testing.T) {
+	balances := []Balance{
+		{Chain: "Ethereum", Symbol: "ETH", Amount: "1"},
+		{Chain: "Ethereum", Asset: "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", Symbol: "USDC", Amount: "100"},
+	}
+	swapFrom := func(token, amount string) map[string]any {
+		return map[string]any{
+			"from":       map[string]any{"chain": "Ethereum", "token": token},
+			"to":         map[string]any{"chain": "Ethereum", "token": "0xdac17f958d2ee523a2206206994597c13d831ec7"},
+			"fromAmount": amount,
+		}
+	}
+
+	tests := []struct {
+		name          string
+		fees          *fakeFees
+		configuration map[string]any
+		// want is a substring of the warning; empty means no warning
+		want       string
+		wantAction string
+	}{
+		{
+			name:          "fee tips a native balance over",
+			fees:          &fakeFees{estimates: map[string]string{"ethereum": "0.00275"}},
+			configuration: swapFrom("", "0.999"),
+			want:          "plus about 0.00275 ETH in network fees",
+			wantAction:    fees.ActionSwap,
+		},
+		{
+			name:          "native balance covers amount and fee",
+			fees:          &fakeFees{estimates: map[string]string{"ethereum": "0.00275"}},
+			configuration: swapFrom("", "0.5"),
+			wantAction:    fees.ActionSwap,
+		},
+		{
+			name: "transfers estimate a transfer",
+			fees: &fakeFees{estimates: map[string]string{"ethereum": "0.000231"}},
+			configuration: map[string]any{
+				"from":       map[string]any{"chain": "Ethereum", "token": ""},
+				"to":         map[string]any{"chain": "Ethereum", "token": ""},
+				"fromAmount": "0.99999",
+			},
+			want:       "network fees",
+			wantAction: fees.ActionTransfer,
+		},
+		{
+			name:          "token source ignores gas",
+			fees:          &fakeFees{estimates: map[string]string{"ethereum": "0.00275"}},
+			configuration: swapFrom("0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", "100"),
+		},
+		{
+			name:          "unsupported chain checks the amount alone",
+			fees:          &fakeFees{},
+			configuration: swapFrom("", "0.999"),
+			wantAction:    fees.ActionSwap,
+		},
+		{
+			name:          "failed estimate checks the amount alone",
+			fees:          &fakeFees{err: errConnReset},
+			configuration: swapFrom("", "1.5"),
+			want:          "each run needs 1.5 ETH, but your balance is 1 ETH",
+			wantAction:    fees.ActionSwap,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AgentService{fees: tt.fees, logger: testLogger()}
+			format := numfmt.New("en", numfmt.Precision{Crypto: 8, Stablecoin: 2, Fiat: 2})
+
+			got := s.checkBalanceSufficiency(context.Background(), tt.configuration, balances, format)
+			if tt.want == "" && got != "" {
+				t.Errorf("checkBalanceSufficiency() = %q, want no warning", got)
+			}
+			if tt.want != "" && !strings.Contains(got, tt.want) {
+				t.Errorf("checkBalanceSufficiency() = %q, want it to contain %q", got, tt.want)
+			}
+			if tt.fees.err != nil && strings.Contains(got, "network fees") {
+				t.Errorf("checkBalanceSufficiency() = %q, want no fee without an estimate", got)
+			}
+			var action string
+			if len(tt.fees.actions) > 0 {
+				action = tt.fees.actions[0]
+			}
+			if action != tt.wantAction {
+				t.Errorf("estimated %q, want %q", action, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestFeeEstimateTool(t *testing.T) {
+	tests := []struct {
+		name    string
+		fees    *fakeFees
+		input   string
+		wantFee string
+		wantErr string
+	}{
+		{name: "estimate", fees: &fakeFees{estimates: map[string]string{"ethereum": "0.000231"}}, input: `{"chain":"Ethereum","action":"transfer"}`, wantFee: "0.000231"},
+		{name: "missing action", fees: &fakeFees{}, input: `{"chain":"Ethereum"}`, wantErr: "a chain and an action are required"},
+		{name: "unsupported chain", fees: &fakeFees{}, input: `{"chain":"Fakechain","action":"transfer"}`, wantErr: fees.ErrUnsupportedChain.Error()},
+		{name: "rpc down", fees: &fakeFees{err: errConnReset}, input: `{"chain":"Ethereum","action":"transfer"}`, wantErr: "could not estimate fees on Ethereum right now"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AgentService{fees: tt.fees, logger: testLogger()}
+			got, err := s.feeEstimateTool(context.Background(), json.RawMessage(tt.input), nil)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("feeEstimateTool() error = %v, want %q", err, tt.wantErr)
+				}
+				// Transport failures stay in the logs
+				if errors.Is(err, errConnReset) {
+					t.Errorf("feeEstimateTool() error wraps the transport error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("feeEstimateTool() error = %v", err)
+			}
+			if estimate, ok := got.(*fees.Estimate); !ok || estimate.Fee != tt.wantFee {
+				t.Errorf("feeEstimateTool() = %+v, want a %s fee", got, tt.wantFee)
+			}
+		})
+	}
+}
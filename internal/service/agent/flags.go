@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/vultisig/agent-backend/internal/service/flags"
+)
+
+// flagEnabled reads an operational kill switch. Without a flag store every feature is on.
+func (s *AgentService) flagEnabled(ctx context.Context, name string) bool {
+	return s.flags == nil || s.flags.Enabled(ctx, name)
+}
+
+// memoryEnabled reports whether user memory is loaded into prompts and updated.
+func (s *AgentService) memoryEnabled(ctx context.Context) bool {
+	return s.memRepo != nil && s.flagEnabled(ctx, flags.Memory)
+}
+
+// summarizationEnabled reports whether long conversations are summarized; when off, the
+// context is cut to the recent window instead.
+func (s *AgentService) summarizationEnabled(ctx context.Context) bool {
+	return s.flagEnabled(ctx, flags.Summarization)
+}
+
+// toolsEnabled reports whether server-side lookup tools are offered during intent detection.
+func (s *AgentService) toolsEnabled(ctx context.Context) bool {
+	return s.flagEnabled(ctx, flags.Tools)
+}
+
+// suggestionsEnabled reports whether plugin suggestions are issued with replies.
+func (s *AgentService) suggestionsEnabled(ctx context.Context) bool {
+	return s.flagEnabled(ctx, flags.Suggestions)
+}
@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/flags"
+)
+
+// fakeFlags is a flag store whose flags can be switched off and on while a test runs.
+type fakeFlags struct {
+	mu  sync.Mutex
+	off map[string]bool
+}
+
+func (f *fakeFlags) Enabled(_ context.Context, name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return !f.off[name]
+}
+
+func (f *fakeFlags) set(name string, enabled bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.off == nil {
+		f.off = make(map[string]bool)
+	}
+	f.off[name] = !enabled
+}
+
+// flagModel answers summarization calls with a summary and intent calls with a reply
+// offering a suggestion, recording the requests.
+type flagModel struct {
+	mu       sync.Mutex
+	requests []*anthropic.Request
+}
+
+func (m *flagModel) SendMessage(_ context.Context, req *anthropic.Request) (*anthropic.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, req)
+	if len(req.Tools) == 0 {
+		return &anthropic.Response{Content: []anthropic.ContentBlock{{Type: "text", Text: "The user asked about swaps."}}}, nil
+	}
+	return toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "action_request",
+		"response": "A DCA plugin can do that.",
+		"suggestions": []map[string]any{
+			{"plugin_id": "vultisig-dca-0000", "title": "Recurring swap", "description": "Swap ETH weekly"},
+		},
+	}), nil
+}
+
+// take returns the requests made since the last call.
+func (m *flagModel) take() []*anthropic.Request {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reqs := m.requests
+	m.requests = nil
+	return reqs
+}
+
+func newFlagService(model *flagModel, ff *fakeFlags, msgs *fakeMessageStore, convs *fakeConversationStore) *AgentService {
+	cache := newFakeCache()
+	return NewAgentService(Deps{
+		Anthropic:     model,
+		Messages:      msgs,
+		Conversations: convs,
+		Cache:         cache,
+		Outbox:        &fakeOutbox{cache: cache},
+		Quotes:        &fakeQuoter{quote: testQuote()},
+		Flags:         ff,
+		Logger:        testLogger(),
+	}, Settings{
+		SummaryModel: "summary-model",
+		Context:      config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 500, HardMaxMessages: 1000},
+		Agent:        config.AgentConfig{IntentMaxTokens: 1024},
+	})
+}
+
+// offersTool reports whether req offers the named tool.
+func offersTool(req *anthropic.Request, name string) bool {
+	for _, tool := range req.Tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFlagsToggledMidFlow(t *testing.T) {
+	model := &flagModel{}
+	ff := &fakeFlags{}
+	svc := newFlagService(model, ff, &fakeMessageStore{}, &fakeConversationStore{owner: testOwner})
+	convID := uuid.New()
+
+	steps := []struct {
+		name            string
+		toggle          func()
+		wantSuggestions int
+		wantTools       bool
+	}{
+		{name: "all on", wantSuggestions: 1, wantTools: true},
+		{name: "suggestions off", toggle: func() { ff.set(flags.Suggestions, false) }, wantTools: true},
+		{name: "tools off too", toggle: func() { ff.set(flags.Tools, false) }},
+		{name: "suggestions back on", toggle: func() { ff.set(flags.Suggestions, true) }, wantSuggestions: 1},
+		{name: "tools back on", toggle: func() { ff.set(flags.Tools, true) }, wantSuggestions: 1, wantTools: true},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if step.toggle != nil {
+				step.toggle()
+			}
+			resp, err := svc.ProcessMessage(context.Background(), convID, testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   "swap eth to btc every week",
+			})
+			if err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+			if len(resp.Suggestions) != step.wantSuggestions {
+				t.Errorf("reply has %d suggestions, want %d", len(resp.Suggestions), step.wantSuggestions)
+			}
+			reqs := model.take()
+			if len(reqs) != 1 {
+				t.Fatalf("model got %d requests, want 1", len(reqs))
+			}
+			if got := offersTool(reqs[0], SwapQuoteTool.Name); got != step.wantTools {
+				t.Errorf("swap quote tool offered = %v, want %v", got, step.wantTools)
+			}
+		})
+	}
+}
+
+func TestSummarizationFlagToggledMidFlow(t *testing.T) {
+	start := time.Now().Add(-24 * time.Hour)
+	history := longConversation(60, start)
+	model := &flagModel{}
+	ff := &fakeFlags{}
+	ff.set(flags.Summarization, false)
+	convs := &fakeConversationStore{owner: testOwner}
+	msgs := &fakeMessageStore{messages: history, total: len(history)}
+	svc := newFlagService(model, ff, msgs, convs)
+	convID := uuid.New()
+
+	send := func() (summaries int, sent []anthropic.Message) {
+		t.Helper()
+		if _, err := svc.ProcessMessage(context.Background(), convID, testOwner, &SendMessageRequest{
+			PublicKey: testOwner,
+			Content:   "what did we talk about?",
+		}); err != nil {
+			t.Fatalf("ProcessMessage() error = %v", err)
+		}
+		for _, req := range model.take() {
+			if req.Model == "summary-model" && len(req.Tools) == 0 {
+				summaries++
+				continue
+			}
+			sent = req.Messages
+		}
+		return summaries, sent
+	}
+
+	// Switched off, the long conversation is cut to the recent window without a summary
+	summaries, sent := send()
+	if summaries != 0 || convs.summary != nil {
+		t.Errorf("summarization off: made %d summary calls, stored summary %v; want none", summaries, convs.summary)
+	}
+	if first := sent[0].Content.(string); first != history[40].Content {
+		t.Errorf("summarization off: context starts at %q, want the recent window from %q", first, history[40].Content)
+	}
+
+	// Switched back on, the next turn summarizes the older messages first
+	ff.set(flags.Summarization, true)
+	summaries, _ = send()
+	if summaries != 1 {
+		t.Errorf("summarization on: made %d summary calls, want 1", summaries)
+	}
+	if convs.summary == nil || len(convs.summaryUpdates) != 1 || !convs.summaryUpdates[0].Equal(history[39].CreatedAt) {
+		t.Errorf("summarization on: stored summaries up to %v, want one up to message 39", convs.summaryUpdates)
+	}
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+const (
+	// MaxImportMessages caps how many messages one import may carry. The request body is
+	// also capped at 1 MB by the route.
+	MaxImportMessages = 300
+	// maxImportedMessageChars caps the length of each imported message.
+	maxImportedMessageChars = 8000
+	// importClockSkew tolerates client clocks slightly ahead of ours.
+	importClockSkew = time.Minute
+)
+
+// ImportConversationRequest is the request body for importing a conversation from the legacy assistant.
+type ImportConversationRequest struct {
+	PublicKey string `json:"public_key"`
+	// Title defaults to the first user message when empty
+	Title    string          `json:"title,omitempty"`
+	Messages []ImportMessage `json:"messages"`
+}
+
+// ImportMessage is one message of an imported conversation.
+type ImportMessage struct {
+	Role      string    `json:"role"` // "user" or "assistant"
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ImportValidationError is returned when an import payload is rejected. Nothing is stored.
+type ImportValidationError struct {
+	Index  int // message index, or -1 for the payload as a whole
+	Reason string
+}
+
+func (e *ImportValidationError) Error() string {
+	if e.Index < 0 {
+		return e.Reason
+	}
+	return fmt.Sprintf("message %d: %s", e.Index, e.Reason)
+}
+
+// ImportConversation creates a conversation from a legacy chat history. The payload is
+// validated as a whole and stored atomically, so an invalid message rejects the entire
+// import. The history is summarized right away so the context window works from the first
+// new message; a failed summary is logged and left to the regular summarization.
+func (s *AgentService) ImportConversation(ctx context.Context, req *ImportConversationRequest) (*types.Conversation, error) {
+	msgs, err := importedMessages(req.Messages, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		for _, msg := range msgs {
+			if msg.Role == types.RoleUser {
+				title = msg.Content
+				break
+			}
+		}
+	}
+	title = truncateTitle(title)
+
+	conv, err := s.convRepo.Import(ctx, req.PublicKey, &title, nil, time.Time{}, msgs)
+	if err != nil {
+		return nil, fmt.Errorf("import conversation: %w", err)
+	}
+
+	if s.summarizationEnabled(ctx) {
+		if err := s.summarizeOldMessages(ctx, conv.ID, req.PublicKey, msgs); err != nil {
+			s.logger.WithError(err).WithField("conversation_id", conv.ID).Warn("failed to summarize imported conversation")
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"conversation_id": conv.ID,
+		"messages":        len(msgs),
+	}).Info("conversation imported")
+	return conv, nil
+}
+
+// importedMessages validates an import payload and converts it to messages. Timestamps must
+// not be in the future or go backwards; equal timestamps are spread a microsecond apart so
+// the stored order matches the payload.
+func importedMessages(in []ImportMessage, now time.Time) ([]types.Message, error) {
+	if len(in) == 0 {
+		return nil, &ImportValidationError{Index: -1, Reason: "no messages to import"}
+	}
+	if len(in) > MaxImportMessages {
+		return nil, &ImportValidationError{Index: -1, Reason: fmt.Sprintf("at most %d messages can be imported", MaxImportMessages)}
+	}
+
+	msgs := make([]types.Message, 0, len(in))
+	var prevTimestamp, prev time.Time
+	for i, m := range in {
+		role := types.MessageRole(m.Role)
+		if role != types.RoleUser && role != types.RoleAssistant {
+			return nil, &ImportValidationError{Index: i, Reason: "role must be user or assistant"}
+		}
+		content := strings.TrimSpace(m.Content)
+		if content == "" {
+			return nil, &ImportValidationError{Index: i, Reason: "content is required"}
+		}
+		if utf8.RuneCountInString(content) > maxImportedMessageChars {
+			return nil, &ImportValidationError{Index: i, Reason: fmt.Sprintf("content is longer than %d characters", maxImportedMessageChars)}
+		}
+		if m.Timestamp.IsZero() {
+			return nil, &ImportValidationError{Index: i, Reason: "timestamp is required"}
+		}
+		if m.Timestamp.After(now.Add(importClockSkew)) {
+			return nil, &ImportValidationError{Index: i, Reason: "timestamp is in the future"}
+		}
+
+		if m.Timestamp.Before(prevTimestamp) {
+			return nil, &ImportValidationError{Index: i, Reason: "timestamp is before the previous message"}
+		}
+		prevTimestamp = m.Timestamp
+
+		// Postgres keeps microseconds; truncating here keeps summary cursors exact
+		createdAt := m.Timestamp.UTC().Truncate(time.Microsecond)
+		if !prev.IsZero() && !createdAt.After(prev) {
+			createdAt = prev.Add(time.Microsecond)
+		}
+		prev = createdAt
+
+		msgs = append(msgs, types.Message{
+			Role:        role,
+			Content:     content,
+			ContentType: "text",
+			CreatedAt:   createdAt,
+		})
+	}
+	return msgs, nil
+}
@@ -0,0 +1,293 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// importStore keeps imported conversations in memory, counting imports.
+type importStore struct {
+	ConversationStore
+	convs   map[uuid.UUID]*types.Conversation
+	msgs    map[uuid.UUID][]types.Message
+	imports int
+}
+
+func newImportStore() *importStore {
+	return &importStore{
+		convs: make(map[uuid.UUID]*types.Conversation),
+		msgs:  make(map[uuid.UUID][]types.Message),
+	}
+}
+
+func (f *importStore) Import(_ context.Context, publicKey string, title, summary *string, summaryUpTo time.Time, msgs []types.Message) (*types.Conversation, error) {
+	f.imports++
+	conv := &types.Conversation{ID: uuid.New(), PublicKey: publicKey, Title: title, Summary: summary, Revision: int64(len(msgs))}
+	if summary != nil {
+		conv.SummaryUpTo = &summaryUpTo
+	}
+	stored := make([]types.Message, len(msgs))
+	for i, msg := range msgs {
+		msg.ID = uuid.New()
+		msg.ConversationID = conv.ID
+		stored[i] = msg
+	}
+	f.convs[conv.ID] = conv
+	f.msgs[conv.ID] = stored
+	return conv, nil
+}
+
+func (f *importStore) GetForAdmin(_ context.Context, id uuid.UUID) (*types.Conversation, error) {
+	conv, ok := f.convs[id]
+	if !ok {
+		return nil, postgres.ErrNotFound
+	}
+	return conv, nil
+}
+
+// importedMessageStore serves the messages of an importStore.
+type importedMessageStore struct {
+	MessageStore
+	store *importStore
+}
+
+func (f *importedMessageStore) GetByConversationID(_ context.Context, id uuid.UUID) ([]types.Message, error) {
+	return f.store.msgs[id], nil
+}
+
+func newImportService(store *importStore) *AgentService {
+	return &AgentService{
+		convRepo:        store,
+		msgRepo:         &importedMessageStore{store: store},
+		logger:          testLogger(),
+		windowSize:      20,
+		hardMaxMessages: 5,
+	}
+}
+
+func TestImportConversationAllOrNothing(t *testing.T) {
+	now := time.Now()
+	valid := func() []ImportMessage {
+		return []ImportMessage{
+			{Role: "user", Content: "how do I swap?", Timestamp: now.Add(-3 * time.Hour)},
+			{Role: "assistant", Content: "Pick the assets.", Timestamp: now.Add(-2 * time.Hour)},
+			{Role: "user", Content: "thanks", Timestamp: now.Add(-time.Hour)},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		change    func([]ImportMessage) []ImportMessage
+		wantIndex int
+	}{
+		{
+			name:      "invalid role last",
+			change:    func(m []ImportMessage) []ImportMessage { m[2].Role = "system"; return m },
+			wantIndex: 2,
+		},
+		{
+			name:      "empty content in the middle",
+			change:    func(m []ImportMessage) []ImportMessage { m[1].Content = "  "; return m },
+			wantIndex: 1,
+		},
+		{
+			name: "content too long",
+			change: func(m []ImportMessage) []ImportMessage {
+				m[1].Content = strings.Repeat("a", maxImportedMessageChars+1)
+				return m
+			},
+			wantIndex: 1,
+		},
+		{
+			name:      "missing timestamp",
+			change:    func(m []ImportMessage) []ImportMessage { m[0].Timestamp = time.Time{}; return m },
+			wantIndex: 0,
+		},
+		{
+			name:      "timestamp in the future",
+			change:    func(m []ImportMessage) []ImportMessage { m[2].Timestamp = now.Add(time.Hour); return m },
+			wantIndex: 2,
+		},
+		{
+			name: "timestamps out of order",
+			change: func(m []ImportMessage) []ImportMessage {
+				m[2].Timestamp = m[0].Timestamp.Add(-time.Minute)
+				return m
+			},
+			wantIndex: 2,
+		},
+		{
+			name: "too many messages",
+			change: func(m []ImportMessage) []ImportMessage {
+				for len(m) <= MaxImportMessages {
+					m = append(m, ImportMessage{Role: "user", Content: "more", Timestamp: now.Add(-time.Minute)})
+				}
+				return m
+			},
+			wantIndex: -1,
+		},
+		{
+			name:      "no messages",
+			change:    func([]ImportMessage) []ImportMessage { return nil },
+			wantIndex: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newImportStore()
+			s := newImportService(store)
+
+			_, err := s.ImportConversation(context.Background(), &ImportConversationRequest{
+				PublicKey: testOwner,
+				Messages:  tt.change(valid()),
+			})
+			var validationErr *ImportValidationError
+			if !errors.As(err, &validationErr) || validationErr.Index != tt.wantIndex {
+				t.Fatalf("ImportConversation() error = %v, want a validation error for index %d", err, tt.wantIndex)
+			}
+			if store.imports != 0 {
+				t.Errorf("stored %d imports, want the whole payload rejected", store.imports)
+			}
+		})
+	}
+
+	t.Run("valid payload", func(t *testing.T) {
+		store := newImportStore()
+		s := newImportService(store)
+
+		msgs := valid()
+		// Equal timestamps keep their payload order
+		msgs[2].Timestamp = msgs[1].Timestamp
+		conv, err := s.ImportConversation(context.Background(), &ImportConversationRequest{PublicKey: testOwner, Messages: msgs})
+		if err != nil {
+			t.Fatalf("ImportConversation() error = %v", err)
+		}
+		if conv.Title == nil || *conv.Title != "how do I swap?" {
+			t.Errorf("title = %v, want the first user message", conv.Title)
+		}
+		stored := store.msgs[conv.ID]
+		if len(stored) != len(msgs) {
+			t.Fatalf("stored %d messages, want %d", len(stored), len(msgs))
+		}
+		for i, msg := range stored {
+			if msg.Content != msgs[i].Content || (i > 0 && !msg.CreatedAt.After(stored[i-1].CreatedAt)) {
+				t.Errorf("stored message %d = %q at %v, want %q after the previous one", i, msg.Content, msg.CreatedAt, msgs[i].Content)
+			}
+		}
+	})
+}
+
+func TestImportExportAllOrNothing(t *testing.T) {
+	now := time.Now()
+	summary := "The user asked about swaps."
+	valid := func() *ConversationExport {
+		return &ConversationExport{
+			PublicKey: testOwner,
+			Messages: []ExportedMessage{
+				{Role: "user", Content: "swap eth", ContentType: "text", CreatedAt: now.Add(-2 * time.Hour)},
+				{Role: "assistant", Content: "Which chain?", ContentType: "text", CreatedAt: now.Add(-time.Hour)},
+			},
+		}
+	}
+
+	tests := []struct {
+		name      string
+		change    func(*ConversationExport)
+		wantIndex int
+	}{
+		{name: "invalid role", change: func(e *ConversationExport) { e.Messages[1].Role = "tool" }, wantIndex: 1},
+		{name: "deleted content type", change: func(e *ConversationExport) { e.Messages[0].ContentType = "deleted" }, wantIndex: 0},
+		{name: "invalid metadata", change: func(e *ConversationExport) { e.Messages[1].Metadata = json.RawMessage(`{"a":`) }, wantIndex: 1},
+		{name: "created_at in the future", change: func(e *ConversationExport) { e.Messages[1].CreatedAt = now.Add(time.Hour) }, wantIndex: 1},
+		{name: "summary without cursor", change: func(e *ConversationExport) { e.Summary = &summary }, wantIndex: -1},
+		{
+			name: "over the hard message cap",
+			change: func(e *ConversationExport) {
+				for len(e.Messages) <= 5 {
+					e.Messages = append(e.Messages, ExportedMessage{Role: "user", Content: "more", ContentType: "text", CreatedAt: now})
+				}
+			},
+			wantIndex: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newImportStore()
+			s := newImportService(store)
+
+			in := valid()
+			tt.change(in)
+			_, err := s.ImportExport(context.Background(), in)
+			var validationErr *ImportValidationError
+			if !errors.As(err, &validationErr) || validationErr.Index != tt.wantIndex {
+				t.Fatalf("ImportExport() error = %v, want a validation error for index %d", err, tt.wantIndex)
+			}
+			if store.imports != 0 {
+				t.Errorf("stored %d imports, want the whole payload rejected", store.imports)
+			}
+		})
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	store := newImportStore()
+	s := newImportService(store)
+	ctx := context.Background()
+
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	title := "Swap ETH"
+	summary := "The user wants to swap ETH to Arbitrum."
+	summaryUpTo := base.Add(time.Minute)
+	source, err := store.Import(ctx, testOwner, &title, &summary, summaryUpTo, []types.Message{
+		{Role: types.RoleUser, Content: "swap eth", ContentType: "text", CreatedAt: base},
+		{Role: types.RoleAssistant, Content: "Which chain?", ContentType: "text", Metadata: json.RawMessage(`{"intent":"swap"}`), CreatedAt: base.Add(time.Minute)},
+		{Role: types.RoleSystem, Content: "Policy created.", ContentType: "action_result", CreatedAt: base.Add(2 * time.Minute)},
+		{Role: types.RoleUser, Content: "arbitrum", ContentType: "text", CreatedAt: base.Add(3 * time.Minute)},
+	})
+	if err != nil {
+		t.Fatalf("seed conversation: %v", err)
+	}
+
+	exported, err := s.ExportConversation(ctx, source.ID)
+	if err != nil {
+		t.Fatalf("ExportConversation() error = %v", err)
+	}
+
+	// The export goes over the wire as JSON
+	data, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatalf("encode export: %v", err)
+	}
+	var decoded ConversationExport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decode export: %v", err)
+	}
+
+	imported, err := s.ImportExport(ctx, &decoded)
+	if err != nil {
+		t.Fatalf("ImportExport() error = %v", err)
+	}
+	if imported.ID == source.ID || imported.Revision != source.Revision {
+		t.Errorf("imported conversation %s at revision %d, want a new conversation at revision %d", imported.ID, imported.Revision, source.Revision)
+	}
+
+	reexported, err := s.ExportConversation(ctx, imported.ID)
+	if err != nil {
+		t.Fatalf("ExportConversation() of the import error = %v", err)
+	}
+	if !reflect.DeepEqual(reexported, exported) {
+		t.Errorf("export after import = %+v, want %+v", reexported, exported)
+	}
+}
@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"regexp"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// Prompt-injection categories reported by detectInjection. Matched text is never logged.
+const (
+	injectionOverride   = "instruction_override"
+	injectionRoleSwitch = "role_switch"
+	injectionFakeTurn   = "spoofed_turn"
+	injectionPromptLeak = "prompt_extraction"
+)
+
+// injectionPatterns are heuristics for text trying to steer the model rather than talk to
+// it. They favour phrasing that has no place in a wallet conversation, so false positives
+// only cost the user name resolution for that build.
+var injectionPatterns = []struct {
+	category string
+	re       *regexp.Regexp
+}{
+	{injectionOverride, regexp.MustCompile(`(?i)\b(?:ignore|disregard|forget|override|bypass)\s+(?:all\s+|any\s+)?(?:of\s+)?(?:the\s+|your\s+|my\s+)?(?:previous|prior|above|earlier|preceding|system|original)\s+(?:instructions?|prompts?|rules|directions|messages|guidelines)`)},
+	{injectionOverride, regexp.MustCompile(`(?i)\b(?:new|updated|real)\s+(?:system\s+)?instructions?\s*:`)},
+	{injectionRoleSwitch, regexp.MustCompile(`(?i)\byou\s+are\s+(?:now|no\s+longer)\s+(?:an?\s+|in\s+|the\s+)?(?:dan|unrestricted|unfiltered|jailbroken|bound|restricted|limited|(?:ai|assistant|system|developer|admin)\b)|\b(?:act|behave|respond)\s+as\s+(?:an?\s+|the\s+)?(?:system|developer|admin(?:istrator)?|unrestricted|jailbroken)\b|\b(?:developer|god|jailbreak)\s+mode\b`)},
+	{injectionFakeTurn, regexp.MustCompile(`(?im)^\s*(?:system|assistant)\s*:|<\|?(?:im_start|im_end|system|endoftext)\|?>|\[/?(?:INST|SYS)\]|</?system>`)},
+	{injectionPromptLeak, regexp.MustCompile(`(?i)\b(?:reveal|show|print|repeat|output|leak)\s+(?:me\s+)?(?:your|the)\s+(?:full\s+|entire\s+|hidden\s+)?(?:system\s+)?(?:prompt|instructions)\b`)},
+}
+
+// detectInjection returns the distinct categories of injection patterns found in text, in
+// pattern order, or nil when none match.
+func detectInjection(text string) []string {
+	var found []string
+	for _, p := range injectionPatterns {
+		if p.re.MatchString(text) && !slices.Contains(found, p.category) {
+			found = append(found, p.category)
+		}
+	}
+	return found
+}
+
+// injectionInWindow returns the injection categories found in the user's text messages in
+// the conversation window, plus content when given.
+func injectionInWindow(window *conversationWindow, content string) []string {
+	found := detectInjection(content)
+	for _, msg := range window.messages {
+		if msg.Role != types.RoleUser || msg.ContentType != "text" || msg.DeletedAt != nil {
+			continue
+		}
+		for _, category := range detectInjection(msg.Content) {
+			if !slices.Contains(found, category) {
+				found = append(found, category)
+			}
+		}
+	}
+	return found
+}
+
+// checkInjection looks for injection patterns in content and the user's messages in the
+// window. New matches in content are counted; any match is logged without the text. It
+// returns the categories found, nil when the conversation looks clean.
+func (s *AgentService) checkInjection(convID uuid.UUID, window *conversationWindow, content, stage string) []string {
+	for _, category := range detectInjection(content) {
+		metrics.InjectionAttempts.WithLabelValues(category).Inc()
+	}
+	categories := injectionInWindow(window, content)
+	if len(categories) > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"conversation_id": convID,
+			"categories":      categories,
+			"stage":           stage,
+		}).Warn("security: likely prompt injection in user messages, constraining agent")
+	}
+	return categories
+}
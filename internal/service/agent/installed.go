@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// installedPluginsTTL is how long a user's installed plugins are cached. Suggestions are
+// annotated from the cache only; it is filled when the installed plugins are looked up
+// anyway (catalog, policy builds) and dropped when the app reports an install.
+const installedPluginsTTL = 1 * time.Minute
+
+// installedPlugins is a user's installed plugin IDs as cached in Redis.
+type installedPlugins struct {
+	PluginIDs []string  `json:"plugin_ids"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// installedPluginsKey is the Redis key caching a user's installed plugins.
+func installedPluginsKey(publicKey string) string {
+	return fmt.Sprintf("installed:%s", publicKey)
+}
+
+// cacheInstalledPlugins caches the plugins the user was just seen to have installed.
+func (s *AgentService) cacheInstalledPlugins(ctx context.Context, publicKey string, ids []string) {
+	if publicKey == "" {
+		return
+	}
+	data, err := json.Marshal(installedPlugins{PluginIDs: ids, FetchedAt: time.Now()})
+	if err != nil {
+		return
+	}
+	if err := s.redis.Set(ctx, installedPluginsKey(publicKey), string(data), installedPluginsTTL); err != nil {
+		s.logger.WithError(err).Warn("failed to cache installed plugins")
+	}
+}
+
+// cachedInstalledPlugins returns the user's cached installed plugins, or nil when they
+// aren't known.
+func (s *AgentService) cachedInstalledPlugins(ctx context.Context, publicKey string) *installedPlugins {
+	cached, err := s.redis.Get(ctx, installedPluginsKey(publicKey))
+	if err != nil || cached == "" {
+		return nil
+	}
+	var installed installedPlugins
+	if err := json.Unmarshal([]byte(cached), &installed); err != nil {
+		return nil
+	}
+	return &installed
+}
+
+// forgetInstalledPlugins drops the user's cached installed plugins after they changed.
+func (s *AgentService) forgetInstalledPlugins(ctx context.Context, publicKey string) {
+	if err := s.redis.Delete(ctx, installedPluginsKey(publicKey)); err != nil {
+		s.logger.WithError(err).Warn("failed to drop cached installed plugins")
+	}
+}
+
+// annotateInstall marks suggestions with whether their plugin must be installed first, and
+// where to install it, when the user's installed plugins are cached. Otherwise the
+// suggestions are left unannotated and the install check happens when one is selected.
+func (s *AgentService) annotateInstall(ctx context.Context, publicKey string, suggestions []Suggestion) {
+	installed := s.cachedInstalledPlugins(ctx, publicKey)
+	if installed == nil {
+		return
+	}
+	for i := range suggestions {
+		missing := !slices.Contains(installed.PluginIDs, suggestions[i].PluginID)
+		checkedAt := installed.FetchedAt
+		suggestions[i].RequiresInstall = &missing
+		suggestions[i].InstallCheckedAt = &checkedAt
+		if missing {
+			suggestions[i].InstallURL = s.installURL(suggestions[i].PluginID)
+		}
+	}
+}
+
+// installURL returns the deeplink installing pluginID, or "" when none is configured.
+func (s *AgentService) installURL(pluginID string) string {
+	if s.pluginInstallURL == "" {
+		return ""
+	}
+	return strings.ReplaceAll(s.pluginInstallURL, "{plugin_id}", url.PathEscape(pluginID))
+}
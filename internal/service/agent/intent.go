@@ -3,81 +3,83 @@ package agent
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 
 	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/service/outbox"
 	"github.com/vultisig/agent-backend/internal/types"
 )
 
 const suggestionTTL = 1 * time.Hour
 
 // detectIntent handles Ability 1: detect user intent and generate response with suggestions.
-func (s *AgentService) detectIntent(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, window *conversationWindow) (*SendMessageResponse, error) {
+func (s *AgentService) detectIntent(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, window *conversationWindow) (_ *SendMessageResponse, err error) {
+	// Attachments are loaded first, so a missing one rejects the message before it is stored
+	images, err := s.loadAttachments(ctx, req.PublicKey, req.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
 	// 1. Store user message in DB
 	userMsg := &types.Message{
 		ConversationID: convID,
 		Role:           types.RoleUser,
 		Content:        req.Content,
 		ContentType:    "text",
+		Metadata:       markNoMemory(ctx, attachmentMetadata(images)),
 	}
-	if err := s.msgRepo.Create(ctx, userMsg); err != nil {
+	if err := s.msgRepo.CreateIfOwned(ctx, userMsg, req.PublicKey); err != nil {
 		return nil, fmt.Errorf("store user message: %w", err)
 	}
+	noteWrite(ctx, userMsg)
+	s.indexMessage(ctx, userMsg)
+	return s.answerIntent(ctx, convID, req, window, userMsg.ID, withImages(appendUserTurn(anthropicMessagesFromWindow(window), req.Content), images))
+}
 
-	// 2. Build system prompt with user context and plugin skills
+// answerIntent generates and stores the reply to a stored user message, whose content is
+// req.Content. messages is the conversation for the model, ending with that message. A
+// failure stores an error reply, so the message can be retried.
+func (s *AgentService) answerIntent(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, window *conversationWindow, userMsgID uuid.UUID, messages []anthropic.Message) (_ *SendMessageResponse, err error) {
+	// From here on a failure would leave the user message unanswered
+	defer func() {
+		if err != nil {
+			s.storeErrorReply(ctx, convID, userMsgID, true)
+		}
+	}()
+
+	// 2-5. Build the request: system prompt with user context, plugin skills and memory, and tools
+	injection := s.checkInjection(convID, window, req.Content, "intent")
+	anthropicReq, pluginSkills := s.buildIntentRequest(ctx, &intentTurn{
+		convID:    convID,
+		publicKey: req.PublicKey,
+		content:   req.Content,
+		context:   req.Context,
+		maxTokens: req.MaxTokens,
+		injection: injection,
+		window:    window,
+		messages:  messages,
+	})
+	systemPrompt := anthropicReq.System
 	var balances []Balance
-	var addresses map[string]string
 	if req.Context != nil {
 		balances = req.Context.Balances
-		addresses = req.Context.Addresses
-	}
-
-	var pluginSkills []PluginSkill
-	if s.pluginProvider != nil {
-		pluginSkills = s.pluginProvider.GetSkills(ctx)
 	}
+	rc := &RequestContext{PublicKey: req.PublicKey, ConversationID: convID}
+	handlers := s.intentTools.Handlers(rc)
 
-	basePrompt := BuildFullPrompt(balances, addresses, pluginSkills)
-
-	// 3. Load memory and build system prompt
-	systemPrompt := BuildSystemPromptWithSummary(
-		basePrompt+s.loadMemorySection(ctx, req.PublicKey)+MemoryManagementInstructions,
-		window.summary,
-	)
-
-	// 4. Build messages for Anthropic
-	messages := anthropicMessagesFromWindow(window)
-	messages = append(messages, anthropic.Message{
-		Role:    "user",
-		Content: req.Content,
-	})
-
-	// 5. Build tools list (respond_to_user + optional update_memory)
-	tools := []anthropic.Tool{RespondToUserTool}
-	tools = append(tools, s.memoryTools()...)
-
-	// 6. Single Claude call — force respond_to_user (update_memory can still be called in parallel)
-	anthropicReq := &anthropic.Request{
-		System:   systemPrompt,
-		Messages: messages,
-		Tools:    tools,
-		ToolChoice: &anthropic.ToolChoice{
-			Type: "tool",
-			Name: "respond_to_user",
-		},
-	}
-
-	resp, err := s.anthropic.SendMessage(ctx, anthropicReq)
+	resp, err := s.runTools(ctx, abilityIntent, anthropicReq, RespondToUserTool.Name, handlers, maxIntentToolRounds)
 	if err != nil {
 		return nil, fmt.Errorf("call anthropic: %w", err)
 	}
 
-	// 7. Parse response: extract respond_to_user and optional update_memory
+	// 6. Parse response: extract respond_to_user and optional update_memory
 	s.logger.WithFields(logrus.Fields{
 		"stop_reason":   resp.StopReason,
 		"content_count": len(resp.Content),
@@ -92,17 +94,16 @@ func (s *AgentService) detectIntent(ctx context.Context, convID uuid.UUID, req *
 	}
 
 	var toolResp *ToolResponse
-	var textContent string
+	var texts []string
 
 	for _, block := range resp.Content {
 		switch block.Type {
 		case "text":
-			textContent = block.Text
+			texts = append(texts, block.Text)
 		case "tool_use":
 			if block.Name == "respond_to_user" {
 				var tr ToolResponse
-				if err := json.Unmarshal(block.Input, &tr); err != nil {
-					s.logger.WithError(err).Warn("failed to unmarshal respond_to_user")
+				if err := s.parseToolInput(ctx, abilityIntent, resp, block, &tr); err != nil {
 					continue
 				}
 				toolResp = &tr
@@ -110,103 +111,273 @@ func (s *AgentService) detectIntent(ctx context.Context, convID uuid.UUID, req *
 		}
 	}
 
-	// 8. Fire-and-forget: persist memory update if present
-	s.persistMemoryUpdate(ctx, req.PublicKey, s.extractMemoryUpdate(resp))
+	// 7. Persist memory update if present
+	memResult := s.persistMemoryUpdate(ctx, req.PublicKey, window, s.extractMemoryUpdate(ctx, abilityIntent, resp))
+
+	// 8. Ground general questions in the Vultisig docs when retrieval finds relevant passages
+	var citations []Citation
+	if toolResp != nil && toolResp.Intent == "general_question" {
+		if grounded := s.answerFromDocs(ctx, systemPrompt, messages[:len(messages)-1], req.Content); grounded != nil {
+			toolResp.Response = grounded.text
+			citations = grounded.citations
+		}
+	}
 
 	// 9. Build response
-	if toolResp != nil {
-		return s.buildIntentResponse(ctx, convID, req, toolResp, window)
+	var out *SendMessageResponse
+	switch {
+	case toolResp != nil:
+		if toolResp.Intent == "unclear" {
+			metrics.IncUnclearIntent(req.Context != nil, len(balances) > 0)
+		}
+		// Quotes move quickly, so they go with the reply showing when they were taken
+		toolResp.quotes = rc.quotes
+		out, err = s.buildIntentResponse(ctx, convID, req, toolResp, citations, memResult, window)
+	case strings.TrimSpace(strings.Join(texts, "")) != "":
+		// Text fallback (no tool called): keep its suggestions when they can be recovered
+		text := strings.Join(texts, "\n\n")
+		if recovered := s.recoverToolResponse(ctx, pluginSkills, req.Content, text); recovered != nil {
+			out, err = s.buildIntentResponse(ctx, convID, req, recovered, nil, memResult, window)
+		} else {
+			out, err = s.buildIntentResponseFromText(ctx, convID, text, memResult)
+		}
+	default:
+		return nil, errEmptyResponse
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Grounded answers are rewritten from the docs, so the original blocks no longer match
+	if req.IncludeContentBlocks && len(citations) == 0 {
+		out.ContentBlocks = s.contentBlocks(resp)
+	}
+	return out, nil
+}
+
+// intentTurn is what an intent request is built from.
+type intentTurn struct {
+	convID    uuid.UUID
+	publicKey string
+	// content is the user message answered
+	content string
+	// context is the request's wallet context, nil when it isn't known
+	context   *MessageContext
+	maxTokens *int
+	// injection lists the likely prompt injection categories in the conversation
+	injection []string
+	window    *conversationWindow
+	// messages is the conversation for the model, ending with the user message answered
+	messages []anthropic.Message
+}
+
+// buildIntentRequest builds the Ability 1 request answering turn: the system prompt with the
+// ranked plugin skills, wallet context, recent activity, memory (or the injection guard),
+// summary and recalled messages, and the tools. It returns the plugins the prompt lists.
+func (s *AgentService) buildIntentRequest(ctx context.Context, turn *intentTurn) (*anthropic.Request, []PluginSkill) {
+	var balances []Balance
+	var addresses map[string]string
+	var activity []Activity
+	if turn.context != nil {
+		balances = turn.context.Balances
+		addresses = turn.context.Addresses
+		activity = turn.context.RecentActivity
 	}
 
-	// Text fallback (no tool called)
-	if textContent != "" {
-		return s.buildIntentResponseFromText(ctx, convID, textContent, window)
+	// Static part (base + plugin skills) is cached per skills generation; only the wallet context is rendered per request
+	staticPrompt, pluginSkills := s.rankedStaticPrompt(ctx, pluginQuery(turn.content, turn.window), balanceChains(balances))
+	basePrompt := staticPrompt + BuildWalletContext(s.promptBalances(balances), addresses, s.loadContacts(ctx, turn.publicKey)) +
+		BuildRecentActivity(activity)
+
+	// Likely injection attempts get a guard section and can't write to memory, so they can't
+	// persist into later conversations
+	memoryPrompt := s.memoryPrompt(ctx, turn.publicKey, turn.window)
+	if len(turn.injection) > 0 {
+		memoryPrompt = s.loadMemorySection(ctx, turn.publicKey, turn.window) + InjectionGuardInstructions
 	}
+	systemPrompt := BuildSystemPromptWithSummary(
+		basePrompt+memoryPrompt,
+		turn.window.summary,
+	) + s.recallSection(ctx, turn.convID, turn.content, turn.window)
 
-	return nil, errors.New("no response content from Claude")
+	// respond_to_user + optional update_memory and registered server-side tools
+	tools := []anthropic.Tool{RespondToUserTool}
+	if len(turn.injection) == 0 {
+		tools = append(tools, s.memoryTools(ctx, turn.window)...)
+	}
+
+	// Force respond_to_user (update_memory can still be called in parallel). With lookup
+	// tools available the model may call them first; they are answered server-side.
+	req := &anthropic.Request{
+		MaxTokens: s.abilityMaxTokens[abilityIntent],
+		System:    systemPrompt,
+		Messages:  turn.messages,
+		Tools:     tools,
+		ToolChoice: &anthropic.ToolChoice{
+			Type: "tool",
+			Name: RespondToUserTool.Name,
+		},
+	}
+	if turn.maxTokens != nil {
+		req.MaxTokens = *turn.maxTokens
+	}
+	if serverTools := s.intentTools.Tools(); len(serverTools) > 0 && s.toolsEnabled(ctx) {
+		req.Tools = append(req.Tools, serverTools...)
+		req.ToolChoice = &anthropic.ToolChoice{Type: "any"}
+	}
+	return req, pluginSkills
 }
 
+// maxSuggestionRationale caps a suggestion's rationale, in runes.
+const maxSuggestionRationale = 140
+
 // buildIntentResponse builds the final response when respond_to_user was called.
-func (s *AgentService) buildIntentResponse(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, toolResp *ToolResponse, window *conversationWindow) (*SendMessageResponse, error) {
-	responseContent := toolResp.Response
+func (s *AgentService) buildIntentResponse(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, toolResp *ToolResponse, citations []Citation, memResult memoryUpdateResult, window *conversationWindow) (*SendMessageResponse, error) {
+	responseContent, truncated := s.processResponse(toolResp.Response)
 
-	// Store suggestions in Redis (1hr TTL)
+	// Unsure of the intent, ask instead of suggesting; then suggestions the model isn't
+	// confident the user wants are withheld, for the app to mention rather than offer as chips
+	clarifying, tentative := s.applyIntentConfidence(toolResp)
+	withheld := s.gateSuggestions(toolResp)
+
+	// Suggestions are cached in Redis (1hr TTL) through the outbox, committed with the message.
+	// When switched off, the model's suggestions are dropped.
 	var suggestions []Suggestion
-	if len(toolResp.Suggestions) > 0 {
+	var events []*types.OutboxEvent
+	if len(toolResp.Suggestions) > 0 && s.suggestionsEnabled(ctx) {
 		for _, ts := range toolResp.Suggestions {
-			suggID := "sug_" + uuid.New().String()
-			sugg := Suggestion{
-				ID:          suggID,
-				PluginID:    ts.PluginID,
-				Title:       ts.Title,
-				Description: ts.Description,
-			}
-			suggestions = append(suggestions, sugg)
+			suggestions = append(suggestions, Suggestion{
+				ID:             "sug_" + uuid.New().String(),
+				PluginID:       ts.PluginID,
+				Title:          ts.Title,
+				Description:    ts.Description,
+				Rationale:      truncateWords(strings.TrimSpace(ts.Rationale), maxSuggestionRationale),
+				ConversationID: convID.String(),
+				Tentative:      tentative,
+			})
+		}
+		s.annotateInstall(ctx, req.PublicKey, suggestions)
 
-			// Store in Redis
+		for _, sugg := range suggestions {
 			suggJSON, err := json.Marshal(sugg)
 			if err != nil {
 				s.logger.WithError(err).Warn("failed to marshal suggestion")
 				continue
 			}
-			if err := s.redis.Set(ctx, suggID, string(suggJSON), suggestionTTL); err != nil {
-				s.logger.WithError(err).Warn("failed to store suggestion in redis")
+			event, err := outbox.NewRedisSetEvent(sugg.ID, string(suggJSON), suggestionTTL)
+			if err != nil {
+				s.logger.WithError(err).Warn("failed to build suggestion cache event")
+				continue
 			}
+			events = append(events, event)
 		}
+		s.prefetchSchemas(ctx, suggestions)
 	}
 
 	// Store assistant message in DB
 	intent := toolResp.Intent
-	metadata, _ := json.Marshal(map[string]any{
+	meta := map[string]any{
 		"intent":      intent,
 		"suggestions": suggestions,
-	})
+	}
+	if toolResp.Confidence != nil {
+		meta["confidence"] = *toolResp.Confidence
+	}
+	blocks := s.validBlocks(quoteBlocks(toolResp.quotes))
+	if len(blocks) > 0 {
+		meta["blocks"] = blocks
+	}
+	if clarifying != "" {
+		meta["clarifying_question"] = clarifying
+	}
+	if len(withheld) > 0 {
+		meta["withheld_suggestions"] = withheld
+	}
+	if len(citations) > 0 {
+		meta["citations"] = citations
+	}
+	if truncated {
+		meta["truncated"] = true
+	}
+	if toolResp.recovered {
+		meta["recovered_from_text"] = true
+	}
+	memResult.annotate(meta)
+	metadata, _ := json.Marshal(meta)
 	assistantMsg := &types.Message{
 		ConversationID: convID,
 		Role:           types.RoleAssistant,
 		Content:        responseContent,
 		ContentType:    "text",
+		AudioURL:       s.replyAudio(ctx, convID, req, responseContent),
 		Metadata:       metadata,
+		Blocks:         blocks,
 	}
-	if err := s.msgRepo.Create(ctx, assistantMsg); err != nil {
+	if err := s.storeAssistantMessage(ctx, assistantMsg, events); err != nil {
 		return nil, fmt.Errorf("store assistant message: %w", err)
 	}
 
+	if len(suggestions) > 0 {
+		s.trackExpiry(ctx, types.ExpiryNoticeSuggestion, assistantMsg.ID.String(), convID, time.Now().Add(suggestionTTL))
+	}
+	s.tagConversation(ctx, convID, req.PublicKey, intent, suggestions)
+
 	// Update conversation title if this is the first exchange
 	if window.total <= 2 {
-		title := truncateTitle(req.Content)
-		if err := s.convRepo.UpdateTitle(ctx, convID, req.PublicKey, title); err != nil {
-			s.logger.WithError(err).Warn("failed to update conversation title")
-		}
+		s.setInitialTitle(ctx, convID, req.PublicKey, req.Content, responseContent)
 	}
 
 	return &SendMessageResponse{
-		Message:     *assistantMsg,
-		Suggestions: suggestions,
+		Message:             *assistantMsg,
+		Suggestions:         suggestions,
+		WithheldSuggestions: withheld,
+		ClarifyingQuestion:  clarifying,
+		Citations:           citations,
+		MemoryUpdated:       memResult.Updated,
+		MemorySections:      memResult.Sections,
+		RolloverSuggested:   window.rolloverSuggested,
 	}, nil
 }
 
 // buildIntentResponseFromText builds a response from text fallback (no tool called).
-func (s *AgentService) buildIntentResponseFromText(ctx context.Context, convID uuid.UUID, text string, window *conversationWindow) (*SendMessageResponse, error) {
+func (s *AgentService) buildIntentResponseFromText(ctx context.Context, convID uuid.UUID, text string, memResult memoryUpdateResult) (*SendMessageResponse, error) {
+	text, truncated := s.processResponse(text)
+	meta := map[string]any{}
+	if truncated {
+		meta["truncated"] = true
+	}
+	memResult.annotate(meta)
+	var metadata []byte
+	if len(meta) > 0 {
+		metadata, _ = json.Marshal(meta)
+	}
 	assistantMsg := &types.Message{
 		ConversationID: convID,
 		Role:           types.RoleAssistant,
 		Content:        text,
 		ContentType:    "text",
+		Metadata:       metadata,
 	}
-	if err := s.msgRepo.Create(ctx, assistantMsg); err != nil {
+	if err := s.storeAssistantMessage(ctx, assistantMsg, nil); err != nil {
 		return nil, fmt.Errorf("store assistant message: %w", err)
 	}
 	return &SendMessageResponse{
-		Message: *assistantMsg,
+		Message:        *assistantMsg,
+		MemoryUpdated:  memResult.Updated,
+		MemorySections: memResult.Sections,
 	}, nil
 }
 
-// truncateTitle truncates content to create a conversation title.
+// truncateTitle truncates content to create a conversation title, without splitting a
+// character.
 func truncateTitle(content string) string {
 	const maxLen = 50
 	if len(content) <= maxLen {
 		return content
 	}
-	return content[:maxLen-3] + "..."
+	cut := maxLen - 3
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return content[:cut] + "..."
 }
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// MaxLabelLength caps the length of a conversation label, in characters.
+const MaxLabelLength = 32
+
+// NormalizeLabels trims and validates user-supplied conversation labels: each must be
+// non-empty, at most MaxLabelLength characters and free of control characters. Inner
+// whitespace is collapsed and case-insensitive duplicates are dropped, keeping the first.
+func NormalizeLabels(labels []string) ([]string, error) {
+	if len(labels) == 0 {
+		return nil, errors.New("labels are required")
+	}
+
+	out := make([]string, 0, len(labels))
+	seen := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		label = strings.Join(strings.Fields(label), " ")
+		if label == "" {
+			return nil, errors.New("labels must not be empty")
+		}
+		if len([]rune(label)) > MaxLabelLength {
+			return nil, fmt.Errorf("label %q must be at most %d characters", label, MaxLabelLength)
+		}
+		if strings.IndexFunc(label, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("label %q contains control characters", label)
+		}
+		key := strings.ToLower(label)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, label)
+	}
+	return out, nil
+}
@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "kept as typed", labels: []string{"ETH strategy", "tax"}, want: []string{"ETH strategy", "tax"}},
+		{name: "whitespace collapsed", labels: []string{"  ETH \t strategy  "}, want: []string{"ETH strategy"}},
+		{name: "case-insensitive duplicates keep the first", labels: []string{"Tax", "tax", "TAX "}, want: []string{"Tax"}},
+		{name: "at the length cap", labels: []string{strings.Repeat("é", MaxLabelLength)}, want: []string{strings.Repeat("é", MaxLabelLength)}},
+		{name: "over the length cap", labels: []string{strings.Repeat("a", MaxLabelLength+1)}, wantErr: true},
+		{name: "blank", labels: []string{"tax", "   "}, wantErr: true},
+		{name: "control characters", labels: []string{"tax\x00"}, wantErr: true},
+		{name: "none", labels: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeLabels(tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeLabels() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// lockPollInterval is how often a waiting message retries its conversation's lock.
+const lockPollInterval = 100 * time.Millisecond
+
+// ErrConversationBusy is returned by ProcessMessage when another message in the same
+// conversation is still being processed after the lock wait.
+var ErrConversationBusy = errors.New("conversation is busy with another message")
+
+func conversationLockKey(convID uuid.UUID) string {
+	return fmt.Sprintf("conv_lock:%s", convID)
+}
+
+// lockConversation serializes messages to one conversation across instances: it waits up to
+// the configured lock wait for the conversation's lock and returns a function releasing it.
+// The lock expires on its own after the lock TTL. When Redis is unavailable the message
+// proceeds unlocked rather than failing.
+func (s *AgentService) lockConversation(ctx context.Context, convID uuid.UUID) (unlock func(), err error) {
+	key := conversationLockKey(convID)
+	token := uuid.NewString()
+	deadline := time.Now().Add(s.lockWait)
+
+	for {
+		ok, err := s.redis.SetNX(ctx, key, token, s.lockTTL)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to take conversation lock, proceeding unlocked")
+			return func() {}, nil
+		}
+		if ok {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			return nil, ErrConversationBusy
+		}
+		select {
+		case <-time.After(lockPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return func() {
+		// Release even if the request was canceled, so the next message needn't wait out the TTL
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), detachedWriteTimeout)
+		defer cancel()
+		if _, err := s.redis.DeleteIfEqual(releaseCtx, key, token); err != nil {
+			s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to release conversation lock")
+		}
+	}, nil
+}
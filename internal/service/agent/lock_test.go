@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+)
+
+// gatedModel holds every request until release is closed, then answers with resp.
+type gatedModel struct {
+	started chan struct{}
+	release chan struct{}
+	resp    *anthropic.Response
+}
+
+func (m *gatedModel) SendMessage(ctx context.Context, _ *anthropic.Request) (*anthropic.Response, error) {
+	m.started <- struct{}{}
+	select {
+	case <-m.release:
+		return m.resp, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestProcessMessageConversationBusy(t *testing.T) {
+	model := &gatedModel{
+		started: make(chan struct{}, 2),
+		release: make(chan struct{}),
+		resp: toolReply(RespondToUserTool.Name, map[string]any{
+			"intent":   "general_question",
+			"response": "Vultisig is a multi-chain wallet.",
+		}),
+	}
+	svc, msgs := newConversationService(nil)
+	svc.anthropic = model
+	svc.lockTTL = time.Minute
+	svc.lockWait = 20 * time.Millisecond
+
+	convID := uuid.New()
+	send := func(content string) error {
+		_, err := svc.ProcessMessage(context.Background(), convID, testOwner, &SendMessageRequest{
+			PublicKey: testOwner,
+			Content:   content,
+		})
+		return err
+	}
+
+	first := make(chan error, 1)
+	go func() { first <- send("what is vultisig?") }()
+	<-model.started
+
+	// The first message holds the conversation for as long as the model takes
+	if err := send("and what chains?"); !errors.Is(err, ErrConversationBusy) {
+		t.Fatalf("second send error = %v, want ErrConversationBusy", err)
+	}
+	if stored := msgs.stored(); len(stored) != 1 {
+		t.Errorf("stored %d messages while busy, want only the first user message", len(stored))
+	}
+
+	close(model.release)
+	if err := <-first; err != nil {
+		t.Fatalf("first send error = %v", err)
+	}
+	if _, err := svc.redis.Get(context.Background(), conversationLockKey(convID)); !errors.Is(err, errCacheMiss) {
+		t.Errorf("conversation lock still held after the first send: %v", err)
+	}
+
+	if err := send("and what chains?"); err != nil {
+		t.Fatalf("second send after unlock error = %v", err)
+	}
+	if stored := msgs.stored(); len(stored) != 4 {
+		t.Errorf("stored %d messages, want both exchanges", len(stored))
+	}
+}
@@ -2,7 +2,7 @@ package agent
 
 import (
 	"context"
-	"encoding/json"
+	"strings"
 
 	"github.com/sirupsen/logrus"
 
@@ -16,10 +16,16 @@ type updateMemoryInput struct {
 	Content string `json:"content"`
 }
 
+// memoryAllowed reports whether memory is enabled and the conversation window wasn't
+// loaded with memory turned off.
+func (s *AgentService) memoryAllowed(ctx context.Context, window *conversationWindow) bool {
+	return !window.noMemory && s.memoryEnabled(ctx)
+}
+
 // loadMemorySection loads the user's memory document and returns the prompt section.
-// Returns empty string if no memory exists or memRepo is nil.
-func (s *AgentService) loadMemorySection(ctx context.Context, publicKey string) string {
-	if s.memRepo == nil {
+// Returns empty string if no memory exists or memory is disabled for the conversation.
+func (s *AgentService) loadMemorySection(ctx context.Context, publicKey string, window *conversationWindow) string {
+	if !s.memoryAllowed(ctx, window) {
 		return ""
 	}
 
@@ -35,12 +41,29 @@ func (s *AgentService) loadMemorySection(ctx context.Context, publicKey string)
 	return BuildMemorySection(mem.Content)
 }
 
-// persistMemoryUpdate validates and persists a memory update (fire-and-forget).
-// Logs errors/warnings but never returns them — callers should not block on memory failures.
-func (s *AgentService) persistMemoryUpdate(ctx context.Context, publicKey string, mu *updateMemoryInput) {
-	if mu == nil || s.memRepo == nil {
+// memoryUpdateResult reports whether a memory update was written and which sections changed.
+type memoryUpdateResult struct {
+	Updated  bool
+	Sections []string
+}
+
+// annotate marks assistant message metadata when memory was updated, for history rendering.
+func (r memoryUpdateResult) annotate(meta map[string]any) {
+	if !r.Updated {
 		return
 	}
+	meta["memory_updated"] = true
+	if len(r.Sections) > 0 {
+		meta["memory_sections"] = r.Sections
+	}
+}
+
+// persistMemoryUpdate validates and persists a memory update. Failures are logged, not
+// returned; the result reports Updated only after the DB write succeeds.
+func (s *AgentService) persistMemoryUpdate(ctx context.Context, publicKey string, window *conversationWindow, mu *updateMemoryInput) memoryUpdateResult {
+	if mu == nil || !s.memoryAllowed(ctx, window) {
+		return memoryUpdateResult{}
+	}
 
 	if len(mu.Content) > maxMemoryBytes {
 		s.logger.WithFields(logrus.Fields{
@@ -48,35 +71,110 @@ func (s *AgentService) persistMemoryUpdate(ctx context.Context, publicKey string
 			"length":     len(mu.Content),
 			"max":        maxMemoryBytes,
 		}).Warn("memory update rejected: too large")
-		return
+		return memoryUpdateResult{}
 	}
 
-	if err := s.memRepo.UpsertMemory(ctx, publicKey, mu.Content); err != nil {
-		s.logger.WithError(err).Error("failed to update memory")
-	} else {
+	content, redacted := scrubSensitive(mu.Content)
+	if len(redacted) > 0 {
 		s.logger.WithFields(logrus.Fields{
 			"public_key": publicKey,
-			"length":     len(mu.Content),
-		}).Debug("memory updated")
+			"categories": redacted,
+		}).Warn("security: redacted sensitive content from memory update")
+	}
+
+	// Previous document is only needed to report which sections changed
+	var previous string
+	if mem, err := s.memRepo.GetMemory(ctx, publicKey); err == nil && mem != nil {
+		previous = mem.Content
+	}
+
+	if err := s.memRepo.UpsertMemory(ctx, publicKey, content); err != nil {
+		s.logger.WithError(err).Error("failed to update memory")
+		return memoryUpdateResult{}
+	}
+	s.logger.WithFields(logrus.Fields{
+		"public_key": publicKey,
+		"length":     len(content),
+	}).Debug("memory updated")
+
+	return memoryUpdateResult{Updated: true, Sections: changedMemorySections(previous, content)}
+}
+
+// changedMemorySections returns the markdown headings whose content differs between two
+// memory documents, including added and removed sections, in document order.
+func changedMemorySections(before, after string) []string {
+	oldSections, oldOrder := splitMemorySections(before)
+	newSections, newOrder := splitMemorySections(after)
+
+	var changed []string
+	for _, heading := range newOrder {
+		if old, ok := oldSections[heading]; !ok || old != newSections[heading] {
+			changed = append(changed, heading)
+		}
+	}
+	for _, heading := range oldOrder {
+		if _, ok := newSections[heading]; !ok {
+			changed = append(changed, heading)
+		}
+	}
+	return changed
+}
+
+// splitMemorySections maps each markdown heading to its trimmed body. Text before the first
+// heading is ignored.
+func splitMemorySections(doc string) (map[string]string, []string) {
+	sections := make(map[string]string)
+	var order []string
+	var heading string
+	var body strings.Builder
+
+	flush := func() {
+		if heading != "" {
+			sections[heading] = strings.TrimSpace(body.String())
+		}
+		body.Reset()
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.HasPrefix(line, "#") {
+			flush()
+			heading = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			if _, seen := sections[heading]; !seen {
+				order = append(order, heading)
+			}
+			continue
+		}
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	flush()
+	return sections, order
+}
+
+// memoryPrompt returns the memory section with the instructions for updating it, or an
+// empty string when memory is disabled for the conversation.
+func (s *AgentService) memoryPrompt(ctx context.Context, publicKey string, window *conversationWindow) string {
+	if !s.memoryAllowed(ctx, window) {
+		return ""
 	}
+	return s.loadMemorySection(ctx, publicKey, window) + MemoryManagementInstructions
 }
 
-// memoryTools returns the update_memory tool if memRepo is configured, for appending to ability tool lists.
-func (s *AgentService) memoryTools() []anthropic.Tool {
-	if s.memRepo == nil {
+// memoryTools returns the update_memory tool if memory is enabled for the conversation, for
+// appending to ability tool lists.
+func (s *AgentService) memoryTools(ctx context.Context, window *conversationWindow) []anthropic.Tool {
+	if !s.memoryAllowed(ctx, window) {
 		return nil
 	}
 	return []anthropic.Tool{UpdateMemoryTool}
 }
 
 // extractMemoryUpdate scans response content blocks for an update_memory tool call.
-// Returns nil if not found. Logs and skips malformed input.
-func (s *AgentService) extractMemoryUpdate(resp *anthropic.Response) *updateMemoryInput {
+// Returns nil if not found. Malformed input is recorded as a parse failure of ability and skipped.
+func (s *AgentService) extractMemoryUpdate(ctx context.Context, ability string, resp *anthropic.Response) *updateMemoryInput {
 	for _, block := range resp.Content {
 		if block.Type == "tool_use" && block.Name == "update_memory" {
 			var mu updateMemoryInput
-			if err := json.Unmarshal(block.Input, &mu); err != nil {
-				s.logger.WithError(err).Warn("failed to unmarshal update_memory")
+			if err := s.parseToolInput(ctx, ability, resp, block, &mu); err != nil {
 				continue
 			}
 			return &mu
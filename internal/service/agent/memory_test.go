@@ -0,0 +1,220 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// fakeMemoryStore holds one user's memory document, recording reads and writes. Writes
+// fail with err when it is set.
+type fakeMemoryStore struct {
+	content string
+	err     error
+	reads   int
+	writes  []string
+}
+
+func (f *fakeMemoryStore) GetMemory(_ context.Context, publicKey string) (*types.UserMemory, error) {
+	f.reads++
+	if f.content == "" {
+		return nil, nil
+	}
+	return &types.UserMemory{PublicKey: publicKey, Content: f.content}, nil
+}
+
+func (f *fakeMemoryStore) UpsertMemory(_ context.Context, _ string, content string) error {
+	f.writes = append(f.writes, content)
+	if f.err != nil {
+		return f.err
+	}
+	f.content = content
+	return nil
+}
+
+func TestProcessMessageNoMemory(t *testing.T) {
+	const existing = "# Preferences\nPrefers ETH."
+
+	tests := []struct {
+		name       string
+		convNoMem  bool
+		reqNoMem   bool
+		wantMemory bool
+	}{
+		{name: "memory on", wantMemory: true},
+		{name: "conversation has memory off", convNoMem: true},
+		{name: "request has memory off", reqNoMem: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The model answers and asks to remember something in the same turn
+			reply := toolReply(RespondToUserTool.Name, map[string]any{
+				"intent":   "general_question",
+				"response": "Noted.",
+			})
+			update := toolReply(UpdateMemoryTool.Name, map[string]any{"content": "# Preferences\nPrefers BTC."})
+			reply.Content = append(reply.Content, update.Content...)
+			reply.Content[1].ID = "toolu_2"
+
+			model := &fakeModel{resp: reply}
+			memory := &fakeMemoryStore{content: existing}
+			svc := NewAgentService(Deps{
+				Anthropic:     model,
+				Messages:      &fakeMessageStore{},
+				Conversations: &fakeConversationStore{owner: testOwner, noMemory: tt.convNoMem},
+				Memory:        memory,
+				Cache:         newFakeCache(),
+				Logger:        testLogger(),
+			}, Settings{
+				Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+				Agent:   config.AgentConfig{IntentMaxTokens: 1024},
+			})
+
+			resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   "I prefer BTC now, remember that",
+				NoMemory:  tt.reqNoMem,
+			})
+			if err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+			if len(model.requests) == 0 {
+				t.Fatal("model got no requests")
+			}
+
+			var offered bool
+			for _, tool := range model.requests[0].Tools {
+				offered = offered || tool.Name == UpdateMemoryTool.Name
+			}
+			injected := strings.Contains(model.requests[0].System, existing)
+
+			if !tt.wantMemory {
+				if len(memory.writes) != 0 || resp.MemoryUpdated {
+					t.Errorf("memory writes = %q, memory_updated = %v; want nothing written", memory.writes, resp.MemoryUpdated)
+				}
+				if memory.content != existing {
+					t.Errorf("memory = %q, want the existing document kept", memory.content)
+				}
+				if memory.reads != 0 || injected {
+					t.Errorf("memory read %d times, injected = %v; want it left out of the prompt", memory.reads, injected)
+				}
+				if offered {
+					t.Errorf("tools include %s, want it left out", UpdateMemoryTool.Name)
+				}
+				return
+			}
+			if len(memory.writes) != 1 || !resp.MemoryUpdated {
+				t.Errorf("memory writes = %q, memory_updated = %v; want the update written", memory.writes, resp.MemoryUpdated)
+			}
+			if !injected || !offered {
+				t.Errorf("memory injected = %v, %s offered = %v; want both", injected, UpdateMemoryTool.Name, offered)
+			}
+		})
+	}
+}
+
+func TestProcessMessageMemoryUpdated(t *testing.T) {
+	const existing = "# Preferences\nPrefers ETH.\n\n# Vaults\nMain vault on Ethereum."
+
+	tests := []struct {
+		name         string
+		content      string
+		repoErr      error
+		secret       string
+		wantWrites   int
+		wantUpdated  bool
+		wantSections []string
+	}{
+		{
+			name:         "section changed",
+			content:      "# Preferences\nPrefers BTC.\n\n# Vaults\nMain vault on Ethereum.",
+			wantWrites:   1,
+			wantUpdated:  true,
+			wantSections: []string{"Preferences"},
+		},
+		{
+			// Sensitive content is redacted, not rejected
+			name:         "redacted",
+			secret:       "4c0883a69102937d",
+			content:      "# Preferences\nPrefers BTC. Key 0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318\n\n# Vaults\nMain vault on Ethereum.",
+			wantWrites:   1,
+			wantUpdated:  true,
+			wantSections: []string{"Preferences"},
+		},
+		{
+			name:    "too large",
+			content: "# Preferences\n" + strings.Repeat("x", maxMemoryBytes),
+		},
+		{
+			name:       "write fails",
+			content:    "# Preferences\nPrefers BTC.",
+			repoErr:    errors.New("connection reset"),
+			wantWrites: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := toolReply(RespondToUserTool.Name, map[string]any{
+				"intent":   "general_question",
+				"response": "Noted.",
+			})
+			update := toolReply(UpdateMemoryTool.Name, map[string]any{"content": tt.content})
+			reply.Content = append(reply.Content, update.Content...)
+			reply.Content[1].ID = "toolu_2"
+
+			memory := &fakeMemoryStore{content: existing, err: tt.repoErr}
+			msgs := &fakeMessageStore{}
+			svc := NewAgentService(Deps{
+				Anthropic:     &fakeModel{resp: reply},
+				Messages:      msgs,
+				Conversations: &fakeConversationStore{owner: testOwner},
+				Memory:        memory,
+				Cache:         newFakeCache(),
+				Logger:        testLogger(),
+			}, Settings{
+				Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+				Agent:   config.AgentConfig{IntentMaxTokens: 1024},
+			})
+
+			resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   "I prefer BTC now, remember that",
+			})
+			if err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+
+			if len(memory.writes) != tt.wantWrites {
+				t.Errorf("memory writes = %d, want %d", len(memory.writes), tt.wantWrites)
+			}
+			if tt.secret != "" && strings.Contains(memory.content, tt.secret) {
+				t.Errorf("memory = %q, want the key redacted", memory.content)
+			}
+			if resp.MemoryUpdated != tt.wantUpdated || !slices.Equal(resp.MemorySections, tt.wantSections) {
+				t.Errorf("memory_updated = %v, memory_sections = %q; want %v, %q", resp.MemoryUpdated, resp.MemorySections, tt.wantUpdated, tt.wantSections)
+			}
+
+			stored := msgs.stored()
+			var meta struct {
+				MemoryUpdated  bool     `json:"memory_updated"`
+				MemorySections []string `json:"memory_sections"`
+			}
+			if err := json.Unmarshal(stored[len(stored)-1].Metadata, &meta); err != nil {
+				t.Fatalf("assistant metadata: %v", err)
+			}
+			if meta.MemoryUpdated != tt.wantUpdated || !slices.Equal(meta.MemorySections, tt.wantSections) {
+				t.Errorf("stored marker = %v %q, want %v %q", meta.MemoryUpdated, meta.MemorySections, tt.wantUpdated, tt.wantSections)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/service/attachment"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+)
+
+// Message outcomes, classifying how processing a message ended.
+const (
+	MessageOK = "ok"
+	// MessageClientError is a request the user can fix or that ended on their side: an
+	// unknown conversation, a busy or full one, an aborted reply, an expired session
+	MessageClientError = "client_error"
+	// MessageAIError is a failed model call or an unusable model response
+	MessageAIError = "ai_error"
+	// MessageVerifierError is a failed call to the plugin service
+	MessageVerifierError = "verifier_error"
+	// MessageDBError is a failed database query
+	MessageDBError = "db_error"
+	// MessageInternalError is any other failure
+	MessageInternalError = "internal_error"
+)
+
+// MessageError is the error ProcessMessage and RetryMessage fail with. It wraps the cause,
+// so errors.Is and errors.As see through it, and tells which ability failed and how.
+type MessageError struct {
+	Ability string
+	Outcome string
+	Err     error
+}
+
+func (e *MessageError) Error() string { return e.Err.Error() }
+
+func (e *MessageError) Unwrap() error { return e.Err }
+
+// ModelError is returned for failed model calls.
+type ModelError struct {
+	Err error
+}
+
+func (e *ModelError) Error() string { return e.Err.Error() }
+
+func (e *ModelError) Unwrap() error { return e.Err }
+
+// RequestAbility returns the ability a send-message request is routed to: confirm for
+// action results, policy for a selected suggestion and intent otherwise, including the
+// fast path and retries.
+func RequestAbility(req *SendMessageRequest) string {
+	switch {
+	case req.ActionResult != nil:
+		return abilityConfirm
+	case req.SelectedSuggestionID != nil:
+		return abilityPolicy
+	default:
+		return abilityIntent
+	}
+}
+
+// ClassifyMessageError returns the outcome of processing a message that ended with err.
+func ClassifyMessageError(err error) string {
+	var (
+		full        *ConversationFullError
+		wrongConv   *SuggestionConversationError
+		notAllowed  *AddressNotAllowedError
+		modelErr    *ModelError
+		verifierErr *verifier.APIError
+		pgErr       *pgconn.PgError
+		connectErr  *pgconn.ConnectError
+	)
+	switch {
+	case err == nil:
+		return MessageOK
+	case errors.Is(err, context.Canceled), errors.Is(err, ErrGenerationAborted), errors.Is(err, ErrConversationBusy),
+		errors.Is(err, ErrMessageNotRetryable), errors.Is(err, ErrMessageAlreadyReplied),
+		errors.Is(err, ErrAttachmentsDisabled), errors.Is(err, attachment.ErrNotFound),
+		errors.Is(err, postgres.ErrNotFound), errors.Is(err, verifier.ErrUnauthorized),
+		errors.As(err, &full), errors.As(err, &wrongConv), errors.As(err, &notAllowed):
+		return MessageClientError
+	case errors.As(err, &modelErr), errors.Is(err, errEmptyResponse):
+		return MessageAIError
+	case errors.Is(err, verifier.ErrUnavailable), errors.As(err, &verifierErr):
+		return MessageVerifierError
+	case errors.As(err, &pgErr), errors.As(err, &connectErr), errors.Is(err, pgx.ErrTxClosed):
+		return MessageDBError
+	default:
+		return MessageInternalError
+	}
+}
+
+// observeMessage records the latency and outcome of processing a message with ability,
+// started at start, and returns err as a *MessageError, or nil on success.
+func observeMessage(ability string, start time.Time, err error) error {
+	outcome := ClassifyMessageError(err)
+	metrics.Messages.WithLabelValues(ability, outcome).Inc()
+	metrics.MessageDuration.WithLabelValues(ability, outcome).Observe(time.Since(start).Seconds())
+	if err == nil {
+		return nil
+	}
+	return &MessageError{Ability: ability, Outcome: outcome, Err: err}
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/service/attachment"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+)
+
+func TestClassifyMessageError(t *testing.T) {
+	wrap := func(err error) error { return fmt.Errorf("build policy: %w", err) }
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "success", want: MessageOK},
+
+		{name: "client went away", err: wrap(context.Canceled), want: MessageClientError},
+		{name: "reply aborted", err: ErrGenerationAborted, want: MessageClientError},
+		{name: "conversation busy", err: ErrConversationBusy, want: MessageClientError},
+		{name: "conversation full", err: wrap(&ConversationFullError{Messages: 100}), want: MessageClientError},
+		{name: "unknown conversation", err: fmt.Errorf("conversation not found: %w", postgres.ErrNotFound), want: MessageClientError},
+		{name: "suggestion from another conversation", err: &SuggestionConversationError{SuggestionID: "sugg-1"}, want: MessageClientError},
+		{name: "address not allowed", err: wrap(&AddressNotAllowedError{Address: "0xabc"}), want: MessageClientError},
+		{name: "message already replied", err: ErrMessageAlreadyReplied, want: MessageClientError},
+		{name: "attachment missing", err: wrap(attachment.ErrNotFound), want: MessageClientError},
+		{name: "session expired", err: wrap(verifier.ErrUnauthorized), want: MessageClientError},
+
+		{name: "model call failed", err: wrap(&ModelError{Err: errors.New("overloaded")}), want: MessageAIError},
+		{name: "model canceled by the server", err: &ModelError{Err: context.DeadlineExceeded}, want: MessageAIError},
+		{name: "empty model response", err: errEmptyResponse, want: MessageAIError},
+
+		{name: "verifier down", err: wrap(fmt.Errorf("get recipe schema: %w", verifier.ErrUnavailable)), want: MessageVerifierError},
+		{name: "verifier error response", err: wrap(&verifier.APIError{StatusCode: 418, Message: "teapot"}), want: MessageVerifierError},
+
+		{name: "query failed", err: wrap(&pgconn.PgError{Code: "23505"}), want: MessageDBError},
+		{name: "transaction closed", err: wrap(pgx.ErrTxClosed), want: MessageDBError},
+
+		{name: "anything else", err: errors.New("marshal metadata"), want: MessageInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyMessageError(tt.err); got != tt.want {
+				t.Errorf("ClassifyMessageError(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestAbility(t *testing.T) {
+	id := "sugg-1"
+	tests := []struct {
+		name string
+		req  SendMessageRequest
+		want string
+	}{
+		{name: "message", req: SendMessageRequest{Content: "hi"}, want: abilityIntent},
+		{name: "suggestion selected", req: SendMessageRequest{SelectedSuggestionID: &id}, want: abilityPolicy},
+		{name: "action result", req: SendMessageRequest{ActionResult: &ActionResult{Action: "create_policy"}, SelectedSuggestionID: &id}, want: abilityConfirm},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RequestAbility(&tt.req); got != tt.want {
+				t.Errorf("RequestAbility() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveMessage(t *testing.T) {
+	count := func(outcome string) float64 {
+		return testutil.ToFloat64(metrics.Messages.WithLabelValues(abilityPolicy, outcome))
+	}
+
+	before := count(MessageOK)
+	if err := observeMessage(abilityPolicy, time.Now(), nil); err != nil {
+		t.Errorf("observeMessage() of a success = %v, want nil", err)
+	}
+	if got := count(MessageOK) - before; got != 1 {
+		t.Errorf("ok messages counted %v times, want 1", got)
+	}
+
+	before = count(MessageVerifierError)
+	cause := fmt.Errorf("get policy suggest: %w", verifier.ErrUnavailable)
+	err := observeMessage(abilityPolicy, time.Now(), cause)
+	var msgErr *MessageError
+	if !errors.As(err, &msgErr) || msgErr.Ability != abilityPolicy || msgErr.Outcome != MessageVerifierError {
+		t.Fatalf("observeMessage() = %#v, want a policy verifier_error MessageError", err)
+	}
+	if !errors.Is(err, verifier.ErrUnavailable) || err.Error() != cause.Error() {
+		t.Errorf("observeMessage() = %v, want it to wrap %v", err, cause)
+	}
+	if got := count(MessageVerifierError) - before; got != 1 {
+		t.Errorf("verifier_error messages counted %v times, want 1", got)
+	}
+}
+
+func TestProcessMessageTypedError(t *testing.T) {
+	svc, _ := newConversationService(&fakeModel{err: errors.New("overloaded")})
+
+	_, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{PublicKey: testOwner, Content: "hi"})
+	var msgErr *MessageError
+	if !errors.As(err, &msgErr) || msgErr.Ability != abilityIntent || msgErr.Outcome != MessageAIError {
+		t.Fatalf("ProcessMessage() error = %#v, want an intent ai_error MessageError", err)
+	}
+	var modelErr *ModelError
+	if !errors.As(err, &modelErr) {
+		t.Errorf("ProcessMessage() error = %v, want the model error wrapped", err)
+	}
+}
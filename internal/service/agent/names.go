@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/names"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// resolveNameInput is the input of the resolve_name tool.
+type resolveNameInput struct {
+	Name string `json:"name"`
+}
+
+// resolveNameTool answers a resolve_name call with the resolved address or an error.
+func (s *AgentService) resolveNameTool(ctx context.Context, input json.RawMessage, _ *RequestContext) (any, error) {
+	var in resolveNameInput
+	if err := json.Unmarshal(input, &in); err != nil || !names.IsName(in.Name) {
+		return nil, errors.New("an ENS (.eth) or SNS (.sol) name is required")
+	}
+
+	res, err := s.names.Resolve(ctx, in.Name)
+	if err != nil {
+		return nil, errors.New(describeNameError(in.Name, err))
+	}
+	return res, nil
+}
+
+// resolveConfigurationNames replaces ENS/SNS names in the configuration's address fields
+// with the addresses they resolve to. It returns the resolutions, or the first name that
+// could not be resolved; names are never passed through to the policy.
+func (s *AgentService) resolveConfigurationNames(ctx context.Context, configuration map[string]any) ([]names.Resolution, string, error) {
+	var resolved []names.Resolution
+	var failed string
+	err := walkAddressFields(configuration, func(fields map[string]any, key, value string) error {
+		if !names.IsName(value) {
+			return nil
+		}
+		if s.names == nil {
+			failed = value
+			return errNameUnresolved
+		}
+		res, err := s.names.Resolve(ctx, value)
+		if err != nil {
+			s.logger.WithError(err).WithField("name", value).Warn("failed to resolve name in policy configuration")
+			failed = value
+			return errNameUnresolved
+		}
+		fields[key] = res.Address
+		resolved = append(resolved, *res)
+		return nil
+	})
+	if errors.Is(err, errNameUnresolved) {
+		return nil, failed, nil
+	}
+	return resolved, "", err
+}
+
+// errNameUnresolved stops the configuration walk at the first unresolvable name.
+var errNameUnresolved = errors.New("name unresolved")
+
+// describeResolvedNames renders resolved names with their full addresses so the user can verify them.
+func describeResolvedNames(resolved []names.Resolution) string {
+	if len(resolved) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("\n\nResolved names — please verify:")
+	for _, r := range resolved {
+		sb.WriteString(fmt.Sprintf("\n- %s → %s", r.Name, r.Address))
+	}
+	return sb.String()
+}
+
+// nameClarificationResponse stores and returns a message asking the user to check a name
+// that could not be resolved, instead of building a policy with it.
+func (s *AgentService) nameClarificationResponse(ctx context.Context, convID uuid.UUID, name string) (*SendMessageResponse, error) {
+	metadata, _ := json.Marshal(map[string]any{
+		"type": "name_unresolved",
+		"name": name,
+	})
+	msg := &types.Message{
+		ConversationID: convID,
+		Role:           types.RoleAssistant,
+		Content:        fmt.Sprintf("I couldn't resolve **%s** to an address, so I didn't build the policy. Please double-check the name or paste the address directly.", name),
+		ContentType:    "text",
+		Metadata:       metadata,
+	}
+	if err := s.storeAssistantMessage(ctx, msg, nil); err != nil {
+		return nil, fmt.Errorf("store clarification message: %w", err)
+	}
+	return &SendMessageResponse{Message: *msg}, nil
+}
+
+// describeNameError turns a resolution failure into a tool result the model can relay.
+func describeNameError(name string, err error) string {
+	if errors.Is(err, names.ErrNotFound) {
+		return fmt.Sprintf("%s is not registered", name)
+	}
+	return fmt.Sprintf("could not resolve %s right now", name)
+}
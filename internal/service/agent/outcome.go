@@ -0,0 +1,249 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+// Response outcomes, classifying how a model response ended.
+const (
+	// OutcomeToolOK is a response that called a tool
+	OutcomeToolOK = "tool_ok"
+	// OutcomeTextFallback is a response with text but no tool call
+	OutcomeTextFallback = "text_fallback"
+	// OutcomeEmpty is a response with neither text nor a tool call
+	OutcomeEmpty = "empty"
+	// OutcomeTruncated is a response cut at max_tokens or a stop sequence
+	OutcomeTruncated = "truncated"
+	// OutcomeRefusal is a response the model declined to generate
+	OutcomeRefusal = "refusal"
+)
+
+// Abilities whose responses are classified.
+const (
+	abilityIntent  = "intent"
+	abilityPolicy  = "policy"
+	abilityConfirm = "confirm"
+)
+
+// errEmptyResponse is returned when the model answered with neither text nor a tool call,
+// even after the nudged retry.
+var errEmptyResponse = errors.New("no response content from Claude")
+
+// emptyResponseNudge is appended to the system prompt when a response comes back empty.
+const emptyResponseNudge = "\n\nYour previous reply was empty. Respond now by calling the required tool; do not return an empty message."
+
+// outcomeStatsRetention is how long daily outcome counts are kept.
+const outcomeStatsRetention = 30 * 24 * time.Hour
+
+// MaxOutcomeStatsDays caps how many days ResponseOutcomeStats reports.
+const MaxOutcomeStatsDays = 30
+
+// outcomeStatsKey is the Redis hash holding a day's outcome counts, one field per
+// ability, model and outcome.
+func outcomeStatsKey(day time.Time) string {
+	return "stats:outcomes:" + day.UTC().Format(time.DateOnly)
+}
+
+// classifyResponse returns the outcome of a model response. Refusals and truncations are
+// reported even when a tool was called, since a cut-off tool call has incomplete input.
+func classifyResponse(resp *anthropic.Response) string {
+	switch resp.StopReason {
+	case "refusal":
+		return OutcomeRefusal
+	case "max_tokens", "stop_sequence":
+		return OutcomeTruncated
+	}
+	if hasAnyToolUse(resp) {
+		return OutcomeToolOK
+	}
+	for _, block := range resp.Content {
+		if block.Type == "text" && strings.TrimSpace(block.Text) != "" {
+			return OutcomeTextFallback
+		}
+	}
+	return OutcomeEmpty
+}
+
+// generate sends req and classifies the response for ability. An empty response is retried
+// once with a nudge appended to the system prompt; if that is empty too errEmptyResponse is
+// returned.
+func (s *AgentService) generate(ctx context.Context, ability string, req *anthropic.Request) (*anthropic.Response, error) {
+	resp, err := s.send(ctx, purposeReply, req)
+	if err != nil {
+		return nil, err
+	}
+	outcome := s.recordOutcome(ctx, ability, req, resp, false)
+	if outcome != OutcomeEmpty {
+		return resp, nil
+	}
+
+	retry := *req
+	retry.System += emptyResponseNudge
+	resp, err = s.send(ctx, purposeReply, &retry)
+	if err != nil {
+		return nil, err
+	}
+	if s.recordOutcome(ctx, ability, &retry, resp, true) == OutcomeEmpty {
+		return nil, errEmptyResponse
+	}
+	return resp, nil
+}
+
+// recordOutcome classifies resp, counts it in metrics and the daily stats, and notes it as
+// the request's generation. Failing to count the daily stats is logged, not returned.
+func (s *AgentService) recordOutcome(ctx context.Context, ability string, req *anthropic.Request, resp *anthropic.Response, retried bool) string {
+	outcome := classifyResponse(resp)
+	model := resp.Model
+	if model == "" {
+		model = req.Model
+	}
+
+	metrics.ResponseOutcomes.WithLabelValues(ability, model, outcome).Inc()
+	// The request is copied so later tool rounds appending to its messages don't change it
+	sent := *req
+	setGeneration(ctx, &generationInfo{
+		Ability:       ability,
+		Model:         model,
+		Outcome:       outcome,
+		StopReason:    resp.StopReason,
+		Retried:       retried,
+		PromptVersion: promptVersions[ability],
+		SystemHash:    promptHash(req.System),
+		request:       &sent,
+		response:      resp,
+	})
+
+	if outcome != OutcomeToolOK {
+		fields := logrus.Fields{
+			"ability":     ability,
+			"model":       model,
+			"outcome":     outcome,
+			"stop_reason": resp.StopReason,
+			"retried":     retried,
+		}
+		if resp.StopSequence != nil {
+			fields["stop_sequence"] = *resp.StopSequence
+		}
+		s.logger.WithFields(fields).Warn("model response without a tool call")
+	}
+
+	field := strings.Join([]string{ability, model, outcome}, "|")
+	if _, err := s.redis.HIncr(ctx, outcomeStatsKey(time.Now()), field, outcomeStatsRetention); err != nil {
+		s.logger.WithError(err).Warn("failed to count response outcome")
+	}
+	return outcome
+}
+
+// generationKey is the context key for the generation noted while handling a message.
+type generationKey struct{}
+
+// generationInfo describes the model response a reply was built from, stored in the
+// reply's metadata under "generation".
+type generationInfo struct {
+	Ability    string `json:"ability"`
+	Model      string `json:"model"`
+	Outcome    string `json:"outcome"`
+	StopReason string `json:"stop_reason,omitempty"`
+	// Retried is set when the response is the retry of an empty one
+	Retried bool `json:"retried,omitempty"`
+	// PromptVersion identifies the ability's prompt template, SystemHash the exact system
+	// prompt sent, so a debug bundle can tell whether the prompt has changed since
+	PromptVersion string `json:"prompt_version,omitempty"`
+	SystemHash    string `json:"system_hash,omitempty"`
+
+	// request and response are kept for the debug snapshot, not stored in metadata
+	request  *anthropic.Request
+	response *anthropic.Response
+}
+
+// withGeneration returns a context that notes the last classified generation, so the reply
+// stored for the message can carry it.
+func withGeneration(ctx context.Context) context.Context {
+	return context.WithValue(ctx, generationKey{}, new(generationInfo))
+}
+
+// setGeneration notes info as the context's latest generation.
+func setGeneration(ctx context.Context, info *generationInfo) {
+	if slot, ok := ctx.Value(generationKey{}).(*generationInfo); ok {
+		*slot = *info
+	}
+}
+
+// annotateGeneration adds the context's latest generation to message metadata. Metadata is
+// returned unchanged when no response was classified.
+func annotateGeneration(ctx context.Context, metadata json.RawMessage) json.RawMessage {
+	info, ok := ctx.Value(generationKey{}).(*generationInfo)
+	if !ok || info.Outcome == "" {
+		return metadata
+	}
+	meta := map[string]any{}
+	if len(metadata) > 0 {
+		_ = json.Unmarshal(metadata, &meta)
+	}
+	meta["generation"] = info
+	data, _ := json.Marshal(meta)
+	return data
+}
+
+// ResponseOutcomeCount is how many responses of one ability and model ended with an outcome.
+type ResponseOutcomeCount struct {
+	Ability string `json:"ability"`
+	Model   string `json:"model"`
+	Outcome string `json:"outcome"`
+	Count   int64  `json:"count"`
+}
+
+// ResponseOutcomeDay is a day's response outcome counts (UTC).
+type ResponseOutcomeDay struct {
+	Date     string                 `json:"date"`
+	Outcomes []ResponseOutcomeCount `json:"outcomes"`
+}
+
+// ResponseOutcomeStats returns response outcome counts for the last days days, newest first.
+// days is clamped to 1..MaxOutcomeStatsDays.
+func (s *AgentService) ResponseOutcomeStats(ctx context.Context, days int) ([]ResponseOutcomeDay, error) {
+	days = max(1, min(days, MaxOutcomeStatsDays))
+
+	now := time.Now()
+	stats := make([]ResponseOutcomeDay, 0, days)
+	for i := range days {
+		day := now.AddDate(0, 0, -i)
+		fields, err := s.redis.HGetAll(ctx, outcomeStatsKey(day))
+		if err != nil {
+			return nil, fmt.Errorf("get response outcomes: %w", err)
+		}
+
+		counts := make([]ResponseOutcomeCount, 0, len(fields))
+		for field, value := range fields {
+			parts := strings.SplitN(field, "|", 3)
+			n, err := strconv.ParseInt(value, 10, 64)
+			if len(parts) != 3 || err != nil {
+				continue
+			}
+			counts = append(counts, ResponseOutcomeCount{Ability: parts[0], Model: parts[1], Outcome: parts[2], Count: n})
+		}
+		sort.Slice(counts, func(a, b int) bool {
+			if counts[a].Ability != counts[b].Ability {
+				return counts[a].Ability < counts[b].Ability
+			}
+			if counts[a].Model != counts[b].Model {
+				return counts[a].Model < counts[b].Model
+			}
+			return counts[a].Outcome < counts[b].Outcome
+		})
+		stats = append(stats, ResponseOutcomeDay{Date: day.UTC().Format(time.DateOnly), Outcomes: counts})
+	}
+	return stats, nil
+}
@@ -0,0 +1,202 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+// withStop returns resp with its stop reason set to reason.
+func withStop(resp *anthropic.Response, reason string) *anthropic.Response {
+	resp.StopReason = reason
+	return resp
+}
+
+func textReply(text string) *anthropic.Response {
+	return &anthropic.Response{StopReason: "end_turn", Content: []anthropic.ContentBlock{{Type: "text", Text: text}}}
+}
+
+func emptyReply() *anthropic.Response {
+	return &anthropic.Response{StopReason: "end_turn", Content: []anthropic.ContentBlock{{Type: "text", Text: "  "}}}
+}
+
+func TestClassifyResponse(t *testing.T) {
+	tool := func() *anthropic.Response { return toolReply(RespondToUserTool.Name, map[string]any{"response": "hi"}) }
+	stop := "###"
+
+	tests := []struct {
+		name string
+		resp *anthropic.Response
+		want string
+	}{
+		{name: "tool call", resp: tool(), want: OutcomeToolOK},
+		{name: "text only", resp: textReply("Hello there."), want: OutcomeTextFallback},
+		{name: "blank text", resp: emptyReply(), want: OutcomeEmpty},
+		{name: "no content", resp: &anthropic.Response{StopReason: "end_turn"}, want: OutcomeEmpty},
+		{name: "max tokens", resp: withStop(textReply("Hello th"), "max_tokens"), want: OutcomeTruncated},
+		{name: "cut-off tool call", resp: withStop(tool(), "max_tokens"), want: OutcomeTruncated},
+		{name: "stop sequence", resp: &anthropic.Response{StopReason: "stop_sequence", StopSequence: &stop}, want: OutcomeTruncated},
+		{name: "refusal", resp: &anthropic.Response{StopReason: "refusal"}, want: OutcomeRefusal},
+		{name: "refusal with a tool call", resp: withStop(tool(), "refusal"), want: OutcomeRefusal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyResponse(tt.resp); got != tt.want {
+				t.Errorf("classifyResponse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateOutcomes(t *testing.T) {
+	tool := toolReply(RespondToUserTool.Name, map[string]any{"response": "hi"})
+
+	tests := []struct {
+		name        string
+		replies     []*anthropic.Response
+		wantErr     error
+		wantOutcome string
+		wantRetried bool
+		wantCounts  map[string]int64
+	}{
+		{
+			name:        "tool ok",
+			replies:     []*anthropic.Response{tool},
+			wantOutcome: OutcomeToolOK,
+			wantCounts:  map[string]int64{OutcomeToolOK: 1},
+		},
+		{
+			name:        "text fallback",
+			replies:     []*anthropic.Response{textReply("Hello there.")},
+			wantOutcome: OutcomeTextFallback,
+			wantCounts:  map[string]int64{OutcomeTextFallback: 1},
+		},
+		{
+			name:        "truncated",
+			replies:     []*anthropic.Response{withStop(textReply("Hello th"), "max_tokens")},
+			wantOutcome: OutcomeTruncated,
+			wantCounts:  map[string]int64{OutcomeTruncated: 1},
+		},
+		{
+			name:        "refusal",
+			replies:     []*anthropic.Response{{StopReason: "refusal"}},
+			wantOutcome: OutcomeRefusal,
+			wantCounts:  map[string]int64{OutcomeRefusal: 1},
+		},
+		{
+			name:        "empty then answered",
+			replies:     []*anthropic.Response{emptyReply(), tool},
+			wantOutcome: OutcomeToolOK,
+			wantRetried: true,
+			wantCounts:  map[string]int64{OutcomeEmpty: 1, OutcomeToolOK: 1},
+		},
+		{
+			name:        "empty twice",
+			replies:     []*anthropic.Response{emptyReply(), emptyReply()},
+			wantErr:     errEmptyResponse,
+			wantOutcome: OutcomeEmpty,
+			wantRetried: true,
+			wantCounts:  map[string]int64{OutcomeEmpty: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &fakeModel{replies: tt.replies}
+			svc, _ := newConversationService(model)
+			ctx := withGeneration(context.Background())
+			// Each case uses its own model name so the shared counters start at zero
+			modelName := "test-" + strings.ReplaceAll(tt.name, " ", "-")
+			req := &anthropic.Request{Model: modelName, System: "system prompt"}
+
+			_, err := svc.generate(ctx, abilityIntent, req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("generate() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if len(model.requests) != len(tt.replies) {
+				t.Fatalf("model got %d requests, want %d", len(model.requests), len(tt.replies))
+			}
+			if tt.wantRetried {
+				if retry := model.requests[1].System; retry != req.System+emptyResponseNudge {
+					t.Errorf("retry system prompt = %q, want the nudge appended", retry)
+				}
+				if model.requests[0].System != req.System {
+					t.Errorf("first system prompt = %q, want it unchanged", model.requests[0].System)
+				}
+			}
+
+			var meta struct {
+				Generation generationInfo `json:"generation"`
+			}
+			if err := json.Unmarshal(annotateGeneration(ctx, nil), &meta); err != nil {
+				t.Fatalf("decode metadata: %v", err)
+			}
+			if g := meta.Generation; g.Outcome != tt.wantOutcome || g.Retried != tt.wantRetried || g.Ability != abilityIntent || g.Model != modelName {
+				t.Errorf("generation = %+v, want outcome %s, retried %v", g, tt.wantOutcome, tt.wantRetried)
+			}
+
+			for _, outcome := range []string{OutcomeToolOK, OutcomeTextFallback, OutcomeEmpty, OutcomeTruncated, OutcomeRefusal} {
+				if got := testutil.ToFloat64(metrics.ResponseOutcomes.WithLabelValues(abilityIntent, modelName, outcome)); int64(got) != tt.wantCounts[outcome] {
+					t.Errorf("%s responses counted = %v, want %d", outcome, got, tt.wantCounts[outcome])
+				}
+			}
+
+			stats, err := svc.ResponseOutcomeStats(ctx, 1)
+			if err != nil {
+				t.Fatalf("ResponseOutcomeStats() error = %v", err)
+			}
+			got := map[string]int64{}
+			for _, c := range stats[0].Outcomes {
+				if c.Ability == abilityIntent && c.Model == modelName {
+					got[c.Outcome] = c.Count
+				}
+			}
+			if !reflect.DeepEqual(got, tt.wantCounts) {
+				t.Errorf("outcome stats = %v, want %v", got, tt.wantCounts)
+			}
+		})
+	}
+}
+
+func TestProcessMessageEmptyResponseRetried(t *testing.T) {
+	model := &fakeModel{replies: []*anthropic.Response{
+		emptyReply(),
+		toolReply(RespondToUserTool.Name, map[string]any{
+			"intent":   "general_question",
+			"response": "Vultisig is a multi-chain wallet.",
+		}),
+	}}
+	svc, msgs := newConversationService(model)
+
+	resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "what is vultisig?",
+	})
+	if err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+	if resp.Message.Content != "Vultisig is a multi-chain wallet." {
+		t.Errorf("reply = %q, want the retried answer", resp.Message.Content)
+	}
+
+	stored := msgs.stored()
+	var meta struct {
+		Generation generationInfo `json:"generation"`
+	}
+	if err := json.Unmarshal(stored[len(stored)-1].Metadata, &meta); err != nil {
+		t.Fatalf("decode reply metadata: %v", err)
+	}
+	if g := meta.Generation; g.Outcome != OutcomeToolOK || !g.Retried || g.Ability != abilityIntent {
+		t.Errorf("stored generation = %+v, want a retried tool_ok intent response", g)
+	}
+}
@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// PendingPolicy is a built policy the user hasn't confirmed or declined yet, re-surfaced when
+// the conversation is reloaded so it survives the app being closed.
+type PendingPolicy struct {
+	// MessageID is the assistant message the policy was built in
+	MessageID uuid.UUID `json:"message_id"`
+	PolicyReady
+}
+
+// FindPendingPolicy returns the most recent policy_ready in messages if no action result was
+// reported after it. Deleted messages don't count, and policies whose stored configuration
+// was compacted can't be confirmed from it, so they aren't re-surfaced.
+func FindPendingPolicy(messages []types.Message) *PendingPolicy {
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.DeletedAt != nil {
+			continue
+		}
+		if msg.Role == types.RoleUser && msg.ContentType == "action_result" {
+			return nil
+		}
+		if msg.Role != types.RoleAssistant || len(msg.Metadata) == 0 {
+			continue
+		}
+
+		var meta PolicyReadyMetadata
+		if err := json.Unmarshal(msg.Metadata, &meta); err != nil || meta.Type != "policy_ready" {
+			continue
+		}
+		if meta.ConfigurationCompacted || meta.PolicySuggest == nil {
+			return nil
+		}
+		return &PendingPolicy{
+			MessageID: msg.ID,
+			PolicyReady: PolicyReady{
+				DraftID:            meta.DraftID,
+				PluginID:           meta.PluginID,
+				Configuration:      meta.Configuration,
+				PolicySuggest:      meta.PolicySuggest,
+				PermissionsSummary: meta.PermissionsSummary,
+			},
+		}
+	}
+	return nil
+}
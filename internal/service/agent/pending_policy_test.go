@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// policyReadyMessage returns an assistant message carrying policy_ready metadata for pluginID.
+func policyReadyMessage(pluginID string, compacted bool) types.Message {
+	meta, _ := json.Marshal(PolicyReadyMetadata{
+		Type:                   "policy_ready",
+		Action:                 "create_policy",
+		PluginID:               pluginID,
+		PolicySuggest:          &verifier.PolicySuggest{},
+		Configuration:          map[string]any{"asset": "ETH"},
+		PermissionsSummary:     []string{"Swap up to 100 USDC a week"},
+		ConfigurationCompacted: compacted,
+	})
+	return types.Message{ID: uuid.New(), Role: types.RoleAssistant, Content: "Here is your policy.", ContentType: "text", Metadata: meta}
+}
+
+func TestFindPendingPolicy(t *testing.T) {
+	user := types.Message{ID: uuid.New(), Role: types.RoleUser, Content: "buy ETH weekly", ContentType: "text"}
+	reply := types.Message{ID: uuid.New(), Role: types.RoleAssistant, Content: "Sure.", ContentType: "text"}
+	actionResult := types.Message{ID: uuid.New(), Role: types.RoleUser, ContentType: "action_result"}
+	older := policyReadyMessage("vultisig-payroll-0000", false)
+	latest := policyReadyMessage(testPluginID, false)
+	deleted := policyReadyMessage("vultisig-recurring-sends-0000", false)
+	deleted.DeletedAt = ptr(time.Now())
+
+	tests := []struct {
+		name     string
+		messages []types.Message
+		// want is the message the pending policy was built in, or nil
+		want *types.Message
+	}{
+		{name: "no policy", messages: []types.Message{user, reply}},
+		{name: "unconfirmed policy", messages: []types.Message{user, latest}, want: &latest},
+		{name: "chatting after the policy", messages: []types.Message{user, latest, user, reply}, want: &latest},
+		{name: "latest of several", messages: []types.Message{older, user, latest}, want: &latest},
+		{name: "confirmed", messages: []types.Message{user, latest, actionResult}},
+		{name: "built again after confirming", messages: []types.Message{older, actionResult, latest}, want: &latest},
+		{name: "deleted policy skipped", messages: []types.Message{latest, deleted}, want: &latest},
+		{name: "compacted configuration", messages: []types.Message{user, policyReadyMessage(testPluginID, true)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindPendingPolicy(tt.messages)
+			if tt.want == nil {
+				if got != nil {
+					t.Errorf("FindPendingPolicy() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("FindPendingPolicy() = nil, want the unconfirmed policy")
+			}
+			if got.MessageID != tt.want.ID || got.PluginID != testPluginID {
+				t.Errorf("pending policy from message %s for %s, want message %s for %s", got.MessageID, got.PluginID, tt.want.ID, testPluginID)
+			}
+			if got.Configuration["asset"] != "ETH" || got.PolicySuggest == nil || len(got.PermissionsSummary) != 1 {
+				t.Errorf("pending policy = %+v, want the stored configuration, suggest and permissions", got.PolicyReady)
+			}
+		})
+	}
+}
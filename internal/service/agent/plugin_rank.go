@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// rankStopWords are common words that say nothing about which plugin fits.
+var rankStopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "you": true, "your": true,
+	"can": true, "want": true, "would": true, "like": true, "please": true, "from": true,
+	"into": true, "this": true, "that": true, "what": true, "how": true, "are": true,
+	"every": true, "all": true, "use": true, "plugin": true, "plugins": true,
+}
+
+// rankPlugins returns at most limit plugins, preferring those whose name and skills share
+// words with the query or mention chains the user holds, and how many were left out.
+// Selected plugins keep their original order so the same selection renders the same prompt.
+func rankPlugins(plugins []PluginSkill, query string, chains []string, limit int) ([]PluginSkill, int) {
+	if len(plugins) <= limit {
+		return plugins, 0
+	}
+
+	queryWords := rankWords(query)
+	scores := make([]int, len(plugins))
+	for i, p := range plugins {
+		nameWords := rankWords(p.Name + " " + p.PluginID)
+		skillWords := rankWords(p.Skills)
+		for w := range queryWords {
+			switch {
+			case nameWords[w]:
+				scores[i] += 3
+			case skillWords[w]:
+				scores[i]++
+			}
+		}
+		for _, chain := range chains {
+			if chain = normalizeChain(chain); chain != "" && (nameWords[chain] || skillWords[chain]) {
+				scores[i]++
+			}
+		}
+	}
+
+	order := make([]int, len(plugins))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return scores[order[a]] > scores[order[b]]
+	})
+	selected := order[:limit]
+	sort.Ints(selected)
+
+	ranked := make([]PluginSkill, 0, limit)
+	for _, i := range selected {
+		ranked = append(ranked, plugins[i])
+	}
+	return ranked, len(plugins) - limit
+}
+
+// rankWords splits text into lowercase words of at least three letters or digits, without
+// stop words.
+func rankWords(text string) map[string]bool {
+	words := make(map[string]bool)
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(w) >= 3 && !rankStopWords[w] {
+			words[w] = true
+		}
+	}
+	return words
+}
+
+// pluginQuery is the text plugins are ranked against: the new message plus the previous
+// user message, so short follow-ups ("make it weekly") keep the plugin in view.
+func pluginQuery(content string, window *conversationWindow) string {
+	for i := len(window.messages) - 1; i >= 0; i-- {
+		msg := window.messages[i]
+		if msg.Role == types.RoleUser && msg.ContentType == "text" {
+			return msg.Content + " " + content
+		}
+	}
+	return content
+}
+
+// balanceChains returns the distinct chains the user holds balances on.
+func balanceChains(balances []Balance) []string {
+	seen := make(map[string]bool)
+	var chains []string
+	for _, b := range balances {
+		if chain := normalizeChain(b.Chain); chain != "" && !seen[chain] {
+			seen[chain] = true
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func pluginIDs(plugins []PluginSkill) []string {
+	ids := make([]string, len(plugins))
+	for i, p := range plugins {
+		ids[i] = p.PluginID
+	}
+	return ids
+}
+
+func TestRankPlugins(t *testing.T) {
+	// 30 interchangeable plugins around the ones a query should pick out
+	plugins := testPlugins(30, "v1")
+	plugins[7] = PluginSkill{PluginID: "vultisig-payroll-0000", Name: "Payroll", Skills: "Pays a team of recipients on a schedule."}
+	plugins[21] = PluginSkill{PluginID: "vultisig-solana-staking", Name: "Staking", Skills: "Stakes SOL with a validator on solana."}
+
+	tests := []struct {
+		name        string
+		query       string
+		chains      []string
+		limit       int
+		wantIDs     []string
+		wantOmitted int
+	}{
+		{
+			name:        "name match",
+			query:       "I need to set up payroll for my team",
+			limit:       1,
+			wantIDs:     []string{"vultisig-payroll-0000"},
+			wantOmitted: 29,
+		},
+		{
+			name:        "held chain",
+			query:       "what can I automate?",
+			chains:      []string{"Solana"},
+			limit:       1,
+			wantIDs:     []string{"vultisig-solana-staking"},
+			wantOmitted: 29,
+		},
+		{
+			// Selected plugins keep the provider's order, so the prompt is stable
+			name:        "several matches in original order",
+			query:       "stake my sol and run payroll",
+			limit:       2,
+			wantIDs:     []string{"vultisig-payroll-0000", "vultisig-solana-staking"},
+			wantOmitted: 28,
+		},
+		{
+			name:        "no match keeps the first plugins",
+			query:       "hello",
+			limit:       3,
+			wantIDs:     []string{"plugin-0", "plugin-1", "plugin-2"},
+			wantOmitted: 27,
+		},
+		{
+			name:    "under the limit",
+			query:   "payroll",
+			limit:   30,
+			wantIDs: pluginIDs(plugins),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranked, omitted := rankPlugins(plugins, tt.query, tt.chains, tt.limit)
+			if got := strings.Join(pluginIDs(ranked), ","); got != strings.Join(tt.wantIDs, ",") || omitted != tt.wantOmitted {
+				t.Errorf("rankPlugins() = %s with %d omitted, want %s with %d", got, omitted, strings.Join(tt.wantIDs, ","), tt.wantOmitted)
+			}
+		})
+	}
+}
+
+func TestPluginQuery(t *testing.T) {
+	window := &conversationWindow{messages: []types.Message{
+		{Role: types.RoleUser, ContentType: "text", Content: "set up payroll"},
+		{Role: types.RoleAssistant, ContentType: "text", Content: "For how many people?"},
+		{Role: types.RoleUser, ContentType: "action_result", Content: "{}"},
+	}}
+	if got, want := pluginQuery("make it monthly", window), "set up payroll make it monthly"; got != want {
+		t.Errorf("pluginQuery() = %q, want %q", got, want)
+	}
+	if got := pluginQuery("make it monthly", &conversationWindow{}); got != "make it monthly" {
+		t.Errorf("pluginQuery() of a new conversation = %q, want the message alone", got)
+	}
+}
+
+func TestProcessMessagePromptPlugins(t *testing.T) {
+	plugins := testPlugins(40, "v1")
+	plugins[33] = PluginSkill{PluginID: "vultisig-payroll-0000", Name: "Payroll", Skills: "Pays a team of recipients on a schedule."}
+
+	model := &fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "general_question",
+		"response": "The payroll plugin can pay your team monthly.",
+	})}
+	svc, _ := newConversationService(model)
+	svc.pluginProvider = &fakeSkillsProvider{skills: plugins}
+	svc.maxPromptPlugins = 5
+
+	if _, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "can you run payroll for my team?",
+	}); err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+
+	system := model.requests[0].System
+	if !strings.Contains(system, "### Payroll (vultisig-payroll-0000)") {
+		t.Error("system prompt lacks the plugin matching the message")
+	}
+	if n := strings.Count(system, " (plugin-"); n != 4 {
+		t.Errorf("system prompt lists %d other plugins, want 4", n)
+	}
+	if !strings.Contains(system, "35 more plugins are available") {
+		t.Error("system prompt doesn't say more plugins are available")
+	}
+}
@@ -6,11 +6,17 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
 
 	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/service/names"
+	"github.com/vultisig/agent-backend/internal/service/outbox"
 	"github.com/vultisig/agent-backend/internal/service/verifier"
 	"github.com/vultisig/agent-backend/internal/types"
 )
@@ -23,11 +29,21 @@ type PolicyResponse struct {
 
 // PolicyReadyMetadata is the metadata for a policy-ready message.
 type PolicyReadyMetadata struct {
-	Type          string                  `json:"type"`   // "policy_ready"
-	Action        string                  `json:"action"` // "create_policy"
-	PluginID      string                  `json:"plugin_id"`
-	PolicySuggest *verifier.PolicySuggest `json:"policy_suggest"`
-	Configuration map[string]any          `json:"configuration"`
+	Type               string                  `json:"type"`   // "policy_ready"
+	Action             string                  `json:"action"` // "create_policy"
+	DraftID            *uuid.UUID              `json:"draft_id,omitempty"`
+	PluginID           string                  `json:"plugin_id"`
+	PolicySuggest      *verifier.PolicySuggest `json:"policy_suggest"`
+	Configuration      map[string]any          `json:"configuration"`
+	Blocks             []types.Block           `json:"blocks,omitempty"`
+	PermissionsSummary []string                `json:"permissions_summary,omitempty"`
+	ResolvedNames      []names.Resolution      `json:"resolved_names,omitempty"`
+	Truncated          bool                    `json:"truncated,omitempty"`
+	// InstallUnverified is set when the plugin's installation couldn't be checked
+	InstallUnverified bool `json:"install_unverified,omitempty"`
+	// ConfigurationCompacted is set when oversized configuration values were cut to keep
+	// the stored message small; the full configuration was only returned in PolicyReady
+	ConfigurationCompacted bool `json:"configuration_compacted,omitempty"`
 }
 
 // buildPolicy handles Ability 2: build policy from selected suggestion.
@@ -37,14 +53,13 @@ func (s *AgentService) buildPolicy(ctx context.Context, convID uuid.UUID, req *S
 	}
 
 	// 1. Look up suggestion from Redis
-	suggJSON, err := s.redis.Get(ctx, *req.SelectedSuggestionID)
+	suggestion, err := s.getSuggestion(ctx, *req.SelectedSuggestionID)
 	if err != nil {
-		return nil, fmt.Errorf("suggestion not found or expired: %w", err)
+		return nil, err
 	}
-
-	var suggestion Suggestion
-	if err := json.Unmarshal([]byte(suggJSON), &suggestion); err != nil {
-		return nil, fmt.Errorf("unmarshal suggestion: %w", err)
+	// Legacy suggestions carry no conversation and are accepted anywhere
+	if suggestion.ConversationID != "" && suggestion.ConversationID != convID.String() {
+		return nil, &SuggestionConversationError{SuggestionID: suggestion.ID, ConversationID: suggestion.ConversationID}
 	}
 
 	// 2. Check if verifier client is available
@@ -52,33 +67,75 @@ func (s *AgentService) buildPolicy(ctx context.Context, convID uuid.UUID, req *S
 		return nil, errors.New("verifier client not configured")
 	}
 
-	// 3. Check if plugin is installed
-	if req.AccessToken != "" {
-		installed, err := s.verifier.IsPluginInstalled(ctx, req.AccessToken, suggestion.PluginID)
-		if err != nil {
-			s.logger.WithError(err).Warn("failed to check plugin installation")
+	// 3. Check installation and fetch the plugin's RecipeSchema concurrently; the schema is
+	// needed on every path that builds, so fetching it alongside the check saves a round-trip.
+	// The plugin may have been uninstalled since it was suggested, so with an access token
+	// installation is always checked again.
+	checkInstall := req.AccessToken != ""
+	var (
+		installed   bool
+		installErr  error
+		schema      *verifier.RecipeSchema
+		schemaErr   error
+		verifierOps errgroup.Group
+	)
+	reportProgress(ctx, ProgressVerifier)
+	if checkInstall {
+		verifierOps.Go(func() error {
+			var ids []string
+			ids, installErr = s.verifier.InstalledPluginIDs(ctx, req.AccessToken)
+			if installErr == nil {
+				installed = slices.Contains(ids, suggestion.PluginID)
+				s.cacheInstalledPlugins(ctx, req.PublicKey, ids)
+			}
+			return nil
+		})
+	}
+	verifierOps.Go(func() error {
+		schema, schemaErr = s.verifier.GetRecipeSchema(ctx, suggestion.PluginID)
+		return nil
+	})
+	_ = verifierOps.Wait()
+
+	// installUnverified is set when the build goes ahead without knowing the plugin is installed
+	var installUnverified bool
+	if checkInstall {
+		switch {
+		case errors.Is(installErr, verifier.ErrUnauthorized):
+			// The app has to re-authenticate; building without a valid token can't be installed
+			return nil, installErr
+		case errors.Is(installErr, verifier.ErrPluginNotFound):
+			return s.pluginUnavailableResponse(ctx, convID, suggestion)
+		case installErr != nil:
+			s.logger.WithError(installErr).Warn("failed to check plugin installation")
 			// Continue anyway - verifier might be unavailable
-		} else if !installed {
+			installUnverified = true
+		case !installed:
 			// Plugin not installed - return install_required response
 			return s.handleInstallRequired(ctx, convID, suggestion)
 		}
+	} else if !justInstalled(req) {
+		// Without a token only recently seen installed plugins are known
+		switch cached := s.cachedInstalledPlugins(ctx, req.PublicKey); {
+		case cached == nil:
+			installUnverified = true
+		case !slices.Contains(cached.PluginIDs, suggestion.PluginID):
+			return s.handleInstallRequired(ctx, convID, suggestion)
+		}
 	}
 
-	// 4. Fetch plugin's RecipeSchema from verifier
-	schema, err := s.verifier.GetRecipeSchema(ctx, suggestion.PluginID)
-	if err != nil {
-		return nil, fmt.Errorf("get recipe schema: %w", err)
+	// 4. Use the plugin's RecipeSchema
+	if errors.Is(schemaErr, verifier.ErrPluginNotFound) {
+		return s.pluginUnavailableResponse(ctx, convID, suggestion)
+	}
+	if schemaErr != nil {
+		return nil, fmt.Errorf("get recipe schema: %w", schemaErr)
 	}
 
 	// Extract configuration schema and examples for Claude
-	configSchemaJSON, err := json.MarshalIndent(schema.Configuration, "", "  ")
+	configSchemaJSON, examplesJSON, err := recipeSchemaJSON(schema)
 	if err != nil {
-		return nil, fmt.Errorf("marshal config schema: %w", err)
-	}
-
-	var examplesJSON []byte
-	if len(schema.ConfigurationExample) > 0 {
-		examplesJSON, _ = json.MarshalIndent(schema.ConfigurationExample, "", "  ")
+		return nil, err
 	}
 
 	// 5. Build system prompt for policy builder
@@ -89,59 +146,138 @@ func (s *AgentService) buildPolicy(ctx context.Context, convID uuid.UUID, req *S
 		addresses = req.Context.Addresses
 	}
 
-	basePrompt := BuildPolicyBuilderPrompt(suggestion, string(configSchemaJSON), string(examplesJSON), balances, addresses)
-	basePrompt += s.loadMemorySection(ctx, req.PublicKey)
+	// Prompt gets a bounded, normalized view; the full list is kept for amount conversion
+	contacts := s.loadContacts(ctx, req.PublicKey)
+	basePrompt := BuildPolicyBuilderPrompt(suggestion, configSchemaJSON, examplesJSON, s.promptBalances(balances), addresses, contacts)
+	basePrompt += s.loadMemorySection(ctx, req.PublicKey, window)
+	// After a likely injection attempt, recipients may only come from app-provided data
+	injection := s.checkInjection(convID, window, "", "policy")
+	if len(injection) > 0 {
+		basePrompt += InjectionGuardInstructions
+	}
 	systemPrompt := BuildSystemPromptWithSummary(basePrompt, window.summary)
 
 	// 6. Build messages for Anthropic
-	messages := anthropicMessagesFromWindow(window)
+	messages := endWithUserTurn(anthropicMessagesFromWindow(window))
 
-	// 7. Call Anthropic with build_policy tool (forced)
+	// 7. Call Anthropic with build_policy tool (forced). With contacts, the model may first
+	// call resolve_contact; lookups are answered server-side until build_policy is called.
 	anthropicReq := &anthropic.Request{
-		System:   systemPrompt,
-		Messages: messages,
-		Tools:    []anthropic.Tool{BuildPolicyTool},
+		MaxTokens: s.abilityMaxTokens[abilityPolicy],
+		System:    systemPrompt,
+		Messages:  messages,
+		Tools:     []anthropic.Tool{BuildPolicyTool},
 		ToolChoice: &anthropic.ToolChoice{
 			Type: "tool",
 			Name: "build_policy",
 		},
 	}
+	handlers := map[string]toolHandler{}
+	if len(contacts) > 0 {
+		anthropicReq.Tools = append(anthropicReq.Tools, ResolveContactTool)
+		anthropicReq.ToolChoice = &anthropic.ToolChoice{Type: "any"}
+		handlers[ResolveContactTool.Name] = contactTool(contacts)
+	}
 
-	resp, err := s.anthropic.SendMessage(ctx, anthropicReq)
+	resp, err := s.runTools(ctx, abilityPolicy, anthropicReq, BuildPolicyTool.Name, handlers, maxContactLookups)
 	if err != nil {
 		return nil, fmt.Errorf("call anthropic: %w", err)
 	}
 
 	// 9. Parse tool response
-	policyResp, err := parsePolicyResponse(resp)
+	policyResp, err := s.parsePolicyResponse(ctx, resp)
 	if err != nil {
 		return nil, fmt.Errorf("parse policy response: %w", err)
 	}
 
+	// ENS/SNS names are resolved deterministically; an unresolvable name asks the user instead of building
+	resolvedNames, unresolved, err := s.resolveConfigurationNames(ctx, policyResp.Configuration)
+	if err != nil {
+		return nil, fmt.Errorf("resolve names: %w", err)
+	}
+	if unresolved != "" {
+		return s.nameClarificationResponse(ctx, convID, unresolved)
+	}
+
+	// Address guardrail: recipients must come from the wallet context, the address book or a
+	// resolved name; names typed into the chat are not trusted after a likely injection attempt
+	allowedNames := resolvedNames
+	if len(injection) > 0 {
+		allowedNames = nil
+	}
+	if err := checkConfigurationAddresses(policyResp.Configuration, addresses, contacts, allowedNames); err != nil {
+		return nil, err
+	}
+
+	// Quote swaps and check the balance covers amount and fees before the amount is converted
+	format := s.amountFormatter(req.Context)
+	outcome, quote := s.expectedOutcome(ctx, policyResp.Configuration, balances, format)
+	outcome += s.checkBalanceSufficiency(ctx, policyResp.Configuration, balances, format)
+
 	// 10. Convert from_amount from human-readable to base units
 	// TODO: Confirm if frontend or backend should convert
 	convertAmountToBaseUnits(policyResp.Configuration, balances)
 
 	// 11. Call verifier's /suggest endpoint with the configuration
+	reportProgress(ctx, ProgressVerifier)
 	policySuggest, err := s.verifier.GetPolicySuggest(ctx, suggestion.PluginID, policyResp.Configuration)
+	switch {
+	case errors.Is(err, verifier.ErrPluginNotFound):
+		return s.pluginUnavailableResponse(ctx, convID, suggestion)
+	case errors.Is(err, verifier.ErrInvalidConfiguration):
+		s.logger.WithError(err).WithField("plugin_id", suggestion.PluginID).Warn("plugin rejected policy configuration")
+		return s.invalidConfigurationResponse(ctx, convID, suggestion, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("get policy suggest: %w", err)
 	}
 
-	// 12. Build response metadata
+	// 12. Build response metadata with a policy preview card and a plain-language permissions summary
+	permissions := explainPolicy(policySuggest, policyResp.Configuration, balances, addresses, format)
+	var quoteCards []types.Block
+	if quote != nil {
+		quoteCards = append(quoteCards, quoteBlock(quote))
+	}
+	blocks := s.validBlocks(append([]types.Block{policyPreviewBlock(suggestion, policyResp.Configuration, policySuggest)}, quoteCards...))
+	draftID := uuid.New()
 	metadata := PolicyReadyMetadata{
-		Type:          "policy_ready",
-		Action:        "create_policy",
-		PluginID:      suggestion.PluginID,
-		PolicySuggest: policySuggest,
-		Configuration: policyResp.Configuration,
+		Type:               "policy_ready",
+		Action:             "create_policy",
+		DraftID:            &draftID,
+		PluginID:           suggestion.PluginID,
+		PolicySuggest:      policySuggest,
+		Configuration:      policyResp.Configuration,
+		Blocks:             blocks,
+		PermissionsSummary: permissions,
+		ResolvedNames:      resolvedNames,
+		InstallUnverified:  installUnverified,
 	}
-	metadataJSON, _ := json.Marshal(metadata)
 
 	// 12. Store assistant message in DB
-	responseContent := fmt.Sprintf("I've prepared your %s. Please review the details below and confirm to create the policy.", suggestion.Title)
+	responseContent := fmt.Sprintf("I've prepared your %s. Please review the details below and confirm to create the policy.", suggestion.Title) + outcome
 	if policyResp.Explanation != "" {
-		responseContent = policyResp.Explanation + "\n\nPlease review and confirm to create the policy."
+		var explanation string
+		explanation, metadata.Truncated = s.processResponse(policyResp.Explanation)
+		responseContent = explanation + outcome + "\n\nPlease review and confirm to create the policy."
+	}
+	responseContent += describeResolvedNames(resolvedNames)
+	metadataJSON, _ := json.Marshal(metadata)
+
+	// Keep oversized configurations from bloating the message row; the card is rebuilt from
+	// the compacted configuration so it matches what is stored
+	if len(metadataJSON) > maxPolicyMetadataBytes {
+		originalSize := len(metadataJSON)
+		metadata.Configuration = compactConfiguration(policyResp.Configuration)
+		metadata.ConfigurationCompacted = true
+		blocks = s.validBlocks(append([]types.Block{policyPreviewBlock(suggestion, metadata.Configuration, policySuggest)}, quoteCards...))
+		metadata.Blocks = blocks
+		metadataJSON, _ = json.Marshal(metadata)
+		s.logger.WithFields(logrus.Fields{
+			"conversation_id": convID,
+			"plugin_id":       suggestion.PluginID,
+			"original_bytes":  originalSize,
+			"compacted_bytes": len(metadataJSON),
+		}).Warn("compacted oversized policy configuration in message metadata")
 	}
 
 	assistantMsg := &types.Message{
@@ -150,27 +286,86 @@ func (s *AgentService) buildPolicy(ctx context.Context, convID uuid.UUID, req *S
 		Content:        responseContent,
 		ContentType:    "text",
 		Metadata:       metadataJSON,
+		Blocks:         blocks,
 	}
-	if err := s.msgRepo.Create(ctx, assistantMsg); err != nil {
+	if err := s.storeAssistantMessage(ctx, assistantMsg, nil); err != nil {
 		return nil, fmt.Errorf("store assistant message: %w", err)
 	}
 
+	// Keep the full configuration as the conversation's draft so the confirm sheet can be
+	// restored without another build; the policy is still returned if that fails
+	policyReadyDraftID := &draftID
+	if err := s.savePolicyDraft(ctx, draftID, convID, suggestion.PluginID, policyResp.Configuration, policySuggest); err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to save policy draft")
+		policyReadyDraftID = nil
+	}
+
+	// 13. The policy is ready, so any pending post-install build for this conversation is done.
+	// If the client went away the user never saw it, so the pending build stays for a retry.
+	if ctx.Err() == nil {
+		if err := s.redis.Delete(ctx, pendingBuildKey(convID)); err != nil {
+			s.logger.WithError(err).Warn("failed to clear pending build suggestion")
+		}
+	}
+
 	return &SendMessageResponse{
 		Message: *assistantMsg,
 		PolicyReady: &PolicyReady{
-			PluginID:      suggestion.PluginID,
-			Configuration: policyResp.Configuration,
-			PolicySuggest: policySuggest,
+			DraftID:            policyReadyDraftID,
+			PluginID:           suggestion.PluginID,
+			Configuration:      policyResp.Configuration,
+			PolicySuggest:      policySuggest,
+			PermissionsSummary: permissions,
+			InstallUnverified:  installUnverified,
 		},
 	}, nil
 }
 
+// getSuggestion loads a suggestion stored by detectIntent from Redis.
+func (s *AgentService) getSuggestion(ctx context.Context, id string) (Suggestion, error) {
+	suggJSON, err := s.redis.Get(ctx, id)
+	if err != nil {
+		return Suggestion{}, fmt.Errorf("%w: %v", ErrSuggestionNotFound, err)
+	}
+
+	var suggestion Suggestion
+	if err := json.Unmarshal([]byte(suggJSON), &suggestion); err != nil {
+		return Suggestion{}, fmt.Errorf("unmarshal suggestion: %w", err)
+	}
+	return suggestion, nil
+}
+
+// justInstalled reports whether req continues a build after the app reported installing
+// the plugin.
+func justInstalled(req *SendMessageRequest) bool {
+	return req.ActionResult != nil && req.ActionResult.Action == "install_plugin" && req.ActionResult.Success
+}
+
+// recipeSchemaJSON renders a plugin's configuration schema and examples for the policy
+// builder prompt. examples is empty when the plugin has none.
+func recipeSchemaJSON(schema *verifier.RecipeSchema) (configSchema, examples string, err error) {
+	configSchemaJSON, err := json.MarshalIndent(schema.Configuration, "", "  ")
+	if err != nil {
+		return "", "", fmt.Errorf("marshal config schema: %w", err)
+	}
+	if len(schema.ConfigurationExample) > 0 {
+		examplesJSON, _ := json.MarshalIndent(schema.ConfigurationExample, "", "  ")
+		examples = string(examplesJSON)
+	}
+	return string(configSchemaJSON), examples, nil
+}
+
+// pendingBuildKey is the Redis key holding the suggestion to build once its plugin is installed.
+func pendingBuildKey(convID uuid.UUID) string {
+	return fmt.Sprintf("pending_build:%s", convID)
+}
+
 // parsePolicyResponse extracts the policy response from Claude's response.
-func parsePolicyResponse(resp *anthropic.Response) (*PolicyResponse, error) {
+func (s *AgentService) parsePolicyResponse(ctx context.Context, resp *anthropic.Response) (*PolicyResponse, error) {
 	for _, block := range resp.Content {
 		if block.Type == "tool_use" && block.Name == "build_policy" {
 			var pr PolicyResponse
-			if err := json.Unmarshal(block.Input, &pr); err != nil {
+			if err := s.parseToolInput(ctx, abilityPolicy, resp, block, &pr); err != nil {
 				return nil, fmt.Errorf("unmarshal tool input: %w", err)
 			}
 			return &pr, nil
@@ -182,10 +377,12 @@ func parsePolicyResponse(resp *anthropic.Response) (*PolicyResponse, error) {
 // handleInstallRequired returns an install_required response when a plugin is not installed.
 // It also stores the suggestion ID in Redis so confirmAction can auto-continue to buildPolicy after install.
 func (s *AgentService) handleInstallRequired(ctx context.Context, convID uuid.UUID, suggestion Suggestion) (*SendMessageResponse, error) {
-	// Store pending suggestion for auto-continue after install
-	pendingKey := fmt.Sprintf("pending_build:%s", convID)
-	if err := s.redis.Set(ctx, pendingKey, suggestion.ID, suggestionTTL); err != nil {
-		s.logger.WithError(err).Warn("failed to store pending build suggestion")
+	// Store pending suggestion for auto-continue after install (via the outbox, with the message)
+	var events []*types.OutboxEvent
+	if event, err := outbox.NewRedisSetEvent(pendingBuildKey(convID), suggestion.ID, suggestionTTL); err != nil {
+		s.logger.WithError(err).Warn("failed to build pending build event")
+	} else {
+		events = append(events, event)
 	}
 
 	content := fmt.Sprintf("To use %s, you need to install the plugin first. Please install it and try again.", suggestion.Title)
@@ -197,7 +394,7 @@ func (s *AgentService) handleInstallRequired(ctx context.Context, convID uuid.UU
 		Content:        content,
 		ContentType:    "text",
 	}
-	if err := s.msgRepo.Create(ctx, assistantMsg); err != nil {
+	if err := s.storeAssistantMessage(ctx, assistantMsg, events); err != nil {
 		return nil, fmt.Errorf("store message: %w", err)
 	}
 
@@ -211,10 +408,14 @@ func (s *AgentService) handleInstallRequired(ctx context.Context, convID uuid.UU
 	}, nil
 }
 
+// defaultTokenDecimals is assumed for source assets neither the balances nor the decimals
+// registry know; unknown tokens are almost always ERC-20s.
+const defaultTokenDecimals = 18
+
 // convertAmountToBaseUnits converts fromAmount in the configuration from human-readable
 // format (e.g. "3.5") to base units (e.g. "3500000" for 6-decimal tokens like USDC).
-// It extracts the token address from the nested from.token field and matches it against
-// the user's balances to find the correct decimals.
+// Decimals come from the user's balance matching from.token, then from the decimals
+// registry for the from.chain native asset or a well-known token.
 func convertAmountToBaseUnits(config map[string]any, balances []Balance) {
 	amountVal, ok := config["fromAmount"]
 	if !ok {
@@ -223,23 +424,31 @@ func convertAmountToBaseUnits(config map[string]any, balances []Balance) {
 
 	amountStr := fmt.Sprintf("%v", amountVal)
 
-	// Find decimals from balances by matching from.token
-	decimals := 18 // default to 18 (ETH-like)
-	if from, ok := config["from"].(map[string]any); ok {
-		if token, ok := from["token"].(string); ok && token != "" {
-			for _, b := range balances {
-				if strings.EqualFold(b.Asset, token) {
-					decimals = b.Decimals
-					break
-				}
-			}
-		}
+	from, _ := config["from"].(map[string]any)
+	chain, _ := from["chain"].(string)
+	token, _ := from["token"].(string)
+	decimals, ok := sourceDecimals(chain, token, balances)
+	if !ok {
+		decimals = defaultTokenDecimals
 	}
 
 	baseUnits := toBaseUnits(amountStr, decimals)
 	config["fromAmount"] = baseUnits
 }
 
+// sourceDecimals finds the decimals of a configuration's source asset: a balance on the
+// same asset, then the registry.
+func sourceDecimals(chain, token string, balances []Balance) (int, bool) {
+	if token != "" && !nativeAssetMarkers[strings.ToLower(strings.TrimSpace(token))] {
+		for _, b := range balances {
+			if strings.EqualFold(b.Asset, token) {
+				return b.Decimals, true
+			}
+		}
+	}
+	return assetDecimals(chain, token)
+}
+
 // toBaseUnits converts a human-readable decimal string to base units.
 // e.g. toBaseUnits("3.5", 6) returns "3500000"
 func toBaseUnits(amount string, decimals int) string {
@@ -266,3 +475,73 @@ func toBaseUnits(amount string, decimals int) string {
 	}
 	return result.String()
 }
+
+const (
+	// maxPolicyMetadataBytes bounds the metadata stored with a policy-ready message before
+	// its configuration is compacted.
+	maxPolicyMetadataBytes = 32 << 10
+	// maxConfigValueBytes is the largest configuration value, as JSON, kept verbatim when compacting.
+	maxConfigValueBytes = 512
+)
+
+// compactConfiguration returns a copy of a configuration with oversized values cut down:
+// long strings are truncated, objects are compacted field by field, and arrays or objects
+// that are still too large become a placeholder noting their size. Small values such as
+// assets, amounts and schedules are kept as they are.
+func compactConfiguration(configuration map[string]any) map[string]any {
+	compact := make(map[string]any, len(configuration))
+	for k, v := range configuration {
+		compact[k] = compactConfigValue(v)
+	}
+	return compact
+}
+
+func compactConfigValue(v any) any {
+	data, _ := json.Marshal(v)
+	if len(data) <= maxConfigValueBytes {
+		return v
+	}
+	switch val := v.(type) {
+	case string:
+		runes := []rune(val)
+		return string(runes[:min(len(runes), maxConfigValueBytes)]) + "..."
+	case map[string]any:
+		nested := compactConfiguration(val)
+		if data, _ := json.Marshal(nested); len(data) <= maxConfigValueBytes*4 {
+			return nested
+		}
+		return fmt.Sprintf("[object with %d fields omitted]", len(val))
+	case []any:
+		return fmt.Sprintf("[%d items omitted]", len(val))
+	default:
+		return fmt.Sprintf("[%d bytes omitted]", len(data))
+	}
+}
+
+// schemaPrefetchTimeout bounds the background schema fetches for new suggestions.
+const schemaPrefetchTimeout = 10 * time.Second
+
+// prefetchSchemas warms the verifier's schema cache for freshly suggested plugins in the
+// background, so building a policy from one of them usually skips the schema round-trip.
+func (s *AgentService) prefetchSchemas(ctx context.Context, suggestions []Suggestion) {
+	if s.verifier == nil || len(suggestions) == 0 {
+		return
+	}
+	seen := make(map[string]bool, len(suggestions))
+	var pluginIDs []string
+	for _, sugg := range suggestions {
+		if !seen[sugg.PluginID] {
+			seen[sugg.PluginID] = true
+			pluginIDs = append(pluginIDs, sugg.PluginID)
+		}
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), schemaPrefetchTimeout)
+		defer cancel()
+		for _, pluginID := range pluginIDs {
+			if _, err := s.verifier.GetRecipeSchema(ctx, pluginID); err != nil {
+				s.logger.WithError(err).WithField("plugin_id", pluginID).Debug("failed to prefetch recipe schema")
+			}
+		}
+	}()
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// policyDraftTTL is how long a built policy can be restored for confirmation. Older drafts
+// are left in place but no longer returned; the user selects the suggestion again instead.
+const policyDraftTTL = 24 * time.Hour
+
+// savePolicyDraft stores a built policy as the conversation's pending draft, superseding the
+// previous one.
+func (s *AgentService) savePolicyDraft(ctx context.Context, draftID, convID uuid.UUID, pluginID string, configuration map[string]any, policySuggest *verifier.PolicySuggest) error {
+	if s.draftRepo == nil {
+		return nil
+	}
+	configJSON, err := json.Marshal(configuration)
+	if err != nil {
+		return fmt.Errorf("marshal configuration: %w", err)
+	}
+	suggestJSON, err := json.Marshal(policySuggest)
+	if err != nil {
+		return fmt.Errorf("marshal policy suggest: %w", err)
+	}
+	err = s.draftRepo.Create(ctx, &types.PolicyDraft{
+		ID:             draftID,
+		ConversationID: convID,
+		PluginID:       pluginID,
+		Configuration:  configJSON,
+		PolicySuggest:  suggestJSON,
+	})
+	if err != nil {
+		return err
+	}
+	s.trackExpiry(ctx, types.ExpiryNoticeDraft, draftID.String(), convID, time.Now().Add(policyDraftTTL))
+	return nil
+}
+
+// trackExpiry records when a draft or a reply's suggestions expire, so the user can be
+// notified shortly before. It does nothing when expiry notices are off. Tracking is best
+// effort: failures are logged, and a client that has gone away doesn't cancel the write.
+func (s *AgentService) trackExpiry(ctx context.Context, kind, refID string, convID uuid.UUID, expiresAt time.Time) {
+	if s.noticeRepo == nil {
+		return
+	}
+	err := s.noticeRepo.Track(context.WithoutCancel(ctx), &types.ExpiryNotice{
+		Kind:           kind,
+		RefID:          refID,
+		ConversationID: convID,
+		ExpiresAt:      expiresAt,
+	})
+	if err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{"conversation_id": convID, "kind": kind}).Warn("failed to track expiry notice")
+	}
+}
+
+// resolvePolicyDraft marks the draft a create_policy result refers to as consumed when the
+// policy was created and discarded otherwise. Failures are logged; the draft then simply
+// stays pending until superseded or expired.
+func (s *AgentService) resolvePolicyDraft(ctx context.Context, convID uuid.UUID, result *ActionResult) {
+	if s.draftRepo == nil || result.Action != "create_policy" {
+		return
+	}
+	status := types.PolicyDraftDiscarded
+	if result.Success {
+		status = types.PolicyDraftConsumed
+	}
+	if _, err := s.draftRepo.Resolve(ctx, convID, result.DraftID, status); err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to resolve policy draft")
+	}
+}
+
+// GetPolicyDraft returns the conversation's pending policy draft so the app can restore the
+// confirm sheet. Returns postgres.ErrNotFound when there is no unexpired pending draft.
+func (s *AgentService) GetPolicyDraft(ctx context.Context, convID uuid.UUID, publicKey string) (*types.PolicyDraft, error) {
+	if s.draftRepo == nil {
+		return nil, postgres.ErrNotFound
+	}
+	return s.draftRepo.GetPending(ctx, convID, publicKey, time.Now().Add(-policyDraftTTL))
+}
@@ -0,0 +1,197 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// fakeDraftStore keeps drafts in memory the way the repository does: a new draft supersedes
+// the conversation's pending one.
+type fakeDraftStore struct {
+	createErr error
+
+	mu     sync.Mutex
+	drafts []types.PolicyDraft
+}
+
+func (f *fakeDraftStore) Create(_ context.Context, draft *types.PolicyDraft) error {
+	if f.createErr != nil {
+		return f.createErr
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.drafts {
+		if f.drafts[i].ConversationID == draft.ConversationID && f.drafts[i].Status == types.PolicyDraftPending {
+			f.drafts[i].Status = types.PolicyDraftSuperseded
+		}
+	}
+	draft.Status = types.PolicyDraftPending
+	draft.CreatedAt = time.Now()
+	f.drafts = append(f.drafts, *draft)
+	return nil
+}
+
+func (f *fakeDraftStore) GetPending(_ context.Context, convID uuid.UUID, _ string, createdAfter time.Time) (*types.PolicyDraft, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.drafts) - 1; i >= 0; i-- {
+		d := f.drafts[i]
+		if d.ConversationID == convID && d.Status == types.PolicyDraftPending && d.CreatedAt.After(createdAfter) {
+			return &d, nil
+		}
+	}
+	return nil, postgres.ErrNotFound
+}
+
+func (f *fakeDraftStore) Resolve(_ context.Context, convID uuid.UUID, draftID *uuid.UUID, status string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resolved := false
+	for i := range f.drafts {
+		d := &f.drafts[i]
+		if d.ConversationID != convID || d.Status != types.PolicyDraftPending || (draftID != nil && d.ID != *draftID) {
+			continue
+		}
+		d.Status = status
+		resolved = true
+	}
+	return resolved, nil
+}
+
+// statuses returns the status of every draft, oldest first.
+func (f *fakeDraftStore) statuses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]string, len(f.drafts))
+	for i, d := range f.drafts {
+		out[i] = d.Status
+	}
+	return out
+}
+
+// draftService returns a service that builds policies for a stored suggestion in convID,
+// keeping drafts in drafts.
+func draftService(t *testing.T, convID uuid.UUID, drafts *fakeDraftStore) (*AgentService, *fakeMessageStore) {
+	t.Helper()
+	cache := newFakeCache()
+	suggestion, _ := json.Marshal(Suggestion{ID: "sugg-1", PluginID: testPluginID, Title: "Recurring swap", ConversationID: convID.String()})
+	_ = cache.Set(context.Background(), "sugg-1", string(suggestion), 0)
+	msgs := &fakeMessageStore{}
+	s := NewAgentService(Deps{
+		Anthropic:     &fakeModel{resp: toolReply(BuildPolicyTool.Name, map[string]any{"configuration": map[string]any{"asset": "ETH", "frequency": "weekly"}})},
+		Messages:      msgs,
+		Conversations: &fakeConversationStore{owner: testOwner},
+		Drafts:        drafts,
+		Cache:         cache,
+		Outbox:        &fakeOutbox{cache: cache},
+		Verifier:      &fakeVerifier{schemas: map[string]*verifier.RecipeSchema{testPluginID: {}}, suggest: &verifier.PolicySuggest{}},
+		Logger:        testLogger(),
+	}, Settings{
+		Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+		Agent:   config.AgentConfig{PolicyMaxTokens: 1024},
+	})
+	return s, msgs
+}
+
+func TestPolicyDraftLifecycle(t *testing.T) {
+	ctx := context.Background()
+	convID := uuid.New()
+	drafts := &fakeDraftStore{}
+	s, msgs := draftService(t, convID, drafts)
+	build := func() *PolicyReady {
+		t.Helper()
+		id := "sugg-1"
+		resp, err := s.buildPolicy(ctx, convID, &SendMessageRequest{PublicKey: testOwner, SelectedSuggestionID: &id}, &conversationWindow{})
+		if err != nil {
+			t.Fatalf("buildPolicy() error = %v", err)
+		}
+		if resp.PolicyReady == nil || resp.PolicyReady.DraftID == nil {
+			t.Fatalf("PolicyReady = %+v, want one referencing its draft", resp.PolicyReady)
+		}
+		return resp.PolicyReady
+	}
+
+	// A build stores its draft, referenced from both the reply and the stored message
+	first := build()
+	draft, err := s.GetPolicyDraft(ctx, convID, testOwner)
+	if err != nil {
+		t.Fatalf("GetPolicyDraft() error = %v", err)
+	}
+	if draft.ID != *first.DraftID || draft.PluginID != testPluginID {
+		t.Errorf("pending draft = %s for %s, want %s for %s", draft.ID, draft.PluginID, *first.DraftID, testPluginID)
+	}
+	var configuration map[string]any
+	if err := json.Unmarshal(draft.Configuration, &configuration); err != nil || configuration["asset"] != "ETH" {
+		t.Errorf("draft configuration = %s, want the built configuration", draft.Configuration)
+	}
+	stored := msgs.stored()
+	var meta PolicyReadyMetadata
+	if err := json.Unmarshal(stored[len(stored)-1].Metadata, &meta); err != nil || meta.DraftID == nil || *meta.DraftID != *first.DraftID {
+		t.Errorf("stored metadata draft_id = %v, want %s", meta.DraftID, *first.DraftID)
+	}
+
+	// Building again supersedes it
+	second := build()
+	if got := drafts.statuses(); len(got) != 2 || got[0] != types.PolicyDraftSuperseded || got[1] != types.PolicyDraftPending {
+		t.Errorf("draft statuses = %q, want superseded then pending", got)
+	}
+	if draft, err := s.GetPolicyDraft(ctx, convID, testOwner); err != nil || draft.ID != *second.DraftID {
+		t.Errorf("GetPolicyDraft() = %v, %v; want the second draft", draft, err)
+	}
+
+	// Results of other actions or for the superseded draft leave the pending one alone
+	s.resolvePolicyDraft(ctx, convID, &ActionResult{Action: "swap", Success: true})
+	s.resolvePolicyDraft(ctx, convID, &ActionResult{Action: "create_policy", Success: true, DraftID: first.DraftID})
+	if got := drafts.statuses(); got[1] != types.PolicyDraftPending {
+		t.Errorf("draft status = %q after unrelated results, want pending", got[1])
+	}
+
+	// Confirming the policy consumes it, and nothing is left to restore
+	s.resolvePolicyDraft(ctx, convID, &ActionResult{Action: "create_policy", Success: true, DraftID: second.DraftID})
+	if got := drafts.statuses(); got[1] != types.PolicyDraftConsumed {
+		t.Errorf("draft status = %q after confirming, want consumed", got[1])
+	}
+	if _, err := s.GetPolicyDraft(ctx, convID, testOwner); !errors.Is(err, postgres.ErrNotFound) {
+		t.Errorf("GetPolicyDraft() error = %v, want %v", err, postgres.ErrNotFound)
+	}
+
+	// A failed create without a draft ID discards the conversation's pending draft
+	third := build()
+	s.resolvePolicyDraft(ctx, convID, &ActionResult{Action: "create_policy", Error: "user declined"})
+	if got := drafts.statuses(); got[2] != types.PolicyDraftDiscarded {
+		t.Errorf("draft %s status = %q after a failed create, want discarded", *third.DraftID, got[2])
+	}
+}
+
+func TestPolicyDraftSaveFails(t *testing.T) {
+	convID := uuid.New()
+	s, _ := draftService(t, convID, &fakeDraftStore{createErr: errConnReset})
+	id := "sugg-1"
+
+	resp, err := s.buildPolicy(context.Background(), convID, &SendMessageRequest{PublicKey: testOwner, SelectedSuggestionID: &id}, &conversationWindow{})
+	if err != nil {
+		t.Fatalf("buildPolicy() error = %v", err)
+	}
+	// The policy is still returned, without a draft the app could reference
+	if resp.PolicyReady == nil || resp.PolicyReady.DraftID != nil {
+		t.Errorf("PolicyReady = %+v, want the policy without a draft ID", resp.PolicyReady)
+	}
+}
+
+func TestGetPolicyDraftWithoutStore(t *testing.T) {
+	s := &AgentService{}
+	if _, err := s.GetPolicyDraft(context.Background(), uuid.New(), testOwner); !errors.Is(err, postgres.ErrNotFound) {
+		t.Errorf("GetPolicyDraft() error = %v, want %v", err, postgres.ErrNotFound)
+	}
+}
@@ -0,0 +1,361 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+)
+
+const testPluginID = "vultisig-dca-0000"
+
+var errConnReset = errors.New("connection reset")
+
+// policyService returns a service holding one stored suggestion for testPluginID in convID.
+func policyService(t *testing.T, v *fakeVerifier, convID uuid.UUID) (*AgentService, *fakeMessageStore, *SendMessageRequest) {
+	t.Helper()
+	cache := newFakeCache()
+	suggestion := Suggestion{ID: "sugg-1", PluginID: testPluginID, Title: "Recurring swap", ConversationID: convID.String()}
+	data, err := json.Marshal(suggestion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = cache.Set(context.Background(), suggestion.ID, string(data), 0)
+
+	msgs := &fakeMessageStore{}
+	s := &AgentService{msgRepo: msgs, redis: cache, outbox: &fakeOutbox{cache: cache}, verifier: v, logger: testLogger()}
+	return s, msgs, &SendMessageRequest{PublicKey: testOwner, SelectedSuggestionID: &suggestion.ID}
+}
+
+func TestBuildPolicyVerifierOutcomes(t *testing.T) {
+	tests := []struct {
+		name          string
+		verifier      *fakeVerifier
+		accessToken   string
+		wantErr       error
+		wantErrorCode string
+		// wantInstallRequired is set when the build stops to ask for the plugin to be installed
+		wantInstallRequired bool
+		wantInstall         int
+		wantCached          bool
+	}{
+		{
+			name:        "access token rejected",
+			verifier:    &fakeVerifier{installErr: verifier.ErrUnauthorized},
+			accessToken: "token",
+			wantErr:     verifier.ErrUnauthorized,
+			wantInstall: 1,
+		},
+		{
+			name:          "plugin gone during install check",
+			verifier:      &fakeVerifier{installErr: verifier.ErrPluginNotFound},
+			accessToken:   "token",
+			wantErrorCode: ErrorCodePluginUnavailable,
+			wantInstall:   1,
+		},
+		{
+			name:                "token given, plugin not installed at build time",
+			verifier:            &fakeVerifier{installed: []string{"vultisig-payroll-0000"}},
+			accessToken:         "token",
+			wantInstallRequired: true,
+			wantInstall:         1,
+			wantCached:          true,
+		},
+		{
+			name:          "installed but schema unknown",
+			verifier:      &fakeVerifier{installed: []string{testPluginID}},
+			accessToken:   "token",
+			wantErrorCode: ErrorCodePluginUnavailable,
+			wantInstall:   1,
+			wantCached:    true,
+		},
+		{
+			name:          "no token skips the install check",
+			verifier:      &fakeVerifier{},
+			wantErrorCode: ErrorCodePluginUnavailable,
+		},
+		{
+			name:        "schema lookup fails",
+			verifier:    &fakeVerifier{installed: []string{testPluginID}, schemaErr: errConnReset},
+			accessToken: "token",
+			wantErr:     errConnReset,
+			wantInstall: 1,
+			wantCached:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convID := uuid.New()
+			s, msgs, req := policyService(t, tt.verifier, convID)
+			req.AccessToken = tt.accessToken
+
+			resp, err := s.buildPolicy(context.Background(), convID, req, &conversationWindow{})
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("buildPolicy() err = %v, want %v", err, tt.wantErr)
+				}
+				if len(msgs.created) != 0 {
+					t.Errorf("stored %d messages on error, want none", len(msgs.created))
+				}
+			case err != nil:
+				t.Fatalf("buildPolicy() err = %v", err)
+			default:
+				if resp.ErrorCode != tt.wantErrorCode {
+					t.Errorf("ErrorCode = %q, want %q", resp.ErrorCode, tt.wantErrorCode)
+				}
+				if got := resp.InstallRequired != nil; got != tt.wantInstallRequired {
+					t.Errorf("InstallRequired = %+v, want set %v", resp.InstallRequired, tt.wantInstallRequired)
+				}
+				// The suggestion is kept pending so the build continues once the plugin is installed
+				if pending, _ := s.redis.Exists(context.Background(), pendingBuildKey(convID)); pending != tt.wantInstallRequired {
+					t.Errorf("pending build stored = %v, want %v", pending, tt.wantInstallRequired)
+				}
+				if len(msgs.created) != 1 {
+					t.Errorf("stored %d messages, want 1", len(msgs.created))
+				}
+			}
+
+			if tt.verifier.installCall != tt.wantInstall {
+				t.Errorf("InstalledPluginIDs called %d times, want %d", tt.verifier.installCall, tt.wantInstall)
+			}
+			if len(tt.verifier.schemaCalls) != 1 || tt.verifier.schemaCalls[0] != testPluginID {
+				t.Errorf("GetRecipeSchema calls = %v, want [%s]", tt.verifier.schemaCalls, testPluginID)
+			}
+			if cached := s.cachedInstalledPlugins(context.Background(), testOwner) != nil; cached != tt.wantCached {
+				t.Errorf("installed plugins cached = %v, want %v", cached, tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestBuildPolicyRejectsSuggestionFromOtherConversation(t *testing.T) {
+	v := &fakeVerifier{}
+	s, _, req := policyService(t, v, uuid.New())
+
+	_, err := s.buildPolicy(context.Background(), uuid.New(), req, &conversationWindow{})
+	var convErr *SuggestionConversationError
+	if !errors.As(err, &convErr) {
+		t.Fatalf("buildPolicy() err = %v, want SuggestionConversationError", err)
+	}
+	if v.installCall != 0 || len(v.schemaCalls) != 0 {
+		t.Errorf("verifier was called for a foreign suggestion")
+	}
+}
+
+func TestListPluginsInstallState(t *testing.T) {
+	skills := []PluginSkill{
+		{PluginID: testPluginID, Name: "DCA", Skills: "Buys a fixed amount on a schedule."},
+		{PluginID: "vultisig-payroll-0000", Name: "Payroll", Skills: "Pays recipients on a schedule."},
+	}
+	tests := []struct {
+		name        string
+		verifier    *fakeVerifier
+		accessToken string
+		want        map[string]*bool
+		wantInstall int
+	}{
+		{
+			name:        "annotated with a token",
+			verifier:    &fakeVerifier{installed: []string{testPluginID}},
+			accessToken: "token",
+			want:        map[string]*bool{testPluginID: ptr(true), "vultisig-payroll-0000": ptr(false)},
+			wantInstall: 1,
+		},
+		{
+			name:     "no token leaves install state out",
+			verifier: &fakeVerifier{installed: []string{testPluginID}},
+			want:     map[string]*bool{testPluginID: nil, "vultisig-payroll-0000": nil},
+		},
+		{
+			name:        "verifier failure leaves install state out",
+			verifier:    &fakeVerifier{installErr: errors.New("timeout")},
+			accessToken: "token",
+			want:        map[string]*bool{testPluginID: nil, "vultisig-payroll-0000": nil},
+			wantInstall: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AgentService{
+				redis:          newFakeCache(),
+				verifier:       tt.verifier,
+				pluginProvider: &fakeSkillsProvider{skills: skills},
+				logger:         testLogger(),
+			}
+			plugins := s.ListPlugins(context.Background(), testOwner, tt.accessToken)
+			if len(plugins) != len(skills) {
+				t.Fatalf("ListPlugins() returned %d plugins, want %d", len(plugins), len(skills))
+			}
+			for _, p := range plugins {
+				want := tt.want[p.ID]
+				if (p.Installed == nil) != (want == nil) || p.Installed != nil && *p.Installed != *want {
+					t.Errorf("%s installed = %v, want %v", p.ID, p.Installed, want)
+				}
+			}
+			if tt.verifier.installCall != tt.wantInstall {
+				t.Errorf("InstalledPluginIDs called %d times, want %d", tt.verifier.installCall, tt.wantInstall)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestToBaseUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals int
+		want     string
+	}{
+		{"3.5", 6, "3500000"},
+		{"1", 18, "1000000000000000000"},
+		{"0.000001", 6, "1"},
+		{"0.0000001", 6, "0"}, // below one base unit is truncated
+		{"1.23456789", 8, "123456789"},
+		{"12.345", 0, "12"},
+		{"007.50", 2, "750"},
+		{"abc", 6, "abc"}, // unparsable amounts are returned as given
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			if got := toBaseUnits(tt.amount, tt.decimals); got != tt.want {
+				t.Errorf("toBaseUnits(%q, %d) = %q, want %q", tt.amount, tt.decimals, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceDecimals(t *testing.T) {
+	const usdc = "0xA0b86991c6218b36c1d19d4a2e9eB0cE3606eB48"
+	const unknown = "0x1111111111111111111111111111111111111111"
+	tests := []struct {
+		name     string
+		chain    string
+		token    string
+		balances []Balance
+		want     int
+		wantOK   bool
+	}{
+		{name: "native asset", chain: "Ethereum", token: "", want: 18, wantOK: true},
+		{name: "native marker ignores balances", chain: "Ethereum", token: "native", balances: []Balance{{Asset: "native", Decimals: 6}}, want: 18, wantOK: true},
+		{name: "known token from the registry", chain: "Ethereum", token: usdc, want: 6, wantOK: true},
+		{name: "balance wins over the registry", chain: "Ethereum", token: usdc, balances: []Balance{{Asset: usdc, Decimals: 8}}, want: 8, wantOK: true},
+		{name: "unknown token from a balance", chain: "Ethereum", token: unknown, balances: []Balance{{Asset: unknown, Decimals: 9}}, want: 9, wantOK: true},
+		{name: "unknown token", chain: "Ethereum", token: unknown},
+		{name: "unknown chain", chain: "Nowhere", token: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sourceDecimals(tt.chain, tt.token, tt.balances)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("sourceDecimals() = %d, %v; want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestBuildPolicyVerifierLatency(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	tests := []struct {
+		name      string
+		installed []string
+		// wantReady is set when the policy is built, otherwise installation is asked for
+		wantReady bool
+	}{
+		{name: "installed", installed: []string{testPluginID}, wantReady: true},
+		{name: "not installed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convID := uuid.New()
+			cache := newFakeCache()
+			suggestion, _ := json.Marshal(Suggestion{ID: "sugg-1", PluginID: testPluginID, Title: "Recurring swap", ConversationID: convID.String()})
+			_ = cache.Set(context.Background(), "sugg-1", string(suggestion), 0)
+			v := &fakeVerifier{
+				installed: tt.installed,
+				schemas:   map[string]*verifier.RecipeSchema{testPluginID: {}},
+				suggest:   &verifier.PolicySuggest{},
+				delay:     delay,
+			}
+			s := NewAgentService(Deps{
+				Anthropic:     &fakeModel{resp: toolReply(BuildPolicyTool.Name, map[string]any{"configuration": map[string]any{"asset": "ETH", "frequency": "weekly"}})},
+				Messages:      &fakeMessageStore{},
+				Conversations: &fakeConversationStore{owner: testOwner},
+				Cache:         cache,
+				Outbox:        &fakeOutbox{cache: cache},
+				Verifier:      v,
+				Logger:        testLogger(),
+			}, Settings{
+				Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+				Agent:   config.AgentConfig{PolicyMaxTokens: 1024},
+			})
+			id := "sugg-1"
+
+			start := time.Now()
+			resp, err := s.buildPolicy(context.Background(), convID, &SendMessageRequest{PublicKey: testOwner, SelectedSuggestionID: &id, AccessToken: "token"}, &conversationWindow{})
+			elapsed := time.Since(start)
+			if err != nil {
+				t.Fatalf("buildPolicy() error = %v", err)
+			}
+
+			// Both verifier calls were made, overlapping rather than back to back
+			if v.installCall != 1 || len(v.schemaCalls) != 1 {
+				t.Errorf("verifier got %d install checks and %d schema fetches, want 1 each", v.installCall, len(v.schemaCalls))
+			}
+			if elapsed >= 2*delay {
+				t.Errorf("buildPolicy() took %v, want under %v with the verifier calls run concurrently", elapsed, 2*delay)
+			}
+			if got := resp.PolicyReady != nil; got != tt.wantReady {
+				t.Errorf("PolicyReady set = %v, want %v", got, tt.wantReady)
+			}
+			if got := resp.InstallRequired != nil; got == tt.wantReady {
+				t.Errorf("InstallRequired set = %v, want %v", got, !tt.wantReady)
+			}
+		})
+	}
+}
+
+func TestProcessMessagePrefetchesSchemas(t *testing.T) {
+	svc, _ := newConversationService(&fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "action_request",
+		"response": "A recurring swap can buy ETH every week.",
+		"suggestions": []map[string]any{
+			{"plugin_id": testPluginID, "title": "Weekly ETH", "description": "Buy ETH every week"},
+			{"plugin_id": testPluginID, "title": "Daily ETH", "description": "Buy ETH every day"},
+		},
+	})})
+	v := &fakeVerifier{schemas: map[string]*verifier.RecipeSchema{testPluginID: {}}}
+	svc.verifier = v
+	svc.outbox = &fakeOutbox{cache: svc.redis}
+
+	resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "how can I buy ETH every week?",
+	})
+	if err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+	if len(resp.Suggestions) == 0 {
+		t.Fatal("reply has no suggestions")
+	}
+
+	// The schema is fetched once per suggested plugin, in the background
+	schemaCalls := func() []string {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return slices.Clone(v.schemaCalls)
+	}
+	waitFor(t, "schema prefetch", func() bool { return len(schemaCalls()) > 0 })
+	time.Sleep(20 * time.Millisecond)
+	if got := schemaCalls(); !slices.Equal(got, []string{testPluginID}) {
+		t.Errorf("GetRecipeSchema calls = %v, want [%s]", got, testPluginID)
+	}
+}
@@ -0,0 +1,61 @@
+package agent
+
+import "context"
+
+// Progress stages reported while a reply is prepared, before each slow downstream call.
+const (
+	ProgressThinking      = "thinking"
+	ProgressSummarizing   = "summarizing"
+	ProgressVerifier      = "contacting_automation_service"
+	ProgressResolvingName = "resolving_name"
+	ProgressTransaction   = "checking_transaction"
+	ProgressFees          = "estimating_fees"
+	ProgressSwapQuote     = "fetching_swap_quote"
+	ProgressSpeech        = "synthesizing_speech"
+)
+
+// progressMessages is the text shown for each stage.
+var progressMessages = map[string]string{
+	ProgressThinking:      "Thinking...",
+	ProgressSummarizing:   "Catching up on the conversation...",
+	ProgressVerifier:      "Contacting the automation service...",
+	ProgressResolvingName: "Resolving the name...",
+	ProgressTransaction:   "Checking the transaction...",
+	ProgressFees:          "Estimating network fees...",
+	ProgressSwapQuote:     "Fetching a swap quote...",
+	ProgressSpeech:        "Recording the voice reply...",
+}
+
+// toolProgress is the stage reported before each server-side tool call. Tools answered
+// in memory, like resolve_contact, report nothing.
+var toolProgress = map[string]string{
+	"resolve_name":           ProgressResolvingName,
+	"get_transaction_status": ProgressTransaction,
+	"get_fee_estimate":       ProgressFees,
+	"get_swap_quote":         ProgressSwapQuote,
+}
+
+// ProgressEvent reports a step of a reply in progress. Message is short text the app can
+// show as is.
+type ProgressEvent struct {
+	Stage   string `json:"stage"`
+	Message string `json:"message"`
+}
+
+// progressKey is the context key for the listener of a reply's progress.
+type progressKey struct{}
+
+// WithProgress returns a context whose reply reports its progress to report. report may be
+// called from goroutines the turn starts, so it must be safe for concurrent use.
+func WithProgress(ctx context.Context, report func(ProgressEvent)) context.Context {
+	return context.WithValue(ctx, progressKey{}, report)
+}
+
+// reportProgress tells the listener of ctx, if any, that the reply reached stage.
+func reportProgress(ctx context.Context, stage string) {
+	report, ok := ctx.Value(progressKey{}).(func(ProgressEvent))
+	if !ok {
+		return
+	}
+	report(ProgressEvent{Stage: stage, Message: progressMessages[stage]})
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+)
+
+// slowVerifier holds every schema fetch until released, signalling when one starts.
+type slowVerifier struct {
+	*fakeVerifier
+	started chan struct{}
+	release chan struct{}
+}
+
+func (v *slowVerifier) GetRecipeSchema(ctx context.Context, pluginID string) (*verifier.RecipeSchema, error) {
+	v.started <- struct{}{}
+	<-v.release
+	return v.fakeVerifier.GetRecipeSchema(ctx, pluginID)
+}
+
+func TestBuildPolicyProgress(t *testing.T) {
+	convID := uuid.New()
+	v := &slowVerifier{fakeVerifier: &fakeVerifier{}, started: make(chan struct{}, 1), release: make(chan struct{})}
+	s, _, req := policyService(t, v.fakeVerifier, convID)
+	s.verifier = v
+
+	events := make(chan ProgressEvent, 10)
+	ctx := WithProgress(context.Background(), func(e ProgressEvent) { events <- e })
+
+	type result struct {
+		resp *SendMessageResponse
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		resp, err := s.buildPolicy(ctx, convID, req, &conversationWindow{})
+		done <- result{resp, err}
+	}()
+
+	select {
+	case <-v.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("verifier was never called")
+	}
+	// The event is out while the verifier call is still pending
+	select {
+	case e := <-events:
+		want := ProgressEvent{Stage: ProgressVerifier, Message: "Contacting the automation service..."}
+		if e != want {
+			t.Errorf("progress event = %+v, want %+v", e, want)
+		}
+	default:
+		t.Fatal("no progress event before the slow verifier call")
+	}
+	select {
+	case e := <-events:
+		t.Errorf("progress event %+v while the verifier call is pending, want one", e)
+	default:
+	}
+
+	close(v.release)
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("buildPolicy() didn't return after the verifier answered")
+	}
+	if res.err != nil {
+		t.Fatalf("buildPolicy() error = %v", res.err)
+	}
+	// The plugin is gone, so the build stops without another verifier call
+	if res.resp.ErrorCode != ErrorCodePluginUnavailable {
+		t.Errorf("ErrorCode = %q, want %q", res.resp.ErrorCode, ErrorCodePluginUnavailable)
+	}
+	if len(events) != 0 {
+		t.Errorf("%d more progress events after the verifier answered, want none", len(events))
+	}
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// staticPromptCache holds the rendered pieces of the static prompt (base prompt plus plugin
+// skills). Each request lists a different ranked subset of plugins, so the cache keeps one
+// rendered section per plugin and assembles the subset from them; skills total tens of KB and
+// are only rendered again after the plugin provider reports a new skills generation.
+type staticPromptCache struct {
+	// appendix is the operator-configured system prompt appendix; it is fixed for the process.
+	appendix string
+
+	mu         sync.RWMutex
+	base       string
+	generation uint64
+	sections   map[string]string
+}
+
+// get returns the static prompt for plugins, rendered from skills of the given generation,
+// and a count of omitted plugins. Sections of an older generation than the cached one are
+// rendered without being stored.
+func (c *staticPromptCache) get(generation uint64, plugins []PluginSkill, omitted int) string {
+	c.mu.RLock()
+	base := c.base
+	sections := make([]string, len(plugins))
+	size, missing := 0, false
+	if generation == c.generation {
+		for i, p := range plugins {
+			sections[i] = c.sections[p.PluginID]
+			size += len(sections[i])
+			missing = missing || sections[i] == ""
+		}
+	}
+	current := generation == c.generation
+	c.mu.RUnlock()
+
+	if base == "" {
+		base = c.storeBase()
+	}
+	if !current || missing {
+		size = c.fill(generation, plugins, sections)
+	}
+
+	if len(plugins) == 0 {
+		return base
+	}
+	note := omittedPluginsNote(omitted)
+	var sb strings.Builder
+	sb.Grow(len(base) + len(pluginsHeader) + size + len(note))
+	sb.WriteString(base)
+	sb.WriteString(pluginsHeader)
+	for _, section := range sections {
+		sb.WriteString(section)
+	}
+	sb.WriteString(note)
+	return sb.String()
+}
+
+// storeBase renders and stores the base prompt, which never changes for the process.
+func (c *staticPromptCache) storeBase() string {
+	base := systemPromptBase(c.appendix)
+	c.mu.Lock()
+	c.base = base
+	c.mu.Unlock()
+	return base
+}
+
+// fill renders the sections missing from sections and returns their total size. A newer
+// generation drops every section cached for the previous one.
+func (c *staticPromptCache) fill(generation uint64, plugins []PluginSkill, sections []string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation > c.generation || c.sections == nil {
+		c.generation = generation
+		c.sections = make(map[string]string, len(plugins))
+	}
+	store := generation == c.generation
+
+	size := 0
+	for i, p := range plugins {
+		if store {
+			sections[i] = c.sections[p.PluginID]
+		}
+		if sections[i] == "" {
+			sections[i] = pluginSection(p)
+			if store {
+				c.sections[p.PluginID] = sections[i]
+			}
+		}
+		size += len(sections[i])
+	}
+	return size
+}
+
+// rankedStaticPrompt ranks the plugin skills for query and chains and returns the static
+// prompt listing the best matches, along with those plugins.
+func (s *AgentService) rankedStaticPrompt(ctx context.Context, query string, chains []string) (string, []PluginSkill) {
+	if s.pluginProvider == nil {
+		return s.staticPrompt.get(0, nil, 0), nil
+	}
+	// The generation is read before the skills: skills refreshed in between are then stored
+	// under the older generation and rendered again on the next request, never the reverse.
+	generation := s.pluginProvider.SkillsGeneration()
+	plugins, omitted := rankPlugins(s.pluginProvider.GetSkills(ctx), query, chains, s.maxPromptPlugins)
+	return s.staticPrompt.get(generation, plugins, omitted), plugins
+}
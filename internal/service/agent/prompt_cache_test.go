@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testPlugins(n int, version string) []PluginSkill {
+	plugins := make([]PluginSkill, n)
+	for i := range plugins {
+		plugins[i] = PluginSkill{
+			PluginID: fmt.Sprintf("plugin-%d", i),
+			Name:     fmt.Sprintf("Plugin %d", i),
+			Skills:   fmt.Sprintf("## Skills %s\n\n%s", version, strings.Repeat("Automates recurring swaps and sends. ", 60)),
+		}
+	}
+	return plugins
+}
+
+func TestStaticPromptCacheMatchesBuildStaticPrompt(t *testing.T) {
+	plugins := testPlugins(6, "v1")
+	tests := []struct {
+		name    string
+		plugins []PluginSkill
+		omitted int
+	}{
+		{"no plugins", nil, 0},
+		{"all plugins", plugins, 0},
+		{"ranked subset", []PluginSkill{plugins[4], plugins[1]}, 4},
+		{"other subset", []PluginSkill{plugins[1], plugins[5], plugins[0]}, 3},
+		{"single plugin", plugins[2:3], 5},
+	}
+	for _, appendix := range []string{"", "Operator note."} {
+		c := &staticPromptCache{appendix: appendix}
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/appendix=%t", tt.name, appendix != ""), func(t *testing.T) {
+				want := BuildStaticPrompt(tt.plugins, tt.omitted, appendix)
+				// First call renders, second serves from the cache
+				for range 2 {
+					if got := c.get(1, tt.plugins, tt.omitted); got != want {
+						t.Fatalf("get() differs from BuildStaticPrompt():\n%s\nwant:\n%s", got, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestStaticPromptCacheInvalidation(t *testing.T) {
+	old, fresh := testPlugins(3, "v1"), testPlugins(3, "v2")
+	c := &staticPromptCache{}
+
+	tests := []struct {
+		name       string
+		generation uint64
+		plugins    []PluginSkill
+		want       string
+	}{
+		{"first render", 1, old, "Skills v1"},
+		{"same generation served from cache", 1, fresh, "Skills v1"},
+		{"new generation renders again", 2, fresh, "Skills v2"},
+		{"late request from an older generation", 1, old, "Skills v1"},
+		{"older generation doesn't replace the cache", 2, fresh, "Skills v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := c.get(tt.generation, tt.plugins, 0)
+			if n := strings.Count(got, tt.want); n != len(tt.plugins) {
+				t.Errorf("get(%d) has %d sections with %q, want %d", tt.generation, n, tt.want, len(tt.plugins))
+			}
+		})
+	}
+}
+
+func BenchmarkStaticPromptCache(b *testing.B) {
+	plugins := testPlugins(40, "v1")
+	// Each message ranks a different subset, as rankPlugins does
+	subsets := make([][]PluginSkill, 8)
+	for i := range subsets {
+		for j := range 10 {
+			subsets[i] = append(subsets[i], plugins[(i*7+j*3)%len(plugins)])
+		}
+	}
+
+	c := &staticPromptCache{}
+	b.ReportAllocs()
+	i := 0
+	for b.Loop() {
+		_ = c.get(1, subsets[i%len(subsets)], 30)
+		i++
+	}
+}
+
+func TestBuildStaticPromptAppendix(t *testing.T) {
+	plugins := testPlugins(1, "v1")
+	plain := BuildStaticPrompt(plugins, 0, "")
+
+	// A blank appendix leaves the prompt as it is
+	if got := BuildStaticPrompt(plugins, 0, " \n\t"); got != plain {
+		t.Errorf("prompt with a blank appendix differs from the plain prompt")
+	}
+
+	got := BuildStaticPrompt(plugins, 0, "  Operator note.\n")
+	at := strings.Index(got, "\n\nOperator note.")
+	if !strings.HasPrefix(got, SystemPrompt) || at != len(SystemPrompt) {
+		t.Errorf("appendix at %d, want directly after the base prompt at %d", at, len(SystemPrompt))
+	}
+	if skills := strings.Index(got, "Skills v1"); skills < at {
+		t.Errorf("plugin skills at %d, want them after the appendix at %d", skills, at)
+	}
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/embeddings"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+const (
+	// recallTimeout bounds the embedding and search done while answering a request.
+	recallTimeout = 3 * time.Second
+	// indexTimeout bounds embedding a stored message in the background.
+	indexTimeout = 15 * time.Second
+)
+
+// EmbeddingStore persists message embeddings and searches them.
+// *postgres.EmbeddingRepository is the production implementation.
+type EmbeddingStore interface {
+	Upsert(ctx context.Context, messageID, convID uuid.UUID, model string, embedding []float32) error
+	Search(ctx context.Context, convID uuid.UUID, model string, embedding []float32, before time.Time, limit int) ([]types.RecalledMessage, error)
+	ListWithoutEmbedding(ctx context.Context, model string, limit int) ([]types.Message, error)
+}
+
+var _ EmbeddingStore = (*postgres.EmbeddingRepository)(nil)
+
+// MessageRecall embeds messages as they are stored and retrieves older messages of a
+// conversation that are semantically similar to the incoming one, so specifics lost to
+// summarization can still reach the model.
+type MessageRecall struct {
+	embedder    embeddings.Embedder
+	repo        EmbeddingStore
+	topK        int
+	maxDistance float64
+	logger      *logrus.Logger
+}
+
+// NewMessageRecall creates a MessageRecall.
+func NewMessageRecall(embedder embeddings.Embedder, repo EmbeddingStore, cfg config.RecallConfig, logger *logrus.Logger) *MessageRecall {
+	return &MessageRecall{
+		embedder:    embedder,
+		repo:        repo,
+		topK:        cfg.TopK,
+		maxDistance: cfg.MaxDistance,
+		logger:      logger,
+	}
+}
+
+// Index embeds and stores messages. Messages must already have IDs. Secrets are scrubbed
+// before the text is sent to the embedding provider.
+func (r *MessageRecall) Index(ctx context.Context, msgs []types.Message) error {
+	texts := make([]string, len(msgs))
+	for i, msg := range msgs {
+		texts[i], _ = scrubSensitive(msg.Content)
+	}
+	vectors, err := r.embedder.Embed(ctx, texts, embeddings.InputDocument)
+	if err != nil {
+		return fmt.Errorf("embed messages: %w", err)
+	}
+	for i, msg := range msgs {
+		if err := r.repo.Upsert(ctx, msg.ID, msg.ConversationID, r.embedder.Model(), vectors[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recall returns up to topK messages of the conversation created before the given time
+// that are within maxDistance of the query, oldest first.
+func (r *MessageRecall) Recall(ctx context.Context, convID uuid.UUID, query string, before time.Time) ([]types.RecalledMessage, error) {
+	vectors, err := r.embedder.Embed(ctx, []string{query}, embeddings.InputQuery)
+	if err != nil {
+		return nil, fmt.Errorf("embed query: %w", err)
+	}
+	matches, err := r.repo.Search(ctx, convID, r.embedder.Model(), vectors[0], before, r.topK)
+	if err != nil {
+		return nil, err
+	}
+
+	var recalled []types.RecalledMessage
+	for _, m := range matches {
+		if m.Distance <= r.maxDistance {
+			recalled = append(recalled, m)
+		}
+	}
+	// Matches come most similar first; the prompt reads better in conversation order
+	sort.Slice(recalled, func(i, j int) bool {
+		return recalled[i].CreatedAt.Before(recalled[j].CreatedAt)
+	})
+	return recalled, nil
+}
+
+// Backfill embeds one batch of messages that have no embedding yet and returns how many
+// were indexed. Callers loop until it returns 0.
+func (r *MessageRecall) Backfill(ctx context.Context, batchSize int) (int, error) {
+	msgs, err := r.repo.ListWithoutEmbedding(ctx, r.embedder.Model(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	if err := r.Index(ctx, msgs); err != nil {
+		return 0, err
+	}
+	return len(msgs), nil
+}
+
+// noMemoryKey marks a context serving a turn with memory turned off.
+type noMemoryKey struct{}
+
+// withNoMemory marks ctx as serving a turn with memory turned off, by the conversation or
+// the request. Its messages are kept out of recall.
+func withNoMemory(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noMemoryKey{}, true)
+}
+
+// memoryOff reports whether ctx serves a turn with memory turned off.
+func memoryOff(ctx context.Context) bool {
+	off, _ := ctx.Value(noMemoryKey{}).(bool)
+	return off
+}
+
+// markNoMemory adds no_memory to the metadata of a message stored with memory turned off,
+// so the embeddings backfill skips it too. Metadata is returned unchanged otherwise.
+func markNoMemory(ctx context.Context, metadata json.RawMessage) json.RawMessage {
+	if !memoryOff(ctx) {
+		return metadata
+	}
+	meta := map[string]any{}
+	if len(metadata) > 0 {
+		_ = json.Unmarshal(metadata, &meta)
+	}
+	meta["no_memory"] = true
+	data, _ := json.Marshal(meta)
+	return data
+}
+
+// indexMessage embeds a stored user or assistant text message in the background, so
+// recall doesn't add latency to the reply. Messages of turns with memory turned off are
+// never embedded.
+func (s *AgentService) indexMessage(ctx context.Context, msg *types.Message) {
+	if s.recall == nil || memoryOff(ctx) || msg.ContentType != "text" || msg.Role == types.RoleSystem || msg.Content == "" {
+		return
+	}
+	stored := *msg
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), indexTimeout)
+		defer cancel()
+		if err := s.recall.Index(ctx, []types.Message{stored}); err != nil {
+			s.logger.WithError(err).WithField("message_id", stored.ID).Warn("failed to index message for recall")
+		}
+	}()
+}
+
+// recallSection renders older messages similar to the incoming one for the system prompt.
+// Only messages older than the window are considered, since the window is already in
+// context. Returns "" when recall is disabled, nothing relevant is found, or it fails.
+func (s *AgentService) recallSection(ctx context.Context, convID uuid.UUID, query string, window *conversationWindow) string {
+	if s.recall == nil || len(window.messages) == 0 {
+		return ""
+	}
+	// Without a summary and with room left in the window, nothing has dropped out of it yet
+	if window.summary == nil && len(window.messages) < s.windowSize {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, recallTimeout)
+	defer cancel()
+	recalled, err := s.recall.Recall(ctx, convID, query, window.messages[0].CreatedAt)
+	if err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("message recall failed")
+		return ""
+	}
+	return BuildRecalledMessages(recalled)
+}
@@ -0,0 +1,245 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/embeddings"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// topicAxes are the dimensions of the fake embedder: a text's vector counts the topic words
+// it contains, plus a small constant so no vector is zero.
+var topicAxes = []string{"address", "swap", "weather"}
+
+// fakeEmbedder embeds text deterministically from topicAxes, recording the texts embedded.
+type fakeEmbedder struct {
+	mu    sync.Mutex
+	texts []string
+	// embedded, when set, receives every batch embedded
+	embedded chan []string
+}
+
+func (f *fakeEmbedder) Embed(_ context.Context, texts []string, _ embeddings.InputType) ([][]float32, error) {
+	f.mu.Lock()
+	f.texts = append(f.texts, texts...)
+	f.mu.Unlock()
+	if f.embedded != nil {
+		f.embedded <- texts
+	}
+
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, len(topicAxes)+1)
+		for j, topic := range topicAxes {
+			v[j] = float32(strings.Count(strings.ToLower(text), topic))
+		}
+		v[len(topicAxes)] = 0.01
+		vectors[i] = v
+	}
+	return vectors, nil
+}
+
+func (f *fakeEmbedder) Model() string { return "fake-embedder" }
+
+// fakeEmbeddingStore searches stored vectors by cosine distance, joining them with the
+// conversation messages it was seeded with.
+type fakeEmbeddingStore struct {
+	messages []types.Message
+
+	mu      sync.Mutex
+	vectors map[uuid.UUID][]float32
+}
+
+func newFakeEmbeddingStore(messages ...types.Message) *fakeEmbeddingStore {
+	return &fakeEmbeddingStore{messages: messages, vectors: make(map[uuid.UUID][]float32)}
+}
+
+func (f *fakeEmbeddingStore) Upsert(_ context.Context, messageID, _ uuid.UUID, _ string, embedding []float32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.vectors[messageID] = embedding
+	return nil
+}
+
+func (f *fakeEmbeddingStore) Search(_ context.Context, convID uuid.UUID, _ string, embedding []float32, before time.Time, limit int) ([]types.RecalledMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var matches []types.RecalledMessage
+	for _, m := range f.messages {
+		v, ok := f.vectors[m.ID]
+		if !ok || m.ConversationID != convID || !m.CreatedAt.Before(before) {
+			continue
+		}
+		matches = append(matches, types.RecalledMessage{ID: m.ID, Role: m.Role, Content: m.Content, CreatedAt: m.CreatedAt, Distance: cosineDistance(embedding, v)})
+	}
+	slices.SortFunc(matches, func(a, b types.RecalledMessage) int {
+		return int(math.Copysign(1, a.Distance-b.Distance))
+	})
+	return matches[:min(limit, len(matches))], nil
+}
+
+func (f *fakeEmbeddingStore) ListWithoutEmbedding(_ context.Context, _ string, limit int) ([]types.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var msgs []types.Message
+	for _, m := range f.messages {
+		if _, ok := f.vectors[m.ID]; !ok && len(msgs) < limit {
+			msgs = append(msgs, m)
+		}
+	}
+	return msgs, nil
+}
+
+func cosineDistance(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	return 1 - dot/math.Sqrt(na*nb)
+}
+
+func TestMessageRecallRecall(t *testing.T) {
+	convID, otherConv := uuid.New(), uuid.New()
+	now := time.Now()
+	message := func(conv uuid.UUID, age time.Duration, content string) types.Message {
+		return types.Message{ID: uuid.New(), ConversationID: conv, Role: types.RoleUser, Content: content, CreatedAt: now.Add(-age)}
+	}
+	swapAddress := message(convID, 30*24*time.Hour, "send the swap output to my address")
+	address := message(convID, 21*24*time.Hour, "my cold storage address is bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq")
+	swap := message(convID, 14*24*time.Hour, "swap eth to usdc every week")
+	weather := message(convID, 7*24*time.Hour, "what is the weather like")
+	inWindow := message(convID, time.Hour, "use the same address as before")
+	foreign := message(otherConv, 21*24*time.Hour, "my address is 0xabc")
+
+	store := newFakeEmbeddingStore(swapAddress, address, swap, weather, inWindow, foreign)
+	recall := &MessageRecall{embedder: &fakeEmbedder{}, repo: store, topK: 3, maxDistance: 0.5, logger: testLogger()}
+	ctx := context.Background()
+	for {
+		n, err := recall.Backfill(ctx, 2)
+		if err != nil {
+			t.Fatalf("Backfill() error = %v", err)
+		}
+		if n == 0 {
+			break
+		}
+	}
+	if len(store.vectors) != 6 {
+		t.Fatalf("backfill embedded %d messages, want 6", len(store.vectors))
+	}
+
+	// The window starts an hour back, so only older messages are candidates
+	got, err := recall.Recall(ctx, convID, "what address did I give you?", now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("Recall() error = %v", err)
+	}
+	var ids []uuid.UUID
+	for _, m := range got {
+		ids = append(ids, m.ID)
+	}
+	// Similar messages only, oldest first: the partly similar one comes before the closest
+	if want := []uuid.UUID{swapAddress.ID, address.ID}; !slices.Equal(ids, want) {
+		t.Errorf("recalled %v, want %v", ids, want)
+	}
+}
+
+func TestMessageRecallIndexScrubs(t *testing.T) {
+	embedder := &fakeEmbedder{}
+	recall := &MessageRecall{embedder: embedder, repo: newFakeEmbeddingStore(), logger: testLogger()}
+	key := strings.Repeat("ab", 32)
+	mnemonic := "abandon ability able about above absent absorb abstract absurd abuse access accident"
+
+	err := recall.Index(context.Background(), []types.Message{
+		{ID: uuid.New(), Content: "my key is " + key},
+		{ID: uuid.New(), Content: "seed: " + mnemonic},
+		{ID: uuid.New(), Content: "swap 1 eth to usdc"},
+	})
+	if err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	want := []string{"my key is " + redactionMarker, "seed: " + redactionMarker, "swap 1 eth to usdc"}
+	if !slices.Equal(embedder.texts, want) {
+		t.Errorf("embedded %q, want %q", embedder.texts, want)
+	}
+}
+
+func TestIndexMessageSkipsNoMemory(t *testing.T) {
+	tests := []struct {
+		name      string
+		noMemory  bool
+		msg       types.Message
+		wantIndex bool
+	}{
+		{name: "text message", msg: types.Message{Role: types.RoleUser, ContentType: "text", Content: "swap eth"}, wantIndex: true},
+		{name: "memory off", noMemory: true, msg: types.Message{Role: types.RoleUser, ContentType: "text", Content: "swap eth"}},
+		{name: "error reply", msg: types.Message{Role: types.RoleAssistant, ContentType: "error", Content: errorReplyContent}},
+		{name: "empty", msg: types.Message{Role: types.RoleAssistant, ContentType: "text"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			embedder := &fakeEmbedder{embedded: make(chan []string, 1)}
+			svc := &AgentService{
+				recall: &MessageRecall{embedder: embedder, repo: newFakeEmbeddingStore(), logger: testLogger()},
+				logger: testLogger(),
+			}
+			ctx := context.Background()
+			if tt.noMemory {
+				ctx = withNoMemory(ctx)
+			}
+			msg := tt.msg
+			msg.ID = uuid.New()
+			svc.indexMessage(ctx, &msg)
+
+			// Indexing runs in the background; a skipped message never reaches the embedder
+			select {
+			case <-embedder.embedded:
+				if !tt.wantIndex {
+					t.Error("message was embedded, want it skipped")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.wantIndex {
+					t.Error("message was not embedded")
+				}
+			}
+		})
+	}
+}
+
+func TestMarkNoMemory(t *testing.T) {
+	tests := []struct {
+		name     string
+		noMemory bool
+		metadata string
+		want     string
+	}{
+		{name: "memory on", metadata: `{"intent":"swap"}`, want: `{"intent":"swap"}`},
+		{name: "memory on without metadata"},
+		{name: "memory off", noMemory: true, metadata: `{"intent":"swap"}`, want: `{"intent":"swap","no_memory":true}`},
+		{name: "memory off without metadata", noMemory: true, want: `{"no_memory":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.noMemory {
+				ctx = withNoMemory(ctx)
+			}
+			var metadata json.RawMessage
+			if tt.metadata != "" {
+				metadata = json.RawMessage(tt.metadata)
+			}
+			if got := string(markNoMemory(ctx, metadata)); got != tt.want {
+				t.Errorf("markNoMemory() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39/wordlists"
+)
+
+// redactionMarker replaces sensitive values scrubbed from persisted text.
+const redactionMarker = "[REDACTED]"
+
+// Sensitive content categories reported by scrubSensitive. Values are never logged.
+const (
+	redactPrivateKeyHex  = "private_key_hex"
+	redactPrivateKeyWIF  = "private_key_wif"
+	redactExtendedKey    = "extended_private_key"
+	redactBase58Secret   = "base58_secret"
+	redactMnemonic       = "mnemonic"
+	redactBearerToken    = "bearer_token"
+	minMnemonicWordCount = 12
+	hexContextLookback   = 24
+)
+
+var (
+	hexKeyRe       = regexp.MustCompile(`\b(?:0x)?[0-9a-fA-F]{64}\b`)
+	wifKeyRe       = regexp.MustCompile(`\b[5KLc][1-9A-HJ-NP-Za-km-z]{50,51}\b`)
+	extendedKeyRe  = regexp.MustCompile(`\b[xyzt]prv[1-9A-HJ-NP-Za-km-z]{100,112}\b`)
+	base58SecretRe = regexp.MustCompile(`\b[1-9A-HJ-NP-Za-km-z]{85,90}\b`)
+	bearerTokenRe  = regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{16,}=*`)
+	jwtRe          = regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)
+	wordRe         = regexp.MustCompile(`[A-Za-z]+`)
+	// hexHashLabelRe matches a transaction or block hash label ending right before a 64-hex
+	// value, allowing only a separator in between ("tx: ", "block hash=", "txid ").
+	hexHashLabelRe = regexp.MustCompile(`(?i)\b(?:tx|txid|txhash|hash|transaction|block)\s*[:=#]?\s*$`)
+	// hexKeyLabelRe matches a key label ending right before a 64-hex value ("key: ",
+	// "private key is ", "pk=").
+	hexKeyLabelRe = regexp.MustCompile(`(?i)\b(?:key|privkey|pk|secret)(?:\s+is)?\s*[:=#]?\s*$`)
+	// mnemonicSepRe matches what may sit between mnemonic words: whitespace, commas, and numbering.
+	mnemonicSepRe = regexp.MustCompile(`^[\s,.\-0-9)]*$`)
+
+	bip39Words = func() map[string]bool {
+		words := make(map[string]bool, len(wordlists.English))
+		for _, w := range wordlists.English {
+			words[w] = true
+		}
+		return words
+	}()
+)
+
+// scrubSensitive replaces private keys, mnemonic phrases, and bearer tokens in text with
+// redactionMarker. It returns the scrubbed text and the distinct categories that were found.
+func scrubSensitive(text string) (string, []string) {
+	var found []string
+	seen := make(map[string]bool)
+	mark := func(category string) {
+		if !seen[category] {
+			seen[category] = true
+			found = append(found, category)
+		}
+	}
+
+	text = replaceMatches(text, extendedKeyRe, redactExtendedKey, mark)
+	text = replaceMatches(text, jwtRe, redactBearerToken, mark)
+	text = replaceMatches(text, bearerTokenRe, redactBearerToken, mark)
+	text = replaceMatches(text, base58SecretRe, redactBase58Secret, mark)
+	text = replaceMatches(text, wifKeyRe, redactPrivateKeyWIF, mark)
+	text = scrubHexKeys(text, mark)
+	text = scrubMnemonics(text, mark)
+
+	return text, found
+}
+
+// replaceMatches replaces every match of re with redactionMarker, recording category when any match.
+func replaceMatches(text string, re *regexp.Regexp, category string, mark func(string)) string {
+	if !re.MatchString(text) {
+		return text
+	}
+	mark(category)
+	return re.ReplaceAllString(text, redactionMarker)
+}
+
+// scrubHexKeys redacts 64-hex values unless they are directly labelled as a transaction
+// or block hash, which share the same shape as raw private keys. A hash word elsewhere
+// in the sentence ("my key for tx signing: ...") does not exempt the value. 0x-prefixed
+// values are how EVM transaction hashes are written, so they are only redacted when
+// directly labelled as a key.
+func scrubHexKeys(text string, mark func(string)) string {
+	matches := hexKeyRe.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		start := max(0, m[0]-hexContextLookback)
+		label := text[start:m[0]]
+		if hexHashLabelRe.MatchString(label) {
+			continue
+		}
+		if strings.HasPrefix(text[m[0]:m[1]], "0x") && !hexKeyLabelRe.MatchString(label) {
+			continue
+		}
+		mark(redactPrivateKeyHex)
+		sb.WriteString(text[last:m[0]])
+		sb.WriteString(redactionMarker)
+		last = m[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// scrubMnemonics redacts runs of minMnemonicWordCount or more consecutive BIP39 words.
+func scrubMnemonics(text string, mark func(string)) string {
+	words := wordRe.FindAllStringIndex(text, -1)
+	if len(words) < minMnemonicWordCount {
+		return text
+	}
+
+	var spans [][2]int
+	runStart := -1
+	flush := func(end int) {
+		if runStart >= 0 && end-runStart >= minMnemonicWordCount {
+			spans = append(spans, [2]int{words[runStart][0], words[end-1][1]})
+		}
+		runStart = -1
+	}
+	for i, w := range words {
+		word := text[w[0]:w[1]]
+		isBIP39 := bip39Words[strings.ToLower(word)]
+		// A run breaks on non-wordlist words or on anything other than list separators.
+		contiguous := i > 0 && mnemonicSepRe.MatchString(text[words[i-1][1]:w[0]])
+		switch {
+		case !isBIP39:
+			flush(i)
+		case runStart < 0:
+			runStart = i
+		case !contiguous:
+			flush(i)
+			runStart = i
+		}
+	}
+	flush(len(words))
+
+	if len(spans) == 0 {
+		return text
+	}
+	mark(redactMnemonic)
+
+	var sb strings.Builder
+	last := 0
+	for _, span := range spans {
+		sb.WriteString(text[last:span[0]])
+		sb.WriteString(redactionMarker)
+		last = span[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
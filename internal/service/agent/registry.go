@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/service/thorchain"
+)
+
+const (
+	// defaultToolTimeout bounds a server-side tool call registered without its own timeout.
+	defaultToolTimeout = 10 * time.Second
+	// maxToolResultBytes caps tool result content sent back to the model.
+	maxToolResultBytes = 16 * 1024
+)
+
+// RequestContext is the per-request state available to server-side tools.
+type RequestContext struct {
+	PublicKey      string
+	ConversationID uuid.UUID
+
+	// quotes collects swap quotes taken during the request, to attach to the response
+	quotes []*thorchain.Quote
+}
+
+// ToolFunc executes a server-side tool call. A non-nil error is returned to the model as an
+// error result: the result itself when one is given, otherwise the error text, so errors
+// must be safe to show the model.
+type ToolFunc func(ctx context.Context, input json.RawMessage, rc *RequestContext) (any, error)
+
+// registeredTool is a tool schema with its handler.
+type registeredTool struct {
+	tool    anthropic.Tool
+	handler ToolFunc
+	timeout time.Duration
+}
+
+// ToolRegistry holds the server-side tools offered to the model, in registration order.
+type ToolRegistry struct {
+	tools  []registeredTool
+	logger *logrus.Logger
+}
+
+// NewToolRegistry creates an empty ToolRegistry.
+func NewToolRegistry(logger *logrus.Logger) *ToolRegistry {
+	return &ToolRegistry{logger: logger}
+}
+
+// Register adds a tool. A zero timeout uses defaultToolTimeout.
+func (r *ToolRegistry) Register(tool anthropic.Tool, handler ToolFunc, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultToolTimeout
+	}
+	r.tools = append(r.tools, registeredTool{tool: tool, handler: handler, timeout: timeout})
+}
+
+// Tools returns the registered tool schemas.
+func (r *ToolRegistry) Tools() []anthropic.Tool {
+	tools := make([]anthropic.Tool, 0, len(r.tools))
+	for _, t := range r.tools {
+		tools = append(tools, t.tool)
+	}
+	return tools
+}
+
+// Handlers binds the registered tools to a request for the tool loop.
+func (r *ToolRegistry) Handlers(rc *RequestContext) map[string]toolHandler {
+	handlers := make(map[string]toolHandler, len(r.tools))
+	for _, t := range r.tools {
+		handlers[t.tool.Name] = func(ctx context.Context, input json.RawMessage) (string, bool) {
+			return r.call(ctx, t, input, rc)
+		}
+	}
+	return handlers
+}
+
+// call runs a tool with its timeout and panic recovery, caps the result size, and records
+// the call's latency and outcome.
+func (r *ToolRegistry) call(ctx context.Context, t registeredTool, input json.RawMessage, rc *RequestContext) (content string, isError bool) {
+	start := time.Now()
+	defer func() {
+		latency := time.Since(start)
+		metrics.ObserveToolCall(t.tool.Name, !isError, latency)
+		r.logger.WithFields(logrus.Fields{
+			"tool_name":  t.tool.Name,
+			"latency_ms": latency.Milliseconds(),
+			"success":    !isError,
+		}).Info("tool call")
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	result, err := r.runToolFunc(ctx, t, input, rc)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Sprintf("%s timed out", t.tool.Name), true
+	}
+	if err != nil && result == nil {
+		return err.Error(), true
+	}
+
+	content, marshalErr := toolResultContent(result)
+	if marshalErr != nil {
+		r.logger.WithError(marshalErr).WithField("tool_name", t.tool.Name).Error("failed to encode tool result")
+		return fmt.Sprintf("%s failed", t.tool.Name), true
+	}
+	if len(content) > maxToolResultBytes {
+		content = strings.ToValidUTF8(content[:maxToolResultBytes], "") + "\n[result truncated]"
+	}
+	return content, err != nil
+}
+
+// runToolFunc calls a tool handler, turning a panic into an error so one faulty tool
+// can't take down the request.
+func (r *ToolRegistry) runToolFunc(ctx context.Context, t registeredTool, input json.RawMessage, rc *RequestContext) (result any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			r.logger.WithField("tool_name", t.tool.Name).Errorf("tool panicked: %v\n%s", p, debug.Stack())
+			result, err = nil, fmt.Errorf("%s failed unexpectedly", t.tool.Name)
+		}
+	}()
+	return t.handler(ctx, input, rc)
+}
+
+// toolResultContent renders a tool result as text: strings as-is, anything else as JSON.
+func toolResultContent(result any) (string, error) {
+	if s, ok := result.(string); ok {
+		return s, nil
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// buildIntentTools registers the server-side tools offered during intent detection, based
+// on which optional services are configured.
+func (s *AgentService) buildIntentTools() *ToolRegistry {
+	registry := NewToolRegistry(s.logger)
+	if s.names != nil {
+		registry.Register(ResolveNameTool, s.resolveNameTool, 0)
+	}
+	if s.explorer != nil {
+		if chains := s.explorer.SupportedChains(); len(chains) > 0 {
+			registry.Register(TransactionStatusTool(chains), s.transactionStatusTool, 0)
+		}
+	}
+	if s.fees != nil {
+		if chains := s.fees.SupportedChains(); len(chains) > 0 {
+			registry.Register(FeeEstimateTool(chains), s.feeEstimateTool, 0)
+		}
+	}
+	if s.quotes != nil {
+		registry.Register(SwapQuoteTool, s.swapQuoteTool, 0)
+	}
+	return registry
+}
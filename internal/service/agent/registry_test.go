@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+func TestToolRegistryCall(t *testing.T) {
+	type quote struct {
+		Amount string `json:"amount"`
+	}
+
+	tests := []struct {
+		name        string
+		handler     ToolFunc
+		timeout     time.Duration
+		want        string
+		wantIsError bool
+	}{
+		{
+			name:    "struct result as JSON",
+			handler: func(context.Context, json.RawMessage, *RequestContext) (any, error) { return quote{Amount: "1.5"}, nil },
+			want:    `{"amount":"1.5"}`,
+		},
+		{
+			name:    "string result as is",
+			handler: func(context.Context, json.RawMessage, *RequestContext) (any, error) { return "vitalik.eth", nil },
+			want:    "vitalik.eth",
+		},
+		{
+			name: "error text",
+			handler: func(context.Context, json.RawMessage, *RequestContext) (any, error) {
+				return nil, errors.New("unsupported chain")
+			},
+			want:        "unsupported chain",
+			wantIsError: true,
+		},
+		{
+			name: "error with a result",
+			handler: func(context.Context, json.RawMessage, *RequestContext) (any, error) {
+				return map[string]string{"error": "no route"}, errors.New("internal detail")
+			},
+			want:        `{"error":"no route"}`,
+			wantIsError: true,
+		},
+		{
+			name: "timeout",
+			handler: func(ctx context.Context, _ json.RawMessage, _ *RequestContext) (any, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			timeout:     10 * time.Millisecond,
+			want:        "test_tool timed out",
+			wantIsError: true,
+		},
+		{
+			name:        "panic",
+			handler:     func(context.Context, json.RawMessage, *RequestContext) (any, error) { panic("nil map") },
+			want:        "test_tool failed unexpectedly",
+			wantIsError: true,
+		},
+		{
+			name:        "unencodable result",
+			handler:     func(context.Context, json.RawMessage, *RequestContext) (any, error) { return make(chan int), nil },
+			want:        "test_tool failed",
+			wantIsError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewToolRegistry(testLogger())
+			r.Register(anthropic.Tool{Name: "test_tool"}, tt.handler, tt.timeout)
+
+			got, isError := r.Handlers(&RequestContext{})["test_tool"](context.Background(), json.RawMessage(`{}`))
+			if got != tt.want || isError != tt.wantIsError {
+				t.Errorf("call = %q (error %v), want %q (error %v)", got, isError, tt.want, tt.wantIsError)
+			}
+		})
+	}
+}
+
+func TestToolRegistryTruncatesResults(t *testing.T) {
+	r := NewToolRegistry(testLogger())
+	// Multi-byte characters straddle the cap
+	long := strings.Repeat("é", maxToolResultBytes)
+	r.Register(anthropic.Tool{Name: "test_tool"}, func(context.Context, json.RawMessage, *RequestContext) (any, error) { return long, nil }, 0)
+
+	got, isError := r.Handlers(&RequestContext{})["test_tool"](context.Background(), nil)
+	if isError {
+		t.Fatalf("call = %q, want a result", got)
+	}
+	content, ok := strings.CutSuffix(got, "\n[result truncated]")
+	if !ok || len(content) > maxToolResultBytes || !utf8.ValidString(content) {
+		t.Errorf("result is %d bytes (marked %v, valid %v), want at most %d valid bytes marked truncated", len(content), ok, utf8.ValidString(content), maxToolResultBytes)
+	}
+}
+
+func TestToolRegistryHandlers(t *testing.T) {
+	r := NewToolRegistry(testLogger())
+	var gotInput string
+	var gotKey string
+	r.Register(anthropic.Tool{Name: "first"}, func(_ context.Context, input json.RawMessage, rc *RequestContext) (any, error) {
+		gotInput, gotKey = string(input), rc.PublicKey
+		return "ok", nil
+	}, 0)
+	r.Register(anthropic.Tool{Name: "second"}, func(context.Context, json.RawMessage, *RequestContext) (any, error) { return "ok", nil }, 0)
+
+	// Schemas keep registration order
+	var names []string
+	for _, tool := range r.Tools() {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); got != "first,second" {
+		t.Errorf("Tools() = %s, want first,second", got)
+	}
+
+	// Each handler runs its own tool with the request's context
+	handlers := r.Handlers(&RequestContext{PublicKey: testOwner})
+	if len(handlers) != 2 {
+		t.Fatalf("Handlers() has %d tools, want 2", len(handlers))
+	}
+	handlers["first"](context.Background(), json.RawMessage(`{"name":"vitalik.eth"}`))
+	if gotInput != `{"name":"vitalik.eth"}` || gotKey != testOwner {
+		t.Errorf("handler got input %s for %q, want the call's input for %q", gotInput, gotKey, testOwner)
+	}
+}
+
+func TestToolRegistryObservesCalls(t *testing.T) {
+	logger, hook := logtest.NewNullLogger()
+	r := NewToolRegistry(logger)
+	r.Register(anthropic.Tool{Name: "observed_tool"}, func(_ context.Context, input json.RawMessage, _ *RequestContext) (any, error) {
+		if string(input) == "fail" {
+			return nil, errors.New("bad input")
+		}
+		return "ok", nil
+	}, 0)
+	call := r.Handlers(&RequestContext{})["observed_tool"]
+
+	call(context.Background(), json.RawMessage("ok"))
+	call(context.Background(), json.RawMessage("fail"))
+	call(context.Background(), json.RawMessage("fail"))
+
+	if got := testutil.ToFloat64(metrics.ToolCalls.WithLabelValues("observed_tool", "true")); got != 1 {
+		t.Errorf("successful calls = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metrics.ToolCalls.WithLabelValues("observed_tool", "false")); got != 2 {
+		t.Errorf("failed calls = %v, want 2", got)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) != 3 {
+		t.Fatalf("logged %d entries, want one per call", len(entries))
+	}
+	last := entries[2]
+	if last.Level != logrus.InfoLevel || last.Data["tool_name"] != "observed_tool" || last.Data["success"] != false {
+		t.Errorf("log entry = %v %v, want tool_name and success=false", last.Level, last.Data)
+	}
+	if _, ok := last.Data["latency_ms"].(int64); !ok {
+		t.Errorf("log entry latency_ms = %v, want milliseconds", last.Data["latency_ms"])
+	}
+}
+
+func TestBuildIntentTools(t *testing.T) {
+	names := func(s *AgentService) string {
+		var out []string
+		for _, tool := range s.buildIntentTools().Tools() {
+			out = append(out, tool.Name)
+		}
+		return strings.Join(out, ",")
+	}
+
+	// Only configured services offer their tools
+	if got := names(&AgentService{logger: testLogger()}); got != "" {
+		t.Errorf("tools without services = %q, want none", got)
+	}
+	s := &AgentService{fees: &fakeFees{}, quotes: &fakeQuoter{quote: testQuote()}, logger: testLogger()}
+	if got, want := names(s), FeeEstimateTool(nil).Name+","+SwapQuoteTool.Name; got != want {
+		t.Errorf("tools = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,332 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// purposeReplay attributes the model calls of offline replays.
+const purposeReplay = "replay"
+
+// ReplayConfig selects the prompt templates and model stored replies are replayed with.
+type ReplayConfig struct {
+	// Model replaces the model replies were generated with; empty uses the client's model
+	Model string
+	// IntentPrompt and PolicyPrompt replace the intent and policy prompt templates; empty
+	// keeps the templates built into this binary
+	IntentPrompt string
+	PolicyPrompt string
+}
+
+// ReplayFilter selects the stored replies to replay.
+type ReplayFilter struct {
+	From time.Time
+	To   time.Time
+	// Intent and PluginID, when set, keep only replies with that intent or about that plugin
+	Intent   string
+	PluginID string
+	Limit    int
+}
+
+// ReplayReply is one side of a replay comparison.
+type ReplayReply struct {
+	Model         string `json:"model,omitempty"`
+	PromptVersion string `json:"prompt_version,omitempty"`
+	Intent        string `json:"intent,omitempty"`
+	Response      string `json:"response"`
+	// PluginIDs are the plugins suggested, or the plugin a policy was built for
+	PluginIDs     []string       `json:"plugin_ids,omitempty"`
+	Configuration map[string]any `json:"configuration,omitempty"`
+}
+
+// ReplayResult compares a stored reply with its replay.
+type ReplayResult struct {
+	ConversationID uuid.UUID    `json:"conversation_id"`
+	MessageID      uuid.UUID    `json:"message_id"`
+	Ability        string       `json:"ability"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Old            ReplayReply  `json:"old"`
+	New            *ReplayReply `json:"new,omitempty"`
+	Usage          *Usage       `json:"usage,omitempty"`
+	// Error is why the reply couldn't be replayed
+	Error string `json:"error,omitempty"`
+}
+
+// replayMetadata is the part of a stored reply's metadata a replay reads.
+type replayMetadata struct {
+	Intent        string         `json:"intent"`
+	PluginID      string         `json:"plugin_id"`
+	Suggestions   []Suggestion   `json:"suggestions"`
+	Configuration map[string]any `json:"configuration"`
+	Generation    generationInfo `json:"generation"`
+}
+
+// Replayer re-runs stored intent and policy replies against other prompt templates or
+// another model, to see how a prompt change alters real answers before shipping it. It only
+// reads: nothing is stored, memory updates and lookups asked for by the model are ignored,
+// and generation stats are left alone.
+//
+// Windows are rebuilt as the service builds them, from the current summary, memory, contacts
+// and plugin skills. Wallet context isn't stored, so replays run without it.
+type Replayer struct {
+	svc *AgentService
+	cfg ReplayConfig
+}
+
+// NewReplayer creates a Replayer. verifierClient is needed to replay policy replies and
+// pluginProvider lists plugins in intent prompts; either may be nil.
+func NewReplayer(
+	anthropicClient *anthropic.Client,
+	msgRepo *postgres.MessageRepository,
+	convRepo *postgres.ConversationRepository,
+	memRepo MemoryStore,
+	contactRepo *postgres.ContactRepository,
+	verifierClient VerifierAPI,
+	pluginProvider PluginSkillsProvider,
+	logger *logrus.Logger,
+	prices config.ModelPrices,
+	ctxCfg config.ContextConfig,
+	agentCfg config.AgentConfig,
+	cfg ReplayConfig,
+) *Replayer {
+	svc := NewAgentService(Deps{
+		Anthropic:     anthropicClient,
+		Messages:      msgRepo,
+		Conversations: convRepo,
+		Memory:        memRepo,
+		Contacts:      contactRepo,
+		Verifier:      verifierClient,
+		Plugins:       pluginProvider,
+		Logger:        logger,
+	}, Settings{Prices: prices, Context: ctxCfg, Agent: agentCfg})
+	return &Replayer{svc: svc, cfg: cfg}
+}
+
+// Sample returns the stored replies f selects, spread over its date range.
+func (r *Replayer) Sample(ctx context.Context, f ReplayFilter) ([]types.Message, error) {
+	return r.svc.msgRepo.ListReplayCandidates(ctx, f.From, f.To, f.Intent, f.PluginID, f.Limit)
+}
+
+// PromptVersion returns the version of the prompt template ability is replayed with.
+func (r *Replayer) PromptVersion(ability string) string {
+	switch {
+	case ability == abilityIntent && r.cfg.IntentPrompt != "":
+		return promptHash(r.cfg.IntentPrompt)
+	case ability == abilityPolicy && r.cfg.PolicyPrompt != "":
+		return promptHash(r.cfg.PolicyPrompt)
+	}
+	return promptVersions[ability]
+}
+
+// Stored returns the comparison for msg, a reply returned by Sample, with only the stored
+// side filled in, as a dry run lists it.
+func (r *Replayer) Stored(msg types.Message) *ReplayResult {
+	var meta replayMetadata
+	_ = json.Unmarshal(msg.Metadata, &meta)
+	return &ReplayResult{
+		ConversationID: msg.ConversationID,
+		MessageID:      msg.ID,
+		Ability:        meta.Generation.Ability,
+		CreatedAt:      msg.CreatedAt,
+		Old: ReplayReply{
+			Model:         meta.Generation.Model,
+			PromptVersion: meta.Generation.PromptVersion,
+			Intent:        meta.Intent,
+			Response:      msg.Content,
+			PluginIDs:     replayPluginIDs(meta.PluginID, meta.Suggestions),
+			Configuration: meta.Configuration,
+		},
+	}
+}
+
+// Replay re-runs msg, a reply returned by Sample. A reply that can't be replayed is
+// reported in the result's Error, so one bad sample doesn't end a run.
+func (r *Replayer) Replay(ctx context.Context, msg types.Message) *ReplayResult {
+	var meta replayMetadata
+	_ = json.Unmarshal(msg.Metadata, &meta)
+	result := r.Stored(msg)
+
+	req, err := r.request(ctx, &msg, &meta)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Model = r.cfg.Model
+
+	ctx = withUsage(ctx)
+	resp, err := r.svc.send(ctx, purposeReplay, req)
+	if usage := turnUsageFrom(ctx); usage != nil {
+		result.Usage = &usage.Reply
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.New = replayReplyFrom(resp)
+	result.New.PromptVersion = r.PromptVersion(result.Ability)
+	if result.Ability == abilityPolicy && len(result.New.PluginIDs) == 0 {
+		result.New.PluginIDs = result.Old.PluginIDs
+	}
+	return result
+}
+
+// request rebuilds the request msg answered, with the replayed prompt template.
+func (r *Replayer) request(ctx context.Context, msg *types.Message, meta *replayMetadata) (*anthropic.Request, error) {
+	if meta.Generation.Ability != abilityIntent && meta.Generation.Ability != abilityPolicy {
+		return nil, fmt.Errorf("replies of ability %q can't be replayed", meta.Generation.Ability)
+	}
+	conv, err := r.svc.convRepo.GetForAdmin(ctx, msg.ConversationID)
+	if err != nil {
+		return nil, fmt.Errorf("get conversation: %w", err)
+	}
+	window, err := r.svc.windowBefore(ctx, conv, msg)
+	if err != nil {
+		return nil, fmt.Errorf("rebuild window: %w", err)
+	}
+
+	if meta.Generation.Ability == abilityIntent {
+		req := r.svc.intentRequest(ctx, conv, window)
+		req.System = withTemplate(req.System, SystemPrompt, r.cfg.IntentPrompt)
+		return req, nil
+	}
+	req, err := r.policyRequest(ctx, conv.PublicKey, window, meta.PluginID)
+	if err != nil {
+		return nil, err
+	}
+	req.System = withTemplate(req.System, PolicyBuilderPrompt, r.cfg.PolicyPrompt)
+	return req, nil
+}
+
+// policyRequest rebuilds a policy builder request for pluginID, with the suggestion the
+// user picked from the window when it is still there. Contact lookups aren't answered in a
+// replay, so the build_policy tool is forced.
+func (r *Replayer) policyRequest(ctx context.Context, publicKey string, window *conversationWindow, pluginID string) (*anthropic.Request, error) {
+	if pluginID == "" {
+		return nil, errors.New("reply names no plugin to build a policy for")
+	}
+	if r.svc.verifier == nil {
+		return nil, errors.New("replaying policy replies needs the verifier")
+	}
+	schema, err := r.svc.verifier.GetRecipeSchema(ctx, pluginID)
+	if err != nil {
+		return nil, fmt.Errorf("get recipe schema: %w", err)
+	}
+	configSchemaJSON, examplesJSON, err := recipeSchemaJSON(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestion := Suggestion{PluginID: pluginID}
+	if found, ok := suggestionInWindow(window, pluginID); ok {
+		suggestion = found
+	}
+	basePrompt := BuildPolicyBuilderPrompt(suggestion, configSchemaJSON, examplesJSON, PromptBalances{}, nil, r.svc.loadContacts(ctx, publicKey))
+	basePrompt += r.svc.loadMemorySection(ctx, publicKey, window)
+
+	return &anthropic.Request{
+		MaxTokens:  r.svc.abilityMaxTokens[abilityPolicy],
+		System:     BuildSystemPromptWithSummary(basePrompt, window.summary),
+		Messages:   endWithUserTurn(anthropicMessagesFromWindow(window)),
+		Tools:      []anthropic.Tool{BuildPolicyTool},
+		ToolChoice: &anthropic.ToolChoice{Type: "tool", Name: BuildPolicyTool.Name},
+	}, nil
+}
+
+// suggestionInWindow returns the latest suggestion of pluginID offered in window.
+func suggestionInWindow(window *conversationWindow, pluginID string) (Suggestion, bool) {
+	for i := len(window.messages) - 1; i >= 0; i-- {
+		var meta struct {
+			Suggestions []Suggestion `json:"suggestions"`
+		}
+		if window.messages[i].Role != types.RoleAssistant || json.Unmarshal(window.messages[i].Metadata, &meta) != nil {
+			continue
+		}
+		for _, sugg := range meta.Suggestions {
+			if sugg.PluginID == pluginID {
+				return sugg, true
+			}
+		}
+	}
+	return Suggestion{}, false
+}
+
+// withTemplate swaps the template system starts with for override, when one is given.
+func withTemplate(system, template, override string) string {
+	if override == "" {
+		return system
+	}
+	if rest, ok := strings.CutPrefix(system, template); ok {
+		return override + rest
+	}
+	return system
+}
+
+// replayReplyFrom reads a replayed reply from the model's response: the respond_to_user
+// or build_policy call, or the text when no tool was called.
+func replayReplyFrom(resp *anthropic.Response) *ReplayReply {
+	reply := &ReplayReply{Model: resp.Model}
+	var texts []string
+	for _, block := range resp.Content {
+		switch {
+		case block.Type == "text":
+			texts = append(texts, block.Text)
+		case block.Type == "tool_use" && block.Name == RespondToUserTool.Name:
+			var tr ToolResponse
+			if decodeToolInput(block.Input, &tr) == nil {
+				reply.Intent = tr.Intent
+				reply.Response = tr.Response
+				for _, sugg := range tr.Suggestions {
+					reply.PluginIDs = append(reply.PluginIDs, sugg.PluginID)
+				}
+			}
+		case block.Type == "tool_use" && block.Name == BuildPolicyTool.Name:
+			var pr PolicyResponse
+			if decodeToolInput(block.Input, &pr) == nil {
+				reply.Response = pr.Explanation
+				reply.Configuration = pr.Configuration
+			}
+		}
+	}
+	if reply.Response == "" {
+		reply.Response = strings.TrimSpace(strings.Join(texts, "\n\n"))
+	}
+	return reply
+}
+
+// decodeToolInput unmarshals a tool call's input into v, leniently when it fails to parse,
+// as the service does, without recording the failure.
+func decodeToolInput(input json.RawMessage, v any) error {
+	err := json.Unmarshal(input, v)
+	if err == nil {
+		return nil
+	}
+	if repaired, ok := repairToolJSON(input); ok && json.Unmarshal(repaired, v) == nil {
+		return nil
+	}
+	return err
+}
+
+// replayPluginIDs lists the plugin a stored reply built a policy for, or else the plugins it
+// suggested.
+func replayPluginIDs(pluginID string, suggestions []Suggestion) []string {
+	if pluginID != "" {
+		return []string{pluginID}
+	}
+	var ids []string
+	for _, sugg := range suggestions {
+		ids = append(ids, sugg.PluginID)
+	}
+	return ids
+}
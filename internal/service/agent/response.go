@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+)
+
+// truncationMarker is appended to responses cut at the length limit.
+const truncationMarker = "…"
+
+var (
+	// dangerousBlockRe matches tags whose content must go too, not just the tags.
+	dangerousBlockRe = regexp.MustCompile(`(?is)<(script|style|iframe|object|embed)\b[^>]*>.*?</(script|style|iframe|object|embed)\s*>`)
+	// tagRe matches HTML/XML-ish tags. Markdown autolinks like <https://...> don't match
+	// because the tag name must be followed by whitespace, "/" or ">".
+	tagRe = regexp.MustCompile(`</?[a-zA-Z][a-zA-Z0-9_-]*(\s[^<>]*)?/?>`)
+	// blankLinesRe matches three or more line breaks, ignoring whitespace-only lines between them.
+	blankLinesRe = regexp.MustCompile(`\n([ \t]*\n){2,}`)
+)
+
+// sanitizeResponse cleans model-produced text before it is stored: it drops invalid UTF-8
+// and control characters, strips HTML/XML tags, collapses runs of blank lines and caps the
+// length at maxChars runes, cutting at a sentence boundary when one is close enough.
+// It reports whether the text was truncated.
+func sanitizeResponse(text string, maxChars int) (string, bool) {
+	text = strings.ToValidUTF8(text, "")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\t' {
+			return r
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+
+	text = dangerousBlockRe.ReplaceAllString(text, "")
+	text = tagRe.ReplaceAllString(text, "")
+	text = blankLinesRe.ReplaceAllString(text, "\n\n")
+	text = strings.TrimSpace(text)
+
+	return truncateAtSentence(text, maxChars)
+}
+
+// truncateAtSentence cuts text to at most maxChars runes, including the marker. It prefers
+// the last sentence or paragraph end in the second half of the allowed length and falls
+// back to the last word boundary.
+func truncateAtSentence(text string, maxChars int) (string, bool) {
+	runes := []rune(text)
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return text, false
+	}
+
+	limit := maxChars - len([]rune(truncationMarker))
+	if limit <= 0 {
+		return truncationMarker, true
+	}
+	cut := runes[:limit]
+
+	end := -1
+	for i := len(cut) - 1; i >= limit/2; i-- {
+		if isSentenceEnd(cut, i) {
+			end = i + 1
+			break
+		}
+	}
+	if end < 0 {
+		for i := len(cut) - 1; i >= limit/2; i-- {
+			if unicode.IsSpace(cut[i]) {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		end = len(cut)
+	}
+
+	return strings.TrimRightFunc(string(cut[:end]), unicode.IsSpace) + truncationMarker, true
+}
+
+// isSentenceEnd reports whether runes[i] ends a sentence: a newline, CJK full stop, or
+// terminal punctuation followed by whitespace.
+func isSentenceEnd(runes []rune, i int) bool {
+	switch runes[i] {
+	case '\n', '。', '！', '？':
+		return true
+	case '.', '!', '?':
+		return i+1 < len(runes) && unicode.IsSpace(runes[i+1])
+	}
+	return false
+}
+
+// processResponse sanitizes a model response with the configured length limit.
+func (s *AgentService) processResponse(text string) (string, bool) {
+	return sanitizeResponse(text, s.maxResponseChars)
+}
+
+// contentBlocks converts model output to response content blocks. Text is sanitized like the
+// flattened reply; other block types are dropped.
+func (s *AgentService) contentBlocks(resp *anthropic.Response) []ContentBlock {
+	var blocks []ContentBlock
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			if text, _ := s.processResponse(block.Text); text != "" {
+				blocks = append(blocks, ContentBlock{Type: "text", Text: text})
+			}
+		case "tool_use":
+			blocks = append(blocks, ContentBlock{Type: "tool_use", Name: block.Name, Input: block.Input})
+		}
+	}
+	return blocks
+}
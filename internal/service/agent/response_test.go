@@ -0,0 +1,195 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+)
+
+func TestSanitizeResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		maxChars      int
+		want          string
+		wantTruncated bool
+	}{
+		{
+			name:     "plain text untouched",
+			text:     "Your vault holds 1.5 ETH.",
+			maxChars: 4000,
+			want:     "Your vault holds 1.5 ETH.",
+		},
+		{
+			name:     "emoji kept",
+			text:     "Done 🎉 Your swap to 🟠 BTC is on its way 👨‍👩‍👧",
+			maxChars: 4000,
+			want:     "Done 🎉 Your swap to 🟠 BTC is on its way 👨‍👩‍👧",
+		},
+		{
+			name:          "emoji counted as runes when truncating",
+			text:          strings.Repeat("🚀", 10),
+			maxChars:      5,
+			want:          "🚀🚀🚀🚀…",
+			wantTruncated: true,
+		},
+		{
+			name:     "cjk kept",
+			text:     "你好！您的金库里有 1.5 ETH。",
+			maxChars: 4000,
+			want:     "你好！您的金库里有 1.5 ETH。",
+		},
+		{
+			name:          "cjk cut at a full stop",
+			text:          "第一句话。第二句话。第三句话很长很长。",
+			maxChars:      12,
+			want:          "第一句话。第二句话。…",
+			wantTruncated: true,
+		},
+		{
+			name:     "nested markdown kept",
+			text:     "**Plan**\n\n> - _Weekly_ buy of **`0.05 ETH`**\n>   1. [docs](https://docs.vultisig.com)\n\n<https://vultisig.com>",
+			maxChars: 4000,
+			want:     "**Plan**\n\n> - _Weekly_ buy of **`0.05 ETH`**\n>   1. [docs](https://docs.vultisig.com)\n\n<https://vultisig.com>",
+		},
+		{
+			name:     "tags stripped inside markdown",
+			text:     "**Note:** <b>bold</b> and <thinking>hidden plan</thinking> <br/>done",
+			maxChars: 4000,
+			want:     "**Note:** bold and hidden plan done",
+		},
+		{
+			name:     "script blocks removed with their content",
+			text:     "Hi<script type=\"text/javascript\">alert(1)</script> there<STYLE>p{}</STYLE>.",
+			maxChars: 4000,
+			want:     "Hi there.",
+		},
+		{
+			name:     "pathological whitespace",
+			text:     " \r\n\t Line one\r\n\r\n \t \r\n\n\n\n   \nLine two\u0000\u0007 \n\n\n",
+			maxChars: 4000,
+			want:     "Line one\n\nLine two",
+		},
+		{
+			name:     "invalid utf-8 dropped",
+			text:     "Send \xff\xfe0.5 ETH",
+			maxChars: 4000,
+			want:     "Send 0.5 ETH",
+		},
+		{
+			name:          "cut at the last sentence",
+			text:          "First sentence. Second sentence. Third sentence runs long.",
+			maxChars:      40,
+			want:          "First sentence. Second sentence.…",
+			wantTruncated: true,
+		},
+		{
+			name:          "cut at a word without a sentence end",
+			text:          "one two three four five six seven eight nine ten",
+			maxChars:      20,
+			want:          "one two three four…",
+			wantTruncated: true,
+		},
+		{
+			name:     "no limit",
+			text:     strings.Repeat("a", 5000),
+			maxChars: 0,
+			want:     strings.Repeat("a", 5000),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := sanitizeResponse(tt.text, tt.maxChars)
+			if got != tt.want || truncated != tt.wantTruncated {
+				t.Errorf("sanitizeResponse(%q, %d) = %q, %v; want %q, %v", tt.text, tt.maxChars, got, truncated, tt.want, tt.wantTruncated)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("sanitizeResponse(%q) returned invalid UTF-8", tt.text)
+			}
+			if tt.maxChars > 0 && utf8.RuneCountInString(got) > tt.maxChars {
+				t.Errorf("sanitizeResponse(%q) is %d runes, over the limit %d", tt.text, utf8.RuneCountInString(got), tt.maxChars)
+			}
+		})
+	}
+}
+
+func TestProcessMessageContentBlocks(t *testing.T) {
+	respond := toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "general_question",
+		"response": "You hold 1.5 ETH.",
+	}).Content[0]
+	texts := func(texts ...string) []anthropic.ContentBlock {
+		var blocks []anthropic.ContentBlock
+		for _, text := range texts {
+			blocks = append(blocks, anthropic.ContentBlock{Type: "text", Text: text})
+		}
+		return blocks
+	}
+
+	tests := []struct {
+		name        string
+		content     []anthropic.ContentBlock
+		include     bool
+		wantContent string
+		wantBlocks  []ContentBlock
+	}{
+		{
+			name:        "text around a tool call",
+			content:     []anthropic.ContentBlock{texts("Let me check your vault.")[0], respond, texts("Anything \x07else?")[0]},
+			include:     true,
+			wantContent: "You hold 1.5 ETH.",
+			wantBlocks: []ContentBlock{
+				{Type: "text", Text: "Let me check your vault."},
+				{Type: "tool_use", Name: RespondToUserTool.Name, Input: respond.Input},
+				{Type: "text", Text: "Anything else?"},
+			},
+		},
+		{
+			name:        "several text blocks",
+			content:     texts("ETH is the native coin of Ethereum.", "  ", "It pays for gas."),
+			include:     true,
+			wantContent: "ETH is the native coin of Ethereum.\n\nIt pays for gas.",
+			wantBlocks: []ContentBlock{
+				{Type: "text", Text: "ETH is the native coin of Ethereum."},
+				{Type: "text", Text: "It pays for gas."},
+			},
+		},
+		{
+			name:        "not requested",
+			content:     []anthropic.ContentBlock{texts("Let me check your vault.")[0], respond},
+			wantContent: "You hold 1.5 ETH.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newConversationService(&fakeModel{resp: &anthropic.Response{StopReason: "end_turn", Content: tt.content}})
+
+			resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey:            testOwner,
+				Content:              "how much eth do i have?",
+				IncludeContentBlocks: tt.include,
+			})
+			if err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+
+			// The flat content stays for clients that don't read the blocks
+			if resp.Message.Content != tt.wantContent {
+				t.Errorf("content = %q, want %q", resp.Message.Content, tt.wantContent)
+			}
+			if !reflect.DeepEqual(resp.ContentBlocks, tt.wantBlocks) {
+				got, _ := json.Marshal(resp.ContentBlocks)
+				want, _ := json.Marshal(tt.wantBlocks)
+				t.Errorf("content_blocks = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ErrMessageNotRetryable is returned by RetryMessage for messages that aren't user text
+// messages, such as assistant replies or action results.
+var ErrMessageNotRetryable = errors.New("only user text messages can be retried")
+
+// ErrMessageAlreadyReplied is returned by RetryMessage when the message already has a reply,
+// or later messages follow it.
+var ErrMessageAlreadyReplied = errors.New("message already has a reply")
+
+// RetryMessage answers a stored user message again after its reply failed, without storing
+// the message a second time. req carries the wallet context and options for the new reply;
+// its content is replaced by the stored message. Only the conversation's last user message
+// can be retried, and only while it is followed by nothing but failed or aborted replies,
+// which are deleted before the new reply is generated.
+func (s *AgentService) RetryMessage(ctx context.Context, convID, messageID uuid.UUID, req *SendMessageRequest) (out *SendMessageResponse, err error) {
+	start := time.Now()
+	ctx, done := s.inflight.start(ctx, convID)
+	defer done()
+	ctx = withWrites(withUsage(withGeneration(ctx)))
+	defer func() {
+		if err != nil && aborted(ctx) {
+			err = ErrGenerationAborted
+		}
+		err = observeMessage(abilityIntent, start, err)
+		s.reportUsage(ctx, convID, out)
+		reportWrites(ctx, out)
+	}()
+
+	if req.Context != nil {
+		req.Context.NormalizeAddresses()
+	}
+
+	// The lock also keeps two retries of the same message from both answering it
+	unlock, err := s.lockConversation(ctx, convID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := s.ensureConversation(ctx, convID, req.PublicKey); err != nil {
+		return nil, err
+	}
+
+	msg, err := s.msgRepo.GetByID(ctx, convID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Role != types.RoleUser || msg.ContentType != "text" {
+		return nil, ErrMessageNotRetryable
+	}
+
+	later, err := s.msgRepo.GetSince(ctx, convID, msg.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("get later messages: %w", err)
+	}
+	for _, m := range later {
+		if !failedReply(m) {
+			return nil, ErrMessageAlreadyReplied
+		}
+	}
+	for _, m := range later {
+		if err := s.convRepo.DeleteMessage(ctx, convID, m.ID, req.PublicKey); err != nil {
+			return nil, fmt.Errorf("delete failed reply: %w", err)
+		}
+	}
+
+	window, err := s.getConversationWindow(ctx, convID, req.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("get conversation window: %w", err)
+	}
+	window.noMemory = req.NoMemory
+	if !window.noMemory {
+		if window.noMemory, err = s.convRepo.NoMemory(ctx, convID, req.PublicKey); err != nil {
+			return nil, fmt.Errorf("get conversation memory setting: %w", err)
+		}
+	}
+	if window.noMemory {
+		ctx = withNoMemory(ctx)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"conversation_id": convID,
+		"message_id":      messageID,
+		"failed_replies":  len(later),
+	}).Info("retrying message")
+
+	// The message's images are sent again; if they are gone, answering without them would
+	// miss the point of the question
+	images, err := s.loadAttachments(ctx, req.PublicKey, attachmentIDs(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Content = msg.Content
+	req.SelectedSuggestionID = nil
+	req.ActionResult = nil
+	return s.answerIntent(ctx, convID, req, window, msg.ID, withImages(endWithUserTurn(anthropicMessagesFromWindow(window)), images))
+}
+
+// failedReply reports whether msg is the placeholder left by a failed or aborted reply.
+func failedReply(msg types.Message) bool {
+	return msg.Role == types.RoleAssistant && (msg.ContentType == "error" || msg.Content == "")
+}
@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// retryConversationStore deletes messages from a fakeMessageStore, recording the deletes.
+type retryConversationStore struct {
+	*fakeConversationStore
+	msgs    *fakeMessageStore
+	deleted []uuid.UUID
+}
+
+func (f *retryConversationStore) DeleteMessage(_ context.Context, _, messageID uuid.UUID, _ string) error {
+	f.deleted = append(f.deleted, messageID)
+	f.msgs.messages = slices.DeleteFunc(f.msgs.messages, func(m types.Message) bool { return m.ID == messageID })
+	return nil
+}
+
+func TestRetryMessage(t *testing.T) {
+	base := time.Now().Add(-time.Hour)
+	// history is a conversation whose last reply failed
+	history := func() []types.Message {
+		msgs := []types.Message{
+			{Role: types.RoleUser, ContentType: "text", Content: "hi"},
+			{Role: types.RoleAssistant, ContentType: "text", Content: "hello"},
+			{Role: types.RoleUser, ContentType: "text", Content: "swap eth"},
+			{Role: types.RoleAssistant, ContentType: "error", Content: "I couldn't generate a response. Tap to retry."},
+		}
+		for i := range msgs {
+			msgs[i].ID = uuid.New()
+			msgs[i].CreatedAt = base.Add(time.Duration(i) * time.Minute)
+		}
+		return msgs
+	}
+
+	tests := []struct {
+		name string
+		// retry is the index of the retried message, -1 for one that doesn't exist
+		retry     int
+		publicKey string
+		change    func([]types.Message) []types.Message
+		wantErr   error
+	}{
+		{name: "failed reply", retry: 2},
+		{
+			name:  "aborted reply",
+			retry: 2,
+			change: func(m []types.Message) []types.Message {
+				m[3].ContentType, m[3].Content = "text", ""
+				return m
+			},
+		},
+		{name: "no reply yet", retry: 2, change: func(m []types.Message) []types.Message { return m[:3] }},
+		{name: "already replied", retry: 0, wantErr: ErrMessageAlreadyReplied},
+		{
+			name:  "reply after the failed one",
+			retry: 2,
+			change: func(m []types.Message) []types.Message {
+				return append(m, types.Message{ID: uuid.New(), Role: types.RoleUser, ContentType: "text", Content: "hello?", CreatedAt: base.Add(time.Hour)})
+			},
+			wantErr: ErrMessageAlreadyReplied,
+		},
+		{name: "assistant message", retry: 1, wantErr: ErrMessageNotRetryable},
+		{
+			name:  "action result",
+			retry: 2,
+			change: func(m []types.Message) []types.Message {
+				m[2].ContentType = "action_result"
+				return m
+			},
+			wantErr: ErrMessageNotRetryable,
+		},
+		{name: "missing message", retry: -1, wantErr: postgres.ErrNotFound},
+		{name: "someone else's conversation", retry: 2, publicKey: "someone-else", wantErr: postgres.ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgs := history()
+			if tt.change != nil {
+				msgs = tt.change(msgs)
+			}
+			messageID := uuid.New()
+			if tt.retry >= 0 {
+				messageID = msgs[tt.retry].ID
+			}
+			before := slices.Clone(msgs)
+
+			model := &fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+				"intent":   "swap",
+				"response": "Which chain?",
+			})}
+			svc, store := newConversationService(model)
+			store.messages = msgs
+			convs := &retryConversationStore{fakeConversationStore: svc.convRepo.(*fakeConversationStore), msgs: store}
+			svc.convRepo = convs
+
+			resp, err := svc.RetryMessage(context.Background(), uuid.New(), messageID, &SendMessageRequest{
+				PublicKey: cmp.Or(tt.publicKey, testOwner),
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RetryMessage() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				if len(model.requests) != 0 || len(store.stored()) != 0 || len(convs.deleted) != 0 {
+					t.Errorf("model requests = %d, stored = %d, deleted = %d; want the conversation untouched",
+						len(model.requests), len(store.stored()), len(convs.deleted))
+				}
+				if !slices.EqualFunc(store.messages, before, func(a, b types.Message) bool { return a.ID == b.ID }) {
+					t.Error("conversation messages changed")
+				}
+				return
+			}
+
+			if resp.Message.Content != "Which chain?" {
+				t.Errorf("reply = %q, want the new answer", resp.Message.Content)
+			}
+			// The failed reply is replaced and the user message isn't stored again
+			if want := before[tt.retry+1:]; !slices.Equal(convs.deleted, ids(want)) {
+				t.Errorf("deleted %v, want the replies after the retried message %v", convs.deleted, ids(want))
+			}
+			stored := store.stored()
+			if len(stored) != 1 || stored[0].Role != types.RoleAssistant {
+				t.Errorf("stored %d messages, want only the new reply", len(stored))
+			}
+
+			if len(model.requests) != 1 {
+				t.Fatalf("model got %d requests, want 1", len(model.requests))
+			}
+			sent := model.requests[0].Messages
+			last := sent[len(sent)-1]
+			if last.Role != "user" || !strings.Contains(fmt.Sprint(last.Content), "swap eth") {
+				t.Errorf("last model message = %s %v, want the stored user message", last.Role, last.Content)
+			}
+			for _, m := range sent {
+				if strings.Contains(fmt.Sprint(m.Content), "Tap to retry") {
+					t.Error("the failed reply was sent to the model")
+				}
+			}
+		})
+	}
+}
+
+// ids returns the ids of msgs.
+func ids(msgs []types.Message) []uuid.UUID {
+	out := make([]uuid.UUID, 0, len(msgs))
+	for _, m := range msgs {
+		out = append(out, m.ID)
+	}
+	return out
+}
@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// statsTTL is how long a user's aggregated stats are cached.
+const statsTTL = 1 * time.Minute
+
+// statsConfidenceDays is how many days of reply confidence the stats report.
+const statsConfidenceDays = 30
+
+// statsKey is the Redis key caching a user's aggregated stats.
+func statsKey(publicKey string) string {
+	return fmt.Sprintf("stats:%s", publicKey)
+}
+
+// UserStats returns the user's conversation, message and automation counts, the date of
+// their first conversation, and the model's daily intent confidence on their replies over
+// the last statsConfidenceDays. Results are cached briefly.
+func (s *AgentService) UserStats(ctx context.Context, publicKey string) (*types.UserStats, error) {
+	if cached, err := s.redis.Get(ctx, statsKey(publicKey)); err == nil && cached != "" {
+		var stats types.UserStats
+		if err := json.Unmarshal([]byte(cached), &stats); err == nil {
+			return &stats, nil
+		}
+	}
+
+	// Automations are policies the app reported as created, stored as action results
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -statsConfidenceDays+1)
+	stats, err := s.convRepo.Stats(ctx, publicKey, "create_policy", since)
+	if err != nil {
+		return nil, err
+	}
+
+	if data, err := json.Marshal(stats); err == nil {
+		if err := s.redis.Set(ctx, statsKey(publicKey), string(data), statsTTL); err != nil {
+			s.logger.WithError(err).Warn("failed to cache user stats")
+		}
+	}
+	return stats, nil
+}
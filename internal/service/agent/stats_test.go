@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestUserStats(t *testing.T) {
+	day := time.Now().UTC().Truncate(24 * time.Hour)
+	tests := []struct {
+		name  string
+		stats *types.UserStats
+	}{
+		{name: "new user", stats: &types.UserStats{}},
+		{
+			name: "active user",
+			stats: &types.UserStats{
+				Conversations: 3,
+				Messages:      42,
+				Automations:   2,
+				Topics:        map[string]int64{"dca": 2},
+				Confidence:    []types.DailyConfidence{{Day: day, Replies: 5, Average: 0.82}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			convs := &fakeConversationStore{stats: tt.stats}
+			s := &AgentService{convRepo: convs, redis: newFakeCache(), logger: testLogger()}
+
+			// The second call is served from the cache
+			for range 2 {
+				got, err := s.UserStats(context.Background(), testOwner)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Conversations != tt.stats.Conversations || got.Automations != tt.stats.Automations || len(got.Confidence) != len(tt.stats.Confidence) {
+					t.Errorf("UserStats() = %+v, want %+v", got, tt.stats)
+				}
+			}
+
+			if len(convs.statsCalls) != 1 {
+				t.Fatalf("Stats called %d times, want 1", len(convs.statsCalls))
+			}
+			call := convs.statsCalls[0]
+			if call.automationAction != "create_policy" {
+				t.Errorf("automations counted for %q, want create_policy", call.automationAction)
+			}
+			if want := day.AddDate(0, 0, -statsConfidenceDays+1); !call.confidenceSince.Equal(want) {
+				t.Errorf("confidence since %v, want %v", call.confidenceSince, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// RefreshSuggestions checks suggestions embedded in assistant message metadata against Redis
+// when a conversation is reloaded. Expired suggestions from messages newer than the rehydrate
+// window are re-stored under their original ids with a fresh TTL; older ones are flagged as
+// expired in the returned metadata so the app can disable them. Messages are updated in place.
+// Redis is checked and written in one batch each, however many suggestions there are.
+func (s *AgentService) RefreshSuggestions(ctx context.Context, messages []types.Message) {
+	type embedded struct {
+		msg         *types.Message
+		meta        map[string]json.RawMessage
+		suggestions []Suggestion
+		rehydrate   bool
+	}
+
+	now := time.Now()
+	var found []embedded
+	var keys []string
+	for i := range messages {
+		msg := &messages[i]
+		if msg.Role != types.RoleAssistant || len(msg.Metadata) == 0 {
+			continue
+		}
+
+		var meta map[string]json.RawMessage
+		if err := json.Unmarshal(msg.Metadata, &meta); err != nil {
+			continue
+		}
+		raw, ok := meta["suggestions"]
+		if !ok {
+			continue
+		}
+		var suggestions []Suggestion
+		if err := json.Unmarshal(raw, &suggestions); err != nil || len(suggestions) == 0 {
+			continue
+		}
+
+		found = append(found, embedded{
+			msg:         msg,
+			meta:        meta,
+			suggestions: suggestions,
+			rehydrate:   now.Sub(msg.CreatedAt) <= s.rehydrateWindow,
+		})
+		for _, sugg := range suggestions {
+			keys = append(keys, sugg.ID)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+
+	exists, err := s.redis.ExistsMany(ctx, keys)
+	if err != nil {
+		// Redis unavailable — leave suggestions as stored rather than graying out valid ones
+		s.logger.WithError(err).Warn("failed to check suggestion expiry")
+		return
+	}
+
+	// Missing suggestions are re-issued when recent enough, the rest are flagged expired
+	restore := make(map[string]string)
+	var restored, expired []*Suggestion
+	k := 0
+	for i := range found {
+		for j := range found[i].suggestions {
+			sugg := &found[i].suggestions[j]
+			present := exists[k]
+			k++
+			if present {
+				continue
+			}
+			if found[i].rehydrate {
+				if suggJSON, err := json.Marshal(sugg); err == nil {
+					restore[sugg.ID] = string(suggJSON)
+					restored = append(restored, sugg)
+					continue
+				}
+			}
+			expired = append(expired, sugg)
+		}
+	}
+	if len(restore) > 0 {
+		if err := s.redis.SetMany(ctx, restore, suggestionTTL); err != nil {
+			s.logger.WithError(err).Warn("failed to rehydrate suggestions")
+			expired = append(expired, restored...)
+		}
+	}
+	if len(expired) == 0 {
+		return
+	}
+	for _, sugg := range expired {
+		sugg.Expired = true
+	}
+
+	for _, e := range found {
+		if !slices.ContainsFunc(e.suggestions, func(sugg Suggestion) bool { return sugg.Expired }) {
+			continue
+		}
+		encoded, err := json.Marshal(e.suggestions)
+		if err != nil {
+			continue
+		}
+		e.meta["suggestions"] = encoded
+		if updated, err := json.Marshal(e.meta); err == nil {
+			e.msg.Metadata = updated
+		}
+	}
+}
+
+// suggestionActivity is the suggestion-related part of assistant message metadata.
+type suggestionActivity struct {
+	Type        string       `json:"type"`
+	PluginID    string       `json:"plugin_id"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// pendingSuggestions returns the suggestions offered in msgs that weren't acted on, in the
+// order they were offered, along with the plugins a policy was built for. A suggestion is
+// acted on once a later policy is built for its plugin; a plugin offered again keeps only
+// its latest suggestion.
+func pendingSuggestions(msgs []types.Message) (pending []Suggestion, actedOn []string) {
+	for _, msg := range msgs {
+		if msg.Role != types.RoleAssistant || len(msg.Metadata) == 0 {
+			continue
+		}
+		var meta suggestionActivity
+		if err := json.Unmarshal(msg.Metadata, &meta); err != nil {
+			continue
+		}
+		if meta.Type == "policy_ready" && meta.PluginID != "" {
+			pending = dropPluginSuggestion(pending, meta.PluginID)
+			actedOn = append(actedOn, meta.PluginID)
+			continue
+		}
+		for _, sugg := range meta.Suggestions {
+			pending = append(dropPluginSuggestion(pending, sugg.PluginID), sugg)
+		}
+	}
+	return pending, actedOn
+}
+
+// dropPluginSuggestion removes the suggestion for pluginID, if any.
+func dropPluginSuggestion(suggestions []Suggestion, pluginID string) []Suggestion {
+	out := suggestions[:0]
+	for _, sugg := range suggestions {
+		if sugg.PluginID != pluginID {
+			out = append(out, sugg)
+		}
+	}
+	return out
+}
+
+// summarySuggestionsSection tells the summarizer which suggestions offered in the messages
+// being summarized are still open, so they outlive the window. Suggestions acted on in the
+// recent messages are left out, and every plugin acted on is listed so the summarizer can
+// drop it from the previous summary. Returns an empty string when there is nothing to report.
+func summarySuggestionsSection(summarized, recent []types.Message) string {
+	pending, actedOn := pendingSuggestions(summarized)
+	_, actedRecently := pendingSuggestions(recent)
+	for _, pluginID := range actedRecently {
+		pending = dropPluginSuggestion(pending, pluginID)
+	}
+	actedOn = append(actedOn, actedRecently...)
+
+	var sb strings.Builder
+	if len(pending) > 0 {
+		sb.WriteString("\n\n## Suggestions Not Acted On\n\n")
+		for _, sugg := range pending {
+			fmt.Fprintf(&sb, "- %s: %s\n", sugg.PluginID, sugg.Title)
+		}
+	}
+	if len(actedOn) > 0 {
+		sb.WriteString("\n\n## Suggestions Acted On\n\n")
+		for _, pluginID := range actedOn {
+			fmt.Fprintf(&sb, "- %s\n", pluginID)
+		}
+	}
+	return sb.String()
+}
+
+// gateSuggestions drops the tool response's suggestions when the model reported a
+// confidence below the configured minimum, returning them as withheld suggestions the app can
+// mention in the user's language. It returns nil when the suggestions stand, including when the
+// model gave no confidence.
+func (s *AgentService) gateSuggestions(toolResp *ToolResponse) []WithheldSuggestion {
+	if s.minSuggestionConf <= 0 || toolResp.Confidence == nil || len(toolResp.Suggestions) == 0 {
+		return nil
+	}
+	if *toolResp.Confidence >= s.minSuggestionConf {
+		return nil
+	}
+
+	withheld := make([]WithheldSuggestion, 0, len(toolResp.Suggestions))
+	for _, ts := range toolResp.Suggestions {
+		withheld = append(withheld, WithheldSuggestion{PluginID: ts.PluginID, Title: ts.Title})
+	}
+	toolResp.Suggestions = nil
+	return withheld
+}
+
+// applyIntentConfidence applies the confidence the model reported in its intent. Below the
+// clarify threshold the suggestions are dropped and the model's clarifying question is
+// returned for the app to show, unless the reply already ends with one; below the tentative
+// threshold the suggestions stand but are flagged tentative. A missing confidence leaves the
+// response alone.
+func (s *AgentService) applyIntentConfidence(toolResp *ToolResponse) (clarifying string, tentative bool) {
+	if toolResp.Confidence == nil {
+		return "", false
+	}
+	confidence := *toolResp.Confidence
+	metrics.IntentConfidence.WithLabelValues(toolResp.Intent).Observe(confidence)
+
+	switch {
+	case confidence < s.clarifyConf:
+		if len(toolResp.Suggestions) == 0 {
+			return "", false
+		}
+		toolResp.Suggestions = nil
+		if strings.HasSuffix(strings.TrimSpace(toolResp.Response), "?") {
+			return "", false
+		}
+		return strings.TrimSpace(toolResp.ClarifyingQuestion), false
+	case confidence < s.tentativeConf:
+		return "", true
+	}
+	return "", false
+}
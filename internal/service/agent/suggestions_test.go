@@ -0,0 +1,364 @@
+package agent
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestGateSuggestions(t *testing.T) {
+	dca := ToolSuggestion{PluginID: "dca", Title: "Recurring buy"}
+	payroll := ToolSuggestion{PluginID: "payroll", Title: "Payroll"}
+
+	tests := []struct {
+		name            string
+		minConfidence   float64
+		confidence      *float64
+		suggestions     []ToolSuggestion
+		wantWithheld    []WithheldSuggestion
+		wantSuggestions int
+	}{
+		{
+			name:            "gate disabled",
+			confidence:      ptr(0.1),
+			suggestions:     []ToolSuggestion{dca},
+			wantSuggestions: 1,
+		},
+		{
+			name:            "no confidence reported",
+			minConfidence:   0.6,
+			suggestions:     []ToolSuggestion{dca},
+			wantSuggestions: 1,
+		},
+		{
+			name:            "confident enough",
+			minConfidence:   0.6,
+			confidence:      ptr(0.6),
+			suggestions:     []ToolSuggestion{dca, payroll},
+			wantSuggestions: 2,
+		},
+		{
+			name:          "below the minimum",
+			minConfidence: 0.6,
+			confidence:    ptr(0.3),
+			suggestions:   []ToolSuggestion{dca, payroll},
+			wantWithheld: []WithheldSuggestion{
+				{PluginID: "dca", Title: "Recurring buy"},
+				{PluginID: "payroll", Title: "Payroll"},
+			},
+		},
+		{
+			name:          "nothing to gate",
+			minConfidence: 0.6,
+			confidence:    ptr(0.3),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AgentService{minSuggestionConf: tt.minConfidence}
+			toolResp := &ToolResponse{Response: "Sure.", Suggestions: tt.suggestions, Confidence: tt.confidence}
+
+			withheld := s.gateSuggestions(toolResp)
+			if !slices.Equal(withheld, tt.wantWithheld) {
+				t.Errorf("gateSuggestions() = %v, want %v", withheld, tt.wantWithheld)
+			}
+			if len(toolResp.Suggestions) != tt.wantSuggestions {
+				t.Errorf("%d suggestions left, want %d", len(toolResp.Suggestions), tt.wantSuggestions)
+			}
+			if toolResp.Response != "Sure." {
+				t.Errorf("response changed to %q", toolResp.Response)
+			}
+		})
+	}
+}
+
+func TestApplyIntentConfidence(t *testing.T) {
+	tests := []struct {
+		name            string
+		confidence      *float64
+		response        string
+		question        string
+		wantClarifying  string
+		wantTentative   bool
+		wantSuggestions int
+	}{
+		{name: "no confidence", wantSuggestions: 1},
+		{name: "at the tentative threshold", confidence: ptr(0.7), wantSuggestions: 1},
+		{name: "just below the tentative threshold", confidence: ptr(0.69), wantTentative: true, wantSuggestions: 1},
+		{name: "at the clarify threshold", confidence: ptr(0.4), wantTentative: true, wantSuggestions: 1},
+		{name: "below the clarify threshold", confidence: ptr(0.39), question: "Which asset?", wantClarifying: "Which asset?"},
+		{name: "below the clarify threshold, question padded", confidence: ptr(0.2), question: "  Welches Asset?\n", wantClarifying: "Welches Asset?"},
+		{name: "below the clarify threshold without a question", confidence: ptr(0.1)},
+		{name: "reply already asks", confidence: ptr(0.1), response: "Which asset do you mean?", question: "Which asset?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &AgentService{clarifyConf: 0.4, tentativeConf: 0.7}
+			response := cmp.Or(tt.response, "Here is how that works.")
+			toolResp := &ToolResponse{
+				Intent:             "action_request",
+				Response:           response,
+				Suggestions:        []ToolSuggestion{{PluginID: "dca", Title: "Recurring buy"}},
+				Confidence:         tt.confidence,
+				ClarifyingQuestion: tt.question,
+			}
+
+			clarifying, tentative := s.applyIntentConfidence(toolResp)
+			if clarifying != tt.wantClarifying || tentative != tt.wantTentative {
+				t.Errorf("applyIntentConfidence() = %q, %v, want %q, %v", clarifying, tentative, tt.wantClarifying, tt.wantTentative)
+			}
+			if len(toolResp.Suggestions) != tt.wantSuggestions {
+				t.Errorf("%d suggestions left, want %d", len(toolResp.Suggestions), tt.wantSuggestions)
+			}
+		})
+	}
+}
+
+func TestProcessMessageClarifyingQuestion(t *testing.T) {
+	svc, msgs := newConversationService(&fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":              "action_request",
+		"response":            "Ich kann beim Tauschen helfen.",
+		"suggestions":         []map[string]any{{"plugin_id": "dca", "title": "Sparplan", "description": "Wöchentlich kaufen"}},
+		"confidence":          0.2,
+		"clarifying_question": "Welches Asset möchtest du tauschen?",
+	})})
+	svc.clarifyConf, svc.tentativeConf = 0.4, 0.7
+
+	resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "tauschen",
+	})
+	if err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+
+	// The question is returned apart from the reply, which stays as the model wrote it
+	if resp.ClarifyingQuestion != "Welches Asset möchtest du tauschen?" {
+		t.Errorf("ClarifyingQuestion = %q, want the model's question", resp.ClarifyingQuestion)
+	}
+	if len(resp.Suggestions) != 0 {
+		t.Errorf("got %d suggestions, want them replaced by the question", len(resp.Suggestions))
+	}
+	stored := msgs.stored()
+	reply := stored[len(stored)-1]
+	if reply.Content != "Ich kann beim Tauschen helfen." {
+		t.Errorf("stored reply = %q, want the model's response unchanged", reply.Content)
+	}
+	var meta struct {
+		ClarifyingQuestion string `json:"clarifying_question"`
+	}
+	if err := json.Unmarshal(reply.Metadata, &meta); err != nil {
+		t.Fatalf("decode reply metadata: %v", err)
+	}
+	if meta.ClarifyingQuestion != resp.ClarifyingQuestion {
+		t.Errorf("stored clarifying_question = %q, want %q", meta.ClarifyingQuestion, resp.ClarifyingQuestion)
+	}
+}
+
+// batchCache counts single-key and batched suggestion reads and writes, and can fail the batches.
+type batchCache struct {
+	*fakeCache
+	existsErr, setErr error
+	single, batches   int
+}
+
+func (c *batchCache) Exists(ctx context.Context, key string) (bool, error) {
+	c.single++
+	return c.fakeCache.Exists(ctx, key)
+}
+
+func (c *batchCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	c.single++
+	return c.fakeCache.Set(ctx, key, value, ttl)
+}
+
+func (c *batchCache) ExistsMany(ctx context.Context, keys []string) ([]bool, error) {
+	c.batches++
+	if c.existsErr != nil {
+		return nil, c.existsErr
+	}
+	return c.fakeCache.ExistsMany(ctx, keys)
+}
+
+func (c *batchCache) SetMany(ctx context.Context, values map[string]string, ttl time.Duration) error {
+	c.batches++
+	if c.setErr != nil {
+		return c.setErr
+	}
+	return c.fakeCache.SetMany(ctx, values, ttl)
+}
+
+func TestRefreshSuggestions(t *testing.T) {
+	kept := Suggestion{ID: "sugg-kept", PluginID: "dca", Title: "Recurring buy"}
+	recent := Suggestion{ID: "sugg-recent", PluginID: "payroll", Title: "Payroll"}
+	old := Suggestion{ID: "sugg-old", PluginID: "dca", Title: "Recurring buy"}
+
+	conversation := func() []types.Message {
+		withSuggestions := func(age time.Duration, suggestions ...Suggestion) types.Message {
+			meta, _ := json.Marshal(map[string]any{"suggestions": suggestions})
+			return types.Message{Role: types.RoleAssistant, Metadata: meta, CreatedAt: time.Now().Add(-age)}
+		}
+		return []types.Message{
+			{Role: types.RoleUser, Content: "what can I automate?"},
+			withSuggestions(2*time.Hour, old),
+			withSuggestions(time.Minute, kept, recent),
+		}
+	}
+	expired := func(messages []types.Message) map[string]bool {
+		out := make(map[string]bool)
+		for _, msg := range messages {
+			var meta struct {
+				Suggestions []Suggestion `json:"suggestions"`
+			}
+			_ = json.Unmarshal(msg.Metadata, &meta)
+			for _, sugg := range meta.Suggestions {
+				out[sugg.ID] = sugg.Expired
+			}
+		}
+		return out
+	}
+
+	tests := []struct {
+		name        string
+		existsErr   error
+		setErr      error
+		wantExpired map[string]bool
+		wantStored  []string
+		wantBatches int
+	}{
+		{
+			name:        "recent suggestions reissued after their TTL",
+			wantExpired: map[string]bool{"sugg-kept": false, "sugg-recent": false, "sugg-old": true},
+			wantStored:  []string{"sugg-kept", "sugg-recent"},
+			wantBatches: 2,
+		},
+		{
+			name:        "redis unavailable",
+			existsErr:   errors.New("connection refused"),
+			wantExpired: map[string]bool{"sugg-kept": false, "sugg-recent": false, "sugg-old": false},
+			wantStored:  []string{"sugg-kept"},
+			wantBatches: 1,
+		},
+		{
+			name:        "reissue fails",
+			setErr:      errors.New("connection reset"),
+			wantExpired: map[string]bool{"sugg-kept": false, "sugg-recent": true, "sugg-old": true},
+			wantStored:  []string{"sugg-kept"},
+			wantBatches: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &batchCache{fakeCache: newFakeCache(), existsErr: tt.existsErr, setErr: tt.setErr}
+			s := &AgentService{redis: cache, logger: testLogger(), rehydrateWindow: time.Hour}
+
+			// All three were issued; only the first is still within its TTL
+			for _, sugg := range []Suggestion{kept, recent, old} {
+				data, _ := json.Marshal(sugg)
+				_ = cache.fakeCache.Set(context.Background(), sugg.ID, string(data), suggestionTTL)
+			}
+			_ = cache.fakeCache.Delete(context.Background(), recent.ID)
+			_ = cache.fakeCache.Delete(context.Background(), old.ID)
+
+			messages := conversation()
+			s.RefreshSuggestions(context.Background(), messages)
+
+			if got := expired(messages); !maps.Equal(got, tt.wantExpired) {
+				t.Errorf("expired = %v, want %v", got, tt.wantExpired)
+			}
+			stored := slices.Sorted(maps.Keys(cache.values))
+			if !slices.Equal(stored, tt.wantStored) {
+				t.Errorf("stored suggestions = %v, want %v", stored, tt.wantStored)
+			}
+			if cache.single != 0 || cache.batches != tt.wantBatches {
+				t.Errorf("cache calls = %d single, %d batched; want 0 single, %d batched", cache.single, cache.batches, tt.wantBatches)
+			}
+			if tt.existsErr != nil || tt.setErr != nil {
+				return
+			}
+
+			var reissued Suggestion
+			if err := json.Unmarshal([]byte(cache.values[recent.ID]), &reissued); err != nil || reissued != recent {
+				t.Errorf("reissued suggestion = %+v (%v), want %+v", reissued, err, recent)
+			}
+
+			// Reloading again finds the reissued suggestion and keeps the old one expired
+			s.RefreshSuggestions(context.Background(), messages)
+			if got := expired(messages); !maps.Equal(got, tt.wantExpired) {
+				t.Errorf("expired after second reload = %v, want %v", got, tt.wantExpired)
+			}
+		})
+	}
+}
+
+func TestProcessMessageSuggestionRationale(t *testing.T) {
+	long := strings.Repeat("you hold idle ETH ", 20)
+	svc, msgs := newConversationService(&fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "action_request",
+		"response": "A recurring swap can put your idle ETH to work.",
+		"suggestions": []map[string]any{
+			{"plugin_id": testPluginID, "title": "Weekly ETH", "description": "Buy ETH every week", "rationale": "  you hold 2 ETH idle "},
+			{"plugin_id": "vultisig-payroll-0000", "title": "Payroll", "description": "Pay your team", "rationale": long},
+			{"plugin_id": "vultisig-recurring-sends-0000", "title": "Send USDC", "description": "Send USDC every Friday"},
+		},
+	})})
+	svc.outbox = &fakeOutbox{cache: svc.redis}
+	ctx := context.Background()
+
+	resp, err := svc.ProcessMessage(ctx, uuid.New(), testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "what should I do with my ETH?",
+	})
+	if err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+	if len(resp.Suggestions) != 3 {
+		t.Fatalf("got %d suggestions, want 3", len(resp.Suggestions))
+	}
+
+	// The rationale is trimmed and kept short; without one none is made up
+	want := []string{"you hold 2 ETH idle", truncateWords(strings.TrimSpace(long), maxSuggestionRationale), ""}
+	for i, sugg := range resp.Suggestions {
+		if sugg.Rationale != want[i] {
+			t.Errorf("suggestion %d rationale = %q, want %q", i, sugg.Rationale, want[i])
+		}
+	}
+	if n := utf8.RuneCountInString(resp.Suggestions[1].Rationale); n > maxSuggestionRationale+1 {
+		t.Errorf("long rationale kept %d characters, want at most %d", n, maxSuggestionRationale)
+	}
+
+	// It is stored with the suggestion for the policy build and in the message for reloads
+	stored, err := svc.getSuggestion(ctx, resp.Suggestions[0].ID)
+	if err != nil {
+		t.Fatalf("getSuggestion() error = %v", err)
+	}
+	if stored.Rationale != want[0] {
+		t.Errorf("stored suggestion rationale = %q, want %q", stored.Rationale, want[0])
+	}
+	created := msgs.stored()
+	var meta struct {
+		Suggestions []Suggestion `json:"suggestions"`
+	}
+	if err := json.Unmarshal(created[len(created)-1].Metadata, &meta); err != nil || len(meta.Suggestions) != 3 || meta.Suggestions[0].Rationale != want[0] {
+		t.Errorf("message metadata = %s, want the suggestions with their rationale", created[len(created)-1].Metadata)
+	}
+
+	// The tool schema offers the field
+	props := RespondToUserTool.InputSchema.(map[string]any)["properties"].(map[string]any)
+	items := props["suggestions"].(map[string]any)["items"].(map[string]any)
+	if _, ok := items["properties"].(map[string]any)["rationale"]; !ok {
+		t.Error("respond_to_user suggestions have no rationale property")
+	}
+}
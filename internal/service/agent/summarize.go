@@ -0,0 +1,76 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ErrSummarizationDisabled is returned by SummarizeConversation while the summarization
+// kill switch is off.
+var ErrSummarizationDisabled = errors.New("summarization is disabled")
+
+// SummarizeResult is the outcome of an on-demand summarization.
+type SummarizeResult struct {
+	// Summarized is false when the unsummarized messages already fit in the context window
+	Summarized bool    `json:"summarized"`
+	Summary    *string `json:"summary,omitempty"`
+	// MessagesSummarized is how many messages were folded into the summary
+	MessagesSummarized int `json:"messages_summarized"`
+}
+
+// SummarizeConversation folds every message outside the recent window into the conversation
+// summary, regardless of the summarize trigger. It holds the conversation lock so it can't
+// race a message on the summary cursor. When the messages since the last summary fit in the
+// window nothing is summarized and the existing summary, if any, is returned.
+func (s *AgentService) SummarizeConversation(ctx context.Context, convID uuid.UUID, publicKey string) (*SummarizeResult, error) {
+	if !s.summarizationEnabled(ctx) {
+		return nil, ErrSummarizationDisabled
+	}
+	if err := s.ensureConversation(ctx, convID, publicKey); err != nil {
+		return nil, err
+	}
+
+	unlock, err := s.lockConversation(ctx, convID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	summary, cursor, err := s.convRepo.GetSummaryWithCursor(ctx, convID, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("get summary with cursor: %w", err)
+	}
+
+	var msgs []types.Message
+	if cursor != nil {
+		msgs, err = s.msgRepo.GetSince(ctx, convID, *cursor)
+	} else {
+		msgs, err = s.msgRepo.GetByConversationID(ctx, convID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get messages: %w", err)
+	}
+
+	if len(msgs) <= s.windowSize {
+		return &SummarizeResult{Summary: summary}, nil
+	}
+
+	if err := s.summarizeOldMessages(ctx, convID, publicKey, msgs); err != nil {
+		return nil, fmt.Errorf("summarize conversation: %w", err)
+	}
+
+	summary, _, err = s.convRepo.GetSummaryWithCursor(ctx, convID, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("get summary after summarization: %w", err)
+	}
+	return &SummarizeResult{
+		Summarized:         true,
+		Summary:            summary,
+		MessagesSummarized: len(msgs) - s.windowSize,
+	}, nil
+}
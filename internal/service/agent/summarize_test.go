@@ -0,0 +1,381 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// longConversation returns n alternating user and assistant messages a minute apart.
+func longConversation(n int, start time.Time) []types.Message {
+	msgs := make([]types.Message, n)
+	for i := range msgs {
+		role := types.RoleUser
+		if i%2 == 1 {
+			role = types.RoleAssistant
+		}
+		msgs[i] = types.Message{
+			ID:          uuid.New(),
+			Role:        role,
+			Content:     fmt.Sprintf("msg-%05d", i),
+			ContentType: "text",
+			CreatedAt:   start.Add(time.Duration(i) * time.Minute),
+		}
+	}
+	return msgs
+}
+
+// newSummaryService returns a service over msgs with a 20 message window that summarizes
+// past 40 messages, summarizing in chunks of chunkSize when set.
+func newSummaryService(model ModelClient, convs *fakeConversationStore, msgs []types.Message, chunkSize int) *AgentService {
+	return NewAgentService(Deps{
+		Anthropic:     model,
+		Messages:      &fakeMessageStore{messages: msgs, total: len(msgs)},
+		Conversations: convs,
+		Cache:         newFakeCache(),
+		Logger:        testLogger(),
+	}, Settings{
+		Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 10000, HardMaxMessages: 10000, SummaryChunkSize: chunkSize},
+	})
+}
+
+func TestGetConversationWindowSummaryFailure(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	msgs := longConversation(3000, start)
+	existing := "The user set up a DCA policy."
+	cursor := msgs[999].CreatedAt
+
+	tests := []struct {
+		name        string
+		summary     *string
+		cursor      *time.Time
+		wantSummary *string
+		wantTotal   int
+	}{
+		{
+			name:      "first summarization",
+			wantTotal: 3000,
+		},
+		{
+			name:        "resummarization keeps the previous summary",
+			summary:     &existing,
+			cursor:      &cursor,
+			wantSummary: &existing,
+			wantTotal:   20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &fakeModel{err: errors.New("anthropic: overloaded_error: Overloaded")}
+			convs := &fakeConversationStore{owner: testOwner, summary: tt.summary, cursor: tt.cursor}
+			s := newSummaryService(model, convs, msgs, 0)
+
+			window, err := s.getConversationWindow(context.Background(), uuid.New(), testOwner)
+			if err != nil {
+				t.Fatalf("getConversationWindow() error = %v, want the recent window", err)
+			}
+			if len(model.requests) != 1 {
+				t.Errorf("model got %d requests, want the one failed summarization", len(model.requests))
+			}
+			// Older context is dropped rather than sending every message
+			if !reflect.DeepEqual(window.messages, msgs[len(msgs)-20:]) {
+				t.Errorf("window has %d messages from %q, want the 20 most recent", len(window.messages), window.messages[0].Content)
+			}
+			if !reflect.DeepEqual(window.summary, tt.wantSummary) {
+				t.Errorf("window summary = %v, want %v", window.summary, tt.wantSummary)
+			}
+			if window.total != tt.wantTotal {
+				t.Errorf("window total = %d, want %d", window.total, tt.wantTotal)
+			}
+			if len(convs.summaryUpdates) != 0 {
+				t.Errorf("stored %d summaries, want none after a failure", len(convs.summaryUpdates))
+			}
+		})
+	}
+}
+
+// chunkModel answers the nth summarization call with "summary n", failing call failAt.
+type chunkModel struct {
+	failAt  int
+	prompts []string
+}
+
+func (m *chunkModel) SendMessage(_ context.Context, req *anthropic.Request) (*anthropic.Response, error) {
+	m.prompts = append(m.prompts, req.Messages[0].Content.(string))
+	n := len(m.prompts)
+	if n == m.failAt {
+		return nil, errors.New("anthropic: overloaded_error: Overloaded")
+	}
+	return &anthropic.Response{Content: []anthropic.ContentBlock{{Type: "text", Text: fmt.Sprintf("summary %d", n)}}}, nil
+}
+
+func TestSummarizeOldMessagesChunked(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 4980 messages fall outside the window: nine chunks of 500 and one of 480
+	msgs := longConversation(5000, start)
+	chunkEnds := []int{499, 999, 1499, 1999, 2499, 2999, 3499, 3999, 4499, 4979}
+
+	tests := []struct {
+		name      string
+		failAt    int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "every chunk summarized", wantCalls: 10},
+		{name: "failure keeps earlier chunks", failAt: 4, wantCalls: 4, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &chunkModel{failAt: tt.failAt}
+			convs := &fakeConversationStore{owner: testOwner}
+			s := newSummaryService(model, convs, msgs, 500)
+
+			err := s.summarizeOldMessages(context.Background(), uuid.New(), testOwner, msgs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("summarizeOldMessages() error = %v, want error %v", err, tt.wantErr)
+			}
+			if len(model.prompts) != tt.wantCalls {
+				t.Fatalf("model got %d summarization calls, want %d", len(model.prompts), tt.wantCalls)
+			}
+
+			from := 0
+			for i, prompt := range model.prompts {
+				end := chunkEnds[i]
+				// Each call covers only its own chunk, folded into the previous summary
+				if !strings.Contains(prompt, msgs[from].Content) || !strings.Contains(prompt, msgs[end].Content) {
+					t.Errorf("call %d prompt is missing messages %d-%d", i+1, from, end)
+				}
+				if from > 0 && strings.Contains(prompt, msgs[from-1].Content+"\n") {
+					t.Errorf("call %d prompt repeats message %d of the previous chunk", i+1, from-1)
+				}
+				if strings.Contains(prompt, msgs[end+1].Content+"\n") {
+					t.Errorf("call %d prompt includes message %d of the next chunk", i+1, end+1)
+				}
+				if i > 0 && !strings.Contains(prompt, fmt.Sprintf("## Previous Summary\n\nsummary %d\n", i)) {
+					t.Errorf("call %d prompt doesn't build on summary %d", i+1, i)
+				}
+				from = end + 1
+			}
+
+			// The cursor advances as each chunk is stored
+			stored := tt.wantCalls
+			if tt.wantErr {
+				stored--
+			}
+			var wantCursors []time.Time
+			for _, end := range chunkEnds[:stored] {
+				wantCursors = append(wantCursors, msgs[end].CreatedAt)
+			}
+			if !reflect.DeepEqual(convs.summaryUpdates, wantCursors) {
+				t.Errorf("summary cursors = %v, want %v", convs.summaryUpdates, wantCursors)
+			}
+			if want := fmt.Sprintf("summary %d", stored); convs.summary == nil || *convs.summary != want {
+				t.Errorf("stored summary = %v, want %q", convs.summary, want)
+			}
+		})
+	}
+}
+
+func TestSummarizeKeepsPendingSuggestions(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	msgs := longConversation(60, start)
+	offer := func(suggestions ...Suggestion) json.RawMessage {
+		meta, _ := json.Marshal(map[string]any{"suggestions": suggestions})
+		return meta
+	}
+	// The DCA offer is repeated with a new title, the payroll offer is taken up in the recent
+	// window, and the send offer is taken up before the window scrolls
+	msgs[1].Metadata = offer(
+		Suggestion{ID: "sugg-1", PluginID: "vultisig-dca-0000", Title: "Buy ETH weekly"},
+		Suggestion{ID: "sugg-2", PluginID: "vultisig-payroll-0000", Title: "Pay your team monthly"},
+	)
+	msgs[3].Metadata = offer(Suggestion{ID: "sugg-3", PluginID: "vultisig-recurring-sends-0000", Title: "Send USDC every Friday"})
+	msgs[5].Metadata = json.RawMessage(`{"type":"policy_ready","plugin_id":"vultisig-recurring-sends-0000"}`)
+	msgs[7].Metadata = offer(Suggestion{ID: "sugg-4", PluginID: "vultisig-dca-0000", Title: "Buy ETH every Monday"})
+	msgs[55].Metadata = json.RawMessage(`{"type":"policy_ready","plugin_id":"vultisig-payroll-0000"}`)
+
+	model := &chunkModel{}
+	convs := &fakeConversationStore{owner: testOwner}
+	s := newSummaryService(model, convs, msgs, 0)
+
+	if err := s.summarizeOldMessages(context.Background(), uuid.New(), testOwner, msgs); err != nil {
+		t.Fatalf("summarizeOldMessages() error = %v", err)
+	}
+	if len(model.prompts) != 1 {
+		t.Fatalf("model got %d summarization calls, want 1", len(model.prompts))
+	}
+	prompt := model.prompts[0]
+	if !strings.Contains(prompt, "Pending suggestions:") {
+		t.Error("summary prompt doesn't ask for pending suggestions")
+	}
+	_, section, ok := strings.Cut(prompt, "## Suggestions Not Acted On\n\n")
+	if !ok {
+		t.Fatalf("summary prompt lists no pending suggestions:\n%s", prompt)
+	}
+	pending, acted, _ := strings.Cut(section, "## Suggestions Acted On\n\n")
+	// Only the latest DCA offer is pending; the others were acted on
+	if want := "- vultisig-dca-0000: Buy ETH every Monday\n\n\n"; pending != want {
+		t.Errorf("pending suggestions = %q, want %q", pending, want)
+	}
+	if want := "- vultisig-recurring-sends-0000\n- vultisig-payroll-0000\n"; acted != want {
+		t.Errorf("acted on = %q, want %q", acted, want)
+	}
+
+	// Once the offers have scrolled out, the next summarization still sees them through the
+	// stored summary
+	convs.summary = ptr("The user asked about DCA.\nPending suggestions: vultisig-dca-0000: Buy ETH every Monday")
+	later := longConversation(60, start.Add(time.Hour))
+	if err := s.summarizeOldMessages(context.Background(), uuid.New(), testOwner, later); err != nil {
+		t.Fatalf("summarizeOldMessages() error = %v", err)
+	}
+	prompt = model.prompts[1]
+	if !strings.Contains(prompt, "## Previous Summary\n\nThe user asked about DCA.\nPending suggestions: vultisig-dca-0000: Buy ETH every Monday") {
+		t.Errorf("second summary prompt lost the pending suggestion:\n%s", prompt)
+	}
+	if strings.Contains(prompt, "## Suggestions") {
+		t.Errorf("second summary prompt lists suggestions without any offered:\n%s", prompt)
+	}
+}
+
+func TestSummarizeConversation(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	existing := "The user asked about DCA."
+
+	tests := []struct {
+		name string
+		msgs []types.Message
+		// held is set when another request holds the conversation lock
+		held       bool
+		wantErr    error
+		wantResult *SummarizeResult
+		wantStored bool
+	}{
+		{
+			name:       "long conversation",
+			msgs:       longConversation(30, start),
+			wantResult: &SummarizeResult{Summarized: true, Summary: ptr("summary 1"), MessagesSummarized: 10},
+			wantStored: true,
+		},
+		{
+			name:       "shorter than the window",
+			msgs:       longConversation(20, start),
+			wantResult: &SummarizeResult{Summary: &existing},
+		},
+		{
+			name:    "conversation busy",
+			msgs:    longConversation(30, start),
+			held:    true,
+			wantErr: ErrConversationBusy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &chunkModel{}
+			convs := &fakeConversationStore{owner: testOwner, summary: &existing}
+			s := newSummaryService(model, convs, tt.msgs, 0)
+			s.lockWait = 10 * time.Millisecond
+			convID := uuid.New()
+			if tt.held {
+				unlock, err := s.lockConversation(context.Background(), convID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer unlock()
+			}
+
+			got, err := s.SummarizeConversation(context.Background(), convID, testOwner)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SummarizeConversation() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.wantResult) {
+				t.Errorf("SummarizeConversation() = %+v, want %+v", got, tt.wantResult)
+			}
+
+			// The summary is persisted with the cursor at the last summarized message
+			if !tt.wantStored {
+				if len(model.prompts) != 0 || len(convs.summaryUpdates) != 0 {
+					t.Errorf("got %d summarization calls and %d stored summaries, want none", len(model.prompts), len(convs.summaryUpdates))
+				}
+				return
+			}
+			if !strings.Contains(model.prompts[0], "## Previous Summary\n\n"+existing) {
+				t.Error("summarization didn't build on the existing summary")
+			}
+			if want := []time.Time{tt.msgs[9].CreatedAt}; !reflect.DeepEqual(convs.summaryUpdates, want) {
+				t.Errorf("summary cursors = %v, want %v", convs.summaryUpdates, want)
+			}
+		})
+	}
+
+	t.Run("other owner", func(t *testing.T) {
+		s := newSummaryService(&chunkModel{}, &fakeConversationStore{owner: testOwner}, longConversation(30, start), 0)
+		if _, err := s.SummarizeConversation(context.Background(), uuid.New(), "someone-else"); !errors.Is(err, postgres.ErrNotFound) {
+			t.Errorf("SummarizeConversation() error = %v, want %v", err, postgres.ErrNotFound)
+		}
+	})
+}
+
+func TestSummarizeCustomPrompt(t *testing.T) {
+	const custom = "Summarize as short bullets. Leave out amounts."
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	msgs := longConversation(30, start)
+
+	tests := []struct {
+		name       string
+		prompt     string
+		wantPrompt string
+	}{
+		{name: "custom template", prompt: custom, wantPrompt: custom},
+		{name: "surrounding space trimmed", prompt: "\n" + custom + "  ", wantPrompt: custom},
+		{name: "default", wantPrompt: SummarizationPrompt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &chunkModel{}
+			convs := &fakeConversationStore{owner: testOwner, summary: ptr("- wants weekly ETH buys")}
+			s := NewAgentService(Deps{
+				Anthropic:     model,
+				Messages:      &fakeMessageStore{messages: msgs, total: len(msgs)},
+				Conversations: convs,
+				Cache:         newFakeCache(),
+				Logger:        testLogger(),
+			}, Settings{
+				Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 10000, HardMaxMessages: 10000, SummaryPrompt: tt.prompt},
+			})
+
+			if err := s.summarizeOldMessages(context.Background(), uuid.New(), testOwner, msgs); err != nil {
+				t.Fatalf("summarizeOldMessages() error = %v", err)
+			}
+			if len(model.prompts) != 1 {
+				t.Fatalf("model got %d summarization calls, want 1", len(model.prompts))
+			}
+
+			// The template leads, and the previous summary is still folded in ahead of the
+			// new messages
+			want := tt.wantPrompt + "\n\n## Previous Summary\n\n- wants weekly ETH buys\n\n## Messages to Summarize\n\n[user]: msg-00000\n\n"
+			if prompt := model.prompts[0]; !strings.HasPrefix(prompt, want) || !strings.Contains(prompt, "msg-00009") || strings.Contains(prompt, "msg-00010") {
+				t.Errorf("prompt = %q, want it to start with %q and cover messages 0-9", prompt, want)
+			}
+			if tt.wantPrompt == custom && strings.Contains(model.prompts[0], SummarizationPrompt) {
+				t.Error("prompt still includes the built-in instructions")
+			}
+			if convs.summary == nil || *convs.summary != "summary 1" {
+				t.Errorf("stored summary = %v, want %q", convs.summary, "summary 1")
+			}
+		})
+	}
+}
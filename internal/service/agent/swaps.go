@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/numfmt"
+	"github.com/vultisig/agent-backend/internal/service/thorchain"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// thorchainPrefixes maps normalized chain names to THORChain chain identifiers.
+var thorchainPrefixes = map[string]string{
+	"ethereum":    "ETH",
+	"bitcoin":     "BTC",
+	"bitcoincash": "BCH",
+	"litecoin":    "LTC",
+	"dogecoin":    "DOGE",
+	"bsc":         "BSC",
+	"avalanche":   "AVAX",
+	"base":        "BASE",
+	"cosmos":      "GAIA",
+	"gaiachain":   "GAIA",
+	"thorchain":   "THOR",
+	"ripple":      "XRP",
+	"tron":        "TRX",
+}
+
+// swapQuoteInput is the input of the get_swap_quote tool.
+type swapQuoteInput struct {
+	FromAsset string `json:"from_asset"`
+	ToAsset   string `json:"to_asset"`
+	Amount    string `json:"amount"`
+}
+
+// pairNotSupportedResult is the structured tool result for pairs THORChain can't quote.
+type pairNotSupportedResult struct {
+	Error     string `json:"error"` // "pair_not_supported"
+	FromAsset string `json:"from_asset"`
+	ToAsset   string `json:"to_asset"`
+	Message   string `json:"message"`
+}
+
+// swapQuoteTool answers get_swap_quote calls. Successful quotes are recorded on the request
+// context so the response can carry them as cards showing when they were taken.
+func (s *AgentService) swapQuoteTool(ctx context.Context, input json.RawMessage, rc *RequestContext) (any, error) {
+	var in swapQuoteInput
+	if err := json.Unmarshal(input, &in); err != nil || in.FromAsset == "" || in.ToAsset == "" || in.Amount == "" {
+		return nil, errors.New("from_asset, to_asset and amount are required")
+	}
+
+	quote, err := s.quotes.Quote(ctx, in.FromAsset, in.ToAsset, in.Amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, thorchain.ErrPairNotSupported):
+			return pairNotSupportedResult{
+				Error:     "pair_not_supported",
+				FromAsset: in.FromAsset,
+				ToAsset:   in.ToAsset,
+				Message:   "THORChain can't quote this pair; tell the user instead of estimating.",
+			}, err
+		case errors.Is(err, thorchain.ErrInvalidAmount):
+			return nil, err
+		}
+		s.logger.WithError(err).WithField("pair", in.FromAsset+"->"+in.ToAsset).Warn("swap quote failed")
+		return nil, errors.New("could not get a swap quote right now")
+	}
+
+	rc.quotes = append(rc.quotes, quote)
+	return quote, nil
+}
+
+// quoteBlock renders a swap quote as a card, so the app can show when it was taken next to
+// the reply. Amounts are human-readable in each asset's units; quoted_at is RFC 3339 UTC.
+func quoteBlock(quote *thorchain.Quote) types.Block {
+	rows := []types.KeyValue{
+		{Key: "from", Value: quote.FromAsset},
+		{Key: "to", Value: quote.ToAsset},
+		{Key: "amount in", Value: quote.AmountIn},
+		{Key: "expected out", Value: quote.ExpectedAmountOut},
+		{Key: "total fee", Value: quote.Fees.Total + " " + quote.Fees.Asset},
+		{Key: "slippage bps", Value: strconv.Itoa(quote.Fees.SlippageBps)},
+	}
+	if quote.RecommendedMinAmountIn != "" {
+		rows = append(rows, types.KeyValue{Key: "recommended min amount in", Value: quote.RecommendedMinAmountIn})
+	}
+	if quote.Warning != "" {
+		rows = append(rows, types.KeyValue{Key: "warning", Value: quote.Warning})
+	}
+	rows = append(rows, types.KeyValue{Key: "quoted at", Value: quote.QuotedAt.UTC().Format(time.RFC3339)})
+	return types.Block{
+		Type:  types.BlockTypeKeyValueTable,
+		Title: "Swap quote",
+		Rows:  rows,
+	}
+}
+
+// quoteBlocks renders the quotes taken during a request, one card each.
+func quoteBlocks(quotes []*thorchain.Quote) []types.Block {
+	var blocks []types.Block
+	for _, q := range quotes {
+		blocks = append(blocks, quoteBlock(q))
+	}
+	return blocks
+}
+
+// expectedOutcome describes what a swap policy's configuration would return at current
+// THORChain rates, with the quote it is based on. It must run before fromAmount is converted
+// to base units. Returns "" and nil when the configuration isn't a swap THORChain can quote.
+func (s *AgentService) expectedOutcome(ctx context.Context, configuration map[string]any, balances []Balance, format numfmt.Formatter) (string, *thorchain.Quote) {
+	if s.quotes == nil {
+		return "", nil
+	}
+	amount, ok := configuration["fromAmount"]
+	if !ok {
+		return "", nil
+	}
+	from, _ := configuration["from"].(map[string]any)
+	to, _ := configuration["to"].(map[string]any)
+	fromAsset, ok := thorchainAsset(from, balances)
+	if !ok {
+		return "", nil
+	}
+	toAsset, ok := thorchainAsset(to, balances)
+	if !ok {
+		return "", nil
+	}
+
+	quote, err := s.quotes.Quote(ctx, fromAsset, toAsset, fmt.Sprintf("%v", amount))
+	if err != nil {
+		if !errors.Is(err, thorchain.ErrPairNotSupported) && !errors.Is(err, thorchain.ErrInvalidAmount) {
+			s.logger.WithError(err).Warn("failed to quote policy swap")
+		}
+		return "", nil
+	}
+
+	fromSymbol, toSymbol := assetSymbol(quote.FromAsset), assetSymbol(quote.ToAsset)
+	return fmt.Sprintf("\n\nAt current rates, %s would return about %s after fees (%s slippage).",
+		format.Asset(quote.AmountIn, fromSymbol, assetClass(fromSymbol)),
+		format.Asset(quote.ExpectedAmountOut, toSymbol, assetClass(toSymbol)),
+		format.Percent(float64(quote.Fees.SlippageBps)/100, 2)), quote
+}
+
+// thorchainAsset converts a configuration asset ({chain, token}) to THORChain notation.
+// Tokens need a symbol, which is taken from the user's balances.
+func thorchainAsset(asset map[string]any, balances []Balance) (string, bool) {
+	chain, _ := asset["chain"].(string)
+	prefix, ok := thorchainPrefixes[normalizeChain(chain)]
+	if !ok {
+		return "", false
+	}
+	token, _ := asset["token"].(string)
+	token = strings.TrimSpace(token)
+
+	if nativeAssetMarkers[strings.ToLower(token)] {
+		symbols := nativeSymbols[normalizeChain(chain)]
+		if len(symbols) == 0 {
+			return "", false
+		}
+		return prefix + "." + symbols[0], true
+	}
+	for _, b := range balances {
+		if strings.EqualFold(b.Asset, token) && normalizeChain(b.Chain) == normalizeChain(chain) && b.Symbol != "" {
+			return strings.ToUpper(prefix + "." + b.Symbol + "-" + token), true
+		}
+	}
+	return "", false
+}
+
+// assetSymbol returns the symbol of a THORChain asset, e.g. "USDC" for
+// "ETH.USDC-0XA0B86991C6218B36C1D19D4A2E9EB0CE3606EB48".
+func assetSymbol(asset string) string {
+	_, symbol, _ := strings.Cut(asset, ".")
+	symbol, _, _ = strings.Cut(symbol, "-")
+	return symbol
+}
@@ -0,0 +1,121 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/thorchain"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// fakeQuoter returns a fixed quote for every pair.
+type fakeQuoter struct {
+	quote *thorchain.Quote
+}
+
+func (f *fakeQuoter) Quote(context.Context, string, string, string) (*thorchain.Quote, error) {
+	return f.quote, nil
+}
+
+func (f *fakeQuoter) USDPrice(context.Context, string) (float64, error) { return 1, nil }
+
+func testQuote() *thorchain.Quote {
+	return &thorchain.Quote{
+		FromAsset:         "ETH.USDC-0XA0B86991C6218B36C1D19D4A2E9EB0CE3606EB48",
+		ToAsset:           "ETH.ETH",
+		AmountIn:          "1000",
+		ExpectedAmountOut: "0.3012",
+		Fees:              thorchain.Fees{Asset: "ETH.ETH", Total: "0.0021", SlippageBps: 12},
+		QuotedAt:          time.Date(2026, 3, 14, 9, 30, 5, 0, time.FixedZone("CET", 3600)),
+	}
+}
+
+func TestQuoteBlock(t *testing.T) {
+	quote := testQuote()
+	quote.RecommendedMinAmountIn = "25"
+	quote.Warning = "Do not cache this response."
+
+	block := quoteBlock(quote)
+	if err := block.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	want := []types.KeyValue{
+		{Key: "from", Value: quote.FromAsset},
+		{Key: "to", Value: "ETH.ETH"},
+		{Key: "amount in", Value: "1000"},
+		{Key: "expected out", Value: "0.3012"},
+		{Key: "total fee", Value: "0.0021 ETH.ETH"},
+		{Key: "slippage bps", Value: "12"},
+		{Key: "recommended min amount in", Value: "25"},
+		{Key: "warning", Value: "Do not cache this response."},
+		{Key: "quoted at", Value: "2026-03-14T08:30:05Z"},
+	}
+	if block.Type != types.BlockTypeKeyValueTable || !reflect.DeepEqual(block.Rows, want) {
+		t.Errorf("quoteBlock() = %+v, want key_value_table rows %+v", block, want)
+	}
+}
+
+func TestProcessMessageAttachesQuotes(t *testing.T) {
+	const reply = "1000 USDC would get you about 0.3 ETH right now."
+	model := &fakeModel{
+		replies: []*anthropic.Response{toolReply(SwapQuoteTool.Name, map[string]any{
+			"from_asset": "ETH.USDC-0XA0B86991C6218B36C1D19D4A2E9EB0CE3606EB48",
+			"to_asset":   "ETH.ETH",
+			"amount":     "1000",
+		})},
+		resp: toolReply(RespondToUserTool.Name, map[string]any{
+			"intent":   "general_question",
+			"response": reply,
+		}),
+	}
+	msgs := &fakeMessageStore{}
+	svc := NewAgentService(Deps{
+		Anthropic:     model,
+		Messages:      msgs,
+		Conversations: &fakeConversationStore{owner: testOwner},
+		Cache:         newFakeCache(),
+		Quotes:        &fakeQuoter{quote: testQuote()},
+		Logger:        testLogger(),
+	}, Settings{
+		Context: config.ContextConfig{WindowSize: 20, SummarizeTrigger: 40, MaxMessages: 50, HardMaxMessages: 100},
+		Agent:   config.AgentConfig{IntentMaxTokens: 1024},
+	})
+
+	resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "how much ETH would I get for 1000 USDC?",
+	})
+	if err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+
+	// The reply stays as the model wrote it; the quote goes with it as a card
+	if resp.Message.Content != reply {
+		t.Errorf("reply = %q, want %q", resp.Message.Content, reply)
+	}
+	want := []types.Block{quoteBlock(testQuote())}
+	if !reflect.DeepEqual(resp.Message.Blocks, want) {
+		t.Errorf("blocks = %+v, want %+v", resp.Message.Blocks, want)
+	}
+	stored := msgs.stored()
+	var meta struct {
+		Blocks []types.Block `json:"blocks"`
+	}
+	if err := json.Unmarshal(stored[len(stored)-1].Metadata, &meta); err != nil {
+		t.Fatalf("decode reply metadata: %v", err)
+	}
+	if !reflect.DeepEqual(meta.Blocks, want) {
+		t.Errorf("stored blocks = %+v, want %+v", meta.Blocks, want)
+	}
+	if strings.Contains(stored[len(stored)-1].Content, "THORChain") {
+		t.Errorf("stored reply %q carries a quote note", stored[len(stored)-1].Content)
+	}
+}
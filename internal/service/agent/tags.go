@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// MaxConversationTags bounds the topic tags kept on a conversation; the oldest are dropped.
+const MaxConversationTags = 5
+
+// intentTags maps respond_to_user intents to topic tags. Intents without an entry, like
+// "unclear", don't tag the conversation.
+var intentTags = map[string]string{
+	"action_request":   "action",
+	"general_question": "question",
+}
+
+// pluginTagRules map suggested plugin IDs to topic tags by substring, first match wins.
+// Plugins matching no rule are tagged "automation".
+var pluginTagRules = []struct {
+	match string
+	tag   string
+}{
+	{"dca", "dca"},
+	{"recurring-send", "recurring_sends"},
+	{"send", "recurring_sends"},
+	{"payroll", "payroll"},
+	{"fee", "fees"},
+}
+
+// deriveTags maps an intent and the suggested plugins to topic tags, without duplicates.
+func deriveTags(intent string, pluginIDs []string) []string {
+	var tags []string
+	add := func(tag string) {
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	add(intentTags[intent])
+	for _, id := range pluginIDs {
+		tag := "automation"
+		lower := strings.ToLower(id)
+		for _, rule := range pluginTagRules {
+			if strings.Contains(lower, rule.match) {
+				tag = rule.tag
+				break
+			}
+		}
+		add(tag)
+	}
+	return tags
+}
+
+// mergeTags appends new tags to existing ones, keeping at most MaxConversationTags with the
+// most recently added last. Tags seen again keep their position.
+func mergeTags(existing, tags []string) []string {
+	merged := slices.Clone(existing)
+	for _, tag := range tags {
+		if !slices.Contains(merged, tag) {
+			merged = append(merged, tag)
+		}
+	}
+	if len(merged) > MaxConversationTags {
+		merged = merged[len(merged)-MaxConversationTags:]
+	}
+	return merged
+}
+
+// TagsFromMessages recomputes a conversation's topic tags from the intent and suggestions
+// stored in its assistant messages' metadata, in conversation order.
+func TagsFromMessages(msgs []types.Message) []string {
+	tags := []string{}
+	for _, msg := range msgs {
+		if msg.Role != types.RoleAssistant || len(msg.Metadata) == 0 {
+			continue
+		}
+		var meta struct {
+			Intent      string `json:"intent"`
+			Suggestions []struct {
+				PluginID string `json:"plugin_id"`
+			} `json:"suggestions"`
+		}
+		if err := json.Unmarshal(msg.Metadata, &meta); err != nil || meta.Intent == "" {
+			continue
+		}
+		pluginIDs := make([]string, 0, len(meta.Suggestions))
+		for _, sugg := range meta.Suggestions {
+			pluginIDs = append(pluginIDs, sugg.PluginID)
+		}
+		tags = mergeTags(tags, deriveTags(meta.Intent, pluginIDs))
+	}
+	return tags
+}
+
+// tagConversation merges tags derived from an intent response into the conversation's tags.
+// Failures are logged; tags are best effort.
+func (s *AgentService) tagConversation(ctx context.Context, convID uuid.UUID, publicKey, intent string, suggestions []Suggestion) {
+	pluginIDs := make([]string, 0, len(suggestions))
+	for _, sugg := range suggestions {
+		pluginIDs = append(pluginIDs, sugg.PluginID)
+	}
+	tags := deriveTags(intent, pluginIDs)
+	if len(tags) == 0 {
+		return
+	}
+
+	conv, err := s.convRepo.GetByID(ctx, convID, publicKey)
+	if err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to load conversation tags")
+		return
+	}
+	merged := mergeTags(conv.Tags, tags)
+	if slices.Equal(merged, conv.Tags) {
+		return
+	}
+	if err := s.convRepo.UpdateTags(ctx, convID, publicKey, merged); err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to update conversation tags")
+	}
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestDeriveTags(t *testing.T) {
+	tests := []struct {
+		name      string
+		intent    string
+		pluginIDs []string
+		want      []string
+	}{
+		{name: "question", intent: "general_question", want: []string{"question"}},
+		{name: "unclear tags nothing", intent: "unclear"},
+		{name: "dca plugin", intent: "action_request", pluginIDs: []string{"vultisig-dca-0000"}, want: []string{"action", "dca"}},
+		{name: "recurring send", intent: "action_request", pluginIDs: []string{"vultisig-recurring-sends-0000"}, want: []string{"action", "recurring_sends"}},
+		{name: "matching is case-insensitive", intent: "action_request", pluginIDs: []string{"Vultisig-Payroll-0000"}, want: []string{"action", "payroll"}},
+		{name: "fee plugin", intent: "action_request", pluginIDs: []string{"vultisig-fees-feee"}, want: []string{"action", "fees"}},
+		{name: "unknown plugin", intent: "action_request", pluginIDs: []string{"vultisig-lending-0000"}, want: []string{"action", "automation"}},
+		{
+			name:      "duplicates collapse",
+			intent:    "action_request",
+			pluginIDs: []string{"vultisig-dca-0000", "dca-weekly", "vultisig-lending-0000", "vultisig-staking-0000"},
+			want:      []string{"action", "dca", "automation"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deriveTags(tt.intent, tt.pluginIDs); !slices.Equal(got, tt.want) {
+				t.Errorf("deriveTags(%q, %q) = %q, want %q", tt.intent, tt.pluginIDs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		tags     []string
+		want     []string
+	}{
+		{name: "into none", tags: []string{"question"}, want: []string{"question"}},
+		{name: "seen tags keep their place", existing: []string{"question", "dca"}, tags: []string{"question", "fees"}, want: []string{"question", "dca", "fees"}},
+		{
+			name:     "oldest dropped past the cap",
+			existing: []string{"question", "action", "dca", "fees", "payroll"},
+			tags:     []string{"automation"},
+			want:     []string{"action", "dca", "fees", "payroll", "automation"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := slices.Clone(tt.existing)
+			if got := mergeTags(existing, tt.tags); !slices.Equal(got, tt.want) {
+				t.Errorf("mergeTags(%q, %q) = %q, want %q", tt.existing, tt.tags, got, tt.want)
+			}
+			if !slices.Equal(existing, tt.existing) {
+				t.Errorf("mergeTags() modified the existing tags to %q", existing)
+			}
+		})
+	}
+}
+
+func TestTagsFromMessages(t *testing.T) {
+	meta := func(v any) json.RawMessage {
+		data, _ := json.Marshal(v)
+		return data
+	}
+	msgs := []types.Message{
+		{Role: types.RoleUser, Content: "what is a vault?"},
+		{Role: types.RoleAssistant, Metadata: meta(map[string]any{"intent": "general_question"})},
+		{Role: types.RoleUser, Content: "buy eth weekly"},
+		{Role: types.RoleAssistant, Metadata: meta(map[string]any{
+			"intent":      "action_request",
+			"suggestions": []map[string]any{{"plugin_id": "vultisig-dca-0000"}},
+		})},
+		// Policy and error replies carry no intent
+		{Role: types.RoleAssistant, Metadata: meta(map[string]any{"type": "policy_ready", "plugin_id": "vultisig-payroll-0000"})},
+		{Role: types.RoleAssistant, Metadata: json.RawMessage(`not json`)},
+	}
+
+	if got, want := TagsFromMessages(msgs), []string{"question", "action", "dca"}; !slices.Equal(got, want) {
+		t.Errorf("TagsFromMessages() = %q, want %q", got, want)
+	}
+	if got := TagsFromMessages(nil); got == nil || len(got) != 0 {
+		t.Errorf("TagsFromMessages(nil) = %#v, want an empty list", got)
+	}
+}
+
+func TestProcessMessageTagsConversation(t *testing.T) {
+	svc, _ := newConversationService(&fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "action_request",
+		"response": "A recurring swap can buy ETH every week.",
+		"suggestions": []map[string]any{
+			{"plugin_id": "vultisig-dca-0000", "title": "Weekly ETH", "description": "Buy ETH every week"},
+		},
+	})})
+	svc.outbox = &fakeOutbox{cache: svc.redis}
+	svc.pluginProvider = &fakeSkillsProvider{skills: []PluginSkill{{PluginID: "vultisig-dca-0000", Name: "Recurring swaps", Skills: "Swap assets on a schedule."}}}
+	svc.maxPromptPlugins = 1
+	convs := svc.convRepo.(*fakeConversationStore)
+	convs.tags = []string{"question"}
+
+	if _, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+		PublicKey: testOwner,
+		Content:   "how can I buy ETH every week?",
+	}); err != nil {
+		t.Fatalf("ProcessMessage() error = %v", err)
+	}
+
+	convs.mu.Lock()
+	defer convs.mu.Unlock()
+	if want := []string{"question", "action", "dca"}; !slices.Equal(convs.tags, want) {
+		t.Errorf("tags = %q, want %q", convs.tags, want)
+	}
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+// textFallbackMaxTokens caps the extraction call's output. The reply isn't repeated back,
+// so only the intent and a few suggestions need room.
+const textFallbackMaxTokens = 512
+
+// recoverToolResponse labels an intent reply the model wrote as plain text, skipping
+// respond_to_user, with one follow-up call to the summary model forced to call the tool.
+// The reply is kept as written; only the intent and suggestions are taken from the call,
+// and suggestions for plugins that weren't offered are dropped. Returns nil, leaving the
+// reply a bare message, when suggestions are switched off, no plugins were offered or the
+// call fails.
+func (s *AgentService) recoverToolResponse(ctx context.Context, plugins []PluginSkill, content, text string) *ToolResponse {
+	if len(plugins) == 0 || !s.suggestionsEnabled(ctx) {
+		return nil
+	}
+
+	var system strings.Builder
+	system.WriteString(TextFallbackPrompt)
+	offered := make(map[string]bool, len(plugins))
+	for _, p := range plugins {
+		offered[p.PluginID] = true
+		fmt.Fprintf(&system, "- %s (%s): %s\n", p.PluginID, p.Name, skillsSummary(p.Skills))
+	}
+
+	resp, err := s.send(ctx, purposeReply, &anthropic.Request{
+		Model:     s.summaryModel,
+		MaxTokens: textFallbackMaxTokens,
+		System:    system.String(),
+		Messages: []anthropic.Message{{
+			Role:    "user",
+			Content: "<user_message>\n" + content + "\n</user_message>\n\n<assistant_reply>\n" + text + "\n</assistant_reply>",
+		}},
+		Tools:      []anthropic.Tool{RespondToUserTool},
+		ToolChoice: &anthropic.ToolChoice{Type: "tool", Name: RespondToUserTool.Name},
+	})
+	if err != nil {
+		metrics.TextFallbackRecoveries.WithLabelValues("failed").Inc()
+		s.logger.WithError(err).Warn("failed to extract suggestions from text reply")
+		return nil
+	}
+
+	var tr *ToolResponse
+	for _, block := range resp.Content {
+		if block.Type != "tool_use" || block.Name != RespondToUserTool.Name {
+			continue
+		}
+		var parsed ToolResponse
+		if err := s.parseToolInput(ctx, abilityIntent, resp, block, &parsed); err == nil {
+			tr = &parsed
+		}
+	}
+	if tr == nil {
+		metrics.TextFallbackRecoveries.WithLabelValues("failed").Inc()
+		return nil
+	}
+
+	suggestions := tr.Suggestions[:0]
+	for _, sugg := range tr.Suggestions {
+		if offered[sugg.PluginID] {
+			suggestions = append(suggestions, sugg)
+		}
+	}
+	outcome := "recovered"
+	if len(suggestions) == 0 {
+		outcome = "no_suggestions"
+	}
+	metrics.TextFallbackRecoveries.WithLabelValues(outcome).Inc()
+
+	// The reply was already written without asking, so it carries no confidence and isn't
+	// turned into a question
+	return &ToolResponse{
+		Intent:      tr.Intent,
+		Response:    text,
+		Suggestions: suggestions,
+		recovered:   true,
+	}
+}
@@ -0,0 +1,125 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+func TestProcessMessageTextFallback(t *testing.T) {
+	const reply = "You can buy ETH every week with a recurring swap."
+	labels := toolReply(RespondToUserTool.Name, map[string]any{
+		"intent":   "action_request",
+		"response": "",
+		"suggestions": []map[string]any{
+			{"plugin_id": "dca", "title": "Weekly ETH", "description": "Buy ETH every week"},
+			// Plugins that weren't offered are dropped
+			{"plugin_id": "payroll", "title": "Pay salaries", "description": "Send monthly payments"},
+		},
+	})
+	skills := []PluginSkill{{PluginID: "dca", Name: "Recurring swaps", Skills: "Swap assets on a schedule."}}
+
+	tests := []struct {
+		name    string
+		plugins []PluginSkill
+		// extraction is the follow-up call's reply
+		extraction      *anthropic.Response
+		wantCalls       int
+		wantIntent      string
+		wantSuggestions []string
+		wantRecovered   bool
+		wantMetric      string
+	}{
+		{
+			name:            "suggestions recovered",
+			plugins:         skills,
+			extraction:      labels,
+			wantCalls:       2,
+			wantIntent:      "action_request",
+			wantSuggestions: []string{"dca"},
+			wantRecovered:   true,
+			wantMetric:      "recovered",
+		},
+		{
+			name:       "extraction without a tool call",
+			plugins:    skills,
+			extraction: textReply("I can't label that."),
+			wantCalls:  2,
+			wantMetric: "failed",
+		},
+		{
+			name:      "no plugins offered",
+			wantCalls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &fakeModel{replies: []*anthropic.Response{textReply(reply), tt.extraction}}
+			svc, msgs := newConversationService(model)
+			svc.summaryModel = "summary-model"
+			svc.outbox = &fakeOutbox{cache: svc.redis}
+			if tt.plugins != nil {
+				svc.pluginProvider = &fakeSkillsProvider{skills: tt.plugins}
+				svc.maxPromptPlugins = len(tt.plugins)
+			}
+			var before float64
+			if tt.wantMetric != "" {
+				before = testutil.ToFloat64(metrics.TextFallbackRecoveries.WithLabelValues(tt.wantMetric))
+			}
+
+			resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   "how can I buy ETH every week?",
+			})
+			if err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+
+			if len(model.requests) != tt.wantCalls {
+				t.Fatalf("model got %d requests, want %d", len(model.requests), tt.wantCalls)
+			}
+			if tt.wantCalls == 2 {
+				followUp := model.requests[1]
+				if followUp.Model != "summary-model" || followUp.ToolChoice == nil || followUp.ToolChoice.Name != RespondToUserTool.Name {
+					t.Errorf("follow-up call to %q with tool choice %+v, want the summary model forced to call %s", followUp.Model, followUp.ToolChoice, RespondToUserTool.Name)
+				}
+			}
+			if tt.wantMetric != "" {
+				if got := testutil.ToFloat64(metrics.TextFallbackRecoveries.WithLabelValues(tt.wantMetric)) - before; got != 1 {
+					t.Errorf("TextFallbackRecoveries{%s} grew by %v, want 1", tt.wantMetric, got)
+				}
+			}
+
+			// The reply is kept as the model wrote it either way
+			if resp.Message.Content != reply {
+				t.Errorf("reply = %q, want %q", resp.Message.Content, reply)
+			}
+			var got []string
+			for _, sugg := range resp.Suggestions {
+				got = append(got, sugg.PluginID)
+			}
+			if len(got) != len(tt.wantSuggestions) || (len(got) > 0 && got[0] != tt.wantSuggestions[0]) {
+				t.Errorf("suggestions for %q, want %q", got, tt.wantSuggestions)
+			}
+
+			stored := msgs.stored()
+			var meta struct {
+				Intent            string `json:"intent"`
+				RecoveredFromText bool   `json:"recovered_from_text"`
+			}
+			_ = json.Unmarshal(stored[len(stored)-1].Metadata, &meta)
+			if meta.RecoveredFromText != tt.wantRecovered {
+				t.Errorf("stored recovered_from_text = %v, want %v", meta.RecoveredFromText, tt.wantRecovered)
+			}
+			if meta.Intent != tt.wantIntent {
+				t.Errorf("stored intent = %q, want %q", meta.Intent, tt.wantIntent)
+			}
+		})
+	}
+}
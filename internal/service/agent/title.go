@@ -0,0 +1,89 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+// titleModeGenerate is the AGENT_TITLE_MODE that asks the summary model for titles.
+const titleModeGenerate = "generate"
+
+const (
+	// titleTimeout bounds generating a title, which runs after the reply was sent
+	titleTimeout = 15 * time.Second
+	// titleMaxTokens caps the title call's output; a title is a few words
+	titleMaxTokens = 32
+)
+
+// setInitialTitle titles a conversation after its first exchange. The first message,
+// truncated, is stored right away; in generate mode a title written by the summary model
+// replaces it in the background, so a failed generation leaves the truncated one.
+func (s *AgentService) setInitialTitle(ctx context.Context, convID uuid.UUID, publicKey, content, reply string) {
+	if err := s.convRepo.UpdateTitle(ctx, convID, publicKey, truncateTitle(content)); err != nil {
+		s.logger.WithError(err).Warn("failed to update conversation title")
+	}
+	if s.titleMode != titleModeGenerate || content == "" {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), titleTimeout)
+		defer cancel()
+		title, err := s.generateTitle(ctx, content, reply)
+		if err != nil {
+			metrics.TitleGenerations.WithLabelValues("failed").Inc()
+			s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to generate conversation title")
+			return
+		}
+		metrics.TitleGenerations.WithLabelValues("generated").Inc()
+		if err := s.convRepo.UpdateTitle(ctx, convID, publicKey, title); err != nil {
+			s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to update conversation title")
+		}
+	}()
+}
+
+// generateTitle asks the summary model for a short title of a conversation's first
+// exchange.
+func (s *AgentService) generateTitle(ctx context.Context, content, reply string) (string, error) {
+	resp, err := s.send(ctx, purposeTitle, &anthropic.Request{
+		Model:     s.summaryModel,
+		MaxTokens: titleMaxTokens,
+		System:    TitlePrompt,
+		Messages: []anthropic.Message{{
+			Role:    "user",
+			Content: "<user_message>\n" + content + "\n</user_message>\n\n<assistant_reply>\n" + reply + "\n</assistant_reply>",
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var text string
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text = block.Text
+			break
+		}
+	}
+	title := cleanTitle(text)
+	if title == "" {
+		return "", errors.New("empty title from model")
+	}
+	return title, nil
+}
+
+// cleanTitle keeps the first line of a generated title without the quotes and trailing
+// period models tend to add, truncated like any other title.
+func cleanTitle(text string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	title = strings.Trim(strings.TrimSpace(title), "\"'`*")
+	title = strings.TrimSuffix(title, ".")
+	return truncateTitle(strings.TrimSpace(title))
+}
@@ -0,0 +1,144 @@
+package agent
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+func TestTruncateTitle(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "short", content: "swap eth", want: "swap eth"},
+		{name: "at the limit", content: "0123456789012345678901234567890123456789012345678", want: "0123456789012345678901234567890123456789012345678"},
+		{name: "long", content: "i want to dca into eth every week with 100 usdc from my vault", want: "i want to dca into eth every week with 100 usdc..."},
+		{name: "limit counts bytes", content: "Ich möchte jede Woche für 100 USDC Ether kaufen, bitte", want: "Ich möchte jede Woche für 100 USDC Ether kauf..."},
+		{name: "cut would split a character", content: "€€€€€€€€€€€€€€€€€€€", want: "€€€€€€€€€€€€€€€..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateTitle(tt.content); got != tt.want {
+				t.Errorf("truncateTitle(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCleanTitle(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{text: "Weekly ETH purchases", want: "Weekly ETH purchases"},
+		{text: "  \"Weekly ETH purchases.\"\n", want: "Weekly ETH purchases"},
+		{text: "**Weekly ETH purchases**", want: "Weekly ETH purchases"},
+		{text: "Weekly ETH purchases\nThe user wants to buy ETH.", want: "Weekly ETH purchases"},
+		{text: "A title far longer than any title should ever be written", want: "A title far longer than any title should ever b..."},
+		{text: "\"\"", want: ""},
+	}
+	for _, tt := range tests {
+		if got := cleanTitle(tt.text); got != tt.want {
+			t.Errorf("cleanTitle(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestProcessMessageTitle(t *testing.T) {
+	const content = "i want to dca into eth every week with 100 usdc from my vault"
+	const truncated = "i want to dca into eth every week with 100 usdc..."
+
+	tests := []struct {
+		name string
+		mode string
+		// title is the title call's reply
+		title      *anthropic.Response
+		wantCalls  int
+		wantTitles []string
+		wantMetric string
+	}{
+		{
+			name:       "truncate",
+			wantCalls:  1,
+			wantTitles: []string{truncated},
+		},
+		{
+			name:       "generate",
+			mode:       titleModeGenerate,
+			title:      textReply("\"Weekly ETH purchases.\""),
+			wantCalls:  2,
+			wantTitles: []string{truncated, "Weekly ETH purchases"},
+			wantMetric: "generated",
+		},
+		{
+			name:       "generation fails",
+			mode:       titleModeGenerate,
+			title:      emptyReply(),
+			wantCalls:  2,
+			wantTitles: []string{truncated},
+			wantMetric: "failed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model := &fakeModel{replies: []*anthropic.Response{
+				toolReply(RespondToUserTool.Name, map[string]any{
+					"intent":   "general_question",
+					"response": "You can set up a recurring swap.",
+				}),
+				tt.title,
+			}}
+			svc, _ := newConversationService(model)
+			svc.titleMode = tt.mode
+			svc.summaryModel = "summary-model"
+			convs := svc.convRepo.(*fakeConversationStore)
+			var before float64
+			if tt.wantMetric != "" {
+				before = testutil.ToFloat64(metrics.TitleGenerations.WithLabelValues(tt.wantMetric))
+			}
+
+			if _, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   content,
+			}); err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+
+			titles := func() []string {
+				convs.mu.Lock()
+				defer convs.mu.Unlock()
+				return slices.Clone(convs.titles)
+			}
+			// Generation runs after the reply; its outcome is counted before the title is stored
+			if tt.wantMetric != "" {
+				waitFor(t, "title generation", func() bool {
+					return testutil.ToFloat64(metrics.TitleGenerations.WithLabelValues(tt.wantMetric)) > before &&
+						len(titles()) >= len(tt.wantTitles)
+				})
+			}
+			if got := titles(); !slices.Equal(got, tt.wantTitles) {
+				t.Errorf("titles = %q, want %q", got, tt.wantTitles)
+			}
+
+			model.mu.Lock()
+			defer model.mu.Unlock()
+			if len(model.requests) != tt.wantCalls {
+				t.Fatalf("model got %d requests, want %d", len(model.requests), tt.wantCalls)
+			}
+			if tt.wantCalls == 2 {
+				req := model.requests[1]
+				if req.Model != "summary-model" || req.MaxTokens != titleMaxTokens || req.System != TitlePrompt {
+					t.Errorf("title call to %q with MaxTokens %d, want the summary model with %d", req.Model, req.MaxTokens, titleMaxTokens)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package agent
+
+import "strings"
+
+// nativeSymbols maps normalized chain names to their native asset symbols.
+var nativeSymbols = map[string][]string{
+	"ethereum":    {"ETH"},
+	"arbitrum":    {"ETH"},
+	"base":        {"ETH"},
+	"optimism":    {"ETH"},
+	"blast":       {"ETH"},
+	"zksync":      {"ETH"},
+	"bsc":         {"BNB"},
+	"avalanche":   {"AVAX"},
+	"polygon":     {"POL", "MATIC"},
+	"cronoschain": {"CRO"},
+	"bitcoin":     {"BTC"},
+	"bitcoincash": {"BCH"},
+	"litecoin":    {"LTC"},
+	"dogecoin":    {"DOGE"},
+	"dash":        {"DASH"},
+	"zcash":       {"ZEC"},
+	"solana":      {"SOL"},
+	"thorchain":   {"RUNE"},
+	"mayachain":   {"CACAO"},
+	"cosmos":      {"ATOM"},
+	"gaiachain":   {"ATOM"},
+	"osmosis":     {"OSMO"},
+	"kujira":      {"KUJI"},
+	"dydx":        {"DYDX"},
+	"polkadot":    {"DOT"},
+	"ripple":      {"XRP"},
+	"tron":        {"TRX"},
+	"ton":         {"TON"},
+	"sui":         {"SUI"},
+	"cardano":     {"ADA"},
+}
+
+// nativeDecimals maps normalized chain names to the decimals of their native asset.
+var nativeDecimals = map[string]int{
+	"ethereum":    18,
+	"arbitrum":    18,
+	"base":        18,
+	"optimism":    18,
+	"blast":       18,
+	"zksync":      18,
+	"bsc":         18,
+	"avalanche":   18,
+	"polygon":     18,
+	"cronoschain": 18,
+	"bitcoin":     8,
+	"bitcoincash": 8,
+	"litecoin":    8,
+	"dogecoin":    8,
+	"dash":        8,
+	"zcash":       8,
+	"solana":      9,
+	"thorchain":   8,
+	"mayachain":   10,
+	"cosmos":      6,
+	"gaiachain":   6,
+	"osmosis":     6,
+	"kujira":      6,
+	"dydx":        18,
+	"polkadot":    10,
+	"ripple":      6,
+	"tron":        6,
+	"ton":         9,
+	"sui":         9,
+	"cardano":     6,
+}
+
+// decimalsChainAliases maps other names apps and the system prompt use for a chain to the
+// key used in nativeDecimals and knownTokens.
+var decimalsChainAliases = map[string]string{
+	"bnbchain":          "bsc",
+	"bnbsmartchain":     "bsc",
+	"binancesmartchain": "bsc",
+	"avalanchec":        "avalanche",
+	"gaia":              "gaiachain",
+	"xrp":               "ripple",
+	"xrpl":              "ripple",
+}
+
+// knownToken is a well-known token contract's symbol and decimals.
+type knownToken struct {
+	symbol   string
+	decimals int
+}
+
+// knownTokens maps normalized chain names to well-known token contracts (lowercased).
+var knownTokens = map[string]map[string]knownToken{
+	"ethereum": {
+		"0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48": {"USDC", 6},
+		"0xdac17f958d2ee523a2206206994597c13d831ec7": {"USDT", 6},
+		"0x6b175474e89094c44da98b954eedeac495271d0f": {"DAI", 18},
+		"0xc02aaa39b223fe8d0a0e5c4f27ead9083c756cc2": {"WETH", 18},
+		"0x2260fac5e5542a773aa44fbcfedf7c193bc2c599": {"WBTC", 8},
+		"0x514910771af9ca656af840dff83e8264ecf986ca": {"LINK", 18},
+		"0x1f9840a85d5af5bf1d1762f925bdaddc4201f984": {"UNI", 18},
+	},
+	"arbitrum": {
+		"0xaf88d065e77c8cc2239327c5edb3a432268e5831": {"USDC", 6},
+		"0xfd086bc7cd5c481dcc9c85ebe478a1c0b69fcbb9": {"USDT", 6},
+		"0x82af49447d8a07e3bd95bd0d56f35241523fbab1": {"WETH", 18},
+		"0x912ce59144191c1204e64559fe8253a0e49e6548": {"ARB", 18},
+	},
+	"base": {
+		"0x833589fcd6edb6e08f4c7c32d4f71b54bda02913": {"USDC", 6},
+		"0x4200000000000000000000000000000000000006": {"WETH", 18},
+	},
+	"optimism": {
+		"0x0b2c639c533813f4aa9d7837caf62653d097ff85": {"USDC", 6},
+		"0x4200000000000000000000000000000000000006": {"WETH", 18},
+		"0x4200000000000000000000000000000000000042": {"OP", 18},
+	},
+	"polygon": {
+		"0x3c499c542cef5e3811e1192ce70d8cc03d5c3359": {"USDC", 6},
+		"0xc2132d05d31c914a87c6611c10748aeb04b58e8f": {"USDT", 6},
+	},
+	"bsc": {
+		"0x55d398326f99059ff775485246999027b3197955": {"USDT", 18},
+		"0x8ac76a51cc950d9822d68b83fe1ad97b32cd580d": {"USDC", 18},
+	},
+	"avalanche": {
+		"0xb97ef9ef8734c71904d8002f8b6bc66dd9c48a6e": {"USDC", 6},
+		"0x9702230a8ea53601f5cd2dc00fdbc13d4df4a8c7": {"USDT", 6},
+	},
+	"solana": {
+		"epjfwdd5aufqssqem2qn1xzybapc8g4weggkzwytdt1v": {"USDC", 6},
+		"es9vmfrzacermjfrf4h2fyd4kconky11mcce8benwnyb": {"USDT", 6},
+	},
+}
+
+// nativeAssetMarkers are asset identifiers apps use for a chain's native coin.
+var nativeAssetMarkers = map[string]bool{
+	"":       true,
+	"native": true,
+	"0x0000000000000000000000000000000000000000": true,
+	"0xeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee": true,
+}
+
+// isRecognizedAsset reports whether a balance is a chain's native coin or a well-known token.
+// Anything else may be a spam or airdrop token and is kept out of actionable context.
+func isRecognizedAsset(b Balance) bool {
+	chain := normalizeChain(b.Chain)
+	asset := strings.ToLower(strings.TrimSpace(b.Asset))
+
+	if nativeAssetMarkers[asset] || strings.EqualFold(asset, b.Symbol) {
+		for _, sym := range nativeSymbols[chain] {
+			if strings.EqualFold(sym, b.Symbol) {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := knownTokens[chain][asset]
+	return ok
+}
+
+// normalizeChain lowercases a chain name and drops separators, so "BNB Smart Chain"-style
+// variants of the same name compare equal.
+func normalizeChain(chain string) string {
+	chain = strings.ToLower(chain)
+	return strings.NewReplacer(" ", "", "-", "", "_", "").Replace(chain)
+}
+
+// supportedChain returns the registry key of a chain name, resolving aliases, and reports
+// whether the chain is supported.
+func supportedChain(chain string) (string, bool) {
+	chain = normalizeChain(strings.TrimSpace(chain))
+	if alias, ok := decimalsChainAliases[chain]; ok {
+		chain = alias
+	}
+	_, ok := nativeDecimals[chain]
+	return chain, ok
+}
+
+// assetDecimals returns the decimals of an asset from the registry: the chain's native asset
+// when asset is a native marker or the native symbol, otherwise a well-known token contract.
+// It reports false for assets the registry doesn't know.
+func assetDecimals(chain, asset string) (int, bool) {
+	chain, _ = supportedChain(chain)
+	asset = strings.ToLower(strings.TrimSpace(asset))
+
+	native := nativeAssetMarkers[asset]
+	for _, sym := range nativeSymbols[chain] {
+		if strings.EqualFold(sym, asset) {
+			native = true
+		}
+	}
+	if native {
+		decimals, ok := nativeDecimals[chain]
+		return decimals, ok
+	}
+	if token, ok := knownTokens[chain][asset]; ok {
+		return token.decimals, true
+	}
+	return 0, false
+}
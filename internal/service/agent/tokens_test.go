@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsRecognizedAsset(t *testing.T) {
+	tests := []struct {
+		name    string
+		balance Balance
+		want    bool
+	}{
+		{name: "native coin without asset", balance: Balance{Chain: "Ethereum", Symbol: "ETH"}, want: true},
+		{name: "native marker", balance: Balance{Chain: "Arbitrum", Asset: "0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE", Symbol: "ETH"}, want: true},
+		{name: "asset named by its symbol", balance: Balance{Chain: "Bitcoin", Asset: "BTC", Symbol: "BTC"}, want: true},
+		{name: "chain name variant", balance: Balance{Chain: "BSC", Symbol: "BNB"}, want: true},
+		{name: "alternate native symbol", balance: Balance{Chain: "Polygon", Symbol: "MATIC"}, want: true},
+		{name: "known token, checksummed", balance: Balance{Chain: "Ethereum", Asset: "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", Symbol: "USDC"}, want: true},
+		{name: "known token on solana", balance: Balance{Chain: "Solana", Asset: "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v", Symbol: "USDC"}, want: true},
+		{name: "native symbol faked on another chain", balance: Balance{Chain: "Solana", Symbol: "ETH"}, want: false},
+		{name: "native marker with a foreign symbol", balance: Balance{Chain: "Ethereum", Asset: "native", Symbol: "FREE-ETH"}, want: false},
+		{name: "known token's symbol at another contract", balance: Balance{Chain: "Ethereum", Asset: "0x1234567890abcdef1234567890abcdef12345678", Symbol: "USDC"}, want: false},
+		{name: "known contract on another chain", balance: Balance{Chain: "Base", Asset: "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", Symbol: "USDC"}, want: false},
+		{name: "unknown chain", balance: Balance{Chain: "Fakechain", Symbol: "FAKE"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRecognizedAsset(tt.balance); got != tt.want {
+				t.Errorf("isRecognizedAsset(%+v) = %v, want %v", tt.balance, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalletContextUnverifiedTokens(t *testing.T) {
+	s := &AgentService{maxPromptBalances: 40}
+	balances := []Balance{
+		{Chain: "Ethereum", Symbol: "ETH", Amount: "1.25"},
+		{Chain: "Ethereum", Asset: "0x1234567890abcdef1234567890abcdef12345678", Symbol: "USDC", Amount: "5000"},
+		{Chain: "Ethereum", Asset: "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48", Symbol: "USDC", Amount: "300"},
+		{Chain: "Solana", Asset: "ClaimReward1111111111111111111111111111111", Symbol: "REWARD", Amount: "1000000"},
+		{Chain: "Solana", Symbol: "SOL", Amount: "12"},
+	}
+
+	pb := s.promptBalances(balances)
+
+	symbols := func(bs []Balance) []string {
+		var out []string
+		for _, b := range bs {
+			out = append(out, b.Symbol+" on "+b.Chain)
+		}
+		return out
+	}
+	// The stablecoin leads as the only valued balance
+	if got, want := strings.Join(symbols(pb.Verified), ", "), "USDC on Ethereum, SOL on Solana, ETH on Ethereum"; got != want {
+		t.Errorf("verified = %s, want %s", got, want)
+	}
+	if got, want := strings.Join(symbols(pb.Unverified), ", "), "REWARD on Solana, USDC on Ethereum"; got != want {
+		t.Errorf("unverified = %s, want %s", got, want)
+	}
+
+	section := BuildWalletContext(pb, nil, nil)
+	balancesPart, unverifiedPart, ok := strings.Cut(section, "### Unverified Tokens\n")
+	if !ok {
+		t.Fatalf("wallet context has no unverified tokens section:\n%s", section)
+	}
+	// The fake USDC is listed with its contract under the warning only, so it can't be
+	// mistaken for the real one
+	if strings.Contains(balancesPart, "5000") || strings.Contains(balancesPart, "REWARD") {
+		t.Errorf("balances section lists unverified tokens:\n%s", balancesPart)
+	}
+	for _, want := range []string{
+		"Do not suggest swapping, sending, or automating them",
+		"- USDC on Ethereum: 5000 (0x1234567890abcdef1234567890abcdef12345678)\n",
+		"- REWARD on Solana: 1000000 (ClaimReward1111111111111111111111111111111)\n",
+	} {
+		if !strings.Contains(unverifiedPart, want) {
+			t.Errorf("unverified section lacks %q:\n%s", want, unverifiedPart)
+		}
+	}
+
+	// Only known assets leave no unverified section
+	if section := BuildWalletContext(s.promptBalances(balances[:1]), nil, nil); strings.Contains(section, "Unverified") {
+		t.Errorf("wallet context of known assets has an unverified section:\n%s", section)
+	}
+}
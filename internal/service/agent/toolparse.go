@@ -0,0 +1,175 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// maxDeadLetterInput caps how much of a failed tool input is kept, in bytes.
+const maxDeadLetterInput = 8 * 1024
+
+// MaxToolParseFailures caps how many failures ToolParseFailures returns.
+const MaxToolParseFailures = 200
+
+// promptVersions identifies the prompt template each ability was answered with, so a parse
+// failure can be tied to the prompt that produced it.
+var promptVersions = map[string]string{
+	abilityIntent:  promptHash(SystemPrompt),
+	abilityPolicy:  promptHash(PolicyBuilderPrompt),
+	abilityConfirm: promptHash(ConfirmActionPrompt),
+}
+
+// promptHash returns a short hash of a prompt, identifying a template or the exact system
+// prompt a response was generated from.
+func promptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return hex.EncodeToString(sum[:6])
+}
+
+// parseToolInput unmarshals a tool call's input into v. Input that fails to parse is tried
+// again leniently, and either way the failure is counted and sampled into the dead-letter
+// table. The strict parse error is returned only when the lenient parse didn't rescue it.
+func (s *AgentService) parseToolInput(ctx context.Context, ability string, resp *anthropic.Response, block anthropic.ContentBlock, v any) error {
+	err := json.Unmarshal(block.Input, v)
+	if err == nil {
+		return nil
+	}
+
+	rescued := false
+	if repaired, ok := repairToolJSON(block.Input); ok {
+		// The failed parse may have filled in part of v
+		reflect.ValueOf(v).Elem().SetZero()
+		rescued = json.Unmarshal(repaired, v) == nil
+	}
+
+	outcome := "dropped"
+	if rescued {
+		outcome = "rescued"
+	}
+	metrics.ToolParseFailures.WithLabelValues(block.Name, outcome).Inc()
+	s.logger.WithError(err).WithFields(logrus.Fields{
+		"ability": ability,
+		"tool":    block.Name,
+		"model":   resp.Model,
+		"rescued": rescued,
+	}).Warn("failed to parse tool input")
+
+	s.deadLetterToolInput(ctx, &types.ToolParseFailure{
+		Ability:       ability,
+		ToolName:      block.Name,
+		RawInput:      truncateUTF8(string(block.Input), maxDeadLetterInput),
+		Error:         err.Error(),
+		Model:         resp.Model,
+		PromptVersion: promptVersions[ability],
+		Rescued:       rescued,
+	})
+
+	if rescued {
+		return nil
+	}
+	return err
+}
+
+// deadLetterToolInput stores a sampled share of parse failures, none without a failure store.
+// Storing is best effort: failures are logged, and a client that has gone away doesn't cancel
+// the write.
+func (s *AgentService) deadLetterToolInput(ctx context.Context, failure *types.ToolParseFailure) {
+	if s.failureRepo == nil || s.toolFailureSampleRate < 1 && rand.Float64() >= s.toolFailureSampleRate {
+		return
+	}
+	if err := s.failureRepo.Create(context.WithoutCancel(ctx), failure); err != nil {
+		s.logger.WithError(err).Warn("failed to store tool parse failure")
+	}
+}
+
+// ToolParseFailures returns the latest stored tool parse failures, newest first.
+// limit is clamped to 1..MaxToolParseFailures.
+func (s *AgentService) ToolParseFailures(ctx context.Context, limit int) ([]types.ToolParseFailure, error) {
+	return s.failureRepo.ListRecent(ctx, max(1, min(limit, MaxToolParseFailures)))
+}
+
+// ToolParseFailure returns a stored tool parse failure.
+func (s *AgentService) ToolParseFailure(ctx context.Context, id uuid.UUID) (*types.ToolParseFailure, error) {
+	return s.failureRepo.GetByID(ctx, id)
+}
+
+// repairToolJSON fixes the slips models make when writing JSON by hand: the object sent
+// as a JSON string, trailing commas, and single-quoted strings. It reports whether the
+// input was changed.
+func repairToolJSON(raw []byte) ([]byte, bool) {
+	src := bytes.TrimSpace(raw)
+	unwrapped := false
+	if len(src) > 0 && src[0] == '"' {
+		var inner string
+		if err := json.Unmarshal(src, &inner); err == nil {
+			src = []byte(strings.TrimSpace(inner))
+			unwrapped = true
+		}
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(src))
+	var quote byte // the quote of the string being copied, or 0 outside strings
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0 && c == '\\' && i+1 < len(src):
+			i++
+			// \' is not a JSON escape; inside a double-quoted string it is a plain quote
+			if src[i] == '\'' {
+				out.WriteByte('\'')
+			} else {
+				out.WriteByte(c)
+				out.WriteByte(src[i])
+			}
+		case quote != 0 && c == quote:
+			quote = 0
+			out.WriteByte('"')
+		case quote == '\'' && c == '"':
+			out.WriteString(`\"`)
+		case quote != 0:
+			out.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+			out.WriteByte('"')
+		case c == ',' && closesNext(src[i+1:]):
+			// Trailing comma: drop it
+		default:
+			out.WriteByte(c)
+		}
+	}
+
+	repaired := out.Bytes()
+	return repaired, unwrapped || !bytes.Equal(repaired, src)
+}
+
+// closesNext reports whether the next non-space byte closes an object or array.
+func closesNext(rest []byte) bool {
+	rest = bytes.TrimLeft(rest, " \t\r\n")
+	return len(rest) > 0 && (rest[0] == '}' || rest[0] == ']')
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
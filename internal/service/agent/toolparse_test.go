@@ -0,0 +1,191 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// fakeFailureStore records dead-lettered tool inputs.
+type fakeFailureStore struct {
+	ToolFailureStore
+	failures []types.ToolParseFailure
+}
+
+func (f *fakeFailureStore) Create(_ context.Context, failure *types.ToolParseFailure) error {
+	f.failures = append(f.failures, *failure)
+	return nil
+}
+
+// rawToolReply returns a model response calling the tool name with input as written.
+func rawToolReply(name, input string) *anthropic.Response {
+	return &anthropic.Response{
+		Model:      "test-model",
+		StopReason: "tool_use",
+		Content:    []anthropic.ContentBlock{{Type: "tool_use", ID: "toolu_1", Name: name, Input: json.RawMessage(input)}},
+	}
+}
+
+func TestRepairToolJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		want        string
+		wantChanged bool
+	}{
+		{name: "valid input", raw: `{"a":"b"}`, want: `{"a":"b"}`},
+		{name: "trailing commas", raw: `{"a":[1,2,],"b":{"c":1,},}`, want: `{"a":[1,2],"b":{"c":1}}`, wantChanged: true},
+		{name: "single quotes", raw: `{'a': 'it\'s "ok"'}`, want: `{"a": "it's \"ok\""}`, wantChanged: true},
+		{name: "comma inside a string kept", raw: `{'a': 'x,}'}`, want: `{"a": "x,}"}`, wantChanged: true},
+		{name: "object sent as a string", raw: `"{\"a\":\"b\"}"`, want: `{"a":"b"}`, wantChanged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := repairToolJSON([]byte(tt.raw))
+			if string(got) != tt.want || changed != tt.wantChanged {
+				t.Errorf("repairToolJSON(%s) = %s, %v; want %s, %v", tt.raw, got, changed, tt.want, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestMalformedToolInputs(t *testing.T) {
+	// parse runs a response through an ability's parser and returns the parsed text
+	type parseFunc func(s *AgentService, resp *anthropic.Response) (string, error)
+	policy := func(s *AgentService, resp *anthropic.Response) (string, error) {
+		pr, err := s.parsePolicyResponse(context.Background(), resp)
+		if err != nil {
+			return "", err
+		}
+		return pr.Explanation, nil
+	}
+	confirm := func(s *AgentService, resp *anthropic.Response) (string, error) {
+		cr, err := s.parseConfirmResponse(context.Background(), resp)
+		if err != nil {
+			return "", err
+		}
+		return cr.Response, nil
+	}
+	memory := func(s *AgentService, resp *anthropic.Response) (string, error) {
+		mu := s.extractMemoryUpdate(context.Background(), abilityIntent, resp)
+		if mu == nil {
+			return "", errors.New("no memory update")
+		}
+		return mu.Content, nil
+	}
+	intent := func(s *AgentService, resp *anthropic.Response) (string, error) {
+		s.anthropic = &fakeModel{resp: resp}
+		out, err := s.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{PublicKey: testOwner, Content: "hi"})
+		if err != nil {
+			return "", err
+		}
+		return out.Message.Content, nil
+	}
+
+	tests := []struct {
+		name    string
+		ability string
+		tool    string
+		parse   parseFunc
+		input   string
+		// want is the parsed text, empty when the input can't be rescued
+		want string
+	}{
+		{name: "intent trailing comma", ability: abilityIntent, tool: RespondToUserTool.Name, parse: intent,
+			input: `{"intent":"general_question","response":"Hello!",}`, want: "Hello!"},
+		{name: "intent single quotes", ability: abilityIntent, tool: RespondToUserTool.Name, parse: intent,
+			input: `{'intent': 'general_question', 'response': 'It\'s a wallet.'}`, want: "It's a wallet."},
+		{name: "intent cut off", ability: abilityIntent, tool: RespondToUserTool.Name, parse: intent,
+			input: `"{\"intent\":\"general_question\",\"response\":\"Hel"`},
+		{name: "policy single quotes", ability: abilityPolicy, tool: BuildPolicyTool.Name, parse: policy,
+			input: `{'configuration': {'amount': '1'}, 'explanation': 'Weekly swap.',}`, want: "Weekly swap."},
+		{name: "policy as a string", ability: abilityPolicy, tool: BuildPolicyTool.Name, parse: policy,
+			input: `"{\"configuration\":{},\"explanation\":\"Weekly swap.\"}"`, want: "Weekly swap."},
+		{name: "policy wrong type", ability: abilityPolicy, tool: BuildPolicyTool.Name, parse: policy,
+			input: `{"configuration":"weekly","explanation":"Weekly swap."}`},
+		{name: "confirm trailing comma", ability: abilityConfirm, tool: ConfirmActionTool.Name, parse: confirm,
+			input: `{"response":"Done.","next_steps":["Check the policy",],}`, want: "Done."},
+		{name: "confirm not JSON", ability: abilityConfirm, tool: ConfirmActionTool.Name, parse: confirm,
+			input: `"Done."`},
+		{name: "memory single quotes", ability: abilityIntent, tool: UpdateMemoryTool.Name, parse: memory,
+			input: `{'content': '# Preferences'}`, want: "# Preferences"},
+		{name: "memory wrong type", ability: abilityIntent, tool: UpdateMemoryTool.Name, parse: memory,
+			input: `{"content":["# Preferences"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := &fakeFailureStore{}
+			s, _ := newConversationService(&fakeModel{})
+			s.failureRepo = failures
+			s.toolFailureSampleRate = 1
+			outcome := "dropped"
+			if tt.want != "" {
+				outcome = "rescued"
+			}
+			before := testutil.ToFloat64(metrics.ToolParseFailures.WithLabelValues(tt.tool, outcome))
+
+			got, err := tt.parse(s, rawToolReply(tt.tool, tt.input))
+			if tt.want != "" && (err != nil || got != tt.want) {
+				t.Errorf("parsed = %q, %v; want the rescued %q", got, err, tt.want)
+			}
+			if tt.want == "" && err == nil {
+				t.Errorf("parsed = %q, want the input dropped", got)
+			}
+
+			if len(failures.failures) != 1 {
+				t.Fatalf("dead-lettered %d failures, want 1", len(failures.failures))
+			}
+			f := failures.failures[0]
+			if f.Ability != tt.ability || f.ToolName != tt.tool || f.RawInput != tt.input || f.Rescued != (tt.want != "") {
+				t.Errorf("failure = %s/%s rescued %v with input %s, want %s/%s rescued %v", f.Ability, f.ToolName, f.Rescued, f.RawInput, tt.ability, tt.tool, tt.want != "")
+			}
+			if f.Error == "" || f.Model != "test-model" || f.PromptVersion != promptVersions[tt.ability] {
+				t.Errorf("failure = %+v, want the strict parse error, model and prompt version", f)
+			}
+			if after := testutil.ToFloat64(metrics.ToolParseFailures.WithLabelValues(tt.tool, outcome)); after != before+1 {
+				t.Errorf("%s %s failures counted %v times, want 1", tt.tool, outcome, after-before)
+			}
+		})
+	}
+}
+
+func TestDeadLetterToolInput(t *testing.T) {
+	resp := rawToolReply(ConfirmActionTool.Name, `{"response":`+strings.Repeat(" ", maxDeadLetterInput)+`"é"`)
+
+	t.Run("input truncated", func(t *testing.T) {
+		failures := &fakeFailureStore{}
+		s := &AgentService{failureRepo: failures, toolFailureSampleRate: 1, logger: testLogger()}
+		if _, err := s.parseConfirmResponse(context.Background(), resp); err == nil {
+			t.Fatal("parseConfirmResponse() succeeded, want the cut-off input dropped")
+		}
+		if len(failures.failures) != 1 || len(failures.failures[0].RawInput) > maxDeadLetterInput {
+			t.Fatalf("dead-lettered %d failures, want one of at most %d bytes", len(failures.failures), maxDeadLetterInput)
+		}
+	})
+
+	t.Run("not sampled", func(t *testing.T) {
+		failures := &fakeFailureStore{}
+		s := &AgentService{failureRepo: failures, logger: testLogger()}
+		_, _ = s.parseConfirmResponse(context.Background(), resp)
+		if len(failures.failures) != 0 {
+			t.Errorf("dead-lettered %d failures at a zero sample rate", len(failures.failures))
+		}
+	})
+
+	t.Run("no store", func(t *testing.T) {
+		s := &AgentService{toolFailureSampleRate: 1, logger: testLogger()}
+		if _, err := s.parseConfirmResponse(context.Background(), resp); err == nil {
+			t.Fatal("parseConfirmResponse() succeeded, want the cut-off input dropped")
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/vultisig/agent-backend/internal/ai/anthropic"
+)
+
+// maxIntentToolRounds caps server-side tool rounds during intent detection.
+const maxIntentToolRounds = 3
+
+// toolHandler answers a server-side tool call. It returns the tool result content and
+// whether the result is an error.
+type toolHandler func(ctx context.Context, input json.RawMessage) (string, bool)
+
+// runTools sends the request and answers server-side tool calls until the model calls the
+// final tool. After maxRounds lookups, or once the model stops calling handled tools, the
+// final tool is forced. Calls to tools processed after the loop (update_memory) are
+// acknowledged and carried over to the returned response. Each response is classified
+// under ability.
+func (s *AgentService) runTools(ctx context.Context, ability string, req *anthropic.Request, final string, handlers map[string]toolHandler, maxRounds int) (*anthropic.Response, error) {
+	var carried []anthropic.ContentBlock
+	for round := 0; ; round++ {
+		forced := req.ToolChoice != nil && req.ToolChoice.Type == "tool" && req.ToolChoice.Name == final
+
+		resp, err := s.generate(ctx, ability, req)
+		if err != nil {
+			return nil, err
+		}
+		if forced || hasToolUse(resp, final) || !hasAnyToolUse(resp) {
+			resp.Content = append(resp.Content, carried...)
+			return resp, nil
+		}
+
+		var results []any
+		handled := false
+		for _, block := range resp.Content {
+			if block.Type != "tool_use" {
+				continue
+			}
+			if h, ok := handlers[block.Name]; ok {
+				if stage, ok := toolProgress[block.Name]; ok {
+					reportProgress(ctx, stage)
+				}
+				content, isError := h(ctx, block.Input)
+				results = append(results, anthropic.NewToolResultBlock(block.ID, content, isError))
+				handled = true
+				continue
+			}
+			carried = append(carried, block)
+			results = append(results, anthropic.NewToolResultBlock(block.ID, "ok", false))
+		}
+
+		req.Messages = append(req.Messages,
+			anthropic.Message{Role: "assistant", Content: resp.Content},
+			anthropic.Message{Role: "user", Content: results},
+		)
+		if !handled || round+1 >= maxRounds {
+			req.ToolChoice = &anthropic.ToolChoice{Type: "tool", Name: final}
+		}
+	}
+}
+
+// hasToolUse reports whether the response calls the named tool.
+func hasToolUse(resp *anthropic.Response, name string) bool {
+	for _, block := range resp.Content {
+		if block.Type == "tool_use" && block.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyToolUse reports whether the response calls any tool.
+func hasAnyToolUse(resp *anthropic.Response) bool {
+	for _, block := range resp.Content {
+		if block.Type == "tool_use" {
+			return true
+		}
+	}
+	return false
+}
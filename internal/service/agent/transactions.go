@@ -0,0 +1,36 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vultisig/agent-backend/internal/service/explorer"
+)
+
+// transactionStatusInput is the input of the get_transaction_status tool.
+type transactionStatusInput struct {
+	Chain string `json:"chain"`
+	Hash  string `json:"hash"`
+}
+
+// transactionStatusTool answers get_transaction_status calls. Outbound lookups are rate
+// limited per user.
+func (s *AgentService) transactionStatusTool(ctx context.Context, input json.RawMessage, rc *RequestContext) (any, error) {
+	var in transactionStatusInput
+	if err := json.Unmarshal(input, &in); err != nil || in.Chain == "" || in.Hash == "" {
+		return nil, errors.New("a chain and a transaction hash are required")
+	}
+
+	status, err := s.explorer.Status(ctx, rc.PublicKey, normalizeChain(in.Chain), in.Hash)
+	if err != nil {
+		switch {
+		case errors.Is(err, explorer.ErrUnsupportedChain), errors.Is(err, explorer.ErrRateLimited):
+			return nil, err
+		}
+		s.logger.WithError(err).WithField("chain", in.Chain).Warn("transaction status lookup failed")
+		return nil, fmt.Errorf("could not look up the transaction on %s right now", in.Chain)
+	}
+	return status, nil
+}
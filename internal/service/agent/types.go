@@ -1,6 +1,19 @@
 package agent
 
-import "github.com/vultisig/agent-backend/internal/types"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/thorchain"
+	"github.com/vultisig/agent-backend/internal/types"
+)
 
 // SendMessageRequest is the request body for sending a message.
 type SendMessageRequest struct {
@@ -9,16 +22,176 @@ type SendMessageRequest struct {
 	Context              *MessageContext `json:"context,omitempty"`
 	SelectedSuggestionID *string         `json:"selected_suggestion_id,omitempty"` // Ability 2 (TBD)
 	ActionResult         *ActionResult   `json:"action_result,omitempty"`          // Ability 3 (TBD)
-	AccessToken          string          `json:"-"`                                // Populated by API layer, not from JSON
+	// IncludeContentBlocks asks for the model's content blocks alongside the flattened reply
+	IncludeContentBlocks bool `json:"include_content_blocks,omitempty"`
+	// NoMemory keeps this message from reading or updating the user's memory, as if the
+	// conversation had been created with no_memory
+	NoMemory bool `json:"no_memory,omitempty"`
+	// MaxTokens overrides the reply's token budget for this turn, e.g. for detailed
+	// explanations; it may not exceed the server's cap, see CheckMaxTokens
+	MaxTokens *int `json:"max_tokens,omitempty"`
+	// Attachments are uploaded images sent to the model with the message's content
+	Attachments []uuid.UUID `json:"attachments,omitempty"`
+	// ReplyFormat "audio" asks for a spoken version of the reply alongside its text; it is
+	// ignored while voice replies are disabled
+	ReplyFormat string `json:"reply_format,omitempty"`
+	AccessToken string `json:"-"` // Populated by API layer, not from JSON
 	// TODO: Audio support
 	// AudioURL *string `json:"audio_url,omitempty"`
 }
 
+// CheckMaxTokens rejects a max_tokens override that isn't positive or exceeds limit.
+func (r *SendMessageRequest) CheckMaxTokens(limit int) error {
+	if r.MaxTokens == nil {
+		return nil
+	}
+	if *r.MaxTokens <= 0 || *r.MaxTokens > limit {
+		return fmt.Errorf("max_tokens must be between 1 and %d", limit)
+	}
+	return nil
+}
+
+// Reply formats a message may ask for.
+const (
+	ReplyFormatText  = "text"
+	ReplyFormatAudio = "audio"
+)
+
+// CheckReplyFormat rejects reply formats other than text and audio.
+func (r *SendMessageRequest) CheckReplyFormat() error {
+	switch r.ReplyFormat {
+	case "", ReplyFormatText, ReplyFormatAudio:
+		return nil
+	}
+	return fmt.Errorf("reply_format must be %q or %q", ReplyFormatText, ReplyFormatAudio)
+}
+
+// CheckAttachments rejects more than limit attachments, repeated ones, and attachments on
+// messages that select a suggestion or report an action result.
+func (r *SendMessageRequest) CheckAttachments(limit int) error {
+	if len(r.Attachments) == 0 {
+		return nil
+	}
+	if r.SelectedSuggestionID != nil || r.ActionResult != nil {
+		return fmt.Errorf("attachments can't be sent with selected_suggestion_id or action_result")
+	}
+	if len(r.Attachments) > limit {
+		return fmt.Errorf("at most %d attachments can be sent with a message", limit)
+	}
+	seen := make(map[uuid.UUID]bool, len(r.Attachments))
+	for _, id := range r.Attachments {
+		if seen[id] {
+			return fmt.Errorf("attachment %s is listed twice", id)
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
 // MessageContext provides context about the user's wallet state.
 type MessageContext struct {
 	VaultAddress string            `json:"vault_address,omitempty"`
 	Balances     []Balance         `json:"balances,omitempty"`
 	Addresses    map[string]string `json:"addresses,omitempty"`
+	// RecentActivity summarizes the user's recent transactions and actions, newest first.
+	// It is rendered into the prompt only and never persisted.
+	RecentActivity []Activity `json:"recent_activity,omitempty"`
+	// Locale is the user's BCP 47 locale (e.g. "de-DE"), used to format amounts in text the
+	// backend writes itself. Unknown locales fall back to the configured default.
+	Locale string `json:"locale,omitempty"`
+}
+
+// maxBalanceDecimals bounds Balance.Decimals; no supported token uses more.
+const maxBalanceDecimals = 36
+
+// MaxContextBalances caps wallet context balances; larger contexts are rejected before any
+// processing. The address cap is configurable, see CheckSize.
+const MaxContextBalances = 500
+
+// ErrContextTooLarge is returned by CheckSize when the wallet context exceeds its caps.
+var ErrContextTooLarge = errors.New("context too large")
+
+// CheckSize rejects contexts with more balances, or more than maxAddresses addresses, than
+// any real wallet sends.
+func (mc *MessageContext) CheckSize(maxAddresses int) error {
+	if len(mc.Balances) > MaxContextBalances {
+		return fmt.Errorf("%w: context.balances has %d entries, at most %d are allowed", ErrContextTooLarge, len(mc.Balances), MaxContextBalances)
+	}
+	if len(mc.Addresses) > maxAddresses {
+		return fmt.Errorf("%w: context.addresses has %d entries, at most %d are allowed", ErrContextTooLarge, len(mc.Addresses), maxAddresses)
+	}
+	return nil
+}
+
+// NormalizeAddresses rewrites address keys to the registry's chain names, so "Ethereum" and
+// "ETHEREUM" are one chain, and trims addresses. Entries with an unsupported chain or an
+// empty address are dropped, as are chains given conflicting addresses under different
+// spellings. It returns the dropped keys, sorted.
+func (mc *MessageContext) NormalizeAddresses() []string {
+	if len(mc.Addresses) == 0 {
+		return nil
+	}
+	var dropped []string
+	normalized := make(map[string]string, len(mc.Addresses))
+	conflicting := make(map[string]bool)
+	for key, address := range mc.Addresses {
+		chain, ok := supportedChain(key)
+		address = strings.TrimSpace(address)
+		if !ok || address == "" {
+			dropped = append(dropped, key)
+			continue
+		}
+		if existing, seen := normalized[chain]; seen && existing != address {
+			conflicting[chain] = true
+		}
+		normalized[chain] = address
+	}
+	for chain := range conflicting {
+		delete(normalized, chain)
+		dropped = append(dropped, chain)
+	}
+	slices.Sort(dropped)
+	mc.Addresses = normalized
+	return dropped
+}
+
+// Validate checks wallet context fields that decode fine but can't be used: balances
+// without a chain or symbol, amounts that aren't decimal numbers, out-of-range decimals and
+// empty addresses or addresses on unsupported chains. Errors name the offending field.
+func (mc *MessageContext) Validate() error {
+	for i, b := range mc.Balances {
+		field := fmt.Sprintf("context.balances[%d]", i)
+		if b.Chain == "" || b.Symbol == "" {
+			return fmt.Errorf("%s must have a chain and symbol", field)
+		}
+		if _, ok := new(big.Rat).SetString(b.Amount); !ok {
+			return fmt.Errorf("%s.amount must be a decimal number in a string, got %q", field, b.Amount)
+		}
+		if b.Decimals < 0 || b.Decimals > maxBalanceDecimals {
+			return fmt.Errorf("%s.decimals must be between 0 and %d", field, maxBalanceDecimals)
+		}
+	}
+	for chain, address := range mc.Addresses {
+		if chain == "" || address == "" {
+			return fmt.Errorf("context.addresses must map chain names to non-empty addresses")
+		}
+		if _, ok := supportedChain(chain); !ok {
+			return fmt.Errorf("context.addresses has an unsupported chain %q", chain)
+		}
+	}
+	for i, a := range mc.RecentActivity {
+		if a.Summary == "" {
+			return fmt.Errorf("context.recent_activity[%d].summary is required", i)
+		}
+	}
+	return nil
+}
+
+// Activity is a compact summary of a recent transaction or action from the app.
+type Activity struct {
+	Type      string     `json:"type,omitempty"` // e.g. "swap", "send", "dca"
+	Summary   string     `json:"summary"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
 }
 
 // Balance represents a token balance in the user's wallet.
@@ -35,16 +208,99 @@ type ActionResult struct {
 	Action  string `json:"action"`
 	Success bool   `json:"success"`
 	Error   string `json:"error,omitempty"`
+	// DraftID is the PolicyReady draft a create_policy result refers to. Without it the
+	// conversation's pending draft is resolved.
+	DraftID *uuid.UUID `json:"draft_id,omitempty"`
 }
 
 // SendMessageResponse is the response for sending a message.
 type SendMessageResponse struct {
 	Message     types.Message `json:"message"`
 	Suggestions []Suggestion  `json:"suggestions,omitempty"`
+	// WithheldSuggestions are suggestions held back because the model wasn't confident the
+	// user wants them; the app may mention them but they can't be selected
+	WithheldSuggestions []WithheldSuggestion `json:"withheld_suggestions,omitempty"`
+	// ClarifyingQuestion is the model's question about what the user wants, set in place of
+	// suggestions when it wasn't sure of the intent; the app shows it apart from the reply
+	ClarifyingQuestion string `json:"clarifying_question,omitempty"`
 	// PolicyReady is set when Ability 2 completes and a policy is ready for confirmation
 	PolicyReady *PolicyReady `json:"policy_ready,omitempty"`
 	// InstallRequired is set when a plugin must be installed before proceeding
 	InstallRequired *InstallRequired `json:"install_required,omitempty"`
+	// Citations lists the documentation passages a general answer was grounded in
+	Citations []Citation `json:"citations,omitempty"`
+	// FollowUp is an additional assistant message stored after Message, e.g. when an
+	// automatically continued step failed
+	FollowUp *types.Message `json:"follow_up,omitempty"`
+	// ErrorCode identifies a partial failure the app should handle (e.g. offer a retry)
+	ErrorCode string `json:"error_code,omitempty"`
+	// MemoryUpdated is true when the assistant stored something in the user's memory
+	MemoryUpdated bool `json:"memory_updated"`
+	// MemorySections lists the memory document headings that changed
+	MemorySections []string `json:"memory_sections,omitempty"`
+	// RolloverSuggested is set when the conversation passed the soft message cap
+	RolloverSuggested bool `json:"rollover_suggested,omitempty"`
+	// ContentBlocks are the model's content blocks behind Message, in order, when requested
+	// with include_content_blocks. Message.Content stays the flattened text.
+	ContentBlocks []ContentBlock `json:"content_blocks,omitempty"`
+	// Usage is the turn's token usage and estimated cost, with summarization apart
+	Usage *TurnUsage `json:"usage,omitempty"`
+	// MessageIDs are the messages the turn stored, in order, including the user's
+	MessageIDs []uuid.UUID `json:"message_ids,omitempty"`
+	// Revision is the conversation revision after the turn's writes; pass it as min_revision
+	// when reading the conversation to be sure they are included
+	Revision int64 `json:"revision,omitempty"`
+}
+
+// ContentBlock is one block of model output: text, or a tool call with its input.
+type ContentBlock struct {
+	Type  string          `json:"type"` // "text" or "tool_use"
+	Text  string          `json:"text,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+// Error codes surfaced in SendMessageResponse.ErrorCode and API error responses.
+const (
+	// ErrorCodeAutoBuildFailed means the plugin was installed but building the pending policy failed.
+	ErrorCodeAutoBuildFailed = "auto_build_failed"
+	// ErrorCodeSuggestionWrongConversation means a suggestion was selected outside the conversation it belongs to.
+	ErrorCodeSuggestionWrongConversation = "suggestion_wrong_conversation"
+	// ErrorCodeConversationFull means the conversation reached its hard message cap.
+	ErrorCodeConversationFull = "conversation_full"
+	// ErrorCodeAddressNotAllowed means a built policy used an address outside the user's context and contacts.
+	ErrorCodeAddressNotAllowed = "address_not_allowed"
+	// ErrorCodeBuildEscalated means policy builds kept failing and the user was pointed to help instead.
+	ErrorCodeBuildEscalated = "build_escalated"
+	// ErrorCodeGenerationAborted means the user stopped the reply before it was ready.
+	ErrorCodeGenerationAborted = "generation_aborted"
+	// ErrorCodeConversationBusy means another message in the conversation is still being processed.
+	ErrorCodeConversationBusy = "conversation_busy"
+	// ErrorCodePluginUnavailable means the verifier doesn't know the suggested plugin anymore.
+	ErrorCodePluginUnavailable = "plugin_unavailable"
+	// ErrorCodeInvalidConfiguration means the plugin rejected the built configuration; the suggestion is offered again.
+	ErrorCodeInvalidConfiguration = "invalid_configuration"
+	// ErrorCodeMessageAlreadyReplied means a retried message already has a reply or later messages.
+	ErrorCodeMessageAlreadyReplied = "message_already_replied"
+	// ErrorCodeInitialMessageFailed means a conversation was created but its initial message wasn't answered.
+	ErrorCodeInitialMessageFailed = "initial_message_failed"
+	// ErrorCodeReauthRequired means the verifier rejected the access token and the app should sign in again.
+	ErrorCodeReauthRequired = "reauth_required"
+	// ErrorCodeVerifierUnavailable means the verifier couldn't be reached or failed; retrying later may help.
+	ErrorCodeVerifierUnavailable = "verifier_unavailable"
+	// ErrorCodePayloadTooLarge means the request body exceeded the route's size limit.
+	ErrorCodePayloadTooLarge = "payload_too_large"
+	// ErrorCodeContextTooLarge means the wallet context had more balances or addresses than allowed.
+	ErrorCodeContextTooLarge = "context_too_large"
+	// ErrorCodeInvalidRequest means request fields failed validation; details names each field.
+	ErrorCodeInvalidRequest = "invalid_request"
+)
+
+// Citation references a documentation passage that supports part of a response.
+type Citation struct {
+	DocumentTitle string `json:"document_title"`
+	Source        string `json:"source,omitempty"`
+	CitedText     string `json:"cited_text"`
 }
 
 // InstallRequired signals that a plugin must be installed before proceeding.
@@ -56,9 +312,16 @@ type InstallRequired struct {
 
 // PolicyReady contains the policy details ready for user confirmation.
 type PolicyReady struct {
-	PluginID      string         `json:"plugin_id"`
-	Configuration map[string]any `json:"configuration"`
-	PolicySuggest any            `json:"policy_suggest"` // verifier.PolicySuggest
+	// DraftID identifies the stored draft; it is omitted when the draft couldn't be saved
+	DraftID            *uuid.UUID     `json:"draft_id,omitempty"`
+	PluginID           string         `json:"plugin_id"`
+	Configuration      map[string]any `json:"configuration"`
+	PolicySuggest      any            `json:"policy_suggest"`                // verifier.PolicySuggest
+	PermissionsSummary []string       `json:"permissions_summary,omitempty"` // plain-language explanation of each rule
+	// InstallUnverified is set when the plugin's installation couldn't be checked, e.g. no
+	// access token was sent; the app tells the user, since creating the policy fails if the
+	// plugin was uninstalled
+	InstallUnverified bool `json:"install_unverified,omitempty"`
 }
 
 // Suggestion represents an action suggestion for the user.
@@ -67,13 +330,79 @@ type Suggestion struct {
 	PluginID    string `json:"plugin_id"`
 	Title       string `json:"title"`
 	Description string `json:"description"`
+	// Rationale is a short reason the suggestion was made, e.g. "you hold 2 ETH idle"
+	Rationale string `json:"rationale,omitempty"`
+	// ConversationID is the conversation the suggestion was generated in. Empty on legacy suggestions.
+	ConversationID string `json:"conversation_id,omitempty"`
+	// Tentative is set when the model wasn't sure of the user's intent; the app renders it
+	// less prominently.
+	Tentative bool `json:"tentative,omitempty"`
+	// RequiresInstall reports whether the plugin must be installed first, so the app can
+	// offer install and setup as one step. Omitted when the installed plugins weren't known.
+	RequiresInstall *bool `json:"requires_install,omitempty"`
+	// InstallURL is the deeplink installing the plugin, set when RequiresInstall is true
+	InstallURL string `json:"install_url,omitempty"`
+	// InstallCheckedAt is when the installed plugins RequiresInstall was based on were fetched
+	InstallCheckedAt *time.Time `json:"install_checked_at,omitempty"`
+	// Expired is set on reload when the suggestion can no longer be selected.
+	Expired bool `json:"expired,omitempty"`
+}
+
+// WithheldSuggestion is a plugin the model suggested with too little confidence to offer it.
+type WithheldSuggestion struct {
+	PluginID string `json:"plugin_id"`
+	Title    string `json:"title"`
+}
+
+// SuggestionConversationError is returned when a suggestion is selected from a conversation
+// other than the one it was generated in.
+type SuggestionConversationError struct {
+	SuggestionID   string
+	ConversationID string // the conversation the suggestion belongs to
+}
+
+func (e *SuggestionConversationError) Error() string {
+	return fmt.Sprintf("suggestion %s belongs to conversation %s", e.SuggestionID, e.ConversationID)
+}
+
+// ErrSuggestionNotFound is returned when a selected suggestion is unknown or has expired.
+var ErrSuggestionNotFound = errors.New("suggestion not found or expired")
+
+// ConversationFullError is returned when a conversation has reached the hard message cap.
+// The app continues in a new conversation seeded with this one's summary.
+type ConversationFullError struct {
+	ConversationID string
+	Messages       int
+}
+
+func (e *ConversationFullError) Error() string {
+	return fmt.Sprintf("conversation %s is full (%d messages)", e.ConversationID, e.Messages)
+}
+
+// AddressNotAllowedError is returned when a built policy configuration contains an address
+// that is neither one of the user's own addresses nor a saved contact.
+type AddressNotAllowedError struct {
+	Address string
+}
+
+func (e *AddressNotAllowedError) Error() string {
+	return fmt.Sprintf("address %s is not in the user's wallet context or contacts", e.Address)
 }
 
 // ToolResponse is the parsed response from the respond_to_user tool.
 type ToolResponse struct {
-	Intent      string              `json:"intent"`
-	Response    string              `json:"response"`
-	Suggestions []ToolSuggestion    `json:"suggestions,omitempty"`
+	Intent      string           `json:"intent"`
+	Response    string           `json:"response"`
+	Suggestions []ToolSuggestion `json:"suggestions,omitempty"`
+	// Confidence is the model's 0-1 confidence in the intent it chose and, with suggestions,
+	// that the user wants to act now
+	Confidence         *float64 `json:"confidence,omitempty"`
+	ClarifyingQuestion string   `json:"clarifying_question,omitempty"`
+
+	// recovered is set when the response was extracted from a reply written as plain text
+	recovered bool
+	// quotes are the swap quotes taken while answering, attached to the reply as cards
+	quotes []*thorchain.Quote
 }
 
 // ToolSuggestion is a suggestion from the tool response.
@@ -81,4 +410,5 @@ type ToolSuggestion struct {
 	PluginID    string `json:"plugin_id"`
 	Title       string `json:"title"`
 	Description string `json:"description"`
+	Rationale   string `json:"rationale,omitempty"`
 }
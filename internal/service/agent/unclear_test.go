@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+func TestProcessMessageCountsUnclear(t *testing.T) {
+	tests := []struct {
+		name        string
+		intent      string
+		context     *MessageContext
+		hasContext  bool
+		hasBalances bool
+		want        float64
+	}{
+		{name: "unclear without context", intent: "unclear", want: 1},
+		{name: "unclear with context", intent: "unclear", context: &MessageContext{}, hasContext: true, want: 1},
+		{
+			name:        "unclear with balances",
+			intent:      "unclear",
+			context:     &MessageContext{Balances: []Balance{{Chain: "Ethereum", Symbol: "ETH", Amount: "1.5"}}},
+			hasContext:  true,
+			hasBalances: true,
+			want:        1,
+		},
+		{name: "clear intent", intent: "general_question"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, _ := newConversationService(&fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+				"intent":   tt.intent,
+				"response": "Could you tell me which asset you mean?",
+			})})
+			counter := metrics.UnclearIntents.WithLabelValues(strconv.FormatBool(tt.hasContext), strconv.FormatBool(tt.hasBalances))
+			before := testutil.ToFloat64(counter)
+
+			if _, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey: testOwner,
+				Content:   "do the thing",
+				Context:   tt.context,
+			}); err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+
+			if got := testutil.ToFloat64(counter) - before; got != tt.want {
+				t.Errorf("unclear intents grew by %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// pluginUnavailableResponse tells the user a suggested plugin can't be set up because the
+// verifier no longer knows it.
+func (s *AgentService) pluginUnavailableResponse(ctx context.Context, convID uuid.UUID, suggestion Suggestion) (*SendMessageResponse, error) {
+	content := fmt.Sprintf("%s isn't available right now, so I can't set it up. It may have been removed or renamed — ask me for alternatives.", suggestion.Title)
+	return s.verifierFailureResponse(ctx, convID, ErrorCodePluginUnavailable, content, suggestion.PluginID, nil, nil)
+}
+
+// invalidConfigurationResponse explains why the plugin rejected the configuration and
+// offers the suggestion again, so the user can adjust the request and retry.
+func (s *AgentService) invalidConfigurationResponse(ctx context.Context, convID uuid.UUID, suggestion Suggestion, err error) (*SendMessageResponse, error) {
+	var reason string
+	var details []string
+	var apiErr *verifier.APIError
+	if errors.As(err, &apiErr) {
+		reason = apiErr.Message
+		details = apiErr.DetailMessages()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The %s plugin couldn't accept this setup", suggestion.Title)
+	if reason != "" {
+		fmt.Fprintf(&sb, ": %s", strings.TrimSuffix(reason, "."))
+	}
+	sb.WriteString(".")
+	for _, d := range details {
+		sb.WriteString("\n- " + d)
+	}
+	sb.WriteString("\n\nTell me what to change and I'll prepare it again.")
+
+	return s.verifierFailureResponse(ctx, convID, ErrorCodeInvalidConfiguration, sb.String(), suggestion.PluginID, []Suggestion{suggestion}, details)
+}
+
+// verifierFailureResponse stores and returns an assistant message for a policy build the
+// verifier turned down.
+func (s *AgentService) verifierFailureResponse(ctx context.Context, convID uuid.UUID, errorCode, content, pluginID string, suggestions []Suggestion, details []string) (*SendMessageResponse, error) {
+	meta := map[string]any{
+		"type":       errorCode,
+		"error_code": errorCode,
+		"plugin_id":  pluginID,
+	}
+	if len(suggestions) > 0 {
+		meta["suggestions"] = suggestions
+	}
+	if len(details) > 0 {
+		meta["details"] = details
+	}
+	metadata, _ := json.Marshal(meta)
+
+	msg := &types.Message{
+		ConversationID: convID,
+		Role:           types.RoleAssistant,
+		Content:        content,
+		ContentType:    "text",
+		Metadata:       metadata,
+	}
+	if err := s.storeAssistantMessage(ctx, msg, nil); err != nil {
+		return nil, fmt.Errorf("store assistant message: %w", err)
+	}
+
+	return &SendMessageResponse{
+		Message:     *msg,
+		Suggestions: suggestions,
+		ErrorCode:   errorCode,
+	}, nil
+}
@@ -0,0 +1,24 @@
+package agent
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// replyAudio speaks a reply when the message asked for reply_format "audio" and returns
+// the URL to store on the assistant message. Voice replies are best effort: nil is
+// returned, leaving a text-only reply, while they are disabled or when synthesis fails.
+func (s *AgentService) replyAudio(ctx context.Context, convID uuid.UUID, req *SendMessageRequest, text string) *string {
+	if s.voice == nil || req.ReplyFormat != ReplyFormatAudio || text == "" {
+		return nil
+	}
+	reportProgress(ctx, ProgressSpeech)
+	audio, err := s.voice.Synthesize(ctx, req.PublicKey, text)
+	if err != nil {
+		s.logger.WithError(err).WithField("conversation_id", convID).Warn("failed to synthesize voice reply")
+		return nil
+	}
+	addSpeechUsage(ctx, audio.Chars)
+	return &audio.URL
+}
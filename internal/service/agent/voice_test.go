@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/service/voice"
+)
+
+// fakeVoice speaks any text, recording the texts it was sent.
+type fakeVoice struct {
+	err   error
+	texts []string
+}
+
+func (f *fakeVoice) Synthesize(_ context.Context, _ string, text string) (*voice.Audio, error) {
+	f.texts = append(f.texts, text)
+	if f.err != nil {
+		return nil, f.err
+	}
+	id := uuid.New()
+	return &voice.Audio{ID: id, URL: "/agent/audio/" + id.String(), Chars: utf8.RuneCountInString(text)}, nil
+}
+
+func TestProcessMessageVoiceReply(t *testing.T) {
+	const reply = "Ein Sparplan kauft für dich jede Woche ETH."
+
+	tests := []struct {
+		name        string
+		replyFormat string
+		synthErr    error
+		wantCalls   int
+		wantAudio   bool
+	}{
+		{name: "audio", replyFormat: ReplyFormatAudio, wantCalls: 1, wantAudio: true},
+		{name: "text", replyFormat: ReplyFormatText},
+		{name: "no format"},
+		{name: "synthesis fails", replyFormat: ReplyFormatAudio, synthErr: errors.New("provider down"), wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, msgs := newConversationService(&fakeModel{resp: toolReply(RespondToUserTool.Name, map[string]any{
+				"intent":   "general_question",
+				"response": reply,
+			})})
+			synth := &fakeVoice{err: tt.synthErr}
+			svc.voice = synth
+
+			resp, err := svc.ProcessMessage(context.Background(), uuid.New(), testOwner, &SendMessageRequest{
+				PublicKey:   testOwner,
+				Content:     "was ist ein Sparplan?",
+				ReplyFormat: tt.replyFormat,
+			})
+			// A failed synthesis still answers with the text
+			if err != nil {
+				t.Fatalf("ProcessMessage() error = %v", err)
+			}
+			if resp.Message.Content != reply {
+				t.Errorf("reply = %q, want %q", resp.Message.Content, reply)
+			}
+
+			if len(synth.texts) != tt.wantCalls || (tt.wantCalls > 0 && synth.texts[0] != reply) {
+				t.Errorf("synthesizer got %q, want the reply %d times", synth.texts, tt.wantCalls)
+			}
+			stored := msgs.stored()
+			storedAudio := stored[len(stored)-1].AudioURL
+			if got := resp.Message.AudioURL != nil; got != tt.wantAudio {
+				t.Fatalf("response audio_url set = %v, want %v", got, tt.wantAudio)
+			}
+			if !tt.wantAudio {
+				if storedAudio != nil {
+					t.Errorf("stored audio_url = %q, want none", *storedAudio)
+				}
+				if resp.Usage.Reply.TTSCharacters != 0 {
+					t.Errorf("TTSCharacters = %d, want 0", resp.Usage.Reply.TTSCharacters)
+				}
+				return
+			}
+			if storedAudio == nil || *storedAudio != *resp.Message.AudioURL {
+				t.Errorf("stored audio_url = %v, want %q", storedAudio, *resp.Message.AudioURL)
+			}
+			// Characters are counted, not bytes
+			if want := utf8.RuneCountInString(reply); resp.Usage.Reply.TTSCharacters != want {
+				t.Errorf("TTSCharacters = %d, want %d", resp.Usage.Reply.TTSCharacters, want)
+			}
+		})
+	}
+}
+
+func TestBuildPolicySkipsVoice(t *testing.T) {
+	convID := uuid.New()
+	s, msgs, req := policyService(t, &fakeVerifier{}, convID)
+	synth := &fakeVoice{}
+	s.voice = synth
+	req.ReplyFormat = ReplyFormatAudio
+
+	if _, err := s.buildPolicy(context.Background(), convID, req, &conversationWindow{}); err != nil {
+		t.Fatalf("buildPolicy() error = %v", err)
+	}
+
+	// Structured flows are read from their cards, not listened to
+	if len(synth.texts) != 0 {
+		t.Errorf("synthesizer got %q, want no calls", synth.texts)
+	}
+	for _, msg := range msgs.created {
+		if msg.AudioURL != nil {
+			t.Errorf("stored message with audio_url %q, want none", *msg.AudioURL)
+		}
+	}
+}
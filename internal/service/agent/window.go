@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// windowPlan is how a conversation window is built from the active messages: those after
+// the summary cursor, or all of them before the first summarization.
+type windowPlan int
+
+const (
+	// windowAll sends every active message
+	windowAll windowPlan = iota
+	// windowRecent sends the most recent windowSize active messages
+	windowRecent
+	// windowSummarize summarizes the older active messages first, and sends the recent ones
+	windowSummarize
+)
+
+// planWindow decides how the window is built from active messages. Between the window size
+// and the summarize trigger a conversation that has been summarized keeps the recent window,
+// while one that hasn't yet sends everything.
+func planWindow(active, windowSize, summarizeTrigger int, hasCursor bool) windowPlan {
+	switch {
+	case active <= windowSize:
+		return windowAll
+	case active > summarizeTrigger:
+		return windowSummarize
+	case hasCursor:
+		return windowRecent
+	default:
+		return windowAll
+	}
+}
+
+// windowAt rebuilds, without summarizing, the window a reply was generated from. history is
+// the conversation's messages before the reply, in order. The stored summary is used when its
+// cursor falls inside history; a summary written after the reply is ignored. Where a
+// summarization would have run, the recent window is kept without it.
+func windowAt(history []types.Message, summary *string, summaryUpTo *time.Time, windowSize, summarizeTrigger int) *conversationWindow {
+	active := history
+	hasCursor := summary != nil && summaryUpTo != nil && len(history) > 0 && summaryUpTo.Before(history[len(history)-1].CreatedAt)
+	if hasCursor {
+		for i, m := range history {
+			if m.CreatedAt.After(*summaryUpTo) {
+				active = history[i:]
+				break
+			}
+		}
+	} else {
+		summary = nil
+	}
+
+	window := &conversationWindow{messages: active, summary: summary, total: len(active)}
+	if planWindow(len(active), windowSize, summarizeTrigger, hasCursor) != windowAll {
+		window.messages = active[len(active)-windowSize:]
+	}
+	return window
+}
+
+// windowBefore rebuilds the window msg was generated from out of the stored conversation;
+// see windowAt.
+func (s *AgentService) windowBefore(ctx context.Context, conv *types.Conversation, msg *types.Message) (*conversationWindow, error) {
+	all, err := s.msgRepo.GetByConversationID(ctx, conv.ID)
+	if err != nil {
+		return nil, err
+	}
+	var history []types.Message
+	for _, m := range all {
+		if m.CreatedAt.Before(msg.CreatedAt) {
+			history = append(history, m)
+		}
+	}
+
+	window := windowAt(history, conv.Summary, conv.SummaryUpTo, s.windowSize, s.summarizeTrigger)
+	window.noMemory = conv.NoMemory
+	return window, nil
+}
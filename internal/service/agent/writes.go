@@ -0,0 +1,51 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// writesKey is the context key for the messages stored while handling a message.
+type writesKey struct{}
+
+// turnWrites collects the messages a turn stored, so the response can tell the app which
+// revision a read must reach to include them. It is locked like turnUsage.
+type turnWrites struct {
+	mu       sync.Mutex
+	ids      []uuid.UUID
+	revision int64
+}
+
+// withWrites returns a context that collects the messages stored with it.
+func withWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, writesKey{}, new(turnWrites))
+}
+
+// noteWrite records that msg was stored.
+func noteWrite(ctx context.Context, msg *types.Message) {
+	tw, ok := ctx.Value(writesKey{}).(*turnWrites)
+	if !ok {
+		return
+	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.ids = append(tw.ids, msg.ID)
+	tw.revision = max(tw.revision, msg.Revision)
+}
+
+// reportWrites attaches the IDs of the messages stored in ctx and the revision they reached
+// to out, when a response was built.
+func reportWrites(ctx context.Context, out *SendMessageResponse) {
+	tw, ok := ctx.Value(writesKey{}).(*turnWrites)
+	if !ok || out == nil {
+		return
+	}
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	out.MessageIDs = tw.ids
+	out.Revision = tw.revision
+}
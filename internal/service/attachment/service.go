@@ -0,0 +1,158 @@
+// Package attachment stores the images users attach to messages and loads them back for
+// the model and for rendering the conversation history.
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/storage/blob"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+var (
+	// ErrEmpty is returned when an upload has no data.
+	ErrEmpty = errors.New("attachment is empty")
+	// ErrTooLarge is returned when an upload exceeds the size limit.
+	ErrTooLarge = errors.New("attachment is too large")
+	// ErrUnsupportedType is returned for uploads that aren't PNG, JPEG or WebP images.
+	ErrUnsupportedType = errors.New("attachments must be PNG, JPEG or WebP images")
+	// ErrNotFound is returned for attachments that don't exist or belong to another user.
+	ErrNotFound = errors.New("attachment not found")
+)
+
+// allowedTypes are the image types the model reads, as detected from the data.
+var allowedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/webp": true,
+}
+
+// Image is an attachment with its data.
+type Image struct {
+	types.Attachment
+	Data []byte
+}
+
+// Service stores attachments: their data in blob storage and a record per attachment in
+// Postgres, which scopes it to its owner.
+type Service struct {
+	repo          *postgres.AttachmentRepository
+	blob          *blob.Client
+	logger        *logrus.Logger
+	maxBytes      int64
+	maxPerMessage int
+}
+
+// NewService creates an attachment service.
+func NewService(repo *postgres.AttachmentRepository, blobClient *blob.Client, cfg config.AttachmentsConfig, logger *logrus.Logger) *Service {
+	return &Service{
+		repo:          repo,
+		blob:          blobClient,
+		logger:        logger,
+		maxBytes:      cfg.MaxBytes,
+		maxPerMessage: cfg.MaxPerMessage,
+	}
+}
+
+// MaxBytes returns the size limit of one attachment.
+func (s *Service) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// MaxPerMessage returns how many attachments one message may carry.
+func (s *Service) MaxPerMessage() int {
+	return s.maxPerMessage
+}
+
+// objectKey is the blob key holding an attachment's data.
+func objectKey(id uuid.UUID) string {
+	return "attachments/" + id.String()
+}
+
+// Upload validates and stores an image of publicKey. The type is detected from the data,
+// not taken from the client. The record is written first, so an upload that fails halfway
+// leaves a record without data, which loads as not found.
+func (s *Service) Upload(ctx context.Context, publicKey string, data []byte) (*types.Attachment, error) {
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	if int64(len(data)) > s.maxBytes {
+		return nil, ErrTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	if !allowedTypes[contentType] {
+		return nil, ErrUnsupportedType
+	}
+
+	a := &types.Attachment{ContentType: contentType, SizeBytes: len(data)}
+	if err := s.repo.Create(ctx, publicKey, a); err != nil {
+		return nil, err
+	}
+	if err := s.blob.Put(ctx, objectKey(a.ID), contentType, data); err != nil {
+		return nil, fmt.Errorf("store attachment: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"attachment_id": a.ID,
+		"content_type":  contentType,
+		"size_bytes":    len(data),
+	}).Info("attachment uploaded")
+	return a, nil
+}
+
+// Open returns an attachment of publicKey with its data.
+func (s *Service) Open(ctx context.Context, publicKey string, id uuid.UUID) (*Image, error) {
+	a, err := s.repo.GetByID(ctx, id, publicKey)
+	if err != nil {
+		if errors.Is(err, postgres.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	data, err := s.blob.Get(ctx, objectKey(id))
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("load attachment: %w", err)
+	}
+	return &Image{Attachment: *a, Data: data}, nil
+}
+
+// Load returns attachments of publicKey with their data, in the order of ids. If any of
+// them doesn't exist or belongs to someone else, ErrNotFound is returned.
+func (s *Service) Load(ctx context.Context, publicKey string, ids []uuid.UUID) ([]Image, error) {
+	found, err := s.repo.ListByIDs(ctx, publicKey, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]types.Attachment, len(found))
+	for _, a := range found {
+		byID[a.ID] = a
+	}
+
+	images := make([]Image, 0, len(ids))
+	for _, id := range ids {
+		a, ok := byID[id]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		data, err := s.blob.Get(ctx, objectKey(id))
+		if err != nil {
+			if errors.Is(err, blob.ErrNotFound) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("load attachment: %w", err)
+		}
+		images = append(images, Image{Attachment: a, Data: data})
+	}
+	return images, nil
+}
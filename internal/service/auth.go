@@ -1,7 +1,9 @@
 package service
 
 import (
+	"encoding/hex"
 	"errors"
+	"strings"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -9,6 +11,28 @@ import (
 // TokenTypeAccess is the expected token type for access tokens.
 const TokenTypeAccess = "access"
 
+// Hex lengths of vault public keys: compressed ECDSA (secp256k1) and EdDSA (ed25519).
+const (
+	ecdsaPublicKeyHexLen = 66
+	eddsaPublicKeyHexLen = 64
+)
+
+// ErrInvalidPublicKey is returned by NormalizePublicKey for keys that aren't hex-encoded
+// ECDSA or EdDSA public keys.
+var ErrInvalidPublicKey = errors.New("invalid public key")
+
+// NormalizePublicKey validates a hex-encoded ECDSA or EdDSA public key and returns it in
+// lowercase, the one spelling used for storage and cache keys.
+func NormalizePublicKey(publicKey string) (string, error) {
+	if len(publicKey) != ecdsaPublicKeyHexLen && len(publicKey) != eddsaPublicKeyHexLen {
+		return "", ErrInvalidPublicKey
+	}
+	if _, err := hex.DecodeString(publicKey); err != nil {
+		return "", ErrInvalidPublicKey
+	}
+	return strings.ToLower(publicKey), nil
+}
+
 // Claims represents the JWT claims structure used by the verifier.
 type Claims struct {
 	jwt.RegisteredClaims
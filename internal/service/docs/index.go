@@ -0,0 +1,203 @@
+package docs
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//go:embed corpus/*.md
+var corpus embed.FS
+
+// BM25 tuning parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Chunk is a retrievable section of a documentation page.
+type Chunk struct {
+	Source string // corpus file name, e.g. "vaults.md"
+	Title  string // "Page title: Section heading"
+	Text   string
+}
+
+// Result is a chunk matched by a search along with its relevance score.
+type Result struct {
+	Chunk
+	Score float64
+}
+
+// Index is an in-memory BM25 keyword index over the embedded Vultisig docs corpus.
+type Index struct {
+	chunks    []Chunk
+	termFreqs []map[string]int
+	lengths   []int
+	docFreq   map[string]int
+	avgLength float64
+}
+
+// NewIndex loads and indexes the embedded docs corpus.
+func NewIndex() (*Index, error) {
+	files, err := fs.Glob(corpus, "corpus/*.md")
+	if err != nil {
+		return nil, fmt.Errorf("list docs corpus: %w", err)
+	}
+
+	var chunks []Chunk
+	for _, f := range files {
+		data, err := corpus.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", f, err)
+		}
+		chunks = append(chunks, splitSections(path.Base(f), string(data))...)
+	}
+
+	return newIndexFromChunks(chunks), nil
+}
+
+func newIndexFromChunks(chunks []Chunk) *Index {
+	idx := &Index{
+		chunks:    chunks,
+		termFreqs: make([]map[string]int, len(chunks)),
+		lengths:   make([]int, len(chunks)),
+		docFreq:   make(map[string]int),
+	}
+
+	var totalLength int
+	for i, c := range chunks {
+		terms := tokenize(c.Title + " " + c.Text)
+		freqs := make(map[string]int, len(terms))
+		for _, t := range terms {
+			freqs[t]++
+		}
+		for t := range freqs {
+			idx.docFreq[t]++
+		}
+		idx.termFreqs[i] = freqs
+		idx.lengths[i] = len(terms)
+		totalLength += len(terms)
+	}
+	if len(chunks) > 0 {
+		idx.avgLength = float64(totalLength) / float64(len(chunks))
+	}
+	return idx
+}
+
+// Len returns the number of indexed chunks.
+func (i *Index) Len() int {
+	return len(i.chunks)
+}
+
+// Search returns up to limit chunks matching the query, best first, with scores of at least minScore.
+func (i *Index) Search(query string, limit int, minScore float64) []Result {
+	terms := tokenize(query)
+	if len(terms) == 0 || len(i.chunks) == 0 || limit <= 0 {
+		return nil
+	}
+
+	n := float64(len(i.chunks))
+	var results []Result
+	for ci, freqs := range i.termFreqs {
+		var score float64
+		for _, t := range terms {
+			tf := float64(freqs[t])
+			if tf == 0 {
+				continue
+			}
+			df := float64(i.docFreq[t])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			norm := tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*float64(i.lengths[ci])/i.avgLength))
+			score += idf * norm
+		}
+		if score >= minScore && score > 0 {
+			results = append(results, Result{Chunk: i.chunks[ci], Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(a, b int) bool {
+		return results[a].Score > results[b].Score
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// splitSections splits a markdown page into one chunk per "## " section.
+// The "# " page title prefixes each section title.
+func splitSections(source, content string) []Chunk {
+	var chunks []Chunk
+	var pageTitle, heading string
+	var body strings.Builder
+
+	flush := func() {
+		text := strings.TrimSpace(body.String())
+		body.Reset()
+		if text == "" {
+			return
+		}
+		title := pageTitle
+		if heading != "" {
+			title = pageTitle + ": " + heading
+		}
+		chunks = append(chunks, Chunk{Source: source, Title: title, Text: text})
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case strings.HasPrefix(line, "# "):
+			flush()
+			pageTitle = strings.TrimSpace(strings.TrimPrefix(line, "# "))
+			heading = ""
+		case strings.HasPrefix(line, "## "):
+			flush()
+			heading = strings.TrimSpace(strings.TrimPrefix(line, "## "))
+		default:
+			body.WriteString(line)
+			body.WriteString("\n")
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// stopWords are dropped from queries and documents before scoring.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "can": true, "do": true, "does": true, "for": true, "from": true, "how": true,
+	"i": true, "in": true, "is": true, "it": true, "my": true, "of": true, "on": true,
+	"or": true, "that": true, "the": true, "this": true, "to": true, "what": true,
+	"when": true, "where": true, "which": true, "with": true, "you": true, "your": true,
+	"there": true, "here": true, "have": true, "has": true, "was": true, "will": true,
+	"would": true, "should": true, "could": true, "about": true, "into": true, "than": true,
+	"then": true, "they": true, "them": true, "we": true, "me": true, "so": true, "if": true,
+	"not": true, "but": true, "all": true, "any": true, "hi": true, "hello": true, "hey": true,
+	"thanks": true, "please": true,
+}
+
+// tokenize lowercases text and splits it into alphanumeric terms, dropping stop words and
+// a trailing plural "s" so "vaults" matches "vault".
+func tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := fields[:0]
+	for _, f := range fields {
+		if stopWords[f] {
+			continue
+		}
+		if len(f) > 3 && strings.HasSuffix(f, "s") && !strings.HasSuffix(f, "ss") {
+			f = strings.TrimSuffix(f, "s")
+		}
+		terms = append(terms, f)
+	}
+	return terms
+}
@@ -0,0 +1,126 @@
+package docs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testChunks() []Chunk {
+	return []Chunk{
+		{Source: "vaults.md", Title: "Vaults: Backups", Text: "Back up every key share of the vault separately. Key shares replace the seed phrase."},
+		{Source: "vaults.md", Title: "Vaults: Sharing", Text: "Share vault access with family members and set a signing threshold."},
+		{Source: "swaps.md", Title: "Swaps: Native swaps", Text: "Swap native assets across chains through THORChain without wrapped tokens."},
+		{Source: "swaps.md", Title: "Swaps: Fees", Text: "Swap fees include the network fee and the affiliate fee."},
+	}
+}
+
+func titles(results []Result) []string {
+	var out []string
+	for _, r := range results {
+		out = append(out, r.Title)
+	}
+	return out
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := newIndexFromChunks(testChunks())
+
+	tests := []struct {
+		name     string
+		query    string
+		limit    int
+		minScore float64
+		want     []string
+	}{
+		{
+			name:  "best match first",
+			query: "how do I back up my key shares?",
+			limit: 10,
+			want:  []string{"Vaults: Backups", "Vaults: Sharing"},
+		},
+		{
+			name:  "plurals match the singular",
+			query: "swaps",
+			limit: 10,
+			want:  []string{"Swaps: Native swaps", "Swaps: Fees"},
+		},
+		{
+			name:  "rarer terms outweigh common ones",
+			query: "vault threshold",
+			limit: 10,
+			want:  []string{"Vaults: Sharing", "Vaults: Backups"},
+		},
+		{
+			name:  "limit keeps the top results",
+			query: "swap fee",
+			limit: 1,
+			want:  []string{"Swaps: Fees"},
+		},
+		{
+			name:     "min score drops weak matches",
+			query:    "vault threshold",
+			limit:    10,
+			minScore: 1.5,
+			want:     []string{"Vaults: Sharing"},
+		},
+		{
+			name:  "stop words only",
+			query: "what is this?",
+			limit: 10,
+		},
+		{
+			name:  "no matching terms",
+			query: "staking rewards",
+			limit: 10,
+		},
+		{
+			name:  "zero limit",
+			query: "vault",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := idx.Search(tt.query, tt.limit, tt.minScore)
+			if !reflect.DeepEqual(titles(got), tt.want) {
+				t.Errorf("Search(%q) = %q, want %q", tt.query, titles(got), tt.want)
+			}
+			for i := 1; i < len(got); i++ {
+				if got[i].Score > got[i-1].Score {
+					t.Errorf("results not sorted by score: %v", got)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitSections(t *testing.T) {
+	page := "# Vaults\n\nIntro text.\n\n## Backups\n\nBack up each share.\n\n## Empty\n\n## Sharing\n\nShare access.\n"
+	want := []Chunk{
+		{Source: "vaults.md", Title: "Vaults", Text: "Intro text."},
+		{Source: "vaults.md", Title: "Vaults: Backups", Text: "Back up each share."},
+		{Source: "vaults.md", Title: "Vaults: Sharing", Text: "Share access."},
+	}
+	if got := splitSections("vaults.md", page); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitSections() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewIndex(t *testing.T) {
+	idx, err := NewIndex()
+	if err != nil {
+		t.Fatalf("NewIndex() error = %v", err)
+	}
+	if idx.Len() == 0 {
+		t.Fatal("NewIndex() indexed no chunks from the embedded corpus")
+	}
+
+	results := idx.Search("how do I back up my vault key shares", 3, 0)
+	if len(results) == 0 {
+		t.Fatal("Search() found nothing for a vault backup question")
+	}
+	if top := results[0]; top.Source != "vaults.md" || !strings.Contains(top.Title, "Backups") {
+		t.Errorf("top result = %s %q, want the vault backups section", top.Source, top.Title)
+	}
+}
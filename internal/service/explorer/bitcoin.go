@@ -0,0 +1,45 @@
+package explorer
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var bitcoinTxIDRe = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// bitcoinStatus looks up a Bitcoin transaction through an Esplora API.
+func (c *Client) bitcoinStatus(ctx context.Context, txid string) (*TxStatus, error) {
+	if !bitcoinTxIDRe.MatchString(txid) {
+		return nil, fmt.Errorf("invalid transaction id %q", txid)
+	}
+
+	var txStatus struct {
+		Confirmed   bool  `json:"confirmed"`
+		BlockHeight int64 `json:"block_height"`
+		BlockTime   int64 `json:"block_time"`
+	}
+	found, err := c.getJSON(ctx, fmt.Sprintf("%s/tx/%s/status", c.bitcoinURL, txid), &txStatus)
+	if err != nil {
+		return nil, fmt.Errorf("get transaction status: %w", err)
+	}
+	if !found {
+		return &TxStatus{Status: StatusNotFound}, nil
+	}
+	if !txStatus.Confirmed {
+		return &TxStatus{Status: StatusPending}, nil
+	}
+
+	status := &TxStatus{Status: StatusSuccess}
+	ts := time.Unix(txStatus.BlockTime, 0).UTC()
+	status.Timestamp = &ts
+
+	var tip int64
+	if _, err := c.getJSON(ctx, c.bitcoinURL+"/blocks/tip/height", &tip); err != nil {
+		c.logger.WithError(err).Warn("failed to get bitcoin tip height")
+	} else if tip >= txStatus.BlockHeight {
+		status.Confirmations = tip - txStatus.BlockHeight + 1
+	}
+	return status, nil
+}
@@ -0,0 +1,183 @@
+package explorer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/cache/redis"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/requestid"
+)
+
+const (
+	// statusCachePrefix is the Redis key prefix for cached terminal transaction statuses.
+	statusCachePrefix = "tx_status:"
+	// statusCacheTTL is how long terminal statuses are cached; they don't change once final.
+	statusCacheTTL = 24 * time.Hour
+	// lookupKeyPrefix is the Redis key prefix for per-user outbound lookup counters.
+	lookupKeyPrefix = "tx_lookups:"
+	// lookupWindow is the rate limit window for outbound lookups.
+	lookupWindow = time.Minute
+)
+
+// Transaction statuses.
+const (
+	StatusSuccess  = "success"
+	StatusFailed   = "failed"
+	StatusPending  = "pending"
+	StatusNotFound = "not_found"
+)
+
+var (
+	// ErrUnsupportedChain is returned for chains without a configured explorer.
+	ErrUnsupportedChain = errors.New("chain not supported for transaction lookups")
+	// ErrRateLimited is returned when a user exceeds the outbound lookup rate.
+	ErrRateLimited = errors.New("too many transaction lookups, try again in a minute")
+)
+
+// TxStatus is the on-chain status of a transaction.
+type TxStatus struct {
+	Chain         string     `json:"chain"`
+	Hash          string     `json:"hash"`
+	Status        string     `json:"status"`
+	Confirmations int64      `json:"confirmations"`
+	Timestamp     *time.Time `json:"timestamp,omitempty"`
+	CheckedAt     time.Time  `json:"checked_at"`
+}
+
+// terminal reports whether the status can no longer change.
+func (s *TxStatus) terminal() bool {
+	return s.Status == StatusSuccess || s.Status == StatusFailed
+}
+
+// Client looks up transaction status through block explorer APIs: an Etherscan-compatible
+// API for EVM chains and an Esplora API for Bitcoin.
+type Client struct {
+	etherscanURL    string
+	etherscanAPIKey string
+	evmChains       map[string]string // chain name -> chain ID
+	bitcoinURL      string
+	lookupsPerMin   int
+	redis           *redis.Client
+	httpClient      *http.Client
+	logger          *logrus.Logger
+}
+
+// NewClient creates a new explorer Client.
+func NewClient(cfg config.ExplorerConfig, redisClient *redis.Client, httpClients *httpclient.Factory, logger *logrus.Logger) *Client {
+	evmChains := make(map[string]string, len(cfg.EVMChains))
+	for chain, id := range cfg.EVMChains {
+		evmChains[strings.ToLower(chain)] = id
+	}
+	return &Client{
+		etherscanURL:    cfg.EtherscanURL,
+		etherscanAPIKey: cfg.EtherscanAPIKey,
+		evmChains:       evmChains,
+		bitcoinURL:      strings.TrimRight(cfg.BitcoinURL, "/"),
+		lookupsPerMin:   cfg.LookupsPerMinute,
+		redis:           redisClient,
+		httpClient:      httpClients.New(10 * time.Second),
+		logger:          logger,
+	}
+}
+
+// SupportedChains lists the chains transactions can be looked up on, sorted.
+func (c *Client) SupportedChains() []string {
+	chains := make([]string, 0, len(c.evmChains)+1)
+	for chain := range c.evmChains {
+		chains = append(chains, chain)
+	}
+	if c.bitcoinURL != "" {
+		chains = append(chains, "bitcoin")
+	}
+	sort.Strings(chains)
+	return chains
+}
+
+// Status returns the status of a transaction. Terminal statuses are served from cache;
+// other lookups count against the user's per-minute limit.
+func (c *Client) Status(ctx context.Context, user, chain, hash string) (*TxStatus, error) {
+	chain = strings.ToLower(strings.TrimSpace(chain))
+	hash = strings.TrimSpace(hash)
+
+	chainID, isEVM := c.evmChains[chain]
+	if !isEVM && (chain != "bitcoin" || c.bitcoinURL == "") {
+		return nil, ErrUnsupportedChain
+	}
+
+	cacheKey := statusCachePrefix + chain + ":" + strings.ToLower(hash)
+	if cached, err := c.redis.Get(ctx, cacheKey); err == nil && cached != "" {
+		var status TxStatus
+		if err := json.Unmarshal([]byte(cached), &status); err == nil {
+			return &status, nil
+		}
+	}
+
+	n, err := c.redis.Incr(ctx, lookupKeyPrefix+user, lookupWindow)
+	if err != nil {
+		c.logger.WithError(err).Warn("failed to count transaction lookup")
+	} else if n > int64(c.lookupsPerMin) {
+		return nil, ErrRateLimited
+	}
+
+	var status *TxStatus
+	if isEVM {
+		status, err = c.evmStatus(ctx, chainID, hash)
+	} else {
+		status, err = c.bitcoinStatus(ctx, hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	status.Chain = chain
+	status.Hash = hash
+	status.CheckedAt = time.Now().UTC()
+
+	if status.terminal() {
+		if data, err := json.Marshal(status); err == nil {
+			if err := c.redis.Set(ctx, cacheKey, string(data), statusCacheTTL); err != nil {
+				c.logger.WithError(err).Warn("failed to cache transaction status")
+			}
+		}
+	}
+	return status, nil
+}
+
+// getJSON performs a GET request and decodes a JSON response. It returns false without an
+// error on 404.
+func (c *Client) getJSON(ctx context.Context, url string, out any) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false, fmt.Errorf("create request: %w", err)
+	}
+	requestid.SetHeader(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return false, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("decode response: %w", err)
+	}
+	return true, nil
+}
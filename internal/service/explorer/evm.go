@@ -0,0 +1,101 @@
+package explorer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var evmHashRe = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+// proxyResponse is an Etherscan proxy module response wrapping a JSON-RPC result.
+type proxyResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// evmStatus looks up a transaction on an EVM chain through the Etherscan proxy module.
+func (c *Client) evmStatus(ctx context.Context, chainID, hash string) (*TxStatus, error) {
+	if !evmHashRe.MatchString(hash) {
+		return nil, fmt.Errorf("invalid transaction hash %q", hash)
+	}
+
+	var receipt *struct {
+		Status      string `json:"status"`
+		BlockNumber string `json:"blockNumber"`
+	}
+	if err := c.proxy(ctx, chainID, url.Values{"action": {"eth_getTransactionReceipt"}, "txhash": {hash}}, &receipt); err != nil {
+		return nil, fmt.Errorf("get receipt: %w", err)
+	}
+
+	if receipt == nil {
+		// No receipt yet: pending if the node knows the transaction at all
+		var tx json.RawMessage
+		if err := c.proxy(ctx, chainID, url.Values{"action": {"eth_getTransactionByHash"}, "txhash": {hash}}, &tx); err != nil {
+			return nil, fmt.Errorf("get transaction: %w", err)
+		}
+		if len(tx) == 0 || string(tx) == "null" {
+			return &TxStatus{Status: StatusNotFound}, nil
+		}
+		return &TxStatus{Status: StatusPending}, nil
+	}
+
+	status := &TxStatus{Status: StatusFailed}
+	if receipt.Status == "0x1" {
+		status.Status = StatusSuccess
+	}
+
+	var head string
+	if err := c.proxy(ctx, chainID, url.Values{"action": {"eth_blockNumber"}}, &head); err != nil {
+		return nil, fmt.Errorf("get block number: %w", err)
+	}
+	if block, headNum := parseHex(receipt.BlockNumber), parseHex(head); headNum >= block {
+		status.Confirmations = headNum - block + 1
+	}
+
+	var block *struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if err := c.proxy(ctx, chainID, url.Values{"action": {"eth_getBlockByNumber"}, "tag": {receipt.BlockNumber}, "boolean": {"false"}}, &block); err != nil {
+		c.logger.WithError(err).Warn("failed to get block timestamp")
+	} else if block != nil {
+		ts := time.Unix(parseHex(block.Timestamp), 0).UTC()
+		status.Timestamp = &ts
+	}
+
+	return status, nil
+}
+
+// proxy calls an Etherscan proxy module action and decodes its result.
+func (c *Client) proxy(ctx context.Context, chainID string, params url.Values, out any) error {
+	params.Set("chainid", chainID)
+	params.Set("module", "proxy")
+	if c.etherscanAPIKey != "" {
+		params.Set("apikey", c.etherscanAPIKey)
+	}
+
+	var resp proxyResponse
+	if _, err := c.getJSON(ctx, c.etherscanURL+"?"+params.Encode(), &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("explorer error: %s", resp.Error.Message)
+	}
+	// Etherscan reports API errors (bad key, rate limit) as a plain string result
+	if len(resp.Result) > 0 && resp.Result[0] == '"' && !strings.HasPrefix(string(resp.Result), `"0x`) {
+		return fmt.Errorf("explorer error: %s", string(resp.Result))
+	}
+	return json.Unmarshal(resp.Result, out)
+}
+
+func parseHex(s string) int64 {
+	n, _ := strconv.ParseInt(strings.TrimPrefix(s, "0x"), 16, 64)
+	return n
+}
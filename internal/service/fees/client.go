@@ -0,0 +1,167 @@
+package fees
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/cache/redis"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+)
+
+// estimateCachePrefix is the Redis key prefix for cached fee estimates.
+const estimateCachePrefix = "fee_estimate:"
+
+// Actions a fee can be estimated for.
+const (
+	ActionTransfer      = "transfer"
+	ActionTokenTransfer = "token_transfer"
+	ActionSwap          = "swap"
+)
+
+var (
+	// ErrUnsupportedChain is returned for chains without a configured estimator.
+	ErrUnsupportedChain = errors.New("chain not supported for fee estimates")
+	// ErrUnsupportedAction is returned for actions a chain can't perform, e.g. token
+	// transfers on Bitcoin.
+	ErrUnsupportedAction = errors.New("action not supported on this chain")
+)
+
+// utxoSymbols maps UTXO chain names to their native symbols.
+var utxoSymbols = map[string]string{
+	"bitcoin":     "BTC",
+	"litecoin":    "LTC",
+	"dogecoin":    "DOGE",
+	"bitcoincash": "BCH",
+}
+
+// evmSymbols maps EVM chain names to their native symbols; unlisted chains use ETH.
+var evmSymbols = map[string]string{
+	"bsc":       "BNB",
+	"avalanche": "AVAX",
+	"polygon":   "POL",
+}
+
+// Estimate is the estimated network fee of an action, in the chain's native asset.
+type Estimate struct {
+	Chain  string `json:"chain"`
+	Action string `json:"action"`
+	Symbol string `json:"symbol"`
+	// Fee is the human-readable fee in native units, e.g. "0.00042"
+	Fee string `json:"fee"`
+	// FeeUSD is filled in by callers that have a price for the native asset
+	FeeUSD      *float64  `json:"fee_usd,omitempty"`
+	Detail      string    `json:"detail"`
+	EstimatedAt time.Time `json:"estimated_at"`
+}
+
+// Estimator estimates fees on a single chain.
+type Estimator interface {
+	Estimate(ctx context.Context, action string) (*Estimate, error)
+}
+
+// Client estimates network fees through per-chain estimators: EVM chains query a JSON-RPC
+// endpoint for current base and priority fees, UTXO chains an Esplora fee-rate API.
+type Client struct {
+	estimators map[string]Estimator
+	cacheTTL   time.Duration
+	redis      *redis.Client
+	logger     *logrus.Logger
+}
+
+// NewClient creates a new fee estimation Client.
+func NewClient(cfg config.FeeConfig, redisClient *redis.Client, httpClients *httpclient.Factory, logger *logrus.Logger) *Client {
+	httpClient := httpClients.New(10 * time.Second)
+
+	estimators := make(map[string]Estimator, len(cfg.EVMRPCURLs)+len(cfg.UTXOURLs))
+	for chain, url := range cfg.EVMRPCURLs {
+		chain = strings.ToLower(chain)
+		symbol := evmSymbols[chain]
+		if symbol == "" {
+			symbol = "ETH"
+		}
+		estimators[chain] = &evmEstimator{rpcURL: url, symbol: symbol, httpClient: httpClient}
+	}
+	for chain, url := range cfg.UTXOURLs {
+		chain = strings.ToLower(chain)
+		symbol, ok := utxoSymbols[chain]
+		if !ok {
+			logger.WithField("chain", chain).Warn("skipping fee estimator for unknown UTXO chain")
+			continue
+		}
+		estimators[chain] = &utxoEstimator{baseURL: strings.TrimRight(url, "/"), symbol: symbol, httpClient: httpClient}
+	}
+
+	return &Client{
+		estimators: estimators,
+		cacheTTL:   cfg.CacheTTL,
+		redis:      redisClient,
+		logger:     logger,
+	}
+}
+
+// SupportedChains lists the chains fees can be estimated on, sorted.
+func (c *Client) SupportedChains() []string {
+	chains := make([]string, 0, len(c.estimators))
+	for chain := range c.estimators {
+		chains = append(chains, chain)
+	}
+	sort.Strings(chains)
+	return chains
+}
+
+// Estimate returns the estimated fee of an action on a chain. Estimates are cached
+// briefly since fees move with network load.
+func (c *Client) Estimate(ctx context.Context, chain, action string) (*Estimate, error) {
+	chain = strings.ToLower(strings.TrimSpace(chain))
+	estimator, ok := c.estimators[chain]
+	if !ok {
+		return nil, ErrUnsupportedChain
+	}
+
+	cacheKey := estimateCachePrefix + chain + ":" + action
+	if c.redis != nil {
+		if cached, err := c.redis.Get(ctx, cacheKey); err == nil && cached != "" {
+			var estimate Estimate
+			if err := json.Unmarshal([]byte(cached), &estimate); err == nil {
+				return &estimate, nil
+			}
+		}
+	}
+
+	estimate, err := estimator.Estimate(ctx, action)
+	if err != nil {
+		return nil, err
+	}
+	estimate.Chain = chain
+	estimate.Action = action
+	estimate.EstimatedAt = time.Now().UTC()
+
+	if c.redis == nil {
+		return estimate, nil
+	}
+	if data, err := json.Marshal(estimate); err == nil {
+		if err := c.redis.Set(ctx, cacheKey, string(data), c.cacheTTL); err != nil {
+			c.logger.WithError(err).Warn("failed to cache fee estimate")
+		}
+	}
+	return estimate, nil
+}
+
+// formatUnits renders an integer amount with the given decimals as a human-readable
+// decimal string with trailing zeros trimmed.
+func formatUnits(amount *big.Int, decimals int) string {
+	s := new(big.Rat).SetFrac(amount, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)).FloatString(decimals)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	return s
+}
@@ -0,0 +1,125 @@
+package fees
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+)
+
+// fixture returns a recorded response from testdata.
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testClient returns a client estimating fees on ethereum and bitcoin against srv, without
+// Redis or retries.
+func testClient(t *testing.T, srv *httptest.Server) *Client {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	clients, err := httpclient.NewFactory(config.HTTPTransportConfig{}, config.HTTPRetryConfig{MaxAttempts: 1}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(config.FeeConfig{
+		EVMRPCURLs: map[string]string{"Ethereum": srv.URL + "/rpc", "BSC": srv.URL + "/rpc"},
+		UTXOURLs:   map[string]string{"Bitcoin": srv.URL + "/esplora/", "Fakecoin": srv.URL},
+	}, nil, clients, logger)
+}
+
+func TestClientEstimate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rpc":
+			w.Write(fixture(t, rpcFixtures[rpcMethod(t, r)]))
+		case "/esplora/fee-estimates":
+			w.Write(fixture(t, "fee-estimates.json"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	c := testClient(t, srv)
+	ctx := context.Background()
+
+	// Unknown UTXO chains are skipped
+	if got, want := c.SupportedChains(), []string{"bitcoin", "bsc", "ethereum"}; !equal(got, want) {
+		t.Errorf("SupportedChains() = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		chain      string
+		action     string
+		wantSymbol string
+		wantFee    string
+		wantErr    error
+	}{
+		{chain: "Ethereum", action: ActionTransfer, wantSymbol: "ETH", wantFee: "0.000231"},
+		{chain: " bsc ", action: ActionSwap, wantSymbol: "BNB", wantFee: "0.00275"},
+		{chain: "bitcoin", action: ActionTransfer, wantSymbol: "BTC", wantFee: "0.00002637"},
+		{chain: "bitcoin", action: ActionTokenTransfer, wantErr: ErrUnsupportedAction},
+		{chain: "solana", action: ActionTransfer, wantErr: ErrUnsupportedChain},
+	}
+	for _, tt := range tests {
+		t.Run(tt.chain+" "+tt.action, func(t *testing.T) {
+			got, err := c.Estimate(ctx, tt.chain, tt.action)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Estimate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if got.Symbol != tt.wantSymbol || got.Fee != tt.wantFee || got.Action != tt.action || got.EstimatedAt.IsZero() {
+				t.Errorf("Estimate() = %+v, want %s %s for %s", got, tt.wantFee, tt.wantSymbol, tt.action)
+			}
+		})
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals int
+		want     string
+	}{
+		{amount: "231000000000000", decimals: 18, want: "0.000231"},
+		{amount: "1000000000000000000", decimals: 18, want: "1"},
+		{amount: "2637", decimals: 8, want: "0.00002637"},
+		{amount: "1500000000", decimals: 9, want: "1.5"},
+		{amount: "0", decimals: 18, want: "0"},
+	}
+	for _, tt := range tests {
+		amount, _ := new(big.Int).SetString(tt.amount, 10)
+		if got := formatUnits(amount, tt.decimals); got != tt.want {
+			t.Errorf("formatUnits(%s, %d) = %q, want %q", tt.amount, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,136 @@
+package fees
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/vultisig/agent-backend/internal/requestid"
+)
+
+// evmGasLimits are typical gas limits per action. Swaps vary by route, so the figure
+// leans high to avoid underestimating.
+var evmGasLimits = map[string]int64{
+	ActionTransfer:      21000,
+	ActionTokenTransfer: 65000,
+	ActionSwap:          250000,
+}
+
+// evmEstimator estimates fees from the latest base fee and the suggested priority fee.
+type evmEstimator struct {
+	rpcURL     string
+	symbol     string
+	httpClient *http.Client
+}
+
+// Estimate implements Estimator.
+func (e *evmEstimator) Estimate(ctx context.Context, action string) (*Estimate, error) {
+	gasLimit, ok := evmGasLimits[action]
+	if !ok {
+		return nil, ErrUnsupportedAction
+	}
+
+	var block struct {
+		BaseFeePerGas string `json:"baseFeePerGas"`
+	}
+	if err := e.call(ctx, "eth_getBlockByNumber", []any{"latest", false}, &block); err != nil {
+		return nil, fmt.Errorf("get latest block: %w", err)
+	}
+	baseFee, err := parseHexBig(block.BaseFeePerGas)
+	if err != nil {
+		return nil, fmt.Errorf("parse base fee: %w", err)
+	}
+
+	var priorityHex string
+	if err := e.call(ctx, "eth_maxPriorityFeePerGas", []any{}, &priorityHex); err != nil {
+		return nil, fmt.Errorf("get priority fee: %w", err)
+	}
+	priorityFee, err := parseHexBig(priorityHex)
+	if err != nil {
+		return nil, fmt.Errorf("parse priority fee: %w", err)
+	}
+
+	gasPrice := new(big.Int).Add(baseFee, priorityFee)
+	fee := new(big.Int).Mul(gasPrice, big.NewInt(gasLimit))
+
+	return &Estimate{
+		Symbol: e.symbol,
+		Fee:    formatUnits(fee, 18),
+		Detail: fmt.Sprintf("%d gas at %s gwei base + %s gwei priority",
+			gasLimit, formatUnits(baseFee, 9), formatUnits(priorityFee, 9)),
+	}, nil
+}
+
+// parseHexBig parses a 0x-prefixed hex quantity. Pre-London blocks have no base fee, so
+// an empty value parses as zero.
+func parseHexBig(s string) (*big.Int, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if s == "" {
+		return new(big.Int), nil
+	}
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex quantity %q", s)
+	}
+	return n, nil
+}
+
+// rpcRequest is a JSON-RPC 2.0 request.
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response.
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// call performs a JSON-RPC call and decodes the result into out.
+func (e *evmEstimator) call(ctx context.Context, method string, params []any, out any) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.rpcURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	requestid.SetHeader(req)
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var rpcResp rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("rpc error %d: %s", rpcResp.Error.Code, rpcResp.Error.Message)
+	}
+	if err := json.Unmarshal(rpcResp.Result, out); err != nil {
+		return fmt.Errorf("decode result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package fees
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// rpcFixtures maps JSON-RPC methods to their recorded responses.
+var rpcFixtures = map[string]string{
+	"eth_getBlockByNumber":     "eth_getBlockByNumber.json",
+	"eth_maxPriorityFeePerGas": "eth_maxPriorityFeePerGas.json",
+}
+
+// rpcMethod decodes the method of a JSON-RPC request.
+func rpcMethod(t *testing.T, r *http.Request) string {
+	t.Helper()
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		t.Errorf("decode rpc request: %v", err)
+	}
+	return req.Method
+}
+
+func TestEVMEstimator(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		// fixtures overrides rpcFixtures per method
+		fixtures   map[string]string
+		status     int
+		wantFee    string
+		wantDetail string
+		wantErr    string
+		wantErrIs  error
+	}{
+		{
+			name:       "transfer",
+			action:     ActionTransfer,
+			wantFee:    "0.000231",
+			wantDetail: "21000 gas at 10 gwei base + 1 gwei priority",
+		},
+		{
+			name:       "token transfer",
+			action:     ActionTokenTransfer,
+			wantFee:    "0.000715",
+			wantDetail: "65000 gas at 10 gwei base + 1 gwei priority",
+		},
+		{
+			name:       "swap",
+			action:     ActionSwap,
+			wantFee:    "0.00275",
+			wantDetail: "250000 gas at 10 gwei base + 1 gwei priority",
+		},
+		{
+			name:       "block without a base fee",
+			action:     ActionTransfer,
+			fixtures:   map[string]string{"eth_getBlockByNumber": "eth_getBlockByNumber_legacy.json"},
+			wantFee:    "0.000021",
+			wantDetail: "21000 gas at 0 gwei base + 1 gwei priority",
+		},
+		{
+			name:     "rpc error",
+			action:   ActionTransfer,
+			fixtures: map[string]string{"eth_maxPriorityFeePerGas": "rpc_error.json"},
+			wantErr:  "get priority fee: rpc error -32601: the method eth_maxPriorityFeePerGas does not exist",
+		},
+		{
+			name:    "rpc unavailable",
+			action:  ActionTransfer,
+			status:  http.StatusBadGateway,
+			wantErr: "get latest block: unexpected status 502",
+		},
+		{
+			name:      "unknown action",
+			action:    "bridge",
+			wantErrIs: ErrUnsupportedAction,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var methods []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method := rpcMethod(t, r)
+				methods = append(methods, method)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				name, ok := tt.fixtures[method]
+				if !ok {
+					name = rpcFixtures[method]
+				}
+				w.Write(fixture(t, name))
+			}))
+			t.Cleanup(srv.Close)
+			e := &evmEstimator{rpcURL: srv.URL, symbol: "ETH", httpClient: srv.Client()}
+
+			got, err := e.Estimate(context.Background(), tt.action)
+			switch {
+			case tt.wantErrIs != nil:
+				if !errors.Is(err, tt.wantErrIs) {
+					t.Fatalf("Estimate() error = %v, want %v", err, tt.wantErrIs)
+				}
+				if len(methods) != 0 {
+					t.Errorf("called %v for an unknown action, want no calls", methods)
+				}
+				return
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Estimate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("Estimate() error = %v", err)
+			}
+			if got.Symbol != "ETH" || got.Fee != tt.wantFee || got.Detail != tt.wantDetail {
+				t.Errorf("Estimate() = %s %s (%s), want %s ETH (%s)", got.Fee, got.Symbol, got.Detail, tt.wantFee, tt.wantDetail)
+			}
+		})
+	}
+}
+
+func TestParseHexBig(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{s: "0x2540be400", want: "10000000000"},
+		{s: "0X3B9ACA00", want: "1000000000"},
+		{s: "", want: "0"},
+		{s: "0x", want: "0"},
+		{s: "0xzz", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseHexBig(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseHexBig(%q) error = %v, want error %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got.String() != tt.want {
+			t.Errorf("parseHexBig(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
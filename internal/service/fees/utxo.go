@@ -0,0 +1,72 @@
+package fees
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+
+	"github.com/vultisig/agent-backend/internal/requestid"
+)
+
+// utxoTargetBlocks is the confirmation target used to pick a fee rate.
+const utxoTargetBlocks = "3"
+
+// utxoVSizes are typical virtual sizes per action: a one-input, two-output segwit
+// transfer, plus an OP_RETURN memo output for swaps routed through THORChain.
+var utxoVSizes = map[string]int64{
+	ActionTransfer: 141,
+	ActionSwap:     200,
+}
+
+// utxoEstimator estimates fees from an Esplora fee-rate API.
+type utxoEstimator struct {
+	baseURL    string
+	symbol     string
+	httpClient *http.Client
+}
+
+// Estimate implements Estimator.
+func (e *utxoEstimator) Estimate(ctx context.Context, action string) (*Estimate, error) {
+	vsize, ok := utxoVSizes[action]
+	if !ok {
+		return nil, ErrUnsupportedAction
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.baseURL+"/fee-estimates", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	requestid.SetHeader(req)
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Fee rates in sat/vB keyed by confirmation target
+	var rates map[string]float64
+	if err := json.NewDecoder(resp.Body).Decode(&rates); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	rate, ok := rates[utxoTargetBlocks]
+	if !ok {
+		return nil, fmt.Errorf("no fee rate for a %s-block target", utxoTargetBlocks)
+	}
+
+	sats := int64(math.Ceil(rate * float64(vsize)))
+	return &Estimate{
+		Symbol: e.symbol,
+		Fee:    formatUnits(big.NewInt(sats), 8),
+		Detail: fmt.Sprintf("%d vB at %.1f sat/vB", vsize, rate),
+	}, nil
+}
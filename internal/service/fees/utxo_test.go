@@ -0,0 +1,70 @@
+package fees
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUTXOEstimator(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		body       string
+		status     int
+		wantFee    string
+		wantDetail string
+		wantErr    string
+		wantErrIs  error
+	}{
+		{name: "transfer", action: ActionTransfer, wantFee: "0.00002637", wantDetail: "141 vB at 18.7 sat/vB"},
+		{name: "swap", action: ActionSwap, wantFee: "0.0000374", wantDetail: "200 vB at 18.7 sat/vB"},
+		{name: "token transfer", action: ActionTokenTransfer, wantErrIs: ErrUnsupportedAction},
+		{name: "no rate for the target", action: ActionTransfer, body: `{"1":25.3,"144":3.5}`, wantErr: "no fee rate for a 3-block target"},
+		{name: "api unavailable", action: ActionTransfer, status: http.StatusServiceUnavailable, wantErr: "unexpected status 503"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/fee-estimates" {
+					http.NotFound(w, r)
+					return
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				if tt.body != "" {
+					w.Write([]byte(tt.body))
+					return
+				}
+				w.Write(fixture(t, "fee-estimates.json"))
+			}))
+			t.Cleanup(srv.Close)
+			e := &utxoEstimator{baseURL: srv.URL, symbol: "BTC", httpClient: srv.Client()}
+
+			got, err := e.Estimate(context.Background(), tt.action)
+			switch {
+			case tt.wantErrIs != nil:
+				if !errors.Is(err, tt.wantErrIs) {
+					t.Fatalf("Estimate() error = %v, want %v", err, tt.wantErrIs)
+				}
+				return
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Estimate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			case err != nil:
+				t.Fatalf("Estimate() error = %v", err)
+			}
+			// Fees round up to a whole satoshi
+			if got.Symbol != "BTC" || got.Fee != tt.wantFee || got.Detail != tt.wantDetail {
+				t.Errorf("Estimate() = %s %s (%s), want %s BTC (%s)", got.Fee, got.Symbol, got.Detail, tt.wantFee, tt.wantDetail)
+			}
+		})
+	}
+}
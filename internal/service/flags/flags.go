@@ -0,0 +1,216 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/cache/redis"
+	"github.com/vultisig/agent-backend/internal/config"
+)
+
+// Flag names. Each switches off an expensive feature when disabled.
+const (
+	Memory        = "memory"
+	Summarization = "summarization"
+	Suggestions   = "suggestions"
+	Tools         = "tools"
+)
+
+const (
+	// overrideKeyPrefix is the Redis key prefix for runtime flag overrides.
+	overrideKeyPrefix = "flags:"
+	// changesChannel is the pub/sub channel announcing changed flags to every replica.
+	changesChannel = "flags_changed"
+	// readTimeout bounds a flag read so a slow Redis can't stall requests.
+	readTimeout = 250 * time.Millisecond
+	// resubscribeDelay is the pause before resubscribing after the subscription failed.
+	resubscribeDelay = 2 * time.Second
+)
+
+// ErrUnknownFlag is returned for flag names not listed above.
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+// Flag is the state of a feature flag.
+type Flag struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Default bool   `json:"default"`
+	// Overridden is set when a runtime override is in effect
+	Overridden bool `json:"overridden"`
+}
+
+// cachedFlag is a flag value read from Redis.
+type cachedFlag struct {
+	enabled   bool
+	fetchedAt time.Time
+}
+
+// Store serves feature flags: config defaults, overridden at runtime by values stored in
+// Redis. Reads are cached per replica for up to the cache TTL; changes made through Set
+// and Reset are announced over pub/sub so other replicas drop their cached value at once.
+// Any Redis failure yields the config default.
+type Store struct {
+	redis    *redis.Client
+	defaults map[string]bool
+	cacheTTL time.Duration
+	logger   *logrus.Logger
+
+	mu    sync.Mutex
+	cache map[string]cachedFlag
+}
+
+// NewStore creates a flag store. A nil Redis client serves the config defaults only.
+func NewStore(redisClient *redis.Client, cfg config.FlagsConfig, logger *logrus.Logger) *Store {
+	return &Store{
+		redis: redisClient,
+		defaults: map[string]bool{
+			Memory:        cfg.Memory,
+			Summarization: cfg.Summarization,
+			Suggestions:   cfg.Suggestions,
+			Tools:         cfg.Tools,
+		},
+		cacheTTL: cfg.CacheTTL,
+		logger:   logger,
+		cache:    make(map[string]cachedFlag),
+	}
+}
+
+// Enabled reports whether the named flag is on. Unknown flags are off.
+func (s *Store) Enabled(ctx context.Context, name string) bool {
+	def, ok := s.defaults[name]
+	if !ok {
+		return false
+	}
+
+	s.mu.Lock()
+	cached, ok := s.cache[name]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < s.cacheTTL {
+		return cached.enabled
+	}
+
+	enabled, _ := s.read(ctx, name, def)
+	s.mu.Lock()
+	s.cache[name] = cachedFlag{enabled: enabled, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return enabled
+}
+
+// read returns the flag's current value from Redis and whether it is overridden, falling
+// back to def when there is no override or Redis can't be read.
+func (s *Store) read(ctx context.Context, name string, def bool) (bool, bool) {
+	if s.redis == nil {
+		return def, false
+	}
+
+	readCtx, cancel := context.WithTimeout(ctx, readTimeout)
+	defer cancel()
+	// The wrapper doesn't tell a missing key from a failed read; both mean the default
+	val, err := s.redis.Get(readCtx, overrideKeyPrefix+name)
+	if err != nil || val == "" {
+		return def, false
+	}
+	enabled, err := strconv.ParseBool(val)
+	if err != nil {
+		s.logger.WithField("flag", name).Warn("ignoring malformed feature flag override")
+		return def, false
+	}
+	return enabled, true
+}
+
+// List returns the current state of every flag, read from Redis rather than the cache.
+func (s *Store) List(ctx context.Context) []Flag {
+	names := make([]string, 0, len(s.defaults))
+	for name := range s.defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]Flag, 0, len(names))
+	for _, name := range names {
+		def := s.defaults[name]
+		enabled, overridden := s.read(ctx, name, def)
+		out = append(out, Flag{Name: name, Enabled: enabled, Default: def, Overridden: overridden})
+	}
+	return out
+}
+
+// Set overrides a flag on every replica until Reset.
+func (s *Store) Set(ctx context.Context, name string, enabled bool) error {
+	if _, ok := s.defaults[name]; !ok {
+		return ErrUnknownFlag
+	}
+	if s.redis == nil {
+		return errors.New("feature flag overrides need redis")
+	}
+	if err := s.redis.Set(ctx, overrideKeyPrefix+name, strconv.FormatBool(enabled), 0); err != nil {
+		return fmt.Errorf("store flag override: %w", err)
+	}
+	s.announce(ctx, name)
+	return nil
+}
+
+// Reset removes a flag's override so the config default applies again.
+func (s *Store) Reset(ctx context.Context, name string) error {
+	if _, ok := s.defaults[name]; !ok {
+		return ErrUnknownFlag
+	}
+	if s.redis == nil {
+		return nil
+	}
+	if err := s.redis.Delete(ctx, overrideKeyPrefix+name); err != nil {
+		return fmt.Errorf("delete flag override: %w", err)
+	}
+	s.announce(ctx, name)
+	return nil
+}
+
+// announce drops the local cached value and tells other replicas to do the same. A lost
+// announcement only delays the change until their cache expires.
+func (s *Store) announce(ctx context.Context, name string) {
+	s.invalidate(name)
+	if err := s.redis.Publish(ctx, changesChannel, name); err != nil {
+		s.logger.WithError(err).WithField("flag", name).Warn("failed to announce feature flag change")
+	}
+}
+
+// invalidate drops the cached value of a flag, or of every flag when name is empty.
+func (s *Store) invalidate(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		clear(s.cache)
+		return
+	}
+	delete(s.cache, name)
+}
+
+// Run listens for flag changes made on other replicas until ctx is done, resubscribing
+// after failures.
+func (s *Store) Run(ctx context.Context) {
+	if s.redis == nil {
+		return
+	}
+	for {
+		// Changes made while unsubscribed weren't seen; start from fresh values
+		s.invalidate("")
+		err := s.redis.Subscribe(ctx, changesChannel, s.invalidate)
+		if ctx.Err() != nil {
+			return
+		}
+		s.logger.WithError(err).Warn("feature flag subscription failed, resubscribing")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
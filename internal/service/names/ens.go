@@ -0,0 +1,95 @@
+package names
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// ensRegistry is the ENS registry contract on Ethereum mainnet.
+	ensRegistry = "0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e"
+	// resolverSelector is the selector of resolver(bytes32) on the registry.
+	resolverSelector = "0178b8bf"
+	// addrSelector is the selector of addr(bytes32) on a public resolver.
+	addrSelector = "3b3b57de"
+)
+
+// resolveENS resolves an ENS name through the registry and the name's resolver contract.
+func (r *Resolver) resolveENS(ctx context.Context, name string) (*Resolution, error) {
+	node := hex.EncodeToString(namehash(name))
+
+	resolver, err := r.ethCallAddress(ctx, ensRegistry, resolverSelector+node)
+	if err != nil {
+		return nil, fmt.Errorf("get resolver: %w", err)
+	}
+	if resolver == "" {
+		return nil, ErrNotFound
+	}
+
+	addr, err := r.ethCallAddress(ctx, resolver, addrSelector+node)
+	if err != nil {
+		return nil, fmt.Errorf("get address: %w", err)
+	}
+	if addr == "" {
+		return nil, ErrNotFound
+	}
+
+	return &Resolution{Name: name, Chain: "ethereum", Address: checksumAddress(addr)}, nil
+}
+
+// ethCallAddress calls a contract and decodes a single address return value. It returns an
+// empty string for the zero address.
+func (r *Resolver) ethCallAddress(ctx context.Context, to, data string) (string, error) {
+	var result string
+	params := []any{map[string]string{"to": to, "data": "0x" + data}, "latest"}
+	if err := r.call(ctx, r.ethRPCURL, "eth_call", params, &result); err != nil {
+		return "", err
+	}
+
+	word := strings.TrimPrefix(result, "0x")
+	if len(word) < 64 {
+		return "", nil
+	}
+	addr := word[24:64]
+	if strings.Trim(addr, "0") == "" {
+		return "", nil
+	}
+	return "0x" + addr, nil
+}
+
+// namehash computes the ENS namehash (EIP-137) of a normalized name.
+func namehash(name string) []byte {
+	node := make([]byte, 32)
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = keccak256(append(node, keccak256([]byte(labels[i]))...))
+	}
+	return node
+}
+
+// checksumAddress returns the EIP-55 mixed-case checksum form of a hex address.
+func checksumAddress(addr string) string {
+	lower := strings.ToLower(strings.TrimPrefix(addr, "0x"))
+	hash := hex.EncodeToString(keccak256([]byte(lower)))
+
+	out := []byte(lower)
+	for i, c := range out {
+		if c >= 'a' && c <= 'f' && hash[i] >= '8' {
+			out[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(out)
+}
+
+func keccak256(data []byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	h.Write(data)
+	return h.Sum(nil)
+}
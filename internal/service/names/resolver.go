@@ -0,0 +1,167 @@
+package names
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/cache/redis"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/requestid"
+)
+
+// cacheKeyPrefix is the Redis key prefix for cached resolutions.
+const cacheKeyPrefix = "names:"
+
+// ErrNotFound is returned when a name has no registered address.
+var ErrNotFound = errors.New("name not registered")
+
+// nameRe matches ENS (.eth) and SNS (.sol) names.
+var nameRe = regexp.MustCompile(`(?i)^([a-z0-9-]+\.)+(eth|sol)$`)
+
+// Resolution is a name resolved to an address.
+type Resolution struct {
+	Name    string `json:"name"`
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+}
+
+// Resolver resolves ENS names on Ethereum and SNS names on Solana through JSON-RPC.
+type Resolver struct {
+	ethRPCURL  string
+	solRPCURL  string
+	cacheTTL   time.Duration
+	redis      *redis.Client
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewResolver creates a new Resolver.
+func NewResolver(cfg config.NameServiceConfig, redisClient *redis.Client, httpClients *httpclient.Factory, logger *logrus.Logger) *Resolver {
+	return &Resolver{
+		ethRPCURL:  cfg.EthereumRPCURL,
+		solRPCURL:  cfg.SolanaRPCURL,
+		cacheTTL:   cfg.CacheTTL,
+		redis:      redisClient,
+		httpClient: httpClients.New(10 * time.Second),
+		logger:     logger,
+	}
+}
+
+// IsName reports whether s looks like an ENS or SNS name rather than an address.
+func IsName(s string) bool {
+	return nameRe.MatchString(strings.TrimSpace(s))
+}
+
+// Resolve returns the address a name points to. Results are cached in Redis; failures are not.
+func (r *Resolver) Resolve(ctx context.Context, name string) (*Resolution, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !IsName(name) {
+		return nil, fmt.Errorf("unsupported name %q", name)
+	}
+
+	if cached := r.cached(ctx, name); cached != nil {
+		return cached, nil
+	}
+
+	var res *Resolution
+	var err error
+	if strings.HasSuffix(name, ".eth") {
+		res, err = r.resolveENS(ctx, name)
+	} else {
+		res, err = r.resolveSNS(ctx, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if r.redis != nil {
+		if data, err := json.Marshal(res); err == nil {
+			if err := r.redis.Set(ctx, cacheKeyPrefix+name, string(data), r.cacheTTL); err != nil {
+				r.logger.WithError(err).Warn("failed to cache name resolution")
+			}
+		}
+	}
+	return res, nil
+}
+
+// cached returns a cached resolution, or nil on a miss.
+func (r *Resolver) cached(ctx context.Context, name string) *Resolution {
+	if r.redis == nil {
+		return nil
+	}
+	data, err := r.redis.Get(ctx, cacheKeyPrefix+name)
+	if err != nil || data == "" {
+		return nil
+	}
+	var res Resolution
+	if err := json.Unmarshal([]byte(data), &res); err != nil {
+		return nil
+	}
+	return &res
+}
+
+// rpcRequest is a JSON-RPC 2.0 request.
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  []any  `json:"params"`
+}
+
+// rpcResponse is a JSON-RPC 2.0 response.
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// call performs a JSON-RPC call and decodes the result into out.
+func (r *Resolver) call(ctx context.Context, url, method string, params []any, out any) error {
+	body, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	requestid.SetHeader(req)
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var rpcResp rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	if rpcResp.Error != nil {
+		return fmt.Errorf("rpc error %d: %s", rpcResp.Error.Code, rpcResp.Error.Message)
+	}
+	if err := json.Unmarshal(rpcResp.Result, out); err != nil {
+		return fmt.Errorf("decode result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package names
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"filippo.io/edwards25519"
+)
+
+const (
+	// snsProgramID is the Solana Name Service program.
+	snsProgramID = "namesLPneVptA9Z5rqUDD9tMTWEJwofgaYwp8cawRkX"
+	// solTLDAuthority is the parent account of all .sol names.
+	solTLDAuthority = "58PwtjSDuFHuUkYjH9BYnnQKHfwo9reZhC2zMJv9JPkx"
+	// hashPrefix is prepended to names before hashing them into account seeds.
+	hashPrefix = "SPL Name Service"
+	// nameRecordHeaderSize is the size of the parent, owner and class fields of a name record.
+	nameRecordHeaderSize = 96
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// resolveSNS resolves a .sol name to the owner of its name account.
+func (r *Resolver) resolveSNS(ctx context.Context, name string) (*Resolution, error) {
+	label := strings.TrimSuffix(name, ".sol")
+	if strings.Contains(label, ".") {
+		return nil, fmt.Errorf("subdomains are not supported: %s", name)
+	}
+
+	account, err := nameAccountKey(label)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Value *struct {
+			Data []string `json:"data"`
+		} `json:"value"`
+	}
+	params := []any{account, map[string]string{"encoding": "base64"}}
+	if err := r.call(ctx, r.solRPCURL, "getAccountInfo", params, &result); err != nil {
+		return nil, fmt.Errorf("get name account: %w", err)
+	}
+	if result.Value == nil || len(result.Value.Data) == 0 {
+		return nil, ErrNotFound
+	}
+
+	data, err := base64.StdEncoding.DecodeString(result.Value.Data[0])
+	if err != nil {
+		return nil, fmt.Errorf("decode name account: %w", err)
+	}
+	if len(data) < nameRecordHeaderSize {
+		return nil, errors.New("name account too short")
+	}
+
+	owner := data[32:64]
+	return &Resolution{Name: name, Chain: "solana", Address: base58Encode(owner)}, nil
+}
+
+// nameAccountKey derives the name account address of a .sol label.
+func nameAccountKey(label string) (string, error) {
+	hashed := sha256.Sum256([]byte(hashPrefix + label))
+	parent, err := base58Decode(solTLDAuthority)
+	if err != nil {
+		return "", err
+	}
+	program, err := base58Decode(snsProgramID)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := findProgramAddress([][]byte{hashed[:], make([]byte, 32), parent}, program)
+	if err != nil {
+		return "", err
+	}
+	return base58Encode(key), nil
+}
+
+// findProgramAddress derives a program address: the first bump seed, counting down from
+// 255, whose hash is not a valid ed25519 point.
+func findProgramAddress(seeds [][]byte, program []byte) ([]byte, error) {
+	for bump := 255; bump >= 0; bump-- {
+		h := sha256.New()
+		for _, seed := range seeds {
+			h.Write(seed)
+		}
+		h.Write([]byte{byte(bump)})
+		h.Write(program)
+		h.Write([]byte("ProgramDerivedAddress"))
+		key := h.Sum(nil)
+
+		if _, err := new(edwards25519.Point).SetBytes(key); err != nil {
+			return key, nil
+		}
+	}
+	return nil, errors.New("no valid program address")
+}
+
+func base58Encode(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		idx := strings.IndexRune(base58Alphabet, c)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+
+	decoded := n.Bytes()
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), decoded...), nil
+}
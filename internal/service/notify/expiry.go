@@ -0,0 +1,127 @@
+// Package notify tells users through a webhook when a policy draft or a reply's suggestions
+// are about to expire, so the app can bring them back before they have to start over.
+package notify
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/outbox"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// Webhook event types, by the kind of item expiring.
+var eventTypes = map[string]string{
+	types.ExpiryNoticeDraft:      "draft_expiring",
+	types.ExpiryNoticeSuggestion: "suggestion_expiring",
+}
+
+// ExpiryEvent is the webhook body sent for an expiring item. ID identifies the notice, so a
+// receiver can drop redeliveries.
+type ExpiryEvent struct {
+	ID             uuid.UUID `json:"id"`
+	Type           string    `json:"type"`
+	ConversationID uuid.UUID `json:"conversation_id"`
+	PublicKey      string    `json:"public_key"`
+	RefID          string    `json:"ref_id"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	ResumeURL      string    `json:"resume_url"`
+}
+
+// NoticeStore claims and prunes expiry notices.
+type NoticeStore interface {
+	ClaimDue(ctx context.Context, window time.Duration, batchSize int, dispatchAfter time.Time, event func(*types.ExpiryNotice) (*types.OutboxEvent, error)) ([]*types.OutboxEvent, error)
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+var _ NoticeStore = (*postgres.ExpiryNoticeRepository)(nil)
+
+// ExpiryNotifier periodically claims notices about to expire and sends them through the
+// outbox, which retries failed webhook calls.
+type ExpiryNotifier struct {
+	repo       NoticeStore
+	dispatcher *outbox.Dispatcher
+	logger     *logrus.Logger
+
+	window       time.Duration
+	scanInterval time.Duration
+	batchSize    int
+	resumeURL    string
+}
+
+// NewExpiryNotifier creates a new ExpiryNotifier. The dispatcher must have a KindWebhook
+// handler registered.
+func NewExpiryNotifier(repo NoticeStore, dispatcher *outbox.Dispatcher, logger *logrus.Logger, cfg config.NotifyConfig) *ExpiryNotifier {
+	return &ExpiryNotifier{
+		repo:         repo,
+		dispatcher:   dispatcher,
+		logger:       logger,
+		window:       cfg.Window,
+		scanInterval: cfg.ScanInterval,
+		batchSize:    cfg.BatchSize,
+		resumeURL:    cfg.ResumeURL,
+	}
+}
+
+// Run scans for notices due until ctx is cancelled.
+func (n *ExpiryNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.scanInterval)
+	defer ticker.Stop()
+
+	lastPrune := time.Time{}
+	for {
+		n.notifyDue(ctx)
+
+		if time.Since(lastPrune) > time.Hour {
+			// Expired items can't be resumed, so their notices are no longer needed
+			if err := n.repo.DeleteExpired(ctx, time.Now().Add(-time.Hour)); err != nil {
+				n.logger.WithError(err).Warn("failed to prune expiry notices")
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notifyDue claims due notices in batches until none are left, delivering each batch right
+// away. Deliveries that fail are retried by the outbox dispatcher.
+func (n *ExpiryNotifier) notifyDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := n.repo.ClaimDue(ctx, n.window, n.batchSize, n.dispatcher.DispatchAfter(), n.event)
+		if err != nil {
+			n.logger.WithError(err).Error("failed to claim expiry notices")
+			return
+		}
+		if len(events) > 0 {
+			n.logger.WithField("count", len(events)).Info("sending expiry notices")
+			n.dispatcher.Deliver(ctx, events)
+		}
+		if len(events) < n.batchSize {
+			return
+		}
+	}
+}
+
+// event builds the webhook event for a claimed notice.
+func (n *ExpiryNotifier) event(notice *types.ExpiryNotice) (*types.OutboxEvent, error) {
+	return outbox.NewWebhookEvent(ExpiryEvent{
+		ID:             notice.ID,
+		Type:           eventTypes[notice.Kind],
+		ConversationID: notice.ConversationID,
+		PublicKey:      notice.PublicKey,
+		RefID:          notice.RefID,
+		ExpiresAt:      notice.ExpiresAt,
+		ResumeURL:      strings.ReplaceAll(n.resumeURL, "{conversation_id}", notice.ConversationID.String()),
+	})
+}
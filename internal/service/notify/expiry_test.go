@@ -0,0 +1,299 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/outbox"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+const (
+	testOwner  = "test-public-key"
+	testSecret = "test-secret"
+)
+
+// fakeNoticeStore keeps notices in memory with the claim rules of the expiry notice queries.
+type fakeNoticeStore struct {
+	mu      sync.Mutex
+	notices []*types.ExpiryNotice
+}
+
+// add tracks a notice for an item expiring at expiresAt.
+func (f *fakeNoticeStore) add(kind string, expiresAt time.Time) *types.ExpiryNotice {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	notice := &types.ExpiryNotice{
+		ID:             uuid.New(),
+		Kind:           kind,
+		RefID:          uuid.NewString(),
+		ConversationID: uuid.New(),
+		ExpiresAt:      expiresAt,
+		CreatedAt:      time.Now(),
+	}
+	f.notices = append(f.notices, notice)
+	return notice
+}
+
+func (f *fakeNoticeStore) ClaimDue(_ context.Context, window time.Duration, batchSize int, dispatchAfter time.Time, event func(*types.ExpiryNotice) (*types.OutboxEvent, error)) ([]*types.OutboxEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	var due []*types.ExpiryNotice
+	for _, n := range f.notices {
+		if n.NotifiedAt == nil && n.ExpiresAt.After(now) && !n.ExpiresAt.After(now.Add(window)) {
+			due = append(due, n)
+		}
+	}
+	slices.SortFunc(due, func(a, b *types.ExpiryNotice) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+	if len(due) > batchSize {
+		due = due[:batchSize]
+	}
+
+	var events []*types.OutboxEvent
+	for _, n := range due {
+		claimed := *n
+		claimed.NotifiedAt = &now
+		claimed.PublicKey = testOwner
+		e, err := event(&claimed)
+		if err != nil {
+			return nil, err
+		}
+		e.ID = uuid.New()
+		e.CreatedAt = now
+		events = append(events, e)
+		n.NotifiedAt = &now
+	}
+	return events, nil
+}
+
+func (f *fakeNoticeStore) DeleteExpired(context.Context, time.Time) error {
+	return nil
+}
+
+// fakeOutbox records how each delivered event ended.
+type fakeOutbox struct {
+	mu        sync.Mutex
+	completed []uuid.UUID
+	failed    []uuid.UUID
+}
+
+func (f *fakeOutbox) Claim(context.Context, int, int, time.Time) ([]types.OutboxEvent, error) {
+	return nil, nil
+}
+
+func (f *fakeOutbox) Complete(_ context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.completed = append(f.completed, id)
+	return nil
+}
+
+func (f *fakeOutbox) Fail(_ context.Context, id uuid.UUID, _ string, _ time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failed = append(f.failed, id)
+	return nil
+}
+
+func (f *fakeOutbox) DeleteCompleted(context.Context, time.Time) error {
+	return nil
+}
+
+// sinkDelivery is a webhook call received by the fake sink.
+type sinkDelivery struct {
+	event      ExpiryEvent
+	signed     bool
+	receivedAt time.Time
+}
+
+// fakeSink is a webhook receiver that records every call, answering with status.
+type fakeSink struct {
+	t      *testing.T
+	mu     sync.Mutex
+	status int
+	calls  []sinkDelivery
+}
+
+func newFakeSink(t *testing.T) (*fakeSink, *httptest.Server) {
+	sink := &fakeSink{t: t, status: http.StatusNoContent}
+	srv := httptest.NewServer(sink)
+	t.Cleanup(srv.Close)
+	return sink, srv
+}
+
+func (s *fakeSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		s.t.Errorf("read webhook body: %v", err)
+	}
+	var event ExpiryEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		s.t.Errorf("decode webhook body %s: %v", body, err)
+	}
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write(body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, sinkDelivery{
+		event:      event,
+		signed:     r.Header.Get(outbox.SignatureHeader) == hex.EncodeToString(mac.Sum(nil)),
+		receivedAt: time.Now(),
+	})
+	w.WriteHeader(s.status)
+}
+
+func (s *fakeSink) deliveries() []sinkDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.calls)
+}
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// testNotifier wires a notifier to the fake store and the fake sink through a real outbox
+// dispatcher.
+func testNotifier(store NoticeStore, box outbox.Store, sinkURL string, cfg config.NotifyConfig) *ExpiryNotifier {
+	dispatcher := outbox.NewDispatcher(box, testLogger(), config.OutboxConfig{
+		PollInterval:  time.Hour,
+		BatchSize:     10,
+		MaxAttempts:   5,
+		RetryBase:     time.Second,
+		FastPathGrace: 30 * time.Second,
+	})
+	dispatcher.Register(outbox.KindWebhook, outbox.WebhookHandler(&http.Client{Timeout: 5 * time.Second}, sinkURL, testSecret))
+	cfg.ResumeURL = "vultisig://agent/conversations/{conversation_id}"
+	return NewExpiryNotifier(store, dispatcher, testLogger(), cfg)
+}
+
+func TestNotifyDue(t *testing.T) {
+	sink, srv := newFakeSink(t)
+	store := &fakeNoticeStore{}
+	box := &fakeOutbox{}
+	n := testNotifier(store, box, srv.URL, config.NotifyConfig{Window: 2 * time.Second, BatchSize: 2})
+
+	now := time.Now()
+	store.add(types.ExpiryNoticeDraft, now.Add(-time.Second))
+	later := store.add(types.ExpiryNoticeSuggestion, now.Add(1500*time.Millisecond))
+	first := store.add(types.ExpiryNoticeDraft, now.Add(500*time.Millisecond))
+	second := store.add(types.ExpiryNoticeSuggestion, now.Add(time.Second))
+	store.add(types.ExpiryNoticeDraft, now.Add(time.Minute))
+
+	n.notifyDue(context.Background())
+
+	// Everything inside the window is sent, soonest first and across batches; expired
+	// items and those outside the window are not
+	got := sink.deliveries()
+	want := []*types.ExpiryNotice{first, second, later}
+	if len(got) != len(want) {
+		t.Fatalf("sink got %d webhooks, want %d", len(got), len(want))
+	}
+	for i, notice := range want {
+		event := got[i].event
+		wantEvent := ExpiryEvent{
+			ID:             notice.ID,
+			Type:           eventTypes[notice.Kind],
+			ConversationID: notice.ConversationID,
+			PublicKey:      testOwner,
+			RefID:          notice.RefID,
+			ExpiresAt:      notice.ExpiresAt,
+			ResumeURL:      "vultisig://agent/conversations/" + notice.ConversationID.String(),
+		}
+		if !event.ExpiresAt.Equal(wantEvent.ExpiresAt) {
+			t.Errorf("webhook %d expires_at = %v, want %v", i, event.ExpiresAt, wantEvent.ExpiresAt)
+		}
+		event.ExpiresAt = wantEvent.ExpiresAt
+		if event != wantEvent {
+			t.Errorf("webhook %d = %+v, want %+v", i, event, wantEvent)
+		}
+		if !got[i].signed {
+			t.Errorf("webhook %d has no valid %s header", i, outbox.SignatureHeader)
+		}
+	}
+	if len(box.completed) != len(want) || len(box.failed) != 0 {
+		t.Errorf("outbox completed %d and failed %d events, want %d completed", len(box.completed), len(box.failed), len(want))
+	}
+
+	// Claimed notices aren't sent again on the next scan
+	n.notifyDue(context.Background())
+	if got := sink.deliveries(); len(got) != len(want) {
+		t.Errorf("sink got %d webhooks after a second scan, want still %d", len(got), len(want))
+	}
+}
+
+func TestNotifyDueFailedDelivery(t *testing.T) {
+	sink, srv := newFakeSink(t)
+	sink.status = http.StatusServiceUnavailable
+	store := &fakeNoticeStore{}
+	box := &fakeOutbox{}
+	n := testNotifier(store, box, srv.URL, config.NotifyConfig{Window: time.Second, BatchSize: 10})
+
+	store.add(types.ExpiryNoticeDraft, time.Now().Add(500*time.Millisecond))
+	n.notifyDue(context.Background())
+	n.notifyDue(context.Background())
+
+	// A failed call is left to the outbox to retry; the notifier doesn't claim it again
+	if got := sink.deliveries(); len(got) != 1 {
+		t.Errorf("sink got %d webhooks, want 1", len(got))
+	}
+	if len(box.failed) != 1 || len(box.completed) != 0 {
+		t.Errorf("outbox failed %d and completed %d events, want 1 failed", len(box.failed), len(box.completed))
+	}
+}
+
+func TestRunNotifiesOnceInWindow(t *testing.T) {
+	sink, srv := newFakeSink(t)
+	store := &fakeNoticeStore{}
+	const window = 200 * time.Millisecond
+	n := testNotifier(store, &fakeOutbox{}, srv.URL, config.NotifyConfig{
+		Window:       window,
+		ScanInterval: 10 * time.Millisecond,
+		BatchSize:    10,
+	})
+
+	notice := store.add(types.ExpiryNoticeSuggestion, time.Now().Add(400*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		n.Run(ctx)
+		close(done)
+	}()
+	// Keep scanning until the item has expired
+	time.Sleep(time.Until(notice.ExpiresAt) + 50*time.Millisecond)
+	cancel()
+	<-done
+
+	got := sink.deliveries()
+	if len(got) != 1 {
+		t.Fatalf("sink got %d webhooks, want exactly 1", len(got))
+	}
+	if got[0].event.ID != notice.ID {
+		t.Errorf("webhook for notice %s, want %s", got[0].event.ID, notice.ID)
+	}
+	if opens := notice.ExpiresAt.Add(-window); got[0].receivedAt.Before(opens) {
+		t.Errorf("webhook sent at %v, before the window opened at %v", got[0].receivedAt, opens)
+	}
+	if !got[0].receivedAt.Before(notice.ExpiresAt) {
+		t.Errorf("webhook sent at %v, after the item expired at %v", got[0].receivedAt, notice.ExpiresAt)
+	}
+}
@@ -0,0 +1,180 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+const (
+	// leaseDuration is how long a claimed event is hidden from other dispatchers while it is delivered.
+	leaseDuration = time.Minute
+	// maxRetryDelay caps the exponential backoff between delivery attempts.
+	maxRetryDelay = 10 * time.Minute
+)
+
+// Handler delivers a single event payload. Handlers must be idempotent: an event can be
+// delivered more than once if the process dies between delivery and completion.
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Store keeps the delivery state of outbox events.
+// *postgres.OutboxRepository is the production implementation.
+type Store interface {
+	Claim(ctx context.Context, batchSize, maxAttempts int, leaseUntil time.Time) ([]types.OutboxEvent, error)
+	Complete(ctx context.Context, id uuid.UUID) error
+	Fail(ctx context.Context, id uuid.UUID, deliveryErr string, nextAttemptAt time.Time) error
+	DeleteCompleted(ctx context.Context, before time.Time) error
+}
+
+var _ Store = (*postgres.OutboxRepository)(nil)
+
+// Dispatcher delivers outbox events. Callers attempt delivery immediately after the
+// message transaction commits (fast path); Run picks up anything left behind by
+// failures or crashes.
+type Dispatcher struct {
+	repo   Store
+	logger *logrus.Logger
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+
+	pollInterval  time.Duration
+	batchSize     int
+	maxAttempts   int
+	retryBase     time.Duration
+	fastPathGrace time.Duration
+	retention     time.Duration
+}
+
+// NewDispatcher creates a new Dispatcher.
+func NewDispatcher(repo Store, logger *logrus.Logger, cfg config.OutboxConfig) *Dispatcher {
+	return &Dispatcher{
+		repo:          repo,
+		logger:        logger,
+		handlers:      make(map[string]Handler),
+		pollInterval:  cfg.PollInterval,
+		batchSize:     cfg.BatchSize,
+		maxAttempts:   cfg.MaxAttempts,
+		retryBase:     cfg.RetryBase,
+		fastPathGrace: cfg.FastPathGrace,
+		retention:     cfg.Retention,
+	}
+}
+
+// Register sets the handler for an event kind.
+func (d *Dispatcher) Register(kind string, h Handler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers[kind] = h
+}
+
+// DispatchAfter returns when newly created events become due for the background loop.
+// The grace period leaves room for the fast path so both don't deliver the same event.
+func (d *Dispatcher) DispatchAfter() time.Time {
+	return time.Now().Add(d.fastPathGrace)
+}
+
+// Deliver attempts delivery of freshly committed events right away. Failed events are
+// left to the background loop.
+func (d *Dispatcher) Deliver(ctx context.Context, events []*types.OutboxEvent) {
+	for _, event := range events {
+		d.deliver(ctx, event)
+	}
+}
+
+// Run polls for due events until ctx is cancelled. The first pass runs immediately so
+// events left pending by a crash are recovered on startup.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	lastPrune := time.Time{}
+	for {
+		d.processDue(ctx)
+
+		if time.Since(lastPrune) > time.Hour {
+			if err := d.repo.DeleteCompleted(ctx, time.Now().Add(-d.retention)); err != nil {
+				d.logger.WithError(err).Warn("failed to prune completed outbox events")
+			}
+			lastPrune = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processDue claims and delivers due events until none are left.
+func (d *Dispatcher) processDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := d.repo.Claim(ctx, d.batchSize, d.maxAttempts, time.Now().Add(leaseDuration))
+		if err != nil {
+			d.logger.WithError(err).Error("failed to claim outbox events")
+			return
+		}
+		for i := range events {
+			d.deliver(ctx, &events[i])
+		}
+		if len(events) < d.batchSize {
+			return
+		}
+	}
+}
+
+// deliver runs the handler for one event and records the outcome.
+func (d *Dispatcher) deliver(ctx context.Context, event *types.OutboxEvent) {
+	err := d.handle(ctx, event)
+	if err == nil {
+		if err := d.repo.Complete(ctx, event.ID); err != nil {
+			d.logger.WithError(err).WithField("event_id", event.ID).Warn("failed to mark outbox event complete")
+		}
+		return
+	}
+
+	attempt := event.Attempts + 1
+	logger := d.logger.WithError(err).WithFields(logrus.Fields{
+		"event_id": event.ID,
+		"kind":     event.Kind,
+		"attempt":  attempt,
+	})
+	if attempt >= d.maxAttempts {
+		logger.Error("outbox event failed permanently")
+	} else {
+		logger.Warn("outbox event delivery failed")
+	}
+
+	if err := d.repo.Fail(ctx, event.ID, err.Error(), time.Now().Add(d.retryDelay(attempt))); err != nil {
+		d.logger.WithError(err).WithField("event_id", event.ID).Warn("failed to record outbox event failure")
+	}
+}
+
+func (d *Dispatcher) handle(ctx context.Context, event *types.OutboxEvent) error {
+	d.mu.RLock()
+	h, ok := d.handlers[event.Kind]
+	d.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no handler for outbox event kind %q", event.Kind)
+	}
+	return h(ctx, event.Payload)
+}
+
+// retryDelay returns the exponential backoff before the given attempt number is retried.
+func (d *Dispatcher) retryDelay(attempt int) time.Duration {
+	delay := d.retryBase
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
@@ -0,0 +1,272 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// storedEvent is an event with the delivery state the outbox table keeps.
+type storedEvent struct {
+	event         types.OutboxEvent
+	nextAttemptAt time.Time
+	completed     bool
+	lastError     string
+}
+
+// fakeStore keeps events in memory with the claim rules of the outbox queries.
+type fakeStore struct {
+	mu     sync.Mutex
+	events []*storedEvent
+	pruned int
+}
+
+// add stores an event that becomes due at dueAt, returning it as committed with a message.
+func (f *fakeStore) add(kind string, payload any, dueAt time.Time) *types.OutboxEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, _ := json.Marshal(payload)
+	e := &storedEvent{
+		event:         types.OutboxEvent{ID: uuid.New(), Kind: kind, Payload: data, CreatedAt: time.Now()},
+		nextAttemptAt: dueAt,
+	}
+	f.events = append(f.events, e)
+	event := e.event
+	return &event
+}
+
+func (f *fakeStore) get(id uuid.UUID) storedEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.events {
+		if e.event.ID == id {
+			return *e
+		}
+	}
+	return storedEvent{}
+}
+
+func (f *fakeStore) Claim(_ context.Context, batchSize, maxAttempts int, leaseUntil time.Time) ([]types.OutboxEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var claimed []types.OutboxEvent
+	for _, e := range f.events {
+		if len(claimed) == batchSize {
+			break
+		}
+		if e.completed || e.nextAttemptAt.After(time.Now()) || e.event.Attempts >= maxAttempts {
+			continue
+		}
+		e.nextAttemptAt = leaseUntil
+		claimed = append(claimed, e.event)
+	}
+	return claimed, nil
+}
+
+func (f *fakeStore) Complete(_ context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.events {
+		if e.event.ID == id {
+			e.completed = true
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) Fail(_ context.Context, id uuid.UUID, deliveryErr string, nextAttemptAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.events {
+		if e.event.ID == id {
+			e.event.Attempts++
+			e.lastError = deliveryErr
+			e.nextAttemptAt = nextAttemptAt
+		}
+	}
+	return nil
+}
+
+func (f *fakeStore) DeleteCompleted(context.Context, time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pruned++
+	return nil
+}
+
+// flakyHandler fails its first failures calls, then records the payloads it delivers.
+type flakyHandler struct {
+	mu        sync.Mutex
+	failures  int
+	calls     int
+	delivered []string
+}
+
+func (h *flakyHandler) handle(_ context.Context, payload json.RawMessage) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls++
+	if h.calls <= h.failures {
+		return errors.New("redis unavailable")
+	}
+	h.delivered = append(h.delivered, string(payload))
+	return nil
+}
+
+func (h *flakyHandler) deliveries() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.delivered)
+}
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func testDispatcher(store Store, cfg config.OutboxConfig) *Dispatcher {
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = time.Millisecond
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 10
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = 5
+	}
+	return NewDispatcher(store, testLogger(), cfg)
+}
+
+func TestDispatcherCompletesEffects(t *testing.T) {
+	tests := []struct {
+		name string
+		// fastPath attempts delivery right after the commit, failing this many times
+		fastPath bool
+		failures int
+	}{
+		{name: "crash before the fast path"},
+		{name: "fast path fails", fastPath: true, failures: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeStore{}
+			h := &flakyHandler{failures: tt.failures}
+			d := testDispatcher(store, config.OutboxConfig{RetryBase: time.Millisecond})
+			d.Register(KindRedisSet, h.handle)
+
+			event := store.add(KindRedisSet, RedisSet{Key: "sug_1", Value: "{}"}, d.DispatchAfter())
+			if tt.fastPath {
+				d.Deliver(context.Background(), []*types.OutboxEvent{event})
+				got := store.get(event.ID)
+				if got.completed || got.event.Attempts != 1 || got.lastError != "redis unavailable" {
+					t.Fatalf("after failed fast path: completed %v, attempts %d, error %q; want a recorded failure", got.completed, got.event.Attempts, got.lastError)
+				}
+			}
+
+			// The background loop picks the event up, as it does on startup after a crash
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				d.Run(ctx)
+				close(done)
+			}()
+			deadline := time.Now().Add(time.Second)
+			for !store.get(event.ID).completed {
+				if time.Now().After(deadline) {
+					t.Fatal("dispatcher didn't complete the event")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+			<-done
+
+			if h.deliveries() != 1 {
+				t.Errorf("delivered %d times, want once", h.deliveries())
+			}
+			if store.pruned == 0 {
+				t.Error("completed events were not pruned on startup")
+			}
+		})
+	}
+}
+
+func TestDispatcherFailureBackoff(t *testing.T) {
+	store := &fakeStore{}
+	d := testDispatcher(store, config.OutboxConfig{RetryBase: 5 * time.Second, MaxAttempts: 10})
+	d.Register(KindRedisSet, (&flakyHandler{failures: 100}).handle)
+
+	for attempt, want := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second} {
+		event := store.add(KindRedisSet, RedisSet{Key: "k"}, time.Now())
+		store.events[len(store.events)-1].event.Attempts = attempt
+		event.Attempts = attempt
+
+		before := time.Now()
+		d.Deliver(context.Background(), []*types.OutboxEvent{event})
+		got := store.get(event.ID)
+		if got.event.Attempts != attempt+1 {
+			t.Errorf("attempt %d: attempts = %d, want %d", attempt+1, got.event.Attempts, attempt+1)
+		}
+		if delay := got.nextAttemptAt.Sub(before); delay < want || delay > want+time.Second {
+			t.Errorf("attempt %d: retried after %v, want %v", attempt+1, delay, want)
+		}
+	}
+}
+
+func TestDispatcherRetryDelay(t *testing.T) {
+	d := testDispatcher(&fakeStore{}, config.OutboxConfig{RetryBase: 5 * time.Second})
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 5 * time.Second},
+		{attempt: 2, want: 10 * time.Second},
+		{attempt: 5, want: 80 * time.Second},
+		{attempt: 8, want: maxRetryDelay},
+		{attempt: 50, want: maxRetryDelay},
+	}
+	for _, tt := range tests {
+		if got := d.retryDelay(tt.attempt); got != tt.want {
+			t.Errorf("retryDelay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestDispatcherMaxAttempts(t *testing.T) {
+	store := &fakeStore{}
+	h := &flakyHandler{failures: 100}
+	// Without backoff every pass retries at once, so only maxAttempts stops the retries
+	d := testDispatcher(store, config.OutboxConfig{MaxAttempts: 3})
+	d.Register(KindRedisSet, h.handle)
+	event := store.add(KindRedisSet, RedisSet{Key: "k"}, time.Now())
+
+	for range 10 {
+		d.processDue(context.Background())
+	}
+	got := store.get(event.ID)
+	if got.completed || got.event.Attempts != 3 || h.calls != 3 {
+		t.Errorf("completed %v after %d attempts and %d calls, want given up after 3", got.completed, got.event.Attempts, h.calls)
+	}
+}
+
+func TestDispatcherUnknownKind(t *testing.T) {
+	store := &fakeStore{}
+	d := testDispatcher(store, config.OutboxConfig{RetryBase: time.Minute})
+	event := store.add("carrier_pigeon", nil, time.Now())
+
+	d.processDue(context.Background())
+	got := store.get(event.ID)
+	if got.completed || got.event.Attempts != 1 || got.lastError == "" {
+		t.Errorf("completed %v, attempts %d, error %q; want a recorded failure", got.completed, got.event.Attempts, got.lastError)
+	}
+}
@@ -0,0 +1,41 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/vultisig/agent-backend/internal/cache/redis"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// KindRedisSet writes a value to Redis with a TTL.
+const KindRedisSet = "redis_set"
+
+// RedisSet is the payload of a KindRedisSet event.
+type RedisSet struct {
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+}
+
+// NewRedisSetEvent builds an event that sets key to value with the given TTL.
+func NewRedisSetEvent(key, value string, ttl time.Duration) (*types.OutboxEvent, error) {
+	payload, err := json.Marshal(RedisSet{Key: key, Value: value, TTLSeconds: int64(ttl / time.Second)})
+	if err != nil {
+		return nil, fmt.Errorf("marshal redis set payload: %w", err)
+	}
+	return &types.OutboxEvent{Kind: KindRedisSet, Payload: payload}, nil
+}
+
+// RedisSetHandler delivers KindRedisSet events. SET is idempotent, so redelivery is safe.
+func RedisSetHandler(client *redis.Client) Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		var p RedisSet
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return fmt.Errorf("unmarshal redis set payload: %w", err)
+		}
+		return client.Set(ctx, p.Key, p.Value, time.Duration(p.TTLSeconds)*time.Second)
+	}
+}
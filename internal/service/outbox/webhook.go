@@ -0,0 +1,59 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// KindWebhook posts a JSON body to the configured webhook.
+const KindWebhook = "webhook"
+
+// SignatureHeader carries the hex HMAC-SHA256 of a webhook body, keyed with the webhook
+// secret, when one is configured.
+const SignatureHeader = "X-Agent-Signature"
+
+// NewWebhookEvent builds an event that posts body, encoded as JSON, to the webhook.
+func NewWebhookEvent(body any) (*types.OutboxEvent, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal webhook payload: %w", err)
+	}
+	return &types.OutboxEvent{Kind: KindWebhook, Payload: payload}, nil
+}
+
+// WebhookHandler delivers KindWebhook events to url, signing the body with secret when set.
+// A redelivered event posts the same body again, so receivers should dedupe on its ID.
+func WebhookHandler(client *http.Client, url, secret string) Handler {
+	return func(ctx context.Context, payload json.RawMessage) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if secret != "" {
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write(payload)
+			req.Header.Set(SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("post webhook: %w", err)
+		}
+		defer resp.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook: unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -12,6 +12,9 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/vultisig/agent-backend/internal/cache/redis"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/requestid"
 	"github.com/vultisig/agent-backend/internal/service/agent"
 )
 
@@ -20,8 +23,51 @@ const (
 	skillsCacheKey = "agent:plugin:skills"
 	// skillsCacheTTL is how long to cache plugin skills (short to allow dynamic updates).
 	skillsCacheTTL = 5 * time.Minute
+	// emptySkillsCacheTTL is how long an empty verifier result is cached before retrying.
+	// An empty list usually means a verifier misconfig or outage, so it is rechecked sooner.
+	emptySkillsCacheTTL = 30 * time.Second
+	// staleWarnInterval rate-limits the warning logged while stale skills are served.
+	staleWarnInterval = 1 * time.Minute
+	// skillsEnvelopeVersion is bumped when the shape of the Redis payload changes; payloads
+	// of another version are ignored and the skills are fetched again.
+	skillsEnvelopeVersion = 1
 )
 
+// Where the skills returned by GetSkills came from.
+const (
+	SkillsSourceMemory = "memory"
+	SkillsSourceRedis  = "redis"
+	SkillsSourceFresh  = "fresh"
+)
+
+// skillsEnvelope is the Redis payload: the skills with the time they were fetched from the verifier.
+type skillsEnvelope struct {
+	Version   int                 `json:"version"`
+	FetchedAt time.Time           `json:"fetched_at"`
+	Skills    []agent.PluginSkill `json:"skills"`
+}
+
+// SkillsStatus reports how fresh the cached plugin skills are.
+type SkillsStatus struct {
+	// Source is where skills were last served from: memory, redis or fresh
+	Source     string     `json:"source,omitempty"`
+	FetchedAt  *time.Time `json:"fetched_at,omitempty"`
+	AgeSeconds int64      `json:"age_seconds"`
+	Stale      bool       `json:"stale"`
+	// LastError is the most recent failed verifier fetch, kept after later successes
+	LastError   string               `json:"last_error,omitempty"`
+	LastErrorAt *time.Time           `json:"last_error_at,omitempty"`
+	Plugins     []PluginSkillsStatus `json:"plugins"`
+}
+
+// PluginSkillsStatus is the freshness of one plugin's cached skills.
+type PluginSkillsStatus struct {
+	PluginID  string    `json:"plugin_id"`
+	Name      string    `json:"name"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Source    string    `json:"source"`
+}
+
 // AvailablePlugin represents a plugin from the verifier API.
 type AvailablePlugin struct {
 	ID       string `json:"id"`
@@ -44,31 +90,43 @@ type Service struct {
 	httpClient  *http.Client
 	logger      *logrus.Logger
 
-	// In-memory cache with expiry
+	// In-memory cache with expiry; fetchedAt is when the cached skills left the verifier.
+	// generation is bumped every time skills is replaced.
 	skills      []agent.PluginSkill
 	skillsMu    sync.RWMutex
 	cacheExpiry time.Time
+	fetchedAt   time.Time
+	generation  uint64
+
+	// Freshness tracking, for the status endpoint and stale warnings
+	staleAfter    time.Duration
+	statusMu      sync.Mutex
+	source        string
+	lastErr       string
+	lastErrAt     time.Time
+	staleWarnedAt time.Time
 }
 
-// NewService creates a new plugin service.
-func NewService(verifierURL string, redisClient *redis.Client, logger *logrus.Logger) *Service {
+// NewService creates a new plugin service. Skills older than staleAfter are still served
+// but logged and reported stale.
+func NewService(verifierURL string, staleAfter time.Duration, redisClient *redis.Client, httpClients *httpclient.Factory, logger *logrus.Logger) *Service {
 	return &Service{
 		verifierURL: verifierURL,
 		redis:       redisClient,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		logger: logger,
+		httpClient:  httpClients.New(30 * time.Second),
+		logger:      logger,
+		staleAfter:  staleAfter,
 	}
 }
 
 // GetSkills returns plugin skills, fetching from verifier if cache is expired.
 func (s *Service) GetSkills(ctx context.Context) []agent.PluginSkill {
-	// Check in-memory cache first
+	// Check in-memory cache first (an empty result is negatively cached for a short while)
 	s.skillsMu.RLock()
-	if time.Now().Before(s.cacheExpiry) && len(s.skills) > 0 {
-		skills := s.skills
+	if time.Now().Before(s.cacheExpiry) {
+		skills, fetchedAt := s.skills, s.fetchedAt
 		s.skillsMu.RUnlock()
+		s.served(SkillsSourceMemory, fetchedAt)
 		return skills
 	}
 	s.skillsMu.RUnlock()
@@ -77,14 +135,18 @@ func (s *Service) GetSkills(ctx context.Context) []agent.PluginSkill {
 	if s.redis != nil {
 		cached, err := s.redis.Get(ctx, skillsCacheKey)
 		if err == nil && cached != "" {
-			var skills []agent.PluginSkill
-			if err := json.Unmarshal([]byte(cached), &skills); err == nil && len(skills) > 0 {
+			var envelope skillsEnvelope
+			err := json.Unmarshal([]byte(cached), &envelope)
+			if err == nil && envelope.Version == skillsEnvelopeVersion && len(envelope.Skills) > 0 {
 				// Update in-memory cache
 				s.skillsMu.Lock()
-				s.skills = skills
+				s.skills = envelope.Skills
+				s.fetchedAt = envelope.FetchedAt
+				s.generation++
 				s.cacheExpiry = time.Now().Add(skillsCacheTTL)
 				s.skillsMu.Unlock()
-				return skills
+				s.served(SkillsSourceRedis, envelope.FetchedAt)
+				return envelope.Skills
 			}
 		}
 	}
@@ -93,21 +155,43 @@ func (s *Service) GetSkills(ctx context.Context) []agent.PluginSkill {
 	skills, err := s.fetchFromVerifier(ctx)
 	if err != nil {
 		s.logger.WithError(err).Warn("failed to fetch plugins from verifier")
+		s.recordFetchError(err.Error())
 		// Return stale cache if available
 		s.skillsMu.RLock()
-		stale := s.skills
+		stale, fetchedAt := s.skills, s.fetchedAt
 		s.skillsMu.RUnlock()
+		s.served(SkillsSourceMemory, fetchedAt)
+		return stale
+	}
+
+	// An empty list is suspicious: keep serving the last known good skills and retry soon
+	if len(skills) == 0 {
+		s.skillsMu.Lock()
+		stale, fetchedAt := s.skills, s.fetchedAt
+		s.cacheExpiry = time.Now().Add(emptySkillsCacheTTL)
+		s.skillsMu.Unlock()
+		s.logger.WithField("last_known_count", len(stale)).Warn("verifier returned no plugins, keeping last known skills")
+		s.recordFetchError("verifier returned no plugins")
+		s.served(SkillsSourceMemory, fetchedAt)
 		return stale
 	}
 
 	// Update caches
+	fetchedAt := time.Now()
 	s.skillsMu.Lock()
 	s.skills = skills
-	s.cacheExpiry = time.Now().Add(skillsCacheTTL)
+	s.fetchedAt = fetchedAt
+	s.generation++
+	s.cacheExpiry = fetchedAt.Add(skillsCacheTTL)
 	s.skillsMu.Unlock()
+	s.served(SkillsSourceFresh, fetchedAt)
 
 	if s.redis != nil {
-		data, err := json.Marshal(skills)
+		data, err := json.Marshal(skillsEnvelope{
+			Version:   skillsEnvelopeVersion,
+			FetchedAt: fetchedAt,
+			Skills:    skills,
+		})
 		if err == nil {
 			if err := s.redis.Set(ctx, skillsCacheKey, string(data), skillsCacheTTL); err != nil {
 				s.logger.WithError(err).Warn("failed to cache skills in Redis")
@@ -119,6 +203,86 @@ func (s *Service) GetSkills(ctx context.Context) []agent.PluginSkill {
 	return skills
 }
 
+// SkillsGeneration returns a counter bumped whenever the skills held in memory are replaced,
+// so callers can cache what they render from the skills until the next refresh.
+func (s *Service) SkillsGeneration() uint64 {
+	s.skillsMu.RLock()
+	defer s.skillsMu.RUnlock()
+	return s.generation
+}
+
+// served records where skills were served from and how old they are, warning at most once
+// per staleWarnInterval while they are older than the stale threshold.
+func (s *Service) served(source string, fetchedAt time.Time) {
+	if fetchedAt.IsZero() {
+		return
+	}
+	age := time.Since(fetchedAt)
+	metrics.PluginSkillsAge.Set(age.Seconds())
+
+	s.statusMu.Lock()
+	s.source = source
+	warn := age > s.staleAfter && time.Since(s.staleWarnedAt) >= staleWarnInterval
+	if warn {
+		s.staleWarnedAt = time.Now()
+	}
+	lastErr := s.lastErr
+	s.statusMu.Unlock()
+
+	if warn {
+		s.logger.WithFields(logrus.Fields{
+			"source":     source,
+			"fetched_at": fetchedAt,
+			"age":        age.Round(time.Second).String(),
+			"last_error": lastErr,
+		}).Warn("serving stale plugin skills")
+	}
+}
+
+// recordFetchError keeps the latest failed verifier fetch for the status endpoint.
+func (s *Service) recordFetchError(msg string) {
+	s.statusMu.Lock()
+	s.lastErr = msg
+	s.lastErrAt = time.Now()
+	s.statusMu.Unlock()
+}
+
+// Status reports the freshness of the skills held in memory, without fetching.
+func (s *Service) Status() SkillsStatus {
+	s.skillsMu.RLock()
+	skills, fetchedAt := s.skills, s.fetchedAt
+	s.skillsMu.RUnlock()
+
+	s.statusMu.Lock()
+	status := SkillsStatus{
+		Source:    s.source,
+		LastError: s.lastErr,
+		Plugins:   make([]PluginSkillsStatus, 0, len(skills)),
+	}
+	if !s.lastErrAt.IsZero() {
+		lastErrAt := s.lastErrAt
+		status.LastErrorAt = &lastErrAt
+	}
+	s.statusMu.Unlock()
+
+	if !fetchedAt.IsZero() {
+		age := time.Since(fetchedAt)
+		status.FetchedAt = &fetchedAt
+		status.AgeSeconds = int64(age.Seconds())
+		status.Stale = age > s.staleAfter
+		metrics.PluginSkillsAge.Set(age.Seconds())
+	}
+	for _, skill := range skills {
+		status.Plugins = append(status.Plugins, PluginSkillsStatus{
+			PluginID:  skill.PluginID,
+			Name:      skill.Name,
+			FetchedAt: fetchedAt,
+			Source:    status.Source,
+		})
+	}
+	return status
+}
+
 // fetchFromVerifier calls the verifier's /plugins/available endpoint.
 func (s *Service) fetchFromVerifier(ctx context.Context) ([]agent.PluginSkill, error) {
 	url := fmt.Sprintf("%s/plugins/available", s.verifierURL)
@@ -127,6 +291,7 @@ func (s *Service) fetchFromVerifier(ctx context.Context) ([]agent.PluginSkill, e
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
+	requestid.SetHeader(req)
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
@@ -0,0 +1,267 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/metrics"
+)
+
+// verifierStub serves /plugins/available with a skills document that changes with every fetch.
+func verifierStub(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := fetches.Add(1)
+		var resp AvailablePluginsResponse
+		resp.Status = http.StatusOK
+		resp.Data.Plugins = []AvailablePlugin{{ID: "dca", Name: "DCA", SkillsMD: fmt.Sprintf("fetch %d", n)}}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &fetches
+}
+
+// testService returns a service fetching from verifierURL without Redis or retries.
+func testService(t *testing.T, verifierURL string) *Service {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	clients, err := httpclient.NewFactory(config.HTTPTransportConfig{}, config.HTTPRetryConfig{MaxAttempts: 1}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewService(verifierURL, time.Hour, nil, clients, logger)
+}
+
+func TestSkillsGeneration(t *testing.T) {
+	srv, fetches := verifierStub(t)
+	s := testService(t, srv.URL)
+	ctx := context.Background()
+
+	steps := []struct {
+		name           string
+		invalidate     bool
+		wantGeneration uint64
+		wantFetches    int32
+	}{
+		{name: "nothing fetched yet", wantGeneration: 0, wantFetches: 0},
+		{name: "first fetch", wantGeneration: 1, wantFetches: 1},
+		{name: "served from memory", wantGeneration: 1, wantFetches: 1},
+		{name: "refetched after invalidation", invalidate: true, wantGeneration: 2, wantFetches: 2},
+	}
+	for i, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if step.invalidate {
+				s.InvalidateCache(ctx)
+			}
+			if i > 0 {
+				if skills := s.GetSkills(ctx); len(skills) != 1 {
+					t.Fatalf("GetSkills() returned %d plugins, want 1", len(skills))
+				}
+			}
+			if got := s.SkillsGeneration(); got != step.wantGeneration {
+				t.Errorf("SkillsGeneration() = %d, want %d", got, step.wantGeneration)
+			}
+			if got := fetches.Load(); got != step.wantFetches {
+				t.Errorf("verifier fetched %d times, want %d", got, step.wantFetches)
+			}
+		})
+	}
+}
+
+func TestGetSkillsEmptyVerifierResult(t *testing.T) {
+	// Each fetch serves the next plugin list; the last one repeats
+	lists := [][]AvailablePlugin{
+		nil,
+		{{ID: "dca", Name: "DCA", SkillsMD: "recurring swaps"}},
+		nil,
+	}
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(fetches.Add(1))
+		var resp AvailablePluginsResponse
+		resp.Status = http.StatusOK
+		resp.Data.Plugins = lists[min(n, len(lists))-1]
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	s := testService(t, srv.URL)
+	ctx := context.Background()
+	// expire lets the cached result lapse without waiting out its TTL
+	expire := func() {
+		s.skillsMu.Lock()
+		s.cacheExpiry = time.Now()
+		s.skillsMu.Unlock()
+	}
+	ttl := func() time.Duration {
+		s.skillsMu.RLock()
+		defer s.skillsMu.RUnlock()
+		return time.Until(s.cacheExpiry)
+	}
+
+	steps := []struct {
+		name        string
+		expire      bool
+		wantPlugins int
+		wantFetches int32
+		// wantTTL is the cache lifetime left after the call, give or take a second
+		wantTTL        time.Duration
+		wantGeneration uint64
+		wantLastError  string
+	}{
+		{
+			name:          "empty with nothing known",
+			wantFetches:   1,
+			wantTTL:       emptySkillsCacheTTL,
+			wantLastError: "verifier returned no plugins",
+		},
+		{
+			name:          "empty result cached briefly",
+			wantFetches:   1,
+			wantTTL:       emptySkillsCacheTTL,
+			wantLastError: "verifier returned no plugins",
+		},
+		{
+			name:           "plugins once the verifier recovers",
+			expire:         true,
+			wantPlugins:    1,
+			wantFetches:    2,
+			wantTTL:        skillsCacheTTL,
+			wantGeneration: 1,
+			wantLastError:  "verifier returned no plugins",
+		},
+		{
+			name:           "later empty result keeps the last known skills",
+			expire:         true,
+			wantPlugins:    1,
+			wantFetches:    3,
+			wantTTL:        emptySkillsCacheTTL,
+			wantGeneration: 1,
+			wantLastError:  "verifier returned no plugins",
+		},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			if step.expire {
+				expire()
+			}
+			if got := s.GetSkills(ctx); len(got) != step.wantPlugins {
+				t.Errorf("GetSkills() returned %d plugins, want %d", len(got), step.wantPlugins)
+			}
+			if got := fetches.Load(); got != step.wantFetches {
+				t.Errorf("verifier fetched %d times, want %d", got, step.wantFetches)
+			}
+			if got := ttl(); got > step.wantTTL || got < step.wantTTL-time.Second {
+				t.Errorf("cached for %v, want %v", got, step.wantTTL)
+			}
+			if got := s.SkillsGeneration(); got != step.wantGeneration {
+				t.Errorf("SkillsGeneration() = %d, want %d", got, step.wantGeneration)
+			}
+			if got := s.Status().LastError; got != step.wantLastError {
+				t.Errorf("Status().LastError = %q, want %q", got, step.wantLastError)
+			}
+		})
+	}
+}
+
+func TestStatusDeadVerifier(t *testing.T) {
+	var down atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "verifier unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		var resp AvailablePluginsResponse
+		resp.Status = http.StatusOK
+		resp.Data.Plugins = []AvailablePlugin{
+			{ID: "dca", Name: "DCA", SkillsMD: "recurring swaps"},
+			{ID: "payroll", Name: "Payroll", SkillsMD: "recurring sends"},
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	s := testService(t, srv.URL)
+	hook := test.NewLocal(s.logger)
+	ctx := context.Background()
+
+	// Nothing fetched yet
+	if status := s.Status(); status.Source != "" || status.FetchedAt != nil || status.Stale || len(status.Plugins) != 0 {
+		t.Errorf("Status() before any fetch = %+v, want it empty", status)
+	}
+
+	s.GetSkills(ctx)
+	if status := s.Status(); status.Source != SkillsSourceFresh || status.FetchedAt == nil || status.Stale || status.LastError != "" {
+		t.Errorf("Status() after a fetch = %+v, want fresh skills without errors", status)
+	}
+	s.GetSkills(ctx)
+	if got := s.Status().Source; got != SkillsSourceMemory {
+		t.Errorf("Source = %q after a cached read, want %q", got, SkillsSourceMemory)
+	}
+
+	// The verifier dies with the cache expired and the skills two hours old
+	down.Store(true)
+	fetchedAt := time.Now().Add(-2 * time.Hour)
+	s.skillsMu.Lock()
+	s.cacheExpiry = time.Now()
+	s.fetchedAt = fetchedAt
+	s.skillsMu.Unlock()
+
+	for range 2 {
+		if skills := s.GetSkills(ctx); len(skills) != 2 {
+			t.Fatalf("GetSkills() returned %d plugins with the verifier down, want the 2 stale ones", len(skills))
+		}
+	}
+	// Serving them is logged, once per warning interval
+	var warnings int
+	for _, entry := range hook.AllEntries() {
+		if entry.Message == "serving stale plugin skills" {
+			warnings++
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("logged %d stale skills warnings, want 1", warnings)
+	}
+	if age := testutil.ToFloat64(metrics.PluginSkillsAge); age < 7200 {
+		t.Errorf("skills age gauge = %v, want at least 7200", age)
+	}
+
+	// The status endpoint's payload shows the stale skills and why they weren't refreshed
+	data, err := json.Marshal(s.Status())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got SkillsStatus
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Source != SkillsSourceMemory || !got.Stale || got.AgeSeconds < 7200 {
+		t.Errorf("status = %s, want stale skills served from memory", data)
+	}
+	if !strings.Contains(got.LastError, "unexpected status 503") || got.LastErrorAt == nil {
+		t.Errorf("last error = %q at %v, want the failed fetch", got.LastError, got.LastErrorAt)
+	}
+	if len(got.Plugins) != 2 {
+		t.Fatalf("status lists %d plugins, want 2", len(got.Plugins))
+	}
+	for _, p := range got.Plugins {
+		if !p.FetchedAt.Equal(fetchedAt) || p.Source != SkillsSourceMemory {
+			t.Errorf("plugin %s fetched at %v from %q, want %v from memory", p.PluginID, p.FetchedAt, p.Source, fetchedAt)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+)
+
+// SchemaFetcher fetches and caches plugin recipe schemas.
+// *verifier.Client is the production implementation.
+type SchemaFetcher interface {
+	GetRecipeSchema(ctx context.Context, pluginID string) (*verifier.RecipeSchema, error)
+}
+
+var _ SchemaFetcher = (*verifier.Client)(nil)
+
+// WarmStatus reports the progress of the startup cache warm-up.
+type WarmStatus struct {
+	Done     bool     `json:"done"`
+	Skills   int      `json:"skills"`
+	Schemas  int      `json:"schemas"`
+	Failed   []string `json:"failed,omitempty"` // plugin IDs whose schema couldn't be fetched
+	TimedOut bool     `json:"timed_out,omitempty"`
+	Duration string   `json:"duration,omitempty"`
+}
+
+// Warmer fills the plugin skills and recipe schema caches at startup, so the first users
+// after a deploy don't pay for cold caches. Failures are logged and never block startup.
+type Warmer struct {
+	plugins *Service
+	schemas SchemaFetcher
+	cfg     config.WarmConfig
+	logger  *logrus.Logger
+
+	mu     sync.Mutex
+	status WarmStatus
+}
+
+// NewWarmer creates a Warmer.
+func NewWarmer(plugins *Service, schemas SchemaFetcher, cfg config.WarmConfig, logger *logrus.Logger) *Warmer {
+	return &Warmer{
+		plugins: plugins,
+		schemas: schemas,
+		cfg:     cfg,
+		logger:  logger,
+	}
+}
+
+// Status returns a snapshot of the warm-up progress.
+func (w *Warmer) Status() WarmStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := w.status
+	status.Failed = append([]string(nil), w.status.Failed...)
+	return status
+}
+
+// Run warms the caches within the configured time budget. Schemas are fetched concurrently
+// for the configured plugins, or the first TopN available ones.
+func (w *Warmer) Run(ctx context.Context) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.Budget)
+	defer cancel()
+
+	skills := w.plugins.GetSkills(ctx)
+	w.mu.Lock()
+	w.status.Skills = len(skills)
+	w.mu.Unlock()
+
+	pluginIDs := w.cfg.Plugins
+	if len(pluginIDs) == 0 {
+		for _, skill := range skills[:min(w.cfg.TopN, len(skills))] {
+			pluginIDs = append(pluginIDs, skill.PluginID)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, pluginID := range pluginIDs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := w.schemas.GetRecipeSchema(ctx, pluginID)
+
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if err != nil {
+				w.status.Failed = append(w.status.Failed, pluginID)
+				w.logger.WithError(err).WithField("plugin_id", pluginID).Warn("failed to warm recipe schema")
+				return
+			}
+			w.status.Schemas++
+		}()
+	}
+	wg.Wait()
+
+	w.mu.Lock()
+	w.status.Done = true
+	w.status.TimedOut = ctx.Err() != nil
+	w.status.Duration = time.Since(start).Round(time.Millisecond).String()
+	status := w.status
+	w.mu.Unlock()
+
+	w.logger.WithFields(logrus.Fields{
+		"skills":    status.Skills,
+		"schemas":   status.Schemas,
+		"failed":    len(status.Failed),
+		"timed_out": status.TimedOut,
+		"duration":  status.Duration,
+	}).Info("plugin caches warmed")
+}
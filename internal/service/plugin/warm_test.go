@@ -0,0 +1,177 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/service/verifier"
+)
+
+// warmVerifier serves four plugins and their recipe schemas, recording the paths requested.
+// Schemas of failing plugins answer 500; those of slow ones wait for the request to end.
+type warmVerifier struct {
+	failing map[string]bool
+	slow    map[string]bool
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func (v *warmVerifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	v.requests = append(v.requests, r.URL.Path)
+	v.mu.Unlock()
+
+	if r.URL.Path == "/plugins/available" {
+		var resp AvailablePluginsResponse
+		resp.Status = http.StatusOK
+		for i := 1; i <= 4; i++ {
+			resp.Data.Plugins = append(resp.Data.Plugins, AvailablePlugin{ID: fmt.Sprintf("p-%d", i), Name: fmt.Sprintf("Plugin %d", i), SkillsMD: "skills"})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+		return
+	}
+	pluginID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/plugins/"), "/recipe-specification")
+	switch {
+	case v.slow[pluginID]:
+		<-r.Context().Done()
+	case v.failing[pluginID]:
+		http.Error(w, "boom", http.StatusInternalServerError)
+	default:
+		_ = json.NewEncoder(w).Encode(verifier.RecipeSpecResponse{})
+	}
+}
+
+// schemaRequests returns the plugins whose schemas were requested, sorted.
+func (v *warmVerifier) schemaRequests() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var ids []string
+	for _, path := range v.requests {
+		if id, ok := strings.CutSuffix(path, "/recipe-specification"); ok {
+			ids = append(ids, strings.TrimPrefix(id, "/plugins/"))
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (v *warmVerifier) count() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return len(v.requests)
+}
+
+func testWarmer(t *testing.T, v *warmVerifier, cfg config.WarmConfig) (*Warmer, *Service, *verifier.Client) {
+	t.Helper()
+	srv := httptest.NewServer(v)
+	t.Cleanup(srv.Close)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	clients, err := httpclient.NewFactory(config.HTTPTransportConfig{}, config.HTTPRetryConfig{MaxAttempts: 1}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugins := NewService(srv.URL, time.Hour, nil, clients, logger)
+	schemas := verifier.NewClient(srv.URL, clients)
+	return NewWarmer(plugins, schemas, cfg, logger), plugins, schemas
+}
+
+func TestWarmerRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         config.WarmConfig
+		failing     map[string]bool
+		wantSchemas []string
+		wantFailed  []string
+	}{
+		{
+			name:        "top plugins",
+			cfg:         config.WarmConfig{TopN: 3, Budget: 5 * time.Second},
+			wantSchemas: []string{"p-1", "p-2", "p-3"},
+		},
+		{
+			name:        "configured plugins",
+			cfg:         config.WarmConfig{Plugins: []string{"p-4", "p-2"}, TopN: 3, Budget: 5 * time.Second},
+			wantSchemas: []string{"p-2", "p-4"},
+		},
+		{
+			name:        "failures are reported and skipped",
+			cfg:         config.WarmConfig{TopN: 3, Budget: 5 * time.Second},
+			failing:     map[string]bool{"p-2": true},
+			wantSchemas: []string{"p-1", "p-2", "p-3"},
+			wantFailed:  []string{"p-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &warmVerifier{failing: tt.failing}
+			w, plugins, schemas := testWarmer(t, v, tt.cfg)
+			if w.Status().Done {
+				t.Fatal("Status().Done before Run")
+			}
+
+			w.Run(context.Background())
+
+			if got := v.schemaRequests(); !slices.Equal(got, tt.wantSchemas) {
+				t.Errorf("schemas requested = %q, want %q", got, tt.wantSchemas)
+			}
+			status := w.Status()
+			wantWarmed := len(tt.wantSchemas) - len(tt.wantFailed)
+			if !status.Done || status.TimedOut || status.Skills != 4 || status.Schemas != wantWarmed || !slices.Equal(status.Failed, tt.wantFailed) {
+				t.Errorf("status = %+v, want done with 4 skills, %d schemas and %q failed", status, wantWarmed, tt.wantFailed)
+			}
+
+			// The caches now answer without the verifier
+			requests := v.count()
+			ctx := context.Background()
+			if skills := plugins.GetSkills(ctx); len(skills) != 4 {
+				t.Errorf("GetSkills() returned %d plugins, want 4", len(skills))
+			}
+			for _, id := range tt.wantSchemas {
+				if !slices.Contains(tt.wantFailed, id) {
+					if _, err := schemas.GetRecipeSchema(ctx, id); err != nil {
+						t.Errorf("GetRecipeSchema(%s) error = %v", id, err)
+					}
+				}
+			}
+			if got := v.count(); got != requests {
+				t.Errorf("verifier got %d more requests after warming, want none", got-requests)
+			}
+		})
+	}
+}
+
+func TestWarmerBudget(t *testing.T) {
+	v := &warmVerifier{slow: map[string]bool{"p-2": true}}
+	w, _, _ := testWarmer(t, v, config.WarmConfig{TopN: 2, Budget: 200 * time.Millisecond})
+
+	start := time.Now()
+	w.Run(context.Background())
+	// A slow verifier can hold readiness back by the budget, not more
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Run() took %v with a 200ms budget", elapsed)
+	}
+
+	status := w.Status()
+	if !status.Done || !status.TimedOut {
+		t.Errorf("status = %+v, want done and timed out", status)
+	}
+	if status.Schemas != 1 || !slices.Equal(status.Failed, []string{"p-2"}) {
+		t.Errorf("status = %+v, want p-1 warmed and p-2 failed", status)
+	}
+}
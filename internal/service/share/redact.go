@@ -0,0 +1,30 @@
+package share
+
+import (
+	"regexp"
+	"strings"
+)
+
+// addressMarker replaces wallet addresses in shared transcripts.
+const addressMarker = "[address]"
+
+var (
+	evmAddressRe    = regexp.MustCompile(`\b0x[0-9a-fA-F]{40}\b`)
+	bech32AddressRe = regexp.MustCompile(`\b(?:bc|tb|ltc|thor|maya|cosmos|osmo|kujira|terra|dydx|bnb)1[02-9ac-hj-np-z]{20,90}\b`)
+	// base58AddressRe covers legacy Bitcoin, Solana, Tron, and similar addresses
+	base58AddressRe = regexp.MustCompile(`\b[1-9A-HJ-NP-Za-km-z]{26,44}\b`)
+)
+
+// RedactAddresses masks address-like strings so a shared transcript doesn't reveal the
+// owner's wallets or their counterparties.
+func RedactAddresses(text string) string {
+	text = evmAddressRe.ReplaceAllString(text, addressMarker)
+	text = bech32AddressRe.ReplaceAllString(text, addressMarker)
+	return base58AddressRe.ReplaceAllStringFunc(text, func(m string) string {
+		// long plain words match the alphabet too; addresses always mix in digits
+		if !strings.ContainsAny(m, "123456789") {
+			return m
+		}
+		return addressMarker
+	})
+}
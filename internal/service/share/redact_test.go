@@ -0,0 +1,28 @@
+package share
+
+import "testing"
+
+func TestRedactAddresses(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "no addresses", text: "Swap 1 ETH to USDC every week", want: "Swap 1 ETH to USDC every week"},
+		{name: "evm", text: "send to 0xA0b86991c6218b36c1d19d4a2e9eB0cE3606eB48 now", want: "send to [address] now"},
+		{name: "bech32", text: "bc1qar0srrr7xfkvy5l643lydnw9re59gtzzwf5mdq", want: "[address]"},
+		{name: "thorchain", text: "thor1dheycdevq39qlkxs2a6wuuzyn4aqxhve4qxtxt received it", want: "[address] received it"},
+		{name: "legacy bitcoin", text: "from 1A1zP1eP5QGefi2DMPTfTL5SLmv7DivfNa", want: "from [address]"},
+		{name: "solana", text: "wallet 7EcDhSYGxXyscszYEp35KHN8vvw3svAuLKTzXwCFLtV", want: "wallet [address]"},
+		{name: "long word without digits", text: "Internationalizationalistically speaking", want: "Internationalizationalistically speaking"},
+		{name: "several", text: "0xdAC17F958D2ee523a2206206994597C13D831ec7 and 0x6B175474E89094C44Da98b954EedeAC495271d0F", want: "[address] and [address]"},
+		{name: "short hex kept", text: "nonce 0x1f", want: "nonce 0x1f"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactAddresses(tt.text); got != tt.want {
+				t.Errorf("RedactAddresses(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
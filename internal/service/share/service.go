@@ -0,0 +1,218 @@
+package share
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/cache/redis"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/storage/postgres"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+const (
+	// linkKeyPrefix is the Redis key prefix mapping a share token to its link.
+	linkKeyPrefix = "share:"
+	// convKeyPrefix is the Redis key prefix mapping a conversation to its active share token.
+	convKeyPrefix = "share_conv:"
+	// fetchKeyPrefix is the Redis key prefix for per-IP transcript fetch counters.
+	fetchKeyPrefix = "share_fetches:"
+	// fetchWindow is the rate limit window for transcript fetches.
+	fetchWindow = time.Minute
+	// tokenBytes is the amount of randomness in a share token.
+	tokenBytes = 24
+)
+
+var (
+	// ErrNotFound is returned for unknown, expired, or revoked share tokens, and for links
+	// whose conversation has since been deleted.
+	ErrNotFound = errors.New("share link not found or expired")
+	// ErrNotShared is returned when revoking a conversation without an active share link.
+	ErrNotShared = errors.New("conversation has no active share link")
+	// ErrInvalidTTL is returned when the requested lifetime is negative or above the maximum.
+	ErrInvalidTTL = errors.New("invalid share link lifetime")
+	// ErrRateLimited is returned when a client fetches too many transcripts.
+	ErrRateLimited = errors.New("too many requests, try again in a minute")
+)
+
+// Link is an active share link.
+type Link struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// storedLink is the Redis value behind a share token.
+type storedLink struct {
+	ConversationID uuid.UUID `json:"conversation_id"`
+	PublicKey      string    `json:"public_key"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// Transcript is the read-only view of a shared conversation. It carries message text and
+// timestamps only: no metadata, suggestions, blocks, or wallet context.
+type Transcript struct {
+	Title     *string             `json:"title,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+	ExpiresAt time.Time           `json:"expires_at"`
+	Messages  []TranscriptMessage `json:"messages"`
+}
+
+// TranscriptMessage is a single message in a shared transcript.
+type TranscriptMessage struct {
+	Role      types.MessageRole `json:"role"`
+	Content   string            `json:"content"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Service issues, resolves, and revokes conversation share links. Tokens are random and
+// stored in Redis with the link's lifetime, so revocation takes effect immediately.
+type Service struct {
+	convRepo *postgres.ConversationRepository
+	redis    *redis.Client
+	cfg      config.ShareConfig
+	logger   *logrus.Logger
+}
+
+// NewService creates a share link service.
+func NewService(convRepo *postgres.ConversationRepository, redisClient *redis.Client, cfg config.ShareConfig, logger *logrus.Logger) *Service {
+	return &Service{
+		convRepo: convRepo,
+		redis:    redisClient,
+		cfg:      cfg,
+		logger:   logger,
+	}
+}
+
+// MaxTTL returns the longest lifetime a share link may have.
+func (s *Service) MaxTTL() time.Duration {
+	return s.cfg.MaxTTL
+}
+
+// Create issues a share link for a conversation owned by publicKey, revoking any link the
+// conversation already has. A zero ttl uses the configured default.
+func (s *Service) Create(ctx context.Context, convID uuid.UUID, publicKey string, ttl time.Duration) (*Link, error) {
+	if ttl == 0 {
+		ttl = s.cfg.DefaultTTL
+	}
+	if ttl < 0 || ttl > s.cfg.MaxTTL {
+		return nil, ErrInvalidTTL
+	}
+	if _, err := s.convRepo.GetByID(ctx, convID, publicKey); err != nil {
+		return nil, err
+	}
+
+	if err := s.revokeActive(ctx, convID); err != nil && !errors.Is(err, ErrNotShared) {
+		return nil, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().UTC().Add(ttl).Truncate(time.Second)
+	data, err := json.Marshal(storedLink{ConversationID: convID, PublicKey: publicKey, ExpiresAt: expiresAt})
+	if err != nil {
+		return nil, fmt.Errorf("marshal share link: %w", err)
+	}
+	if err := s.redis.Set(ctx, linkKeyPrefix+token, string(data), ttl); err != nil {
+		return nil, fmt.Errorf("store share link: %w", err)
+	}
+	if err := s.redis.Set(ctx, convKeyPrefix+convID.String(), token, ttl); err != nil {
+		// without the conversation index the link couldn't be revoked, so drop it
+		_ = s.redis.Delete(ctx, linkKeyPrefix+token)
+		return nil, fmt.Errorf("store share link: %w", err)
+	}
+
+	return &Link{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// Revoke removes the active share link of a conversation owned by publicKey.
+func (s *Service) Revoke(ctx context.Context, convID uuid.UUID, publicKey string) error {
+	if _, err := s.convRepo.GetByID(ctx, convID, publicKey); err != nil {
+		return err
+	}
+	return s.revokeActive(ctx, convID)
+}
+
+// revokeActive deletes the conversation's active link, if any.
+func (s *Service) revokeActive(ctx context.Context, convID uuid.UUID) error {
+	token, err := s.redis.Get(ctx, convKeyPrefix+convID.String())
+	if err != nil || token == "" {
+		return ErrNotShared
+	}
+	if err := s.redis.Delete(ctx, linkKeyPrefix+token); err != nil {
+		return fmt.Errorf("delete share link: %w", err)
+	}
+	if err := s.redis.Delete(ctx, convKeyPrefix+convID.String()); err != nil {
+		return fmt.Errorf("delete share link: %w", err)
+	}
+	return nil
+}
+
+// Transcript resolves a share token to the conversation's read-only transcript. Fetches
+// count against clientIP's per-minute limit.
+func (s *Service) Transcript(ctx context.Context, token, clientIP string) (*Transcript, error) {
+	n, err := s.redis.Incr(ctx, fetchKeyPrefix+clientIP, fetchWindow)
+	if err != nil {
+		s.logger.WithError(err).Warn("failed to count share link fetch")
+	} else if n > int64(s.cfg.RequestsPerMinute) {
+		return nil, ErrRateLimited
+	}
+
+	raw, err := s.redis.Get(ctx, linkKeyPrefix+token)
+	if err != nil || raw == "" {
+		return nil, ErrNotFound
+	}
+	var link storedLink
+	if err := json.Unmarshal([]byte(raw), &link); err != nil {
+		return nil, fmt.Errorf("decode share link: %w", err)
+	}
+
+	conv, err := s.convRepo.GetWithMessages(ctx, link.ConversationID, link.PublicKey)
+	if errors.Is(err, postgres.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	transcript := &Transcript{
+		Title:     conv.Title,
+		CreatedAt: conv.CreatedAt,
+		ExpiresAt: link.ExpiresAt,
+		Messages:  make([]TranscriptMessage, 0, len(conv.Messages)),
+	}
+	for _, msg := range conv.Messages {
+		// tombstones, aborted replies, and system notes aren't part of the conversation
+		if msg.DeletedAt != nil || msg.Content == "" || (msg.Role != types.RoleUser && msg.Role != types.RoleAssistant) {
+			continue
+		}
+		content := msg.Content
+		if s.cfg.RedactAddresses {
+			content = RedactAddresses(content)
+		}
+		transcript.Messages = append(transcript.Messages, TranscriptMessage{
+			Role:      msg.Role,
+			Content:   content,
+			CreatedAt: msg.CreatedAt,
+		})
+	}
+	return transcript, nil
+}
+
+// newToken returns a random URL-safe share token.
+func newToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate share token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
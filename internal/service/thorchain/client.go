@@ -0,0 +1,278 @@
+package thorchain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/cache/redis"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/requestid"
+)
+
+const (
+	// quoteCachePrefix is the Redis key prefix for cached swap quotes.
+	quoteCachePrefix = "swap_quote:"
+	// priceCachePrefix is the Redis key prefix for cached USD prices.
+	priceCachePrefix = "asset_price:"
+	// decimals is the fixed precision THORChain uses for every asset amount.
+	decimals = 8
+)
+
+var (
+	// ErrPairNotSupported is returned when THORChain can't quote the asset pair, e.g. an
+	// unknown asset or a pool that doesn't exist or is halted.
+	ErrPairNotSupported = errors.New("pair not supported")
+	// ErrInvalidAmount is returned for amounts that aren't positive decimal numbers.
+	ErrInvalidAmount = errors.New("amount must be a positive decimal number")
+)
+
+// assetRe matches THORChain asset notation: CHAIN.SYMBOL, optionally followed by
+// -CONTRACT for tokens (e.g. ETH.USDC-0XA0B86991C6218B36C1D19D4A2E9EB0CE3606EB48).
+var assetRe = regexp.MustCompile(`^[A-Z0-9]+\.[A-Z0-9]+(-[A-Z0-9]+)?$`)
+
+// notSupportedMarkers are substrings of THORNode error messages that mean the pair can't
+// be swapped, as opposed to a transient failure.
+var notSupportedMarkers = []string{
+	"pool",
+	"asset",
+	"halted",
+	"not found",
+	"doesn't exist",
+	"does not exist",
+}
+
+// Fees is the fee breakdown of a quote, in units of Asset.
+type Fees struct {
+	Asset       string `json:"asset"`
+	Total       string `json:"total"`
+	Outbound    string `json:"outbound"`
+	Liquidity   string `json:"liquidity"`
+	Affiliate   string `json:"affiliate"`
+	SlippageBps int    `json:"slippage_bps"`
+	TotalBps    int    `json:"total_bps"`
+}
+
+// Quote is a THORChain swap quote with human-readable amounts.
+type Quote struct {
+	FromAsset              string    `json:"from_asset"`
+	ToAsset                string    `json:"to_asset"`
+	AmountIn               string    `json:"amount_in"`
+	ExpectedAmountOut      string    `json:"expected_amount_out"`
+	Fees                   Fees      `json:"fees"`
+	RecommendedMinAmountIn string    `json:"recommended_min_amount_in,omitempty"`
+	Warning                string    `json:"warning,omitempty"`
+	QuotedAt               time.Time `json:"quoted_at"`
+}
+
+// quoteResponse is the subset of the THORNode /thorchain/quote/swap response we use.
+// Amounts are strings in 1e8 units.
+type quoteResponse struct {
+	ExpectedAmountOut      string `json:"expected_amount_out"`
+	RecommendedMinAmountIn string `json:"recommended_min_amount_in"`
+	Warning                string `json:"warning"`
+	Fees                   struct {
+		Asset       string `json:"asset"`
+		Affiliate   string `json:"affiliate"`
+		Outbound    string `json:"outbound"`
+		Liquidity   string `json:"liquidity"`
+		Total       string `json:"total"`
+		SlippageBps int    `json:"slippage_bps"`
+		TotalBps    int    `json:"total_bps"`
+	} `json:"fees"`
+}
+
+// poolResponse is the subset of the THORNode /thorchain/pool/{asset} response we use.
+type poolResponse struct {
+	// AssetTorPrice is the asset's USD price in 1e8 units
+	AssetTorPrice string `json:"asset_tor_price"`
+}
+
+// errorResponse covers both error shapes THORNode returns.
+type errorResponse struct {
+	Message string `json:"message"`
+	Error   string `json:"error"`
+}
+
+// Client fetches swap quotes from a THORNode API.
+type Client struct {
+	baseURL    string
+	cacheTTL   time.Duration
+	redis      *redis.Client
+	httpClient *http.Client
+	logger     *logrus.Logger
+}
+
+// NewClient creates a new THORChain quote Client.
+func NewClient(cfg config.SwapQuoteConfig, redisClient *redis.Client, httpClients *httpclient.Factory, logger *logrus.Logger) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(cfg.URL, "/"),
+		cacheTTL:   cfg.CacheTTL,
+		redis:      redisClient,
+		httpClient: httpClients.New(10 * time.Second),
+		logger:     logger,
+	}
+}
+
+// Quote returns a quote for swapping amount (human-readable, e.g. "1000") of fromAsset into
+// toAsset. Assets use THORChain notation. Quotes are cached briefly since prices move.
+func (c *Client) Quote(ctx context.Context, fromAsset, toAsset, amount string) (*Quote, error) {
+	fromAsset = strings.ToUpper(strings.TrimSpace(fromAsset))
+	toAsset = strings.ToUpper(strings.TrimSpace(toAsset))
+	if !assetRe.MatchString(fromAsset) || !assetRe.MatchString(toAsset) || fromAsset == toAsset {
+		return nil, ErrPairNotSupported
+	}
+	baseAmount, err := toBaseUnits(strings.TrimSpace(amount))
+	if err != nil {
+		return nil, err
+	}
+
+	cacheKey := quoteCachePrefix + fromAsset + ":" + toAsset + ":" + baseAmount
+	if cached, err := c.redis.Get(ctx, cacheKey); err == nil && cached != "" {
+		var quote Quote
+		if err := json.Unmarshal([]byte(cached), &quote); err == nil {
+			return &quote, nil
+		}
+	}
+
+	params := url.Values{}
+	params.Set("from_asset", fromAsset)
+	params.Set("to_asset", toAsset)
+	params.Set("amount", baseAmount)
+
+	var resp quoteResponse
+	if err := c.getJSON(ctx, c.baseURL+"/thorchain/quote/swap?"+params.Encode(), &resp); err != nil {
+		return nil, err
+	}
+
+	quote := &Quote{
+		FromAsset:         fromAsset,
+		ToAsset:           toAsset,
+		AmountIn:          fromBaseUnits(baseAmount),
+		ExpectedAmountOut: fromBaseUnits(resp.ExpectedAmountOut),
+		Fees: Fees{
+			Asset:       resp.Fees.Asset,
+			Total:       fromBaseUnits(resp.Fees.Total),
+			Outbound:    fromBaseUnits(resp.Fees.Outbound),
+			Liquidity:   fromBaseUnits(resp.Fees.Liquidity),
+			Affiliate:   fromBaseUnits(resp.Fees.Affiliate),
+			SlippageBps: resp.Fees.SlippageBps,
+			TotalBps:    resp.Fees.TotalBps,
+		},
+		Warning:  resp.Warning,
+		QuotedAt: time.Now().UTC(),
+	}
+	if resp.RecommendedMinAmountIn != "" {
+		quote.RecommendedMinAmountIn = fromBaseUnits(resp.RecommendedMinAmountIn)
+	}
+
+	if data, err := json.Marshal(quote); err == nil {
+		if err := c.redis.Set(ctx, cacheKey, string(data), c.cacheTTL); err != nil {
+			c.logger.WithError(err).Warn("failed to cache swap quote")
+		}
+	}
+	return quote, nil
+}
+
+// USDPrice returns the USD price of an asset from its THORChain pool. Prices are cached
+// for the same window as quotes.
+func (c *Client) USDPrice(ctx context.Context, asset string) (float64, error) {
+	asset = strings.ToUpper(strings.TrimSpace(asset))
+	if !assetRe.MatchString(asset) {
+		return 0, ErrPairNotSupported
+	}
+
+	cacheKey := priceCachePrefix + asset
+	if cached, err := c.redis.Get(ctx, cacheKey); err == nil && cached != "" {
+		if price, err := strconv.ParseFloat(cached, 64); err == nil {
+			return price, nil
+		}
+	}
+
+	var resp poolResponse
+	if err := c.getJSON(ctx, c.baseURL+"/thorchain/pool/"+url.PathEscape(asset), &resp); err != nil {
+		return 0, err
+	}
+	price, err := strconv.ParseFloat(fromBaseUnits(resp.AssetTorPrice), 64)
+	if err != nil || price <= 0 {
+		return 0, fmt.Errorf("invalid pool price %q", resp.AssetTorPrice)
+	}
+
+	if err := c.redis.Set(ctx, cacheKey, strconv.FormatFloat(price, 'f', -1, 64), c.cacheTTL); err != nil {
+		c.logger.WithError(err).Warn("failed to cache asset price")
+	}
+	return price, nil
+}
+
+// getJSON performs a GET request and decodes a JSON response. Errors that mean the pair
+// can't be quoted are returned as ErrPairNotSupported.
+func (c *Client) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	requestid.SetHeader(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		var errResp errorResponse
+		_ = json.Unmarshal(body, &errResp)
+		msg := strings.ToLower(errResp.Message + " " + errResp.Error)
+		for _, marker := range notSupportedMarkers {
+			if strings.Contains(msg, marker) {
+				return fmt.Errorf("%w: %s", ErrPairNotSupported, strings.TrimSpace(errResp.Message+errResp.Error))
+			}
+		}
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// toBaseUnits converts a human-readable amount to THORChain's 1e8 units, truncating
+// extra precision.
+func toBaseUnits(amount string) (string, error) {
+	r, ok := new(big.Rat).SetString(amount)
+	if !ok || r.Sign() <= 0 {
+		return "", ErrInvalidAmount
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(decimals), nil)))
+	base := new(big.Int).Quo(r.Num(), r.Denom())
+	if base.Sign() <= 0 {
+		return "", ErrInvalidAmount
+	}
+	return base.String(), nil
+}
+
+// fromBaseUnits converts a 1e8-unit amount to a human-readable decimal string with
+// trailing zeros trimmed. Unparseable input is returned unchanged.
+func fromBaseUnits(amount string) string {
+	n, ok := new(big.Int).SetString(amount, 10)
+	if !ok {
+		return amount
+	}
+	s := new(big.Rat).SetFrac(n, new(big.Int).Exp(big.NewInt(10), big.NewInt(decimals), nil)).FloatString(decimals)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
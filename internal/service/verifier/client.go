@@ -5,24 +5,40 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"slices"
+	"sync"
 	"time"
+
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/requestid"
 )
 
+// schemaCacheTTL is how long a plugin's recipe schema is reused before it is fetched again.
+const schemaCacheTTL = 10 * time.Minute
+
 // Client is a client for the verifier service.
 type Client struct {
 	baseURL    string
 	httpClient *http.Client
+
+	// Recipe schemas change only with plugin releases, so they are cached in memory
+	schemasMu sync.Mutex
+	schemas   map[string]cachedSchema
+}
+
+// cachedSchema is a recipe schema with its expiry.
+type cachedSchema struct {
+	schema  *RecipeSchema
+	expires time.Time
 }
 
-// NewClient creates a new verifier client.
-func NewClient(baseURL string) *Client {
+// NewClient creates a new verifier client. GET requests are retried per the retry policy.
+func NewClient(baseURL string, httpClients *httpclient.Factory) *Client {
 	return &Client{
-		baseURL: baseURL,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		baseURL:    baseURL,
+		httpClient: httpClients.New(30 * time.Second),
+		schemas:    make(map[string]cachedSchema),
 	}
 }
 
@@ -111,58 +127,87 @@ type SuggestRequest struct {
 	Configuration map[string]any `json:"configuration"`
 }
 
-// IsPluginInstalled checks if a plugin is installed for the given user.
+// IsPluginInstalled checks if a plugin is installed for the given user. Failures are
+// *APIError values or wrap ErrUnavailable, as for the other calls below.
 func (c *Client) IsPluginInstalled(ctx context.Context, accessToken, pluginID string) (bool, error) {
+	installed, err := c.InstalledPluginIDs(ctx, accessToken)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(installed, pluginID), nil
+}
+
+// InstalledPluginIDs returns the IDs of the plugins the given user has installed.
+func (c *Client) InstalledPluginIDs(ctx context.Context, accessToken string) ([]string, error) {
 	url := fmt.Sprintf("%s/plugins/installed", c.baseURL)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return false, fmt.Errorf("create request: %w", err)
+		return nil, fmt.Errorf("create request: %w", err)
 	}
+	requestid.SetHeader(req)
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("http request: %w", err)
+		return nil, requestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return false, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+		return nil, parseError(resp)
 	}
 
 	var apiResp InstalledPluginsResponse
 	if err := json.NewDecoder(resp.Body).Decode(&apiResp); err != nil {
-		return false, fmt.Errorf("decode response: %w", err)
+		return nil, fmt.Errorf("decode response: %w", err)
 	}
 
+	ids := make([]string, 0, len(apiResp.Data.Plugins))
 	for _, p := range apiResp.Data.Plugins {
-		if p.ID == pluginID {
-			return true, nil
-		}
+		ids = append(ids, p.ID)
 	}
-	return false, nil
+	return ids, nil
 }
 
-// GetRecipeSchema fetches the recipe specification for a plugin.
+// GetRecipeSchema returns the recipe specification for a plugin, from cache when fresh.
 func (c *Client) GetRecipeSchema(ctx context.Context, pluginID string) (*RecipeSchema, error) {
+	c.schemasMu.Lock()
+	cached, ok := c.schemas[pluginID]
+	c.schemasMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.schema, nil
+	}
+
+	schema, err := c.fetchRecipeSchema(ctx, pluginID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.schemasMu.Lock()
+	c.schemas[pluginID] = cachedSchema{schema: schema, expires: time.Now().Add(schemaCacheTTL)}
+	c.schemasMu.Unlock()
+	return schema, nil
+}
+
+// fetchRecipeSchema fetches the recipe specification for a plugin.
+func (c *Client) fetchRecipeSchema(ctx context.Context, pluginID string) (*RecipeSchema, error) {
 	url := fmt.Sprintf("%s/plugins/%s/recipe-specification", c.baseURL, pluginID)
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
+	requestid.SetHeader(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("http request: %w", err)
+		return nil, requestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+		return nil, parseError(resp)
 	}
 
 	var apiResp RecipeSpecResponse
@@ -186,17 +231,17 @@ func (c *Client) GetPolicySuggest(ctx context.Context, pluginID string, configur
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
+	requestid.SetHeader(req)
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("http request: %w", err)
+		return nil, requestError(ctx, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(respBody))
+		return nil, parseError(resp)
 	}
 
 	var apiResp PolicySuggestResponse
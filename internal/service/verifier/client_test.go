@@ -0,0 +1,252 @@
+package verifier
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/httpclient"
+	"github.com/vultisig/agent-backend/internal/requestid"
+)
+
+// testClient returns a client for baseURL that doesn't retry.
+func testClient(t *testing.T, baseURL string) *Client {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	clients, err := httpclient.NewFactory(config.HTTPTransportConfig{}, config.HTTPRetryConfig{MaxAttempts: 1}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(baseURL, clients)
+}
+
+// verifierCalls runs each client call that surfaces verifier errors.
+var verifierCalls = map[string]func(context.Context, *Client) error{
+	"IsPluginInstalled": func(ctx context.Context, c *Client) error {
+		_, err := c.IsPluginInstalled(ctx, "token", "vultisig-dca-0000")
+		return err
+	},
+	"GetRecipeSchema": func(ctx context.Context, c *Client) error {
+		_, err := c.GetRecipeSchema(ctx, "vultisig-dca-0000")
+		return err
+	},
+	"GetPolicySuggest": func(ctx context.Context, c *Client) error {
+		_, err := c.GetPolicySuggest(ctx, "vultisig-dca-0000", map[string]any{"amount": "-1"})
+		return err
+	},
+}
+
+func TestClientErrors(t *testing.T) {
+	longPage := "<html><body>" + strings.Repeat("upstream connect error ", 20) + "</body></html>"
+
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantKind    error
+		wantCode    string
+		wantMessage string
+		wantDetails []string
+	}{
+		{
+			name:        "plugin not found",
+			status:      http.StatusNotFound,
+			body:        `{"code":"plugin_not_found","message":"plugin vultisig-dca-0000 not found"}`,
+			wantKind:    ErrPluginNotFound,
+			wantCode:    "plugin_not_found",
+			wantMessage: "plugin vultisig-dca-0000 not found",
+		},
+		{
+			name:        "not found code on a bad request",
+			status:      http.StatusBadRequest,
+			body:        `{"code":"PLUGIN_NOT_FOUND","message":"unknown plugin"}`,
+			wantKind:    ErrPluginNotFound,
+			wantCode:    "PLUGIN_NOT_FOUND",
+			wantMessage: "unknown plugin",
+		},
+		{
+			name:        "invalid access token",
+			status:      http.StatusUnauthorized,
+			body:        `{"error":"invalid access token"}`,
+			wantKind:    ErrUnauthorized,
+			wantMessage: "invalid access token",
+		},
+		{
+			name:        "forbidden with a numeric code",
+			status:      http.StatusForbidden,
+			body:        `{"code":403,"message":"token expired"}`,
+			wantKind:    ErrUnauthorized,
+			wantCode:    "403",
+			wantMessage: "token expired",
+		},
+		{
+			name:        "invalid configuration with field details",
+			status:      http.StatusBadRequest,
+			body:        `{"code":"invalid_configuration","message":"configuration is invalid","details":{"frequency":"unsupported","amount":"must be positive"}}`,
+			wantKind:    ErrInvalidConfiguration,
+			wantCode:    "invalid_configuration",
+			wantMessage: "configuration is invalid",
+			wantDetails: []string{"amount: must be positive", "frequency: unsupported"},
+		},
+		{
+			name:        "invalid configuration with detail objects",
+			status:      http.StatusUnprocessableEntity,
+			body:        `{"code":"validation_failed","message":"validation failed","details":[{"field":"amount","message":"must be positive"},{"message":"end date is before start date"}]}`,
+			wantKind:    ErrInvalidConfiguration,
+			wantCode:    "validation_failed",
+			wantMessage: "validation failed",
+			wantDetails: []string{"amount: must be positive", "end date is before start date"},
+		},
+		{
+			name:        "invalid configuration with a detail string",
+			status:      http.StatusBadRequest,
+			body:        `{"message":"bad configuration","details":"asset is not supported on this chain"}`,
+			wantKind:    ErrInvalidConfiguration,
+			wantMessage: "bad configuration",
+			wantDetails: []string{"asset is not supported on this chain"},
+		},
+		{
+			name:        "server error",
+			status:      http.StatusServiceUnavailable,
+			body:        `{"code":"unavailable","message":"database is down"}`,
+			wantKind:    ErrUnavailable,
+			wantCode:    "unavailable",
+			wantMessage: "database is down",
+		},
+		{
+			name:        "rate limited",
+			status:      http.StatusTooManyRequests,
+			body:        `{"message":"slow down"}`,
+			wantKind:    ErrUnavailable,
+			wantMessage: "slow down",
+		},
+		{
+			name:        "non-JSON 502 from a proxy",
+			status:      http.StatusBadGateway,
+			contentType: "text/html",
+			body:        "<html><body><h1>502 Bad Gateway</h1></body></html>\n",
+			wantKind:    ErrUnavailable,
+			wantMessage: "<html><body><h1>502 Bad Gateway</h1></body></html>",
+		},
+		{
+			name:        "long proxy page",
+			status:      http.StatusBadGateway,
+			contentType: "text/html",
+			body:        longPage,
+			wantKind:    ErrUnavailable,
+			wantMessage: longPage[:200] + "…",
+		},
+		{
+			name:   "empty body",
+			status: http.StatusBadGateway,
+			// No message, so the error falls back to the status
+			wantKind: ErrUnavailable,
+		},
+		{
+			name:        "unclassified status",
+			status:      http.StatusConflict,
+			body:        `{"code":"conflict","message":"policy already exists"}`,
+			wantCode:    "conflict",
+			wantMessage: "policy already exists",
+		},
+	}
+
+	kinds := []error{ErrPluginNotFound, ErrUnauthorized, ErrInvalidConfiguration, ErrUnavailable}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", cmp.Or(tt.contentType, "application/json"))
+			w.WriteHeader(tt.status)
+			_, _ = io.WriteString(w, tt.body)
+		}))
+		c := testClient(t, srv.URL)
+
+		for call, run := range verifierCalls {
+			t.Run(tt.name+"/"+call, func(t *testing.T) {
+				err := run(context.Background(), c)
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) {
+					t.Fatalf("error = %v, want an *APIError", err)
+				}
+				if apiErr.StatusCode != tt.status || apiErr.Code != tt.wantCode || apiErr.Message != tt.wantMessage {
+					t.Errorf("APIError = %d %q %q, want %d %q %q", apiErr.StatusCode, apiErr.Code, apiErr.Message, tt.status, tt.wantCode, tt.wantMessage)
+				}
+				for _, kind := range kinds {
+					if got, want := errors.Is(err, kind), kind == tt.wantKind; got != want {
+						t.Errorf("errors.Is(err, %v) = %v, want %v", kind, got, want)
+					}
+				}
+				if got := apiErr.DetailMessages(); !reflect.DeepEqual(got, tt.wantDetails) {
+					t.Errorf("DetailMessages() = %q, want %q", got, tt.wantDetails)
+				}
+			})
+		}
+		srv.Close()
+	}
+}
+
+func TestClientTransportErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	c := testClient(t, srv.URL)
+	// Nothing listens once the server is closed
+	srv.Close()
+
+	for call, run := range verifierCalls {
+		t.Run(call, func(t *testing.T) {
+			if err := run(context.Background(), c); !errors.Is(err, ErrUnavailable) {
+				t.Errorf("unreachable verifier error = %v, want %v", err, ErrUnavailable)
+			}
+
+			// A caller giving up isn't the verifier being unavailable
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err := run(ctx, c)
+			if !errors.Is(err, context.Canceled) || errors.Is(err, ErrUnavailable) {
+				t.Errorf("canceled call error = %v, want %v only", err, context.Canceled)
+			}
+		})
+	}
+}
+
+func TestClientForwardsRequestID(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.Header.Get(requestid.Header))
+		mu.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+	c := testClient(t, srv.URL)
+
+	for call, run := range verifierCalls {
+		t.Run(call, func(t *testing.T) {
+			mu.Lock()
+			got = nil
+			mu.Unlock()
+
+			_ = run(requestid.WithID(context.Background(), "req-123"), c)
+			_ = run(context.Background(), c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if want := []string{"req-123", ""}; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s headers = %q, want %q", requestid.Header, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// maxErrorBodyBytes bounds how much of an error response is read.
+const maxErrorBodyBytes = 64 << 10
+
+var (
+	// ErrPluginNotFound means the verifier doesn't know the plugin.
+	ErrPluginNotFound = errors.New("plugin not found")
+	// ErrUnauthorized means the verifier rejected the user's access token.
+	ErrUnauthorized = errors.New("verifier rejected the access token")
+	// ErrInvalidConfiguration means the plugin rejected a policy configuration. The
+	// *APIError carries the verifier's message and details.
+	ErrInvalidConfiguration = errors.New("invalid policy configuration")
+	// ErrUnavailable means the verifier couldn't be reached or failed on its side.
+	ErrUnavailable = errors.New("verifier unavailable")
+)
+
+// errorEnvelope is the body of a verifier error response.
+type errorEnvelope struct {
+	Code    json.RawMessage `json:"code"`
+	Message string          `json:"message"`
+	Error   string          `json:"error"`
+	Details json.RawMessage `json:"details"`
+}
+
+// APIError is a non-200 response from the verifier. It unwraps to ErrPluginNotFound,
+// ErrUnauthorized, ErrInvalidConfiguration or ErrUnavailable when the response identifies one.
+type APIError struct {
+	StatusCode int
+	// Code is the verifier's error code, as text; empty when the body wasn't an envelope
+	Code    string
+	Message string
+	// Details is the raw details field, whose shape varies by endpoint
+	Details json.RawMessage
+	kind    error
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("verifier: unexpected status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("verifier: status %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.kind
+}
+
+// DetailMessages flattens Details into readable lines. It understands a string, a list of
+// strings, a map of field to message, and a list of objects with field and message; other
+// shapes yield nothing.
+func (e *APIError) DetailMessages() []string {
+	if len(e.Details) == 0 {
+		return nil
+	}
+
+	var single string
+	if err := json.Unmarshal(e.Details, &single); err == nil {
+		if single == "" {
+			return nil
+		}
+		return []string{single}
+	}
+	var list []string
+	if err := json.Unmarshal(e.Details, &list); err == nil {
+		return list
+	}
+	var fields map[string]string
+	if err := json.Unmarshal(e.Details, &fields); err == nil {
+		out := make([]string, 0, len(fields))
+		for field, msg := range fields {
+			out = append(out, field+": "+msg)
+		}
+		sort.Strings(out)
+		return out
+	}
+	var items []struct {
+		Field   string `json:"field"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(e.Details, &items); err == nil {
+		out := make([]string, 0, len(items))
+		for _, item := range items {
+			if item.Field == "" {
+				out = append(out, item.Message)
+			} else {
+				out = append(out, item.Field+": "+item.Message)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// parseError builds an *APIError from a non-200 response. Bodies that aren't a JSON
+// envelope, such as a proxy's HTML error page, keep a short excerpt as the message.
+func parseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyBytes))
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+
+	var env errorEnvelope
+	if err := json.Unmarshal(body, &env); err == nil {
+		apiErr.Code = strings.Trim(string(env.Code), `"`)
+		apiErr.Message = env.Message
+		if apiErr.Message == "" {
+			apiErr.Message = env.Error
+		}
+		apiErr.Details = env.Details
+	} else {
+		apiErr.Message = excerpt(string(body))
+	}
+	apiErr.kind = classify(resp.StatusCode, apiErr.Code)
+	return apiErr
+}
+
+// classify maps a status code and verifier error code to a sentinel error, or nil.
+func classify(status int, code string) error {
+	code = strings.ToLower(code)
+	switch {
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrUnauthorized
+	case status == http.StatusNotFound, strings.Contains(code, "not_found"):
+		return ErrPluginNotFound
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		return ErrInvalidConfiguration
+	case status == http.StatusTooManyRequests, status >= http.StatusInternalServerError:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// excerpt trims a raw body to a loggable length.
+func excerpt(body string) string {
+	const maxLen = 200
+	body = strings.TrimSpace(body)
+	if len(body) > maxLen {
+		return body[:maxLen] + "…"
+	}
+	return body
+}
+
+// requestError wraps a transport failure as ErrUnavailable, unless the caller gave up.
+func requestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("http request: %w", err)
+	}
+	return fmt.Errorf("http request: %w: %w", ErrUnavailable, err)
+}
@@ -0,0 +1,121 @@
+// Package voice synthesizes spoken versions of assistant replies and stores them for the
+// app to play back.
+package voice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/ai/tts"
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/storage/blob"
+)
+
+// ErrNotFound is returned for audio that doesn't exist or belongs to another user.
+var ErrNotFound = errors.New("audio not found")
+
+// markdown is the formatting replies use that would otherwise be read out.
+var markdown = strings.NewReplacer("**", "", "__", "", "`", "", "# ", "", "#", "")
+
+// Audio is a stored voice reply.
+type Audio struct {
+	ID uuid.UUID
+	// URL is the API path the audio is served from
+	URL string
+	// Chars is how many characters were sent for synthesis
+	Chars int
+}
+
+// BlobStore keeps audio objects. *blob.Client is the production implementation.
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+var _ BlobStore = (*blob.Client)(nil)
+
+// Service synthesizes replies and keeps the audio in blob storage, under its owner's key.
+type Service struct {
+	synth    tts.Synthesizer
+	blob     BlobStore
+	logger   *logrus.Logger
+	maxChars int
+}
+
+// NewService creates a voice service.
+func NewService(synth tts.Synthesizer, blobClient BlobStore, cfg config.TTSConfig, logger *logrus.Logger) *Service {
+	return &Service{
+		synth:    synth,
+		blob:     blobClient,
+		logger:   logger,
+		maxChars: cfg.MaxChars,
+	}
+}
+
+// objectKey is the blob key holding audio of publicKey. Keying by owner scopes reads to
+// them without a database record.
+func objectKey(publicKey string, id uuid.UUID) string {
+	return "audio/" + publicKey + "/" + id.String() + ".mp3"
+}
+
+// Synthesize speaks text, capped at the configured length, and stores the audio for
+// publicKey.
+func (s *Service) Synthesize(ctx context.Context, publicKey, text string) (*Audio, error) {
+	speech := speechText(text, s.maxChars)
+	if speech == "" {
+		return nil, errors.New("nothing to synthesize")
+	}
+	chars := utf8.RuneCountInString(speech)
+	provider := s.synth.Provider()
+
+	data, err := s.synth.Synthesize(ctx, speech)
+	if err != nil {
+		metrics.TTSSyntheses.WithLabelValues(provider, "failed").Inc()
+		return nil, fmt.Errorf("synthesize: %w", err)
+	}
+	metrics.TTSSyntheses.WithLabelValues(provider, "synthesized").Inc()
+	metrics.TTSCharacters.WithLabelValues(provider).Add(float64(chars))
+
+	id := uuid.New()
+	if err := s.blob.Put(ctx, objectKey(publicKey, id), tts.ContentType, data); err != nil {
+		return nil, fmt.Errorf("store audio: %w", err)
+	}
+	return &Audio{ID: id, URL: "/agent/audio/" + id.String(), Chars: chars}, nil
+}
+
+// Open returns audio of publicKey.
+func (s *Service) Open(ctx context.Context, publicKey string, id uuid.UUID) ([]byte, error) {
+	data, err := s.blob.Get(ctx, objectKey(publicKey, id))
+	if err != nil {
+		if errors.Is(err, blob.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("load audio: %w", err)
+	}
+	return data, nil
+}
+
+// speechText strips markdown from text and cuts it to maxChars characters, at the end of
+// the last whole sentence that fits, or of the last word when no sentence does.
+func speechText(text string, maxChars int) string {
+	text = strings.TrimSpace(markdown.Replace(text))
+	if utf8.RuneCountInString(text) <= maxChars {
+		return text
+	}
+	cut := []rune(text)[:maxChars]
+	head := string(cut)
+	if i := strings.LastIndexAny(head, ".!?\n"); i > 0 {
+		return strings.TrimSpace(head[:i+1])
+	}
+	if i := strings.LastIndexAny(head, " \t"); i > 0 {
+		return strings.TrimSpace(head[:i])
+	}
+	return head
+}
@@ -0,0 +1,180 @@
+package voice
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+
+	"github.com/vultisig/agent-backend/internal/config"
+	"github.com/vultisig/agent-backend/internal/metrics"
+	"github.com/vultisig/agent-backend/internal/storage/blob"
+)
+
+const testProvider = "fake"
+
+// fakeSynthesizer returns fixed audio for any text, recording the texts it was sent.
+type fakeSynthesizer struct {
+	err   error
+	texts []string
+}
+
+func (f *fakeSynthesizer) Synthesize(_ context.Context, text string) ([]byte, error) {
+	f.texts = append(f.texts, text)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte("audio:" + text), nil
+}
+
+func (f *fakeSynthesizer) Provider() string { return testProvider }
+
+// fakeBlob keeps objects in memory.
+type fakeBlob struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeBlob) Put(_ context.Context, key, _ string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.objects == nil {
+		f.objects = make(map[string][]byte)
+	}
+	f.objects[key] = data
+	return nil
+}
+
+func (f *fakeBlob) Get(_ context.Context, key string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[key]
+	if !ok {
+		return nil, blob.ErrNotFound
+	}
+	return data, nil
+}
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestSpeechText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxChars int
+		want     string
+	}{
+		{name: "short", text: "Your swap is ready.", maxChars: 100, want: "Your swap is ready."},
+		{name: "markdown stripped", text: "## Swap\n\n**Send** `0.5 ETH` to __Arbitrum__.", maxChars: 100, want: "Swap\n\nSend 0.5 ETH to Arbitrum."},
+		{name: "cut at the last whole sentence", text: "Your swap is ready. It settles in ten minutes.", maxChars: 30, want: "Your swap is ready."},
+		{name: "cut at the last word", text: "Swapping half of your ether to arbitrum", maxChars: 20, want: "Swapping half of"},
+		{name: "cut counts characters", text: "Tausch läuft schon. Fertig in zehn Minuten.", maxChars: 20, want: "Tausch läuft schon."},
+		{name: "one long word", text: "0x1234567890abcdef", maxChars: 8, want: "0x123456"},
+		{name: "only markdown", text: "** __ ``", maxChars: 100, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := speechText(tt.text, tt.maxChars); got != tt.want {
+				t.Errorf("speechText(%q, %d) = %q, want %q", tt.text, tt.maxChars, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSynthesize(t *testing.T) {
+	const owner = "owner-key"
+	tests := []struct {
+		name      string
+		text      string
+		synthErr  error
+		wantErr   bool
+		wantSpeak string
+	}{
+		{name: "capped reply", text: "**Done.** Your swap settles in about ten minutes.", wantSpeak: "Done."},
+		{name: "synthesis fails", text: "Done.", synthErr: errors.New("provider down"), wantErr: true, wantSpeak: "Done."},
+		{name: "nothing to speak", text: "**", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			synth := &fakeSynthesizer{err: tt.synthErr}
+			store := &fakeBlob{}
+			s := NewService(synth, store, config.TTSConfig{MaxChars: 20}, testLogger())
+			chars := testutil.ToFloat64(metrics.TTSCharacters.WithLabelValues(testProvider))
+			failed := testutil.ToFloat64(metrics.TTSSyntheses.WithLabelValues(testProvider, "failed"))
+
+			audio, err := s.Synthesize(context.Background(), owner, tt.text)
+
+			var wantTexts []string
+			if tt.wantSpeak != "" {
+				wantTexts = []string{tt.wantSpeak}
+			}
+			if !slices.Equal(synth.texts, wantTexts) {
+				t.Errorf("synthesizer got %q, want %q", synth.texts, wantTexts)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Synthesize() = %+v, want an error", audio)
+				}
+				if len(store.objects) != 0 {
+					t.Errorf("stored %d objects, want none", len(store.objects))
+				}
+				if got := testutil.ToFloat64(metrics.TTSCharacters.WithLabelValues(testProvider)) - chars; got != 0 {
+					t.Errorf("TTSCharacters grew by %v without a synthesis, want 0", got)
+				}
+				if tt.synthErr != nil {
+					if got := testutil.ToFloat64(metrics.TTSSyntheses.WithLabelValues(testProvider, "failed")) - failed; got != 1 {
+						t.Errorf("failed syntheses grew by %v, want 1", got)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Synthesize() error = %v", err)
+			}
+
+			if audio.Chars != len(tt.wantSpeak) {
+				t.Errorf("Chars = %d, want %d", audio.Chars, len(tt.wantSpeak))
+			}
+			if got := testutil.ToFloat64(metrics.TTSCharacters.WithLabelValues(testProvider)) - chars; got != float64(len(tt.wantSpeak)) {
+				t.Errorf("TTSCharacters grew by %v, want %d", got, len(tt.wantSpeak))
+			}
+			if want := "/agent/audio/" + audio.ID.String(); audio.URL != want {
+				t.Errorf("URL = %q, want %q", audio.URL, want)
+			}
+			key := "audio/" + owner + "/" + audio.ID.String() + ".mp3"
+			if data := store.objects[key]; string(data) != "audio:"+tt.wantSpeak {
+				t.Errorf("object %s = %q, want the synthesized audio", key, data)
+			}
+		})
+	}
+}
+
+func TestOpenScopedToOwner(t *testing.T) {
+	s := NewService(&fakeSynthesizer{}, &fakeBlob{}, config.TTSConfig{MaxChars: 100}, testLogger())
+	ctx := context.Background()
+	audio, err := s.Synthesize(ctx, "owner-key", "Your swap is ready.")
+	if err != nil {
+		t.Fatalf("Synthesize() error = %v", err)
+	}
+
+	data, err := s.Open(ctx, "owner-key", audio.ID)
+	if err != nil || string(data) != "audio:Your swap is ready." {
+		t.Errorf("Open() = %q, %v; want the stored audio", data, err)
+	}
+	if _, err := s.Open(ctx, "other-key", audio.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open() by another owner error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := s.Open(ctx, "owner-key", uuid.New()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open() of missing audio error = %v, want %v", err, ErrNotFound)
+	}
+}
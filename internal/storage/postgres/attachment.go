@@ -0,0 +1,78 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// AttachmentRepository handles the records of uploaded message attachments.
+type AttachmentRepository struct {
+	pool *pgxpool.Pool
+	q    *queries.Queries
+}
+
+// NewAttachmentRepository creates a new AttachmentRepository.
+func NewAttachmentRepository(pool *pgxpool.Pool) *AttachmentRepository {
+	return &AttachmentRepository{
+		pool: pool,
+		q:    queries.New(pool),
+	}
+}
+
+// Create records an attachment of publicKey, filling in its ID and creation time.
+func (r *AttachmentRepository) Create(ctx context.Context, publicKey string, a *types.Attachment) error {
+	row, err := r.q.CreateAttachment(ctx, &queries.CreateAttachmentParams{
+		PublicKey:   publicKey,
+		ContentType: a.ContentType,
+		SizeBytes:   int32(a.SizeBytes),
+	})
+	if err != nil {
+		return fmt.Errorf("create attachment: %w", err)
+	}
+	*a = *attachmentFromDB(row)
+	return nil
+}
+
+// GetByID returns an attachment if it exists and belongs to the given public key.
+func (r *AttachmentRepository) GetByID(ctx context.Context, id uuid.UUID, publicKey string) (*types.Attachment, error) {
+	row, err := r.q.GetAttachment(ctx, &queries.GetAttachmentParams{
+		ID:        uuidToPgtype(id),
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	return attachmentFromDB(row), nil
+}
+
+// ListByIDs returns the attachments among ids that belong to publicKey, in no particular order.
+func (r *AttachmentRepository) ListByIDs(ctx context.Context, publicKey string, ids []uuid.UUID) ([]types.Attachment, error) {
+	pgIDs := make([]pgtype.UUID, len(ids))
+	for i, id := range ids {
+		pgIDs[i] = uuidToPgtype(id)
+	}
+	rows, err := r.q.ListAttachmentsByIDs(ctx, &queries.ListAttachmentsByIDsParams{
+		PublicKey: publicKey,
+		Ids:       pgIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list attachments: %w", err)
+	}
+	out := make([]types.Attachment, len(rows))
+	for i, row := range rows {
+		out[i] = *attachmentFromDB(row)
+	}
+	return out, nil
+}
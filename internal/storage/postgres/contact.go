@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// uniqueViolation is the Postgres error code for a unique constraint violation.
+const uniqueViolation = "23505"
+
+var (
+	// ErrContactExists is returned when the user already has a contact with the same name on the chain.
+	ErrContactExists = errors.New("contact already exists")
+	// ErrContactLimit is returned when the user has reached the maximum number of contacts.
+	ErrContactLimit = errors.New("contact limit reached")
+)
+
+// ContactRepository handles address book persistence.
+type ContactRepository struct {
+	pool *pgxpool.Pool
+	q    *queries.Queries
+}
+
+// NewContactRepository creates a new ContactRepository.
+func NewContactRepository(pool *pgxpool.Pool) *ContactRepository {
+	return &ContactRepository{pool: pool, q: queries.New(pool)}
+}
+
+// Create adds a contact unless the user already has maxContacts of them.
+func (r *ContactRepository) Create(ctx context.Context, contact *types.Contact, maxContacts int) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	count, err := q.CountContacts(ctx, contact.PublicKey)
+	if err != nil {
+		return fmt.Errorf("count contacts: %w", err)
+	}
+	if count >= int64(maxContacts) {
+		return ErrContactLimit
+	}
+
+	result, err := q.CreateContact(ctx, &queries.CreateContactParams{
+		PublicKey: contact.PublicKey,
+		Name:      contact.Name,
+		Chain:     contact.Chain,
+		Address:   contact.Address,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrContactExists
+		}
+		return fmt.Errorf("create contact: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	*contact = *contactFromDB(result)
+	return nil
+}
+
+// List returns all contacts owned by the public key, ordered by name.
+func (r *ContactRepository) List(ctx context.Context, publicKey string) ([]types.Contact, error) {
+	results, err := r.q.ListContacts(ctx, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("list contacts: %w", err)
+	}
+
+	contacts := make([]types.Contact, 0, len(results))
+	for _, c := range results {
+		contacts = append(contacts, *contactFromDB(c))
+	}
+	return contacts, nil
+}
+
+// Update changes a contact's name, chain and address if it belongs to the public key.
+func (r *ContactRepository) Update(ctx context.Context, contact *types.Contact) error {
+	result, err := r.q.UpdateContact(ctx, &queries.UpdateContactParams{
+		ID:        uuidToPgtype(contact.ID),
+		PublicKey: contact.PublicKey,
+		Name:      contact.Name,
+		Chain:     contact.Chain,
+		Address:   contact.Address,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if isUniqueViolation(err) {
+			return ErrContactExists
+		}
+		return fmt.Errorf("update contact: %w", err)
+	}
+	*contact = *contactFromDB(result)
+	return nil
+}
+
+// Delete removes a contact if it belongs to the public key.
+func (r *ContactRepository) Delete(ctx context.Context, id uuid.UUID, publicKey string) error {
+	rows, err := r.q.DeleteContact(ctx, &queries.DeleteContactParams{
+		ID:        uuidToPgtype(id),
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		return fmt.Errorf("delete contact: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
@@ -4,40 +4,187 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
 
 	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
 	"github.com/vultisig/agent-backend/internal/types"
 )
 
-// ErrNotFound is returned when a resource is not found.
-var ErrNotFound = errors.New("not found")
+var (
+	// ErrNotFound is returned when a resource is not found.
+	ErrNotFound = errors.New("not found")
+	// ErrLabelLimit is returned when adding labels would exceed the per-conversation maximum.
+	ErrLabelLimit = errors.New("label limit reached")
+)
 
 // ConversationRepository handles database operations for conversations.
 type ConversationRepository struct {
-	q *queries.Queries
+	pool   *pgxpool.Pool
+	q      *queries.Queries
+	logger *logrus.Logger
 }
 
 // NewConversationRepository creates a new ConversationRepository.
-func NewConversationRepository(pool *pgxpool.Pool) *ConversationRepository {
+func NewConversationRepository(pool *pgxpool.Pool, logger *logrus.Logger) *ConversationRepository {
 	return &ConversationRepository{
-		q: queries.New(pool),
+		pool:   pool,
+		q:      queries.New(pool),
+		logger: logger,
 	}
 }
 
 // Create creates a new conversation for the given public key.
-func (r *ConversationRepository) Create(ctx context.Context, publicKey string) (*types.Conversation, error) {
-	conv, err := r.q.CreateConversation(ctx, publicKey)
+func (r *ConversationRepository) Create(ctx context.Context, publicKey string, noMemory bool) (*types.Conversation, error) {
+	conv, err := r.q.CreateConversation(ctx, &queries.CreateConversationParams{
+		PublicKey: publicKey,
+		NoMemory:  noMemory,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("create conversation: %w", err)
 	}
 	return conversationFromDB(conv), nil
 }
 
+// Fork copies a conversation into a new conversation owned by the same public key, in one
+// transaction. Messages up to and including cutoffMessageID (all messages when nil) are copied
+// with their original timestamps, so ordering is preserved. The summary is carried over only
+// if it doesn't cover messages past the cutoff. Returns ErrNotFound if the conversation or the
+// cutoff message does not exist or is not owned by publicKey.
+func (r *ConversationRepository) Fork(ctx context.Context, id uuid.UUID, publicKey string, cutoffMessageID *uuid.UUID, summaryOnly bool) (*types.Conversation, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	source, err := q.GetConversationByID(ctx, &queries.GetConversationByIDParams{
+		ID:        uuidToPgtype(id),
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get conversation: %w", err)
+	}
+
+	var cutoff pgtype.Timestamptz
+	if cutoffMessageID != nil {
+		cutoff, err = q.GetMessageCreatedAt(ctx, &queries.GetMessageCreatedAtParams{
+			ID:             uuidToPgtype(*cutoffMessageID),
+			ConversationID: source.ID,
+		})
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("get cutoff message: %w", err)
+		}
+	}
+
+	// A summary that extends past the cutoff would leak messages the fork doesn't include
+	summary, summaryUpTo := source.Summary, source.SummaryUpTo
+	if cutoff.Valid && summaryUpTo.Valid && summaryUpTo.Time.After(cutoff.Time) {
+		summary, summaryUpTo = pgtype.Text{}, pgtype.Timestamptz{}
+	}
+
+	fork, err := q.CreateConversationWithSummary(ctx, &queries.CreateConversationWithSummaryParams{
+		PublicKey:   publicKey,
+		Title:       source.Title,
+		Summary:     summary,
+		SummaryUpTo: summaryUpTo,
+		Tags:        source.Tags,
+		NoMemory:    source.NoMemory,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create fork: %w", err)
+	}
+
+	// A summary-only fork starts empty and relies on the carried-over summary for context
+	if !summaryOnly {
+		copied, err := q.CopyMessages(ctx, &queries.CopyMessagesParams{
+			TargetID: fork.ID,
+			SourceID: source.ID,
+			Cutoff:   cutoff,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("copy messages: %w", err)
+		}
+		if err := q.BumpConversationRevision(ctx, &queries.BumpConversationRevisionParams{ID: fork.ID, Messages: copied}); err != nil {
+			return nil, fmt.Errorf("bump revision: %w", err)
+		}
+		fork.Revision += copied
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return conversationFromDB(fork), nil
+}
+
+// Import creates a conversation marked imported for publicKey with the given messages, in
+// one transaction so a failure leaves nothing behind. Messages are stored with their
+// CreatedAt timestamps, which must already be in order. A non-nil summary is stored with
+// summaryUpTo as its cursor.
+func (r *ConversationRepository) Import(ctx context.Context, publicKey string, title, summary *string, summaryUpTo time.Time, msgs []types.Message) (*types.Conversation, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	conv, err := q.CreateImportedConversation(ctx, &queries.CreateImportedConversationParams{
+		PublicKey: publicKey,
+		Title:     stringPtrToPgtext(title),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create conversation: %w", err)
+	}
+
+	for i, msg := range msgs {
+		if err := q.CreateImportedMessage(ctx, &queries.CreateImportedMessageParams{
+			ConversationID: conv.ID,
+			Role:           messageRoleToDB(msg.Role),
+			Content:        msg.Content,
+			ContentType:    msg.ContentType,
+			Metadata:       msg.Metadata,
+			CreatedAt:      timeToPgtimestamptz(msg.CreatedAt),
+		}); err != nil {
+			return nil, fmt.Errorf("create message %d: %w", i, err)
+		}
+	}
+	if summary != nil {
+		if _, err := q.UpdateConversationSummaryWithCursor(ctx, &queries.UpdateConversationSummaryWithCursorParams{
+			Summary:     stringPtrToPgtext(summary),
+			SummaryUpTo: timeToPgtimestamptz(summaryUpTo),
+			ID:          conv.ID,
+			PublicKey:   publicKey,
+		}); err != nil {
+			return nil, fmt.Errorf("store summary: %w", err)
+		}
+		conv.Summary = stringPtrToPgtext(summary)
+		conv.SummaryUpTo = timeToPgtimestamptz(summaryUpTo)
+	}
+	if err := q.BumpConversationRevision(ctx, &queries.BumpConversationRevisionParams{ID: conv.ID, Messages: int64(len(msgs))}); err != nil {
+		return nil, fmt.Errorf("bump revision: %w", err)
+	}
+	conv.Revision += int64(len(msgs))
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return conversationFromDB(conv), nil
+}
+
 // GetByID returns a conversation if it exists and belongs to the given public key.
 func (r *ConversationRepository) GetByID(ctx context.Context, id uuid.UUID, publicKey string) (*types.Conversation, error) {
 	conv, err := r.q.GetConversationByID(ctx, &queries.GetConversationByIDParams{
@@ -53,35 +200,158 @@ func (r *ConversationRepository) GetByID(ctx context.Context, id uuid.UUID, publ
 	return conversationFromDB(conv), nil
 }
 
-// GetWithMessages returns a conversation with all its messages.
+// GetForAdmin returns a conversation whoever owns it, archived or not, for admin tooling.
+// Returns ErrNotFound if it doesn't exist.
+func (r *ConversationRepository) GetForAdmin(ctx context.Context, id uuid.UUID) (*types.Conversation, error) {
+	conv, err := r.q.GetConversationForAdmin(ctx, uuidToPgtype(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get conversation: %w", err)
+	}
+	return conversationFromDB(conv), nil
+}
+
+// NoMemory reports whether the conversation was created with memory turned off.
+// Returns ErrNotFound if the conversation does not exist or is not owned by publicKey.
+func (r *ConversationRepository) NoMemory(ctx context.Context, id uuid.UUID, publicKey string) (bool, error) {
+	noMemory, err := r.q.GetConversationNoMemory(ctx, &queries.GetConversationNoMemoryParams{
+		ID:        uuidToPgtype(id),
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, ErrNotFound
+		}
+		return false, fmt.Errorf("get conversation no_memory: %w", err)
+	}
+	return noMemory, nil
+}
+
+// GetWithMessages returns a conversation with all its messages, deleted ones as tombstones.
+// Both are read from one snapshot, so the messages are exactly those of the revision returned.
 func (r *ConversationRepository) GetWithMessages(ctx context.Context, id uuid.UUID, publicKey string) (*types.ConversationWithMessages, error) {
-	conv, err := r.GetByID(ctx, id, publicKey)
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	conv, err := q.GetConversationByID(ctx, &queries.GetConversationByIDParams{
+		ID:        uuidToPgtype(id),
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get conversation: %w", err)
 	}
 
-	msgs, err := r.q.GetMessagesByConversationID(ctx, uuidToPgtype(id))
+	msgs, err := q.GetMessageHistoryByConversationID(ctx, uuidToPgtype(id))
 	if err != nil {
 		return nil, fmt.Errorf("get messages: %w", err)
 	}
 
 	return &types.ConversationWithMessages{
-		Conversation: *conv,
-		Messages:     messagesFromDB(msgs),
+		Conversation: *conversationFromDB(conv),
+		Messages:     messagesFromDB(msgs, r.logger),
 	}, nil
 }
 
-// List returns paginated conversations for a public key.
-func (r *ConversationRepository) List(ctx context.Context, publicKey string, skip, take int) ([]types.Conversation, int, error) {
-	totalCount, err := r.q.CountConversations(ctx, publicKey)
+// ListMessages returns a page of messages for a conversation owned by the given public key,
+// along with the total message count. Deleted messages are included as tombstones.
+func (r *ConversationRepository) ListMessages(ctx context.Context, id uuid.UUID, publicKey string, skip, take int) ([]types.Message, int, error) {
+	if _, err := r.GetByID(ctx, id, publicKey); err != nil {
+		return nil, 0, err
+	}
+
+	totalCount, err := r.q.CountMessageHistoryByConversationID(ctx, uuidToPgtype(id))
+	if err != nil {
+		return nil, 0, fmt.Errorf("count messages: %w", err)
+	}
+
+	msgs, err := r.q.ListMessages(ctx, &queries.ListMessagesParams{
+		ConversationID: uuidToPgtype(id),
+		Limit:          int32(take),
+		Offset:         int32(skip),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("list messages: %w", err)
+	}
+
+	return messagesFromDB(msgs, r.logger), int(totalCount), nil
+}
+
+// DeleteMessage soft-deletes a user or assistant message in a conversation owned by the given
+// public key, wiping its content and leaving a tombstone. A summary covering the message is
+// dropped in the same transaction so the deleted text doesn't outlive it there. Deleting an
+// already deleted message succeeds. Returns ErrNotFound if the message does not exist, is not
+// a user or assistant message, or its conversation is not owned by publicKey.
+func (r *ConversationRepository) DeleteMessage(ctx context.Context, id, messageID uuid.UUID, publicKey string) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	createdAt, err := q.SoftDeleteMessage(ctx, &queries.SoftDeleteMessageParams{
+		ID:             uuidToPgtype(messageID),
+		ConversationID: uuidToPgtype(id),
+		PublicKey:      publicKey,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("delete message: %w", err)
+	}
+
+	if err := q.ClearConversationSummaryCovering(ctx, &queries.ClearConversationSummaryCoveringParams{
+		ID:          uuidToPgtype(id),
+		SummaryUpTo: createdAt,
+	}); err != nil {
+		return fmt.Errorf("clear summary: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// List returns paginated conversations for a public key. When tags or labels are given,
+// only conversations carrying all of them are returned; labels match regardless of case.
+func (r *ConversationRepository) List(ctx context.Context, publicKey string, tags, labels []string, skip, take int) ([]types.Conversation, int, error) {
+	// A NULL array would match nothing; an empty one matches every conversation
+	if tags == nil {
+		tags = []string{}
+	}
+	// Labels are compared with their lowercased form, see agent_lower_labels
+	lowered := make([]string, len(labels))
+	for i, label := range labels {
+		lowered[i] = strings.ToLower(label)
+	}
+	labels = lowered
+
+	totalCount, err := r.q.CountConversations(ctx, &queries.CountConversationsParams{
+		PublicKey: publicKey,
+		Tags:      tags,
+		Labels:    labels,
+	})
 	if err != nil {
 		return nil, 0, fmt.Errorf("count conversations: %w", err)
 	}
 
 	convs, err := r.q.ListConversations(ctx, &queries.ListConversationsParams{
 		PublicKey: publicKey,
-		Limit:     int32(take),
-		Offset:    int32(skip),
+		Tags:      tags,
+		Labels:    labels,
+		Take:      int32(take),
+		Skip:      int32(skip),
 	})
 	if err != nil {
 		return nil, 0, fmt.Errorf("list conversations: %w", err)
@@ -105,6 +375,73 @@ func (r *ConversationRepository) Archive(ctx context.Context, id uuid.UUID, publ
 	return nil
 }
 
+// Delete permanently removes a conversation with its messages and everything else
+// referencing it. Unlike Archive it leaves nothing behind; it is meant for undoing a
+// conversation that never got going.
+func (r *ConversationRepository) Delete(ctx context.Context, id uuid.UUID, publicKey string) error {
+	rowsAffected, err := r.q.DeleteConversation(ctx, &queries.DeleteConversationParams{
+		ID:        uuidToPgtype(id),
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		return fmt.Errorf("delete conversation: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// BulkArchive archives up to limit of publicKey's live conversations matching filter, where
+// OlderThan is compared with the last activity, and returns the IDs archived. Each call is a
+// single statement, so a batch is applied all or nothing.
+func (r *ConversationRepository) BulkArchive(ctx context.Context, publicKey string, filter types.BulkFilter, limit int) ([]uuid.UUID, error) {
+	ids, olderThan := bulkFilterToDB(filter)
+	rows, err := r.q.BulkArchiveConversations(ctx, &queries.BulkArchiveConversationsParams{
+		PublicKey:  publicKey,
+		Ids:        ids,
+		OlderThan:  olderThan,
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bulk archive conversations: %w", err)
+	}
+	return uuidsFromDB(rows), nil
+}
+
+// BulkRestore restores up to limit of publicKey's archived conversations matching filter,
+// where OlderThan is compared with the archive time, and returns the IDs restored.
+func (r *ConversationRepository) BulkRestore(ctx context.Context, publicKey string, filter types.BulkFilter, limit int) ([]uuid.UUID, error) {
+	ids, olderThan := bulkFilterToDB(filter)
+	rows, err := r.q.BulkRestoreConversations(ctx, &queries.BulkRestoreConversationsParams{
+		PublicKey:  publicKey,
+		Ids:        ids,
+		OlderThan:  olderThan,
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bulk restore conversations: %w", err)
+	}
+	return uuidsFromDB(rows), nil
+}
+
+// BulkDeleteArchived permanently deletes up to limit of publicKey's archived conversations
+// matching filter, where OlderThan is compared with the archive time, and returns the IDs
+// deleted. Live conversations are never deleted.
+func (r *ConversationRepository) BulkDeleteArchived(ctx context.Context, publicKey string, filter types.BulkFilter, limit int) ([]uuid.UUID, error) {
+	ids, olderThan := bulkFilterToDB(filter)
+	rows, err := r.q.BulkDeleteArchivedConversations(ctx, &queries.BulkDeleteArchivedConversationsParams{
+		PublicKey:  publicKey,
+		Ids:        ids,
+		OlderThan:  olderThan,
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bulk delete archived conversations: %w", err)
+	}
+	return uuidsFromDB(rows), nil
+}
+
 // UpdateTitle updates the title of a conversation.
 func (r *ConversationRepository) UpdateTitle(ctx context.Context, id uuid.UUID, publicKey string, title string) error {
 	rowsAffected, err := r.q.UpdateConversationTitle(ctx, &queries.UpdateConversationTitleParams{
@@ -121,6 +458,207 @@ func (r *ConversationRepository) UpdateTitle(ctx context.Context, id uuid.UUID,
 	return nil
 }
 
+// UpdateTags replaces the topic tags of a conversation. It doesn't change updated_at.
+func (r *ConversationRepository) UpdateTags(ctx context.Context, id uuid.UUID, publicKey string, tags []string) error {
+	rowsAffected, err := r.q.UpdateConversationTags(ctx, &queries.UpdateConversationTagsParams{
+		Tags:      tags,
+		ID:        uuidToPgtype(id),
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		return fmt.Errorf("update tags: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddLabels adds labels to a conversation, skipping ones it already has (compared
+// case-insensitively), and returns the resulting labels. It fails with ErrLabelLimit if the
+// conversation would end up with more than maxLabels. It doesn't change updated_at.
+func (r *ConversationRepository) AddLabels(ctx context.Context, id uuid.UUID, publicKey string, labels []string, maxLabels int) ([]string, error) {
+	return r.editLabels(ctx, id, publicKey, func(current []string) ([]string, error) {
+		next := append([]string{}, current...)
+		for _, label := range labels {
+			if indexLabel(next, label) < 0 {
+				next = append(next, label)
+			}
+		}
+		if len(next) > maxLabels {
+			return nil, ErrLabelLimit
+		}
+		return next, nil
+	})
+}
+
+// RemoveLabels removes labels from a conversation, compared case-insensitively, and
+// returns the remaining labels. Labels the conversation doesn't have are ignored.
+func (r *ConversationRepository) RemoveLabels(ctx context.Context, id uuid.UUID, publicKey string, labels []string) ([]string, error) {
+	return r.editLabels(ctx, id, publicKey, func(current []string) ([]string, error) {
+		next := make([]string, 0, len(current))
+		for _, label := range current {
+			if indexLabel(labels, label) < 0 {
+				next = append(next, label)
+			}
+		}
+		return next, nil
+	})
+}
+
+// editLabels applies edit to a conversation's labels while holding its row lock.
+func (r *ConversationRepository) editLabels(ctx context.Context, id uuid.UUID, publicKey string, edit func([]string) ([]string, error)) ([]string, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	current, err := q.GetConversationLabelsForUpdate(ctx, &queries.GetConversationLabelsForUpdateParams{
+		ID:        uuidToPgtype(id),
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get labels: %w", err)
+	}
+
+	next, err := edit(current)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := q.UpdateConversationLabels(ctx, &queries.UpdateConversationLabelsParams{
+		Labels:    next,
+		ID:        uuidToPgtype(id),
+		PublicKey: publicKey,
+	}); err != nil {
+		return nil, fmt.Errorf("update labels: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return next, nil
+}
+
+// indexLabel returns the index of label in labels, compared case-insensitively, or -1.
+func indexLabel(labels []string, label string) int {
+	for i, l := range labels {
+		if strings.EqualFold(l, label) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetTags replaces the topic tags of any conversation, archived or not. It is meant for
+// maintenance jobs; request handlers use UpdateTags, which checks ownership.
+func (r *ConversationRepository) SetTags(ctx context.Context, id uuid.UUID, tags []string) error {
+	if err := r.q.SetConversationTags(ctx, &queries.SetConversationTagsParams{
+		Tags: tags,
+		ID:   uuidToPgtype(id),
+	}); err != nil {
+		return fmt.Errorf("set tags: %w", err)
+	}
+	return nil
+}
+
+// ListIDsAfter returns up to limit conversation IDs greater than after, in ID order, for
+// walking every conversation in batches. Pass uuid.Nil to start.
+func (r *ConversationRepository) ListIDsAfter(ctx context.Context, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	rows, err := r.q.ListConversationIDsAfter(ctx, &queries.ListConversationIDsAfterParams{
+		ID:    uuidToPgtype(after),
+		Limit: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list conversation ids: %w", err)
+	}
+	ids := make([]uuid.UUID, len(rows))
+	for i, row := range rows {
+		ids[i] = pgtypeToUUID(row)
+	}
+	return ids, nil
+}
+
+// ListNeedingSummary returns up to limit live conversations with more than trigger active
+// messages (those past the summary cursor), in ID order after the given ID, for summarizing
+// them in the background. Pass uuid.Nil to start, then the last ID returned.
+func (r *ConversationRepository) ListNeedingSummary(ctx context.Context, trigger int, after uuid.UUID, limit int) ([]types.SummaryCandidate, error) {
+	rows, err := r.q.ListConversationsNeedingSummary(ctx, &queries.ListConversationsNeedingSummaryParams{
+		AfterID:    uuidToPgtype(after),
+		Trigger:    int64(trigger),
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list conversations needing summary: %w", err)
+	}
+	candidates := make([]types.SummaryCandidate, len(rows))
+	for i, row := range rows {
+		candidates[i] = types.SummaryCandidate{
+			ID:             pgtypeToUUID(row.ID),
+			PublicKey:      row.PublicKey,
+			ActiveMessages: row.ActiveMessages,
+		}
+	}
+	return candidates, nil
+}
+
+// ListPublicKeysAfter returns up to limit public keys greater than after of users with live
+// conversations, in order, for walking every user in batches. Pass "" to start.
+func (r *ConversationRepository) ListPublicKeysAfter(ctx context.Context, after string, limit int) ([]string, error) {
+	keys, err := r.q.ListConversationPublicKeysAfter(ctx, &queries.ListConversationPublicKeysAfterParams{
+		PublicKey: after,
+		Limit:     int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list public keys: %w", err)
+	}
+	return keys, nil
+}
+
+// ListDuplicateCandidates returns the live conversations of the given users created within
+// window of another conversation of the same user, ordered by public key and creation time.
+// Imported conversations are left out.
+func (r *ConversationRepository) ListDuplicateCandidates(ctx context.Context, publicKeys []string, window time.Duration) ([]types.DuplicateCandidate, error) {
+	rows, err := r.q.ListDuplicateCandidates(ctx, &queries.ListDuplicateCandidatesParams{
+		PublicKeys:    publicKeys,
+		WindowSeconds: window.Seconds(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list duplicate candidates: %w", err)
+	}
+	candidates := make([]types.DuplicateCandidate, len(rows))
+	for i, row := range rows {
+		candidates[i] = types.DuplicateCandidate{
+			ID:           pgtypeToUUID(row.ID),
+			PublicKey:    row.PublicKey,
+			CreatedAt:    pgtimestamptzToTime(row.CreatedAt),
+			Labels:       row.Labels,
+			Messages:     row.Messages,
+			UserMessages: row.UserMessages,
+			FirstMessage: row.FirstMessage,
+		}
+	}
+	return candidates, nil
+}
+
+// ArchiveDuplicate archives a conversation judged a duplicate, unless it is already
+// archived or its message count has moved from messages since. Returns whether it was
+// archived.
+func (r *ConversationRepository) ArchiveDuplicate(ctx context.Context, id uuid.UUID, messages int64) (bool, error) {
+	n, err := r.q.ArchiveDuplicateConversation(ctx, &queries.ArchiveDuplicateConversationParams{
+		ID:       uuidToPgtype(id),
+		Messages: messages,
+	})
+	if err != nil {
+		return false, fmt.Errorf("archive duplicate conversation: %w", err)
+	}
+	return n > 0, nil
+}
+
 // UpdateSummaryWithCursor updates the summary and advances the summary_up_to cursor.
 func (r *ConversationRepository) UpdateSummaryWithCursor(ctx context.Context, id uuid.UUID, publicKey string, summary string, summaryUpTo time.Time) error {
 	_, err := r.q.UpdateConversationSummaryWithCursor(ctx, &queries.UpdateConversationSummaryWithCursorParams{
@@ -136,6 +674,7 @@ func (r *ConversationRepository) UpdateSummaryWithCursor(ctx context.Context, id
 }
 
 // GetSummaryWithCursor returns the summary and summary_up_to cursor of a conversation.
+// Returns ErrNotFound if the conversation does not belong to the given public key.
 func (r *ConversationRepository) GetSummaryWithCursor(ctx context.Context, id uuid.UUID, publicKey string) (*string, *time.Time, error) {
 	row, err := r.q.GetConversationSummaryWithCursor(ctx, &queries.GetConversationSummaryWithCursorParams{
 		ID:        uuidToPgtype(id),
@@ -143,9 +682,54 @@ func (r *ConversationRepository) GetSummaryWithCursor(ctx context.Context, id uu
 	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil, nil
+			return nil, nil, ErrNotFound
 		}
 		return nil, nil, fmt.Errorf("get summary with cursor: %w", err)
 	}
 	return pgtextToStringPtr(row.Summary), pgtimestamptzToTimePtr(row.SummaryUpTo), nil
 }
+
+// Stats aggregates a user's conversation, message, automation and per-topic counts. Automations are
+// counted from action_result messages whose metadata records a successful automationAction; the
+// member-since date includes archived conversations. Daily reply confidence starts at confidenceSince.
+func (r *ConversationRepository) Stats(ctx context.Context, publicKey, automationAction string, confidenceSince time.Time) (*types.UserStats, error) {
+	row, err := r.q.GetUserStats(ctx, &queries.GetUserStatsParams{
+		PublicKey:        publicKey,
+		AutomationAction: automationAction,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get user stats: %w", err)
+	}
+
+	topics, err := r.q.GetUserTopicCounts(ctx, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("get user topic counts: %w", err)
+	}
+	confidence, err := r.q.GetUserDailyConfidence(ctx, &queries.GetUserDailyConfidenceParams{
+		PublicKey: publicKey,
+		CreatedAt: timeToPgtimestamptz(confidenceSince),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get user daily confidence: %w", err)
+	}
+	stats := &types.UserStats{
+		Conversations: row.Conversations,
+		Messages:      row.Messages,
+		Automations:   row.Automations,
+		MemberSince:   pgtimestamptzToTimePtr(row.MemberSince),
+	}
+	if len(topics) > 0 {
+		stats.Topics = make(map[string]int64, len(topics))
+		for _, t := range topics {
+			stats.Topics[t.Tag] = t.Conversations
+		}
+	}
+	for _, day := range confidence {
+		stats.Confidence = append(stats.Confidence, types.DailyConfidence{
+			Day:     pgtimestamptzToTime(day.Day),
+			Replies: day.Replies,
+			Average: day.Average,
+		})
+	}
+	return stats, nil
+}
@@ -0,0 +1,572 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// conversationState is where a conversation stands after a bulk operation.
+type conversationState int
+
+const (
+	stateLive conversationState = iota
+	stateArchived
+	stateDeleted
+)
+
+func (s conversationState) String() string {
+	return [...]string{"live", "archived", "deleted"}[s]
+}
+
+// state looks up a conversation regardless of its owner.
+func state(t *testing.T, repo *ConversationRepository, id uuid.UUID) conversationState {
+	t.Helper()
+	conv, err := repo.GetForAdmin(context.Background(), id)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return stateDeleted
+	case err != nil:
+		t.Fatalf("get conversation %s: %v", id, err)
+	case conv.ArchivedAt != nil:
+		return stateArchived
+	}
+	return stateLive
+}
+
+func TestBulkOperationsScopedToOwner(t *testing.T) {
+	db := testDB(t)
+	repo := NewConversationRepository(db.Pool(), testLogger())
+	ctx := context.Background()
+	owner, other := testPublicKey(t), testPublicKey(t)
+
+	create := func(publicKey string, archived bool) uuid.UUID {
+		t.Helper()
+		conv, err := repo.Create(ctx, publicKey, false)
+		if err != nil {
+			t.Fatalf("create conversation: %v", err)
+		}
+		if archived {
+			if err := repo.Archive(ctx, conv.ID, publicKey); err != nil {
+				t.Fatalf("archive conversation: %v", err)
+			}
+		}
+		return conv.ID
+	}
+	ownLive, ownArchived := create(owner, false), create(owner, true)
+	otherLive, otherArchived := create(other, false), create(other, true)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name string
+		// apply runs the operation as owner
+		apply  func(ctx context.Context, publicKey string, filter types.BulkFilter, limit int) ([]uuid.UUID, error)
+		filter types.BulkFilter
+		want   []uuid.UUID
+		// after is the state of each conversation once the operation ran
+		after map[uuid.UUID]conversationState
+	}{
+		{
+			name:   "archive by ids skips foreign ids",
+			apply:  repo.BulkArchive,
+			filter: types.BulkFilter{IDs: []uuid.UUID{ownLive, otherLive, otherArchived}},
+			want:   []uuid.UUID{ownLive},
+			after:  map[uuid.UUID]conversationState{ownLive: stateArchived, otherLive: stateLive, otherArchived: stateArchived},
+		},
+		{
+			name:   "restore by ids skips foreign ids",
+			apply:  repo.BulkRestore,
+			filter: types.BulkFilter{IDs: []uuid.UUID{ownLive, ownArchived, otherArchived}},
+			want:   []uuid.UUID{ownLive, ownArchived},
+			after:  map[uuid.UUID]conversationState{ownLive: stateLive, ownArchived: stateLive, otherArchived: stateArchived},
+		},
+		{
+			name:   "archive by age touches only the owner's conversations",
+			apply:  repo.BulkArchive,
+			filter: types.BulkFilter{OlderThan: &future},
+			want:   []uuid.UUID{ownLive, ownArchived},
+			after:  map[uuid.UUID]conversationState{ownLive: stateArchived, ownArchived: stateArchived, otherLive: stateLive},
+		},
+		{
+			name:   "delete archived by ids skips foreign ids",
+			apply:  repo.BulkDeleteArchived,
+			filter: types.BulkFilter{IDs: []uuid.UUID{ownLive, otherArchived, otherLive}},
+			want:   []uuid.UUID{ownLive},
+			after:  map[uuid.UUID]conversationState{ownLive: stateDeleted, otherArchived: stateArchived, otherLive: stateLive},
+		},
+		{
+			name:   "delete archived by age touches only the owner's conversations",
+			apply:  repo.BulkDeleteArchived,
+			filter: types.BulkFilter{OlderThan: &future},
+			want:   []uuid.UUID{ownArchived},
+			after:  map[uuid.UUID]conversationState{ownArchived: stateDeleted, otherArchived: stateArchived, otherLive: stateLive},
+		},
+	}
+
+	// The cases run in order, each starting from the state the previous one left
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.apply(ctx, owner, tt.filter, 100)
+			if err != nil {
+				t.Fatalf("bulk operation: %v", err)
+			}
+			if !sameIDs(got, tt.want) {
+				t.Errorf("changed %v, want %v", got, tt.want)
+			}
+			for id, wantState := range tt.after {
+				if got := state(t, repo, id); got != wantState {
+					t.Errorf("conversation %s is %s, want %s", id, got, wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkArchiveLimit(t *testing.T) {
+	db := testDB(t)
+	repo := NewConversationRepository(db.Pool(), testLogger())
+	ctx := context.Background()
+	owner := testPublicKey(t)
+
+	for range 3 {
+		if _, err := repo.Create(ctx, owner, false); err != nil {
+			t.Fatalf("create conversation: %v", err)
+		}
+	}
+	future := time.Now().Add(time.Hour)
+	for _, want := range []int{2, 1, 0} {
+		got, err := repo.BulkArchive(ctx, owner, types.BulkFilter{OlderThan: &future}, 2)
+		if err != nil {
+			t.Fatalf("BulkArchive() error = %v", err)
+		}
+		// Archived conversations stop matching, so each batch picks up the rest
+		if len(got) != want {
+			t.Fatalf("archived %d conversations, want %d", len(got), want)
+		}
+	}
+}
+
+func TestConversationLabels(t *testing.T) {
+	db := testDB(t)
+	repo := NewConversationRepository(db.Pool(), testLogger())
+	ctx := context.Background()
+	owner, other := testPublicKey(t), testPublicKey(t)
+
+	create := func(publicKey string, labels ...string) uuid.UUID {
+		t.Helper()
+		conv, err := repo.Create(ctx, publicKey, false)
+		if err != nil {
+			t.Fatalf("create conversation: %v", err)
+		}
+		if len(labels) > 0 {
+			if _, err := repo.AddLabels(ctx, conv.ID, publicKey, labels, 5); err != nil {
+				t.Fatalf("add labels: %v", err)
+			}
+		}
+		return conv.ID
+	}
+	strategy := create(owner, "ETH Strategy", "tax")
+	taxOnly := create(owner, "Tax")
+	create(other, "tax")
+
+	t.Run("add keeps case and skips case-insensitive duplicates", func(t *testing.T) {
+		got, err := repo.AddLabels(ctx, taxOnly, owner, []string{"TAX", "Airdrops"}, 5)
+		if err != nil {
+			t.Fatalf("AddLabels() error = %v", err)
+		}
+		if want := []string{"Tax", "Airdrops"}; !slices.Equal(got, want) {
+			t.Errorf("labels = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("add past the limit changes nothing", func(t *testing.T) {
+		if _, err := repo.AddLabels(ctx, taxOnly, owner, []string{"a", "b", "c", "d"}, 5); !errors.Is(err, ErrLabelLimit) {
+			t.Fatalf("AddLabels() error = %v, want ErrLabelLimit", err)
+		}
+		conv, err := repo.GetByID(ctx, taxOnly, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"Tax", "Airdrops"}; !slices.Equal(conv.Labels, want) {
+			t.Errorf("labels = %q, want %q", conv.Labels, want)
+		}
+	})
+
+	t.Run("another user's conversation", func(t *testing.T) {
+		if _, err := repo.AddLabels(ctx, strategy, other, []string{"mine"}, 5); !errors.Is(err, ErrNotFound) {
+			t.Errorf("AddLabels() error = %v, want ErrNotFound", err)
+		}
+		if _, err := repo.RemoveLabels(ctx, strategy, other, []string{"tax"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("RemoveLabels() error = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("filter ignores case", func(t *testing.T) {
+		tests := []struct {
+			labels []string
+			want   []uuid.UUID
+		}{
+			{labels: []string{"tax"}, want: []uuid.UUID{strategy, taxOnly}},
+			{labels: []string{"TAX"}, want: []uuid.UUID{strategy, taxOnly}},
+			{labels: []string{"eth strategy"}, want: []uuid.UUID{strategy}},
+			{labels: []string{"eth strategy", "Airdrops"}, want: nil},
+			{labels: nil, want: []uuid.UUID{strategy, taxOnly}},
+		}
+		for _, tt := range tests {
+			convs, total, err := repo.List(ctx, owner, nil, tt.labels, 0, 10)
+			if err != nil {
+				t.Fatalf("List(%q) error = %v", tt.labels, err)
+			}
+			var got []uuid.UUID
+			for _, conv := range convs {
+				got = append(got, conv.ID)
+			}
+			if total != len(tt.want) || !sameIDs(got, tt.want) {
+				t.Errorf("List(%q) = %v (total %d), want %v", tt.labels, got, total, tt.want)
+			}
+		}
+	})
+
+	t.Run("remove ignores case", func(t *testing.T) {
+		got, err := repo.RemoveLabels(ctx, strategy, owner, []string{"eth STRATEGY", "missing"})
+		if err != nil {
+			t.Fatalf("RemoveLabels() error = %v", err)
+		}
+		if want := []string{"tax"}; !slices.Equal(got, want) {
+			t.Errorf("labels = %q, want %q", got, want)
+		}
+		convs, _, err := repo.List(ctx, owner, nil, []string{"ETH Strategy"}, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(convs) != 0 {
+			t.Errorf("removed label still matches %d conversations", len(convs))
+		}
+	})
+}
+
+// sameIDs reports whether a and b hold the same IDs in any order.
+func sameIDs(a, b []uuid.UUID) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	compare := func(x, y uuid.UUID) int { return slices.Compare(x[:], y[:]) }
+	slices.SortFunc(a, compare)
+	slices.SortFunc(b, compare)
+	return slices.Equal(a, b)
+}
+
+func TestForkSeedsSummary(t *testing.T) {
+	db := testDB(t)
+	convRepo := NewConversationRepository(db.Pool(), testLogger())
+	msgRepo := NewMessageRepository(db.Pool(), testLogger())
+	ctx := context.Background()
+	owner := testPublicKey(t)
+
+	source, err := convRepo.Create(ctx, owner, false)
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	var msgs []types.Message
+	for _, content := range []string{"swap eth", "which chain?", "arbitrum"} {
+		msg := types.Message{ConversationID: source.ID, Role: types.RoleUser, Content: content, ContentType: "text"}
+		if err := msgRepo.Create(ctx, &msg); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	const summary = "The user wants to swap ETH."
+	summaryUpTo := msgs[1].CreatedAt
+	if err := convRepo.UpdateSummaryWithCursor(ctx, source.ID, owner, summary, summaryUpTo); err != nil {
+		t.Fatalf("update summary: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		cutoff       *uuid.UUID
+		summaryOnly  bool
+		wantMessages int
+		wantSummary  bool
+	}{
+		{name: "summary only", summaryOnly: true, wantSummary: true},
+		{name: "all messages", wantMessages: 3, wantSummary: true},
+		{name: "cutoff at the summary cursor", cutoff: &msgs[1].ID, wantMessages: 2, wantSummary: true},
+		{name: "cutoff before the summary cursor", cutoff: &msgs[0].ID, wantMessages: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fork, err := convRepo.Fork(ctx, source.ID, owner, tt.cutoff, tt.summaryOnly)
+			if err != nil {
+				t.Fatalf("Fork() error = %v", err)
+			}
+			copied, err := msgRepo.GetByConversationID(ctx, fork.ID)
+			if err != nil {
+				t.Fatalf("get fork messages: %v", err)
+			}
+			if len(copied) != tt.wantMessages || fork.Revision != int64(tt.wantMessages) {
+				t.Errorf("fork has %d messages at revision %d, want %d", len(copied), fork.Revision, tt.wantMessages)
+			}
+
+			gotSummary, gotUpTo, err := convRepo.GetSummaryWithCursor(ctx, fork.ID, owner)
+			if err != nil {
+				t.Fatalf("GetSummaryWithCursor() error = %v", err)
+			}
+			if !tt.wantSummary {
+				if gotSummary != nil || gotUpTo != nil {
+					t.Errorf("fork summary = %v up to %v, want none", gotSummary, gotUpTo)
+				}
+				return
+			}
+			if gotSummary == nil || *gotSummary != summary || gotUpTo == nil || !gotUpTo.Equal(summaryUpTo) {
+				t.Errorf("fork summary = %v up to %v, want %q up to %v", gotSummary, gotUpTo, summary, summaryUpTo)
+			}
+		})
+	}
+
+	t.Run("foreign owner", func(t *testing.T) {
+		if _, err := convRepo.Fork(ctx, source.ID, testPublicKey(t), nil, true); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Fork() error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestForkIndependent(t *testing.T) {
+	db := testDB(t)
+	convRepo := NewConversationRepository(db.Pool(), testLogger())
+	msgRepo := NewMessageRepository(db.Pool(), testLogger())
+	ctx := context.Background()
+	owner := testPublicKey(t)
+
+	source, err := convRepo.Create(ctx, owner, false)
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	if err := convRepo.UpdateTitle(ctx, source.ID, owner, "Swap ETH"); err != nil {
+		t.Fatalf("update title: %v", err)
+	}
+	addMessage := func(convID uuid.UUID, content string) types.Message {
+		t.Helper()
+		msg := types.Message{ConversationID: convID, Role: types.RoleUser, Content: content, ContentType: "text"}
+		if err := msgRepo.Create(ctx, &msg); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+		return msg
+	}
+	contents := func(convID uuid.UUID) []string {
+		t.Helper()
+		msgs, err := msgRepo.GetByConversationID(ctx, convID)
+		if err != nil {
+			t.Fatalf("get messages: %v", err)
+		}
+		var out []string
+		for _, msg := range msgs {
+			out = append(out, msg.Content)
+		}
+		return out
+	}
+	var originals []types.Message
+	for _, content := range []string{"swap eth", "which chain?", "arbitrum"} {
+		originals = append(originals, addMessage(source.ID, content))
+	}
+
+	fork, err := convRepo.Fork(ctx, source.ID, owner, nil, false)
+	if err != nil {
+		t.Fatalf("Fork() error = %v", err)
+	}
+	if fork.ID == source.ID || fork.Title == nil || *fork.Title != "Swap ETH" {
+		t.Fatalf("fork = %s titled %v, want a new conversation titled %q", fork.ID, fork.Title, "Swap ETH")
+	}
+
+	// The copies are new rows in the original order, keeping their timestamps
+	copies, err := msgRepo.GetByConversationID(ctx, fork.ID)
+	if err != nil {
+		t.Fatalf("get fork messages: %v", err)
+	}
+	if len(copies) != len(originals) {
+		t.Fatalf("fork has %d messages, want %d", len(copies), len(originals))
+	}
+	for i, msg := range copies {
+		if msg.ID == originals[i].ID || msg.Content != originals[i].Content || !msg.CreatedAt.Equal(originals[i].CreatedAt) {
+			t.Errorf("fork message %d = %s %q at %v, want a copy of %s %q at %v", i, msg.ID, msg.Content, msg.CreatedAt, originals[i].ID, originals[i].Content, originals[i].CreatedAt)
+		}
+	}
+
+	// Changes to either side stay on that side
+	addMessage(fork.ID, "actually, use base")
+	addMessage(source.ID, "and send the rest to cold storage")
+	if err := convRepo.UpdateTitle(ctx, fork.ID, owner, "Swap ETH on Base"); err != nil {
+		t.Fatalf("update fork title: %v", err)
+	}
+	if err := convRepo.DeleteMessage(ctx, fork.ID, copies[0].ID, owner); err != nil {
+		t.Fatalf("delete fork message: %v", err)
+	}
+
+	if got, want := contents(source.ID), []string{"swap eth", "which chain?", "arbitrum", "and send the rest to cold storage"}; !slices.Equal(got, want) {
+		t.Errorf("source messages = %q, want %q", got, want)
+	}
+	if got, want := contents(fork.ID), []string{"which chain?", "arbitrum", "actually, use base"}; !slices.Equal(got, want) {
+		t.Errorf("fork messages = %q, want %q", got, want)
+	}
+	if conv, err := convRepo.GetByID(ctx, source.ID, owner); err != nil || conv.Title == nil || *conv.Title != "Swap ETH" {
+		t.Errorf("source = %+v, %v; want its title kept", conv, err)
+	}
+
+	// Deleting the fork leaves the original in place
+	if err := convRepo.Delete(ctx, fork.ID, owner); err != nil {
+		t.Fatalf("delete fork: %v", err)
+	}
+	if got := contents(source.ID); len(got) != 4 {
+		t.Errorf("source has %d messages after the fork was deleted, want 4", len(got))
+	}
+}
+
+func TestImportAtomic(t *testing.T) {
+	db := testDB(t)
+	convRepo := NewConversationRepository(db.Pool(), testLogger())
+	msgRepo := NewMessageRepository(db.Pool(), testLogger())
+	ctx := context.Background()
+	owner := testPublicKey(t)
+
+	base := time.Now().UTC().Truncate(time.Microsecond).Add(-time.Hour)
+	title := "Swap ETH"
+	msgs := []types.Message{
+		{Role: types.RoleUser, Content: "swap eth", ContentType: "text", CreatedAt: base},
+		{Role: types.RoleAssistant, Content: "Which chain?", ContentType: "text", Metadata: []byte(`{"intent":"swap"}`), CreatedAt: base.Add(time.Minute)},
+		{Role: types.RoleUser, Content: "arbitrum", ContentType: "text", CreatedAt: base.Add(2 * time.Minute)},
+	}
+
+	t.Run("failing message rolls back the import", func(t *testing.T) {
+		bad := slices.Clone(msgs)
+		bad[1].Metadata = []byte(`{"intent":`)
+		if _, err := convRepo.Import(ctx, owner, &title, nil, time.Time{}, bad); err == nil {
+			t.Fatal("Import() error = nil, want the invalid metadata rejected")
+		}
+		if _, total, err := convRepo.List(ctx, owner, nil, nil, 0, 10); err != nil || total != 0 {
+			t.Errorf("owner has %d conversations (%v), want none", total, err)
+		}
+	})
+
+	t.Run("stored as given", func(t *testing.T) {
+		summary := "The user wants to swap ETH."
+		summaryUpTo := msgs[1].CreatedAt
+		conv, err := convRepo.Import(ctx, owner, &title, &summary, summaryUpTo, msgs)
+		if err != nil {
+			t.Fatalf("Import() error = %v", err)
+		}
+		if !conv.Imported || conv.Revision != int64(len(msgs)) {
+			t.Errorf("imported conversation imported=%t at revision %d, want imported at revision %d", conv.Imported, conv.Revision, len(msgs))
+		}
+
+		stored, err := msgRepo.GetByConversationID(ctx, conv.ID)
+		if err != nil {
+			t.Fatalf("get messages: %v", err)
+		}
+		if len(stored) != len(msgs) {
+			t.Fatalf("stored %d messages, want %d", len(stored), len(msgs))
+		}
+		for i, msg := range stored {
+			want := msgs[i]
+			if msg.Role != want.Role || msg.Content != want.Content || !msg.CreatedAt.Equal(want.CreatedAt) {
+				t.Errorf("message %d = %s %q at %v, want %s %q at %v", i, msg.Role, msg.Content, msg.CreatedAt, want.Role, want.Content, want.CreatedAt)
+			}
+		}
+
+		gotSummary, gotUpTo, err := convRepo.GetSummaryWithCursor(ctx, conv.ID, owner)
+		if err != nil {
+			t.Fatalf("GetSummaryWithCursor() error = %v", err)
+		}
+		if gotSummary == nil || *gotSummary != summary || gotUpTo == nil || !gotUpTo.Equal(summaryUpTo) {
+			t.Errorf("summary = %v up to %v, want %q up to %v", gotSummary, gotUpTo, summary, summaryUpTo)
+		}
+	})
+}
+
+func TestListNeedingSummary(t *testing.T) {
+	db := testDB(t)
+	convRepo := NewConversationRepository(db.Pool(), testLogger())
+	msgRepo := NewMessageRepository(db.Pool(), testLogger())
+	ctx := context.Background()
+	owner := testPublicKey(t)
+	const trigger = 4
+
+	// seed creates a conversation with n messages, returning it with its messages in order
+	seed := func(n int) (*types.Conversation, []types.Message) {
+		t.Helper()
+		conv, err := convRepo.Create(ctx, owner, false)
+		if err != nil {
+			t.Fatalf("create conversation: %v", err)
+		}
+		msgs := make([]types.Message, n)
+		for i := range msgs {
+			msgs[i] = types.Message{ConversationID: conv.ID, Role: types.RoleUser, Content: "hi", ContentType: "text"}
+			if err := msgRepo.Create(ctx, &msgs[i]); err != nil {
+				t.Fatalf("create message: %v", err)
+			}
+		}
+		return conv, msgs
+	}
+
+	// Never summarized and past the trigger
+	unsummarized, _ := seed(6)
+	// Past the trigger again since its last summary
+	stale, staleMsgs := seed(8)
+	if err := convRepo.UpdateSummaryWithCursor(ctx, stale.ID, owner, "summary", staleMsgs[1].CreatedAt); err != nil {
+		t.Fatalf("update summary: %v", err)
+	}
+	// Summarized recently enough
+	upToDate, upToDateMsgs := seed(8)
+	if err := convRepo.UpdateSummaryWithCursor(ctx, upToDate.ID, owner, "summary", upToDateMsgs[4].CreatedAt); err != nil {
+		t.Fatalf("update summary: %v", err)
+	}
+	// At the trigger, not past it
+	seed(trigger)
+	// Past the trigger only by counting deleted messages
+	pruned, prunedMsgs := seed(6)
+	for _, msg := range prunedMsgs[:2] {
+		if err := convRepo.DeleteMessage(ctx, pruned.ID, msg.ID, owner); err != nil {
+			t.Fatalf("delete message: %v", err)
+		}
+	}
+	// Archived conversations aren't summarized
+	archived, _ := seed(6)
+	if err := convRepo.Archive(ctx, archived.ID, owner); err != nil {
+		t.Fatalf("archive conversation: %v", err)
+	}
+
+	// Page through every candidate; other tests' conversations share the table, so only
+	// this owner's are compared
+	got := make(map[uuid.UUID]int64)
+	after := uuid.Nil
+	for {
+		page, err := convRepo.ListNeedingSummary(ctx, trigger, after, 2)
+		if err != nil {
+			t.Fatalf("ListNeedingSummary() error = %v", err)
+		}
+		for _, c := range page {
+			if c.ID.String() <= after.String() {
+				t.Fatalf("candidate %s after %s, want ID order", c.ID, after)
+			}
+			after = c.ID
+			if c.PublicKey == owner {
+				got[c.ID] = c.ActiveMessages
+			}
+		}
+		if len(page) < 2 {
+			break
+		}
+	}
+
+	want := map[uuid.UUID]int64{unsummarized.ID: 6, stale.ID: 6}
+	if len(got) != len(want) {
+		t.Errorf("ListNeedingSummary() returned %d of the owner's conversations, want %d: %v", len(got), len(want), got)
+	}
+	for id, active := range want {
+		if got[id] != active {
+			t.Errorf("conversation %s has %d active messages, want %d", id, got[id], active)
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sirupsen/logrus"
 
 	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
 	"github.com/vultisig/agent-backend/internal/types"
@@ -66,6 +67,28 @@ func timeToPgtimestamptz(t time.Time) pgtype.Timestamptz {
 	}
 }
 
+func uuidsFromDB(ids []pgtype.UUID) []uuid.UUID {
+	out := make([]uuid.UUID, len(ids))
+	for i, id := range ids {
+		out[i] = pgtypeToUUID(id)
+	}
+	return out
+}
+
+// bulkFilterToDB converts a bulk filter to query arguments. The ID array is never NULL, and
+// a missing cutoff is NULL, which matches nothing.
+func bulkFilterToDB(f types.BulkFilter) ([]pgtype.UUID, pgtype.Timestamptz) {
+	ids := make([]pgtype.UUID, len(f.IDs))
+	for i, id := range f.IDs {
+		ids[i] = uuidToPgtype(id)
+	}
+	var olderThan pgtype.Timestamptz
+	if f.OlderThan != nil {
+		olderThan = timeToPgtimestamptz(*f.OlderThan)
+	}
+	return ids, olderThan
+}
+
 // Model conversions
 
 func conversationFromDB(c *queries.AgentConversation) *types.Conversation {
@@ -81,6 +104,11 @@ func conversationFromDB(c *queries.AgentConversation) *types.Conversation {
 		CreatedAt:   pgtimestamptzToTime(c.CreatedAt),
 		UpdatedAt:   pgtimestamptzToTime(c.UpdatedAt),
 		ArchivedAt:  pgtimestamptzToTimePtr(c.ArchivedAt),
+		Tags:        c.Tags,
+		Imported:    c.Imported,
+		Labels:      c.Labels,
+		NoMemory:    c.NoMemory,
+		Revision:    c.Revision,
 	}
 }
 
@@ -103,10 +131,11 @@ func messageRoleToDB(r types.MessageRole) queries.AgentMessageRole {
 	return queries.AgentMessageRole(r)
 }
 
-func messageFromDB(m *queries.AgentMessage) *types.Message {
+func messageFromDB(m *queries.AgentMessage, logger *logrus.Logger) *types.Message {
 	if m == nil {
 		return nil
 	}
+	metadata, blocks := messageMetadata(m, logger)
 	return &types.Message{
 		ID:             pgtypeToUUID(m.ID),
 		ConversationID: pgtypeToUUID(m.ConversationID),
@@ -114,15 +143,43 @@ func messageFromDB(m *queries.AgentMessage) *types.Message {
 		Content:        m.Content,
 		ContentType:    m.ContentType,
 		AudioURL:       pgtextToStringPtr(m.AudioUrl),
-		Metadata:       json.RawMessage(m.Metadata),
+		Metadata:       metadata,
+		Blocks:         blocks,
 		CreatedAt:      pgtimestamptzToTime(m.CreatedAt),
+		DeletedAt:      pgtimestamptzToTimePtr(m.DeletedAt),
 	}
 }
 
-func messagesFromDB(ms []*queries.AgentMessage) []types.Message {
+// storedMetadata is the part of message metadata read when loading a message.
+type storedMetadata struct {
+	Blocks json.RawMessage `json:"blocks"`
+}
+
+// messageMetadata returns a message's metadata if it is a JSON object, which every reader
+// expects, along with the structured blocks stored under metadata.blocks. Anything else (a
+// double-encoded string or an array written by a past bug) is logged and dropped rather than
+// handed on; the 20260308000001 migration clears such rows. Malformed blocks are left out
+// without dropping the metadata.
+func messageMetadata(m *queries.AgentMessage, logger *logrus.Logger) (json.RawMessage, []types.Block) {
+	if len(m.Metadata) == 0 {
+		return nil, nil
+	}
+	var meta storedMetadata
+	if string(m.Metadata) == "null" || json.Unmarshal(m.Metadata, &meta) != nil {
+		logger.WithField("message_id", pgtypeToUUID(m.ID)).Warn("dropping malformed message metadata")
+		return nil, nil
+	}
+	var blocks []types.Block
+	if len(meta.Blocks) > 0 {
+		_ = json.Unmarshal(meta.Blocks, &blocks)
+	}
+	return json.RawMessage(m.Metadata), blocks
+}
+
+func messagesFromDB(ms []*queries.AgentMessage, logger *logrus.Logger) []types.Message {
 	result := make([]types.Message, len(ms))
 	for i, m := range ms {
-		msg := messageFromDB(m)
+		msg := messageFromDB(m, logger)
 		if msg != nil {
 			result[i] = *msg
 		}
@@ -140,3 +197,90 @@ func userMemoryFromDB(m *queries.AgentUserMemory) *types.UserMemory {
 		UpdatedAt: pgtimestamptzToTime(m.UpdatedAt),
 	}
 }
+
+func outboxEventFromDB(e *queries.AgentOutboxEvent) *types.OutboxEvent {
+	if e == nil {
+		return nil
+	}
+	return &types.OutboxEvent{
+		ID:        pgtypeToUUID(e.ID),
+		Kind:      e.Kind,
+		Payload:   e.Payload,
+		Attempts:  int(e.Attempts),
+		CreatedAt: pgtimestamptzToTime(e.CreatedAt),
+	}
+}
+
+func contactFromDB(c *queries.AgentContact) *types.Contact {
+	if c == nil {
+		return nil
+	}
+	return &types.Contact{
+		ID:        pgtypeToUUID(c.ID),
+		PublicKey: c.PublicKey,
+		Name:      c.Name,
+		Chain:     c.Chain,
+		Address:   c.Address,
+		CreatedAt: pgtimestamptzToTime(c.CreatedAt),
+	}
+}
+
+func policyDraftFromDB(d *queries.AgentPolicyDraft) *types.PolicyDraft {
+	if d == nil {
+		return nil
+	}
+	return &types.PolicyDraft{
+		ID:             pgtypeToUUID(d.ID),
+		ConversationID: pgtypeToUUID(d.ConversationID),
+		PluginID:       d.PluginID,
+		Configuration:  d.Configuration,
+		PolicySuggest:  d.PolicySuggest,
+		Status:         d.Status,
+		CreatedAt:      pgtimestamptzToTime(d.CreatedAt),
+	}
+}
+
+func toolParseFailureFromDB(f *queries.AgentToolParseFailure) *types.ToolParseFailure {
+	if f == nil {
+		return nil
+	}
+	return &types.ToolParseFailure{
+		ID:            pgtypeToUUID(f.ID),
+		Ability:       f.Ability,
+		ToolName:      f.ToolName,
+		RawInput:      f.RawInput,
+		Error:         f.Error,
+		Model:         f.Model,
+		PromptVersion: f.PromptVersion,
+		Rescued:       f.Rescued,
+		CreatedAt:     pgtimestamptzToTime(f.CreatedAt),
+	}
+}
+
+func expiryNoticeFromDB(n *queries.ClaimDueExpiryNoticesRow) *types.ExpiryNotice {
+	if n == nil {
+		return nil
+	}
+	return &types.ExpiryNotice{
+		ID:             pgtypeToUUID(n.ID),
+		Kind:           n.Kind,
+		RefID:          n.RefID,
+		ConversationID: pgtypeToUUID(n.ConversationID),
+		PublicKey:      n.PublicKey,
+		ExpiresAt:      pgtimestamptzToTime(n.ExpiresAt),
+		NotifiedAt:     pgtimestamptzToTimePtr(n.NotifiedAt),
+		CreatedAt:      pgtimestamptzToTime(n.CreatedAt),
+	}
+}
+
+func attachmentFromDB(a *queries.AgentAttachment) *types.Attachment {
+	if a == nil {
+		return nil
+	}
+	return &types.Attachment{
+		ID:          pgtypeToUUID(a.ID),
+		ContentType: a.ContentType,
+		SizeBytes:   int(a.SizeBytes),
+		CreatedAt:   pgtimestamptzToTime(a.CreatedAt),
+	}
+}
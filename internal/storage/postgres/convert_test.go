@@ -0,0 +1,47 @@
+package postgres
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
+)
+
+func TestMessageMetadata(t *testing.T) {
+	tests := []struct {
+		name         string
+		metadata     string
+		wantMetadata bool
+		wantBlocks   int
+		wantWarning  bool
+	}{
+		{name: "empty"},
+		{name: "object", metadata: `{"confidence":0.9}`, wantMetadata: true},
+		{name: "object with blocks", metadata: `{"blocks":[{"type":"text"},{"type":"text"}]}`, wantMetadata: true, wantBlocks: 2},
+		{name: "malformed blocks keep metadata", metadata: `{"blocks":"oops"}`, wantMetadata: true},
+		{name: "null", metadata: `null`, wantWarning: true},
+		{name: "double-encoded string", metadata: `"{\"confidence\":0.9}"`, wantWarning: true},
+		{name: "array", metadata: `[1,2]`, wantWarning: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			hook := test.NewLocal(logger)
+
+			metadata, blocks := messageMetadata(&queries.AgentMessage{Metadata: []byte(tt.metadata)}, logger)
+			if got := metadata != nil; got != tt.wantMetadata {
+				t.Errorf("metadata kept = %v, want %v", got, tt.wantMetadata)
+			}
+			if len(blocks) != tt.wantBlocks {
+				t.Errorf("got %d blocks, want %d", len(blocks), tt.wantBlocks)
+			}
+			if got := len(hook.Entries) > 0; got != tt.wantWarning {
+				t.Errorf("warned = %v, want %v", got, tt.wantWarning)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testDSNEnv names the database repository tests run against. The tests are skipped when
+// it is unset; the database is migrated and left in place, and every test works on its own
+// public keys, so tests don't see each other's rows.
+const testDSNEnv = "TEST_DATABASE_DSN"
+
+// testDB connects to the test database, skipping the test when none is configured.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", testDSNEnv)
+	}
+	db, err := New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+// testPublicKey returns a random vault public key, so each test owns its rows.
+func testPublicKey(t *testing.T) string {
+	t.Helper()
+	b := make([]byte, 33)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// testLogger returns a logger that discards its output.
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// EmbeddingRepository handles message embedding persistence for semantic recall.
+type EmbeddingRepository struct {
+	pool *pgxpool.Pool
+	q    *queries.Queries
+}
+
+// NewEmbeddingRepository creates a new EmbeddingRepository.
+func NewEmbeddingRepository(pool *pgxpool.Pool) *EmbeddingRepository {
+	return &EmbeddingRepository{pool: pool, q: queries.New(pool)}
+}
+
+// Upsert stores a message's embedding, replacing any earlier one.
+func (r *EmbeddingRepository) Upsert(ctx context.Context, messageID, convID uuid.UUID, model string, embedding []float32) error {
+	err := r.q.UpsertMessageEmbedding(ctx, &queries.UpsertMessageEmbeddingParams{
+		MessageID:      uuidToPgtype(messageID),
+		ConversationID: uuidToPgtype(convID),
+		Model:          model,
+		Embedding:      vectorLiteral(embedding),
+	})
+	if err != nil {
+		return fmt.Errorf("upsert message embedding: %w", err)
+	}
+	return nil
+}
+
+// Search returns up to limit messages of the conversation created before the given time,
+// most similar to the query embedding first. Only embeddings from the same model are compared.
+func (r *EmbeddingRepository) Search(ctx context.Context, convID uuid.UUID, model string, embedding []float32, before time.Time, limit int) ([]types.RecalledMessage, error) {
+	rows, err := r.q.SearchMessageEmbeddings(ctx, &queries.SearchMessageEmbeddingsParams{
+		Embedding:      vectorLiteral(embedding),
+		ConversationID: uuidToPgtype(convID),
+		Model:          model,
+		Before:         timeToPgtimestamptz(before),
+		MaxResults:     int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("search message embeddings: %w", err)
+	}
+
+	result := make([]types.RecalledMessage, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, types.RecalledMessage{
+			ID:        pgtypeToUUID(row.ID),
+			Role:      messageRoleFromDB(row.Role),
+			Content:   row.Content,
+			CreatedAt: pgtimestamptzToTime(row.CreatedAt),
+			Distance:  row.Distance,
+		})
+	}
+	return result, nil
+}
+
+// ListWithoutEmbedding returns up to limit user and assistant text messages, oldest first,
+// that have no embedding from the given model yet, leaving out those of conversations and
+// turns with memory turned off. Used to backfill existing conversations.
+func (r *EmbeddingRepository) ListWithoutEmbedding(ctx context.Context, model string, limit int) ([]types.Message, error) {
+	rows, err := r.q.ListMessagesWithoutEmbedding(ctx, &queries.ListMessagesWithoutEmbeddingParams{
+		Model:      model,
+		MaxResults: int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list messages without embedding: %w", err)
+	}
+
+	result := make([]types.Message, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, types.Message{
+			ID:             pgtypeToUUID(row.ID),
+			ConversationID: pgtypeToUUID(row.ConversationID),
+			Content:        row.Content,
+		})
+	}
+	return result, nil
+}
+
+// vectorLiteral renders an embedding in pgvector's text format, e.g. "[0.1,0.2]".
+func vectorLiteral(embedding []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, v := range embedding {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ExpiryNoticeRepository handles the notices sent before drafts and suggestions expire.
+type ExpiryNoticeRepository struct {
+	pool *pgxpool.Pool
+	q    *queries.Queries
+}
+
+// NewExpiryNoticeRepository creates a new ExpiryNoticeRepository.
+func NewExpiryNoticeRepository(pool *pgxpool.Pool) *ExpiryNoticeRepository {
+	return &ExpiryNoticeRepository{
+		pool: pool,
+		q:    queries.New(pool),
+	}
+}
+
+// Track records that notice.RefID expires at notice.ExpiresAt. Tracking the same item
+// again is a no-op.
+func (r *ExpiryNoticeRepository) Track(ctx context.Context, notice *types.ExpiryNotice) error {
+	err := r.q.CreateExpiryNotice(ctx, &queries.CreateExpiryNoticeParams{
+		Kind:           notice.Kind,
+		RefID:          notice.RefID,
+		ConversationID: uuidToPgtype(notice.ConversationID),
+		ExpiresAt:      timeToPgtimestamptz(notice.ExpiresAt),
+	})
+	if err != nil {
+		return fmt.Errorf("create expiry notice: %w", err)
+	}
+	return nil
+}
+
+// ClaimDue marks up to batchSize notices expiring within window as notified and records the
+// outbox event built by event for each, in one transaction, so every notice is sent at most
+// once even across restarts. Events become due for the background dispatcher at
+// dispatchAfter; IDs are set on the returned events.
+func (r *ExpiryNoticeRepository) ClaimDue(ctx context.Context, window time.Duration, batchSize int, dispatchAfter time.Time, event func(*types.ExpiryNotice) (*types.OutboxEvent, error)) ([]*types.OutboxEvent, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	rows, err := q.ClaimDueExpiryNotices(ctx, &queries.ClaimDueExpiryNoticesParams{
+		WindowSeconds: window.Seconds(),
+		BatchSize:     int32(batchSize),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("claim expiry notices: %w", err)
+	}
+
+	events := make([]*types.OutboxEvent, 0, len(rows))
+	for _, row := range rows {
+		e, err := event(expiryNoticeFromDB(row))
+		if err != nil {
+			return nil, err
+		}
+		created, err := q.CreateOutboxEvent(ctx, &queries.CreateOutboxEventParams{
+			Kind:          e.Kind,
+			Payload:       e.Payload,
+			NextAttemptAt: timeToPgtimestamptz(dispatchAfter),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create outbox event: %w", err)
+		}
+		e.ID = pgtypeToUUID(created.ID)
+		e.CreatedAt = pgtimestamptzToTime(created.CreatedAt)
+		events = append(events, e)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return events, nil
+}
+
+// DeleteExpired removes notices that expired before the given time.
+func (r *ExpiryNoticeRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	if err := r.q.DeleteExpiryNoticesBefore(ctx, timeToPgtimestamptz(before)); err != nil {
+		return fmt.Errorf("delete expired notices: %w", err)
+	}
+	return nil
+}
@@ -2,11 +2,15 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
 
 	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
 	"github.com/vultisig/agent-backend/internal/types"
@@ -14,13 +18,17 @@ import (
 
 // MessageRepository handles database operations for messages.
 type MessageRepository struct {
-	q *queries.Queries
+	pool   *pgxpool.Pool
+	q      *queries.Queries
+	logger *logrus.Logger
 }
 
 // NewMessageRepository creates a new MessageRepository.
-func NewMessageRepository(pool *pgxpool.Pool) *MessageRepository {
+func NewMessageRepository(pool *pgxpool.Pool, logger *logrus.Logger) *MessageRepository {
 	return &MessageRepository{
-		q: queries.New(pool),
+		pool:   pool,
+		q:      queries.New(pool),
+		logger: logger,
 	}
 }
 
@@ -41,6 +49,82 @@ func (r *MessageRepository) Create(ctx context.Context, msg *types.Message) erro
 	// Update the input message with generated values
 	msg.ID = pgtypeToUUID(created.ID)
 	msg.CreatedAt = pgtimestamptzToTime(created.CreatedAt)
+	msg.Revision = created.Revision
+
+	return nil
+}
+
+// CreateWithOutbox creates a message and its side-effect events in one transaction, so the
+// effects are delivered eventually even if the process dies right after the insert.
+// Events become due for the background dispatcher at dispatchAfter; the caller is expected
+// to attempt delivery immediately and mark them complete. IDs are set on the input events.
+func (r *MessageRepository) CreateWithOutbox(ctx context.Context, msg *types.Message, events []*types.OutboxEvent, dispatchAfter time.Time) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	created, err := q.CreateMessage(ctx, &queries.CreateMessageParams{
+		ConversationID: uuidToPgtype(msg.ConversationID),
+		Role:           messageRoleToDB(msg.Role),
+		Content:        msg.Content,
+		ContentType:    msg.ContentType,
+		AudioUrl:       stringPtrToPgtext(msg.AudioURL),
+		Metadata:       msg.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("create message: %w", err)
+	}
+
+	for _, event := range events {
+		row, err := q.CreateOutboxEvent(ctx, &queries.CreateOutboxEventParams{
+			Kind:          event.Kind,
+			Payload:       event.Payload,
+			NextAttemptAt: timeToPgtimestamptz(dispatchAfter),
+		})
+		if err != nil {
+			return fmt.Errorf("create outbox event: %w", err)
+		}
+		event.ID = pgtypeToUUID(row.ID)
+		event.CreatedAt = pgtimestamptzToTime(row.CreatedAt)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	msg.ID = pgtypeToUUID(created.ID)
+	msg.CreatedAt = pgtimestamptzToTime(created.CreatedAt)
+	msg.Revision = created.Revision
+
+	return nil
+}
+
+// CreateIfOwned creates a new message only if its conversation exists, is not archived, and
+// belongs to the given public key. Ownership is checked in the same statement as the insert,
+// saving a separate lookup. Returns ErrNotFound if the caller does not own the conversation.
+func (r *MessageRepository) CreateIfOwned(ctx context.Context, msg *types.Message, publicKey string) error {
+	created, err := r.q.CreateMessageIfOwned(ctx, &queries.CreateMessageIfOwnedParams{
+		ConversationID: uuidToPgtype(msg.ConversationID),
+		PublicKey:      publicKey,
+		Role:           messageRoleToDB(msg.Role),
+		Content:        msg.Content,
+		ContentType:    msg.ContentType,
+		AudioUrl:       stringPtrToPgtext(msg.AudioURL),
+		Metadata:       msg.Metadata,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("create message: %w", err)
+	}
+
+	msg.ID = pgtypeToUUID(created.ID)
+	msg.CreatedAt = pgtimestamptzToTime(created.CreatedAt)
+	msg.Revision = created.Revision
 
 	return nil
 }
@@ -51,7 +135,23 @@ func (r *MessageRepository) GetByConversationID(ctx context.Context, convID uuid
 	if err != nil {
 		return nil, fmt.Errorf("get messages: %w", err)
 	}
-	return messagesFromDB(msgs), nil
+	return messagesFromDB(msgs, r.logger), nil
+}
+
+// GetByID returns a message of a conversation, or ErrNotFound if it doesn't exist or was
+// deleted. Callers check the conversation's ownership.
+func (r *MessageRepository) GetByID(ctx context.Context, convID, messageID uuid.UUID) (*types.Message, error) {
+	msg, err := r.q.GetMessageByID(ctx, &queries.GetMessageByIDParams{
+		ID:             uuidToPgtype(messageID),
+		ConversationID: uuidToPgtype(convID),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get message: %w", err)
+	}
+	return messageFromDB(msg, r.logger), nil
 }
 
 // GetRecent returns the most recent messages for a conversation in chronological order.
@@ -63,7 +163,7 @@ func (r *MessageRepository) GetRecent(ctx context.Context, convID uuid.UUID, lim
 	if err != nil {
 		return nil, fmt.Errorf("get recent messages: %w", err)
 	}
-	result := messagesFromDB(msgs)
+	result := messagesFromDB(msgs, r.logger)
 	// Reverse to get chronological order (query returns DESC)
 	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
 		result[i], result[j] = result[j], result[i]
@@ -101,7 +201,7 @@ func (r *MessageRepository) GetSince(ctx context.Context, convID uuid.UUID, sinc
 	if err != nil {
 		return nil, fmt.Errorf("get messages since: %w", err)
 	}
-	return messagesFromDB(msgs), nil
+	return messagesFromDB(msgs, r.logger), nil
 }
 
 // GetRecentSince returns the most recent messages after the given timestamp in chronological order.
@@ -114,10 +214,27 @@ func (r *MessageRepository) GetRecentSince(ctx context.Context, convID uuid.UUID
 	if err != nil {
 		return nil, fmt.Errorf("get recent messages since: %w", err)
 	}
-	result := messagesFromDB(msgs)
+	result := messagesFromDB(msgs, r.logger)
 	// Reverse to get chronological order (query returns DESC)
 	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
 		result[i], result[j] = result[j], result[i]
 	}
 	return result, nil
 }
+
+// ListReplayCandidates returns up to limit assistant replies of the intent and policy
+// abilities created in [from, to), for replaying offline. A non-empty intent or pluginID
+// keeps only replies with that intent, or about that plugin.
+func (r *MessageRepository) ListReplayCandidates(ctx context.Context, from, to time.Time, intent, pluginID string, limit int) ([]types.Message, error) {
+	msgs, err := r.q.ListReplayCandidates(ctx, &queries.ListReplayCandidatesParams{
+		CreatedFrom: timeToPgtimestamptz(from),
+		CreatedTo:   timeToPgtimestamptz(to),
+		Intent:      pgtype.Text{String: intent, Valid: intent != ""},
+		PluginID:    pgtype.Text{String: pluginID, Valid: pluginID != ""},
+		MaxResults:  int32(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list replay candidates: %w", err)
+	}
+	return messagesFromDB(msgs, r.logger), nil
+}
@@ -0,0 +1,199 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestCreateIfOwned(t *testing.T) {
+	db := testDB(t)
+	convRepo := NewConversationRepository(db.Pool(), testLogger())
+	msgRepo := NewMessageRepository(db.Pool(), testLogger())
+	ctx := context.Background()
+	owner := testPublicKey(t)
+
+	live, err := convRepo.Create(ctx, owner, false)
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	archived, err := convRepo.Create(ctx, owner, false)
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	if err := convRepo.Archive(ctx, archived.ID, owner); err != nil {
+		t.Fatalf("archive conversation: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		convID    uuid.UUID
+		publicKey string
+		wantErr   error
+	}{
+		{name: "owner", convID: live.ID, publicKey: owner},
+		{name: "foreign owner", convID: live.ID, publicKey: testPublicKey(t), wantErr: ErrNotFound},
+		{name: "archived", convID: archived.ID, publicKey: owner, wantErr: ErrNotFound},
+		{name: "missing conversation", convID: uuid.New(), publicKey: owner, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := msgRepo.GetByConversationID(ctx, tt.convID)
+			if err != nil {
+				t.Fatalf("get messages: %v", err)
+			}
+			var revision int64
+			if conv, err := convRepo.GetForAdmin(ctx, tt.convID); err == nil {
+				revision = conv.Revision
+			}
+
+			msg := types.Message{ConversationID: tt.convID, Role: types.RoleUser, Content: "hi", ContentType: "text"}
+			err = msgRepo.CreateIfOwned(ctx, &msg, tt.publicKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateIfOwned() error = %v, want %v", err, tt.wantErr)
+			}
+
+			after, err := msgRepo.GetByConversationID(ctx, tt.convID)
+			if err != nil {
+				t.Fatalf("get messages: %v", err)
+			}
+			if tt.wantErr != nil {
+				// Nothing is written and the conversation's revision doesn't move
+				if len(after) != len(before) {
+					t.Errorf("conversation has %d messages, want %d", len(after), len(before))
+				}
+				if conv, err := convRepo.GetForAdmin(ctx, tt.convID); err == nil && conv.Revision != revision {
+					t.Errorf("revision = %d, want unchanged %d", conv.Revision, revision)
+				}
+				return
+			}
+			if len(after) != len(before)+1 || after[len(after)-1].ID != msg.ID {
+				t.Errorf("conversation has %d messages, want the new message %s appended", len(after), msg.ID)
+			}
+			if msg.Revision != revision+1 {
+				t.Errorf("message revision = %d, want %d", msg.Revision, revision+1)
+			}
+		})
+	}
+}
+
+func TestDeleteMessageExcludedFromWindow(t *testing.T) {
+	db := testDB(t)
+	convRepo := NewConversationRepository(db.Pool(), testLogger())
+	msgRepo := NewMessageRepository(db.Pool(), testLogger())
+	ctx := context.Background()
+	owner := testPublicKey(t)
+
+	conv, err := convRepo.Create(ctx, owner, false)
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	contents := []string{"hi", "hello", "my seed is abandon abandon", "don't share that", "thanks", "anytime"}
+	msgs := make([]types.Message, len(contents))
+	for i, content := range contents {
+		role := types.RoleUser
+		if i%2 == 1 {
+			role = types.RoleAssistant
+		}
+		msgs[i] = types.Message{ConversationID: conv.ID, Role: role, Content: content, ContentType: "text"}
+		if err := msgRepo.Create(ctx, &msgs[i]); err != nil {
+			t.Fatalf("create message: %v", err)
+		}
+	}
+	// The summary covers the first exchange only
+	if err := convRepo.UpdateSummaryWithCursor(ctx, conv.ID, owner, "The user said hi.", msgs[1].CreatedAt); err != nil {
+		t.Fatalf("store summary: %v", err)
+	}
+
+	secret := msgs[2]
+	if err := convRepo.DeleteMessage(ctx, conv.ID, secret.ID, owner); err != nil {
+		t.Fatalf("DeleteMessage() error = %v", err)
+	}
+
+	contentsOf := func(msgs []types.Message) []string {
+		var out []string
+		for _, m := range msgs {
+			out = append(out, m.Content)
+		}
+		return out
+	}
+	// Every read the context window and summarization are built from skips the message;
+	// the reply to it stays
+	live := []string{"hi", "hello", "don't share that", "thanks", "anytime"}
+	all, err := msgRepo.GetByConversationID(ctx, conv.ID)
+	if err != nil || !slices.Equal(contentsOf(all), live) {
+		t.Errorf("GetByConversationID() = %q, %v; want %q", contentsOf(all), err, live)
+	}
+	if n, err := msgRepo.CountByConversationID(ctx, conv.ID); err != nil || n != len(live) {
+		t.Errorf("CountByConversationID() = %d, %v; want %d", n, err, len(live))
+	}
+	recent, err := msgRepo.GetRecent(ctx, conv.ID, 4)
+	if want := live[1:]; err != nil || !slices.Equal(contentsOf(recent), want) {
+		t.Errorf("GetRecent(4) = %q, %v; want %q", contentsOf(recent), err, want)
+	}
+	since, err := msgRepo.GetSince(ctx, conv.ID, msgs[1].CreatedAt)
+	if want := live[2:]; err != nil || !slices.Equal(contentsOf(since), want) {
+		t.Errorf("GetSince() = %q, %v; want %q", contentsOf(since), err, want)
+	}
+	if n, err := msgRepo.CountSince(ctx, conv.ID, msgs[1].CreatedAt); err != nil || n != 3 {
+		t.Errorf("CountSince() = %d, %v; want 3", n, err)
+	}
+	recentSince, err := msgRepo.GetRecentSince(ctx, conv.ID, msgs[1].CreatedAt, 10)
+	if want := live[2:]; err != nil || !slices.Equal(contentsOf(recentSince), want) {
+		t.Errorf("GetRecentSince() = %q, %v; want %q", contentsOf(recentSince), err, want)
+	}
+	if _, err := msgRepo.GetByID(ctx, conv.ID, secret.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetByID() of the deleted message error = %v, want %v", err, ErrNotFound)
+	}
+
+	// The history shows a tombstone in its place
+	history, err := convRepo.GetWithMessages(ctx, conv.ID, owner)
+	if err != nil {
+		t.Fatalf("GetWithMessages() error = %v", err)
+	}
+	if len(history.Messages) != len(contents) {
+		t.Fatalf("GetWithMessages() returned %d messages, want %d", len(history.Messages), len(contents))
+	}
+	if tomb := history.Messages[2]; tomb.ID != secret.ID || tomb.ContentType != "deleted" || tomb.Content != "" {
+		t.Errorf("message 2 = %s %s %q, want a tombstone for %s", tomb.ID, tomb.ContentType, tomb.Content, secret.ID)
+	}
+
+	// A summary written before the deleted message is kept
+	if summary, _, err := convRepo.GetSummaryWithCursor(ctx, conv.ID, owner); err != nil || summary == nil {
+		t.Errorf("summary = %v, %v; want it kept", summary, err)
+	}
+
+	tests := []struct {
+		name      string
+		messageID uuid.UUID
+		publicKey string
+		wantErr   error
+	}{
+		{name: "already deleted", messageID: secret.ID, publicKey: owner},
+		{name: "foreign owner", messageID: msgs[3].ID, publicKey: testPublicKey(t), wantErr: ErrNotFound},
+		{name: "missing message", messageID: uuid.New(), publicKey: owner, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := convRepo.DeleteMessage(ctx, conv.ID, tt.messageID, tt.publicKey); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DeleteMessage() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if n, err := msgRepo.CountByConversationID(ctx, conv.ID); err != nil || n != len(live) {
+		t.Errorf("CountByConversationID() after the refused deletes = %d, %v; want %d", n, err, len(live))
+	}
+
+	// Deleting a message the summary covers drops the summary with it
+	if err := convRepo.DeleteMessage(ctx, conv.ID, msgs[0].ID, owner); err != nil {
+		t.Fatalf("DeleteMessage() of a summarized message error = %v", err)
+	}
+	if summary, cursor, err := convRepo.GetSummaryWithCursor(ctx, conv.ID, owner); err != nil || summary != nil || cursor != nil {
+		t.Errorf("summary = %v at %v, %v; want it cleared", summary, cursor, err)
+	}
+}
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE agent_contacts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    public_key VARCHAR(66) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    chain VARCHAR(50) NOT NULL,
+    address TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_agent_contacts_owner_name_chain ON agent_contacts(public_key, LOWER(name), chain);
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE IF EXISTS agent_contacts;
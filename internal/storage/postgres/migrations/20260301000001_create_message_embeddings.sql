@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Semantic recall needs pgvector. Without it the migration fails rather than being
+-- recorded as applied with no table, which a later rerun could never fix.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'vector') THEN
+        RAISE EXCEPTION 'pgvector is not available: install the vector extension on the database server and migrate again';
+    END IF;
+
+    CREATE EXTENSION IF NOT EXISTS vector;
+
+    -- Dimensions depend on the embedding model, so the column is unsized and rows are
+    -- tagged with the model that produced them.
+    CREATE TABLE agent_message_embeddings (
+        message_id UUID PRIMARY KEY REFERENCES agent_messages(id) ON DELETE CASCADE,
+        conversation_id UUID NOT NULL REFERENCES agent_conversations(id) ON DELETE CASCADE,
+        model VARCHAR(100) NOT NULL,
+        embedding vector NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+    CREATE INDEX idx_agent_message_embeddings_conversation ON agent_message_embeddings(conversation_id, model);
+END $$;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE IF EXISTS agent_message_embeddings;
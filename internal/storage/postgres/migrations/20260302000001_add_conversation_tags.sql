@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE agent_conversations ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_agent_conversations_tags ON agent_conversations USING GIN (tags);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_agent_conversations_tags;
+ALTER TABLE agent_conversations DROP COLUMN tags;
+-- +goose StatementEnd
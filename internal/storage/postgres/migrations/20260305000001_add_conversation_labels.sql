@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE agent_conversations ADD COLUMN labels TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX idx_agent_conversations_labels ON agent_conversations USING GIN (labels);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_agent_conversations_labels;
+ALTER TABLE agent_conversations DROP COLUMN labels;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE agent_policy_drafts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    conversation_id UUID NOT NULL REFERENCES agent_conversations(id) ON DELETE CASCADE,
+    plugin_id VARCHAR(255) NOT NULL,
+    configuration JSONB NOT NULL,
+    policy_suggest JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_agent_policy_drafts_pending ON agent_policy_drafts(conversation_id, created_at) WHERE status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE IF EXISTS agent_policy_drafts;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Message metadata is always read as an object; clear values a past bug stored otherwise
+-- (double-encoded strings, arrays, JSON null).
+UPDATE agent_messages
+SET metadata = NULL
+WHERE metadata IS NOT NULL AND jsonb_typeof(metadata) <> 'object';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- The cleared values are not restored.
+SELECT 1;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE agent_tool_parse_failures (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ability VARCHAR(32) NOT NULL,
+    tool_name VARCHAR(64) NOT NULL,
+    raw_input TEXT NOT NULL,
+    error TEXT NOT NULL,
+    model VARCHAR(255) NOT NULL,
+    prompt_version VARCHAR(32) NOT NULL,
+    rescued BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_agent_tool_parse_failures_created_at ON agent_tool_parse_failures(created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE IF EXISTS agent_tool_parse_failures;
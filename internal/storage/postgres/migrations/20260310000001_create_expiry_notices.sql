@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE agent_expiry_notices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(20) NOT NULL,
+    ref_id VARCHAR(100) NOT NULL,
+    conversation_id UUID NOT NULL REFERENCES agent_conversations(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    notified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_agent_expiry_notices_ref ON agent_expiry_notices(kind, ref_id);
+CREATE INDEX idx_agent_expiry_notices_due ON agent_expiry_notices(expires_at) WHERE notified_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE IF EXISTS agent_expiry_notices;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE agent_conversations ADD COLUMN revision BIGINT NOT NULL DEFAULT 0;
+
+-- Existing conversations start at their message count, as if every insert had bumped it
+UPDATE agent_conversations c
+SET revision = (SELECT COUNT(*) FROM agent_messages m WHERE m.conversation_id = c.id);
+-- +goose StatementEnd
+
+-- +goose Down
+ALTER TABLE agent_conversations DROP COLUMN IF EXISTS revision;
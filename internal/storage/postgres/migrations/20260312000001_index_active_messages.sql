@@ -0,0 +1,8 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+-- Counts active messages past a summary cursor without reading the rows. Built
+-- concurrently so writes to agent_messages aren't blocked while it builds.
+CREATE INDEX CONCURRENTLY IF NOT EXISTS idx_agent_messages_conversation_active ON agent_messages(conversation_id, created_at) WHERE deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX CONCURRENTLY IF EXISTS idx_agent_messages_conversation_active;
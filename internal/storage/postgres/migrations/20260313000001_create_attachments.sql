@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE agent_attachments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    public_key VARCHAR(66) NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_agent_attachments_public_key ON agent_attachments(public_key);
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TABLE IF EXISTS agent_attachments;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Action results used to be stored as text only; user stats now read the action and outcome
+-- from metadata, so record them for the results stored before.
+UPDATE agent_messages
+SET metadata = jsonb_build_object(
+    'type', 'action_result',
+    'action', substring(content FROM '^\[Action completed: (.+) was successful\]$'),
+    'success', true)
+WHERE content_type = 'action_result' AND metadata IS NULL
+  AND content ~ '^\[Action completed: .+ was successful\]$';
+
+UPDATE agent_messages
+SET metadata = jsonb_build_object(
+    'type', 'action_result',
+    'action', substring(content FROM '^\[Action failed: (.+?) (?:failed with error|was not successful)'),
+    'success', false)
+WHERE content_type = 'action_result' AND metadata IS NULL
+  AND content ~ '^\[Action failed: .+? (failed with error|was not successful)';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- The text content is unchanged, so the backfilled metadata is left in place.
+SELECT 1;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Labels keep the case the user typed but are filtered case-insensitively, through an
+-- index on their lowercased form.
+CREATE FUNCTION agent_lower_labels(labels TEXT[]) RETURNS TEXT[]
+LANGUAGE sql IMMUTABLE PARALLEL SAFE
+AS $$ SELECT ARRAY(SELECT lower(l) FROM unnest(labels) AS l) $$;
+
+DROP INDEX IF EXISTS idx_agent_conversations_labels;
+CREATE INDEX idx_agent_conversations_labels_lower ON agent_conversations USING GIN (agent_lower_labels(labels));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_agent_conversations_labels_lower;
+CREATE INDEX idx_agent_conversations_labels ON agent_conversations USING GIN (labels);
+DROP FUNCTION IF EXISTS agent_lower_labels(TEXT[]);
+-- +goose StatementEnd
@@ -0,0 +1,73 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// OutboxRepository handles delivery state for outbox events.
+// Events are created together with their message by MessageRepository.CreateWithOutbox.
+type OutboxRepository struct {
+	q *queries.Queries
+}
+
+// NewOutboxRepository creates a new OutboxRepository.
+func NewOutboxRepository(pool *pgxpool.Pool) *OutboxRepository {
+	return &OutboxRepository{q: queries.New(pool)}
+}
+
+// Claim leases up to batchSize due events that have not exhausted maxAttempts.
+// Claimed events are not returned again until leaseUntil passes.
+func (r *OutboxRepository) Claim(ctx context.Context, batchSize, maxAttempts int, leaseUntil time.Time) ([]types.OutboxEvent, error) {
+	rows, err := r.q.ClaimOutboxEvents(ctx, &queries.ClaimOutboxEventsParams{
+		LeaseUntil:  timeToPgtimestamptz(leaseUntil),
+		MaxAttempts: int32(maxAttempts),
+		BatchSize:   int32(batchSize),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox events: %w", err)
+	}
+
+	events := make([]types.OutboxEvent, len(rows))
+	for i, row := range rows {
+		events[i] = *outboxEventFromDB(row)
+	}
+	return events, nil
+}
+
+// Complete marks an event as delivered.
+func (r *OutboxRepository) Complete(ctx context.Context, id uuid.UUID) error {
+	if err := r.q.CompleteOutboxEvent(ctx, uuidToPgtype(id)); err != nil {
+		return fmt.Errorf("complete outbox event: %w", err)
+	}
+	return nil
+}
+
+// Fail records a failed delivery attempt and schedules the next one.
+func (r *OutboxRepository) Fail(ctx context.Context, id uuid.UUID, deliveryErr string, nextAttemptAt time.Time) error {
+	err := r.q.FailOutboxEvent(ctx, &queries.FailOutboxEventParams{
+		ID:            uuidToPgtype(id),
+		LastError:     pgtype.Text{String: deliveryErr, Valid: true},
+		NextAttemptAt: timeToPgtimestamptz(nextAttemptAt),
+	})
+	if err != nil {
+		return fmt.Errorf("fail outbox event: %w", err)
+	}
+	return nil
+}
+
+// DeleteCompleted removes events delivered before the given time.
+func (r *OutboxRepository) DeleteCompleted(ctx context.Context, before time.Time) error {
+	if err := r.q.DeleteCompletedOutboxEvents(ctx, timeToPgtimestamptz(before)); err != nil {
+		return fmt.Errorf("delete completed outbox events: %w", err)
+	}
+	return nil
+}
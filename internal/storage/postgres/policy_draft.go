@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// PolicyDraftRepository handles persistence of built policies awaiting confirmation.
+type PolicyDraftRepository struct {
+	pool *pgxpool.Pool
+	q    *queries.Queries
+}
+
+// NewPolicyDraftRepository creates a new PolicyDraftRepository.
+func NewPolicyDraftRepository(pool *pgxpool.Pool) *PolicyDraftRepository {
+	return &PolicyDraftRepository{pool: pool, q: queries.New(pool)}
+}
+
+// Create stores draft as the conversation's pending draft, superseding any earlier one.
+// draft.ID is used as given so it can be referenced before the row is written.
+func (r *PolicyDraftRepository) Create(ctx context.Context, draft *types.PolicyDraft) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	_, err = q.UpdatePendingPolicyDrafts(ctx, &queries.UpdatePendingPolicyDraftsParams{
+		ConversationID: uuidToPgtype(draft.ConversationID),
+		Status:         types.PolicyDraftSuperseded,
+	})
+	if err != nil {
+		return fmt.Errorf("supersede policy drafts: %w", err)
+	}
+
+	result, err := q.CreatePolicyDraft(ctx, &queries.CreatePolicyDraftParams{
+		ID:             uuidToPgtype(draft.ID),
+		ConversationID: uuidToPgtype(draft.ConversationID),
+		PluginID:       draft.PluginID,
+		Configuration:  draft.Configuration,
+		PolicySuggest:  draft.PolicySuggest,
+	})
+	if err != nil {
+		return fmt.Errorf("create policy draft: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	*draft = *policyDraftFromDB(result)
+	return nil
+}
+
+// GetPending returns the conversation's pending draft if it was built after createdAfter.
+// Returns ErrNotFound if there is none or the conversation isn't owned by the public key.
+func (r *PolicyDraftRepository) GetPending(ctx context.Context, convID uuid.UUID, publicKey string, createdAfter time.Time) (*types.PolicyDraft, error) {
+	result, err := r.q.GetPendingPolicyDraft(ctx, &queries.GetPendingPolicyDraftParams{
+		ConversationID: uuidToPgtype(convID),
+		PublicKey:      publicKey,
+		CreatedAfter:   timeToPgtimestamptz(createdAfter),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get pending policy draft: %w", err)
+	}
+	return policyDraftFromDB(result), nil
+}
+
+// Resolve moves a pending draft to status. With a nil draftID every pending draft of the
+// conversation is resolved. Returns whether any draft was still pending.
+func (r *PolicyDraftRepository) Resolve(ctx context.Context, convID uuid.UUID, draftID *uuid.UUID, status string) (bool, error) {
+	var (
+		n   int64
+		err error
+	)
+	if draftID != nil {
+		n, err = r.q.UpdatePolicyDraftStatus(ctx, &queries.UpdatePolicyDraftStatusParams{
+			ID:             uuidToPgtype(*draftID),
+			ConversationID: uuidToPgtype(convID),
+			Status:         status,
+		})
+	} else {
+		n, err = r.q.UpdatePendingPolicyDrafts(ctx, &queries.UpdatePendingPolicyDraftsParams{
+			ConversationID: uuidToPgtype(convID),
+			Status:         status,
+		})
+	}
+	if err != nil {
+		return false, fmt.Errorf("resolve policy draft: %w", err)
+	}
+	return n > 0, nil
+}
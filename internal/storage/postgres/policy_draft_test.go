@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+func TestPolicyDraftLifecycle(t *testing.T) {
+	db := testDB(t)
+	convs := NewConversationRepository(db.Pool(), testLogger())
+	drafts := NewPolicyDraftRepository(db.Pool())
+	ctx := context.Background()
+	owner := testPublicKey(t)
+
+	conv, err := convs.Create(ctx, owner, false)
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	create := func() *types.PolicyDraft {
+		t.Helper()
+		draft := &types.PolicyDraft{
+			ID:             uuid.New(),
+			ConversationID: conv.ID,
+			PluginID:       "vultisig-dca-0000",
+			Configuration:  json.RawMessage(`{"asset":"ETH"}`),
+			PolicySuggest:  json.RawMessage(`{}`),
+		}
+		id := draft.ID
+		if err := drafts.Create(ctx, draft); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		if draft.ID != id || draft.Status != types.PolicyDraftPending || draft.CreatedAt.IsZero() {
+			t.Fatalf("created draft = %+v, want pending under ID %s", draft, id)
+		}
+		return draft
+	}
+	pending := func(createdAfter time.Time) (*types.PolicyDraft, error) {
+		return drafts.GetPending(ctx, conv.ID, owner, createdAfter)
+	}
+	longAgo := time.Now().Add(-time.Hour)
+
+	first := create()
+	got, err := pending(longAgo)
+	if err != nil || got.ID != first.ID {
+		t.Fatalf("GetPending() = %+v, %v; want the first draft", got, err)
+	}
+	var configuration map[string]any
+	if err := json.Unmarshal(got.Configuration, &configuration); err != nil || configuration["asset"] != "ETH" {
+		t.Errorf("draft configuration = %s, want the stored configuration", got.Configuration)
+	}
+	if _, err := drafts.GetPending(ctx, conv.ID, testPublicKey(t), longAgo); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPending() by another owner error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := pending(time.Now().Add(time.Minute)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPending() of an expired draft error = %v, want %v", err, ErrNotFound)
+	}
+
+	// A newer build supersedes the pending draft, so resolving the old one does nothing
+	second := create()
+	if got, err := pending(longAgo); err != nil || got.ID != second.ID {
+		t.Fatalf("GetPending() = %+v, %v; want the second draft", got, err)
+	}
+	if resolved, err := drafts.Resolve(ctx, conv.ID, &first.ID, types.PolicyDraftConsumed); err != nil || resolved {
+		t.Errorf("Resolve() of a superseded draft = %v, %v; want false", resolved, err)
+	}
+
+	// Consuming the pending draft leaves nothing to restore
+	if resolved, err := drafts.Resolve(ctx, conv.ID, &second.ID, types.PolicyDraftConsumed); err != nil || !resolved {
+		t.Errorf("Resolve() = %v, %v; want true", resolved, err)
+	}
+	if _, err := pending(longAgo); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPending() after consuming error = %v, want %v", err, ErrNotFound)
+	}
+
+	// Without a draft ID the conversation's pending draft is resolved
+	create()
+	if resolved, err := drafts.Resolve(ctx, conv.ID, nil, types.PolicyDraftDiscarded); err != nil || !resolved {
+		t.Errorf("Resolve() without an ID = %v, %v; want true", resolved, err)
+	}
+	if resolved, err := drafts.Resolve(ctx, conv.ID, nil, types.PolicyDraftDiscarded); err != nil || resolved {
+		t.Errorf("Resolve() with nothing pending = %v, %v; want false", resolved, err)
+	}
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
+)
+
+// PublicKeyMergeResult reports what merging case variants of public keys changed, or would
+// change on a dry run.
+type PublicKeyMergeResult struct {
+	DryRun bool `json:"dry_run"`
+	// MixedCaseKeys is the number of distinct public keys stored with uppercase characters
+	MixedCaseKeys   int64 `json:"mixed_case_keys"`
+	Conversations   int64 `json:"conversations"`
+	Contacts        int64 `json:"contacts"`
+	ContactsDropped int64 `json:"contacts_dropped"`
+	Memories        int64 `json:"memories"`
+	MemoriesDropped int64 `json:"memories_dropped"`
+}
+
+// PublicKeyRepository handles maintenance of stored public key spellings.
+type PublicKeyRepository struct {
+	pool *pgxpool.Pool
+	q    *queries.Queries
+}
+
+// NewPublicKeyRepository creates a new PublicKeyRepository.
+func NewPublicKeyRepository(pool *pgxpool.Pool) *PublicKeyRepository {
+	return &PublicKeyRepository{pool: pool, q: queries.New(pool)}
+}
+
+// MergeCaseVariants rewrites every stored public key to lowercase in one transaction, so
+// data split across spellings of the same key is reunited. Contacts that would collide keep
+// the lowercase-key one, else the oldest; colliding memory documents keep the most recently
+// updated. With dryRun the changes are counted and rolled back.
+func (r *PublicKeyRepository) MergeCaseVariants(ctx context.Context, dryRun bool) (*PublicKeyMergeResult, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	q := r.q.WithTx(tx)
+	result := &PublicKeyMergeResult{DryRun: dryRun}
+	if result.MixedCaseKeys, err = q.CountMixedCasePublicKeys(ctx); err != nil {
+		return nil, fmt.Errorf("count mixed-case public keys: %w", err)
+	}
+	if result.MixedCaseKeys == 0 {
+		return result, nil
+	}
+
+	if result.Conversations, err = q.LowercaseConversationPublicKeys(ctx); err != nil {
+		return nil, fmt.Errorf("lowercase conversation public keys: %w", err)
+	}
+	if result.ContactsDropped, err = q.DeleteDuplicateCaseContacts(ctx); err != nil {
+		return nil, fmt.Errorf("delete duplicate contacts: %w", err)
+	}
+	if result.Contacts, err = q.LowercaseContactPublicKeys(ctx); err != nil {
+		return nil, fmt.Errorf("lowercase contact public keys: %w", err)
+	}
+	if result.MemoriesDropped, err = q.DeleteDuplicateCaseMemories(ctx); err != nil {
+		return nil, fmt.Errorf("delete duplicate memories: %w", err)
+	}
+	if result.Memories, err = q.LowercaseMemoryPublicKeys(ctx); err != nil {
+		return nil, fmt.Errorf("lowercase memory public keys: %w", err)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,115 @@
+package postgres
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// keyData is what is stored under one spelling of a public key.
+type keyData struct {
+	conversations int
+	contacts      []string // "name/chain/address"
+	memory        string
+}
+
+func TestMergeCaseVariants(t *testing.T) {
+	db := testDB(t)
+	convRepo := NewConversationRepository(db.Pool(), testLogger())
+	contactRepo := NewContactRepository(db.Pool())
+	memRepo := NewMemoryRepository(db.Pool())
+	keyRepo := NewPublicKeyRepository(db.Pool())
+	ctx := context.Background()
+
+	lower := testPublicKey(t)
+	upper := strings.ToUpper(lower)
+
+	snapshot := func(publicKey string) keyData {
+		t.Helper()
+		var data keyData
+		var err error
+		if _, data.conversations, err = convRepo.List(ctx, publicKey, nil, nil, 0, 10); err != nil {
+			t.Fatalf("list conversations: %v", err)
+		}
+		contacts, err := contactRepo.List(ctx, publicKey)
+		if err != nil {
+			t.Fatalf("list contacts: %v", err)
+		}
+		for _, c := range contacts {
+			data.contacts = append(data.contacts, c.Name+"/"+c.Chain+"/"+c.Address)
+		}
+		mem, err := memRepo.GetMemory(ctx, publicKey)
+		if err != nil {
+			t.Fatalf("get memory: %v", err)
+		}
+		if mem != nil {
+			data.memory = mem.Content
+		}
+		return data
+	}
+
+	// The same vault's data split across two spellings of its key
+	for _, publicKey := range []string{lower, upper} {
+		if _, err := convRepo.Create(ctx, publicKey, false); err != nil {
+			t.Fatalf("create conversation: %v", err)
+		}
+	}
+	for _, c := range []types.Contact{
+		{PublicKey: lower, Name: "Alice", Chain: "Ethereum", Address: "0xaaa"},
+		{PublicKey: upper, Name: "alice", Chain: "Ethereum", Address: "0xbbb"},
+		{PublicKey: upper, Name: "Bob", Chain: "Bitcoin", Address: "bc1bob"},
+	} {
+		if err := contactRepo.Create(ctx, &c, 10); err != nil {
+			t.Fatalf("create contact: %v", err)
+		}
+	}
+	if err := memRepo.UpsertMemory(ctx, lower, "older notes"); err != nil {
+		t.Fatalf("upsert memory: %v", err)
+	}
+	if err := memRepo.UpsertMemory(ctx, upper, "newer notes"); err != nil {
+		t.Fatalf("upsert memory: %v", err)
+	}
+	before := map[string]keyData{lower: snapshot(lower), upper: snapshot(upper)}
+
+	t.Run("dry run counts without changing anything", func(t *testing.T) {
+		result, err := keyRepo.MergeCaseVariants(ctx, true)
+		if err != nil {
+			t.Fatalf("MergeCaseVariants() error = %v", err)
+		}
+		// Other tests' rows may be counted too, so ours set the minimum
+		if !result.DryRun || result.MixedCaseKeys < 1 || result.Conversations < 1 ||
+			result.Contacts < 1 || result.ContactsDropped < 1 || result.Memories < 1 || result.MemoriesDropped < 1 {
+			t.Errorf("dry run result = %+v, want this vault's changes counted", result)
+		}
+		for publicKey, want := range before {
+			if got := snapshot(publicKey); !reflect.DeepEqual(got, want) {
+				t.Errorf("after dry run %s has %+v, want unchanged %+v", publicKey, got, want)
+			}
+		}
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		result, err := keyRepo.MergeCaseVariants(ctx, false)
+		if err != nil {
+			t.Fatalf("MergeCaseVariants() error = %v", err)
+		}
+		if result.DryRun || result.MixedCaseKeys < 1 {
+			t.Errorf("result = %+v, want the merge applied", result)
+		}
+
+		if got := snapshot(upper); !reflect.DeepEqual(got, keyData{}) {
+			t.Errorf("uppercase key still has %+v", got)
+		}
+		want := keyData{
+			conversations: 2,
+			contacts:      []string{"Alice/Ethereum/0xaaa", "Bob/Bitcoin/bc1bob"},
+			memory:        "newer notes",
+		}
+		if got := snapshot(lower); !reflect.DeepEqual(got, want) {
+			t.Errorf("lowercase key has %+v, want %+v", got, want)
+		}
+	})
+}
@@ -30,13 +30,220 @@ func (q *Queries) ArchiveConversation(ctx context.Context, arg *ArchiveConversat
 	return result.RowsAffected(), nil
 }
 
+const archiveDuplicateConversation = `-- name: ArchiveDuplicateConversation :execrows
+UPDATE agent_conversations c
+SET archived_at = NOW(), updated_at = NOW()
+WHERE c.id = $1 AND c.archived_at IS NULL
+  AND (SELECT COUNT(*) FROM agent_messages m
+       WHERE m.conversation_id = c.id AND m.deleted_at IS NULL) = $2::bigint
+`
+
+type ArchiveDuplicateConversationParams struct {
+	ID       pgtype.UUID `json:"id"`
+	Messages int64       `json:"messages"`
+}
+
+// Archives a duplicate only while it still has the number of messages it was judged by.
+func (q *Queries) ArchiveDuplicateConversation(ctx context.Context, arg *ArchiveDuplicateConversationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, archiveDuplicateConversation, arg.ID, arg.Messages)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const bulkArchiveConversations = `-- name: BulkArchiveConversations :many
+UPDATE agent_conversations
+SET archived_at = NOW(), updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM agent_conversations
+    WHERE public_key = $1 AND archived_at IS NULL
+      AND (id = ANY($2::uuid[]) OR updated_at < $3)
+    ORDER BY id
+    LIMIT $4
+)
+  AND public_key = $1 AND archived_at IS NULL
+RETURNING id
+`
+
+type BulkArchiveConversationsParams struct {
+	PublicKey  string             `json:"public_key"`
+	Ids        []pgtype.UUID      `json:"ids"`
+	OlderThan  pgtype.Timestamptz `json:"older_than"`
+	MaxResults int32              `json:"max_results"`
+}
+
+// Archives up to max_results of the user's live conversations, picked by ID or by last
+// activity before older_than, and returns the IDs archived.
+func (q *Queries) BulkArchiveConversations(ctx context.Context, arg *BulkArchiveConversationsParams) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, bulkArchiveConversations,
+		arg.PublicKey,
+		arg.Ids,
+		arg.OlderThan,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []pgtype.UUID{}
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const bulkDeleteArchivedConversations = `-- name: BulkDeleteArchivedConversations :many
+DELETE FROM agent_conversations
+WHERE id IN (
+    SELECT id FROM agent_conversations
+    WHERE public_key = $1 AND archived_at IS NOT NULL
+      AND (id = ANY($2::uuid[]) OR archived_at < $3)
+    ORDER BY id
+    LIMIT $4
+)
+  AND public_key = $1 AND archived_at IS NOT NULL
+RETURNING id
+`
+
+type BulkDeleteArchivedConversationsParams struct {
+	PublicKey  string             `json:"public_key"`
+	Ids        []pgtype.UUID      `json:"ids"`
+	OlderThan  pgtype.Timestamptz `json:"older_than"`
+	MaxResults int32              `json:"max_results"`
+}
+
+// Permanently deletes up to max_results of the user's archived conversations, picked by ID
+// or by archive time before older_than, and returns the IDs deleted.
+func (q *Queries) BulkDeleteArchivedConversations(ctx context.Context, arg *BulkDeleteArchivedConversationsParams) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, bulkDeleteArchivedConversations,
+		arg.PublicKey,
+		arg.Ids,
+		arg.OlderThan,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []pgtype.UUID{}
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const bulkRestoreConversations = `-- name: BulkRestoreConversations :many
+UPDATE agent_conversations
+SET archived_at = NULL, updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM agent_conversations
+    WHERE public_key = $1 AND archived_at IS NOT NULL
+      AND (id = ANY($2::uuid[]) OR archived_at < $3)
+    ORDER BY id
+    LIMIT $4
+)
+  AND public_key = $1 AND archived_at IS NOT NULL
+RETURNING id
+`
+
+type BulkRestoreConversationsParams struct {
+	PublicKey  string             `json:"public_key"`
+	Ids        []pgtype.UUID      `json:"ids"`
+	OlderThan  pgtype.Timestamptz `json:"older_than"`
+	MaxResults int32              `json:"max_results"`
+}
+
+// Restores up to max_results of the user's archived conversations, picked by ID or by
+// archive time before older_than, and returns the IDs restored.
+func (q *Queries) BulkRestoreConversations(ctx context.Context, arg *BulkRestoreConversationsParams) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, bulkRestoreConversations,
+		arg.PublicKey,
+		arg.Ids,
+		arg.OlderThan,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []pgtype.UUID{}
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const bumpConversationRevision = `-- name: BumpConversationRevision :exec
+UPDATE agent_conversations
+SET revision = revision + $1::bigint
+WHERE id = $2
+`
+
+type BumpConversationRevisionParams struct {
+	Messages int64       `json:"messages"`
+	ID       pgtype.UUID `json:"id"`
+}
+
+func (q *Queries) BumpConversationRevision(ctx context.Context, arg *BumpConversationRevisionParams) error {
+	_, err := q.db.Exec(ctx, bumpConversationRevision, arg.Messages, arg.ID)
+	return err
+}
+
+const clearConversationSummaryCovering = `-- name: ClearConversationSummaryCovering :exec
+
+UPDATE agent_conversations
+SET summary = NULL, summary_up_to = NULL
+WHERE id = $1 AND summary_up_to >= $2
+`
+
+type ClearConversationSummaryCoveringParams struct {
+	ID          pgtype.UUID        `json:"id"`
+	SummaryUpTo pgtype.Timestamptz `json:"summary_up_to"`
+}
+
+// Drops a summary that covers the given time, so it is rebuilt from the remaining messages.
+func (q *Queries) ClearConversationSummaryCovering(ctx context.Context, arg *ClearConversationSummaryCoveringParams) error {
+	_, err := q.db.Exec(ctx, clearConversationSummaryCovering, arg.ID, arg.SummaryUpTo)
+	return err
+}
+
 const countConversations = `-- name: CountConversations :one
 SELECT COUNT(*) FROM agent_conversations
 WHERE public_key = $1 AND archived_at IS NULL
+  AND tags @> $2::text[]
+  AND agent_lower_labels(labels) @> $3::text[]
 `
 
-func (q *Queries) CountConversations(ctx context.Context, publicKey string) (int64, error) {
-	row := q.db.QueryRow(ctx, countConversations, publicKey)
+type CountConversationsParams struct {
+	PublicKey string   `json:"public_key"`
+	Tags      []string `json:"tags"`
+	Labels    []string `json:"labels"`
+}
+
+func (q *Queries) CountConversations(ctx context.Context, arg *CountConversationsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countConversations, arg.PublicKey, arg.Tags, arg.Labels)
 	var count int64
 	err := row.Scan(&count)
 	return count, err
@@ -44,14 +251,94 @@ func (q *Queries) CountConversations(ctx context.Context, publicKey string) (int
 
 const createConversation = `-- name: CreateConversation :one
 
-INSERT INTO agent_conversations (public_key)
-VALUES ($1)
-RETURNING id, public_key, title, summary, summary_up_to, created_at, updated_at, archived_at
+INSERT INTO agent_conversations (public_key, no_memory)
+VALUES ($1, $2)
+RETURNING id, public_key, title, summary, summary_up_to, created_at, updated_at, archived_at, tags, imported, labels, no_memory, revision
 `
 
+type CreateConversationParams struct {
+	PublicKey string `json:"public_key"`
+	NoMemory  bool   `json:"no_memory"`
+}
+
 // Conversations table queries
-func (q *Queries) CreateConversation(ctx context.Context, publicKey string) (*AgentConversation, error) {
-	row := q.db.QueryRow(ctx, createConversation, publicKey)
+func (q *Queries) CreateConversation(ctx context.Context, arg *CreateConversationParams) (*AgentConversation, error) {
+	row := q.db.QueryRow(ctx, createConversation, arg.PublicKey, arg.NoMemory)
+	var i AgentConversation
+	err := row.Scan(
+		&i.ID,
+		&i.PublicKey,
+		&i.Title,
+		&i.Summary,
+		&i.SummaryUpTo,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ArchivedAt,
+		&i.Tags,
+		&i.Imported,
+		&i.Labels,
+		&i.NoMemory,
+		&i.Revision,
+	)
+	return &i, err
+}
+
+const createConversationWithSummary = `-- name: CreateConversationWithSummary :one
+INSERT INTO agent_conversations (public_key, title, summary, summary_up_to, tags, no_memory)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, public_key, title, summary, summary_up_to, created_at, updated_at, archived_at, tags, imported, labels, no_memory, revision
+`
+
+type CreateConversationWithSummaryParams struct {
+	PublicKey   string             `json:"public_key"`
+	Title       pgtype.Text        `json:"title"`
+	Summary     pgtype.Text        `json:"summary"`
+	SummaryUpTo pgtype.Timestamptz `json:"summary_up_to"`
+	Tags        []string           `json:"tags"`
+	NoMemory    bool               `json:"no_memory"`
+}
+
+func (q *Queries) CreateConversationWithSummary(ctx context.Context, arg *CreateConversationWithSummaryParams) (*AgentConversation, error) {
+	row := q.db.QueryRow(ctx, createConversationWithSummary,
+		arg.PublicKey,
+		arg.Title,
+		arg.Summary,
+		arg.SummaryUpTo,
+		arg.Tags,
+		arg.NoMemory,
+	)
+	var i AgentConversation
+	err := row.Scan(
+		&i.ID,
+		&i.PublicKey,
+		&i.Title,
+		&i.Summary,
+		&i.SummaryUpTo,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ArchivedAt,
+		&i.Tags,
+		&i.Imported,
+		&i.Labels,
+		&i.NoMemory,
+		&i.Revision,
+	)
+	return &i, err
+}
+
+const createImportedConversation = `-- name: CreateImportedConversation :one
+INSERT INTO agent_conversations (public_key, title, imported)
+VALUES ($1, $2, true)
+RETURNING id, public_key, title, summary, summary_up_to, created_at, updated_at, archived_at, tags, imported, labels, no_memory, revision
+`
+
+type CreateImportedConversationParams struct {
+	PublicKey string      `json:"public_key"`
+	Title     pgtype.Text `json:"title"`
+}
+
+func (q *Queries) CreateImportedConversation(ctx context.Context, arg *CreateImportedConversationParams) (*AgentConversation, error) {
+	row := q.db.QueryRow(ctx, createImportedConversation, arg.PublicKey, arg.Title)
 	var i AgentConversation
 	err := row.Scan(
 		&i.ID,
@@ -62,12 +349,35 @@ func (q *Queries) CreateConversation(ctx context.Context, publicKey string) (*Ag
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ArchivedAt,
+		&i.Tags,
+		&i.Imported,
+		&i.Labels,
+		&i.NoMemory,
+		&i.Revision,
 	)
 	return &i, err
 }
 
+const deleteConversation = `-- name: DeleteConversation :execrows
+DELETE FROM agent_conversations
+WHERE id = $1 AND public_key = $2
+`
+
+type DeleteConversationParams struct {
+	ID        pgtype.UUID `json:"id"`
+	PublicKey string      `json:"public_key"`
+}
+
+func (q *Queries) DeleteConversation(ctx context.Context, arg *DeleteConversationParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteConversation, arg.ID, arg.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getConversationByID = `-- name: GetConversationByID :one
-SELECT id, public_key, title, summary, summary_up_to, created_at, updated_at, archived_at FROM agent_conversations
+SELECT id, public_key, title, summary, summary_up_to, created_at, updated_at, archived_at, tags, imported, labels, no_memory, revision FROM agent_conversations
 WHERE id = $1 AND public_key = $2 AND archived_at IS NULL
 `
 
@@ -88,10 +398,79 @@ func (q *Queries) GetConversationByID(ctx context.Context, arg *GetConversationB
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.ArchivedAt,
+		&i.Tags,
+		&i.Imported,
+		&i.Labels,
+		&i.NoMemory,
+		&i.Revision,
+	)
+	return &i, err
+}
+
+const getConversationForAdmin = `-- name: GetConversationForAdmin :one
+SELECT id, public_key, title, summary, summary_up_to, created_at, updated_at, archived_at, tags, imported, labels, no_memory, revision FROM agent_conversations
+WHERE id = $1
+`
+
+// Admin tooling only: not scoped to a public key, and includes archived conversations.
+func (q *Queries) GetConversationForAdmin(ctx context.Context, id pgtype.UUID) (*AgentConversation, error) {
+	row := q.db.QueryRow(ctx, getConversationForAdmin, id)
+	var i AgentConversation
+	err := row.Scan(
+		&i.ID,
+		&i.PublicKey,
+		&i.Title,
+		&i.Summary,
+		&i.SummaryUpTo,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.ArchivedAt,
+		&i.Tags,
+		&i.Imported,
+		&i.Labels,
+		&i.NoMemory,
+		&i.Revision,
 	)
 	return &i, err
 }
 
+const getConversationLabelsForUpdate = `-- name: GetConversationLabelsForUpdate :one
+
+SELECT labels FROM agent_conversations
+WHERE id = $1 AND public_key = $2 AND archived_at IS NULL
+FOR UPDATE
+`
+
+type GetConversationLabelsForUpdateParams struct {
+	ID        pgtype.UUID `json:"id"`
+	PublicKey string      `json:"public_key"`
+}
+
+// Locks the row so concurrent label edits apply one after the other.
+func (q *Queries) GetConversationLabelsForUpdate(ctx context.Context, arg *GetConversationLabelsForUpdateParams) ([]string, error) {
+	row := q.db.QueryRow(ctx, getConversationLabelsForUpdate, arg.ID, arg.PublicKey)
+	var labels []string
+	err := row.Scan(&labels)
+	return labels, err
+}
+
+const getConversationNoMemory = `-- name: GetConversationNoMemory :one
+SELECT no_memory FROM agent_conversations
+WHERE id = $1 AND public_key = $2 AND archived_at IS NULL
+`
+
+type GetConversationNoMemoryParams struct {
+	ID        pgtype.UUID `json:"id"`
+	PublicKey string      `json:"public_key"`
+}
+
+func (q *Queries) GetConversationNoMemory(ctx context.Context, arg *GetConversationNoMemoryParams) (bool, error) {
+	row := q.db.QueryRow(ctx, getConversationNoMemory, arg.ID, arg.PublicKey)
+	var no_memory bool
+	err := row.Scan(&no_memory)
+	return no_memory, err
+}
+
 const getConversationSummaryWithCursor = `-- name: GetConversationSummaryWithCursor :one
 SELECT summary, summary_up_to FROM agent_conversations
 WHERE id = $1 AND public_key = $2
@@ -114,21 +493,216 @@ func (q *Queries) GetConversationSummaryWithCursor(ctx context.Context, arg *Get
 	return &i, err
 }
 
+const getUserDailyConfidence = `-- name: GetUserDailyConfidence :many
+SELECT date_trunc('day', m.created_at)::timestamptz AS day,
+    COUNT(*)::bigint AS replies,
+    AVG((m.metadata->>'confidence')::float8)::float8 AS average
+FROM agent_messages m
+JOIN agent_conversations c ON c.id = m.conversation_id
+WHERE c.public_key = $1 AND m.role = 'assistant' AND m.deleted_at IS NULL
+  AND m.created_at >= $2
+  AND jsonb_typeof(m.metadata->'confidence') = 'number'
+GROUP BY day
+ORDER BY day
+`
+
+type GetUserDailyConfidenceParams struct {
+	PublicKey string             `json:"public_key"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type GetUserDailyConfidenceRow struct {
+	Day     pgtype.Timestamptz `json:"day"`
+	Replies int64              `json:"replies"`
+	Average float64            `json:"average"`
+}
+
+// Average intent confidence the model reported on the user's replies per day, from the
+// confidence stored in assistant message metadata.
+func (q *Queries) GetUserDailyConfidence(ctx context.Context, arg *GetUserDailyConfidenceParams) ([]*GetUserDailyConfidenceRow, error) {
+	rows, err := q.db.Query(ctx, getUserDailyConfidence, arg.PublicKey, arg.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*GetUserDailyConfidenceRow{}
+	for rows.Next() {
+		var i GetUserDailyConfidenceRow
+		if err := rows.Scan(&i.Day, &i.Replies, &i.Average); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUserStats = `-- name: GetUserStats :one
+SELECT
+    (SELECT COUNT(*) FROM agent_conversations c
+     WHERE c.public_key = $1 AND c.archived_at IS NULL)::bigint AS conversations,
+    (SELECT COUNT(*) FROM agent_messages m
+     JOIN agent_conversations c ON c.id = m.conversation_id
+     WHERE c.public_key = $1 AND c.archived_at IS NULL
+       AND m.deleted_at IS NULL)::bigint AS messages,
+    (SELECT COUNT(*) FROM agent_messages m
+     JOIN agent_conversations c ON c.id = m.conversation_id
+     WHERE c.public_key = $1
+       AND m.content_type = 'action_result'
+       AND m.metadata @> jsonb_build_object('action', $2::text, 'success', true))::bigint AS automations,
+    (SELECT MIN(c.created_at) FROM agent_conversations c
+     WHERE c.public_key = $1)::timestamptz AS member_since
+`
+
+type GetUserStatsParams struct {
+	PublicKey        string `json:"public_key"`
+	AutomationAction string `json:"automation_action"`
+}
+
+type GetUserStatsRow struct {
+	Conversations int64              `json:"conversations"`
+	Messages      int64              `json:"messages"`
+	Automations   int64              `json:"automations"`
+	MemberSince   pgtype.Timestamptz `json:"member_since"`
+}
+
+func (q *Queries) GetUserStats(ctx context.Context, arg *GetUserStatsParams) (*GetUserStatsRow, error) {
+	row := q.db.QueryRow(ctx, getUserStats, arg.PublicKey, arg.AutomationAction)
+	var i GetUserStatsRow
+	err := row.Scan(
+		&i.Conversations,
+		&i.Messages,
+		&i.Automations,
+		&i.MemberSince,
+	)
+	return &i, err
+}
+
+const getUserTopicCounts = `-- name: GetUserTopicCounts :many
+SELECT tag::text AS tag, COUNT(*)::bigint AS conversations
+FROM agent_conversations c, unnest(c.tags) AS tag
+WHERE c.public_key = $1 AND c.archived_at IS NULL
+GROUP BY tag
+ORDER BY tag
+`
+
+type GetUserTopicCountsRow struct {
+	Tag           string `json:"tag"`
+	Conversations int64  `json:"conversations"`
+}
+
+func (q *Queries) GetUserTopicCounts(ctx context.Context, publicKey string) ([]*GetUserTopicCountsRow, error) {
+	rows, err := q.db.Query(ctx, getUserTopicCounts, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*GetUserTopicCountsRow{}
+	for rows.Next() {
+		var i GetUserTopicCountsRow
+		if err := rows.Scan(&i.Tag, &i.Conversations); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationIDsAfter = `-- name: ListConversationIDsAfter :many
+SELECT id FROM agent_conversations
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListConversationIDsAfterParams struct {
+	ID    pgtype.UUID `json:"id"`
+	Limit int32       `json:"limit"`
+}
+
+func (q *Queries) ListConversationIDsAfter(ctx context.Context, arg *ListConversationIDsAfterParams) ([]pgtype.UUID, error) {
+	rows, err := q.db.Query(ctx, listConversationIDsAfter, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []pgtype.UUID{}
+	for rows.Next() {
+		var id pgtype.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationPublicKeysAfter = `-- name: ListConversationPublicKeysAfter :many
+SELECT DISTINCT public_key FROM agent_conversations
+WHERE public_key > $1 AND archived_at IS NULL AND NOT imported
+ORDER BY public_key
+LIMIT $2
+`
+
+type ListConversationPublicKeysAfterParams struct {
+	PublicKey string `json:"public_key"`
+	Limit     int32  `json:"limit"`
+}
+
+// Users with live conversations, in public key order, for walking them in batches.
+func (q *Queries) ListConversationPublicKeysAfter(ctx context.Context, arg *ListConversationPublicKeysAfterParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, listConversationPublicKeysAfter, arg.PublicKey, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var public_key string
+		if err := rows.Scan(&public_key); err != nil {
+			return nil, err
+		}
+		items = append(items, public_key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listConversations = `-- name: ListConversations :many
-SELECT id, public_key, title, summary, summary_up_to, created_at, updated_at, archived_at FROM agent_conversations
+SELECT id, public_key, title, summary, summary_up_to, created_at, updated_at, archived_at, tags, imported, labels, no_memory, revision FROM agent_conversations
 WHERE public_key = $1 AND archived_at IS NULL
+  AND tags @> $2::text[]
+  AND agent_lower_labels(labels) @> $3::text[]
 ORDER BY updated_at DESC
-LIMIT $2 OFFSET $3
+LIMIT $4 OFFSET $5
 `
 
 type ListConversationsParams struct {
-	PublicKey string `json:"public_key"`
-	Limit     int32  `json:"limit"`
-	Offset    int32  `json:"offset"`
+	PublicKey string   `json:"public_key"`
+	Tags      []string `json:"tags"`
+	Labels    []string `json:"labels"`
+	Take      int32    `json:"take"`
+	Skip      int32    `json:"skip"`
 }
 
 func (q *Queries) ListConversations(ctx context.Context, arg *ListConversationsParams) ([]*AgentConversation, error) {
-	rows, err := q.db.Query(ctx, listConversations, arg.PublicKey, arg.Limit, arg.Offset)
+	rows, err := q.db.Query(ctx, listConversations,
+		arg.PublicKey,
+		arg.Tags,
+		arg.Labels,
+		arg.Take,
+		arg.Skip,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -145,6 +719,129 @@ func (q *Queries) ListConversations(ctx context.Context, arg *ListConversationsP
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.ArchivedAt,
+			&i.Tags,
+			&i.Imported,
+			&i.Labels,
+			&i.NoMemory,
+			&i.Revision,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listConversationsNeedingSummary = `-- name: ListConversationsNeedingSummary :many
+SELECT c.id, c.public_key, a.active_messages
+FROM agent_conversations c
+CROSS JOIN LATERAL (
+    SELECT COUNT(*)::bigint AS active_messages FROM agent_messages m
+    WHERE m.conversation_id = c.id AND m.deleted_at IS NULL
+      AND (c.summary_up_to IS NULL OR m.created_at > c.summary_up_to)
+) a
+WHERE c.id > $1 AND c.archived_at IS NULL
+  AND c.revision > $2
+  AND a.active_messages > $2
+ORDER BY c.id
+LIMIT $3
+`
+
+type ListConversationsNeedingSummaryParams struct {
+	AfterID    pgtype.UUID `json:"after_id"`
+	Trigger    int64       `json:"trigger"`
+	MaxResults int32       `json:"max_results"`
+}
+
+type ListConversationsNeedingSummaryRow struct {
+	ID             pgtype.UUID `json:"id"`
+	PublicKey      string      `json:"public_key"`
+	ActiveMessages int64       `json:"active_messages"`
+}
+
+// Returns live conversations after after_id, in ID order, whose active messages (those past
+// the summary cursor, or all before the first summary) exceed the trigger. revision counts
+// every message ever stored, so it rules most conversations out before their messages are counted.
+func (q *Queries) ListConversationsNeedingSummary(ctx context.Context, arg *ListConversationsNeedingSummaryParams) ([]*ListConversationsNeedingSummaryRow, error) {
+	rows, err := q.db.Query(ctx, listConversationsNeedingSummary, arg.AfterID, arg.Trigger, arg.MaxResults)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*ListConversationsNeedingSummaryRow{}
+	for rows.Next() {
+		var i ListConversationsNeedingSummaryRow
+		if err := rows.Scan(&i.ID, &i.PublicKey, &i.ActiveMessages); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDuplicateCandidates = `-- name: ListDuplicateCandidates :many
+SELECT c.id, c.public_key, c.created_at, c.labels,
+    (SELECT COUNT(*) FROM agent_messages m
+     WHERE m.conversation_id = c.id AND m.deleted_at IS NULL)::bigint AS messages,
+    (SELECT COUNT(*) FROM agent_messages m
+     WHERE m.conversation_id = c.id AND m.deleted_at IS NULL AND m.role = 'user')::bigint AS user_messages,
+    COALESCE((SELECT m.content FROM agent_messages m
+     WHERE m.conversation_id = c.id AND m.deleted_at IS NULL AND m.role = 'user'
+     ORDER BY m.created_at LIMIT 1), '')::text AS first_message
+FROM agent_conversations c
+WHERE c.public_key = ANY($1::text[])
+  AND c.archived_at IS NULL AND NOT c.imported
+  AND EXISTS (
+    SELECT 1 FROM agent_conversations o
+    WHERE o.public_key = c.public_key AND o.id <> c.id
+      AND o.archived_at IS NULL AND NOT o.imported
+      AND o.created_at BETWEEN c.created_at - make_interval(secs => $2::float8)
+                           AND c.created_at + make_interval(secs => $2::float8)
+  )
+ORDER BY c.public_key, c.created_at
+`
+
+type ListDuplicateCandidatesParams struct {
+	PublicKeys    []string `json:"public_keys"`
+	WindowSeconds float64  `json:"window_seconds"`
+}
+
+type ListDuplicateCandidatesRow struct {
+	ID           pgtype.UUID        `json:"id"`
+	PublicKey    string             `json:"public_key"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	Labels       []string           `json:"labels"`
+	Messages     int64              `json:"messages"`
+	UserMessages int64              `json:"user_messages"`
+	FirstMessage string             `json:"first_message"`
+}
+
+// Live conversations of the given users created within window_seconds of another of the same
+// user, with their message counts and first user message, for spotting duplicates from double
+// taps and retries.
+func (q *Queries) ListDuplicateCandidates(ctx context.Context, arg *ListDuplicateCandidatesParams) ([]*ListDuplicateCandidatesRow, error) {
+	rows, err := q.db.Query(ctx, listDuplicateCandidates, arg.PublicKeys, arg.WindowSeconds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*ListDuplicateCandidatesRow{}
+	for rows.Next() {
+		var i ListDuplicateCandidatesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.PublicKey,
+			&i.CreatedAt,
+			&i.Labels,
+			&i.Messages,
+			&i.UserMessages,
+			&i.FirstMessage,
 		); err != nil {
 			return nil, err
 		}
@@ -156,6 +853,44 @@ func (q *Queries) ListConversations(ctx context.Context, arg *ListConversationsP
 	return items, nil
 }
 
+const setConversationTags = `-- name: SetConversationTags :exec
+UPDATE agent_conversations
+SET tags = $1
+WHERE id = $2
+`
+
+type SetConversationTagsParams struct {
+	Tags []string    `json:"tags"`
+	ID   pgtype.UUID `json:"id"`
+}
+
+func (q *Queries) SetConversationTags(ctx context.Context, arg *SetConversationTagsParams) error {
+	_, err := q.db.Exec(ctx, setConversationTags, arg.Tags, arg.ID)
+	return err
+}
+
+const updateConversationLabels = `-- name: UpdateConversationLabels :execrows
+
+UPDATE agent_conversations
+SET labels = $1
+WHERE id = $2 AND public_key = $3 AND archived_at IS NULL
+`
+
+type UpdateConversationLabelsParams struct {
+	Labels    []string    `json:"labels"`
+	ID        pgtype.UUID `json:"id"`
+	PublicKey string      `json:"public_key"`
+}
+
+// Like tags, labels don't bump updated_at.
+func (q *Queries) UpdateConversationLabels(ctx context.Context, arg *UpdateConversationLabelsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateConversationLabels, arg.Labels, arg.ID, arg.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateConversationSummaryWithCursor = `-- name: UpdateConversationSummaryWithCursor :execrows
 UPDATE agent_conversations
 SET summary = $1, summary_up_to = $2, updated_at = NOW()
@@ -182,6 +917,28 @@ func (q *Queries) UpdateConversationSummaryWithCursor(ctx context.Context, arg *
 	return result.RowsAffected(), nil
 }
 
+const updateConversationTags = `-- name: UpdateConversationTags :execrows
+
+UPDATE agent_conversations
+SET tags = $1
+WHERE id = $2 AND public_key = $3 AND archived_at IS NULL
+`
+
+type UpdateConversationTagsParams struct {
+	Tags      []string    `json:"tags"`
+	ID        pgtype.UUID `json:"id"`
+	PublicKey string      `json:"public_key"`
+}
+
+// Tags don't bump updated_at, so tagging doesn't reorder the conversation list.
+func (q *Queries) UpdateConversationTags(ctx context.Context, arg *UpdateConversationTagsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateConversationTags, arg.Tags, arg.ID, arg.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const updateConversationTitle = `-- name: UpdateConversationTitle :execrows
 UPDATE agent_conversations
 SET title = $1, updated_at = NOW()
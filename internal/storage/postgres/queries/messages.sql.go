@@ -11,11 +11,47 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const countMessagesByConversationID = `-- name: CountMessagesByConversationID :one
+const copyMessages = `-- name: CopyMessages :execrows
+INSERT INTO agent_messages (conversation_id, role, content, content_type, audio_url, metadata, created_at)
+SELECT $1::uuid, role, content, content_type, audio_url, metadata, created_at
+FROM agent_messages
+WHERE conversation_id = $2
+  AND ($3::timestamptz IS NULL OR created_at <= $3)
+  AND deleted_at IS NULL
+ORDER BY created_at
+`
+
+type CopyMessagesParams struct {
+	TargetID pgtype.UUID        `json:"target_id"`
+	SourceID pgtype.UUID        `json:"source_id"`
+	Cutoff   pgtype.Timestamptz `json:"cutoff"`
+}
+
+func (q *Queries) CopyMessages(ctx context.Context, arg *CopyMessagesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, copyMessages, arg.TargetID, arg.SourceID, arg.Cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const countMessageHistoryByConversationID = `-- name: CountMessageHistoryByConversationID :one
 SELECT COUNT(*) FROM agent_messages
 WHERE conversation_id = $1
 `
 
+func (q *Queries) CountMessageHistoryByConversationID(ctx context.Context, conversationID pgtype.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countMessageHistoryByConversationID, conversationID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countMessagesByConversationID = `-- name: CountMessagesByConversationID :one
+SELECT COUNT(*) FROM agent_messages
+WHERE conversation_id = $1 AND deleted_at IS NULL
+`
+
 func (q *Queries) CountMessagesByConversationID(ctx context.Context, conversationID pgtype.UUID) (int64, error) {
 	row := q.db.QueryRow(ctx, countMessagesByConversationID, conversationID)
 	var count int64
@@ -25,7 +61,7 @@ func (q *Queries) CountMessagesByConversationID(ctx context.Context, conversatio
 
 const countMessagesSince = `-- name: CountMessagesSince :one
 SELECT COUNT(*) FROM agent_messages
-WHERE conversation_id = $1 AND created_at > $2
+WHERE conversation_id = $1 AND created_at > $2 AND deleted_at IS NULL
 `
 
 type CountMessagesSinceParams struct {
@@ -40,11 +76,42 @@ func (q *Queries) CountMessagesSince(ctx context.Context, arg *CountMessagesSinc
 	return count, err
 }
 
+const createImportedMessage = `-- name: CreateImportedMessage :exec
+INSERT INTO agent_messages (conversation_id, role, content, content_type, metadata, created_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+`
+
+type CreateImportedMessageParams struct {
+	ConversationID pgtype.UUID        `json:"conversation_id"`
+	Role           AgentMessageRole   `json:"role"`
+	Content        string             `json:"content"`
+	ContentType    string             `json:"content_type"`
+	Metadata       []byte             `json:"metadata"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+func (q *Queries) CreateImportedMessage(ctx context.Context, arg *CreateImportedMessageParams) error {
+	_, err := q.db.Exec(ctx, createImportedMessage,
+		arg.ConversationID,
+		arg.Role,
+		arg.Content,
+		arg.ContentType,
+		arg.Metadata,
+		arg.CreatedAt,
+	)
+	return err
+}
+
 const createMessage = `-- name: CreateMessage :one
 
+WITH bumped AS (
+    UPDATE agent_conversations SET revision = revision + 1
+    WHERE id = $1
+    RETURNING revision
+)
 INSERT INTO agent_messages (conversation_id, role, content, content_type, audio_url, metadata)
 VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id, conversation_id, role, content, content_type, audio_url, metadata, created_at
+RETURNING id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at, (SELECT revision FROM bumped)::bigint AS revision
 `
 
 type CreateMessageParams struct {
@@ -56,8 +123,21 @@ type CreateMessageParams struct {
 	Metadata       []byte           `json:"metadata"`
 }
 
+type CreateMessageRow struct {
+	ID             pgtype.UUID        `json:"id"`
+	ConversationID pgtype.UUID        `json:"conversation_id"`
+	Role           AgentMessageRole   `json:"role"`
+	Content        string             `json:"content"`
+	ContentType    string             `json:"content_type"`
+	AudioUrl       pgtype.Text        `json:"audio_url"`
+	Metadata       []byte             `json:"metadata"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+	Revision       int64              `json:"revision"`
+}
+
 // Messages table queries
-func (q *Queries) CreateMessage(ctx context.Context, arg *CreateMessageParams) (*AgentMessage, error) {
+func (q *Queries) CreateMessage(ctx context.Context, arg *CreateMessageParams) (*CreateMessageRow, error) {
 	row := q.db.QueryRow(ctx, createMessage,
 		arg.ConversationID,
 		arg.Role,
@@ -66,6 +146,95 @@ func (q *Queries) CreateMessage(ctx context.Context, arg *CreateMessageParams) (
 		arg.AudioUrl,
 		arg.Metadata,
 	)
+	var i CreateMessageRow
+	err := row.Scan(
+		&i.ID,
+		&i.ConversationID,
+		&i.Role,
+		&i.Content,
+		&i.ContentType,
+		&i.AudioUrl,
+		&i.Metadata,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Revision,
+	)
+	return &i, err
+}
+
+const createMessageIfOwned = `-- name: CreateMessageIfOwned :one
+WITH owned AS (
+    UPDATE agent_conversations SET revision = revision + 1
+    WHERE id = $1 AND public_key = $2 AND archived_at IS NULL
+    RETURNING id, revision
+)
+INSERT INTO agent_messages (conversation_id, role, content, content_type, audio_url, metadata)
+SELECT owned.id, $3, $4, $5, $6, $7
+FROM owned
+RETURNING id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at, (SELECT revision FROM owned)::bigint AS revision
+`
+
+type CreateMessageIfOwnedParams struct {
+	ConversationID pgtype.UUID      `json:"conversation_id"`
+	PublicKey      string           `json:"public_key"`
+	Role           AgentMessageRole `json:"role"`
+	Content        string           `json:"content"`
+	ContentType    string           `json:"content_type"`
+	AudioUrl       pgtype.Text      `json:"audio_url"`
+	Metadata       []byte           `json:"metadata"`
+}
+
+type CreateMessageIfOwnedRow struct {
+	ID             pgtype.UUID        `json:"id"`
+	ConversationID pgtype.UUID        `json:"conversation_id"`
+	Role           AgentMessageRole   `json:"role"`
+	Content        string             `json:"content"`
+	ContentType    string             `json:"content_type"`
+	AudioUrl       pgtype.Text        `json:"audio_url"`
+	Metadata       []byte             `json:"metadata"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+	Revision       int64              `json:"revision"`
+}
+
+func (q *Queries) CreateMessageIfOwned(ctx context.Context, arg *CreateMessageIfOwnedParams) (*CreateMessageIfOwnedRow, error) {
+	row := q.db.QueryRow(ctx, createMessageIfOwned,
+		arg.ConversationID,
+		arg.PublicKey,
+		arg.Role,
+		arg.Content,
+		arg.ContentType,
+		arg.AudioUrl,
+		arg.Metadata,
+	)
+	var i CreateMessageIfOwnedRow
+	err := row.Scan(
+		&i.ID,
+		&i.ConversationID,
+		&i.Role,
+		&i.Content,
+		&i.ContentType,
+		&i.AudioUrl,
+		&i.Metadata,
+		&i.CreatedAt,
+		&i.DeletedAt,
+		&i.Revision,
+	)
+	return &i, err
+}
+
+const getMessageByID = `-- name: GetMessageByID :one
+SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at FROM agent_messages
+WHERE id = $1 AND conversation_id = $2 AND deleted_at IS NULL
+`
+
+type GetMessageByIDParams struct {
+	ID             pgtype.UUID `json:"id"`
+	ConversationID pgtype.UUID `json:"conversation_id"`
+}
+
+func (q *Queries) GetMessageByID(ctx context.Context, arg *GetMessageByIDParams) (*AgentMessage, error) {
+	row := q.db.QueryRow(ctx, getMessageByID, arg.ID, arg.ConversationID)
 	var i AgentMessage
 	err := row.Scan(
 		&i.ID,
@@ -76,16 +245,72 @@ func (q *Queries) CreateMessage(ctx context.Context, arg *CreateMessageParams) (
 		&i.AudioUrl,
 		&i.Metadata,
 		&i.CreatedAt,
+		&i.DeletedAt,
 	)
 	return &i, err
 }
 
-const getMessagesByConversationID = `-- name: GetMessagesByConversationID :many
-SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at FROM agent_messages
+const getMessageCreatedAt = `-- name: GetMessageCreatedAt :one
+SELECT created_at FROM agent_messages
+WHERE id = $1 AND conversation_id = $2
+`
+
+type GetMessageCreatedAtParams struct {
+	ID             pgtype.UUID `json:"id"`
+	ConversationID pgtype.UUID `json:"conversation_id"`
+}
+
+func (q *Queries) GetMessageCreatedAt(ctx context.Context, arg *GetMessageCreatedAtParams) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, getMessageCreatedAt, arg.ID, arg.ConversationID)
+	var created_at pgtype.Timestamptz
+	err := row.Scan(&created_at)
+	return created_at, err
+}
+
+const getMessageHistoryByConversationID = `-- name: GetMessageHistoryByConversationID :many
+
+SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at FROM agent_messages
 WHERE conversation_id = $1
 ORDER BY created_at ASC
 `
 
+// Unlike GetMessagesByConversationID this includes deleted messages, as tombstones.
+func (q *Queries) GetMessageHistoryByConversationID(ctx context.Context, conversationID pgtype.UUID) ([]*AgentMessage, error) {
+	rows, err := q.db.Query(ctx, getMessageHistoryByConversationID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*AgentMessage{}
+	for rows.Next() {
+		var i AgentMessage
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.Role,
+			&i.Content,
+			&i.ContentType,
+			&i.AudioUrl,
+			&i.Metadata,
+			&i.CreatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getMessagesByConversationID = `-- name: GetMessagesByConversationID :many
+SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at FROM agent_messages
+WHERE conversation_id = $1 AND deleted_at IS NULL
+ORDER BY created_at ASC
+`
+
 func (q *Queries) GetMessagesByConversationID(ctx context.Context, conversationID pgtype.UUID) ([]*AgentMessage, error) {
 	rows, err := q.db.Query(ctx, getMessagesByConversationID, conversationID)
 	if err != nil {
@@ -104,6 +329,7 @@ func (q *Queries) GetMessagesByConversationID(ctx context.Context, conversationI
 			&i.AudioUrl,
 			&i.Metadata,
 			&i.CreatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -116,8 +342,8 @@ func (q *Queries) GetMessagesByConversationID(ctx context.Context, conversationI
 }
 
 const getMessagesSince = `-- name: GetMessagesSince :many
-SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at FROM agent_messages
-WHERE conversation_id = $1 AND created_at > $2
+SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at FROM agent_messages
+WHERE conversation_id = $1 AND created_at > $2 AND deleted_at IS NULL
 ORDER BY created_at ASC
 `
 
@@ -144,6 +370,7 @@ func (q *Queries) GetMessagesSince(ctx context.Context, arg *GetMessagesSincePar
 			&i.AudioUrl,
 			&i.Metadata,
 			&i.CreatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -156,8 +383,8 @@ func (q *Queries) GetMessagesSince(ctx context.Context, arg *GetMessagesSincePar
 }
 
 const getRecentMessages = `-- name: GetRecentMessages :many
-SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at FROM agent_messages
-WHERE conversation_id = $1
+SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at FROM agent_messages
+WHERE conversation_id = $1 AND deleted_at IS NULL
 ORDER BY created_at DESC
 LIMIT $2
 `
@@ -185,6 +412,7 @@ func (q *Queries) GetRecentMessages(ctx context.Context, arg *GetRecentMessagesP
 			&i.AudioUrl,
 			&i.Metadata,
 			&i.CreatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -197,8 +425,8 @@ func (q *Queries) GetRecentMessages(ctx context.Context, arg *GetRecentMessagesP
 }
 
 const getRecentMessagesSince = `-- name: GetRecentMessagesSince :many
-SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at FROM agent_messages
-WHERE conversation_id = $1 AND created_at > $2
+SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at FROM agent_messages
+WHERE conversation_id = $1 AND created_at > $2 AND deleted_at IS NULL
 ORDER BY created_at DESC
 LIMIT $3
 `
@@ -227,6 +455,109 @@ func (q *Queries) GetRecentMessagesSince(ctx context.Context, arg *GetRecentMess
 			&i.AudioUrl,
 			&i.Metadata,
 			&i.CreatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listMessages = `-- name: ListMessages :many
+SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at FROM agent_messages
+WHERE conversation_id = $1
+ORDER BY created_at ASC
+LIMIT $2 OFFSET $3
+`
+
+type ListMessagesParams struct {
+	ConversationID pgtype.UUID `json:"conversation_id"`
+	Limit          int32       `json:"limit"`
+	Offset         int32       `json:"offset"`
+}
+
+func (q *Queries) ListMessages(ctx context.Context, arg *ListMessagesParams) ([]*AgentMessage, error) {
+	rows, err := q.db.Query(ctx, listMessages, arg.ConversationID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*AgentMessage{}
+	for rows.Next() {
+		var i AgentMessage
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.Role,
+			&i.Content,
+			&i.ContentType,
+			&i.AudioUrl,
+			&i.Metadata,
+			&i.CreatedAt,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, &i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReplayCandidates = `-- name: ListReplayCandidates :many
+SELECT id, conversation_id, role, content, content_type, audio_url, metadata, created_at, deleted_at FROM agent_messages
+WHERE role = 'assistant' AND deleted_at IS NULL
+  AND created_at >= $1 AND created_at < $2
+  AND metadata->'generation'->>'ability' IN ('intent', 'policy')
+  AND ($3::text IS NULL OR metadata->>'intent' = $3)
+  AND ($4::text IS NULL
+    OR metadata->>'plugin_id' = $4
+    OR metadata->'suggestions' @> jsonb_build_array(jsonb_build_object('plugin_id', $4::text)))
+ORDER BY id
+LIMIT $5
+`
+
+type ListReplayCandidatesParams struct {
+	CreatedFrom pgtype.Timestamptz `json:"created_from"`
+	CreatedTo   pgtype.Timestamptz `json:"created_to"`
+	Intent      pgtype.Text        `json:"intent"`
+	PluginID    pgtype.Text        `json:"plugin_id"`
+	MaxResults  int32              `json:"max_results"`
+}
+
+// Assistant replies of the intent and policy abilities created in [from, to), optionally
+// narrowed to an intent and a plugin. Ids are random, so ordering by them samples the range.
+func (q *Queries) ListReplayCandidates(ctx context.Context, arg *ListReplayCandidatesParams) ([]*AgentMessage, error) {
+	rows, err := q.db.Query(ctx, listReplayCandidates,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.Intent,
+		arg.PluginID,
+		arg.MaxResults,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*AgentMessage{}
+	for rows.Next() {
+		var i AgentMessage
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConversationID,
+			&i.Role,
+			&i.Content,
+			&i.ContentType,
+			&i.AudioUrl,
+			&i.Metadata,
+			&i.CreatedAt,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -237,3 +568,29 @@ func (q *Queries) GetRecentMessagesSince(ctx context.Context, arg *GetRecentMess
 	}
 	return items, nil
 }
+
+const softDeleteMessage = `-- name: SoftDeleteMessage :one
+
+UPDATE agent_messages m
+SET deleted_at = COALESCE(m.deleted_at, NOW()),
+    content = '', content_type = 'deleted', audio_url = NULL, metadata = NULL
+FROM agent_conversations c
+WHERE m.id = $1 AND m.conversation_id = $2
+  AND m.role IN ('user', 'assistant')
+  AND c.id = m.conversation_id AND c.public_key = $3 AND c.archived_at IS NULL
+RETURNING m.created_at
+`
+
+type SoftDeleteMessageParams struct {
+	ID             pgtype.UUID `json:"id"`
+	ConversationID pgtype.UUID `json:"conversation_id"`
+	PublicKey      string      `json:"public_key"`
+}
+
+// Content is wiped along with the delete, leaving a tombstone that keeps the message's place.
+func (q *Queries) SoftDeleteMessage(ctx context.Context, arg *SoftDeleteMessageParams) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, softDeleteMessage, arg.ID, arg.ConversationID, arg.PublicKey)
+	var created_at pgtype.Timestamptz
+	err := row.Scan(&created_at)
+	return created_at, err
+}
@@ -54,6 +54,23 @@ func (ns NullAgentMessageRole) Value() (driver.Value, error) {
 	return string(ns.AgentMessageRole), nil
 }
 
+type AgentAttachment struct {
+	ID          pgtype.UUID        `json:"id"`
+	PublicKey   string             `json:"public_key"`
+	ContentType string             `json:"content_type"`
+	SizeBytes   int32              `json:"size_bytes"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+type AgentContact struct {
+	ID        pgtype.UUID        `json:"id"`
+	PublicKey string             `json:"public_key"`
+	Name      string             `json:"name"`
+	Chain     string             `json:"chain"`
+	Address   string             `json:"address"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
 type AgentConversation struct {
 	ID          pgtype.UUID        `json:"id"`
 	PublicKey   string             `json:"public_key"`
@@ -63,6 +80,21 @@ type AgentConversation struct {
 	CreatedAt   pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
 	ArchivedAt  pgtype.Timestamptz `json:"archived_at"`
+	Tags        []string           `json:"tags"`
+	Imported    bool               `json:"imported"`
+	Labels      []string           `json:"labels"`
+	NoMemory    bool               `json:"no_memory"`
+	Revision    int64              `json:"revision"`
+}
+
+type AgentExpiryNotice struct {
+	ID             pgtype.UUID        `json:"id"`
+	Kind           string             `json:"kind"`
+	RefID          string             `json:"ref_id"`
+	ConversationID pgtype.UUID        `json:"conversation_id"`
+	ExpiresAt      pgtype.Timestamptz `json:"expires_at"`
+	NotifiedAt     pgtype.Timestamptz `json:"notified_at"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
 }
 
 type AgentMessage struct {
@@ -74,6 +106,49 @@ type AgentMessage struct {
 	AudioUrl       pgtype.Text        `json:"audio_url"`
 	Metadata       []byte             `json:"metadata"`
 	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	DeletedAt      pgtype.Timestamptz `json:"deleted_at"`
+}
+
+type AgentMessageEmbedding struct {
+	MessageID      pgtype.UUID        `json:"message_id"`
+	ConversationID pgtype.UUID        `json:"conversation_id"`
+	Model          string             `json:"model"`
+	Embedding      interface{}        `json:"embedding"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+type AgentOutboxEvent struct {
+	ID            pgtype.UUID        `json:"id"`
+	Kind          string             `json:"kind"`
+	Payload       []byte             `json:"payload"`
+	Attempts      int32              `json:"attempts"`
+	LastError     pgtype.Text        `json:"last_error"`
+	NextAttemptAt pgtype.Timestamptz `json:"next_attempt_at"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	CompletedAt   pgtype.Timestamptz `json:"completed_at"`
+}
+
+type AgentPolicyDraft struct {
+	ID             pgtype.UUID        `json:"id"`
+	ConversationID pgtype.UUID        `json:"conversation_id"`
+	PluginID       string             `json:"plugin_id"`
+	Configuration  []byte             `json:"configuration"`
+	PolicySuggest  []byte             `json:"policy_suggest"`
+	Status         string             `json:"status"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+}
+
+type AgentToolParseFailure struct {
+	ID            pgtype.UUID        `json:"id"`
+	Ability       string             `json:"ability"`
+	ToolName      string             `json:"tool_name"`
+	RawInput      string             `json:"raw_input"`
+	Error         string             `json:"error"`
+	Model         string             `json:"model"`
+	PromptVersion string             `json:"prompt_version"`
+	Rescued       bool               `json:"rescued"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
 }
 
 type AgentUserMemory struct {
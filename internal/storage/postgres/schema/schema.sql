@@ -11,10 +11,18 @@ CREATE TABLE agent_conversations (
     summary_up_to TIMESTAMPTZ,
     created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    archived_at TIMESTAMPTZ
+    archived_at TIMESTAMPTZ,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    imported BOOLEAN NOT NULL DEFAULT false,
+    labels TEXT[] NOT NULL DEFAULT '{}',
+    no_memory BOOLEAN NOT NULL DEFAULT false,
+    -- revision is bumped on every message insert, for read-your-writes checks
+    revision BIGINT NOT NULL DEFAULT 0
 );
 
 CREATE INDEX idx_agent_conversations_public_key ON agent_conversations(public_key);
+CREATE INDEX idx_agent_conversations_tags ON agent_conversations USING GIN (tags);
+CREATE INDEX idx_agent_conversations_labels ON agent_conversations USING GIN (labels);
 
 CREATE TABLE agent_messages (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -24,13 +32,101 @@ CREATE TABLE agent_messages (
     content_type VARCHAR(50) NOT NULL DEFAULT 'text',
     audio_url TEXT,
     metadata JSONB,
-    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMPTZ
 );
 
 CREATE INDEX idx_agent_messages_conversation ON agent_messages(conversation_id);
+CREATE INDEX idx_agent_messages_conversation_active ON agent_messages(conversation_id, created_at) WHERE deleted_at IS NULL;
 
 CREATE TABLE agent_user_memories (
     public_key VARCHAR(66) PRIMARY KEY,
     content TEXT NOT NULL DEFAULT '',
     updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 );
+
+CREATE TABLE agent_outbox_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_agent_outbox_events_pending ON agent_outbox_events(next_attempt_at) WHERE completed_at IS NULL;
+
+CREATE TABLE agent_contacts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    public_key VARCHAR(66) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    chain VARCHAR(50) NOT NULL,
+    address TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_agent_contacts_owner_name_chain ON agent_contacts(public_key, LOWER(name), chain);
+
+CREATE EXTENSION IF NOT EXISTS vector;
+
+CREATE TABLE agent_message_embeddings (
+    message_id UUID PRIMARY KEY REFERENCES agent_messages(id) ON DELETE CASCADE,
+    conversation_id UUID NOT NULL REFERENCES agent_conversations(id) ON DELETE CASCADE,
+    model VARCHAR(100) NOT NULL,
+    embedding vector NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_agent_message_embeddings_conversation ON agent_message_embeddings(conversation_id, model);
+
+CREATE TABLE agent_policy_drafts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    conversation_id UUID NOT NULL REFERENCES agent_conversations(id) ON DELETE CASCADE,
+    plugin_id VARCHAR(255) NOT NULL,
+    configuration JSONB NOT NULL,
+    policy_suggest JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_agent_policy_drafts_pending ON agent_policy_drafts(conversation_id, created_at) WHERE status = 'pending';
+
+CREATE TABLE agent_tool_parse_failures (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    ability VARCHAR(32) NOT NULL,
+    tool_name VARCHAR(64) NOT NULL,
+    raw_input TEXT NOT NULL,
+    error TEXT NOT NULL,
+    model VARCHAR(255) NOT NULL,
+    prompt_version VARCHAR(32) NOT NULL,
+    rescued BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_agent_tool_parse_failures_created_at ON agent_tool_parse_failures(created_at DESC);
+
+CREATE TABLE agent_expiry_notices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind VARCHAR(20) NOT NULL,
+    ref_id VARCHAR(100) NOT NULL,
+    conversation_id UUID NOT NULL REFERENCES agent_conversations(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    notified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_agent_expiry_notices_ref ON agent_expiry_notices(kind, ref_id);
+CREATE INDEX idx_agent_expiry_notices_due ON agent_expiry_notices(expires_at) WHERE notified_at IS NULL;
+
+CREATE TABLE agent_attachments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    public_key VARCHAR(66) NOT NULL,
+    content_type VARCHAR(50) NOT NULL,
+    size_bytes INTEGER NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_agent_attachments_public_key ON agent_attachments(public_key);
@@ -0,0 +1,14 @@
+-- Attachments table queries
+
+-- name: CreateAttachment :one
+INSERT INTO agent_attachments (public_key, content_type, size_bytes)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetAttachment :one
+SELECT * FROM agent_attachments
+WHERE id = $1 AND public_key = $2;
+
+-- name: ListAttachmentsByIDs :many
+SELECT * FROM agent_attachments
+WHERE public_key = sqlc.arg(public_key) AND id = ANY(sqlc.arg(ids)::uuid[]);
@@ -0,0 +1,23 @@
+-- name: CountContacts :one
+SELECT COUNT(*) FROM agent_contacts
+WHERE public_key = $1;
+
+-- name: CreateContact :one
+INSERT INTO agent_contacts (public_key, name, chain, address)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: DeleteContact :execrows
+DELETE FROM agent_contacts
+WHERE id = $1 AND public_key = $2;
+
+-- name: ListContacts :many
+SELECT * FROM agent_contacts
+WHERE public_key = $1
+ORDER BY LOWER(name), chain;
+
+-- name: UpdateContact :one
+UPDATE agent_contacts
+SET name = $3, chain = $4, address = $5
+WHERE id = $1 AND public_key = $2
+RETURNING *;
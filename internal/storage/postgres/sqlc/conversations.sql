@@ -1,29 +1,42 @@
 -- Conversations table queries
 
 -- name: CreateConversation :one
-INSERT INTO agent_conversations (public_key)
-VALUES ($1)
+INSERT INTO agent_conversations (public_key, no_memory)
+VALUES ($1, $2)
 RETURNING *;
 
 -- name: GetConversationByID :one
 SELECT * FROM agent_conversations
 WHERE id = $1 AND public_key = $2 AND archived_at IS NULL;
 
+-- name: GetConversationForAdmin :one
+-- Admin tooling only: not scoped to a public key, and includes archived conversations.
+SELECT * FROM agent_conversations
+WHERE id = $1;
+
 -- name: ListConversations :many
 SELECT * FROM agent_conversations
-WHERE public_key = $1 AND archived_at IS NULL
+WHERE public_key = sqlc.arg(public_key) AND archived_at IS NULL
+  AND tags @> sqlc.arg(tags)::text[]
+  AND agent_lower_labels(labels) @> sqlc.arg(labels)::text[]
 ORDER BY updated_at DESC
-LIMIT $2 OFFSET $3;
+LIMIT sqlc.arg(take) OFFSET sqlc.arg(skip);
 
 -- name: CountConversations :one
 SELECT COUNT(*) FROM agent_conversations
-WHERE public_key = $1 AND archived_at IS NULL;
+WHERE public_key = sqlc.arg(public_key) AND archived_at IS NULL
+  AND tags @> sqlc.arg(tags)::text[]
+  AND agent_lower_labels(labels) @> sqlc.arg(labels)::text[];
 
 -- name: ArchiveConversation :execrows
 UPDATE agent_conversations
 SET archived_at = NOW(), updated_at = NOW()
 WHERE id = $1 AND public_key = $2 AND archived_at IS NULL;
 
+-- name: DeleteConversation :execrows
+DELETE FROM agent_conversations
+WHERE id = $1 AND public_key = $2;
+
 -- name: UpdateConversationTitle :execrows
 UPDATE agent_conversations
 SET title = $1, updated_at = NOW()
@@ -37,3 +50,194 @@ WHERE id = $3 AND public_key = $4;
 -- name: GetConversationSummaryWithCursor :one
 SELECT summary, summary_up_to FROM agent_conversations
 WHERE id = $1 AND public_key = $2;
+
+-- name: CreateConversationWithSummary :one
+INSERT INTO agent_conversations (public_key, title, summary, summary_up_to, tags, no_memory)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: CreateImportedConversation :one
+INSERT INTO agent_conversations (public_key, title, imported)
+VALUES ($1, $2, true)
+RETURNING *;
+
+-- name: UpdateConversationTags :execrows
+-- Tags don't bump updated_at, so tagging doesn't reorder the conversation list.
+UPDATE agent_conversations
+SET tags = $1
+WHERE id = $2 AND public_key = $3 AND archived_at IS NULL;
+
+-- name: GetConversationNoMemory :one
+SELECT no_memory FROM agent_conversations
+WHERE id = $1 AND public_key = $2 AND archived_at IS NULL;
+
+-- name: GetConversationLabelsForUpdate :one
+-- Locks the row so concurrent label edits apply one after the other.
+SELECT labels FROM agent_conversations
+WHERE id = $1 AND public_key = $2 AND archived_at IS NULL
+FOR UPDATE;
+
+-- name: UpdateConversationLabels :execrows
+-- Like tags, labels don't bump updated_at.
+UPDATE agent_conversations
+SET labels = $1
+WHERE id = $2 AND public_key = $3 AND archived_at IS NULL;
+
+-- name: SetConversationTags :exec
+UPDATE agent_conversations
+SET tags = $1
+WHERE id = $2;
+
+-- name: ListConversationIDsAfter :many
+SELECT id FROM agent_conversations
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: ListConversationPublicKeysAfter :many
+-- Users with live conversations, in public key order, for walking them in batches.
+SELECT DISTINCT public_key FROM agent_conversations
+WHERE public_key > $1 AND archived_at IS NULL AND NOT imported
+ORDER BY public_key
+LIMIT $2;
+
+-- name: GetUserDailyConfidence :many
+-- Average intent confidence the model reported on the user's replies per day, from the
+-- confidence stored in assistant message metadata.
+SELECT date_trunc('day', m.created_at)::timestamptz AS day,
+    COUNT(*)::bigint AS replies,
+    AVG((m.metadata->>'confidence')::float8)::float8 AS average
+FROM agent_messages m
+JOIN agent_conversations c ON c.id = m.conversation_id
+WHERE c.public_key = $1 AND m.role = 'assistant' AND m.deleted_at IS NULL
+  AND m.created_at >= $2
+  AND jsonb_typeof(m.metadata->'confidence') = 'number'
+GROUP BY day
+ORDER BY day;
+
+-- name: GetUserStats :one
+SELECT
+    (SELECT COUNT(*) FROM agent_conversations c
+     WHERE c.public_key = sqlc.arg(public_key) AND c.archived_at IS NULL)::bigint AS conversations,
+    (SELECT COUNT(*) FROM agent_messages m
+     JOIN agent_conversations c ON c.id = m.conversation_id
+     WHERE c.public_key = sqlc.arg(public_key) AND c.archived_at IS NULL
+       AND m.deleted_at IS NULL)::bigint AS messages,
+    (SELECT COUNT(*) FROM agent_messages m
+     JOIN agent_conversations c ON c.id = m.conversation_id
+     WHERE c.public_key = sqlc.arg(public_key)
+       AND m.content_type = 'action_result'
+       AND m.metadata @> jsonb_build_object('action', sqlc.arg(automation_action)::text, 'success', true))::bigint AS automations,
+    (SELECT MIN(c.created_at) FROM agent_conversations c
+     WHERE c.public_key = sqlc.arg(public_key))::timestamptz AS member_since;
+
+-- name: GetUserTopicCounts :many
+SELECT tag::text AS tag, COUNT(*)::bigint AS conversations
+FROM agent_conversations c, unnest(c.tags) AS tag
+WHERE c.public_key = $1 AND c.archived_at IS NULL
+GROUP BY tag
+ORDER BY tag;
+
+-- name: ClearConversationSummaryCovering :exec
+-- Drops a summary that covers the given time, so it is rebuilt from the remaining messages.
+UPDATE agent_conversations
+SET summary = NULL, summary_up_to = NULL
+WHERE id = $1 AND summary_up_to >= $2;
+
+-- name: ListDuplicateCandidates :many
+-- Live conversations of the given users created within window_seconds of another of the same
+-- user, with their message counts and first user message, for spotting duplicates from double
+-- taps and retries.
+SELECT c.id, c.public_key, c.created_at, c.labels,
+    (SELECT COUNT(*) FROM agent_messages m
+     WHERE m.conversation_id = c.id AND m.deleted_at IS NULL)::bigint AS messages,
+    (SELECT COUNT(*) FROM agent_messages m
+     WHERE m.conversation_id = c.id AND m.deleted_at IS NULL AND m.role = 'user')::bigint AS user_messages,
+    COALESCE((SELECT m.content FROM agent_messages m
+     WHERE m.conversation_id = c.id AND m.deleted_at IS NULL AND m.role = 'user'
+     ORDER BY m.created_at LIMIT 1), '')::text AS first_message
+FROM agent_conversations c
+WHERE c.public_key = ANY(sqlc.arg(public_keys)::text[])
+  AND c.archived_at IS NULL AND NOT c.imported
+  AND EXISTS (
+    SELECT 1 FROM agent_conversations o
+    WHERE o.public_key = c.public_key AND o.id <> c.id
+      AND o.archived_at IS NULL AND NOT o.imported
+      AND o.created_at BETWEEN c.created_at - make_interval(secs => sqlc.arg(window_seconds)::float8)
+                           AND c.created_at + make_interval(secs => sqlc.arg(window_seconds)::float8)
+  )
+ORDER BY c.public_key, c.created_at;
+
+-- name: BumpConversationRevision :exec
+UPDATE agent_conversations
+SET revision = revision + sqlc.arg(messages)::bigint
+WHERE id = sqlc.arg(id);
+
+-- name: ArchiveDuplicateConversation :execrows
+-- Archives a duplicate only while it still has the number of messages it was judged by.
+UPDATE agent_conversations c
+SET archived_at = NOW(), updated_at = NOW()
+WHERE c.id = $1 AND c.archived_at IS NULL
+  AND (SELECT COUNT(*) FROM agent_messages m
+       WHERE m.conversation_id = c.id AND m.deleted_at IS NULL) = sqlc.arg(messages)::bigint;
+
+-- name: ListConversationsNeedingSummary :many
+-- Returns live conversations after after_id, in ID order, whose active messages (those past
+-- the summary cursor, or all before the first summary) exceed the trigger. revision counts
+-- every message ever stored, so it rules most conversations out before their messages are counted.
+SELECT c.id, c.public_key, a.active_messages
+FROM agent_conversations c
+CROSS JOIN LATERAL (
+    SELECT COUNT(*)::bigint AS active_messages FROM agent_messages m
+    WHERE m.conversation_id = c.id AND m.deleted_at IS NULL
+      AND (c.summary_up_to IS NULL OR m.created_at > c.summary_up_to)
+) a
+WHERE c.id > sqlc.arg(after_id) AND c.archived_at IS NULL
+  AND c.revision > sqlc.arg(trigger)
+  AND a.active_messages > sqlc.arg(trigger)
+ORDER BY c.id
+LIMIT sqlc.arg(max_results);
+
+-- name: BulkArchiveConversations :many
+-- Archives up to max_results of the user's live conversations, picked by ID or by last
+-- activity before older_than, and returns the IDs archived.
+UPDATE agent_conversations
+SET archived_at = NOW(), updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM agent_conversations
+    WHERE public_key = sqlc.arg(public_key) AND archived_at IS NULL
+      AND (id = ANY(sqlc.arg(ids)::uuid[]) OR updated_at < sqlc.narg(older_than))
+    ORDER BY id
+    LIMIT sqlc.arg(max_results)
+)
+  AND public_key = sqlc.arg(public_key) AND archived_at IS NULL
+RETURNING id;
+
+-- name: BulkRestoreConversations :many
+-- Restores up to max_results of the user's archived conversations, picked by ID or by
+-- archive time before older_than, and returns the IDs restored.
+UPDATE agent_conversations
+SET archived_at = NULL, updated_at = NOW()
+WHERE id IN (
+    SELECT id FROM agent_conversations
+    WHERE public_key = sqlc.arg(public_key) AND archived_at IS NOT NULL
+      AND (id = ANY(sqlc.arg(ids)::uuid[]) OR archived_at < sqlc.narg(older_than))
+    ORDER BY id
+    LIMIT sqlc.arg(max_results)
+)
+  AND public_key = sqlc.arg(public_key) AND archived_at IS NOT NULL
+RETURNING id;
+
+-- name: BulkDeleteArchivedConversations :many
+-- Permanently deletes up to max_results of the user's archived conversations, picked by ID
+-- or by archive time before older_than, and returns the IDs deleted.
+DELETE FROM agent_conversations
+WHERE id IN (
+    SELECT id FROM agent_conversations
+    WHERE public_key = sqlc.arg(public_key) AND archived_at IS NOT NULL
+      AND (id = ANY(sqlc.arg(ids)::uuid[]) OR archived_at < sqlc.narg(older_than))
+    ORDER BY id
+    LIMIT sqlc.arg(max_results)
+)
+  AND public_key = sqlc.arg(public_key) AND archived_at IS NOT NULL
+RETURNING id;
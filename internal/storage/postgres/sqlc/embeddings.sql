@@ -0,0 +1,33 @@
+-- Message embeddings queries
+
+-- name: UpsertMessageEmbedding :exec
+INSERT INTO agent_message_embeddings (message_id, conversation_id, model, embedding)
+VALUES (sqlc.arg(message_id), sqlc.arg(conversation_id), sqlc.arg(model), sqlc.arg(embedding)::text::vector)
+ON CONFLICT (message_id) DO UPDATE
+SET model = EXCLUDED.model, embedding = EXCLUDED.embedding, created_at = NOW();
+
+-- name: SearchMessageEmbeddings :many
+SELECT m.id, m.role, m.content, m.created_at,
+       (e.embedding <=> sqlc.arg(embedding)::text::vector)::float8 AS distance
+FROM agent_message_embeddings e
+JOIN agent_messages m ON m.id = e.message_id
+WHERE e.conversation_id = sqlc.arg(conversation_id)
+  AND e.model = sqlc.arg(model)
+  AND m.created_at < sqlc.arg(before)
+  AND m.deleted_at IS NULL
+ORDER BY distance
+LIMIT sqlc.arg(max_results);
+
+-- name: ListMessagesWithoutEmbedding :many
+-- Conversations and messages with memory turned off are never embedded.
+SELECT m.id, m.conversation_id, m.content
+FROM agent_messages m
+JOIN agent_conversations c ON c.id = m.conversation_id AND NOT c.no_memory
+LEFT JOIN agent_message_embeddings e ON e.message_id = m.id AND e.model = sqlc.arg(model)
+WHERE e.message_id IS NULL
+  AND m.role IN ('user', 'assistant')
+  AND m.content_type = 'text'
+  AND m.deleted_at IS NULL
+  AND COALESCE(m.metadata->>'no_memory', '') <> 'true'
+ORDER BY m.created_at
+LIMIT sqlc.arg(max_results);
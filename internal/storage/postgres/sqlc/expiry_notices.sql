@@ -0,0 +1,37 @@
+-- name: ClaimDueExpiryNotices :many
+-- Marks up to batch_size notices expiring within the window as notified and returns them with
+-- the conversation's owner. A notice is left alone once the conversation moved on: a message
+-- was added since, the conversation was archived, or the draft is no longer pending.
+UPDATE agent_expiry_notices n
+SET notified_at = NOW()
+FROM agent_conversations c
+WHERE n.id IN (
+    SELECT e.id FROM agent_expiry_notices e
+    JOIN agent_conversations ec ON ec.id = e.conversation_id
+    WHERE e.notified_at IS NULL
+      AND e.expires_at > NOW()
+      AND e.expires_at <= NOW() + make_interval(secs => sqlc.arg(window_seconds)::float8)
+      AND ec.archived_at IS NULL
+      AND NOT EXISTS (
+          SELECT 1 FROM agent_messages m
+          WHERE m.conversation_id = e.conversation_id AND m.created_at > e.created_at
+      )
+      AND (e.kind <> 'draft' OR EXISTS (
+          SELECT 1 FROM agent_policy_drafts d
+          WHERE d.id::text = e.ref_id AND d.status = 'pending'
+      ))
+    ORDER BY e.expires_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE OF e SKIP LOCKED
+)
+  AND c.id = n.conversation_id
+RETURNING n.id, n.kind, n.ref_id, n.conversation_id, n.expires_at, n.notified_at, n.created_at, c.public_key;
+
+-- name: CreateExpiryNotice :exec
+INSERT INTO agent_expiry_notices (kind, ref_id, conversation_id, expires_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (kind, ref_id) DO NOTHING;
+
+-- name: DeleteExpiryNoticesBefore :exec
+DELETE FROM agent_expiry_notices
+WHERE expires_at < $1;
@@ -1,36 +1,114 @@
 -- Messages table queries
 
 -- name: CreateMessage :one
+WITH bumped AS (
+    UPDATE agent_conversations SET revision = revision + 1
+    WHERE id = $1
+    RETURNING revision
+)
 INSERT INTO agent_messages (conversation_id, role, content, content_type, audio_url, metadata)
 VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING *;
+RETURNING *, (SELECT revision FROM bumped)::bigint AS revision;
+
+-- name: CreateMessageIfOwned :one
+WITH owned AS (
+    UPDATE agent_conversations SET revision = revision + 1
+    WHERE id = sqlc.arg(conversation_id) AND public_key = sqlc.arg(public_key) AND archived_at IS NULL
+    RETURNING id, revision
+)
+INSERT INTO agent_messages (conversation_id, role, content, content_type, audio_url, metadata)
+SELECT owned.id, sqlc.arg(role), sqlc.arg(content), sqlc.arg(content_type), sqlc.narg(audio_url), sqlc.narg(metadata)
+FROM owned
+RETURNING *, (SELECT revision FROM owned)::bigint AS revision;
+
+-- name: CreateImportedMessage :exec
+INSERT INTO agent_messages (conversation_id, role, content, content_type, metadata, created_at)
+VALUES ($1, $2, $3, $4, $5, $6);
 
 -- name: GetMessagesByConversationID :many
 SELECT * FROM agent_messages
-WHERE conversation_id = $1
+WHERE conversation_id = $1 AND deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: GetRecentMessages :many
 SELECT * FROM agent_messages
-WHERE conversation_id = $1
+WHERE conversation_id = $1 AND deleted_at IS NULL
 ORDER BY created_at DESC
 LIMIT $2;
 
 -- name: CountMessagesByConversationID :one
 SELECT COUNT(*) FROM agent_messages
-WHERE conversation_id = $1;
+WHERE conversation_id = $1 AND deleted_at IS NULL;
 
 -- name: CountMessagesSince :one
 SELECT COUNT(*) FROM agent_messages
-WHERE conversation_id = $1 AND created_at > $2;
+WHERE conversation_id = $1 AND created_at > $2 AND deleted_at IS NULL;
 
 -- name: GetMessagesSince :many
 SELECT * FROM agent_messages
-WHERE conversation_id = $1 AND created_at > $2
+WHERE conversation_id = $1 AND created_at > $2 AND deleted_at IS NULL
 ORDER BY created_at ASC;
 
 -- name: GetRecentMessagesSince :many
 SELECT * FROM agent_messages
-WHERE conversation_id = $1 AND created_at > $2
+WHERE conversation_id = $1 AND created_at > $2 AND deleted_at IS NULL
 ORDER BY created_at DESC
 LIMIT $3;
+
+-- name: ListMessages :many
+SELECT * FROM agent_messages
+WHERE conversation_id = $1
+ORDER BY created_at ASC
+LIMIT $2 OFFSET $3;
+
+-- name: ListReplayCandidates :many
+-- Assistant replies of the intent and policy abilities created in [from, to), optionally
+-- narrowed to an intent and a plugin. Ids are random, so ordering by them samples the range.
+SELECT * FROM agent_messages
+WHERE role = 'assistant' AND deleted_at IS NULL
+  AND created_at >= sqlc.arg(created_from) AND created_at < sqlc.arg(created_to)
+  AND metadata->'generation'->>'ability' IN ('intent', 'policy')
+  AND (sqlc.narg(intent)::text IS NULL OR metadata->>'intent' = sqlc.narg(intent))
+  AND (sqlc.narg(plugin_id)::text IS NULL
+    OR metadata->>'plugin_id' = sqlc.narg(plugin_id)
+    OR metadata->'suggestions' @> jsonb_build_array(jsonb_build_object('plugin_id', sqlc.narg(plugin_id)::text)))
+ORDER BY id
+LIMIT sqlc.arg(max_results);
+
+-- name: CopyMessages :execrows
+INSERT INTO agent_messages (conversation_id, role, content, content_type, audio_url, metadata, created_at)
+SELECT sqlc.arg(target_id)::uuid, role, content, content_type, audio_url, metadata, created_at
+FROM agent_messages
+WHERE conversation_id = sqlc.arg(source_id)
+  AND (sqlc.narg(cutoff)::timestamptz IS NULL OR created_at <= sqlc.narg(cutoff))
+  AND deleted_at IS NULL
+ORDER BY created_at;
+
+-- name: GetMessageCreatedAt :one
+SELECT created_at FROM agent_messages
+WHERE id = $1 AND conversation_id = $2;
+
+-- name: GetMessageByID :one
+SELECT * FROM agent_messages
+WHERE id = $1 AND conversation_id = $2 AND deleted_at IS NULL;
+
+-- name: GetMessageHistoryByConversationID :many
+-- Unlike GetMessagesByConversationID this includes deleted messages, as tombstones.
+SELECT * FROM agent_messages
+WHERE conversation_id = $1
+ORDER BY created_at ASC;
+
+-- name: CountMessageHistoryByConversationID :one
+SELECT COUNT(*) FROM agent_messages
+WHERE conversation_id = $1;
+
+-- name: SoftDeleteMessage :one
+-- Content is wiped along with the delete, leaving a tombstone that keeps the message's place.
+UPDATE agent_messages m
+SET deleted_at = COALESCE(m.deleted_at, NOW()),
+    content = '', content_type = 'deleted', audio_url = NULL, metadata = NULL
+FROM agent_conversations c
+WHERE m.id = sqlc.arg(id) AND m.conversation_id = sqlc.arg(conversation_id)
+  AND m.role IN ('user', 'assistant')
+  AND c.id = m.conversation_id AND c.public_key = sqlc.arg(public_key) AND c.archived_at IS NULL
+RETURNING m.created_at;
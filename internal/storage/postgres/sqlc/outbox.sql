@@ -0,0 +1,32 @@
+-- name: ClaimOutboxEvents :many
+UPDATE agent_outbox_events
+SET next_attempt_at = sqlc.arg(lease_until)
+WHERE id IN (
+    SELECT id FROM agent_outbox_events
+    WHERE completed_at IS NULL
+      AND next_attempt_at <= NOW()
+      AND attempts < sqlc.arg(max_attempts)
+    ORDER BY next_attempt_at
+    LIMIT sqlc.arg(batch_size)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteOutboxEvent :exec
+UPDATE agent_outbox_events
+SET completed_at = NOW()
+WHERE id = $1;
+
+-- name: CreateOutboxEvent :one
+INSERT INTO agent_outbox_events (kind, payload, next_attempt_at)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: DeleteCompletedOutboxEvents :exec
+DELETE FROM agent_outbox_events
+WHERE completed_at IS NOT NULL AND completed_at < $1;
+
+-- name: FailOutboxEvent :exec
+UPDATE agent_outbox_events
+SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+WHERE id = $1;
@@ -0,0 +1,22 @@
+-- name: CreatePolicyDraft :one
+INSERT INTO agent_policy_drafts (id, conversation_id, plugin_id, configuration, policy_suggest)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetPendingPolicyDraft :one
+SELECT d.* FROM agent_policy_drafts d
+JOIN agent_conversations c ON c.id = d.conversation_id
+WHERE d.conversation_id = sqlc.arg(conversation_id) AND c.public_key = sqlc.arg(public_key)
+  AND d.status = 'pending' AND d.created_at > sqlc.arg(created_after)
+ORDER BY d.created_at DESC
+LIMIT 1;
+
+-- name: UpdatePendingPolicyDrafts :execrows
+UPDATE agent_policy_drafts
+SET status = $2, updated_at = NOW()
+WHERE conversation_id = $1 AND status = 'pending';
+
+-- name: UpdatePolicyDraftStatus :execrows
+UPDATE agent_policy_drafts
+SET status = $3, updated_at = NOW()
+WHERE id = $1 AND conversation_id = $2 AND status = 'pending';
@@ -0,0 +1,45 @@
+-- Maintenance queries merging public keys that differ only by case into their lowercase spelling
+
+-- name: CountMixedCasePublicKeys :one
+SELECT COUNT(DISTINCT public_key) FROM (
+    SELECT public_key FROM agent_conversations
+    UNION ALL SELECT public_key FROM agent_contacts
+    UNION ALL SELECT public_key FROM agent_user_memories
+) k
+WHERE public_key <> LOWER(public_key);
+
+-- name: LowercaseConversationPublicKeys :execrows
+UPDATE agent_conversations
+SET public_key = LOWER(public_key)
+WHERE public_key <> LOWER(public_key);
+
+-- name: DeleteDuplicateCaseContacts :execrows
+-- Keeps the lowercase-key contact, else the oldest, of contacts that collide once lowercased.
+DELETE FROM agent_contacts c
+WHERE c.public_key <> LOWER(c.public_key)
+  AND EXISTS (
+    SELECT 1 FROM agent_contacts o
+    WHERE o.id <> c.id AND LOWER(o.public_key) = LOWER(c.public_key)
+      AND LOWER(o.name) = LOWER(c.name) AND o.chain = c.chain
+      AND (o.public_key = LOWER(o.public_key) OR o.created_at < c.created_at
+           OR (o.created_at = c.created_at AND o.id < c.id))
+  );
+
+-- name: LowercaseContactPublicKeys :execrows
+UPDATE agent_contacts
+SET public_key = LOWER(public_key)
+WHERE public_key <> LOWER(public_key);
+
+-- name: DeleteDuplicateCaseMemories :execrows
+-- Keeps the most recently updated memory document of keys that collide once lowercased.
+DELETE FROM agent_user_memories m
+WHERE EXISTS (
+    SELECT 1 FROM agent_user_memories o
+    WHERE o.public_key <> m.public_key AND LOWER(o.public_key) = LOWER(m.public_key)
+      AND (o.updated_at > m.updated_at OR (o.updated_at = m.updated_at AND o.public_key < m.public_key))
+);
+
+-- name: LowercaseMemoryPublicKeys :execrows
+UPDATE agent_user_memories
+SET public_key = LOWER(public_key)
+WHERE public_key <> LOWER(public_key);
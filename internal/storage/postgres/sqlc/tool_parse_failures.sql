@@ -0,0 +1,13 @@
+-- name: CreateToolParseFailure :one
+INSERT INTO agent_tool_parse_failures (ability, tool_name, raw_input, error, model, prompt_version, rescued)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING *;
+
+-- name: ListToolParseFailures :many
+SELECT * FROM agent_tool_parse_failures
+ORDER BY created_at DESC
+LIMIT $1;
+
+-- name: GetToolParseFailure :one
+SELECT * FROM agent_tool_parse_failures
+WHERE id = $1;
@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/vultisig/agent-backend/internal/storage/postgres/queries"
+	"github.com/vultisig/agent-backend/internal/types"
+)
+
+// ToolParseFailureRepository handles persistence of tool inputs that failed to parse.
+type ToolParseFailureRepository struct {
+	q *queries.Queries
+}
+
+// NewToolParseFailureRepository creates a new ToolParseFailureRepository.
+func NewToolParseFailureRepository(pool *pgxpool.Pool) *ToolParseFailureRepository {
+	return &ToolParseFailureRepository{q: queries.New(pool)}
+}
+
+// Create stores a parse failure, filling in its ID and creation time.
+func (r *ToolParseFailureRepository) Create(ctx context.Context, f *types.ToolParseFailure) error {
+	result, err := r.q.CreateToolParseFailure(ctx, &queries.CreateToolParseFailureParams{
+		Ability:       f.Ability,
+		ToolName:      f.ToolName,
+		RawInput:      f.RawInput,
+		Error:         f.Error,
+		Model:         f.Model,
+		PromptVersion: f.PromptVersion,
+		Rescued:       f.Rescued,
+	})
+	if err != nil {
+		return fmt.Errorf("create tool parse failure: %w", err)
+	}
+	*f = *toolParseFailureFromDB(result)
+	return nil
+}
+
+// ListRecent returns the latest parse failures, newest first.
+func (r *ToolParseFailureRepository) ListRecent(ctx context.Context, limit int) ([]types.ToolParseFailure, error) {
+	results, err := r.q.ListToolParseFailures(ctx, int32(limit))
+	if err != nil {
+		return nil, fmt.Errorf("list tool parse failures: %w", err)
+	}
+
+	failures := make([]types.ToolParseFailure, len(results))
+	for i, f := range results {
+		failures[i] = *toolParseFailureFromDB(f)
+	}
+	return failures, nil
+}
+
+// GetByID returns a parse failure. Returns ErrNotFound if there is none with the ID.
+func (r *ToolParseFailureRepository) GetByID(ctx context.Context, id uuid.UUID) (*types.ToolParseFailure, error) {
+	result, err := r.q.GetToolParseFailure(ctx, uuidToPgtype(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("get tool parse failure: %w", err)
+	}
+	return toolParseFailureFromDB(result), nil
+}
@@ -0,0 +1,16 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Attachment is an image a user uploaded to send with a message. Its data is kept in blob
+// storage; messages reference it by ID.
+type Attachment struct {
+	ID          uuid.UUID `json:"id"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int       `json:"size_bytes"`
+	CreatedAt   time.Time `json:"created_at"`
+}
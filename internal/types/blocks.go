@@ -0,0 +1,183 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// Block types for structured assistant message content.
+const (
+	BlockTypeText          = "text"
+	BlockTypePolicyPreview = "policy_preview"
+	BlockTypeKeyValueTable = "key_value_table"
+	BlockTypeLink          = "link"
+)
+
+// maxBlocksPerMessage bounds how many blocks a single message may carry.
+const maxBlocksPerMessage = 20
+
+// Block is a typed piece of structured assistant output that the app renders as a card.
+// Message content stays the plain-text fallback for clients that don't render blocks.
+// Which fields are set depends on Type; see BlocksJSONSchema.
+type Block struct {
+	Type     string        `json:"type"`
+	Title    string        `json:"title,omitempty"`
+	Text     string        `json:"text,omitempty"`      // text
+	PluginID string        `json:"plugin_id,omitempty"` // policy_preview
+	Rows     []KeyValue    `json:"rows,omitempty"`      // policy_preview, key_value_table
+	Rules    []RulePreview `json:"rules,omitempty"`     // policy_preview
+	URL      string        `json:"url,omitempty"`       // link
+}
+
+// KeyValue is a labeled value in a table-like block.
+type KeyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// RulePreview is a human-readable summary of a policy rule.
+type RulePreview struct {
+	Resource    string     `json:"resource"`
+	Effect      string     `json:"effect,omitempty"`
+	Target      string     `json:"target,omitempty"`
+	Constraints []KeyValue `json:"constraints,omitempty"`
+}
+
+// BlocksJSONSchema describes the blocks array stored in assistant message metadata.
+const BlocksJSONSchema = `{
+  "type": "array",
+  "maxItems": 20,
+  "items": {
+    "oneOf": [
+      {
+        "type": "object",
+        "properties": {
+          "type": {"const": "text"},
+          "title": {"type": "string"},
+          "text": {"type": "string", "minLength": 1}
+        },
+        "required": ["type", "text"]
+      },
+      {
+        "type": "object",
+        "properties": {
+          "type": {"const": "policy_preview"},
+          "title": {"type": "string", "minLength": 1},
+          "plugin_id": {"type": "string", "minLength": 1},
+          "rows": {"$ref": "#/$defs/rows"},
+          "rules": {
+            "type": "array",
+            "items": {
+              "type": "object",
+              "properties": {
+                "resource": {"type": "string", "minLength": 1},
+                "effect": {"type": "string"},
+                "target": {"type": "string"},
+                "constraints": {"$ref": "#/$defs/rows"}
+              },
+              "required": ["resource"]
+            }
+          }
+        },
+        "required": ["type", "title", "plugin_id"]
+      },
+      {
+        "type": "object",
+        "properties": {
+          "type": {"const": "key_value_table"},
+          "title": {"type": "string"},
+          "rows": {"$ref": "#/$defs/rows", "minItems": 1}
+        },
+        "required": ["type", "rows"]
+      },
+      {
+        "type": "object",
+        "properties": {
+          "type": {"const": "link"},
+          "title": {"type": "string", "minLength": 1},
+          "url": {"type": "string", "format": "uri", "pattern": "^https://"}
+        },
+        "required": ["type", "title", "url"]
+      }
+    ]
+  },
+  "$defs": {
+    "rows": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "key": {"type": "string", "minLength": 1},
+          "value": {"type": "string"}
+        },
+        "required": ["key", "value"]
+      }
+    }
+  }
+}`
+
+// Validate checks a block against the rules in BlocksJSONSchema.
+func (b Block) Validate() error {
+	switch b.Type {
+	case BlockTypeText:
+		if b.Text == "" {
+			return errors.New("text block requires text")
+		}
+	case BlockTypePolicyPreview:
+		if b.Title == "" || b.PluginID == "" {
+			return errors.New("policy_preview block requires title and plugin_id")
+		}
+		if err := validateRows(b.Rows); err != nil {
+			return err
+		}
+		for _, r := range b.Rules {
+			if r.Resource == "" {
+				return errors.New("policy_preview rule requires resource")
+			}
+			if err := validateRows(r.Constraints); err != nil {
+				return err
+			}
+		}
+	case BlockTypeKeyValueTable:
+		if len(b.Rows) == 0 {
+			return errors.New("key_value_table block requires rows")
+		}
+		if err := validateRows(b.Rows); err != nil {
+			return err
+		}
+	case BlockTypeLink:
+		if b.Title == "" {
+			return errors.New("link block requires title")
+		}
+		u, err := url.Parse(b.URL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("link block requires an https url, got %q", b.URL)
+		}
+	default:
+		return fmt.Errorf("unknown block type %q", b.Type)
+	}
+	return nil
+}
+
+// ValidateBlocks validates every block and the number of blocks.
+func ValidateBlocks(blocks []Block) error {
+	if len(blocks) > maxBlocksPerMessage {
+		return fmt.Errorf("too many blocks: %d (max %d)", len(blocks), maxBlocksPerMessage)
+	}
+	for i, b := range blocks {
+		if err := b.Validate(); err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func validateRows(rows []KeyValue) error {
+	for _, r := range rows {
+		if r.Key == "" {
+			return errors.New("row requires key")
+		}
+	}
+	return nil
+}
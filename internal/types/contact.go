@@ -0,0 +1,17 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Contact is a named address in a user's address book.
+type Contact struct {
+	ID        uuid.UUID `json:"id"`
+	PublicKey string    `json:"public_key"`
+	Name      string    `json:"name"`
+	Chain     string    `json:"chain"`
+	Address   string    `json:"address"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -26,6 +26,17 @@ type Conversation struct {
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
 	ArchivedAt   *time.Time `json:"archived_at,omitempty"`
+	// Tags are topic tags derived from the conversation's intents and suggestions
+	Tags []string `json:"tags"`
+	// Imported is set on conversations migrated from the legacy assistant
+	Imported bool `json:"imported,omitempty"`
+	// Labels are user-chosen organizational labels, distinct from the title and topic tags
+	Labels []string `json:"labels"`
+	// NoMemory is set on conversations that neither read nor update the user's memory
+	NoMemory bool `json:"no_memory,omitempty"`
+	// Revision counts the messages ever stored in the conversation; it only grows, so a
+	// read can be checked against the revision a write returned
+	Revision int64 `json:"revision"`
 }
 
 // Message represents a single message in a conversation.
@@ -37,7 +48,11 @@ type Message struct {
 	ContentType    string          `json:"content_type"`
 	AudioURL       *string         `json:"audio_url,omitempty"`
 	Metadata       json.RawMessage `json:"metadata,omitempty"`
+	Blocks         []Block         `json:"blocks,omitempty"` // structured cards, stored under metadata.blocks
 	CreatedAt      time.Time       `json:"created_at"`
+	DeletedAt      *time.Time      `json:"deleted_at,omitempty"` // set on tombstones, whose content_type is "deleted"
+	// Revision is the conversation's revision after the message was stored; set on create only
+	Revision int64 `json:"-"`
 }
 
 // ConversationWithMessages includes a conversation and its messages.
@@ -46,6 +61,34 @@ type ConversationWithMessages struct {
 	Messages []Message `json:"messages"`
 }
 
+// DuplicateCandidate is a conversation created close to another of the same user, with
+// what is needed to tell whether it duplicates it.
+type DuplicateCandidate struct {
+	ID           uuid.UUID
+	PublicKey    string
+	CreatedAt    time.Time
+	Labels       []string
+	Messages     int64
+	UserMessages int64
+	// FirstMessage is the first user message, empty when there is none
+	FirstMessage string
+}
+
+// SummaryCandidate is a conversation whose active messages have grown past the summarize
+// trigger since its last summary.
+type SummaryCandidate struct {
+	ID             uuid.UUID
+	PublicKey      string
+	ActiveMessages int64
+}
+
+// BulkFilter picks the conversations a bulk operation applies to: those listed in IDs, or
+// those older than OlderThan. Only one of the two is set.
+type BulkFilter struct {
+	IDs       []uuid.UUID
+	OlderThan *time.Time
+}
+
 // UserMemory represents a user's persistent memory document.
 type UserMemory struct {
 	PublicKey string    `json:"public_key"`
@@ -0,0 +1,27 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of items an expiry notice is sent for.
+const (
+	ExpiryNoticeDraft      = "draft"
+	ExpiryNoticeSuggestion = "suggestion"
+)
+
+// ExpiryNotice tracks a policy draft or a message's suggestions so their owner can be told
+// shortly before they expire. RefID is the draft ID for drafts and the assistant message ID
+// for suggestions; PublicKey is filled in when a notice is claimed.
+type ExpiryNotice struct {
+	ID             uuid.UUID  `json:"id"`
+	Kind           string     `json:"kind"`
+	RefID          string     `json:"ref_id"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	PublicKey      string     `json:"public_key,omitempty"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	NotifiedAt     *time.Time `json:"notified_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Policy draft statuses. Only the latest draft of a conversation is pending; it is
+// superseded by the next build and resolved when the app reports the create_policy result.
+const (
+	PolicyDraftPending    = "pending"
+	PolicyDraftSuperseded = "superseded"
+	PolicyDraftConsumed   = "consumed"
+	PolicyDraftDiscarded  = "discarded"
+)
+
+// PolicyDraft is a built policy configuration kept until the user confirms or declines it,
+// so the confirm sheet can be restored without building the policy again.
+type PolicyDraft struct {
+	ID             uuid.UUID       `json:"id"`
+	ConversationID uuid.UUID       `json:"conversation_id"`
+	PluginID       string          `json:"plugin_id"`
+	Configuration  json.RawMessage `json:"configuration"`
+	PolicySuggest  json.RawMessage `json:"policy_suggest"`
+	Status         string          `json:"status"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
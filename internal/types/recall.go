@@ -0,0 +1,17 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RecalledMessage is an older message retrieved for its similarity to the incoming one.
+type RecalledMessage struct {
+	ID        uuid.UUID   `json:"id"`
+	Role      MessageRole `json:"role"`
+	Content   string      `json:"content"`
+	CreatedAt time.Time   `json:"created_at"`
+	// Distance is the cosine distance to the query; lower is more similar
+	Distance float64 `json:"distance"`
+}
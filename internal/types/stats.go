@@ -0,0 +1,23 @@
+package types
+
+import "time"
+
+// UserStats aggregates a user's activity for their profile.
+type UserStats struct {
+	Conversations int64      `json:"conversations"`
+	Messages      int64      `json:"messages"`
+	Automations   int64      `json:"automations"`
+	MemberSince   *time.Time `json:"member_since,omitempty"`
+	// Topics counts active conversations per topic tag
+	Topics map[string]int64 `json:"topics,omitempty"`
+	// Confidence is the intent confidence the model reported on the user's replies per day,
+	// oldest first, for tracking its calibration over time
+	Confidence []DailyConfidence `json:"confidence,omitempty"`
+}
+
+// DailyConfidence is the model's reported intent confidence over one day's replies.
+type DailyConfidence struct {
+	Day     time.Time `json:"day"`
+	Replies int64     `json:"replies"`
+	Average float64   `json:"average"`
+}
@@ -0,0 +1,21 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ToolParseFailure is a tool call whose input could not be parsed strictly, kept so the
+// prompt that produced it can be debugged. Rescued is set when a lenient parse recovered it.
+type ToolParseFailure struct {
+	ID            uuid.UUID `json:"id"`
+	Ability       string    `json:"ability"`
+	ToolName      string    `json:"tool_name"`
+	RawInput      string    `json:"raw_input"`
+	Error         string    `json:"error"`
+	Model         string    `json:"model"`
+	PromptVersion string    `json:"prompt_version"`
+	Rescued       bool      `json:"rescued"`
+	CreatedAt     time.Time `json:"created_at"`
+}